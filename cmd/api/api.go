@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// apiCmdConfig holds the options of the api command.
+type apiCmdConfig struct {
+	Listen string
+	Token  string
+}
+
+// ApiCmd is the api subcommand.
+var ApiCmd = newAPICommand()
+
+func newAPICommand() *cobra.Command {
+	cfg := &apiCmdConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "api",
+		Short: "Serves a REST API over the database and xray-knife's operations",
+		Long: `Starts an HTTP server exposing the database and the main operations as a JSON
+REST API, so web front-ends and bots can be built on top of xray-knife without
+shelling out to the CLI.
+
+Every request must carry the token as "Authorization: Bearer <token>". The token
+is taken from --token or the XRAY_KNIFE_API_TOKEN environment variable; without
+one, the server only listens on a loopback address and refuses requests whose
+Host or Origin isn't a loopback one, so web pages can't reach it. Request bodies
+must be sent as Content-Type: application/json.
+
+Endpoints (all under /api/v1):
+  GET    /subscriptions                 list subscriptions
+  POST   /subscriptions                 add one: {"url", "remark", "user_agent"}
+  GET    /subscriptions/{id}            show one
+  PATCH  /subscriptions/{id}            edit: {"url", "remark", "user_agent", "enabled", "priority"}
+  DELETE /subscriptions/{id}            remove one and the configs only it provided
+  POST   /subscriptions/{id}/fetch      fetch one in the background
+  POST   /subscriptions/fetch           fetch every enabled subscription
+  GET    /configs                       list or search configs: ?sub=, protocol=,
+                                        q=, where=, limit=, offset=
+  GET    /configs/{id}                  show one
+  PATCH  /configs/{id}                  edit: {"enabled", "notes"}
+  POST   /tests                         test configs in the background (see below)
+  GET    /jobs, /jobs/{id}              state of background fetches and tests
+  GET    /runs                          stored test runs: ?limit=
+  GET    /runs/{id}/results             results of a run: ?status=
+
+POST /tests takes {"links": [...]} or DB filters {"sub", "protocol", "where",
+"limit"} (enabled, parsed configs only), and the test options {"threads", "core",
+"url", "max_delay", "timeout", "retries", "insecure"}. Results are stored as a
+test run, whose ID is returned with the job. "where" uses the filter language of
+'xray-knife subs disable --where'.
+
+Only one fetch and one test run at a time; starting another returns 409.
+
+Examples:
+  xray-knife api --token s3cret
+  xray-knife api --listen 0.0.0.0:8989 --token s3cret
+  curl -H "Authorization: Bearer s3cret" localhost:8989/api/v1/configs?protocol=vless`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("token") {
+				cfg.Token = os.Getenv("XRAY_KNIFE_API_TOKEN")
+			}
+			if cfg.Token == "" && !utils.IsLoopbackAddr(cfg.Listen) {
+				return fmt.Errorf("refusing to serve on %s without a token: set --token or XRAY_KNIFE_API_TOKEN", cfg.Listen)
+			}
+			return runServer(cmd.Context(), cfg)
+		},
+	}
+
+	cmd.Flags().StringVarP(&cfg.Listen, "listen", "l", "127.0.0.1:8989", "Address to listen on")
+	cmd.Flags().StringVar(&cfg.Token, "token", "", "Bearer token required on every request (env XRAY_KNIFE_API_TOKEN)")
+	return cmd
+}
+
+// runServer serves the API until ctx is done, then cancels the running jobs.
+func runServer(ctx context.Context, cfg *apiCmdConfig) error {
+	jobCtx, cancelJobs := context.WithCancel(ctx)
+	defer cancelJobs()
+	s := newServer(jobCtx, cfg.Token)
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+	srv := &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+	customlog.Printf(customlog.Success, "API listening on http://%s/api/v1/\n", ln.Addr())
+	if cfg.Token == "" {
+		customlog.Printf(customlog.Warning, "No token set: any local process can use the API.\n")
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("API server failed: %w", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	cancelJobs()
+	s.jobs.wait()
+	return nil
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+)
+
+func newTestServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ts := httptest.NewServer(newServer(ctx, token).routes())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func do(t *testing.T, ts *httptest.Server, method, path, token, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t, "s3cret")
+	if code, _ := do(t, ts, "GET", "/api/v1/subscriptions", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", code)
+	}
+	if code, _ := do(t, ts, "GET", "/api/v1/subscriptions", "wrong", ""); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", code)
+	}
+	if code, _ := do(t, ts, "GET", "/api/v1/subscriptions", "s3cret", ""); code != http.StatusOK {
+		t.Errorf("valid token: status %d, want 200", code)
+	}
+}
+
+func TestCrossSiteRequests(t *testing.T) {
+	ts := newTestServer(t, "")
+	send := func(method, path, body string, header map[string]string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			if k == "Host" {
+				req.Host = v
+			} else {
+				req.Header.Set(k, v)
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	const sub = `{"url": "https://example.com/sub"}`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{"form post", "POST", "/api/v1/subscriptions", sub, map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"no content type", "POST", "/api/v1/subscriptions", sub, nil, http.StatusUnsupportedMediaType},
+		{"other origin", "POST", "/api/v1/subscriptions/fetch", "", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"rebound host", "GET", "/api/v1/subscriptions", "", map[string]string{"Host": "evil.example:8989"}, http.StatusForbidden},
+		{"local origin", "GET", "/api/v1/subscriptions", "", map[string]string{"Origin": "http://localhost:3000"}, http.StatusOK},
+		{"json", "POST", "/api/v1/subscriptions", sub, map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if code := send(tt.method, tt.path, tt.body, tt.header); code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestSubscriptionCRUD(t *testing.T) {
+	ts := newTestServer(t, "")
+
+	code, body := do(t, ts, "POST", "/api/v1/subscriptions", "", `{"url": "https://example.com/sub", "remark": "main"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("add: status %d: %s", code, body)
+	}
+	var sub subscriptionJSON
+	if err := json.Unmarshal([]byte(body), &sub); err != nil {
+		t.Fatal(err)
+	}
+	if sub.ID == 0 || sub.Remark != "main" || !sub.Enabled {
+		t.Errorf("add returned %+v", sub)
+	}
+
+	if code, _ := do(t, ts, "POST", "/api/v1/subscriptions", "", `{"url": "https://example.com/sub"}`); code != http.StatusConflict {
+		t.Errorf("duplicate add: status %d, want 409", code)
+	}
+	if code, _ := do(t, ts, "POST", "/api/v1/subscriptions", "", `{"url": "not a url"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid URL: status %d, want 400", code)
+	}
+	if code, _ := do(t, ts, "POST", "/api/v1/subscriptions", "", `{"link": "https://example.com/x"}`); code != http.StatusBadRequest {
+		t.Errorf("unknown field: status %d, want 400", code)
+	}
+
+	code, body = do(t, ts, "PATCH", "/api/v1/subscriptions/1", "", `{"enabled": false}`)
+	if code != http.StatusOK || !strings.Contains(body, `"enabled":false`) {
+		t.Errorf("update: status %d: %s", code, body)
+	}
+
+	if code, _ := do(t, ts, "DELETE", "/api/v1/subscriptions/1", "", ""); code != http.StatusNoContent {
+		t.Errorf("delete: status %d, want 204", code)
+	}
+	if code, _ := do(t, ts, "GET", "/api/v1/subscriptions/1", "", ""); code != http.StatusNotFound {
+		t.Errorf("get deleted: status %d, want 404", code)
+	}
+	if code, _ := do(t, ts, "GET", "/api/v1/subscriptions/abc", "", ""); code != http.StatusBadRequest {
+		t.Errorf("bad ID: status %d, want 400", code)
+	}
+}
+
+func TestListConfigs(t *testing.T) {
+	ts := newTestServer(t, "")
+	now := time.Now()
+	err := database.UpsertSubscriptionConfigs([]database.SubscriptionConfig{
+		{ConfigLink: "vless://a", Protocol: sql.NullString{String: "vless", Valid: true}, Remark: sql.NullString{String: "Germany 1", Valid: true}, LastSeenAt: sql.NullTime{Time: now, Valid: true}},
+		{ConfigLink: "ss://b", Protocol: sql.NullString{String: "ss", Valid: true}, Remark: sql.NullString{String: "Japan", Valid: true}, LastSeenAt: sql.NullTime{Time: now, Valid: true}},
+		{ConfigLink: "vless://c", Protocol: sql.NullString{String: "vless", Valid: true}, Remark: sql.NullString{String: "Germany 2", Valid: true}, LastSeenAt: sql.NullTime{Time: now, Valid: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) (int, []configJSON) {
+		t.Helper()
+		code, body := do(t, ts, "GET", "/api/v1/configs"+query, "", "")
+		if code != http.StatusOK {
+			t.Fatalf("list %s: status %d: %s", query, code, body)
+		}
+		var page struct {
+			Items []configJSON `json:"items"`
+			Total int          `json:"total"`
+		}
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		return page.Total, page.Items
+	}
+
+	if total, _ := list(""); total != 3 {
+		t.Errorf("all configs: total %d, want 3", total)
+	}
+	if total, items := list("?protocol=vless&limit=1"); total != 2 || len(items) != 1 {
+		t.Errorf("vless page: total %d, %d items, want 2 and 1", total, len(items))
+	}
+	if total, _ := list("?q=germany"); total != 2 {
+		t.Errorf("search: total %d, want 2", total)
+	}
+	if total, items := list("?where=" + "remark%20%3D%20%27Japan%27"); total != 1 || items[0].Link != "ss://b" {
+		t.Errorf("where: total %d, items %+v", total, items)
+	}
+	if code, _ := do(t, ts, "GET", "/api/v1/configs?where=password%3D1", "", ""); code != http.StatusBadRequest {
+		t.Errorf("invalid where: status %d, want 400", code)
+	}
+
+	code, body := do(t, ts, "PATCH", "/api/v1/configs/2", "", `{"enabled": false, "notes": "slow"}`)
+	if code != http.StatusOK || !strings.Contains(body, `"enabled":false`) || !strings.Contains(body, `"notes":"slow"`) {
+		t.Errorf("update config: status %d: %s", code, body)
+	}
+}
+
+func TestJobManagerOneJobPerKind(t *testing.T) {
+	m := newJobManager(context.Background())
+	release := make(chan struct{})
+	first, err := m.start("test", 7, func(ctx context.Context, update func(func(*job))) error {
+		update(func(j *job) { j.Total = 3 })
+		<-release
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.start("test", 0, func(context.Context, func(func(*job))) error { return nil }); err == nil {
+		t.Error("second test job started while the first was running")
+	}
+	if _, err := m.start("fetch", 0, func(context.Context, func(func(*job))) error { return nil }); err != nil {
+		t.Errorf("fetch job blocked by a test job: %v", err)
+	}
+
+	close(release)
+	m.wait()
+	j, ok := m.get(first.ID)
+	if !ok || j.State != jobFailed || j.Error != "boom" || j.RunID != 7 || j.Total != 3 || j.FinishedAt == nil {
+		t.Errorf("finished job = %+v", j)
+	}
+	if len(m.list()) != 2 {
+		t.Errorf("list has %d jobs, want 2", len(m.list()))
+	}
+}
+
+func TestRejectLocalSubscriptions(t *testing.T) {
+	ts := newTestServer(t, "")
+	for _, u := range []string{"file:///etc/passwd", "/etc/passwd"} {
+		if code, _ := do(t, ts, "POST", "/api/v1/subscriptions", "", `{"url": "`+u+`"}`); code != http.StatusBadRequest {
+			t.Errorf("add %s: status %d, want 400", u, code)
+		}
+	}
+}
@@ -0,0 +1,771 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// server holds the state shared by the API handlers.
+type server struct {
+	token string
+	jobs  *jobManager
+}
+
+// newServer returns an API server whose background jobs stop when ctx is done.
+func newServer(ctx context.Context, token string) *server {
+	return &server{token: token, jobs: newJobManager(ctx)}
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/subscriptions", s.handleListSubscriptions)
+	mux.HandleFunc("POST /api/v1/subscriptions", s.handleAddSubscription)
+	mux.HandleFunc("POST /api/v1/subscriptions/fetch", s.handleFetchAll)
+	mux.HandleFunc("GET /api/v1/subscriptions/{id}", s.handleGetSubscription)
+	mux.HandleFunc("PATCH /api/v1/subscriptions/{id}", s.handleUpdateSubscription)
+	mux.HandleFunc("DELETE /api/v1/subscriptions/{id}", s.handleDeleteSubscription)
+	mux.HandleFunc("POST /api/v1/subscriptions/{id}/fetch", s.handleFetchSubscription)
+	mux.HandleFunc("GET /api/v1/configs", s.handleListConfigs)
+	mux.HandleFunc("GET /api/v1/configs/{id}", s.handleGetConfig)
+	mux.HandleFunc("PATCH /api/v1/configs/{id}", s.handleUpdateConfig)
+	mux.HandleFunc("POST /api/v1/tests", s.handleStartTest)
+	mux.HandleFunc("GET /api/v1/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/v1/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /api/v1/runs", s.handleListRuns)
+	mux.HandleFunc("GET /api/v1/runs/{id}/results", s.handleRunResults)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests without the bearer token, when one is configured.
+// Without one the API is only served on loopback, so it also rejects requests
+// that name another host, as DNS rebinding does, or come from a web page of
+// another origin, which any site the user visits could send.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+				return
+			}
+		} else if !utils.IsLoopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("host %q is not a loopback address", r.Host))
+			return
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !utils.IsLoopbackHost(u.Host) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("cross-origin request from %q", origin))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --- Subscriptions ---
+
+type subscriptionJSON struct {
+	ID            int64      `json:"id"`
+	URL           string     `json:"url"`
+	Remark        string     `json:"remark,omitempty"`
+	UserAgent     string     `json:"user_agent,omitempty"`
+	Enabled       bool       `json:"enabled"`
+	Priority      int        `json:"priority"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	FailureCount  int        `json:"failure_count"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+func toSubscriptionJSON(sub database.Subscription) subscriptionJSON {
+	return subscriptionJSON{
+		ID:            sub.ID,
+		URL:           sub.URL,
+		Remark:        sub.Remark.String,
+		UserAgent:     sub.UserAgent.String,
+		Enabled:       sub.Enabled,
+		Priority:      sub.Priority,
+		LastFetchedAt: nullTime(sub.LastFetchedAt),
+		CreatedAt:     sub.CreatedAt,
+		FailureCount:  sub.FailureCount,
+		LastError:     sub.LastError.String,
+	}
+}
+
+func (s *server) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	list, err := database.ListSubscriptions()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	items := make([]subscriptionJSON, 0, len(list))
+	for _, sub := range list {
+		items = append(items, toSubscriptionJSON(sub))
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *server) handleAddSubscription(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL       string `json:"url"`
+		Remark    string `json:"remark"`
+		UserAgent string `json:"user_agent"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if !validSubscriptionURL(w, req.URL) {
+		return
+	}
+	if err := database.AddSubscription(req.URL, req.Remark, req.UserAgent); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			writeError(w, http.StatusConflict, "a subscription with this URL already exists")
+			return
+		}
+		writeDBError(w, err)
+		return
+	}
+	sub, err := database.GetSubscriptionByURL(req.URL)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toSubscriptionJSON(*sub))
+}
+
+// validSubscriptionURL rejects invalid URLs and local file subscriptions, which would
+// let API clients read files from the server; those can only be added locally.
+func validSubscriptionURL(w http.ResponseWriter, raw string) bool {
+	if subs.IsLocalSubscription(raw) {
+		if !strings.Contains(raw, "://") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid URL %q", raw))
+		} else {
+			writeError(w, http.StatusBadRequest, "local file subscriptions can only be added with 'xray-knife subs add'")
+		}
+		return false
+	}
+	if _, err := url.ParseRequestURI(raw); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid URL %q: %v", raw, err))
+		return false
+	}
+	return true
+}
+
+func (s *server) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	sub, err := database.GetSubscriptionByID(id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toSubscriptionJSON(*sub))
+}
+
+func (s *server) handleUpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		URL       *string `json:"url"`
+		Remark    *string `json:"remark"`
+		UserAgent *string `json:"user_agent"`
+		Enabled   *bool   `json:"enabled"`
+		Priority  *int    `json:"priority"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.URL != nil {
+		if !validSubscriptionURL(w, *req.URL) {
+			return
+		}
+	}
+	fields := req.URL != nil || req.Remark != nil || req.UserAgent != nil || req.Enabled != nil
+	if !fields && req.Priority == nil {
+		writeError(w, http.StatusBadRequest, "nothing to update")
+		return
+	}
+	if fields {
+		if err := database.UpdateSubscription(id, req.URL, req.Remark, req.UserAgent, req.Enabled); err != nil {
+			writeDBError(w, err)
+			return
+		}
+	}
+	if req.Priority != nil {
+		if err := database.SetSubscriptionPriority(id, *req.Priority); err != nil {
+			writeDBError(w, err)
+			return
+		}
+	}
+	s.handleGetSubscription(w, r)
+}
+
+func (s *server) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := database.DeleteSubscription(id); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleFetchSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := database.GetSubscriptionByID(id); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	s.startFetch(w, subs.FetchConfig{SubscriptionID: id})
+}
+
+func (s *server) handleFetchAll(w http.ResponseWriter, r *http.Request) {
+	s.startFetch(w, subs.FetchConfig{FetchAll: true})
+}
+
+// startFetch runs a fetch job with the defaults of 'subs fetch'.
+func (s *server) startFetch(w http.ResponseWriter, cfg subs.FetchConfig) {
+	cfg.DisableAfter = 5
+	cfg.PerHost = 1
+	cfg.KeepSnapshots = 10
+	j, err := s.jobs.start("fetch", 0, func(ctx context.Context, _ func(func(*job))) error {
+		return subs.Fetch(ctx, cfg)
+	})
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// --- Configs ---
+
+type configJSON struct {
+	ID               int64             `json:"id"`
+	Link             string            `json:"link"`
+	Protocol         string            `json:"protocol,omitempty"`
+	Remark           string            `json:"remark,omitempty"`
+	Enabled          bool              `json:"enabled"`
+	Sources          []int64           `json:"sources"`
+	AddedAt          time.Time         `json:"added_at"`
+	LastSeenAt       *time.Time        `json:"last_seen_at,omitempty"`
+	ParseError       string            `json:"parse_error,omitempty"`
+	ParseErrorDetail string            `json:"parse_error_detail,omitempty"`
+	Notes            string            `json:"notes,omitempty"`
+	Fields           map[string]string `json:"fields,omitempty"`
+}
+
+func toConfigJSON(c database.SubscriptionConfig) configJSON {
+	out := configJSON{
+		ID:               c.ID,
+		Link:             c.ConfigLink,
+		Protocol:         c.Protocol.String,
+		Remark:           c.Remark.String,
+		Enabled:          c.Enabled,
+		Sources:          []int64{},
+		AddedAt:          c.AddedAt,
+		LastSeenAt:       nullTime(c.LastSeenAt),
+		ParseError:       c.ParseError.String,
+		ParseErrorDetail: c.ParseErrorDetail.String,
+		Notes:            c.Notes.String,
+	}
+	for _, s := range strings.Split(c.Sources.String, ",") {
+		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+			out.Sources = append(out.Sources, id)
+		}
+	}
+	if c.Metadata.Valid {
+		json.Unmarshal([]byte(c.Metadata.String), &out.Fields)
+	}
+	return out
+}
+
+// configQueryFilter builds the filter of a config listing from the query parameters
+// sub, protocol, q (a remark or link substring) and where.
+func configQueryFilter(q url.Values) (*database.ConfigFilter, error) {
+	filter := &database.ConfigFilter{SQL: "1=1"}
+	if v := q.Get("sub"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sub %q", v)
+		}
+		filter = filter.And(subFilter(id))
+	}
+	if v := q.Get("protocol"); v != "" {
+		filter = filter.And(&database.ConfigFilter{SQL: "protocol = ?", Args: []interface{}{v}})
+	}
+	if v := q.Get("q"); v != "" {
+		pattern := "%" + v + "%"
+		filter = filter.And(&database.ConfigFilter{SQL: "remark LIKE ? OR config_link LIKE ?", Args: []interface{}{pattern, pattern}})
+	}
+	if v := q.Get("where"); v != "" {
+		where, err := database.ParseConfigFilter(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid where filter: %w", err)
+		}
+		filter = filter.And(where)
+	}
+	return filter, nil
+}
+
+func subFilter(subID int64) *database.ConfigFilter {
+	return &database.ConfigFilter{
+		SQL:  "id IN (SELECT config_id FROM config_sources WHERE subscription_id = ?)",
+		Args: []interface{}{subID},
+	}
+}
+
+func (s *server) handleListConfigs(w http.ResponseWriter, r *http.Request) {
+	filter, err := configQueryFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	total, err := database.CountConfigsMatching(filter)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	configs, err := database.ListConfigsMatching(filter, limit, offset)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	items := make([]configJSON, 0, len(configs))
+	for _, c := range configs {
+		items = append(items, toConfigJSON(c))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (s *server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	c, err := database.GetSubscriptionConfig(id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toConfigJSON(*c))
+}
+
+func (s *server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled *bool   `json:"enabled"`
+		Notes   *string `json:"notes"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Enabled == nil && req.Notes == nil {
+		writeError(w, http.StatusBadRequest, "nothing to update")
+		return
+	}
+	c, err := database.GetSubscriptionConfig(id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if req.Notes != nil {
+		notes := strings.TrimSpace(*req.Notes)
+		if err := database.SetConfigNotes(id, sql.NullString{String: notes, Valid: notes != ""}, c.Metadata); err != nil {
+			writeDBError(w, err)
+			return
+		}
+	}
+	if req.Enabled != nil {
+		byID := &database.ConfigFilter{SQL: "id = ?", Args: []interface{}{id}}
+		if _, err := database.SetConfigsEnabled(byID, *req.Enabled); err != nil {
+			writeDBError(w, err)
+			return
+		}
+	}
+	s.handleGetConfig(w, r)
+}
+
+// --- Tests ---
+
+type testRequest struct {
+	Links    []string `json:"links"`
+	Sub      int64    `json:"sub"`
+	Protocol string   `json:"protocol"`
+	Where    string   `json:"where"`
+	Limit    int      `json:"limit"`
+
+	Threads   uint16 `json:"threads"`
+	Core      string `json:"core"`
+	URL       string `json:"url"`
+	MaxDelay  uint16 `json:"max_delay"`
+	Timeout   uint16 `json:"timeout"`
+	Retries   uint8  `json:"retries"`
+	Insecure  bool   `json:"insecure"`
+	IPVersion string `json:"ip_version"`
+}
+
+// testLinks returns the links a test request names, or the enabled, parsed DB configs
+// matching its filters.
+func testLinks(req testRequest) ([]string, error) {
+	if len(req.Links) > 0 {
+		links, _ := pkghttp.DeduplicateLinks(req.Links)
+		return links, nil
+	}
+
+	filter := &database.ConfigFilter{SQL: "enabled = 1 AND parse_error IS NULL"}
+	if req.Sub > 0 {
+		filter = filter.And(subFilter(req.Sub))
+	}
+	if req.Protocol != "" {
+		filter = filter.And(&database.ConfigFilter{SQL: "protocol = ?", Args: []interface{}{req.Protocol}})
+	}
+	if req.Where != "" {
+		where, err := database.ParseConfigFilter(req.Where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid where filter: %w", err)
+		}
+		filter = filter.And(where)
+	}
+	configs, err := database.ListConfigsMatching(filter, req.Limit, 0)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]string, 0, len(configs))
+	for _, c := range configs {
+		links = append(links, c.ConfigLink)
+	}
+	links, _ = pkghttp.DeduplicateLinks(links)
+	return links, nil
+}
+
+func (s *server) handleStartTest(w http.ResponseWriter, r *http.Request) {
+	req := testRequest{Threads: 50, Core: "auto", URL: "https://cloudflare.com/cdn-cgi/trace", MaxDelay: 5000}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	switch req.Core {
+	case "auto", "xray", "singbox":
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid core %q (auto, xray, singbox)", req.Core))
+		return
+	}
+	if req.Threads == 0 {
+		writeError(w, http.StatusBadRequest, "threads must be at least 1")
+		return
+	}
+
+	links, err := testLinks(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(links) == 0 {
+		writeError(w, http.StatusBadRequest, "no configs to test")
+		return
+	}
+
+	opts := pkghttp.Options{
+		Core:                   req.Core,
+		MaxDelay:               req.MaxDelay,
+		Timeout:                req.Timeout,
+		Retries:                req.Retries,
+		InsecureTLS:            req.Insecure,
+		TestEndpoint:           req.URL,
+		TestEndpointHttpMethod: "GET",
+		IPVersion:              req.IPVersion,
+	}
+	examiner, err := pkghttp.NewExaminer(opts)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid test options: %v", err))
+		return
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	runID, err := database.CreateHttpTestRun(string(optsJSON), len(links))
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	j, err := s.jobs.start("test", runID, func(ctx context.Context, update func(func(*job))) error {
+		update(func(j *job) { j.Total = len(links) })
+		results := runTests(ctx, examiner, req.Threads, links, func(res *pkghttp.Result) {
+			if res.Status == "passed" || res.Status == "semi-passed" {
+				update(func(j *job) { j.Passed++ })
+			}
+		})
+		return pkghttp.NewResultProcessor(pkghttp.ResultProcessorOptions{RunID: runID}).SaveResults(results)
+	})
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// runTests tests links and collects the results, calling onResult for each one.
+func runTests(ctx context.Context, examiner *pkghttp.Examiner, threads uint16, links []string, onResult func(*pkghttp.Result)) pkghttp.ConfigResults {
+	testManager := pkghttp.NewTestManager(examiner, threads, false, nil)
+	resultsChan := make(chan *pkghttp.Result, threads)
+	var results pkghttp.ConfigResults
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range resultsChan {
+			results = append(results, res)
+			onResult(res)
+		}
+	}()
+	testManager.RunTests(ctx, links, resultsChan, nil)
+	close(resultsChan)
+	<-done
+	return results
+}
+
+// --- Jobs and results ---
+
+func (s *server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.jobs.list())
+}
+
+func (s *server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	j, ok := s.jobs.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no job with ID %d", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+type runJSON struct {
+	ID          int64           `json:"id"`
+	StartTime   time.Time       `json:"start_time"`
+	ConfigCount int             `json:"config_count"`
+	Results     int             `json:"results"`
+	Passed      int             `json:"passed"`
+	Options     json.RawMessage `json:"options,omitempty"`
+}
+
+func (s *server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", v))
+			return
+		}
+		limit = n
+	}
+	runs, err := database.ListHttpTestRuns(limit)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	items := make([]runJSON, 0, len(runs))
+	for _, run := range runs {
+		item := runJSON{ID: run.ID, StartTime: run.StartTime, ConfigCount: run.ConfigCount, Results: run.Results, Passed: run.Passed}
+		if json.Valid([]byte(run.OptionsJSON)) {
+			item.Options = json.RawMessage(run.OptionsJSON)
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+type resultJSON struct {
+	Link          string  `json:"link"`
+	Status        string  `json:"status"`
+	Reason        string  `json:"reason,omitempty"`
+	DelayMs       int64   `json:"delay_ms"`
+	DownloadMbps  float64 `json:"download_mbps,omitempty"`
+	UploadMbps    float64 `json:"upload_mbps,omitempty"`
+	IPAddress     string  `json:"ip_address,omitempty"`
+	IPLocation    string  `json:"ip_location,omitempty"`
+	TTFBMs        int64   `json:"ttfb_ms,omitempty"`
+	ConnectTimeMs int64   `json:"connect_time_ms,omitempty"`
+	WarmDelayMs   int64   `json:"warm_delay_ms,omitempty"`
+	UDP           bool    `json:"udp,omitempty"`
+	NATType       string  `json:"nat_type,omitempty"`
+	SMTP          string  `json:"smtp,omitempty"`
+	P2P           string  `json:"p2p,omitempty"`
+	Leaks         string  `json:"leaks,omitempty"`
+	CertIssuer    string  `json:"cert_issuer,omitempty"`
+	CertSANs      string  `json:"cert_sans,omitempty"`
+	CertExpires   string  `json:"cert_expires,omitempty"`
+	CertWarnings  string  `json:"cert_warnings,omitempty"`
+	Failure       string  `json:"failure,omitempty"`
+	BlockSignal   string  `json:"block_signal,omitempty"`
+	Mutation      string  `json:"mutation,omitempty"`
+	MutatedLink   string  `json:"mutated_link,omitempty"`
+}
+
+func (s *server) handleRunResults(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	results, err := database.GetHttpTestResults(id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	items := make([]resultJSON, 0, len(results))
+	for _, res := range results {
+		if status != "" && res.Status != status {
+			continue
+		}
+		items = append(items, resultJSON{
+			Link:          res.ConfigLink,
+			Status:        res.Status,
+			Reason:        res.Reason.String,
+			DelayMs:       res.DelayMs,
+			DownloadMbps:  res.DownloadMbps,
+			UploadMbps:    res.UploadMbps,
+			IPAddress:     res.IPAddress.String,
+			IPLocation:    res.IPLocation.String,
+			TTFBMs:        res.TTFBMs,
+			ConnectTimeMs: res.ConnectTimeMs,
+			WarmDelayMs:   res.WarmDelayMs,
+			UDP:           res.UDP,
+			NATType:       res.NATType,
+			SMTP:          res.SMTP,
+			P2P:           res.P2P,
+			Leaks:         res.Leaks,
+			CertIssuer:    res.CertIssuer,
+			CertSANs:      res.CertSANs,
+			CertExpires:   res.CertExpires,
+			CertWarnings:  res.CertWarnings,
+			Failure:       res.Failure,
+			BlockSignal:   res.BlockSignal,
+			Mutation:      res.Mutation,
+			MutatedLink:   res.MutatedLink,
+		})
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// --- Helpers ---
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeDBError answers 404 for a missing row and 500 for any other database error.
+func writeDBError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// decodeBody decodes the JSON request body into v, answering 400 when it is invalid
+// and 415 when it isn't sent as JSON, which a form on another site can't do.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "request body must be sent as Content-Type: application/json")
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// pathID parses the {id} path value, answering 400 when it is not a number.
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ID %q", r.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+// pageParams returns the limit and offset query parameters, with defaults.
+func pageParams(q url.Values) (int, int, error) {
+	limit, offset := defaultPageSize, 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", v)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// Job states.
+const (
+	jobRunning   = "running"
+	jobFinished  = "finished"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// job is a fetch or test running in the background.
+type job struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	Error      string     `json:"error,omitempty"`
+	RunID      int64      `json:"run_id,omitempty"`
+	Total      int        `json:"total,omitempty"`
+	Passed     int        `json:"passed,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// jobManager runs at most one job of each kind at a time and remembers every job.
+type jobManager struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+
+	mu      sync.Mutex
+	nextID  int64
+	jobs    map[int64]*job
+	running map[string]bool
+}
+
+func newJobManager(ctx context.Context) *jobManager {
+	return &jobManager{ctx: ctx, jobs: map[int64]*job{}, running: map[string]bool{}}
+}
+
+// errJobRunning is returned by start when a job of the same kind is still running.
+type errJobRunning string
+
+func (e errJobRunning) Error() string { return fmt.Sprintf("a %s job is already running", string(e)) }
+
+// start runs fn in the background as a new job of the given kind. fn may update the
+// job through update while it runs.
+func (m *jobManager) start(kind string, runID int64, fn func(ctx context.Context, update func(func(*job))) error) (job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running[kind] {
+		return job{}, errJobRunning(kind)
+	}
+	m.nextID++
+	j := &job{ID: m.nextID, Kind: kind, State: jobRunning, RunID: runID, StartedAt: time.Now()}
+	m.jobs[j.ID] = j
+	m.running[kind] = true
+
+	update := func(f func(*job)) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		f(j)
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := fn(m.ctx, update)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		now := time.Now()
+		j.FinishedAt = &now
+		switch {
+		case m.ctx.Err() != nil:
+			j.State = jobCancelled
+		case err != nil:
+			j.State, j.Error = jobFailed, err.Error()
+			customlog.Printf(customlog.Failure, "API %s job %d failed: %v\n", kind, j.ID, err)
+		default:
+			j.State = jobFinished
+		}
+		m.running[kind] = false
+	}()
+	return *j, nil
+}
+
+func (m *jobManager) get(id int64) (job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// list returns every job, newest first.
+func (m *jobManager) list() []job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID > jobs[b].ID })
+	return jobs
+}
+
+// wait blocks until every job has returned.
+func (m *jobManager) wait() {
+	m.wg.Wait()
+}
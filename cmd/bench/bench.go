@@ -0,0 +1,307 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+// benchLink is the config the core instances are built from. Nothing is dialed:
+// an instance costs the same whether its server is reachable or not.
+const benchLink = "vless://d342d11e-d424-4583-b36e-524ab1f0afa4@127.0.0.1:9?type=tcp&security=none#bench"
+
+// BenchConfig holds the flags of the bench command.
+type BenchConfig struct {
+	Instances int
+	CoreType  string
+}
+
+// BenchCmd measures what this machine can run at once.
+var BenchCmd = newBenchCommand()
+
+func newBenchCommand() *cobra.Command {
+	cfg := &BenchConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measures how many test threads this machine can sustain",
+		Long: `Measures the resources of this machine (CPUs, available memory, the open
+file limit) and what one test worker costs: it builds --instances core
+instances, the same way 'http' does for each config it tests, and records the
+memory, file descriptors and startup time they take. From that it recommends a
+--thread value for 'http'.
+
+Too many threads doesn't test faster: once the CPUs are saturated, the file
+limit is hit or the machine swaps, delays grow and working configs fail with
+timeouts, so the results are garbage. The recommendation is the smallest of
+  CPU      ` + fmt.Sprint(workersPerCPU) + ` workers per CPU (TLS handshakes and core startup are CPU work)
+  memory   half the available memory divided by the cost of a worker
+  files    the open file limit, less a reserve, divided by the files of a worker
+On Linux the soft limit of open files is often 1024; if the files bound the
+recommendation and the hard limit is higher, raise it with 'ulimit -n'.
+
+Speed tests are limited by bandwidth rather than by this machine, so a much
+lower value is recommended for --speedtest.
+
+Examples:
+  xray-knife bench
+  xray-knife bench --core singbox --instances 50`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.Instances < 1 {
+				return fmt.Errorf("--instances must be at least 1")
+			}
+			cores, err := benchCores(cfg.CoreType)
+			if err != nil {
+				return err
+			}
+			return runBench(cmd.Context(), cfg, cores)
+		},
+	}
+
+	cmd.Flags().IntVarP(&cfg.Instances, "instances", "n", 20, "Number of core instances to build for the measurement")
+	cmd.Flags().StringVarP(&cfg.CoreType, "core", "z", "auto", "Core to measure: xray, singbox, or auto (both)")
+	return cmd
+}
+
+// benchCores returns the cores named by --core.
+func benchCores(name string) (map[string]core.CoreType, error) {
+	switch name {
+	case "auto", "":
+		return map[string]core.CoreType{"xray": core.XrayCoreType, "singbox": core.SingboxCoreType}, nil
+	case "xray":
+		return map[string]core.CoreType{"xray": core.XrayCoreType}, nil
+	case "singbox", "sing-box":
+		return map[string]core.CoreType{"singbox": core.SingboxCoreType}, nil
+	}
+	return nil, fmt.Errorf("invalid --core %q (supported: xray, singbox, auto)", name)
+}
+
+func runBench(ctx context.Context, cfg *BenchConfig, cores map[string]core.CoreType) error {
+	sys := readSystem()
+
+	var prints []footprint
+	for _, name := range []string{"xray", "singbox"} {
+		coreType, ok := cores[name]
+		if !ok {
+			continue
+		}
+		customlog.Printf(customlog.Processing, "Building %d %s instances...\n", cfg.Instances, name)
+		fp, err := measureCore(ctx, name, coreType, cfg.Instances)
+		if err != nil {
+			return fmt.Errorf("could not measure %s: %w", name, err)
+		}
+		prints = append(prints, fp)
+	}
+
+	printSystem(sys)
+	fmt.Println()
+	// The heavier core decides: with auto, any config may end up on it.
+	worst := prints[0]
+	for _, fp := range prints {
+		printFootprint(fp)
+		if fp.bytes > worst.bytes {
+			worst.bytes = fp.bytes
+		}
+		if fp.fds > worst.fds {
+			worst.fds = fp.fds
+		}
+	}
+	fmt.Println()
+	printRecommendation(sys, recommend(sys, worst))
+	return nil
+}
+
+// system is what the machine offers. Zero means unknown on this platform.
+type system struct {
+	cpus         int
+	memTotal     uint64 // bytes
+	memAvailable uint64 // bytes
+	fdSoft       uint64
+	fdHard       uint64
+	fdOpen       int // files this process has open already
+}
+
+func readSystem() system {
+	s := system{cpus: runtime.NumCPU(), fdOpen: openFiles()}
+	s.memTotal, s.memAvailable = memoryInfo()
+	s.fdSoft, s.fdHard = fileLimit()
+	return s
+}
+
+// footprint is the cost of one test worker of a core.
+type footprint struct {
+	core    string
+	bytes   uint64        // heap and stacks of one instance
+	fds     float64       // files one instance keeps open
+	startup time.Duration // time to build one instance
+}
+
+// measureCore builds n instances of the core, as 'http' does for each config it
+// tests, and divides what they take up by n.
+func measureCore(ctx context.Context, name string, coreType core.CoreType, n int) (footprint, error) {
+	c := core.CoreFactory(coreType, false, false)
+	proto, err := c.CreateProtocol(benchLink)
+	if err != nil {
+		return footprint{}, err
+	}
+	if err := proto.Parse(); err != nil {
+		return footprint{}, err
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	filesBefore := openFiles()
+
+	var closers []interface{ Close() error }
+	defer func() {
+		for _, cl := range closers {
+			cl.Close()
+		}
+	}()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return footprint{}, err
+		}
+		_, instance, err := c.MakeHttpClient(ctx, proto, 5*time.Second)
+		if err != nil {
+			return footprint{}, err
+		}
+		closers = append(closers, instance)
+	}
+	elapsed := time.Since(start)
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	fp := footprint{core: name, startup: elapsed / time.Duration(n)}
+	if used := inUse(after) - min(inUse(before), inUse(after)); used > 0 {
+		fp.bytes = used / uint64(n)
+	}
+	if canCountFiles {
+		fp.fds = float64(openFiles()-filesBefore) / float64(n)
+	}
+	return fp, nil
+}
+
+// inUse returns the memory held by live objects and goroutine stacks.
+func inUse(m runtime.MemStats) uint64 {
+	return m.HeapInuse + m.StackInuse
+}
+
+// recommendation is the --thread value for 'http' and the bounds it came from.
+// A zero bound is unknown and doesn't limit.
+type recommendation struct {
+	byCPU, byMemory, byFiles int
+	threads                  int
+	speedtest                int
+	limitedBy                string
+}
+
+const (
+	workersPerCPU   = 25
+	maxThreads      = 2000
+	fileReserve     = 128     // database, logs, listeners and the like
+	filesPerConn    = 2       // the connection to the server, and DNS
+	bytesPerConn    = 1 << 20 // buffers, TLS state and the response of a request in flight
+	speedtestPerCPU = 2
+)
+
+// recommend works out the --thread value for a worker of footprint fp.
+func recommend(sys system, fp footprint) recommendation {
+	r := recommendation{byCPU: max(sys.cpus, 1) * workersPerCPU}
+
+	if sys.memAvailable > 0 {
+		r.byMemory = int(sys.memAvailable / 2 / (fp.bytes + bytesPerConn))
+	}
+	if sys.fdSoft > 0 {
+		files := int(fp.fds+0.5) + filesPerConn
+		free := int(min(sys.fdSoft, uint64(1<<30))) - sys.fdOpen - fileReserve
+		r.byFiles = max(free, 0) / files
+	}
+
+	r.threads, r.limitedBy = min(r.byCPU, maxThreads), "CPU"
+	if r.byCPU > maxThreads {
+		r.limitedBy = "cap"
+	}
+	if r.byMemory > 0 && r.byMemory < r.threads {
+		r.threads, r.limitedBy = r.byMemory, "memory"
+	}
+	if sys.fdSoft > 0 && r.byFiles < r.threads {
+		r.threads, r.limitedBy = r.byFiles, "files"
+	}
+	r.threads = max(r.threads, 1)
+	r.speedtest = max(min(r.threads, max(sys.cpus, 1)*speedtestPerCPU), 1)
+	return r
+}
+
+func printSystem(s system) {
+	label := func(key string) string { return customlog.GetColor(customlog.Label, key) }
+	fmt.Printf("%s: %d\n", label("CPUs"), s.cpus)
+	if s.memTotal > 0 {
+		fmt.Printf("%s: %s available of %s\n", label("Memory"), formatBytes(s.memAvailable), formatBytes(s.memTotal))
+	} else {
+		fmt.Printf("%s: unknown on %s\n", label("Memory"), runtime.GOOS)
+	}
+	if s.fdSoft > 0 {
+		fmt.Printf("%s: %s (hard limit %s, %d in use)\n", label("Open file limit"), formatLimit(s.fdSoft), formatLimit(s.fdHard), s.fdOpen)
+	} else {
+		fmt.Printf("%s: none on %s\n", label("Open file limit"), runtime.GOOS)
+	}
+}
+
+func printFootprint(fp footprint) {
+	label := customlog.GetColor(customlog.Label, "Per "+fp.core+" worker")
+	files := "?"
+	if canCountFiles {
+		files = fmt.Sprintf("%.1f", fp.fds)
+	}
+	fmt.Printf("%s: %s memory, %s files, %s to start\n", label, formatBytes(fp.bytes), files, fp.startup.Round(10*time.Microsecond))
+}
+
+func printRecommendation(sys system, r recommendation) {
+	var bounds []string
+	bounds = append(bounds, fmt.Sprintf("CPU %d", r.byCPU))
+	if r.byMemory > 0 {
+		bounds = append(bounds, fmt.Sprintf("memory %d", r.byMemory))
+	}
+	if sys.fdSoft > 0 {
+		bounds = append(bounds, fmt.Sprintf("files %d", r.byFiles))
+	}
+	fmt.Printf("%s: %s\n", customlog.GetColor(customlog.Label, "Bounds"), strings.Join(bounds, ", "))
+
+	customlog.Printf(customlog.Success, "Recommended: --thread %d (limited by %s); with --speedtest: --thread %d\n", r.threads, r.limitedBy, r.speedtest)
+	if r.limitedBy == "files" && sys.fdHard > sys.fdSoft {
+		customlog.Printf(customlog.Info, "The open file limit binds; raise it with 'ulimit -n %d' before testing\n", sys.fdHard)
+	}
+	if r.limitedBy == "memory" {
+		customlog.Printf(customlog.Info, "Memory binds; close other programs to use more threads\n")
+	}
+}
+
+// formatLimit prints a resource limit, which may be unlimited.
+func formatLimit(n uint64) string {
+	if n >= 1<<62 {
+		return "unlimited"
+	}
+	return fmt.Sprint(n)
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
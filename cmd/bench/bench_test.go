@@ -0,0 +1,61 @@
+package bench
+
+import "testing"
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name      string
+		sys       system
+		fp        footprint
+		threads   int
+		limitedBy string
+	}{
+		{
+			name:      "cpu",
+			sys:       system{cpus: 4, memAvailable: 8 << 30, fdSoft: 65536},
+			fp:        footprint{bytes: 300 << 10, fds: 2},
+			threads:   100,
+			limitedBy: "CPU",
+		},
+		{
+			// 1024 - 20 open - 128 reserved, over 2 + 2 files a worker.
+			name:      "files",
+			sys:       system{cpus: 16, memAvailable: 8 << 30, fdSoft: 1024, fdHard: 1 << 20, fdOpen: 20},
+			fp:        footprint{bytes: 300 << 10, fds: 2},
+			threads:   219,
+			limitedBy: "files",
+		},
+		{
+			// Half of 64 MiB over 1 MiB + 1 MiB a worker.
+			name:      "memory",
+			sys:       system{cpus: 8, memAvailable: 64 << 20},
+			fp:        footprint{bytes: 1 << 20},
+			threads:   16,
+			limitedBy: "memory",
+		},
+		{
+			name:      "unknown limits",
+			sys:       system{cpus: 128},
+			threads:   maxThreads,
+			limitedBy: "cap",
+		},
+	}
+	for _, tt := range tests {
+		r := recommend(tt.sys, tt.fp)
+		if r.threads != tt.threads || r.limitedBy != tt.limitedBy {
+			t.Errorf("%s: recommend() = %d (%s), want %d (%s)", tt.name, r.threads, r.limitedBy, tt.threads, tt.limitedBy)
+		}
+		if r.speedtest < 1 || r.speedtest > r.threads {
+			t.Errorf("%s: speedtest threads = %d, want 1..%d", tt.name, r.speedtest, r.threads)
+		}
+	}
+}
+
+func TestBenchCores(t *testing.T) {
+	if cores, err := benchCores("auto"); err != nil || len(cores) != 2 {
+		t.Errorf("benchCores(auto) = %v, %v", cores, err)
+	}
+	if _, err := benchCores("v2ray"); err == nil {
+		t.Error("benchCores accepted an unknown core")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package bench
+
+// fileLimit returns 0 where processes have no limit of open files to speak of.
+func fileLimit() (soft, hard uint64) {
+	return 0, 0
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package bench
+
+import "golang.org/x/sys/unix"
+
+// fileLimit returns the soft and hard limits of open files.
+func fileLimit() (soft, hard uint64) {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, 0
+	}
+	return uint64(rl.Cur), uint64(rl.Max)
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package bench
+
+// canCountFiles reports whether openFiles works here.
+const canCountFiles = false
+
+// memoryInfo is not implemented outside Linux; the memory bound is skipped.
+func memoryInfo() (total, available uint64) {
+	return 0, 0
+}
+
+// openFiles is not implemented outside Linux.
+func openFiles() int {
+	return 0
+}
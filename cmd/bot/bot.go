@@ -0,0 +1,518 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// botConfig holds the options of the bot command.
+type botConfig struct {
+	Token      string
+	APIURL     string
+	Allowed    []int64
+	Public     bool
+	MaxLinks   int
+	Concurrent int
+	PerChat    int
+
+	ThreadCount     uint16
+	CoreType        string
+	DestURL         string
+	MaxDelay        uint16
+	InsecureTLS     bool
+	Speedtest       bool
+	SpeedtestAmount uint64
+	IPInfoProviders []string
+	IPInfoToken     string
+}
+
+// BotCmd is the bot subcommand.
+var BotCmd = newBotCommand()
+
+func newBotCommand() *cobra.Command {
+	cfg := &botConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "bot",
+		Short: "Runs a Telegram bot that tests configs sent to it",
+		Long: `Runs a Telegram bot in the foreground. Send it config links or subscription
+URLs, in one message or several lines, and it tests them and replies with the
+latency, exit country and, with --speedtest, the speed of every working config.
+
+Commands:
+  /best [n]   the n fastest configs of the latest test run in the database
+              (default 5, at most 20; only for the --allow list)
+  /help       usage
+
+Create a bot with @BotFather and pass its token with --token or the
+XRAY_KNIFE_BOT_TOKEN environment variable. Restrict who may use it with
+--allow (user or chat IDs). Serving everyone who finds the bot takes --public,
+and even then /best, which shows the configs of your database, stays limited
+to the --allow list. At most --concurrent messages are tested at once, and
+--per-chat of them per chat; messages over that are turned down.
+
+Examples:
+  xray-knife bot --token 123456:ABC-DEF --allow 11111111
+  xray-knife bot --allow 11111111 --allow 22222222 --speedtest
+  xray-knife bot --token 123456:ABC-DEF --public --max-links 5
+  XRAY_KNIFE_BOT_TOKEN=123456:ABC-DEF xray-knife bot --max-links 50`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("token") {
+				cfg.Token = os.Getenv("XRAY_KNIFE_BOT_TOKEN")
+			}
+			if err := validateBotConfig(cfg); err != nil {
+				return err
+			}
+			return runBot(cmd.Context(), cfg)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.Token, "token", "", "Telegram bot token from @BotFather (env XRAY_KNIFE_BOT_TOKEN)")
+	flags.Int64SliceVar(&cfg.Allowed, "allow", nil, "Only answer these Telegram user or chat IDs (repeatable)")
+	flags.BoolVar(&cfg.Public, "public", false, "Test the links of anyone who finds the bot (/best stays limited to --allow)")
+	flags.IntVar(&cfg.MaxLinks, "max-links", 20, "Maximum number of configs tested per message")
+	flags.IntVar(&cfg.Concurrent, "concurrent", 2, "Maximum number of messages tested at the same time")
+	flags.IntVar(&cfg.PerChat, "per-chat", 1, "Maximum number of messages of one chat tested or queued at the same time")
+	flags.Uint16VarP(&cfg.ThreadCount, "thread", "t", 10, "Number of threads per message")
+	flags.StringVarP(&cfg.CoreType, "core", "z", "auto", "Core type (auto, singbox, xray)")
+	flags.StringVarP(&cfg.DestURL, "url", "u", "https://cloudflare.com/cdn-cgi/trace", "The url to test config")
+	flags.Uint16VarP(&cfg.MaxDelay, "mdelay", "d", 5000, "Maximum allowed delay (ms)")
+	flags.BoolVarP(&cfg.InsecureTLS, "insecure", "e", false, "Insecure tls connection (fake SNI)")
+	flags.BoolVarP(&cfg.Speedtest, "speedtest", "p", false, "Speed test with speed.cloudflare.com")
+	flags.Uint64VarP(&cfg.SpeedtestAmount, "amount", "a", 10000, "Download and upload amount (KB)")
+	flags.StringSliceVar(&cfg.IPInfoProviders, "ip-providers", nil, "Services looking up the real IP and country, tried in order: cloudflare, ip-api, ipinfo or an http(s) URL (default cloudflare,ipinfo,ip-api)")
+	flags.StringVar(&cfg.IPInfoToken, "ipinfo-token", "", "Token for the ipinfo provider")
+	flags.StringVar(&cfg.APIURL, "api-url", "https://api.telegram.org", "Telegram Bot API server")
+	flags.MarkHidden("api-url")
+	return cmd
+}
+
+func validateBotConfig(cfg *botConfig) error {
+	if cfg.Token == "" {
+		return fmt.Errorf("a bot token is required: set --token or XRAY_KNIFE_BOT_TOKEN")
+	}
+	if len(cfg.Allowed) == 0 && !cfg.Public {
+		return fmt.Errorf("refusing to serve everyone: set --allow with your user or chat ID, or --public")
+	}
+	switch cfg.CoreType {
+	case "auto", "xray", "singbox":
+	default:
+		return fmt.Errorf("invalid core type. Available cores: (auto, xray, singbox)")
+	}
+	if cfg.MaxLinks < 1 {
+		return fmt.Errorf("--max-links must be at least 1, got %d", cfg.MaxLinks)
+	}
+	if cfg.Concurrent < 1 {
+		return fmt.Errorf("--concurrent must be at least 1, got %d", cfg.Concurrent)
+	}
+	if cfg.PerChat < 1 {
+		return fmt.Errorf("--per-chat must be at least 1, got %d", cfg.PerChat)
+	}
+	if cfg.ThreadCount < 1 {
+		return fmt.Errorf("--thread must be at least 1")
+	}
+	return nil
+}
+
+// bot answers the messages of one Telegram bot.
+type bot struct {
+	cfg      *botConfig
+	tg       *telegramClient
+	examiner *pkghttp.Examiner
+	slots    chan struct{} // limits the messages tested at once
+	queue    chan struct{} // limits the messages tested or waiting for a slot
+
+	mu    sync.Mutex
+	chats map[int64]int // messages of each chat tested or queued
+}
+
+// maxQueuedPerSlot is how many messages may wait for each of the --concurrent
+// slots before new ones are turned down.
+const maxQueuedPerSlot = 4
+
+// pollTimeout is how long one getUpdates call waits for new messages.
+const pollTimeout = 50 * time.Second
+
+func runBot(ctx context.Context, cfg *botConfig) error {
+	examiner, err := pkghttp.NewExaminer(pkghttp.Options{
+		Core:                   cfg.CoreType,
+		MaxDelay:               cfg.MaxDelay,
+		InsecureTLS:            cfg.InsecureTLS,
+		DoSpeedtest:            cfg.Speedtest,
+		SpeedtestKbAmount:      cfg.SpeedtestAmount,
+		DoIPInfo:               true,
+		IPInfoProviders:        cfg.IPInfoProviders,
+		IPInfoToken:            cfg.IPInfoToken,
+		TestEndpoint:           cfg.DestURL,
+		TestEndpointHttpMethod: "GET",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create examiner: %w", err)
+	}
+
+	b := &bot{
+		cfg:      cfg,
+		tg:       newTelegramClient(cfg.APIURL, cfg.Token),
+		examiner: examiner,
+		slots:    make(chan struct{}, cfg.Concurrent),
+		queue:    make(chan struct{}, cfg.Concurrent*(1+maxQueuedPerSlot)),
+		chats:    make(map[int64]int),
+	}
+	name, err := b.tg.getMe(ctx)
+	if err != nil {
+		return fmt.Errorf("could not log in to Telegram: %w", err)
+	}
+	customlog.Printf(customlog.Success, "Bot @%s is running. Press Ctrl+C to stop.\n", name)
+	if cfg.Public {
+		customlog.Printf(customlog.Warning, "--public: anyone can make this machine test links.\n")
+	}
+
+	var offset int64
+	for {
+		updates, err := b.tg.getUpdates(ctx, offset, pollTimeout)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			customlog.Printf(customlog.Failure, "%v; retrying in 5s\n", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message != nil {
+				go b.handle(ctx, u.Message)
+			}
+		}
+	}
+}
+
+// allowed reports whether the sender or chat of msg may have links tested.
+func (b *bot) allowed(msg *tgMessage) bool {
+	return b.cfg.Public || b.listed(msg)
+}
+
+// listed reports whether the sender or chat of msg is on the --allow list, and
+// so may see the configs of the database.
+func (b *bot) listed(msg *tgMessage) bool {
+	if msg.From != nil && slices.Contains(b.cfg.Allowed, msg.From.ID) {
+		return true
+	}
+	return slices.Contains(b.cfg.Allowed, msg.Chat.ID)
+}
+
+// acquire reserves a place for a test of chat, reporting false when the chat
+// or the bot has as many tests running or queued as allowed.
+func (b *bot) acquire(chat int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.chats[chat] >= b.cfg.PerChat {
+		return false
+	}
+	select {
+	case b.queue <- struct{}{}:
+	default:
+		return false
+	}
+	b.chats[chat]++
+	return true
+}
+
+// release frees the place taken by acquire.
+func (b *bot) release(chat int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	<-b.queue
+	if b.chats[chat]--; b.chats[chat] <= 0 {
+		delete(b.chats, chat)
+	}
+}
+
+func (b *bot) reply(ctx context.Context, msg *tgMessage, text string) {
+	if err := b.tg.sendMessage(ctx, msg.Chat.ID, msg.MessageID, text); err != nil && ctx.Err() == nil {
+		customlog.Printf(customlog.Failure, "Could not reply in chat %d: %v\n", msg.Chat.ID, err)
+	}
+}
+
+const helpText = `Send me config links (vless://, vmess://, ss://, trojan://, ...) or subscription URLs and I'll test them.
+
+/best [n] - the fastest configs of the latest test run`
+
+func (b *bot) handle(ctx context.Context, msg *tgMessage) {
+	if !b.allowed(msg) {
+		from := msg.Chat.ID
+		if msg.From != nil {
+			from = msg.From.ID
+		}
+		customlog.Printf(customlog.Warning, "Ignoring a message from %d (not in --allow).\n", from)
+		b.reply(ctx, msg, "Sorry, this bot is private.")
+		return
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		text = strings.TrimSpace(msg.Caption)
+	}
+	command, arg, _ := strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@") // /best@my_bot in groups
+	switch command {
+	case "/start", "/help":
+		b.reply(ctx, msg, helpText)
+		return
+	case "/best":
+		if !b.listed(msg) {
+			b.reply(ctx, msg, "Sorry, /best is private.")
+			return
+		}
+		b.reply(ctx, msg, bestConfigsText(strings.TrimSpace(arg)))
+		return
+	}
+
+	configs, subURLs := extractLinks(text)
+	if len(configs) == 0 && len(subURLs) == 0 {
+		b.reply(ctx, msg, "I couldn't find any config link or subscription URL in your message.\n\n"+helpText)
+		return
+	}
+	if !b.acquire(msg.Chat.ID) {
+		b.reply(ctx, msg, "Too many tests running, please wait for yours to finish and try again.")
+		return
+	}
+	defer b.release(msg.Chat.ID)
+	b.test(ctx, msg, configs, subURLs)
+}
+
+// test fetches the subscriptions, tests every link and replies with the results.
+func (b *bot) test(ctx context.Context, msg *tgMessage, links, subURLs []string) {
+	var notes []string
+	for _, u := range subURLs {
+		if len(links) >= b.cfg.MaxLinks {
+			break
+		}
+		fetched, err := fetchSubscription(ctx, u, b.cfg.MaxLinks-len(links))
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("Could not fetch %s: %v", u, err))
+			continue
+		}
+		links = append(links, fetched...)
+	}
+	links, _ = pkghttp.DeduplicateLinks(links)
+	if len(links) > b.cfg.MaxLinks {
+		notes = append(notes, fmt.Sprintf("Only the first %d configs were tested.", b.cfg.MaxLinks))
+		links = links[:b.cfg.MaxLinks]
+	}
+	if len(links) == 0 {
+		b.reply(ctx, msg, strings.Join(append(notes, "No configs to test."), "\n"))
+		return
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+	default:
+		b.reply(ctx, msg, "Busy with other tests, your configs are queued...")
+		select {
+		case b.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+	defer func() { <-b.slots }()
+
+	customlog.Printf(customlog.Processing, "Testing %d configs for chat %d...\n", len(links), msg.Chat.ID)
+	b.reply(ctx, msg, fmt.Sprintf("Testing %d config(s)...", len(links)))
+	results := b.runTests(ctx, links)
+	if ctx.Err() != nil {
+		return
+	}
+	b.reply(ctx, msg, formatResults(results, notes))
+}
+
+func (b *bot) runTests(ctx context.Context, links []string) pkghttp.ConfigResults {
+	testManager := pkghttp.NewTestManager(b.examiner, b.cfg.ThreadCount, false, nil)
+	resultsChan := make(chan *pkghttp.Result, b.cfg.ThreadCount)
+	var results pkghttp.ConfigResults
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range resultsChan {
+			results = append(results, res)
+		}
+	}()
+	testManager.RunTests(ctx, links, resultsChan, nil)
+	close(resultsChan)
+	<-done
+	return results
+}
+
+// errEnoughLinks stops a subscription download once enough links were read.
+var errEnoughLinks = errors.New("enough links")
+
+// fetchSubscription downloads up to max links from a subscription URL.
+func fetchSubscription(ctx context.Context, rawURL string, max int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var links []string
+	sub := &subs.Subscription{Url: rawURL}
+	_, err := sub.Stream(ctx, func(link string) error {
+		if !isConfigLink(link) {
+			return nil
+		}
+		links = append(links, link)
+		if len(links) >= max {
+			return errEnoughLinks
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEnoughLinks) {
+		return nil, err
+	}
+	return links, nil
+}
+
+// extractLinks picks the config links and subscription (http/https) URLs out of a
+// message, one per whitespace-separated word. An http(s) URL of just a host and
+// port is an HTTP proxy config rather than a subscription.
+func extractLinks(text string) (configs, subURLs []string) {
+	for _, word := range strings.Fields(text) {
+		lower := strings.ToLower(word)
+		switch {
+		case isConfigLink(word):
+			configs = append(configs, word)
+		case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+			subURLs = append(subURLs, word)
+		}
+	}
+	return configs, subURLs
+}
+
+// isConfigLink reports whether s looks like a proxy config link, e.g. vless://...
+// or an HTTP proxy (see protocol.IsProxyLink).
+func isConfigLink(s string) bool {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme == "" || rest == "" {
+		return false
+	}
+	for _, r := range scheme {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	lower := strings.ToLower(scheme)
+	return lower != "http" && lower != "https" || protocol.IsProxyLink(s)
+}
+
+// formatResults renders test results, working configs first and fastest first.
+func formatResults(results pkghttp.ConfigResults, notes []string) string {
+	sort.SliceStable(results, func(i, j int) bool {
+		pi, pj := resultWorks(results[i]), resultWorks(results[j])
+		if pi != pj {
+			return pi
+		}
+		return pi && results[i].Delay < results[j].Delay
+	})
+
+	working := 0
+	var b strings.Builder
+	for _, r := range results {
+		if resultWorks(r) {
+			working++
+		}
+	}
+	fmt.Fprintf(&b, "%d of %d config(s) work.\n", working, len(results))
+	for _, note := range notes {
+		b.WriteString(note + "\n")
+	}
+
+	for _, r := range results {
+		b.WriteString("\n")
+		remark := r.ProtocolInfo.Remark
+		if !resultWorks(r) {
+			reason := r.Reason
+			if reason == "" {
+				reason = r.Status
+			}
+			fmt.Fprintf(&b, "❌ %s: %s\n", orDash(remark), reason)
+			continue
+		}
+
+		line := []string{fmt.Sprintf("✅ %dms", r.Delay)}
+		if loc := r.IpAddrLoc; loc != "" && loc != "null" {
+			line = append(line, loc)
+		}
+		if r.DownloadSpeed > 0 || r.UploadSpeed > 0 {
+			line = append(line, fmt.Sprintf("↓%.1f ↑%.1f Mbps", r.DownloadSpeed, r.UploadSpeed))
+		}
+		if r.Status == "semi-passed" {
+			line = append(line, "speed test failed")
+		}
+		fmt.Fprintf(&b, "%s · %s\n%s\n", strings.Join(line, " · "), orDash(remark), r.ConfigLink)
+	}
+	return b.String()
+}
+
+func resultWorks(r *pkghttp.Result) bool {
+	return r.Status == "passed" || r.Status == "semi-passed"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// bestConfigsText lists the fastest configs of the latest test run in the database.
+func bestConfigsText(arg string) string {
+	n := 5
+	if arg != "" {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 1 {
+			return "Usage: /best [n]"
+		}
+		n = min(v, 20)
+	}
+	results, err := database.GetPassedHttpTestResults(0, 0)
+	if err != nil {
+		customlog.Printf(customlog.Failure, "%v\n", err)
+		return "Could not read the database."
+	}
+	if len(results) == 0 {
+		return "No working configs in the latest test run yet."
+	}
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The %d fastest configs of the latest test run:\n", len(results))
+	for i, r := range results {
+		loc := ""
+		if r.IPLocation.Valid && r.IPLocation.String != "" {
+			loc = " · " + r.IPLocation.String
+		}
+		fmt.Fprintf(&b, "\n%d. %dms%s\n%s\n", i+1, r.DelayMs, loc, r.ConfigLink)
+	}
+	return b.String()
+}
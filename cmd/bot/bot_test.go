@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+)
+
+func TestExtractLinks(t *testing.T) {
+	text := "try these:\nvless://uuid@1.2.3.4:443#de  ss://YWVz@5.6.7.8:8388\n" +
+		"and my sub https://example.com/sub?token=1 HTTP://example.org/s plus junk :// ://x foo http://u:p@9.9.9.9:3128"
+	configs, subURLs := extractLinks(text)
+	wantConfigs := []string{"vless://uuid@1.2.3.4:443#de", "ss://YWVz@5.6.7.8:8388", "http://u:p@9.9.9.9:3128"}
+	wantSubs := []string{"https://example.com/sub?token=1", "HTTP://example.org/s"}
+	if !reflect.DeepEqual(configs, wantConfigs) {
+		t.Errorf("configs = %q, want %q", configs, wantConfigs)
+	}
+	if !reflect.DeepEqual(subURLs, wantSubs) {
+		t.Errorf("subscription URLs = %q, want %q", subURLs, wantSubs)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	text := strings.Repeat("a", 6) + "\n" + strings.Repeat("b", 6) + "\n" + strings.Repeat("c", 12)
+	got := splitMessage(text, 10)
+	want := []string{"aaaaaa", "bbbbbb", "cccccccccc", "cc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitMessage = %q, want %q", got, want)
+	}
+
+	// A long line of multi-byte characters is never cut inside a character.
+	for _, part := range splitMessage(strings.Repeat("é", 10), 5) {
+		if !strings.HasPrefix(part, "é") || len(part) > 5 {
+			t.Errorf("bad part %q", part)
+		}
+	}
+}
+
+func TestFormatResults(t *testing.T) {
+	results := pkghttp.ConfigResults{
+		{ConfigLink: "vless://slow", Status: "passed", Delay: 900, IpAddrLoc: "DE", ProtocolInfo: pkghttp.ProtocolInfo{Remark: "slow"}},
+		{ConfigLink: "vless://dead", Status: "failed", Reason: "context deadline exceeded", ProtocolInfo: pkghttp.ProtocolInfo{Remark: "dead"}},
+		{ConfigLink: "vless://fast", Status: "passed", Delay: 120, IpAddrLoc: "NL", DownloadSpeed: 12.5, UploadSpeed: 3},
+	}
+	out := formatResults(results, []string{"note"})
+
+	for _, want := range []string{"2 of 3 config(s) work.", "note", "✅ 120ms · NL · ↓12.5 ↑3.0 Mbps · -\nvless://fast", "✅ 900ms · DE · slow\nvless://slow", "❌ dead: context deadline exceeded"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "vless://fast") > strings.Index(out, "vless://slow") || strings.Contains(out, "vless://dead") {
+		t.Errorf("results are not ordered fastest first, or a failed link is shown:\n%s", out)
+	}
+}
+
+func TestTelegramClient(t *testing.T) {
+	var sent []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		switch r.URL.Path {
+		case "/botTOKEN/getUpdates":
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":7,"message":{"message_id":3,"from":{"id":42},"chat":{"id":42},"text":"/best"}}]}`))
+		case "/botTOKEN/sendMessage":
+			sent = append(sent, params)
+			w.Write([]byte(`{"ok":true,"result":{}}`))
+		default:
+			w.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+		}
+	}))
+	defer srv.Close()
+
+	tg := newTelegramClient(srv.URL, "TOKEN")
+	updates, err := tg.getUpdates(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].UpdateID != 7 || updates[0].Message.Text != "/best" || updates[0].Message.From.ID != 42 {
+		t.Errorf("updates = %+v", updates)
+	}
+
+	if err := tg.sendMessage(context.Background(), 42, 3, strings.Repeat("x\n", maxMessageLen)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || sent[0]["reply_parameters"] == nil || sent[1]["reply_parameters"] != nil {
+		t.Errorf("long message was sent as %d parts: %v", len(sent), sent)
+	}
+
+	if _, err := newTelegramClient(srv.URL, "BAD").getMe(context.Background()); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("getMe with a bad token: err = %v", err)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	b := &bot{cfg: &botConfig{Allowed: []int64{42, -100}}}
+	cases := []struct {
+		msg  tgMessage
+		want bool
+	}{
+		{tgMessage{From: &tgUser{ID: 42}, Chat: tgChat{ID: 42}}, true},
+		{tgMessage{From: &tgUser{ID: 7}, Chat: tgChat{ID: -100}}, true},
+		{tgMessage{From: &tgUser{ID: 7}, Chat: tgChat{ID: 7}}, false},
+	}
+	for _, c := range cases {
+		if got := b.allowed(&c.msg); got != c.want {
+			t.Errorf("allowed(from %d, chat %d) = %v, want %v", c.msg.From.ID, c.msg.Chat.ID, got, c.want)
+		}
+	}
+
+	// A public bot tests anyone's links but keeps /best to the list.
+	b.cfg.Public = true
+	stranger := &tgMessage{From: &tgUser{ID: 7}, Chat: tgChat{ID: 7}}
+	if !b.allowed(stranger) || b.listed(stranger) {
+		t.Errorf("public bot: allowed = %v, listed = %v; want true, false", b.allowed(stranger), b.listed(stranger))
+	}
+}
+
+func TestValidateBotConfigRequiresAllowOrPublic(t *testing.T) {
+	cfg := &botConfig{Token: "t", CoreType: "auto", MaxLinks: 1, Concurrent: 1, PerChat: 1, ThreadCount: 1}
+	if err := validateBotConfig(cfg); err == nil {
+		t.Error("validateBotConfig accepted a bot open to everyone without --public")
+	}
+	cfg.Public = true
+	if err := validateBotConfig(cfg); err != nil {
+		t.Errorf("--public: %v", err)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	b := &bot{
+		cfg:   &botConfig{Concurrent: 1, PerChat: 2},
+		queue: make(chan struct{}, 3),
+		chats: make(map[int64]int),
+	}
+	if !b.acquire(1) || !b.acquire(1) {
+		t.Fatal("first two tests of a chat refused")
+	}
+	if b.acquire(1) {
+		t.Error("third test of a chat accepted over --per-chat 2")
+	}
+	if !b.acquire(2) {
+		t.Fatal("test of another chat refused")
+	}
+	if b.acquire(3) {
+		t.Error("test accepted over the global limit")
+	}
+	b.release(1)
+	if !b.acquire(3) {
+		t.Error("test refused after a release")
+	}
+	b.release(1)
+	b.release(2)
+	b.release(3)
+	if len(b.chats) != 0 || len(b.queue) != 0 {
+		t.Errorf("after releasing everything: chats %v, queue %d", b.chats, len(b.queue))
+	}
+}
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxMessageLen is the longest text Telegram accepts in one message.
+const maxMessageLen = 4096
+
+// telegramClient is a minimal client of the Telegram Bot API, enough for long
+// polling updates and replying with text.
+type telegramClient struct {
+	baseURL string // e.g. https://api.telegram.org/bot<token>
+	client  *http.Client
+}
+
+func newTelegramClient(apiURL, token string) *telegramClient {
+	return &telegramClient{
+		baseURL: strings.TrimRight(apiURL, "/") + "/bot" + token,
+		client:  &http.Client{Timeout: 90 * time.Second},
+	}
+}
+
+type tgUpdate struct {
+	UpdateID int64      `json:"update_id"`
+	Message  *tgMessage `json:"message"`
+}
+
+type tgMessage struct {
+	MessageID int64   `json:"message_id"`
+	From      *tgUser `json:"from"`
+	Chat      tgChat  `json:"chat"`
+	Text      string  `json:"text"`
+	Caption   string  `json:"caption"`
+}
+
+type tgUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type tgChat struct {
+	ID int64 `json:"id"`
+}
+
+// call invokes a Bot API method and decodes its result into result, if not nil.
+func (c *telegramClient) call(ctx context.Context, method string, params, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The request URL embeds the bot token; keep it out of error messages.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("telegram %s: invalid response (HTTP %d): %w", method, resp.StatusCode, err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s: %s", method, envelope.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
+
+// getMe returns the bot's own username, which also checks the token.
+func (c *telegramClient) getMe(ctx context.Context) (string, error) {
+	var me tgUser
+	if err := c.call(ctx, "getMe", struct{}{}, &me); err != nil {
+		return "", err
+	}
+	return me.Username, nil
+}
+
+// getUpdates long-polls for new messages after offset for up to timeout.
+func (c *telegramClient) getUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]tgUpdate, error) {
+	params := map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}
+	var updates []tgUpdate
+	err := c.call(ctx, "getUpdates", params, &updates)
+	return updates, err
+}
+
+// sendMessage replies to a message with plain text, split over several messages
+// when it is too long for one.
+func (c *telegramClient) sendMessage(ctx context.Context, chatID, replyTo int64, text string) error {
+	for i, part := range splitMessage(text, maxMessageLen) {
+		params := map[string]interface{}{
+			"chat_id":                  chatID,
+			"text":                     part,
+			"disable_web_page_preview": true,
+		}
+		if i == 0 && replyTo != 0 {
+			params["reply_parameters"] = map[string]interface{}{"message_id": replyTo, "allow_sending_without_reply": true}
+		}
+		if err := c.call(ctx, "sendMessage", params, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMessage cuts text into parts of at most limit bytes, preferring line breaks.
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	for len(text) > limit {
+		cut := strings.LastIndexByte(text[:limit], '\n')
+		if cut <= 0 {
+			cut = limit
+			// Don't cut a multi-byte character in half.
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
@@ -1,7 +1,6 @@
 package cfscanner
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lilendian0x00/xray-knife/v9/database"
 	pkgscanner "github.com/lilendian0x00/xray-knife/v9/pkg/scanner"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
@@ -45,6 +45,13 @@ pass a file containing one subnet per line.`,
 		}
 		cliConfig.Subnets = allSubnets
 
+		link, err := database.ResolveConfigLink(cliConfig.ConfigLink)
+		if err != nil {
+			customlog.Printf(customlog.Failure, "%v\n", err)
+			return
+		}
+		cliConfig.ConfigLink = link
+
 		if !cliConfig.Resume {
 			if err := os.Remove(cliConfig.OutputFile); err != nil && !os.IsNotExist(err) {
 				customlog.Printf(customlog.Failure, "Failed to clear previous results file %s: %v\n", cliConfig.OutputFile, err)
@@ -85,7 +92,7 @@ pass a file containing one subnet per line.`,
 			}
 		}()
 
-		if err := service.Run(context.Background(), progressChan); err != nil {
+		if err := service.Run(cmd.Context(), progressChan); err != nil {
 			customlog.Printf(customlog.Failure, "Scan encountered an error: %v\n", err)
 		}
 		wg.Wait()
@@ -120,7 +127,7 @@ func init() {
 	CFscannerCmd.Flags().BoolVarP(&cliConfig.OnlySpeedtestResults, "only-speedtest", "k", false, "Only display results that have successful speedtest data")
 	CFscannerCmd.Flags().IntVarP(&cliConfig.DownloadMB, "download-mb", "d", 20, "Custom amount of data to download for speedtest (in MB)")
 	CFscannerCmd.Flags().IntVarP(&cliConfig.UploadMB, "upload-mb", "m", 10, "Custom amount of data to upload for speedtest (in MB)")
-	CFscannerCmd.Flags().StringVarP(&cliConfig.ConfigLink, "config", "C", "", "Use a config link as a proxy to test IPs")
+	CFscannerCmd.Flags().StringVarP(&cliConfig.ConfigLink, "config", "C", "", "Use a config link, or the ID or alias of a stored config, as a proxy to test IPs")
 	CFscannerCmd.Flags().BoolVarP(&cliConfig.InsecureTLS, "insecure", "E", false, "Allow insecure TLS connections for the proxy config")
 	CFscannerCmd.Flags().BoolVar(&cliConfig.Resume, "resume", false, "Resume scan from previous results (file or DB)")
 	CFscannerCmd.Flags().BoolVar(&cliConfig.SaveToDB, "save-db", false, "Save scan results to the database")
@@ -0,0 +1,18 @@
+package convert
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// ConvertCmd is the convert subcommand (groups subscription conversion tools).
+var ConvertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Converts subscriptions to the formats of other clients (Clash, sing-box, base64)",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	ConvertCmd.AddCommand(newServeCommand())
+}
@@ -0,0 +1,216 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	pkgconvert "github.com/lilendian0x00/xray-knife/v9/pkg/convert"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// defaultUserAgent asks panels for plain links, the only format the converter
+// reads, rather than a Clash or sing-box config of their own.
+const defaultUserAgent = "v2rayng"
+
+// serveConfig holds the options of the serve subcommand.
+type serveConfig struct {
+	Listen  string
+	Token   string
+	Timeout time.Duration
+	Proxy   string
+}
+
+func newServeCommand() *cobra.Command {
+	cfg := &serveConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serves an HTTP endpoint converting subscriptions on the fly",
+		Long: `Starts an HTTP server that fetches a subscription and returns it converted for
+another client, a self-hosted replacement for public subconverter services, which
+get to see every subscription URL they convert.
+
+  GET /convert?url=<subscription>&target=clash|singbox|base64[&ua=<user-agent>]
+
+clash is a Clash (mihomo) config, singbox the outbounds of a sing-box config;
+both add a selector defaulting to a latency test over every config. base64 is
+the links themselves. Configs the target can't express are left out and counted
+in the X-Skipped-Configs response header.
+
+The subscription is fetched as v2rayNG so panels answer with links; ua takes
+another User-Agent or client preset. Only http(s) subscriptions are fetched.
+
+Clients can't always send headers, so the token is accepted as "Authorization:
+Bearer <token>" or as a token= query parameter. It is taken from --token or the
+XRAY_KNIFE_CONVERT_TOKEN environment variable; without one, the server only
+listens on a loopback address and refuses requests naming another host or sent
+by a web page of another origin.
+
+Examples:
+  xray-knife convert serve
+  xray-knife convert serve --listen 0.0.0.0:8990 --token s3cret
+  curl "localhost:8990/convert?target=clash&url=https%3A%2F%2Fpanel.example.com%2Fsub"`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("token") {
+				cfg.Token = os.Getenv("XRAY_KNIFE_CONVERT_TOKEN")
+			}
+			if cfg.Token == "" && !utils.IsLoopbackAddr(cfg.Listen) {
+				return fmt.Errorf("refusing to serve on %s without a token: set --token or XRAY_KNIFE_CONVERT_TOKEN", cfg.Listen)
+			}
+			if cfg.Timeout <= 0 {
+				return fmt.Errorf("--timeout must be positive")
+			}
+			return runServe(cmd.Context(), cfg)
+		},
+	}
+
+	cmd.Flags().StringVarP(&cfg.Listen, "listen", "l", "127.0.0.1:8990", "Address to listen on")
+	cmd.Flags().StringVar(&cfg.Token, "token", "", "Token required on every request (env XRAY_KNIFE_CONVERT_TOKEN)")
+	cmd.Flags().DurationVar(&cfg.Timeout, "timeout", 30*time.Second, "Time limit for fetching a subscription")
+	cmd.Flags().StringVarP(&cfg.Proxy, "proxy", "x", "", "Proxy to fetch subscriptions through (e.g. socks5://127.0.0.1:1080)")
+	return cmd
+}
+
+// runServe serves conversions until ctx is done.
+func runServe(ctx context.Context, cfg *serveConfig) error {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+	srv := &http.Server{Handler: newConverter(cfg).routes(), ReadHeaderTimeout: 10 * time.Second}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+	customlog.Printf(customlog.Success, "Converter listening on http://%s/convert\n", ln.Addr())
+	if cfg.Token == "" {
+		customlog.Printf(customlog.Warning, "No token set: any local process can use the converter.\n")
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("converter failed: %w", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	return nil
+}
+
+type converter struct {
+	cfg *serveConfig
+}
+
+func newConverter(cfg *serveConfig) *converter {
+	return &converter{cfg: cfg}
+}
+
+func (c *converter) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /convert", c.handleConvert)
+	return mux
+}
+
+// authorized checks the token of a request, from its header or query.
+func (c *converter) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.cfg.Token)) == 1
+}
+
+// checkLocal rejects a request to a tokenless converter, which only listens on
+// loopback, that names another host, as DNS rebinding does, or comes from a web
+// page of another origin, which any site the user visits could send.
+func checkLocal(r *http.Request) error {
+	if !utils.IsLoopbackHost(r.Host) {
+		return fmt.Errorf("host %q is not a loopback address", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !utils.IsLoopbackHost(u.Host) {
+			return fmt.Errorf("cross-origin request from %q", origin)
+		}
+	}
+	return nil
+}
+
+func (c *converter) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if c.cfg.Token == "" {
+		if err := checkLocal(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	} else if !c.authorized(r) {
+		http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	target, err := pkgconvert.ParseTarget(q.Get("target"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subURL := q.Get("url")
+	u, err := url.Parse(subURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, fmt.Sprintf("url must be an http(s) subscription URL, got %q", subURL), http.StatusBadRequest)
+		return
+	}
+	ua := q.Get("ua")
+	if ua == "" {
+		ua = defaultUserAgent
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.cfg.Timeout)
+	defer cancel()
+	sub := &subs.Subscription{Url: subURL, UserAgent: ua, Proxy: c.cfg.Proxy}
+	seen := make(map[string]bool)
+	var links []string
+	if _, err := sub.Stream(ctx, func(link string) error {
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+		return nil
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("failed to fetch the subscription: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	var body bytes.Buffer
+	skipped, err := pkgconvert.Convert(&body, target, links)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, pkgconvert.ErrNothingConverted) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, fmt.Sprintf("%v (%d links, %d skipped)", err, len(links), len(skipped)), status)
+		return
+	}
+	customlog.Printf(customlog.Info, "Converted %s to %s: %d configs, %d skipped\n", u.Host, target, len(links)-len(skipped), len(skipped))
+
+	w.Header().Set("Content-Type", pkgconvert.ContentType(target))
+	w.Header().Set("X-Skipped-Configs", strconv.Itoa(len(skipped)))
+	w.Write(body.Bytes())
+}
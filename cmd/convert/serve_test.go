@@ -0,0 +1,148 @@
+package convert
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSub = "vless://d342d11e-d424-4583-b36e-524ab1f0afa4@1.2.3.4:443?security=tls&type=ws&sni=a.example.com#A\n" +
+	"ss://YWVzLTEyOC1nY206cGFzcw@5.6.7.8:8388#B\n" +
+	"wireguard://broken#C\n"
+
+// newTestConverter starts a converter and a subscription server, returning the
+// converter, the subscription URL and where the User-Agent it was fetched with goes.
+func newTestConverter(t *testing.T, token string) (*httptest.Server, string, *string) {
+	t.Helper()
+	gotUA := new(string)
+	sub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*gotUA = r.Header.Get("User-Agent")
+		fmt.Fprint(w, base64.StdEncoding.EncodeToString([]byte(testSub)))
+	}))
+	t.Cleanup(sub.Close)
+	conv := httptest.NewServer(newConverter(&serveConfig{Token: token, Timeout: 5 * time.Second}).routes())
+	t.Cleanup(conv.Close)
+	return conv, sub.URL, gotUA
+}
+
+func get(t *testing.T, rawURL string, header http.Header) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", rawURL, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func TestConvertEndpoint(t *testing.T) {
+	conv, subURL, ua := newTestConverter(t, "")
+	resp, body := get(t, conv.URL+"/convert?target=clash&url="+url.QueryEscape(subURL), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/yaml") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if n := resp.Header.Get("X-Skipped-Configs"); n != "1" {
+		t.Errorf("X-Skipped-Configs = %q, want 1", n)
+	}
+	if !strings.Contains(body, `name: "A"`) || !strings.Contains(body, `name: "B"`) {
+		t.Errorf("configs missing from the output:\n%s", body)
+	}
+	if !strings.HasPrefix(*ua, "v2rayNG/") {
+		t.Errorf("fetched with User-Agent %q, want the v2rayng preset", *ua)
+	}
+
+	get(t, conv.URL+"/convert?target=singbox&ua=curl%2F8&url="+url.QueryEscape(subURL), nil)
+	if *ua != "curl/8" {
+		t.Errorf("fetched with User-Agent %q, want the ua parameter", *ua)
+	}
+}
+
+func TestConvertEndpoint_Errors(t *testing.T) {
+	conv, subURL, _ := newTestConverter(t, "")
+	for query, want := range map[string]int{
+		"target=surge&url=" + url.QueryEscape(subURL):   http.StatusBadRequest,
+		"target=clash&url=file%3A%2F%2F%2Fetc%2Fpasswd": http.StatusBadRequest,
+		"target=clash": http.StatusBadRequest,
+		"target=clash&url=http%3A%2F%2F127.0.0.1%3A1%2F": http.StatusBadGateway,
+	} {
+		if resp, body := get(t, conv.URL+"/convert?"+query, nil); resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d (%s)", query, resp.StatusCode, want, body)
+		}
+	}
+}
+
+func TestConvertEndpoint_Token(t *testing.T) {
+	conv, subURL, _ := newTestConverter(t, "s3cret")
+	base := conv.URL + "/convert?target=base64&url=" + url.QueryEscape(subURL)
+	if resp, _ := get(t, base, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without token: status %d", resp.StatusCode)
+	}
+	if resp, _ := get(t, base+"&token=s3cret", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("with token= parameter: status %d", resp.StatusCode)
+	}
+	if resp, _ := get(t, base, http.Header{"Authorization": {"Bearer s3cret"}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("with bearer token: status %d", resp.StatusCode)
+	}
+}
+
+func TestConvertEndpoint_Local(t *testing.T) {
+	conv, subURL, _ := newTestConverter(t, "")
+	base := conv.URL + "/convert?target=base64&url=" + url.QueryEscape(subURL)
+	do := func(host, origin string) int {
+		req, _ := http.NewRequest("GET", base, nil)
+		if host != "" {
+			req.Host = host
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	tests := []struct {
+		host, origin string
+		want         int
+	}{
+		{"", "", http.StatusOK},
+		{"localhost:8990", "http://localhost:8990", http.StatusOK},
+		// A rebound name resolves to loopback but is still named in Host.
+		{"evil.example:8990", "", http.StatusForbidden},
+		{"", "https://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := do(tt.host, tt.origin); got != tt.want {
+			t.Errorf("host %q, origin %q: status %d, want %d", tt.host, tt.origin, got, tt.want)
+		}
+	}
+
+	// A token replaces the check.
+	conv, subURL, _ = newTestConverter(t, "s3cret")
+	req, _ := http.NewRequest("GET", conv.URL+"/convert?target=base64&token=s3cret&url="+url.QueryEscape(subURL), nil)
+	req.Host = "converter.example"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("with token and another host: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,130 @@
+package generate
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// fromTemplateConfig holds the options of the from-template subcommand.
+type fromTemplateConfig struct {
+	Template  string
+	Data      string
+	DryRun    bool
+	BatchSize int
+}
+
+func newFromTemplateCommand() *cobra.Command {
+	cfg := &fromTemplateConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "from-template",
+		Short: "Generates configs for a fleet of servers from a link template and an inventory",
+		Long: `Fills the {{field}} placeholders of a link template with each row of a server
+inventory and stores the resulting configs in the DB, to set up many servers
+that share their settings at once.
+
+--template is a link or a file with one template per line, e.g. a VLESS and a
+Trojan link per server. --data is a CSV file whose header row names the fields
+(ip, port, uuid, sni, or any other), or a .json file holding an array of
+objects. Field names are case-insensitive; a row missing a field a template
+uses is reported and skipped.
+
+Values are inserted as they are, except in the remark after '#', where they are
+percent-encoded. A vmess template may be base64 as usual or its plain JSON
+payload (vmess://{"add":"{{ip}}",...}); the filled-in payload is encoded.
+
+Example template and data:
+  vless://{{uuid}}@{{ip}}:{{port}}?security=tls&sni={{sni}}&type=ws&path=%2Fws#{{name}}
+
+  name,ip,port,uuid,sni
+  Frankfurt 1,203.0.113.10,443,3f8e2a1c-...,de1.example.com
+
+Examples:
+  xray-knife generate from-template --template tpl.link --data servers.csv
+  xray-knife generate from-template --template "trojan://{{password}}@{{ip}}:443#{{name}}" --data servers.json --dry-run`,
+		Args:         cobra.NoArgs,
+		PreRunE:      func(cmd *cobra.Command, args []string) error { return cfg.validate() },
+		RunE:         func(cmd *cobra.Command, args []string) error { return cfg.run() },
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&cfg.Template, "template", "t", "", "Link template with {{field}} placeholders, or a file of them, one per line")
+	flags.StringVarP(&cfg.Data, "data", "d", "", "Server inventory: CSV with a header row, or a JSON array of objects (.json)")
+	flags.BoolVar(&cfg.DryRun, "dry-run", false, "Print the generated links without writing to the DB")
+	flags.IntVar(&cfg.BatchSize, "batch-size", 500, "Number of configs committed to the DB per transaction")
+	cmd.MarkFlagRequired("template")
+	cmd.MarkFlagRequired("data")
+	return cmd
+}
+
+func (cfg *fromTemplateConfig) validate() error {
+	if cfg.BatchSize < 1 {
+		return fmt.Errorf("--batch-size must be at least 1, got %d", cfg.BatchSize)
+	}
+	return nil
+}
+
+func (cfg *fromTemplateConfig) run() error {
+	templates, err := readTemplates(cfg.Template)
+	if err != nil {
+		return err
+	}
+	rows, err := readRows(cfg.Data)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no rows in %s", cfg.Data)
+	}
+
+	c := core.NewAutomaticCore(false, false)
+	var links []string
+	skipped := 0
+	for i, row := range rows {
+		for _, t := range templates {
+			link, err := t.render(row)
+			if err == nil {
+				err = checkLink(c, link)
+			}
+			if err != nil {
+				// Row 1 is the first after the CSV header.
+				customlog.Printf(customlog.Warning, "Skipping row %d: %v\n", i+1, err)
+				skipped++
+				continue
+			}
+			links = append(links, link)
+		}
+	}
+
+	if cfg.DryRun {
+		for _, l := range links {
+			fmt.Println(l)
+		}
+		return nil
+	}
+	saved, err := subs.SaveLinks(c, links, cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+	customlog.Printf(customlog.Finished, "Generated %d configs from %d rows and saved them to the database (%d skipped).\n", saved, len(rows), skipped)
+	return nil
+}
+
+// checkLink makes sure a generated link parses, so a typo in the template or the
+// data shows up here rather than as a failed test.
+func checkLink(c core.Core, link string) error {
+	p, err := c.CreateProtocol(link)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(); err != nil {
+		return fmt.Errorf("generated link does not parse: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package generate
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// GenerateCmd is the generate subcommand (groups config generation tools).
+var GenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generates config links, e.g. for a fleet of servers from a template",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	GenerateCmd.AddCommand(newFromTemplateCommand())
+}
@@ -0,0 +1,193 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// placeholder matches a {{field}} of a link template.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// linkTemplate is a config link with {{field}} placeholders.
+type linkTemplate struct {
+	raw string
+	// vmess is the JSON payload of a vmess template, whose placeholders are
+	// filled in before it is encoded.
+	vmess string
+}
+
+func parseTemplate(raw string) (*linkTemplate, error) {
+	raw = strings.TrimSpace(raw)
+	t := &linkTemplate{raw: raw}
+	if payload, ok := strings.CutPrefix(raw, "vmess://"); ok {
+		if strings.HasPrefix(payload, "{") {
+			t.vmess = payload
+		} else {
+			decoded, err := utils.Base64Decode(payload)
+			if err != nil {
+				return nil, fmt.Errorf("invalid vmess template: %w", err)
+			}
+			t.vmess = string(decoded)
+		}
+	}
+	if len(placeholder.FindAllString(raw+t.vmess, 1)) == 0 {
+		return nil, fmt.Errorf("template %q has no {{field}} placeholder", raw)
+	}
+	return t, nil
+}
+
+// render fills in the placeholders with the fields of row. Values are escaped
+// where they land: JSON-escaped in a vmess payload and percent-encoded in the
+// remark of other links.
+func (t *linkTemplate) render(row map[string]string) (string, error) {
+	if t.vmess != "" {
+		payload, err := fill(t.vmess, row, func(v string) string {
+			quoted, _ := json.Marshal(v)
+			return string(quoted[1 : len(quoted)-1])
+		})
+		if err != nil {
+			return "", err
+		}
+		if !json.Valid([]byte(payload)) {
+			return "", fmt.Errorf("vmess payload is not valid JSON after filling in the fields")
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString([]byte(payload)), nil
+	}
+
+	base, fragment, hasFragment := strings.Cut(t.raw, "#")
+	link, err := fill(base, row, func(v string) string { return v })
+	if err != nil {
+		return "", err
+	}
+	if hasFragment {
+		remark, err := fill(fragment, row, url.PathEscape)
+		if err != nil {
+			return "", err
+		}
+		link += "#" + remark
+	}
+	return link, nil
+}
+
+func fill(s string, row map[string]string, escape func(string) string) (string, error) {
+	var missing string
+	out := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := strings.ToLower(placeholder.FindStringSubmatch(m)[1])
+		v, ok := row[name]
+		if !ok || v == "" {
+			if missing == "" {
+				missing = name
+			}
+			return m
+		}
+		return escape(v)
+	})
+	if missing != "" {
+		return "", fmt.Errorf("no value for {{%s}}", missing)
+	}
+	return out, nil
+}
+
+// readTemplates reads the templates of --template: a link, or a file with one
+// template per line ('#' starts a comment line).
+func readTemplates(arg string) ([]*linkTemplate, error) {
+	lines := []string{arg}
+	if !strings.Contains(arg, "://") {
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		lines = strings.Split(string(data), "\n")
+	}
+	var templates []*linkTemplate
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		t, err := parseTemplate(line)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no template in %s", arg)
+	}
+	return templates, nil
+}
+
+// readRows reads the server inventory: a JSON array of objects when path ends
+// in .json, CSV with a header row otherwise. Field names are lowercased.
+func readRows(path string) ([]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return parseJSONRows(data)
+	}
+	return parseCSVRows(data)
+}
+
+func parseCSVRows(data []byte) ([]map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	var rows []map[string]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		row := make(map[string]string, len(header))
+		for i, v := range record {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseJSONRows(data []byte) ([]map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var objects []map[string]interface{}
+	if err := dec.Decode(&objects); err != nil {
+		return nil, fmt.Errorf("invalid JSON, expected an array of objects: %w", err)
+	}
+	rows := make([]map[string]string, 0, len(objects))
+	for _, o := range objects {
+		row := make(map[string]string, len(o))
+		for k, v := range o {
+			if v != nil {
+				row[strings.ToLower(k)] = fmt.Sprint(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,66 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	rows, err := parseCSVRows([]byte("Name,IP,Port,UUID,SNI\n" +
+		"Frankfurt 1,203.0.113.10,443,3f8e2a1c-1b2d-4c5e-9f70-112233445566,de1.example.com\n" +
+		"# retired\n" +
+		"Paris,203.0.113.20,8443,,fr.example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %v", rows)
+	}
+
+	tpl, err := parseTemplate("vless://{{uuid}}@{{ip}}:{{ port }}?security=tls&sni={{SNI}}&type=ws&path=%2Fws#{{name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tpl.render(rows[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "vless://3f8e2a1c-1b2d-4c5e-9f70-112233445566@203.0.113.10:443?security=tls&sni=de1.example.com&type=ws&path=%2Fws#Frankfurt%201"
+	if got != want {
+		t.Errorf("render() =\n%s\nwant\n%s", got, want)
+	}
+	if err := checkLink(core.NewAutomaticCore(false, false), got); err != nil {
+		t.Errorf("generated link does not parse: %v", err)
+	}
+	if _, err := tpl.render(rows[1]); err == nil || !strings.Contains(err.Error(), "{{uuid}}") {
+		t.Errorf("render() of a row without uuid = %v", err)
+	}
+
+	if _, err := parseTemplate("vless://fixed@1.2.3.4:443"); err == nil {
+		t.Error("parseTemplate accepted a link without placeholders")
+	}
+}
+
+func TestRenderVmessTemplate(t *testing.T) {
+	rows, err := parseJSONRows([]byte(`[{"ip": "203.0.113.10", "port": 443, "uuid": "3f8e2a1c-1b2d-4c5e-9f70-112233445566", "name": "DE \"1\""}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := parseTemplate(`vmess://{"v":"2","ps":"{{name}}","add":"{{ip}}","port":"{{port}}","id":"{{uuid}}","aid":"0","net":"tcp","tls":""}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tpl.render(rows[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remark := utils.LinkRemark(got); remark != `DE "1"` {
+		t.Errorf("remark = %q", remark)
+	}
+	if err := checkLink(core.NewAutomaticCore(false, false), got); err != nil {
+		t.Errorf("generated link does not parse: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// CompareConfig holds the options of the compare subcommand.
+type CompareConfig struct {
+	ConfigLink      string
+	ConfigLinksFile string
+	Cores           []string
+	ThreadCount     uint16
+	DestURL         string
+	MaxDelay        uint16
+	Timeout         uint16
+	Retries         uint16
+	InsecureTLS     bool
+	Speedtest       bool
+	SpeedtestAmount uint64
+	OutputFile      string
+
+	// DB flags
+	FromDB         bool
+	Limit          int
+	SubscriptionID int64
+	Protocol       string
+}
+
+func newCompareCommand() *cobra.Command {
+	config := &CompareConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "compare",
+		Short: "Tests the same configs through xray and sing-box and compares the cores",
+		Long: `Tests every config once through each core and reports, per protocol, how many
+configs passed on each core, their median delay and download speed, and which
+core was faster head to head on the configs that passed on both.
+
+The cores run one after the other, so they don't compete for bandwidth. Configs
+that pass on one core but fail on the other are listed with the error of the
+failing core: they usually point at a core-specific bug or an unsupported
+option. Protocols a core can't load at all are shown as unsupported.
+
+Examples:
+  xray-knife http compare -f configs.txt
+  xray-knife http compare --from-db --protocol vless --limit 200 -p
+  xray-knife http compare -c "vless://..." -o compare.csv`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateCompareConfig(config); err != nil {
+				return err
+			}
+
+			var links []string
+			switch {
+			case config.FromDB:
+				var err error
+				links, err = database.GetConfigsFromDB(config.SubscriptionID, config.Protocol, config.Limit)
+				if err != nil {
+					return err
+				}
+			case config.ConfigLinksFile != "":
+				links = utils.ParseFileByNewline(config.ConfigLinksFile)
+			default:
+				link, err := database.ResolveConfigLink(config.ConfigLink)
+				if err != nil {
+					return err
+				}
+				links = []string{link}
+			}
+			links, _ = pkghttp.DeduplicateLinks(links)
+			if len(links) == 0 {
+				customlog.Printf(customlog.Warning, "No config links to test.\n")
+				return nil
+			}
+			return runCompare(cmd.Context(), config, links)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&config.ConfigLink, "config", "c", "", "The config link to test, or the ID or alias of a stored config")
+	flags.StringVarP(&config.ConfigLinksFile, "file", "f", "", "Read config links from a file")
+	flags.StringSliceVar(&config.Cores, "cores", []string{"xray", "singbox"}, "Cores to compare")
+	flags.Uint16VarP(&config.ThreadCount, "thread", "t", 50, "Number of threads")
+	flags.StringVarP(&config.DestURL, "url", "u", "https://cloudflare.com/cdn-cgi/trace", "The url to test config")
+	flags.Uint16VarP(&config.MaxDelay, "mdelay", "d", 5000, "Maximum allowed delay (ms)")
+	flags.Uint16Var(&config.Timeout, "timeout", 0, "HTTP client timeout in ms (0 = use mdelay value)")
+	flags.Uint16Var(&config.Retries, "retries", 0, "Number of retries for failed proxy tests")
+	flags.BoolVarP(&config.InsecureTLS, "insecure", "e", false, "Insecure tls connection (fake SNI)")
+	flags.BoolVarP(&config.Speedtest, "speedtest", "p", false, "Also compare download speeds with speed.cloudflare.com")
+	flags.Uint64VarP(&config.SpeedtestAmount, "amount", "a", 10000, "Download and upload amount (KB)")
+	flags.StringVarP(&config.OutputFile, "out", "o", "", "Write the result of every config on every core to this CSV file")
+	flags.BoolVar(&config.FromDB, "from-db", false, "Test configs from the database")
+	flags.IntVar(&config.Limit, "limit", 0, "Limit the number of configs to test from the DB (0 for all)")
+	flags.Int64Var(&config.SubscriptionID, "sub-id", 0, "Filter configs by subscription ID from the DB")
+	flags.StringVar(&config.Protocol, "protocol", "", "Filter configs by protocol (vmess, vless, etc.) from the DB")
+	cmd.MarkFlagsMutuallyExclusive("file", "config", "from-db")
+	cmd.MarkFlagsOneRequired("file", "config", "from-db")
+	return cmd
+}
+
+func validateCompareConfig(cfg *CompareConfig) error {
+	if len(cfg.Cores) < 2 {
+		return fmt.Errorf("--cores needs at least two cores to compare")
+	}
+	seen := make(map[string]bool)
+	for i, name := range cfg.Cores {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "xray", "singbox":
+		default:
+			return fmt.Errorf("invalid core %q in --cores. Available cores: (xray, singbox)", cfg.Cores[i])
+		}
+		if seen[name] {
+			return fmt.Errorf("core %q is listed twice in --cores", name)
+		}
+		seen[name] = true
+		cfg.Cores[i] = name
+	}
+	return nil
+}
+
+// runCompare tests links through each core in turn and prints the comparison.
+func runCompare(ctx context.Context, cfg *CompareConfig, links []string) error {
+	customlog.Printf(customlog.Info, "Comparing %s on %d configs.\n", strings.Join(cfg.Cores, " and "), len(links))
+
+	results := make(map[string]pkghttp.ConfigResults, len(cfg.Cores))
+	for _, name := range cfg.Cores {
+		examiner, err := pkghttp.NewExaminer(pkghttp.Options{
+			Core:                   name,
+			MaxDelay:               cfg.MaxDelay,
+			Timeout:                cfg.Timeout,
+			Retries:                uint8(cfg.Retries),
+			InsecureTLS:            cfg.InsecureTLS,
+			DoSpeedtest:            cfg.Speedtest,
+			TestEndpoint:           cfg.DestURL,
+			TestEndpointHttpMethod: "GET",
+			SpeedtestKbAmount:      cfg.SpeedtestAmount,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create %s examiner: %w", name, err)
+		}
+		loadTestTargets(examiner)
+		results[name] = testWithCore(ctx, examiner, name, cfg.ThreadCount, links)
+		if ctx.Err() != nil {
+			customlog.Printf(customlog.Warning, "Interrupted: the comparison is incomplete.\n")
+			return nil
+		}
+	}
+
+	pairs := pkghttp.PairCoreResults(links, cfg.Cores, results)
+	fmt.Println()
+	pkghttp.WriteCoreComparison(os.Stdout, pairs, cfg.Cores)
+
+	if cfg.OutputFile != "" {
+		f, err := os.Create(cfg.OutputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", cfg.OutputFile, err)
+		}
+		defer f.Close()
+		if err := pkghttp.WriteCoreComparisonCSV(f, pairs, cfg.Cores); err != nil {
+			return fmt.Errorf("failed to write %s: %w", cfg.OutputFile, err)
+		}
+		customlog.Printf(customlog.Success, "Wrote the per-config results to %s\n", cfg.OutputFile)
+	}
+	return nil
+}
+
+// testWithCore tests links through one core with a progress bar.
+func testWithCore(ctx context.Context, examiner *pkghttp.Examiner, name string, threads uint16, links []string) pkghttp.ConfigResults {
+	bar := progressbar.NewOptions(len(links),
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetDescription(fmt.Sprintf("[cyan]Testing with %s (0 passed)[reset]", name)),
+	)
+
+	var results pkghttp.ConfigResults
+	var passedCount int32
+	resultsChan := make(chan *pkghttp.Result, threads)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range resultsChan {
+			if res.Status == "passed" {
+				atomic.AddInt32(&passedCount, 1)
+			}
+			results = append(results, res)
+		}
+	}()
+	pkghttp.NewTestManager(examiner, threads, false, nil).RunTests(ctx, links, resultsChan, func() {
+		bar.Describe(fmt.Sprintf("[cyan]Testing with %s (%d passed)[reset]", name, atomic.LoadInt32(&passedCount)))
+		bar.Add(1)
+	})
+	close(resultsChan)
+	<-done
+	bar.Finish()
+	fmt.Fprintln(os.Stderr)
+	return results
+}
+
+func init() {
+	HttpCmd.AddCommand(newCompareCommand())
+}
@@ -0,0 +1,460 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/watchdog"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// DaemonConfig holds the options of the daemon subcommand.
+type DaemonConfig struct {
+	Interval    time.Duration
+	Top         int
+	BestFile    string
+	Format      string
+	ServeAddr   string
+	ThreadCount uint16
+	CoreType    string
+	DestURL     string
+	MaxDelay    uint16
+	Timeout     uint16
+	Retries     uint16
+	InsecureTLS bool
+	PoolSize    int
+	SaveToDB    bool
+	IPVersion   string
+	Dial        protocol.DialOptions
+	Upload      UploadOptions
+	MaxMemory   uint64
+
+	// DB filters
+	Limit          int
+	SubscriptionID int64
+	Protocol       string
+}
+
+// bestList is the latest list of top configs, shared with the subscription server.
+type bestList struct {
+	mu        sync.RWMutex
+	data      []byte
+	updatedAt time.Time
+	// picks are the configs of the list with their score, which /random draws from.
+	picks []scoredLink
+	// weights score the configs of a round, see score.Score.
+	weights score.Weights
+}
+
+// scoredLink is a config of the list and its score in the round that published it.
+type scoredLink struct {
+	link  string
+	score float64
+}
+
+// set publishes data, the encoded list of top, and scores the configs of top by
+// their result in the round.
+func (b *bestList) set(data []byte, top pkghttp.ConfigResults) {
+	now := time.Now()
+	picks := make([]scoredLink, len(top))
+	for i, r := range top {
+		sample := score.Sample{Passed: true, Delay: r.Delay, DownloadMbps: float64(r.DownloadSpeed), At: now}
+		picks[i] = scoredLink{link: r.ConfigLink, score: score.Score([]score.Sample{sample}, b.weights, now).Total}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = data
+	b.updatedAt = now
+	b.picks = picks
+}
+
+// serveRandom answers with a single config of the list, drawn with a chance
+// proportional to its score.
+func (b *bestList) serveRandom(w http.ResponseWriter, r *http.Request) {
+	b.mu.RLock()
+	picks := b.picks
+	b.mu.RUnlock()
+	if len(picks) == 0 {
+		http.Error(w, "the first test round has not finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	pick := weightedPick(picks, rand.Float64())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Config-Score", fmt.Sprintf("%.1f", pick.score))
+	fmt.Fprintln(w, pick.link)
+}
+
+// weightedPick returns the config at u (0 <= u < 1) of the cumulative scores of
+// picks, so each is drawn with a chance proportional to its score. Configs are
+// drawn uniformly when none scored above 0.
+func weightedPick(picks []scoredLink, u float64) scoredLink {
+	var total float64
+	for _, p := range picks {
+		total += max(p.score, 0)
+	}
+	if total == 0 {
+		return picks[min(int(u*float64(len(picks))), len(picks)-1)]
+	}
+	target := u * total
+	for _, p := range picks {
+		if target -= max(p.score, 0); target < 0 {
+			return p
+		}
+	}
+	return picks[len(picks)-1]
+}
+
+func (b *bestList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.RLock()
+	data, updatedAt := b.data, b.updatedAt
+	b.mu.RUnlock()
+	if data == nil {
+		http.Error(w, "the first test round has not finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, "", updatedAt, bytes.NewReader(data))
+}
+
+func newDaemonCommand() *cobra.Command {
+	config := &DaemonConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Periodically re-tests DB configs and keeps a file of the best ones up to date",
+		Long: `Runs in the foreground, re-testing the configs stored in the database every
+--interval and rewriting --best with the --top fastest working configs, those of
+subscriptions with a higher priority ('subs update --priority') first. The file is
+replaced atomically, so a client or sync tool never reads a half-written list.
+When a round finds no working config, the previous list is kept.
+
+With --serve, the same list is also served over HTTP at every path, so client
+devices can add it as a subscription URL and always pull a fresh, working list.
+--format base64 writes the encoding most V2Ray clients expect from a subscription.
+
+GET /random returns a single config of the list instead, drawn at random with a
+chance proportional to its score in the round (weighted as set in
+` + score.ConfigFileName + `, see 'subs best'), for scripts that need one good
+config rather than the whole list. Its score is in the X-Config-Score header.
+
+After every round the daemon logs the goroutines, open files and resident
+memory it holds, which grow when the cores leak. With --max-memory it restarts
+itself, with the same command line, once its resident memory goes over that
+many MB, instead of needing an external supervisor to do it.
+
+With --upload, the list (named after --best) and a results.json of the round are
+pushed after every round to an https://, webdavs:// or s3:// destination (see
+'xray-knife http --help'), for a team sharing one probe machine.
+
+Examples:
+  xray-knife http daemon
+  xray-knife http daemon --interval 15m --top 30 --best /srv/sub/best.txt
+  xray-knife http daemon --serve 127.0.0.1:8081 --format base64 --sub-id 2
+  curl http://127.0.0.1:8081/random
+  xray-knife http daemon --max-memory 1024
+  xray-knife http daemon --best "" --upload "s3://team-lists/probe-de?region=eu-central-1"`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateDaemonConfig(config); err != nil {
+				return err
+			}
+			return runDaemon(cmd.Context(), config)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.DurationVar(&config.Interval, "interval", 30*time.Minute, "Time between the start of two test rounds")
+	flags.IntVar(&config.Top, "top", 20, "Number of fastest configs to keep in the list")
+	flags.StringVar(&config.BestFile, "best", "best.txt", "File rewritten with the best configs after each round ('' to disable)")
+	flags.StringVar(&config.Format, "format", "plain", "Format of the list (plain, base64)")
+	flags.StringVar(&config.ServeAddr, "serve", "", "Serve the list over HTTP on this address, e.g. 127.0.0.1:8081")
+	flags.Uint16VarP(&config.ThreadCount, "thread", "t", 50, "Number of threads")
+	flags.StringVarP(&config.CoreType, "core", "z", "auto", "Core type (auto, singbox, xray)")
+	flags.StringVarP(&config.DestURL, "url", "u", "https://cloudflare.com/cdn-cgi/trace", "The url to test config")
+	flags.Uint16VarP(&config.MaxDelay, "mdelay", "d", 5000, "Maximum allowed delay (ms)")
+	flags.Uint16Var(&config.Timeout, "timeout", 0, "HTTP client timeout in ms (0 = use mdelay value)")
+	flags.Uint16Var(&config.Retries, "retries", 0, "Number of retries for failed proxy tests")
+	flags.BoolVarP(&config.InsecureTLS, "insecure", "e", false, "Insecure tls connection (fake SNI)")
+	flags.StringVar(&config.IPVersion, "ip-version", "", "Dial config servers over IPv4 or IPv6 only (4, 6), or test over both (both)")
+	addDialFlags(cmd, &config.Dial)
+	addUploadFlags(cmd, &config.Upload)
+	flags.IntVar(&config.PoolSize, "pool", 0, "Load this many configs into one shared core instance (0 = one instance per config)")
+	flags.BoolVar(&config.SaveToDB, "save-db", false, "Save the results of every round to the database as a test run")
+	flags.Uint64Var(&config.MaxMemory, "max-memory", 0, "Restart the daemon when its resident memory goes over this many MB (0 = never)")
+	flags.IntVar(&config.Limit, "limit", 0, "Limit the number of configs tested per round (0 for all)")
+	flags.Int64Var(&config.SubscriptionID, "sub-id", 0, "Only test configs of this subscription")
+	flags.StringVar(&config.Protocol, "protocol", "", "Only test configs of this protocol (vmess, vless, etc.)")
+	return cmd
+}
+
+func validateDaemonConfig(cfg *DaemonConfig) error {
+	switch cfg.CoreType {
+	case "auto", "xray", "singbox":
+	default:
+		return fmt.Errorf("invalid core type. Available cores: (auto, xray, singbox)")
+	}
+	switch cfg.Format {
+	case "plain", "base64":
+	default:
+		return fmt.Errorf("invalid --format %q (supported: plain, base64)", cfg.Format)
+	}
+	if cfg.Interval < time.Minute {
+		return fmt.Errorf("--interval must be at least 1m, got %s", cfg.Interval)
+	}
+	if cfg.Top < 1 {
+		return fmt.Errorf("--top must be at least 1, got %d", cfg.Top)
+	}
+	if cfg.BestFile == "" && cfg.ServeAddr == "" && cfg.Upload.URL == "" {
+		return fmt.Errorf("nothing to do: set --best, --serve or --upload")
+	}
+	if err := validateUploadOptions(cfg.Upload); err != nil {
+		return err
+	}
+	if cfg.PoolSize < 0 {
+		return fmt.Errorf("--pool must not be negative")
+	}
+	if _, err := core.ParseIPVersion(cfg.IPVersion); err != nil {
+		return err
+	}
+	return validateDialOptions(cfg.Dial, cfg.IPVersion)
+}
+
+// runDaemon tests the DB configs every interval until ctx is done.
+func runDaemon(ctx context.Context, cfg *DaemonConfig) error {
+	opts := pkghttp.Options{
+		Core:                   cfg.CoreType,
+		MaxDelay:               cfg.MaxDelay,
+		Timeout:                cfg.Timeout,
+		Retries:                uint8(cfg.Retries),
+		InsecureTLS:            cfg.InsecureTLS,
+		TestEndpoint:           cfg.DestURL,
+		TestEndpointHttpMethod: "GET",
+		IPVersion:              cfg.IPVersion,
+		Dial:                   cfg.Dial,
+	}
+	examiner, err := pkghttp.NewExaminer(opts)
+	if err != nil {
+		return fmt.Errorf("failed to create examiner: %w", err)
+	}
+
+	best := &bestList{weights: score.DefaultWeights()}
+	if cfg.ServeAddr != "" {
+		scoreCfg, err := score.LoadProfileConfig()
+		if err != nil {
+			return err
+		}
+		best.weights = scoreCfg.Weights
+
+		ln, err := net.Listen("tcp", cfg.ServeAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", cfg.ServeAddr, err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /random", best.serveRandom)
+		mux.Handle("/", best)
+		srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				customlog.Printf(customlog.Failure, "Subscription server stopped: %v\n", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+		customlog.Printf(customlog.Success, "Serving the best configs at http://%s/\n", ln.Addr())
+	}
+
+	w := &watchdog.Watchdog{MaxMemory: cfg.MaxMemory}
+	ctx, stopWatchdog := w.Watch(ctx)
+	defer stopWatchdog()
+
+	customlog.Printf(customlog.Info, "Testing DB configs every %s. Press Ctrl+C to stop.\n", cfg.Interval)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for round := 1; ; round++ {
+		// Test targets are reloaded every round, so 'subs test-target' changes apply without a restart.
+		loadTestTargets(examiner)
+		if err := daemonRound(ctx, examiner, cfg, opts, best, round); err != nil {
+			customlog.Printf(customlog.Failure, "Round %d: %v\n", round, err)
+		}
+		customlog.Printf(customlog.Info, "Round %d: the daemon holds %s.\n", round, watchdog.Sample())
+
+		select {
+		case <-ctx.Done():
+			return watchdog.Restarting(ctx)
+		case <-ticker.C:
+		}
+	}
+}
+
+// daemonRound tests the DB configs once and publishes the best ones.
+func daemonRound(ctx context.Context, examiner *pkghttp.Examiner, cfg *DaemonConfig, opts pkghttp.Options, best *bestList, round int) error {
+	links, err := database.GetConfigsFromDB(cfg.SubscriptionID, cfg.Protocol, cfg.Limit)
+	if err != nil {
+		return err
+	}
+	links, _ = pkghttp.DeduplicateLinks(links)
+	if len(links) == 0 {
+		customlog.Printf(customlog.Warning, "Round %d: no matching configs in the database.\n", round)
+		return nil
+	}
+	customlog.Printf(customlog.Processing, "Round %d: testing %d configs...\n", round, len(links))
+
+	testManager := pkghttp.NewTestManager(examiner, cfg.ThreadCount, false, nil)
+	testManager.SetPoolSize(cfg.PoolSize)
+	resultsChan := make(chan *pkghttp.Result, cfg.ThreadCount)
+	var results pkghttp.ConfigResults
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range resultsChan {
+			results = append(results, res)
+		}
+	}()
+	testManager.RunTests(ctx, links, resultsChan, nil)
+	close(resultsChan)
+	<-done
+
+	if ctx.Err() != nil {
+		customlog.Printf(customlog.Warning, "Round %d interrupted; keeping the previous list.\n", round)
+		return nil
+	}
+
+	if cfg.SaveToDB {
+		optsJSON, err := json.Marshal(opts)
+		if err != nil {
+			return fmt.Errorf("failed to marshal test options to JSON: %w", err)
+		}
+		runID, err := database.CreateHttpTestRun(string(optsJSON), len(links))
+		if err != nil {
+			return fmt.Errorf("failed to create database entry for test run: %w", err)
+		}
+		if err := pkghttp.NewResultProcessor(pkghttp.ResultProcessorOptions{RunID: runID}).SaveResults(results); err != nil {
+			return err
+		}
+	}
+
+	priorities, err := database.GetConfigPriorities()
+	if err != nil {
+		return err
+	}
+	top := topLinks(results, cfg.Top, priorities)
+	if len(top) == 0 {
+		customlog.Printf(customlog.Warning, "Round %d: no working configs; keeping the previous list.\n", round)
+		return nil
+	}
+	data := encodeBestList(top, cfg.Format)
+	if cfg.BestFile != "" {
+		if err := writeFileAtomic(cfg.BestFile, data); err != nil {
+			return err
+		}
+	}
+	best.set(data, top)
+	fastest := top[0].Delay
+	for _, r := range top {
+		fastest = min(fastest, r.Delay)
+	}
+	customlog.Printf(customlog.Success, "Round %d: published the %d best configs (fastest %dms).\n", round, len(top), fastest)
+
+	if cfg.Upload.URL != "" {
+		name := "best.txt"
+		if cfg.BestFile != "" {
+			name = filepath.Base(cfg.BestFile)
+		}
+		f, err := resultsFile(results)
+		if err != nil {
+			return err
+		}
+		pushResults(ctx, cfg.Upload, uploadFile{name: name, data: data, contentType: "text/plain; charset=utf-8"}, f)
+	}
+	return nil
+}
+
+// topLinks returns the n best passed results: those of the highest subscription
+// priority first (see database.GetConfigPriorities), fastest first among equals.
+func topLinks(results pkghttp.ConfigResults, n int, priorities map[string]int) pkghttp.ConfigResults {
+	var passed pkghttp.ConfigResults
+	for _, r := range results {
+		if r.Status == "passed" {
+			passed = append(passed, r)
+		}
+	}
+	sort.Sort(passed)
+	sort.SliceStable(passed, func(i, j int) bool {
+		return priorities[passed[i].ConfigLink] > priorities[passed[j].ConfigLink]
+	})
+	if len(passed) > n {
+		passed = passed[:n]
+	}
+	return passed
+}
+
+// encodeBestList renders the links one per line, base64 encoded for the base64 format.
+func encodeBestList(results pkghttp.ConfigResults, format string) []byte {
+	var b strings.Builder
+	for _, r := range results {
+		b.WriteString(r.ConfigLink)
+		b.WriteByte('\n')
+	}
+	if format == "base64" {
+		return []byte(base64.StdEncoding.EncodeToString([]byte(b.String())))
+	}
+	return []byte(b.String())
+}
+
+// writeFileAtomic replaces path with data by renaming a temporary file over it,
+// so readers see either the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+func init() {
+	HttpCmd.AddCommand(newDaemonCommand())
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+)
+
+func TestTopLinks(t *testing.T) {
+	results := pkghttp.ConfigResults{
+		{ConfigLink: "vless://slow", Status: "passed", Delay: 900},
+		{ConfigLink: "vless://dead", Status: "failed", Delay: -1},
+		{ConfigLink: "vless://fast", Status: "passed", Delay: 100},
+		{ConfigLink: "vless://semi", Status: "semi-passed", Delay: 50},
+		{ConfigLink: "vless://mid", Status: "passed", Delay: 400},
+	}
+	top := topLinks(results, 2, nil)
+	if len(top) != 2 || top[0].ConfigLink != "vless://fast" || top[1].ConfigLink != "vless://mid" {
+		t.Fatalf("unexpected top links: %v", top)
+	}
+	if prio := topLinks(results, 2, map[string]int{"vless://slow": 5}); prio[0].ConfigLink != "vless://slow" || prio[1].ConfigLink != "vless://fast" {
+		t.Errorf("unexpected top links with priorities: %v", prio)
+	}
+
+	plain := encodeBestList(top, "plain")
+	if string(plain) != "vless://fast\nvless://mid\n" {
+		t.Errorf("plain list = %q", plain)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(encodeBestList(top, "base64")))
+	if err != nil || string(decoded) != string(plain) {
+		t.Errorf("base64 list decodes to %q, %v", decoded, err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "best.txt")
+	for _, content := range []string{"first\n", "second\n"} {
+		if err := writeFileAtomic(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != content {
+			t.Fatalf("read %q, %v; want %q", got, err, content)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestBestListServe(t *testing.T) {
+	best := &bestList{}
+	rec := httptest.NewRecorder()
+	best.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("empty list: status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	best.set([]byte("vless://fast\n"), pkghttp.ConfigResults{{ConfigLink: "vless://fast", Status: "passed", Delay: 100}})
+	rec = httptest.NewRecorder()
+	best.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sub", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "vless://fast\n" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBestListRandom(t *testing.T) {
+	best := &bestList{weights: score.DefaultWeights()}
+	rec := httptest.NewRecorder()
+	best.serveRandom(rec, httptest.NewRequest(http.MethodGet, "/random", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("empty list: status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	top := pkghttp.ConfigResults{
+		{ConfigLink: "vless://fast", Status: "passed", Delay: 100},
+		{ConfigLink: "vless://slow", Status: "passed", Delay: 3000},
+	}
+	best.set(encodeBestList(top, "plain"), top)
+	if best.picks[0].score <= best.picks[1].score {
+		t.Fatalf("scores = %+v, want the fast config first", best.picks)
+	}
+	rec = httptest.NewRecorder()
+	best.serveRandom(rec, httptest.NewRequest(http.MethodGet, "/random", nil))
+	if link := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || (link != "vless://fast" && link != "vless://slow") {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Config-Score") == "" {
+		t.Error("no X-Config-Score header")
+	}
+}
+
+func TestWeightedPick(t *testing.T) {
+	picks := []scoredLink{{"a", 30}, {"b", 0}, {"c", 10}}
+	for _, tt := range []struct {
+		u    float64
+		want string
+	}{{0, "a"}, {0.74, "a"}, {0.75, "c"}, {0.999, "c"}} {
+		if got := weightedPick(picks, tt.u).link; got != tt.want {
+			t.Errorf("weightedPick(%v) = %s, want %s", tt.u, got, tt.want)
+		}
+	}
+	unscored := []scoredLink{{"a", 0}, {"b", 0}}
+	if got := weightedPick(unscored, 0.6).link; got != "b" {
+		t.Errorf("weightedPick of unscored configs = %s, want b", got)
+	}
+}
@@ -52,7 +52,12 @@ var listResultsCmd = &cobra.Command{
 				location = res.IPLocation.String
 			}
 
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", res.Status, delay, download, upload, location, res.ConfigLink)
+			status := res.Status
+			if res.Failure != "" {
+				status += " (" + res.Failure + ")"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", status, delay, download, upload, location, res.ConfigLink)
 		}
 
 		return w.Flush()
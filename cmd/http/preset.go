@@ -0,0 +1,160 @@
+package http
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// presetFlags are the flags of 'test' a preset stores: what is tested and how,
+// not which configs.
+var presetFlags = []string{
+	"stages", "url", "method", "expect-status", "expect-body", "insecure",
+	"accept-status", "accept-body", "accept-delay",
+	"mdelay", "timeout", "connect-timeout", "tls-timeout", "first-byte-timeout", "retries",
+	"thread", "core", "pool", "ip-version", "amount", "warm", "ip-providers",
+	"dns-cache", "dns-resolver", "timings", "geo-url", "mutate",
+}
+
+// applyPreset gives the flags of cmd not set on the command line the values of
+// the preset called name, over those of the config file.
+func applyPreset(cmd *cobra.Command, name string) (*database.TestPreset, error) {
+	preset, err := database.GetTestPreset(name)
+	if err != nil {
+		return nil, err
+	}
+	for flag, value := range preset.FlagValues() {
+		f := cmd.Flags().Lookup(flag)
+		if f == nil || f.Changed {
+			continue
+		}
+		if err := setFlagValue(f, value); err != nil {
+			return nil, fmt.Errorf("preset %s: --%s: %w", name, flag, err)
+		}
+	}
+	return preset, nil
+}
+
+// savePreset stores the preset flags given on the command line as the preset
+// called name, on top of those of base (the --preset the command started from,
+// or nil). weights replaces the scoring weights of base when not empty.
+func savePreset(cmd *cobra.Command, name string, base *database.TestPreset, weights string) error {
+	preset := database.TestPreset{Name: name}
+	values := make(map[string]string)
+	if base != nil {
+		values = base.FlagValues()
+		preset.Weights = base.Weights
+	}
+	for _, flag := range presetFlags {
+		if f := cmd.Flags().Lookup(flag); f != nil && f.Changed {
+			values[flag] = flagValue(f)
+		}
+	}
+	if weights != "" {
+		w := score.DefaultWeights()
+		if err := w.Parse(weights); err != nil {
+			return err
+		}
+		if err := w.Validate(); err != nil {
+			return err
+		}
+		preset.Weights = weights
+	}
+	if len(values) == 0 && preset.Weights == "" {
+		return fmt.Errorf("nothing to save: give the flags the preset should set, e.g. --stages or --thread")
+	}
+	preset.SetFlagValues(values)
+	if err := database.SaveTestPreset(preset); err != nil {
+		return err
+	}
+	customlog.Printf(customlog.Success, "Saved preset %s: %s\n", name, describePreset(preset))
+	return nil
+}
+
+// setFlagValue sets f to a value stored by flagValue. Lists are replaced, not
+// appended to.
+func setFlagValue(f *pflag.Flag, value string) error {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		var items []string
+		if value != "" {
+			items = strings.Split(value, ",")
+		}
+		return sv.Replace(items)
+	}
+	return f.Value.Set(value)
+}
+
+// flagValue returns the value of f as setFlagValue takes it.
+func flagValue(f *pflag.Flag) string {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return strings.Join(sv.GetSlice(), ",")
+	}
+	return f.Value.String()
+}
+
+// describePreset shows the flags of a preset as they would be typed.
+func describePreset(p database.TestPreset) string {
+	values := p.FlagValues()
+	var parts []string
+	for _, flag := range presetFlags {
+		if value, ok := values[flag]; ok {
+			parts = append(parts, "--"+flag+"="+value)
+		}
+	}
+	if p.Weights != "" {
+		parts = append(parts, "weights "+p.Weights)
+	}
+	return strings.Join(parts, " ")
+}
+
+func newPresetsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "presets",
+		Short: "Lists the saved test presets",
+		Long: `Lists the presets saved with 'test --save-preset', with the flags each one sets
+and the scoring weights 'subs best --preset' ranks with.
+
+Examples:
+  xray-knife test presets
+  xray-knife test presets rm mobile-sim`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			presets, err := database.ListTestPresets()
+			if err != nil {
+				return err
+			}
+			if len(presets) == 0 {
+				fmt.Println("No presets saved. Save one with 'xray-knife test --save-preset NAME' and the flags it should set.")
+				return nil
+			}
+			w := utils.NewTableWriter(os.Stdout, 3, 0)
+			fmt.Fprintln(w, "NAME\tUPDATED\tFLAGS")
+			fmt.Fprintln(w, "----\t-------\t-----")
+			for _, p := range presets {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, p.UpdatedAt.Local().Format("2006-01-02 15:04"), describePreset(p))
+			}
+			return w.Flush()
+		},
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm NAME",
+		Short: "Removes a saved test preset",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := database.DeleteTestPreset(args[0]); err != nil {
+				return err
+			}
+			customlog.Printf(customlog.Success, "Removed preset %s\n", args[0])
+			return nil
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+)
+
+// TestCmd is the test command.
+var TestCmd = newTestCommand()
+
+// defaultWarmProbes is how many requests the warm stage repeats unless --warm says.
+const defaultWarmProbes = 3
+
+// checkFlags are the flags of 'http' each turning on a check, which --stages
+// replaces in 'test'.
+var checkFlags = map[string]string{
+	"speedtest":  pkghttp.CheckSpeed,
+	"rip":        pkghttp.CheckIP,
+	"udp":        pkghttp.CheckUDP,
+	"policy":     pkghttp.CheckPolicy,
+	"leak-check": pkghttp.CheckLeak,
+	"cert":       pkghttp.CheckCert,
+}
+
+func newTestCommand() *cobra.Command {
+	config := &Config{}
+	var (
+		stages        []string
+		presetName    string
+		saveAs        string
+		presetWeights string
+		appliedPreset *database.TestPreset
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Runs latency, speed, IP and capability checks on configs in one pass.",
+		Long: `Tests configs like 'http', with every check picked by one flag: --stages
+lists the checks to run on each config, and they all run in one pool of
+--thread workers over a single core instance per config. A bulk test ends with
+one report of every stage, followed by the usual summary.
+
+Stages:
+  latency  the test request through the config (always runs; the others build on it)
+  speed    download and upload speed with speed.cloudflare.com (--amount KB)
+  ip       the exit IP and its country (--ip-providers)
+  warm     the delay over a reused connection (--warm requests, default ` + fmt.Sprint(defaultWarmProbes) + `)
+  udp      whether UDP is relayed and the NAT type behind it
+  policy   whether the exit lets SMTP (port 25) and BitTorrent through
+  leak     IP, WebRTC and DNS leaks
+  cert     the certificate of the config's server
+
+Checks after latency only run on configs that passed it. Speed tests are limited
+by bandwidth; give them a much lower --thread ('xray-knife bench' recommends
+one). Every other flag works as in 'http'.
+
+A test scenario can be saved as a named preset, so it is repeated the same way
+later: --save-preset NAME stores the stages, URL, timeouts, thread count and
+other test flags given with it, and --weights the scoring weights 'subs best
+--preset NAME' ranks the results with, without testing anything. --preset NAME
+then tests with those flags; flags given on the command line still win, and
+the preset wins over the config file. Saving over a preset given with --preset
+keeps the flags not given again. 'test presets' lists the saved presets.
+
+Examples:
+  xray-knife test -f configs.txt
+  xray-knife test -f configs.txt --stages latency,speed,ip -t 8 -x csv -o results.csv
+  xray-knife test --from-db --stages latency,ip,udp,policy,leak,cert --save-db
+  xray-knife test -c "vless://..." --stages speed,warm
+  xray-knife test --save-preset mobile-sim --stages latency,speed -t 4 --mdelay 8000 --amount 2000 --weights latency=0.2,speed=0.6
+  xray-knife test --preset mobile-sim -f configs.txt --save-db`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			for name, check := range checkFlags {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--%s is not a flag of 'test', add %s to --stages instead", name, check)
+				}
+			}
+			if presetWeights != "" && saveAs == "" {
+				return fmt.Errorf("--weights is saved with a preset, give --save-preset too")
+			}
+			if saveAs != "" {
+				if err := database.ValidatePresetName(saveAs); err != nil {
+					return err
+				}
+			}
+			if presetName != "" {
+				preset, err := applyPreset(cmd, presetName)
+				if err != nil {
+					return err
+				}
+				appliedPreset = preset
+			}
+			checks, err := pkghttp.ParseChecks(stages)
+			if err != nil {
+				return err
+			}
+			applyChecks(config, checks)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if saveAs != "" {
+				return savePreset(cmd, saveAs, appliedPreset, presetWeights)
+			}
+			return runTests(cmd.Context(), config)
+		},
+	}
+
+	addFlags(cmd, config)
+	cmd.Flags().StringSliceVar(&stages, "stages", []string{pkghttp.CheckLatency, pkghttp.CheckIP}, "Checks to run on each config: "+strings.Join(pkghttp.Checks, ", "))
+	for name := range checkFlags {
+		cmd.Flags().MarkHidden(name)
+	}
+	cmd.Flags().StringVar(&presetName, "preset", "", "Test with the flags saved in this preset (see 'test presets')")
+	cmd.Flags().StringVar(&saveAs, "save-preset", "", "Save the test flags given with it as this preset instead of testing")
+	cmd.Flags().StringVar(&presetWeights, "weights", "", "Scoring weights saved with --save-preset, e.g. latency=1,speed=0")
+	cmd.AddCommand(newPresetsCommand())
+	cmd.Flags().Lookup("warm").Usage = fmt.Sprintf("Requests over a reused connection in the warm stage (0 = %d)", defaultWarmProbes)
+	return cmd
+}
+
+// applyChecks turns the checks of --stages into the options of an http test.
+func applyChecks(config *Config, checks []string) {
+	has := func(check string) bool { return slices.Contains(checks, check) }
+	config.Checks = checks
+	config.Speedtest = has(pkghttp.CheckSpeed)
+	config.GetIPInfo = has(pkghttp.CheckIP)
+	config.UDPTest = has(pkghttp.CheckUDP)
+	config.PolicyProbes = has(pkghttp.CheckPolicy)
+	config.LeakCheck = has(pkghttp.CheckLeak)
+	config.CertCheck = has(pkghttp.CheckCert)
+	switch {
+	case !has(pkghttp.CheckWarm):
+		config.WarmProbes = 0
+	case config.WarmProbes == 0:
+		config.WarmProbes = defaultWarmProbes
+	}
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+)
+
+func TestApplyChecks(t *testing.T) {
+	config := &Config{GetIPInfo: true, WarmProbes: 5}
+	applyChecks(config, []string{pkghttp.CheckLatency, pkghttp.CheckSpeed, pkghttp.CheckUDP})
+	if !config.Speedtest || !config.UDPTest || config.GetIPInfo || config.WarmProbes != 0 || config.CertCheck {
+		t.Errorf("applyChecks(latency,speed,udp) = %+v", config)
+	}
+
+	config = &Config{}
+	applyChecks(config, []string{pkghttp.CheckLatency, pkghttp.CheckWarm, pkghttp.CheckLeak})
+	if config.WarmProbes != defaultWarmProbes || !config.LeakCheck || config.Speedtest {
+		t.Errorf("applyChecks(latency,warm,leak) = %+v", config)
+	}
+	if len(config.Checks) != 3 {
+		t.Errorf("Checks = %v, want the 3 stages kept for the report", config.Checks)
+	}
+}
+
+func TestTestRejectsCheckFlags(t *testing.T) {
+	cmd := newTestCommand()
+	cmd.SetArgs([]string{"--speedtest", "-f", "configs.txt"})
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	if err := cmd.Execute(); err == nil {
+		t.Error("test accepted --speedtest")
+	}
+}
+
+func TestTestPresets(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.DB.Close()
+
+	cmd := newTestCommand()
+	cmd.SetArgs([]string{"--save-preset", "mobile-sim", "--stages", "latency,speed", "-t", "4", "--mdelay", "8000", "--weights", "speed=0.6"})
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags on the command line win over the preset.
+	cmd = newTestCommand()
+	if err := cmd.ParseFlags([]string{"--thread", "8"}); err != nil {
+		t.Fatal(err)
+	}
+	preset, err := applyPreset(cmd, "mobile-sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, _ := cmd.Flags().GetStringSlice("stages")
+	threads, _ := cmd.Flags().GetUint16("thread")
+	mdelay, _ := cmd.Flags().GetUint16("mdelay")
+	if strings.Join(stages, ",") != "latency,speed" || threads != 8 || mdelay != 8000 {
+		t.Errorf("after the preset: stages %v, thread %d, mdelay %d", stages, threads, mdelay)
+	}
+	if preset.Weights != "speed=0.6" {
+		t.Errorf("weights = %q", preset.Weights)
+	}
+
+	// Saving over the preset keeps the flags not given again.
+	cmd = newTestCommand()
+	cmd.SetArgs([]string{"--preset", "mobile-sim", "--save-preset", "mobile-sim", "-t", "2"})
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	preset, err = database.GetTestPreset("mobile-sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "mdelay=8000\nstages=latency,speed\nthread=2"; preset.Flags != want || preset.Weights != "speed=0.6" {
+		t.Errorf("updated preset = %q, weights %q; want %q", preset.Flags, preset.Weights, want)
+	}
+
+	if _, err := applyPreset(newTestCommand(), "desktop"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("unknown preset: err = %v", err)
+	}
+}
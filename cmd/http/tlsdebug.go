@@ -0,0 +1,58 @@
+package http
+
+import (
+	"context"
+	"strings"
+
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// handleTLSDebug prints the TLS handshake of the config of --tls-debug.
+func handleTLSDebug(ctx context.Context, examiner *pkghttp.Examiner, config *Config) error {
+	d, err := examiner.DebugTLS(ctx, config.ConfigLink)
+	if err != nil {
+		return err
+	}
+	fingerprint := d.Fingerprint
+	if fingerprint == "" {
+		fingerprint = "default (chrome)"
+	}
+	customlog.Printf(customlog.Info, "Server: %s (%s)\n", d.Server, d.Security)
+	customlog.Printf(customlog.Info, "ClientHello, fingerprint %s, %d bytes:\n", fingerprint, d.Hello.Size)
+	printHelloField("SNI", []string{d.Hello.SNI})
+	printHelloField("ALPN", d.Hello.ALPN)
+	printHelloField("Versions", d.Hello.Versions)
+	printHelloField("Cipher suites", d.Hello.CipherSuites)
+	printHelloField("Extensions", d.Hello.Extensions)
+	printHelloField("Groups", d.Hello.Groups)
+	printHelloField("Key shares", d.Hello.KeyShares)
+	printHelloField("Signatures", d.Hello.SignatureAlgorithms)
+	printHelloField("JA3", []string{d.Hello.JA3})
+
+	if d.Err != nil {
+		customlog.Printf(customlog.Failure, "Handshake failed: %v\n", d.Err)
+		return nil
+	}
+	customlog.Printf(customlog.Success, "ServerHello: %s, %s, ALPN %s (connect %dms, handshake %dms)\n",
+		d.Version, d.CipherSuite, orNone(d.ALPN), d.ConnectTime.Milliseconds(), d.HandshakeTime.Milliseconds())
+	if c := d.Certificate; c != nil {
+		customlog.Printf(customlog.Info, "Certificate: %s, issued by %s for %s, expires %s\n",
+			c.Subject, c.Issuer, strings.Join(c.SANs, ","), c.NotAfter.Format("2006-01-02"))
+		if len(c.Warnings) > 0 {
+			customlog.Printf(customlog.Warning, "Certificate warnings: %s\n", strings.Join(c.Warnings, ","))
+		}
+	}
+	return nil
+}
+
+func printHelloField(name string, values []string) {
+	customlog.Printf(customlog.Info, "  %-14s %s\n", name+":", orNone(strings.Join(values, ", ")))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
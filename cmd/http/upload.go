@@ -0,0 +1,85 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/upload"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// UploadOptions set where the results of a run are pushed for a team to share.
+type UploadOptions struct {
+	URL     string
+	Headers []string
+}
+
+type uploadFile struct {
+	name        string
+	data        []byte
+	contentType string
+}
+
+func addUploadFlags(cmd *cobra.Command, o *UploadOptions) {
+	flags := cmd.Flags()
+	flags.StringVar(&o.URL, "upload", "", "Push the results after each run to an https://, webdavs:// or s3://bucket/prefix destination")
+	flags.StringArrayVar(&o.Headers, "upload-header", nil, "Extra \"Name: value\" header for --upload requests, e.g. an Authorization token (repeatable)")
+}
+
+func validateUploadOptions(o UploadOptions) error {
+	if o.URL == "" {
+		if len(o.Headers) > 0 {
+			return fmt.Errorf("--upload-header requires --upload")
+		}
+		return nil
+	}
+	_, err := upload.New(o.URL, o.Headers)
+	return err
+}
+
+// resultsFile renders every result of a run as results.json.
+func resultsFile(results pkghttp.ConfigResults) (uploadFile, error) {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return uploadFile{}, fmt.Errorf("failed to encode results: %w", err)
+	}
+	return uploadFile{name: "results.json", data: data, contentType: "application/json"}, nil
+}
+
+// outputFile reads a written output file for upload.
+func outputFile(path, outputType string) (uploadFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return uploadFile{}, err
+	}
+	contentType := "text/plain; charset=utf-8"
+	if outputType == "csv" {
+		contentType = "text/csv; charset=utf-8"
+	}
+	return uploadFile{name: filepath.Base(path), data: data, contentType: contentType}, nil
+}
+
+// pushResults uploads files to the --upload destination. Failures are only
+// reported: the results are already saved locally.
+func pushResults(ctx context.Context, o UploadOptions, files ...uploadFile) {
+	u, err := upload.New(o.URL, o.Headers)
+	if err != nil {
+		customlog.Printf(customlog.Failure, "Upload skipped: %v\n", err)
+		return
+	}
+	// An interrupted run still shares what it collected.
+	ctx = context.WithoutCancel(ctx)
+	for _, f := range files {
+		if err := u.Upload(ctx, f.name, f.data, f.contentType); err != nil {
+			customlog.Printf(customlog.Failure, "Upload of %s failed: %v\n", f.name, err)
+			continue
+		}
+		customlog.Printf(customlog.Success, "Uploaded %s to %s\n", f.name, upload.Redacted(o.URL))
+	}
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/proxy/svcinstall"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/settings"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+// Defaults offered by the setup wizard, matching the flag defaults.
+const (
+	initTestURL      = "https://cloudflare.com/cdn-cgi/trace"
+	initMaxDelay     = 5000
+	initDaemonName   = "xray-knife-daemon"
+	initDaemonPeriod = "30m"
+)
+
+func newInitCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Walks through the first-time setup and writes the config file",
+		Long: `Asks a few questions to set xray-knife up: where the database lives, a first
+subscription to add, the default core, the test URL and time limits, and whether
+to install a background service running 'http daemon'. Press Enter to keep the
+value shown in brackets, so running init again is a quick way to review them.
+
+The answers are saved to xray-knife.conf in the data directory (see --profile)
+and become the defaults of the matching flags: --core for every command, and
+--url, --mdelay and --timeout for 'http', 'http daemon', 'http compare', 'bot'
+and 'proxy monitor'. Flags given on the command line still win. Other sections
+of the file, such as the score weights, are kept.
+
+Examples:
+  xray-knife init
+  xray-knife init --profile work`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if readOnly {
+				return fmt.Errorf("init writes to the database and can't run with --readonly")
+			}
+			return runInit(newWizard(cmd.InOrStdin(), cmd.OutOrStdout()))
+		},
+	}
+}
+
+func runInit(w *wizard) error {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return err
+	}
+	confPath := filepath.Join(dataDir, score.ConfigFileName)
+	s := userSettings
+
+	fmt.Fprintf(w.out, "Setting up xray-knife in %s. Press Enter to keep the value in brackets.\n", dataDir)
+
+	// Database location
+	w.section("Database")
+	defaultDB := filepath.Join(dataDir, "xray-knife.db")
+	path := w.ask("Database file", dbPath, func(v string) error {
+		_, err := resolvePath(v)
+		return err
+	})
+	path, _ = resolvePath(path)
+	if path != dbPath {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("could not create database directory: %w", err)
+		}
+		database.DB.Close()
+		if err := database.InitDB(path); err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		fmt.Fprintf(w.out, "Using %s from now on; %s is left as it is.\n", path, dbPath)
+		dbPath = path
+	}
+	s.DBPath = ""
+	if path != defaultDB {
+		s.DBPath = path
+	}
+
+	// First subscription
+	w.section("Subscription")
+	existing, err := database.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		fmt.Fprintf(w.out, "The database has %d subscription(s); add another one or leave it empty.\n", len(existing))
+	}
+	subURL := w.ask("Subscription URL or file to add (empty to skip)", "", func(v string) error {
+		if v == "" {
+			return nil
+		}
+		_, err := subs.ResolveSubscriptionURL(v)
+		return err
+	})
+	if subURL != "" {
+		subURL, _ = subs.ResolveSubscriptionURL(subURL)
+		remark := w.ask("Remark (optional)", "", nil)
+		if err := database.AddSubscription(subURL, remark, ""); err != nil {
+			customlog.Printf(customlog.Warning, "Could not add the subscription: %v\n", err)
+		} else {
+			customlog.Printf(customlog.Success, "Added subscription: %s\n", subURL)
+		}
+	}
+
+	// Core and test settings
+	w.section("Testing")
+	s.Core = w.ask("Default core ("+strings.Join(settings.Cores, ", ")+")", orDefault(s.Core, "auto"), settings.ValidateCore)
+	s.TestURL = w.ask("Test URL", orDefault(s.TestURL, initTestURL), settings.ValidateTestURL)
+	s.MaxDelay = w.askMillis("Maximum allowed delay in ms", orDefaultMillis(s.MaxDelay, initMaxDelay), 1)
+	s.Timeout = w.askMillis("HTTP client timeout in ms (0 = same as the maximum delay)", s.Timeout, 0)
+
+	if err := settings.Save(confPath, s); err != nil {
+		return fmt.Errorf("could not write %s: %w", confPath, err)
+	}
+	customlog.Printf(customlog.Success, "Saved settings to %s\n", confPath)
+
+	// Background daemon
+	w.section("Daemon")
+	if err := setupDaemon(w, dataDir); err != nil {
+		return err
+	}
+
+	w.section("Next steps")
+	fmt.Fprintln(w.out, "  xray-knife subs fetch --all     fetch the configs of your subscriptions")
+	fmt.Fprintln(w.out, "  xray-knife http --from-db       test them")
+	fmt.Fprintln(w.out, "  xray-knife subs best            list the most reliable ones")
+	return nil
+}
+
+// setupDaemon offers to install a service running 'http daemon'.
+func setupDaemon(w *wizard, dataDir string) error {
+	args := []string{"http", "daemon"}
+	if p := utils.Profile(); p != "" {
+		args = append([]string{"--profile", p}, args...)
+	}
+	if runtime.GOOS != "linux" {
+		fmt.Fprintf(w.out, "Services can only be set up on Linux. To keep a list of the best configs up to date,\nkeep 'xray-knife %s' running, e.g. from the task scheduler.\n", strings.Join(args, " "))
+		return nil
+	}
+	if !w.confirm("Install a service re-testing your configs in the background?", false) {
+		return nil
+	}
+
+	interval := w.ask("Time between test rounds", initDaemonPeriod, func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("enter a duration of at least 1m, like 30m or 2h")
+		}
+		return nil
+	})
+	best := filepath.Join(dataDir, "best.txt")
+	opts := svcinstall.Options{
+		Name:        initDaemonName,
+		Description: "xray-knife config test daemon",
+		Args:        append(args, "--interval", interval, "--best", best),
+		User:        os.Geteuid() != 0,
+	}
+	if err := svcinstall.Install(opts); err != nil {
+		return fmt.Errorf("could not install the daemon service: %w", err)
+	}
+	customlog.Printf(customlog.Success, "Service '%s' installed and started; the best configs are kept in %s\n", initDaemonName, best)
+	return nil
+}
+
+// resolvePath makes a path typed by the user absolute, expanding a leading ~.
+func resolvePath(p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("enter a path")
+	}
+	if rest, ok := strings.CutPrefix(p, "~"); ok && (rest == "" || rest[0] == '/' || rest[0] == filepath.Separator) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		p = filepath.Join(home, rest)
+	}
+	return filepath.Abs(p)
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func orDefaultMillis(v, def uint16) uint16 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// wizard asks questions on a terminal. When the input ends, every remaining
+// question takes its default answer.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newWizard(in io.Reader, out io.Writer) *wizard {
+	return &wizard{in: bufio.NewReader(in), out: out}
+}
+
+func (w *wizard) section(title string) {
+	fmt.Fprintf(w.out, "\n== %s ==\n", title)
+}
+
+// ask prompts until the answer, or def for an empty one, passes validate.
+func (w *wizard) ask(question, def string, validate func(string) error) string {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", question)
+		}
+		line, err := w.in.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		if err != nil {
+			fmt.Fprintln(w.out)
+		}
+		if answer == "" {
+			answer = def
+		}
+		if validate == nil {
+			return answer
+		}
+		verr := validate(answer)
+		if verr == nil {
+			return answer
+		}
+		if err != nil {
+			// No more input: fall back to the default.
+			return def
+		}
+		fmt.Fprintf(w.out, "  %v\n", verr)
+	}
+}
+
+func (w *wizard) askMillis(question string, def uint16, minimum uint64) uint16 {
+	answer := w.ask(question, strconv.Itoa(int(def)), func(v string) error {
+		ms, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || ms < minimum {
+			return fmt.Errorf("enter a number of milliseconds from %d to 65535", minimum)
+		}
+		return nil
+	})
+	ms, _ := strconv.ParseUint(answer, 10, 16)
+	return uint16(ms)
+}
+
+func (w *wizard) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := w.ask(question+" ["+hint+"]", "", nil)
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
@@ -2,6 +2,7 @@ package net
 
 import (
 	"fmt"
+	"github.com/lilendian0x00/xray-knife/v9/database"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
 	"net"
 	"time"
@@ -32,8 +33,12 @@ func newTcpCommand() *cobra.Command {
 			if cfg.configLink == "" {
 				return fmt.Errorf("config link is required for the tcp command. Use -c or --config")
 			}
+			link, err := database.ResolveConfigLink(cfg.configLink)
+			if err != nil {
+				return err
+			}
 
-			parsed, err := x.CreateProtocol(cfg.configLink)
+			parsed, err := x.CreateProtocol(link)
 			if err != nil {
 				return fmt.Errorf("couldn't parse the config: %w", err)
 			}
@@ -59,7 +64,7 @@ func newTcpCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&cfg.configLink, "config", "c", "", "The xray config link")
+	cmd.Flags().StringVarP(&cfg.configLink, "config", "c", "", "The xray config link, or the ID or alias of a stored config")
 	// cmd.MarkFlagRequired("config")
 	return cmd
 }
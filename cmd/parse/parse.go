@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"github.com/lilendian0x00/xray-knife/v9/database"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
@@ -15,7 +16,6 @@ import (
 
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -25,6 +25,8 @@ type parseCmdConfig struct {
 	configLink      string
 	configLinksFile string
 	outputJSON      bool
+	redact          bool
+	fix             bool
 }
 
 // ParseCmd is the parse subcommand.
@@ -182,6 +184,31 @@ func newParseCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "parse",
 		Short: "Decode and display a detailed, human-readable breakdown of a proxy configuration link.",
+		Long: `Decodes config links and prints their settings as an aligned list, including
+derived details such as "TLS: REALITY (fp=chrome)" and warnings for risky settings
+(allowInsecure, missing TLS, legacy ciphers).
+
+Use --no-color for plain output that is safe to paste or pipe.
+
+--redact prints the links with their credentials masked instead: UUIDs become
+xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx and passwords, keys and REALITY ids ***,
+while the server, transport settings and remark stay, so a config can be shared
+in an issue or forum for debugging. The redacted links still parse; combined
+with --json the generated config is masked too.
+
+Links damaged in a known way are repaired before they are parsed: spaces in
+a path or remark, '#', '?', '/' or '@' left unescaped in a password, stray '%'
+signs, &amp; in the query, an IPv6 server without brackets, a wrapped base64
+payload, an upper-case scheme, or quotes and brackets around the link. The
+details of a repaired link list what was fixed. --fix prints the links instead,
+repaired where needed, and leaves out those beyond repair, so a whole
+subscription can be cleaned up in one go.
+
+Examples:
+  xray-knife parse -c "vless://..."
+  xray-knife parse -f configs.txt --redact
+  xray-knife parse -c "vless://..." --redact --json
+  xray-knife parse -f configs.txt --fix > fixed.txt`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 && !cfg.readFromSTDIN && cfg.configLink == "" && cfg.configLinksFile == "" {
 				cmd.Help()
@@ -199,7 +226,11 @@ func newParseCommand() *cobra.Command {
 				}
 				links = append(links, text)
 			} else if cfg.configLink != "" {
-				links = append(links, cfg.configLink)
+				link, err := database.ResolveConfigLink(cfg.configLink)
+				if err != nil {
+					return err
+				}
+				links = append(links, link)
 			} else if cfg.configLinksFile != "" {
 				// Assuming utils.ParseFileByNewline internally handles and logs errors
 				// or consider changing it to return an error.
@@ -216,6 +247,27 @@ func newParseCommand() *cobra.Command {
 				return fmt.Errorf("no config links provided or found")
 			}
 
+			if cfg.redact {
+				redacted := links[:0]
+				for _, link := range links {
+					if strings.TrimSpace(link) == "" {
+						continue
+					}
+					r, err := utils.RedactLink(link)
+					if err != nil {
+						return fmt.Errorf("failed to redact %q: %w", strings.TrimSpace(link), err)
+					}
+					redacted = append(redacted, r)
+				}
+				links = redacted
+				if !cfg.outputJSON {
+					for _, link := range links {
+						fmt.Println(link)
+					}
+					return nil
+				}
+			}
+
 			// New logic branch for JSON output
 			if cfg.outputJSON {
 				if len(links) > 1 {
@@ -229,26 +281,27 @@ func newParseCommand() *cobra.Command {
 			}
 
 			c := core.NewAutomaticCore(true, true)
+			if cfg.fix {
+				return fixLinks(os.Stdout, c, links)
+			}
 
-			d := color.New(color.FgCyan, color.Bold)
 			for i, link := range links {
 				trimmedLink := strings.TrimSpace(link)
 				if trimmedLink == "" {
 					continue
 				}
 				if len(links) > 1 {
-					d.Printf("Config Number: %d\n", i+1)
+					fmt.Println(customlog.GetColor(customlog.Info, fmt.Sprintf("Config Number: %d", i+1)))
 				}
 
 				fmt.Printf("\n")
-				p, err := c.CreateProtocol(trimmedLink)
+				p, repaired, fixes, err := parseLink(c, trimmedLink)
 				if err != nil {
-					return fmt.Errorf("failed to create protocol for link %d ('%s'): %w", i+1, trimmedLink, err)
+					return fmt.Errorf("link %d ('%s'): %w", i+1, trimmedLink, err)
 				}
-
-				err = p.Parse()
-				if err != nil {
-					return fmt.Errorf("failed to parse for link %d ('%s'): %w", i+1, trimmedLink, err)
+				if len(fixes) > 0 {
+					customlog.Printf(customlog.Warning, "Link %d is malformed; repaired: %s\n", i+1, strings.Join(fixes, "; "))
+					fmt.Printf("%s: %s\n", customlog.GetColor(customlog.Label, "Repaired link"), repaired)
 				}
 
 				fmt.Println(p.DetailsStr())
@@ -260,8 +313,12 @@ func newParseCommand() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&cfg.readFromSTDIN, "stdin", "i", false, "Read config link from the console")
-	cmd.Flags().StringVarP(&cfg.configLink, "config", "c", "", "The config link")
+	cmd.Flags().StringVarP(&cfg.configLink, "config", "c", "", "The config link, or the ID or alias of a stored config")
 	cmd.Flags().StringVarP(&cfg.configLinksFile, "file", "f", "", "Read config links from a file")
 	cmd.Flags().BoolVarP(&cfg.outputJSON, "json", "j", false, "Output full xray-core JSON configuration with a default inbound")
+	cmd.Flags().BoolVar(&cfg.redact, "redact", false, "Print the links with UUIDs, passwords and keys masked, for sharing")
+	cmd.Flags().BoolVar(&cfg.fix, "fix", false, "Print the links repaired where they are malformed, leaving out those that can't be")
+	cmd.MarkFlagsMutuallyExclusive("fix", "redact")
+	cmd.MarkFlagsMutuallyExclusive("fix", "json")
 	return cmd
 }
@@ -0,0 +1,73 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// parseLink creates and parses the protocol of link. A link with damage
+// protocol.RepairLink knows of is repaired first, and the repaired link is used
+// if it parses, with the repairs made: some damage, like &amp; in the query,
+// still parses but loses settings. err is the error of the link as given.
+func parseLink(c core.Core, link string) (p protocol.Protocol, repaired string, fixes []string, err error) {
+	if repaired, fixes = protocol.RepairLink(link); len(fixes) > 0 {
+		if p, err := createAndParse(c, repaired); err == nil {
+			return p, repaired, fixes, nil
+		}
+	}
+	p, err = createAndParse(c, link)
+	return p, link, nil, err
+}
+
+// createAndParse creates and parses the protocol of link. Malformed links must
+// not crash the program, so a panicking parser is reported as an error.
+func createAndParse(c core.Core, link string) (p protocol.Protocol, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p, err = nil, fmt.Errorf("parser crashed: %v", r)
+		}
+	}()
+	p, err = c.CreateProtocol(link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create protocol: %w", err)
+	}
+	if err := p.Parse(); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	return p, nil
+}
+
+// fixLinks writes links to w as they parse, repaired where needed, for --fix.
+// Links that can't be repaired are left out and reported.
+func fixLinks(w io.Writer, c core.Core, links []string) error {
+	var valid, repaired, broken int
+	for i, link := range links {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+		_, fixed, fixes, err := parseLink(c, link)
+		switch {
+		case err != nil:
+			broken++
+			customlog.Printf(customlog.Failure, "Link %d can't be repaired: %v\n", i+1, err)
+			continue
+		case len(fixes) > 0:
+			repaired++
+			customlog.Printf(customlog.Info, "Link %d: %s\n", i+1, strings.Join(fixes, "; "))
+		default:
+			valid++
+		}
+		fmt.Fprintln(w, fixed)
+	}
+	customlog.Printf(customlog.Finished, "%d links repaired, %d already valid, %d left out as broken.\n", repaired, valid, broken)
+	if valid+repaired == 0 {
+		return fmt.Errorf("no link could be parsed")
+	}
+	return nil
+}
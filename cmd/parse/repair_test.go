@@ -0,0 +1,48 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+)
+
+func TestFixLinks(t *testing.T) {
+	const id = "b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5"
+	links := []string{
+		"trojan://pa#ss@example.com:443?security=tls&sni=example.com#remark",
+		"vless://" + id + "@example.com:443?type=tcp#fine",
+		"",
+		"not a link",
+	}
+	var out bytes.Buffer
+	if err := fixLinks(&out, core.NewAutomaticCore(false, false), links); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"trojan://pa%23ss@example.com:443?security=tls&sni=example.com#remark",
+		"vless://" + id + "@example.com:443?type=tcp#fine",
+	}
+	if got := strings.Fields(out.String()); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("fixed links:\n%s\nwant:\n%s", out.String(), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseLinkKeepsPassword(t *testing.T) {
+	c := core.NewAutomaticCore(false, false)
+	p, repaired, fixes, err := parseLink(c, "trojan://pa#ss@example.com:443?security=tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixes) == 0 || repaired == "trojan://pa#ss@example.com:443?security=tls" {
+		t.Fatalf("link wasn't repaired: %q", repaired)
+	}
+	if id := p.ConvertToGeneralConfig().ID; id != "pa#ss" {
+		t.Errorf("password = %q, want pa#ss", id)
+	}
+
+	if _, _, _, err := parseLink(c, "vless://@"); err == nil {
+		t.Error("a link beyond repair parsed")
+	}
+}
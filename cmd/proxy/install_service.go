@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/proxy/svcinstall"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+
+	"github.com/spf13/cobra"
+)
+
+// installServiceCmdConfig holds the flags for the install-service command
+type installServiceCmdConfig struct {
+	name        string
+	description string
+	user        bool
+	noStart     bool
+	dryRun      bool
+}
+
+// rejectedServiceFlags are proxy flags that need an interactive terminal.
+var rejectedServiceFlags = map[string]bool{
+	"--stdin": true, "-i": true, "--shell": true,
+}
+
+func newInstallServiceCommand() *cobra.Command {
+	cfg := &installServiceCmdConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "install-service [flags] -- [proxy flags]",
+		Short: "Install the proxy as a systemd unit (Linux) or Windows service so it survives reboots.",
+		Long: `Generates and installs an OS service that runs 'xray-knife proxy' with the given flags.
+Everything after '--' is passed to the proxy command unchanged.
+
+On Linux a systemd unit is written to /etc/systemd/system (or ~/.config/systemd/user
+with --user), enabled, and started. On Windows the service is registered with the
+service control manager with automatic start and restart-on-failure.
+
+Examples:
+  sudo xray-knife proxy install-service -- --rotate 600 --port 1080
+  xray-knife proxy install-service --user --name my-proxy -- --core sing-box
+  xray-knife proxy install-service --dry-run -- --mode inbound --file /etc/xray-knife/links.txt`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, a := range args {
+				if rejectedServiceFlags[a] {
+					return fmt.Errorf("%s cannot be used in a background service", a)
+				}
+			}
+
+			// The proxy must run under the name the service is registered with.
+			serviceArgs := []string{"proxy", "--service-name", cfg.name}
+			if p := utils.Profile(); p != "" {
+				// The service must read the same database as the installing command.
+				serviceArgs = append(serviceArgs, "--profile", p)
+			}
+			opts := svcinstall.Options{
+				Name:        cfg.name,
+				Description: cfg.description,
+				Args:        append(serviceArgs, args...),
+				User:        cfg.user,
+				NoStart:     cfg.noStart,
+			}
+
+			if cfg.dryRun {
+				preview, err := svcinstall.Preview(opts)
+				if err != nil {
+					return err
+				}
+				fmt.Print(preview)
+				return nil
+			}
+
+			if err := svcinstall.Install(opts); err != nil {
+				return err
+			}
+			if cfg.noStart {
+				customlog.Printf(customlog.Success, "Service '%s' installed and enabled.\n", cfg.name)
+			} else {
+				customlog.Printf(customlog.Success, "Service '%s' installed, enabled, and started.\n", cfg.name)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.name, "name", svcinstall.DefaultName, "Service name")
+	flags.StringVar(&cfg.description, "description", "", "Service description")
+	flags.BoolVar(&cfg.user, "user", false, "Install a per-user systemd service instead of a system one (Linux only)")
+	flags.BoolVar(&cfg.noStart, "no-start", false, "Install and enable the service without starting it")
+	flags.BoolVar(&cfg.dryRun, "dry-run", false, "Print the service definition instead of installing it")
+	return cmd
+}
+
+func newUninstallServiceCommand() *cobra.Command {
+	var name string
+	var user bool
+
+	cmd := &cobra.Command{
+		Use:   "uninstall-service",
+		Short: "Stop and remove a service created by install-service.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := svcinstall.Uninstall(name, user); err != nil {
+				return err
+			}
+			customlog.Printf(customlog.Success, "Service '%s' removed.\n", name)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", svcinstall.DefaultName, "Service name")
+	cmd.Flags().BoolVar(&user, "user", false, "Remove a per-user systemd service (Linux only)")
+	return cmd
+}
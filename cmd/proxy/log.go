@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	pkgproxy "github.com/lilendian0x00/xray-knife/v9/pkg/proxy"
+
+	"github.com/spf13/cobra"
+)
+
+// logTailCmdConfig holds the flags for the log tail command
+type logTailCmdConfig struct {
+	file   string
+	lines  int
+	follow bool
+	json   bool
+}
+
+func newLogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Inspect the access log of the proxy.",
+	}
+	cmd.AddCommand(newLogTailCommand())
+	return cmd
+}
+
+func newLogTailCommand() *cobra.Command {
+	cfg := &logTailCmdConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Print the last connections of the proxy access log.",
+		Long: `Prints the last --lines connections recorded by 'xray-knife proxy --access-log':
+when each was opened, its destination, the outbound and exit config it left
+through, the bytes sent and received and how long it lasted. --follow keeps
+printing connections as they close, across rotations of the log.
+
+Examples:
+  xray-knife proxy log tail
+  xray-knife proxy log tail -n 100 --json
+  xray-knife proxy log tail -f`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := cfg.file
+			if path == "" {
+				var err error
+				if path, err = pkgproxy.DefaultAccessLogPath(); err != nil {
+					return err
+				}
+			}
+			entries, err := pkgproxy.ReadAccessLog(path, cfg.lines)
+			if errors.Is(err, os.ErrNotExist) && !cfg.follow {
+				return fmt.Errorf("no access log at %s; run the proxy with --access-log", path)
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			for _, e := range entries {
+				printAccessEntry(e, cfg.json)
+			}
+			if !cfg.follow {
+				return nil
+			}
+			return followAccessLog(cmd, path, cfg.json)
+		},
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.file, "file", "", "Access log file (default "+pkgproxy.AccessLogFileName+" in the data directory)")
+	flags.IntVarP(&cfg.lines, "lines", "n", 20, "Number of connections to print (0 = all)")
+	flags.BoolVarP(&cfg.follow, "follow", "f", false, "Keep printing new connections")
+	flags.BoolVar(&cfg.json, "json", false, "Print the entries as JSON lines")
+	return cmd
+}
+
+// followAccessLog prints the entries appended to path until the command is
+// cancelled. The file is reopened from the start when it is rotated.
+func followAccessLog(cmd *cobra.Command, path string, asJSON bool) error {
+	var f *os.File
+	var offset int64
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			if f != nil {
+				if cur, err := f.Stat(); err != nil || !os.SameFile(cur, info) || info.Size() < offset {
+					f.Close()
+					f, offset = nil, 0
+				}
+			}
+			if f == nil {
+				if f, err = os.Open(path); err != nil {
+					return err
+				}
+			}
+			if info.Size() > offset {
+				if _, err := f.Seek(offset, io.SeekStart); err != nil {
+					return err
+				}
+				entries, read, err := pkgproxy.ReadAccessEntries(f)
+				if err != nil {
+					return err
+				}
+				offset += read
+				for _, e := range entries {
+					printAccessEntry(e, asJSON)
+				}
+			}
+		}
+
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func printAccessEntry(e protocol.AccessEntry, asJSON bool) {
+	if asJSON {
+		line, _ := json.Marshal(e)
+		fmt.Println(string(line))
+		return
+	}
+	exit := e.Exit
+	if exit == "" {
+		exit = "-"
+	}
+	fmt.Printf("%s  %-3s  %-40s  %-8s %-30s  ↑ %-9s ↓ %-9s %s\n",
+		e.Time.Local().Format(time.DateTime), e.Network, e.Destination, e.Outbound, exit,
+		formatBytes(e.Up), formatBytes(e.Down), (time.Duration(e.Duration) * time.Millisecond).String())
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
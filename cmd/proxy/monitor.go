@@ -0,0 +1,312 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+
+	"github.com/spf13/cobra"
+)
+
+// sparkBlocks are the sparkline levels, lowest latency first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkFailed marks a failed probe in the sparkline.
+const sparkFailed = '×'
+
+// monitorCmdConfig holds the flags for the monitor command
+type monitorCmdConfig struct {
+	configLink  string
+	coreType    string
+	destURL     string
+	httpMethod  string
+	interval    uint16
+	timeout     uint16
+	width       int
+	alertAfter  int
+	alertExec   string
+	bell        bool
+	insecureTLS bool
+}
+
+// monitorStats accumulates probe results for the live line and the summary.
+type monitorStats struct {
+	sent, received          int
+	total, minimum, maximum int64
+	window                  []int64 // last N delays in ms, -1 for failures
+	failStreak              int
+	down                    bool
+	downSince               time.Time
+}
+
+func newMonitorCommand() *cobra.Command {
+	cfg := &monitorCmdConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "monitor",
+		Short: "Continuously probe one config and show a live latency sparkline and loss rate.",
+		Long: `Probes a single config every --interval seconds through a long-running core instance
+and prints a live latency sparkline with the loss percentage, e.g.
+
+  ▂▂▃▂▁▂×▂▃█▂▂  last 212ms  avg 230ms  loss 1.2% (1/84)
+
+After --alert-after consecutive failures the config is reported DOWN, and UP again when
+a probe succeeds. --alert-exec runs a command on each transition with MONITOR_STATE
+(down/up), MONITOR_ADDRESS and MONITOR_ERROR set in its environment.
+
+Examples:
+  xray-knife proxy monitor -c "vless://..." --interval 10
+  xray-knife proxy monitor -c de-1
+  xray-knife proxy monitor -c "vless://..." --alert-after 3 --alert-exec 'notify-send "proxy $MONITOR_STATE"'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.configLink == "" {
+				return fmt.Errorf("a config link is required (--config)")
+			}
+			link, err := database.ResolveConfigLink(cfg.configLink)
+			if err != nil {
+				return err
+			}
+			cfg.configLink = link
+			if cfg.interval == 0 {
+				return fmt.Errorf("--interval must be at least 1 second")
+			}
+			if cfg.width < 1 {
+				return fmt.Errorf("--width must be at least 1")
+			}
+			if cfg.alertAfter < 1 {
+				return fmt.Errorf("--alert-after must be at least 1")
+			}
+			return runMonitor(cmd.Context(), cfg)
+		},
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&cfg.configLink, "config", "c", "", "The config link to monitor, or the ID or alias of a stored config")
+	flags.StringVarP(&cfg.coreType, "core", "z", "auto", "Core type (auto, singbox, xray)")
+	flags.StringVarP(&cfg.destURL, "url", "u", "https://cloudflare.com/cdn-cgi/trace", "The url to probe through the config")
+	flags.StringVarP(&cfg.httpMethod, "method", "m", "GET", "Http method")
+	flags.Uint16VarP(&cfg.interval, "interval", "n", 5, "Seconds between probes")
+	flags.Uint16Var(&cfg.timeout, "timeout", 5000, "Probe timeout in ms")
+	flags.IntVar(&cfg.width, "width", 40, "Number of probes shown in the sparkline")
+	flags.IntVar(&cfg.alertAfter, "alert-after", 3, "Consecutive failures before the config is reported down")
+	flags.StringVar(&cfg.alertExec, "alert-exec", "", "Shell command to run when the config goes down or comes back up")
+	flags.BoolVar(&cfg.bell, "bell", false, "Ring the terminal bell when the config goes down")
+	flags.BoolVarP(&cfg.insecureTLS, "insecure", "e", false, "Insecure tls connection (fake SNI)")
+	return cmd
+}
+
+func runMonitor(ctx context.Context, cfg *monitorCmdConfig) error {
+	var c core.Core
+	switch cfg.coreType {
+	case "xray":
+		c = core.CoreFactory(core.XrayCoreType, cfg.insecureTLS, false)
+	case "singbox", "sing-box":
+		c = core.CoreFactory(core.SingboxCoreType, cfg.insecureTLS, false)
+	case "auto":
+		c = core.NewAutomaticCore(false, cfg.insecureTLS)
+	default:
+		return fmt.Errorf("invalid core type. Available cores: (auto, xray, singbox)")
+	}
+
+	p, err := c.CreateProtocol(strings.TrimSpace(cfg.configLink))
+	if err != nil {
+		return fmt.Errorf("failed to create protocol: %w", err)
+	}
+	if err := p.Parse(); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	address := p.ConvertToGeneralConfig().Address
+
+	client, instance, err := c.MakeHttpClient(ctx, p, time.Duration(cfg.timeout)*time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	defer instance.Close()
+
+	customlog.Printf(customlog.Info, "Monitoring %s every %ds. Press Ctrl+C to stop.\n\n", address, cfg.interval)
+
+	live := isTerminal(os.Stdout)
+	st := &monitorStats{minimum: -1}
+	defer func() {
+		if live {
+			fmt.Println()
+		}
+		st.printSummary(address)
+	}()
+
+	ticker := time.NewTicker(time.Duration(cfg.interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		delay, _, _, err := pkghttp.MeasureDelay(ctx, client, cfg.destURL, cfg.httpMethod)
+		if ctx.Err() != nil {
+			return nil
+		}
+		st.record(delay, err, cfg.width)
+
+		switch st.transition(err, cfg.alertAfter, time.Now()) {
+		case "down":
+			clearLine(live)
+			customlog.Printf(customlog.Failure, "%s is DOWN after %d failed probes: %v\n", address, st.failStreak, err)
+			if cfg.bell {
+				fmt.Print("\a")
+			}
+			runAlert(cfg.alertExec, "down", address, err)
+		case "up":
+			clearLine(live)
+			customlog.Printf(customlog.Success, "%s is UP again after %s\n", address, time.Since(st.downSince).Round(time.Second))
+			runAlert(cfg.alertExec, "up", address, nil)
+		}
+
+		if live {
+			fmt.Printf("\r\033[K%s", st.line())
+		} else {
+			fmt.Println(st.line())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (st *monitorStats) record(delay int64, err error, width int) {
+	st.sent++
+	if err != nil {
+		st.failStreak++
+		delay = -1
+	} else {
+		st.failStreak = 0
+		st.received++
+		st.total += delay
+		if st.minimum == -1 || delay < st.minimum {
+			st.minimum = delay
+		}
+		st.maximum = max(st.maximum, delay)
+	}
+	st.window = append(st.window, delay)
+	if len(st.window) > width {
+		st.window = st.window[len(st.window)-width:]
+	}
+}
+
+// transition reports the config down once the last alertAfter probes failed and
+// up again at the first success after that. It returns the new state, "down" or
+// "up", or "" when the state didn't change. Call it after record.
+func (st *monitorStats) transition(err error, alertAfter int, now time.Time) string {
+	switch {
+	case err != nil && !st.down && st.failStreak >= alertAfter:
+		st.down, st.downSince = true, now
+		return "down"
+	case err == nil && st.down:
+		st.down = false
+		return "up"
+	}
+	return ""
+}
+
+func (st *monitorStats) loss() float64 {
+	if st.sent == 0 {
+		return 0
+	}
+	return float64(st.sent-st.received) / float64(st.sent) * 100
+}
+
+func (st *monitorStats) line() string {
+	last := "down"
+	if d := st.window[len(st.window)-1]; d >= 0 {
+		last = fmt.Sprintf("%dms", d)
+	}
+	avg := "-"
+	if st.received > 0 {
+		avg = fmt.Sprintf("%dms", st.total/int64(st.received))
+	}
+	return fmt.Sprintf("%s  last %s  avg %s  loss %.1f%% (%d/%d)",
+		sparkline(st.window), last, avg, st.loss(), st.sent-st.received, st.sent)
+}
+
+func (st *monitorStats) printSummary(address string) {
+	customlog.Printf(customlog.Info, "--- %s monitor statistics ---\n", address)
+	fmt.Printf("%d probes sent, %d succeeded, %.1f%% loss\n", st.sent, st.received, st.loss())
+	if st.received > 0 {
+		fmt.Printf("rtt min/avg/max = %d/%d/%d ms\n", st.minimum, st.total/int64(st.received), st.maximum)
+	}
+}
+
+// sparkline scales delays between the window's fastest and slowest probe.
+// Failed probes (-1) are drawn as sparkFailed.
+func sparkline(delays []int64) string {
+	lo, hi := int64(-1), int64(0)
+	for _, d := range delays {
+		if d < 0 {
+			continue
+		}
+		if lo == -1 || d < lo {
+			lo = d
+		}
+		hi = max(hi, d)
+	}
+
+	var b strings.Builder
+	for _, d := range delays {
+		switch {
+		case d < 0:
+			b.WriteRune(sparkFailed)
+		case hi == lo:
+			b.WriteRune(sparkBlocks[0])
+		default:
+			level := int((d - lo) * int64(len(sparkBlocks)-1) / (hi - lo))
+			b.WriteRune(sparkBlocks[level])
+		}
+	}
+	return b.String()
+}
+
+// runAlert runs the --alert-exec command for a state transition. Failures are only logged.
+func runAlert(command, state, address string, probeErr error) {
+	if command == "" {
+		return
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	errText := ""
+	if probeErr != nil {
+		errText = probeErr.Error()
+	}
+	cmd.Env = append(os.Environ(),
+		"MONITOR_STATE="+state,
+		"MONITOR_ADDRESS="+address,
+		"MONITOR_ERROR="+errText,
+	)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		customlog.Printf(customlog.Warning, "Alert command failed: %v\n", err)
+	}
+}
+
+func clearLine(live bool) {
+	if live {
+		fmt.Print("\r\033[K")
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		delays []int64
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"one probe", []int64{120}, "▁"},
+		{"equal delays", []int64{80, 80, 80}, "▁▁▁"},
+		{"scaled between fastest and slowest", []int64{100, 800, 450}, "▁█▄"},
+		{"failures", []int64{-1, 100, -1, 200}, "×▁×█"},
+		{"only failures", []int64{-1, -1}, "××"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sparkline(tt.delays); got != tt.want {
+				t.Errorf("sparkline(%v) = %q, want %q", tt.delays, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorTransitions(t *testing.T) {
+	failed := errors.New("probe failed")
+	tests := []struct {
+		name       string
+		alertAfter int
+		probes     []error
+		want       []string
+	}{
+		{"up stays quiet", 3, []error{nil, nil}, []string{"", ""}},
+		{"down after the streak", 3, []error{failed, failed, failed, failed}, []string{"", "", "down", ""}},
+		{"a success resets the streak", 2, []error{failed, nil, failed, failed}, []string{"", "", "", "down"}},
+		{"up again", 1, []error{failed, failed, nil, nil}, []string{"down", "", "up", ""}},
+		{"down twice", 1, []error{failed, nil, failed}, []string{"down", "up", "down"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &monitorStats{minimum: -1}
+			now := time.Now()
+			for i, err := range tt.probes {
+				st.record(100, err, 10)
+				if got := st.transition(err, tt.alertAfter, now); got != tt.want[i] {
+					t.Errorf("probe %d: transition = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	st := &monitorStats{minimum: -1}
+	st.record(0, failed, 10)
+	since := time.Now()
+	st.transition(failed, 1, since)
+	if !st.down || !st.downSince.Equal(since) {
+		t.Errorf("down = %v since %v, want down since %v", st.down, st.downSince, since)
+	}
+}
+
+func TestRunAlert(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the alert command runs through sh")
+	}
+	out := filepath.Join(t.TempDir(), "alert")
+	tests := []struct {
+		state string
+		err   error
+		want  string
+	}{
+		{"down", errors.New("connection reset"), "down 1.2.3.4 connection reset"},
+		{"up", nil, "up 1.2.3.4 "},
+	}
+	for _, tt := range tests {
+		runAlert(`printf '%s %s %s' "$MONITOR_STATE" "$MONITOR_ADDRESS" "$MONITOR_ERROR" > `+out, tt.state, "1.2.3.4", tt.err)
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("alert for %s wrote %q, want %q", tt.state, got, tt.want)
+		}
+	}
+
+	// Without a command nothing runs, and a failing command is only logged.
+	os.Remove(out)
+	runAlert("", "down", "1.2.3.4", nil)
+	if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("alert ran without a command: %v", err)
+	}
+	runAlert("exit 3", "down", "1.2.3.4", nil)
+}
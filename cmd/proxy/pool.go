@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	pkgproxy "github.com/lilendian0x00/xray-knife/v9/pkg/proxy"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+
+	"github.com/spf13/cobra"
+)
+
+// poolCmdConfig holds the flags for the pool command
+type poolCmdConfig struct {
+	basePort    int
+	count       int
+	listenAddr  string
+	coreType    string
+	subID       int64
+	file        string
+	auth        string
+	out         string
+	insecureTLS bool
+	verbose     bool
+
+	lbPort         int
+	rotate         string
+	rotateEvery    int
+	rotateInterval time.Duration
+	sticky         bool
+	stickyTTL      time.Duration
+}
+
+func newPoolCommand() *cobra.Command {
+	cfg := &poolCmdConfig{}
+
+	cmd := &cobra.Command{
+		Use:   "pool",
+		Short: "Serve the top N configs at once, each on its own local SOCKS port.",
+		Long: `Starts --count local SOCKS5 inbounds on consecutive ports from --base-port, each
+bound to a different config, and prints which port exits through which config.
+Scrapers and test frameworks can then spread their requests over many distinct
+exits at once.
+
+The configs are the best ranked by 'xray-knife subs best' over the recent test
+runs (run 'xray-knife http --from-db --save-db' first), or the first --count
+links of --file. A config that fails to start is reported and its port left
+unused. --out writes the proxy URLs, one per line, for tools that read a proxy
+list.
+
+--lb-port adds a load-balanced SOCKS5 port in front of the pool, for clients
+that only take a single proxy. Its connections are spread over the pool's exits
+by the --rotate policy:
+  conn      every connection leaves through the next exit
+  requests  every --rotate-every connections switch to the next exit
+  interval  the exit changes every --rotate-interval
+--sticky keeps every destination host on the exit it last used until it goes
+--sticky-ttl without a connection, so sites that tie a session to the client IP
+keep working.
+
+Examples:
+  xray-knife proxy pool --base-port 20000 --count 20
+  xray-knife proxy pool --count 5 --sub-id 2 --out proxies.txt
+  xray-knife proxy pool -f configs.txt --count 10 --addr 0.0.0.0 --auth user:secret
+  xray-knife proxy pool --count 10 --lb-port 1080 --rotate requests --rotate-every 50
+  xray-knife proxy pool --count 10 --lb-port 1080 --rotate interval --rotate-interval 2m --sticky`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.count < 1 {
+				return fmt.Errorf("--count must be at least 1")
+			}
+			var username, password string
+			if cfg.auth != "" {
+				var ok bool
+				if username, password, ok = strings.Cut(cfg.auth, ":"); !ok || username == "" || password == "" {
+					return fmt.Errorf("--auth must be user:pass")
+				}
+			}
+
+			links, err := poolLinks(cfg)
+			if err != nil {
+				return err
+			}
+			if len(links) == 0 && cfg.file != "" {
+				return fmt.Errorf("no config links in %s", cfg.file)
+			}
+			if len(links) == 0 {
+				return fmt.Errorf("no config passed in the recent test runs; run 'xray-knife http --from-db --save-db' first")
+			}
+			if len(links) < cfg.count {
+				customlog.Printf(customlog.Warning, "Only %d configs are available, serving them on %d ports.\n", len(links), len(links))
+			}
+
+			pool, err := pkgproxy.StartPool(pkgproxy.PoolConfig{
+				CoreType:    cfg.coreType,
+				ListenAddr:  cfg.listenAddr,
+				BasePort:    cfg.basePort,
+				Username:    username,
+				Password:    password,
+				InsecureTLS: cfg.insecureTLS,
+				Verbose:     cfg.verbose,
+			}, links)
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+
+			var rotator *pkgproxy.Rotator
+			if cfg.lbPort != 0 {
+				rotator, err = pkgproxy.NewRotator(pkgproxy.RotatorConfig{
+					Policy:    cfg.rotate,
+					Every:     cfg.rotateEvery,
+					Interval:  cfg.rotateInterval,
+					Sticky:    cfg.sticky,
+					StickyTTL: cfg.stickyTTL,
+					Username:  username,
+					Password:  password,
+					Verbose:   cfg.verbose,
+				}, pkgproxy.PoolExits(pool, cfg.listenAddr), log.New(os.Stderr, "", 0))
+				if err != nil {
+					return err
+				}
+				if err := rotator.Start(net.JoinHostPort(cfg.listenAddr, strconv.Itoa(cfg.lbPort))); err != nil {
+					return err
+				}
+				defer rotator.Close()
+			}
+
+			var urls []string
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "PORT\tPROTOCOL\tSERVER\tREMARK")
+			fmt.Fprintln(w, "----\t--------\t------\t------")
+			for _, m := range pool.Members {
+				if m.Err != nil {
+					fmt.Fprintf(w, "%d\t-\t-\tfailed: %v\n", m.Port, m.Err)
+					continue
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", m.Port, m.Config.Protocol, net.JoinHostPort(m.Config.Address, m.Config.Port), m.Config.Remark)
+				urls = append(urls, poolProxyURL(cfg.listenAddr, m.Port, username, password))
+			}
+			w.Flush()
+			fmt.Println()
+
+			if cfg.out != "" {
+				if err := utils.WriteIntoFile(cfg.out, []byte(strings.Join(urls, "\n")+"\n")); err != nil {
+					return err
+				}
+				if cfg.out != "-" {
+					customlog.Printf(customlog.Success, "Wrote the %d proxy URLs to %s\n", len(urls), cfg.out)
+				}
+			}
+			if rotator != nil {
+				customlog.Printf(customlog.Info, "Load-balanced port: %s (rotating %s)\n", poolProxyURL(cfg.listenAddr, cfg.lbPort, username, password), rotationDescription(cfg))
+			}
+			customlog.Printf(customlog.Success, "Serving %d configs on %s. Press Ctrl+C to stop.\n", len(urls), cfg.listenAddr)
+			<-cmd.Context().Done()
+			customlog.Printf(customlog.Processing, "Shutting down the pool...\n")
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.IntVar(&cfg.basePort, "base-port", 20000, "Port of the first config; the others follow on consecutive ports")
+	flags.IntVar(&cfg.count, "count", 20, "Number of configs to serve")
+	flags.StringVarP(&cfg.listenAddr, "addr", "a", "127.0.0.1", "Listen ip address of the SOCKS inbounds")
+	flags.StringVarP(&cfg.coreType, "core", "z", "auto", "Core type (auto, xray, sing-box)")
+	flags.Int64Var(&cfg.subID, "sub-id", 0, "Only serve configs seen in this subscription")
+	flags.StringVarP(&cfg.file, "file", "f", "", "Serve the first --count links of this file instead of the best-ranked configs")
+	flags.StringVar(&cfg.auth, "auth", "", "Require this user:pass on every inbound")
+	flags.StringVarP(&cfg.out, "out", "o", "", "Write the proxy URLs to this file ('-' for stdout)")
+	flags.BoolVarP(&cfg.insecureTLS, "insecure", "e", false, "Allow insecure TLS connections (e.g., self-signed certs)")
+	flags.BoolVarP(&cfg.verbose, "verbose", "v", false, "Enable verbose logging for the cores")
+	flags.IntVar(&cfg.lbPort, "lb-port", 0, "Also serve a load-balanced SOCKS5 port rotating over the pool (0 = off)")
+	flags.StringVar(&cfg.rotate, "rotate", pkgproxy.RotatePerConnection, "Rotation policy of the load-balanced port: conn, requests, interval")
+	flags.IntVar(&cfg.rotateEvery, "rotate-every", 10, "Connections per exit with --rotate requests")
+	flags.DurationVar(&cfg.rotateInterval, "rotate-interval", time.Minute, "Time per exit with --rotate interval, e.g. 30s")
+	flags.BoolVar(&cfg.sticky, "sticky", false, "Keep each destination host on the same exit of the load-balanced port")
+	flags.DurationVar(&cfg.stickyTTL, "sticky-ttl", 10*time.Minute, "Idle time after which a sticky host may move to another exit")
+	cmd.MarkFlagsMutuallyExclusive("file", "sub-id")
+	cmd.RegisterFlagCompletionFunc("rotate", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{pkgproxy.RotatePerConnection, pkgproxy.RotatePerRequests, pkgproxy.RotatePerInterval}, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.RegisterFlagCompletionFunc("core", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"auto", "xray", "sing-box"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
+// poolLinks returns the links the pool serves, best first.
+func poolLinks(cfg *poolCmdConfig) ([]string, error) {
+	if cfg.file == "" {
+		return subs.BestConfigs(cfg.count, cfg.subID)
+	}
+	links, _ := pkghttp.DeduplicateLinks(utils.ParseFileByNewline(cfg.file))
+	if len(links) > cfg.count {
+		links = links[:cfg.count]
+	}
+	return links, nil
+}
+
+// rotationDescription describes the rotation policy of the load-balanced port.
+func rotationDescription(cfg *poolCmdConfig) string {
+	var d string
+	switch cfg.rotate {
+	case pkgproxy.RotatePerRequests:
+		d = fmt.Sprintf("every %d connections", cfg.rotateEvery)
+	case pkgproxy.RotatePerInterval:
+		d = "every " + cfg.rotateInterval.String()
+	default:
+		d = "per connection"
+	}
+	if cfg.sticky {
+		d += ", sticky per host"
+	}
+	return d
+}
+
+// poolProxyURL is the socks5:// URL a client uses for the inbound on port.
+func poolProxyURL(addr string, port int, username, password string) string {
+	if addr == "0.0.0.0" || addr == "::" {
+		addr = "127.0.0.1"
+	}
+	u := url.URL{Scheme: "socks5", Host: net.JoinHostPort(addr, strconv.Itoa(port))}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	return u.String()
+}
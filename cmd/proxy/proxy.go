@@ -5,11 +5,14 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	pkgproxy "github.com/lilendian0x00/xray-knife/v9/pkg/proxy"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/proxy/svcinstall"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/watchdog"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
 
@@ -46,6 +49,18 @@ type proxyCmdConfig struct {
 	chainFile           string
 	chainHops           uint8
 	chainRotation       string
+	group               int64
+	outbound            string
+	ipVersion           string
+	dial                protocol.DialOptions
+	blockRules          []string
+	allowRules          []string
+	accessLog           bool
+	accessLogFile       string
+	accessLogMaxSize    uint32
+	accessLogBackups    uint16
+	maxMemory           uint64
+	serviceName         string
 }
 
 // ProxyCmd is the proxy subcommand.
@@ -58,7 +73,37 @@ func newProxyCommand() *cobra.Command {
 		Use:   "proxy",
 		Short: "Run a local inbound proxy that tunnels traffic through a remote configuration. Supports automatic rotation.",
 		Long: `Runs a local proxy service using configurations from the database by default.
-Use --file, --config, or --stdin to provide configs for a single session without using the database.`,
+Use --file, --config, or --stdin to provide configs for a single session without using the database.
+
+With --outbound direct or --outbound block no remote config is used: the inbound
+sends traffic straight out or drops it, which makes xray-knife a plain local
+router or debug proxy. --block and --allow route matching destinations (a domain
+and its subdomains, full:/keyword:/regexp: matchers, an IP or CIDR, or "private")
+to the blackhole or direct outbound.
+
+--group runs a relay chain or balancer group saved from a subscription's composite
+links (see 'xray-knife subs groups').
+
+--config also takes the ID or alias of a stored config (see 'xray-knife subs
+list-configs'), such as "de-1".
+
+--access-log records every proxied connection (time, destination, outbound,
+exit config and bytes each way) to ` + pkgproxy.AccessLogFileName + ` in the data directory, or
+--access-log-file, rotating it at --access-log-max-size. Watch it with
+'xray-knife proxy log tail -f'.
+
+--max-memory restarts the proxy, with the same command line, once its resident
+memory goes over that many MB, for cores that leak over long rotation runs.
+With --verbose the goroutines, open files and memory it holds are logged every
+minute. The limit doesn't apply when the proxy runs as a Windows service.
+
+Examples:
+  xray-knife proxy --config de-1
+  xray-knife proxy --rotate 300 --access-log
+  xray-knife proxy --rotate 300 --max-memory 512
+  xray-knife proxy --group 4
+  xray-knife proxy --outbound direct --block ads.example.com,private
+  xray-knife proxy --outbound block --allow example.com --allow 1.1.1.1`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Get config links if provided via flags, otherwise leave empty.
 			var links []string
@@ -66,7 +111,11 @@ Use --file, --config, or --stdin to provide configs for a single session without
 			if cfg.configLinksFile != "" {
 				links = utils.ParseFileByNewline(cfg.configLinksFile)
 			} else if cfg.configLink != "" {
-				links = []string{cfg.configLink}
+				link, err := database.ResolveConfigLink(cfg.configLink)
+				if err != nil {
+					return err
+				}
+				links = []string{link}
 			} else if cfg.readConfigFromSTDIN {
 				scanner := bufio.NewScanner(os.Stdin)
 				fmt.Println("Reading config links from STDIN (press CTRL+D when done):")
@@ -79,6 +128,11 @@ Use --file, --config, or --stdin to provide configs for a single session without
 					return fmt.Errorf("error reading from stdin: %w", err)
 				}
 			}
+			if cfg.group != 0 {
+				if links, err = groupLinks(cfg); err != nil {
+					return err
+				}
+			}
 			// If links slice is empty, the service will automatically fetch from the DB.
 
 			// Validate app mode flags.
@@ -117,6 +171,17 @@ Use --file, --config, or --stdin to provide configs for a single session without
 				cfg.chainRotation = "none"
 			}
 
+			var accessLog string
+			if cfg.accessLog {
+				if accessLog = cfg.accessLogFile; accessLog == "" {
+					if accessLog, err = pkgproxy.DefaultAccessLogPath(); err != nil {
+						return err
+					}
+				}
+			} else if cmd.Flags().Changed("access-log-file") {
+				return fmt.Errorf("--access-log-file requires --access-log")
+			}
+
 			// Create the service configuration from flags
 			serviceConfig := pkgproxy.Config{
 				CoreType:            cfg.CoreType,
@@ -144,6 +209,14 @@ Use --file, --config, or --stdin to provide configs for a single session without
 				ChainFile:           cfg.chainFile,
 				ChainHops:           cfg.chainHops,
 				ChainRotation:       cfg.chainRotation,
+				Outbound:            cfg.outbound,
+				IPVersion:           cfg.ipVersion,
+				Dial:                cfg.dial,
+				BlockRules:          strings.Join(cfg.blockRules, ","),
+				AllowRules:          strings.Join(cfg.allowRules, ","),
+				AccessLog:           accessLog,
+				AccessLogMaxSize:    cfg.accessLogMaxSize,
+				AccessLogBackups:    cfg.accessLogBackups,
 				ConfigLinks:         links,
 			}
 
@@ -154,22 +227,26 @@ Use --file, --config, or --stdin to provide configs for a single session without
 			}
 			defer service.Close()
 
-			// Set up context for graceful shutdown
-			ctx, cancel := context.WithCancel(context.Background())
-			signalChan := make(chan os.Signal, 1)
-			signal.Notify(signalChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-			defer func() {
-				signal.Stop(signalChan)
-				cancel()
-			}()
-			go func() {
-				select {
-				case sig := <-signalChan:
-					customlog.Printf(customlog.Processing, "Received signal: %v. Shutting down...\n", sig)
-					cancel()
-				case <-ctx.Done():
+			// When started by the Windows service control manager, stop requests
+			// cancel the context instead of OS signals.
+			if handled, err := svcinstall.RunAsService(cfg.serviceName, func(ctx context.Context) error {
+				return service.Run(ctx, make(chan struct{}))
+			}); handled {
+				return err
+			}
+
+			// The root context is cancelled on SIGINT/SIGTERM; Run then closes the
+			// inbounds and the deferred Close restores the system proxy.
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			w := &watchdog.Watchdog{MaxMemory: cfg.maxMemory, Interval: time.Minute}
+			if cfg.verbose {
+				w.OnSample = func(s watchdog.Stats) {
+					customlog.Printf(customlog.Info, "Proxy resources: %s\n", s)
 				}
-			}()
+			}
+			ctx, stopWatchdog := w.Watch(ctx)
+			defer stopWatchdog()
 
 			// Set up channel for manual rotation.
 			// Skip the stdin reader in app+shell mode because the shell
@@ -179,7 +256,11 @@ Use --file, --config, or --stdin to provide configs for a single session without
 				go func() {
 					reader := bufio.NewReader(os.Stdin)
 					for {
-						reader.ReadString('\n')
+						// Stop on EOF (e.g. stdin is /dev/null under systemd),
+						// otherwise we would force a rotation in a tight loop.
+						if _, err := reader.ReadString('\n'); err != nil {
+							return
+						}
 						select {
 						case forceRotateChan <- struct{}{}:
 						case <-ctx.Done():
@@ -190,11 +271,20 @@ Use --file, --config, or --stdin to provide configs for a single session without
 			}
 
 			// Run the service
-			return service.Run(ctx, forceRotateChan)
+			err = service.Run(ctx, forceRotateChan)
+			if restart := watchdog.Restarting(ctx); restart != nil {
+				return restart
+			}
+			return err
 		},
 	}
 
 	addFlags(cmd, cfg)
+	cmd.AddCommand(newMonitorCommand())
+	cmd.AddCommand(newPoolCommand())
+	cmd.AddCommand(newLogCommand())
+	cmd.AddCommand(newInstallServiceCommand())
+	cmd.AddCommand(newUninstallServiceCommand())
 	return cmd
 }
 
@@ -203,7 +293,7 @@ func addFlags(cmd *cobra.Command, cfg *proxyCmdConfig) {
 	flags := cmd.Flags()
 	flags.BoolVarP(&cfg.readConfigFromSTDIN, "stdin", "i", false, "Read config link(s) from STDIN")
 	flags.StringVarP(&cfg.configLinksFile, "file", "f", "", "Read config links from a file")
-	flags.StringVarP(&cfg.configLink, "config", "c", "", "The single xray/sing-box config link to use")
+	flags.StringVarP(&cfg.configLink, "config", "c", "", "The single xray/sing-box config link to use, or the ID or alias of a stored config")
 
 	flags.Uint32VarP(&cfg.rotationInterval, "rotate", "t", 300, "How often to rotate outbounds (seconds)")
 	flags.Uint16VarP(&cfg.maximumAllowedDelay, "mdelay", "d", 3000, "Maximum allowed delay (ms) for testing configs during rotation")
@@ -228,6 +318,19 @@ func addFlags(cmd *cobra.Command, cfg *proxyCmdConfig) {
 
 	flags.BoolVarP(&cfg.verbose, "verbose", "v", false, "Enable verbose logging for the selected core")
 	flags.BoolVarP(&cfg.insecureTLS, "insecure", "e", false, "Allow insecure TLS connections (e.g., self-signed certs)")
+	flags.StringVar(&cfg.ipVersion, "ip-version", "", "Only use configs over this IP version and dial their servers over it (4, 6)")
+	flags.BoolVar(&cfg.dial.TCPFastOpen, "tcp-fast-open", false, "Enable TCP Fast Open when dialing config servers")
+	flags.StringVar(&cfg.dial.Interface, "bind-interface", "", "Dial config servers from this network interface, e.g. eth1")
+	flags.Uint32Var(&cfg.dial.Mark, "mark", 0, "Set this fwmark (SO_MARK) on sockets to config servers, for policy routing (Linux)")
+	flags.StringVar(&cfg.dial.DomainStrategy, "domain-strategy", "", "How server domains are resolved: as-is, prefer-ipv4, prefer-ipv6, ipv4-only, ipv6-only")
+	flags.DurationVar(&cfg.dial.HappyEyeballs, "happy-eyeballs", 0, "Race the addresses of a server, trying the next after this delay, e.g. 250ms (0 = off)")
+	flags.BoolVar(&cfg.dial.Fragment, "fragment", false, "Split the TLS ClientHello sent to config servers, against SNI filtering")
+	cmd.RegisterFlagCompletionFunc("domain-strategy", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"as-is", "prefer-ipv4", "prefer-ipv6", "ipv4-only", "ipv6-only"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.RegisterFlagCompletionFunc("ip-version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"4", "6"}, cobra.ShellCompDirectiveNoFileComp
+	})
 
 	flags.Uint16VarP(&cfg.batchSize, "batch", "b", 0, "Number of configs to test per rotation (0=auto)")
 	flags.Uint16VarP(&cfg.concurrency, "concurrency", "n", 0, "Number of concurrent test threads (0=auto)")
@@ -244,13 +347,58 @@ func addFlags(cmd *cobra.Command, cfg *proxyCmdConfig) {
 	flags.StringVar(&cfg.chainFile, "chain-file", "", "Fixed chain hops from file (one link per line)")
 	flags.Uint8Var(&cfg.chainHops, "chain-hops", 2, "Number of hops when selecting from pool")
 	flags.StringVar(&cfg.chainRotation, "chain-rotation", "none", "Chain rotation mode: none, exit, full")
+	flags.Int64Var(&cfg.group, "group", 0, "Use a relay chain or balancer group from the database (see 'subs groups')")
 	cmd.RegisterFlagCompletionFunc("chain-rotation", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"none", "exit", "full"}, cobra.ShellCompDirectiveNoFileComp
 	})
 
+	flags.StringVar(&cfg.outbound, "outbound", "", "Route locally instead of through a config: direct or block")
+	cmd.RegisterFlagCompletionFunc("outbound", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"direct", "block"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	flags.StringSliceVar(&cfg.blockRules, "block", nil, "Destinations the local outbound drops (domain, full:/keyword:/regexp:, IP, CIDR, private)")
+	flags.StringSliceVar(&cfg.allowRules, "allow", nil, "Destinations the local outbound sends direct (same forms as --block)")
+
+	flags.BoolVar(&cfg.accessLog, "access-log", false, "Record every proxied connection to the access log")
+	flags.StringVar(&cfg.accessLogFile, "access-log-file", "", "Access log file (default "+pkgproxy.AccessLogFileName+" in the data directory)")
+	flags.Uint32Var(&cfg.accessLogMaxSize, "access-log-max-size", 10, "Size in MB at which the access log is rotated (0 = never)")
+	flags.Uint16Var(&cfg.accessLogBackups, "access-log-backups", 3, "Rotated access logs to keep")
+	flags.Uint64Var(&cfg.maxMemory, "max-memory", 0, "Restart the proxy when its resident memory goes over this many MB (0 = never)")
+	// Set by install-service to the name the service is registered under.
+	flags.StringVar(&cfg.serviceName, "service-name", svcinstall.DefaultName, "Name of the Windows service the proxy runs as")
+	flags.MarkHidden("service-name")
+
 	// Mark mutually exclusive flags
 	cmd.MarkFlagsMutuallyExclusive("file", "config", "stdin")
+	cmd.MarkFlagsMutuallyExclusive("outbound", "file")
+	cmd.MarkFlagsMutuallyExclusive("outbound", "config")
+	cmd.MarkFlagsMutuallyExclusive("outbound", "stdin")
+	cmd.MarkFlagsMutuallyExclusive("outbound", "chain")
 	cmd.MarkFlagsMutuallyExclusive("inbound-config", "inbound")
 	cmd.MarkFlagsMutuallyExclusive("shell", "namespace")
 	cmd.MarkFlagsMutuallyExclusive("chain-links", "chain-file")
+	cmd.MarkFlagsMutuallyExclusive("group", "file", "config", "stdin", "outbound", "chain-links", "chain-file")
+}
+
+// groupLinks loads a group saved from a composite link. A chain becomes the
+// fixed chain, and the links of a balancer group are returned as the pool.
+func groupLinks(cfg *proxyCmdConfig) ([]string, error) {
+	group, err := database.GetConfigGroup(cfg.group)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]string, len(group.Members))
+	for i, m := range group.Members {
+		links[i] = m.ConfigLink
+	}
+	if group.Kind != string(protocol.CompositeChain) {
+		return links, nil
+	}
+	for i, l := range links {
+		if strings.Contains(l, "|") {
+			return nil, fmt.Errorf("hop %d of group %d contains '|'; save the hops with 'subs groups --id %d --links' and use --chain-file", i+1, group.ID, group.ID)
+		}
+	}
+	cfg.chainLinks = strings.Join(links, "|")
+	return nil, nil
 }
@@ -1,19 +1,35 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
+	"github.com/lilendian0x00/xray-knife/v9/cmd/api"
+	"github.com/lilendian0x00/xray-knife/v9/cmd/bench"
+	"github.com/lilendian0x00/xray-knife/v9/cmd/bot"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/cfscanner"
+	"github.com/lilendian0x00/xray-knife/v9/cmd/convert"
 	xkexec "github.com/lilendian0x00/xray-knife/v9/cmd/exec"
+	"github.com/lilendian0x00/xray-knife/v9/cmd/generate"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/http"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/net"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/parse"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/proxy"
+	"github.com/lilendian0x00/xray-knife/v9/cmd/server"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
 	"github.com/lilendian0x00/xray-knife/v9/cmd/webui"
 	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/settings"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/watchdog"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
 	"github.com/spf13/cobra"
 )
@@ -27,54 +43,172 @@ var rootCmd = &cobra.Command{
 
 // Execute is called by main() to kick everything off.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := shutdownContext()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	var restart *watchdog.RestartError
+	if errors.As(err, &restart) {
+		customlog.Printf(customlog.Warning, "Restarting: %v\n", restart)
+		err = watchdog.Restart()
+		customlog.Printf(customlog.Failure, "Failed to restart: %v\n", err)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// shutdownContext returns a context that is cancelled on the first SIGINT/SIGTERM,
+// giving long-running commands (tests, scans, fetches, the proxy) a chance to save
+// partial results and clean up. A second signal exits immediately.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			customlog.Printf(customlog.Warning, "Received %v, shutting down... (press Ctrl+C again to force quit)\n", sig)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		<-sigCh
+		os.Exit(130)
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
+	}
+}
+
 func addSubcommandPalettes() {
 	rootCmd.AddCommand(parse.ParseCmd)
 	rootCmd.AddCommand(subs.SubsCmd)
 	rootCmd.AddCommand(http.HttpCmd)
+	rootCmd.AddCommand(http.TestCmd)
 	rootCmd.AddCommand(net.NetCmd)
 	rootCmd.AddCommand(cfscanner.CFscannerCmd)
 	rootCmd.AddCommand(proxy.ProxyCmd)
 	rootCmd.AddCommand(webui.WebUICmd)
+	rootCmd.AddCommand(api.ApiCmd)
+	rootCmd.AddCommand(bot.BotCmd)
 	rootCmd.AddCommand(xkexec.ExecCmd)
+	rootCmd.AddCommand(convert.ConvertCmd)
+	rootCmd.AddCommand(generate.GenerateCmd)
+	rootCmd.AddCommand(bench.BenchCmd)
+	rootCmd.AddCommand(server.ServerCmd)
+	rootCmd.AddCommand(newInitCommand())
 }
 
+// profile is the --profile flag.
+var profile string
+
+// dataDir is the --data-dir flag.
+var dataDir string
+
+// readOnly is the --readonly flag.
+var readOnly bool
+
+// noColor is the --no-color flag.
+var noColor bool
+
+// themeName is the --theme flag.
+var themeName string
+
+// dbPath is the database opened by initConfig.
+var dbPath string
+
+// userSettings are the settings of the config file, loaded by initConfig.
+var userSettings settings.Settings
+
 // Set up the application's configuration and initialize the database.
 func initConfig() {
-	// Find home directory.
-	home, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalf("Could not find user home directory: %v", err)
+	if !rootCmd.PersistentFlags().Changed("profile") {
+		profile = os.Getenv(utils.ProfileEnv)
+	}
+	if err := utils.SetProfile(profile); err != nil {
+		log.Fatal(err)
+	}
+	if !rootCmd.PersistentFlags().Changed("data-dir") {
+		dataDir = os.Getenv(utils.DataDirEnv)
+	}
+	if err := utils.SetBaseDir(dataDir); err != nil {
+		log.Fatal(err)
 	}
 
-	// Define the application's config directory path (~/.xray-knife)
-	configDir := filepath.Join(home, ".xray-knife")
+	// The config directory of the profile (the data directory, or its
+	// profiles/<name>), created if it doesn't exist.
+	configDir, err := utils.DataDir()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Create the config directory if it doesn't exist.
-	if _, err := os.Stat(configDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(configDir, 0755); err != nil {
-			log.Fatalf("Could not create config directory at %s: %v", configDir, err)
-		}
+	// Read the general settings; they may move the database elsewhere.
+	userSettings, err = settings.Load(filepath.Join(configDir, score.ConfigFileName))
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Define the database path.
-	dbPath := filepath.Join(configDir, "xray-knife.db")
+	dbPath = filepath.Join(configDir, "xray-knife.db")
+	if userSettings.DBPath != "" {
+		dbPath = userSettings.DBPath
+	}
 
 	// Initialize the database.
-	// This opens the connection and runs migrations.
-	if err := database.InitDB(dbPath); err != nil {
+	// This opens the connection and runs migrations, unless it's opened
+	// read-only next to a process writing to it.
+	initDB := database.InitDB
+	if readOnly {
+		initDB = database.InitDBReadOnly
+	}
+	if err := initDB(dbPath); err != nil {
 		customlog.Printf(customlog.Failure, "Failed to initialize database: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// applyColors sets up colored output from --no-color, --theme and the color.*
+// settings.
+func applyColors(s settings.Settings) error {
+	if noColor {
+		customlog.DisableColor()
+	}
+	theme := themeName
+	if theme == "" {
+		theme = s.Theme
+	}
+	if theme != "" {
+		if err := customlog.SetTheme(theme); err != nil {
+			return fmt.Errorf("invalid --theme: %w", err)
+		}
+	}
+	if s.ColorSuccess != "" {
+		if err := customlog.SetTypeColor(customlog.Success, s.ColorSuccess); err != nil {
+			return err
+		}
+	}
+	if s.ColorFailure != "" {
+		return customlog.SetTypeColor(customlog.Failure, s.ColorFailure)
+	}
+	return nil
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := applyColors(userSettings); err != nil {
+			return err
+		}
+		return applySettings(cmd, userSettings)
+	}
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Use a separate database, config files and data dir under <data dir>/profiles/NAME (env "+utils.ProfileEnv+")")
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "", "Keep the database, config files, logs and state here (env "+utils.DataDirEnv+"; default ~/.xray-knife if it exists, else the platform's data directory)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also when NO_COLOR is set)")
+	rootCmd.PersistentFlags().StringVar(&themeName, "theme", "", "Color theme: "+strings.Join(customlog.ThemeNames(), " or ")+" (default from color.theme, else dark)")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "readonly", false, "Open the database read-only, e.g. to query it while a proxy or web UI writes to it")
 
 	addSubcommandPalettes()
 }
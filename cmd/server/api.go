@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// apiConfig holds the flags connecting to the gRPC API of a server.
+type apiConfig struct {
+	Timeout    time.Duration
+	TLS        bool
+	Insecure   bool
+	ServerName string
+	Token      string
+}
+
+// addAPIFlags adds the flags of cfg to cmd.
+func addAPIFlags(cmd *cobra.Command, cfg *apiConfig) {
+	flags := cmd.Flags()
+	flags.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "Time limit for the calls to the API")
+	flags.BoolVar(&cfg.TLS, "tls", false, "Connect to the API with TLS")
+	flags.BoolVar(&cfg.Insecure, "insecure", false, "With --tls, don't verify the certificate of the API")
+	flags.StringVar(&cfg.ServerName, "sni", "", "With --tls, the server name to verify (default the host of ADDRESS)")
+	flags.StringVar(&cfg.Token, "token", "", "Send this bearer token with every call, for a reverse proxy in front of the API")
+}
+
+// dial opens a connection to the API at addr. Nothing is sent until the first call.
+func dial(addr string, cfg *apiConfig) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if cfg.TLS {
+		creds = credentials.NewTLS(&tls.Config{ServerName: cfg.ServerName, InsecureSkipVerify: cfg.Insecure})
+	} else if cfg.Token != "" {
+		customlog.Printf(customlog.Warning, "Sending --token without --tls: anyone on the way can read it\n")
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if cfg.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken{token: cfg.Token, secure: cfg.TLS}))
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// bearerToken sends a token in the authorization header of every call.
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+func (b bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + b.token}, nil
+}
+
+func (b bearerToken) RequireTransportSecurity() bool { return b.secure }
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xtls/xray-core/app/stats/command"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+func newCheckCommand() *cobra.Command {
+	cfg := &apiConfig{}
+	var reset bool
+
+	cmd := &cobra.Command{
+		Use:   "check ADDRESS",
+		Short: "Reports the uptime, traffic and online users of an xray server from its stats API",
+		Long: `Connects to the gRPC API of an xray server at ADDRESS (host:port) and reports
+how long it has been up, its memory use, the traffic of each user and inbound
+and the users online now, with how many IPs each one is connected from.
+
+The server needs the API with the StatsService and stats enabled, and per-user
+traffic and online users need statsUserUplink, statsUserDownlink and
+statsUserOnline in its policy:
+
+  "api": { "tag": "api", "listen": "127.0.0.1:10085", "services": ["StatsService"] },
+  "stats": {},
+  "policy": { "levels": { "0": { "statsUserUplink": true, "statsUserDownlink": true,
+                                 "statsUserOnline": true } } }
+
+The API has no authentication of its own, so keep it on localhost and reach it
+over an SSH tunnel, or put it behind a reverse proxy: --tls connects with TLS
+and --token sends "authorization: Bearer TOKEN" with every call for the proxy
+to check. Older xray versions can't list the users online and only report the
+traffic. --reset zeroes the traffic counters after reading them, to
+report the traffic since the last check.
+
+Examples:
+  xray-knife server check 127.0.0.1:10085
+  xray-knife server check api.example.com:443 --tls --token s3cret
+  xray-knife server check 127.0.0.1:10085 --reset`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, err := dial(args[0], cfg)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), cfg.Timeout)
+			defer cancel()
+			st, err := checkServer(ctx, command.NewStatsServiceClient(conn), reset)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			printStatus(args[0], st)
+			return nil
+		},
+	}
+
+	addAPIFlags(cmd, cfg)
+	cmd.Flags().BoolVar(&reset, "reset", false, "Zero the traffic counters after reading them")
+	return cmd
+}
+
+// traffic is the traffic of a user or an inbound since the counters were last
+// reset, in bytes.
+type traffic struct {
+	Name     string
+	Up, Down int64
+	// OnlineIPs is the number of IPs a user is connected from, 0 when offline.
+	OnlineIPs int64
+}
+
+// serverStatus is what 'server check' reports.
+type serverStatus struct {
+	Uptime     time.Duration
+	Goroutines uint32
+	Memory     uint64 // bytes allocated
+	Users      []traffic
+	Inbounds   []traffic
+	// Online are the users online now, nil when the server can't tell.
+	Online []string
+}
+
+// checkServer gathers the status of the server behind client.
+func checkServer(ctx context.Context, client command.StatsServiceClient, reset bool) (serverStatus, error) {
+	var st serverStatus
+	sys, err := client.GetSysStats(ctx, &command.SysStatsRequest{})
+	if err != nil {
+		return st, fmt.Errorf("the stats API doesn't answer: %w", err)
+	}
+	st.Uptime = time.Duration(sys.Uptime) * time.Second
+	st.Goroutines = sys.NumGoroutine
+	st.Memory = sys.Alloc
+
+	stats, err := client.QueryStats(ctx, &command.QueryStatsRequest{Reset_: reset})
+	if err != nil {
+		return st, fmt.Errorf("could not query the traffic: %w", err)
+	}
+	users := make(map[string]*traffic)
+	inbounds := make(map[string]*traffic)
+	for _, s := range stats.Stat {
+		// e.g. user>>>alice@example.com>>>traffic>>>uplink
+		parts := strings.Split(s.Name, ">>>")
+		if len(parts) != 4 || parts[2] != "traffic" {
+			continue
+		}
+		var byName map[string]*traffic
+		switch parts[0] {
+		case "user":
+			byName = users
+		case "inbound":
+			byName = inbounds
+		default:
+			continue
+		}
+		t, ok := byName[parts[1]]
+		if !ok {
+			t = &traffic{Name: parts[1]}
+			byName[parts[1]] = t
+		}
+		switch parts[3] {
+		case "uplink":
+			t.Up = s.Value
+		case "downlink":
+			t.Down = s.Value
+		}
+	}
+
+	online, err := client.GetAllOnlineUsers(ctx, &command.GetAllOnlineUsersRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		// Older servers can't list the users online.
+	case err != nil:
+		return st, fmt.Errorf("could not list the online users: %w", err)
+	default:
+		st.Online = []string{}
+		for _, name := range online.Users {
+			// e.g. user>>>alice@example.com>>>online
+			user := strings.TrimSuffix(strings.TrimPrefix(name, "user>>>"), ">>>online")
+			st.Online = append(st.Online, user)
+			t, ok := users[user]
+			if !ok {
+				t = &traffic{Name: user}
+				users[user] = t
+			}
+			if count, err := client.GetStatsOnline(ctx, &command.GetStatsRequest{Name: name}); err == nil {
+				t.OnlineIPs = count.Stat.GetValue()
+			}
+		}
+		sort.Strings(st.Online)
+	}
+
+	st.Users = sortedTraffic(users)
+	st.Inbounds = sortedTraffic(inbounds)
+	return st, nil
+}
+
+// sortedTraffic returns the traffic in byName, the busiest first.
+func sortedTraffic(byName map[string]*traffic) []traffic {
+	list := make([]traffic, 0, len(byName))
+	for _, t := range byName {
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].Up+list[i].Down, list[j].Up+list[j].Down
+		if a != b {
+			return a > b
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func printStatus(addr string, st serverStatus) {
+	label := func(key string) string { return customlog.GetColor(customlog.Label, key) }
+	fmt.Printf("%s: %s\n", label("Server"), addr)
+	fmt.Printf("%s: %s\n", label("Uptime"), formatUptime(st.Uptime))
+	fmt.Printf("%s: %s allocated, %d goroutines\n", label("Memory"), formatBytes(int64(st.Memory)), st.Goroutines)
+	if st.Online == nil {
+		fmt.Printf("%s: unknown, the server is too old to list them\n", label("Online users"))
+	} else {
+		fmt.Printf("%s: %d\n", label("Online users"), len(st.Online))
+	}
+
+	if len(st.Inbounds) > 0 {
+		fmt.Println()
+		w := utils.NewTableWriter(os.Stdout, 3, 0)
+		fmt.Fprintln(w, "INBOUND\tUP\tDOWN\tTOTAL")
+		for _, t := range st.Inbounds {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, formatBytes(t.Up), formatBytes(t.Down), formatBytes(t.Up+t.Down))
+		}
+		w.Flush()
+	}
+
+	fmt.Println()
+	if len(st.Users) == 0 {
+		customlog.Printf(customlog.Info, "No per-user traffic: enable statsUserUplink and statsUserDownlink in the policy of the server\n")
+		return
+	}
+	w := utils.NewTableWriter(os.Stdout, 3, 0)
+	fmt.Fprintln(w, "USER\tUP\tDOWN\tTOTAL\tONLINE")
+	for _, t := range st.Users {
+		online := "-"
+		if t.OnlineIPs > 0 {
+			online = fmt.Sprintf("%d IPs", t.OnlineIPs)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Name, formatBytes(t.Up), formatBytes(t.Down), formatBytes(t.Up+t.Down), online)
+	}
+	w.Flush()
+}
+
+// formatUptime prints d in days, hours and minutes.
+func formatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	d -= time.Duration(days) * 24 * time.Hour
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, int(d.Hours()), int(d.Minutes())%60)
+	}
+	return d.Truncate(time.Second).String()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/app/stats/command"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStats answers like an xray server with two users, one of them online.
+type fakeStats struct {
+	command.UnimplementedStatsServiceServer
+	online bool
+	token  string // authorization header of the last call
+	reset  bool
+}
+
+func (f *fakeStats) GetSysStats(ctx context.Context, _ *command.SysStatsRequest) (*command.SysStatsResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) > 0 {
+		f.token = v[0]
+	}
+	return &command.SysStatsResponse{Uptime: 90061, NumGoroutine: 42, Alloc: 8 << 20}, nil
+}
+
+func (f *fakeStats) QueryStats(_ context.Context, req *command.QueryStatsRequest) (*command.QueryStatsResponse, error) {
+	f.reset = req.Reset_
+	return &command.QueryStatsResponse{Stat: []*command.Stat{
+		{Name: "user>>>alice@example.com>>>traffic>>>uplink", Value: 100},
+		{Name: "user>>>alice@example.com>>>traffic>>>downlink", Value: 900},
+		{Name: "user>>>bob>>>traffic>>>downlink", Value: 5000},
+		{Name: "inbound>>>vless-in>>>traffic>>>uplink", Value: 100},
+		{Name: "inbound>>>api>>>traffic>>>downlink", Value: 7},
+		{Name: "outbound>>>direct>>>traffic>>>uplink", Value: 3},
+	}}, nil
+}
+
+func (f *fakeStats) GetAllOnlineUsers(context.Context, *command.GetAllOnlineUsersRequest) (*command.GetAllOnlineUsersResponse, error) {
+	if !f.online {
+		return nil, status.Error(codes.Unimplemented, "method GetAllOnlineUsers not implemented")
+	}
+	return &command.GetAllOnlineUsersResponse{Users: []string{"user>>>alice@example.com>>>online"}}, nil
+}
+
+func (f *fakeStats) GetStatsOnline(_ context.Context, req *command.GetStatsRequest) (*command.GetStatsResponse, error) {
+	return &command.GetStatsResponse{Stat: &command.Stat{Name: req.Name, Value: 2}}, nil
+}
+
+// startAPI serves the services register adds on a local port and returns its address.
+func startAPI(t *testing.T, register func(*grpc.Server)) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestCheckServer(t *testing.T) {
+	fake := &fakeStats{online: true}
+	addr := startAPI(t, func(srv *grpc.Server) { command.RegisterStatsServiceServer(srv, fake) })
+	conn, err := dial(addr, &apiConfig{Token: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	st, err := checkServer(ctx, command.NewStatsServiceClient(conn), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Uptime != 25*time.Hour+time.Minute+time.Second || st.Goroutines != 42 || !fake.reset || fake.token != "Bearer s3cret" {
+		t.Errorf("status = %+v, reset %v, token %q", st, fake.reset, fake.token)
+	}
+	if len(st.Users) != 2 || st.Users[0].Name != "bob" || st.Users[1].Up != 100 || st.Users[1].Down != 900 || st.Users[1].OnlineIPs != 2 {
+		t.Errorf("users = %+v, want bob first, then alice online from 2 IPs", st.Users)
+	}
+	if len(st.Inbounds) != 2 || st.Inbounds[0].Name != "vless-in" {
+		t.Errorf("inbounds = %+v", st.Inbounds)
+	}
+	if len(st.Online) != 1 || st.Online[0] != "alice@example.com" {
+		t.Errorf("online = %v", st.Online)
+	}
+
+	// A server that can't list online users still reports the traffic.
+	fake.online = false
+	st, err = checkServer(ctx, command.NewStatsServiceClient(conn), false)
+	if err != nil || st.Online != nil || len(st.Users) != 2 {
+		t.Errorf("old server: %+v, %v", st, err)
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		90 * time.Second:                 "1m30s",
+		49*time.Hour + 5*time.Minute + 7: "2d 1h 5m",
+	} {
+		if got := formatUptime(d); got != want {
+			t.Errorf("formatUptime(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
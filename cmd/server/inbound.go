@@ -0,0 +1,256 @@
+package server
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/xtls/xray-core/app/proxyman"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/proxy/trojan"
+	"github.com/xtls/xray-core/proxy/vless"
+	vlessinbound "github.com/xtls/xray-core/proxy/vless/inbound"
+	"github.com/xtls/xray-core/proxy/vmess"
+	vmessinbound "github.com/xtls/xray-core/proxy/vmess/inbound"
+	"github.com/xtls/xray-core/transport/internet"
+	"github.com/xtls/xray-core/transport/internet/grpc"
+	"github.com/xtls/xray-core/transport/internet/httpupgrade"
+	"github.com/xtls/xray-core/transport/internet/reality"
+	"github.com/xtls/xray-core/transport/internet/splithttp"
+	"github.com/xtls/xray-core/transport/internet/tls"
+	"github.com/xtls/xray-core/transport/internet/websocket"
+)
+
+// inbound is what a share link of a user needs from an inbound of the server.
+type inbound struct {
+	Tag      string
+	Protocol string // vless, vmess, trojan
+	Port     uint32
+	// Network is the transport as links name it: tcp, ws, grpc, httpupgrade,
+	// xhttp or kcp.
+	Network     string
+	Host        string
+	Path        string
+	ServiceName string
+	Mode        string // of xhttp
+	Security    string // none, tls, reality
+	SNI         string
+	PublicKey   string // of reality, base64url
+	ShortID     string // of reality, hex
+}
+
+// transportNames maps the transport names of xray to those of share links.
+var transportNames = map[string]string{
+	"tcp":         "tcp",
+	"websocket":   "ws",
+	"grpc":        "grpc",
+	"httpupgrade": "httpupgrade",
+	"splithttp":   "xhttp",
+	"mkcp":        "kcp",
+}
+
+// parseInbound reads an inbound as the API lists it.
+func parseInbound(cfg *core.InboundHandlerConfig) (inbound, error) {
+	in := inbound{Tag: cfg.Tag, Network: "tcp", Security: "none"}
+	proxy, err := instance(cfg.ProxySettings)
+	if err != nil {
+		return in, err
+	}
+	switch proxy.(type) {
+	case *vlessinbound.Config:
+		in.Protocol = "vless"
+	case *vmessinbound.Config:
+		in.Protocol = "vmess"
+	case *trojan.ServerConfig:
+		in.Protocol = "trojan"
+	default:
+		return in, fmt.Errorf("inbound %s is %s, only vless, vmess and trojan users can be managed", cfg.Tag, cfg.ProxySettings.GetType())
+	}
+
+	receiver, err := instance(cfg.ReceiverSettings)
+	if err != nil {
+		return in, err
+	}
+	rc, ok := receiver.(*proxyman.ReceiverConfig)
+	if !ok {
+		return in, fmt.Errorf("inbound %s has no receiver settings", cfg.Tag)
+	}
+	if ranges := rc.GetPortList().GetRange(); len(ranges) > 0 {
+		in.Port = ranges[0].From
+	}
+	if err := in.readStream(rc.StreamSettings); err != nil {
+		return in, fmt.Errorf("inbound %s: %w", cfg.Tag, err)
+	}
+	return in, nil
+}
+
+// readStream reads the transport and security settings of an inbound.
+func (in *inbound) readStream(stream *internet.StreamConfig) error {
+	if stream == nil {
+		return nil
+	}
+	if stream.ProtocolName != "" {
+		name, ok := transportNames[stream.ProtocolName]
+		if !ok {
+			return fmt.Errorf("transport %s is not supported in share links", stream.ProtocolName)
+		}
+		in.Network = name
+	}
+	for _, t := range stream.TransportSettings {
+		if t.ProtocolName != "" && t.ProtocolName != stream.ProtocolName {
+			continue
+		}
+		settings, err := instance(t.Settings)
+		if err != nil {
+			return err
+		}
+		switch s := settings.(type) {
+		case *websocket.Config:
+			in.Host, in.Path = s.Host, s.Path
+		case *httpupgrade.Config:
+			in.Host, in.Path = s.Host, s.Path
+		case *splithttp.Config:
+			in.Host, in.Path, in.Mode = s.Host, s.Path, s.Mode
+		case *grpc.Config:
+			in.ServiceName = s.ServiceName
+		}
+	}
+
+	for _, tm := range stream.SecuritySettings {
+		if tm.GetType() != stream.SecurityType {
+			continue
+		}
+		settings, err := instance(tm)
+		if err != nil {
+			return err
+		}
+		switch s := settings.(type) {
+		case *tls.Config:
+			in.Security = "tls"
+			in.SNI = s.ServerName
+		case *reality.Config:
+			in.Security = "reality"
+			if len(s.ServerNames) > 0 {
+				in.SNI = s.ServerNames[0]
+			}
+			if len(s.ShortIds) > 0 {
+				in.ShortID = hex.EncodeToString(s.ShortIds[0])
+			}
+			key, err := ecdh.X25519().NewPrivateKey(s.PrivateKey)
+			if err != nil {
+				return fmt.Errorf("invalid REALITY private key: %w", err)
+			}
+			in.PublicKey = base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+		}
+	}
+	return nil
+}
+
+func instance(tm *serial.TypedMessage) (any, error) {
+	if tm == nil {
+		return nil, nil
+	}
+	msg, err := tm.GetInstance()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", tm.Type, err)
+	}
+	return msg, nil
+}
+
+// account is the credentials of a user of an inbound.
+type account struct {
+	Email string
+	ID    string // UUID of vless and vmess, password of trojan
+	Flow  string // of vless
+}
+
+// typed returns a as the user the API adds to an inbound of proto.
+func (a account) typed(proto string, level uint32) *protocol.User {
+	u := &protocol.User{Email: a.Email, Level: level}
+	switch proto {
+	case "vless":
+		u.Account = serial.ToTypedMessage(&vless.Account{Id: a.ID, Flow: a.Flow, Encryption: "none"})
+	case "vmess":
+		u.Account = serial.ToTypedMessage(&vmess.Account{Id: a.ID})
+	case "trojan":
+		u.Account = serial.ToTypedMessage(&trojan.Account{Password: a.ID})
+	}
+	return u
+}
+
+// accountOf reads the credentials of a user listed by the API.
+func accountOf(u *protocol.User) account {
+	a := account{Email: u.Email}
+	msg, err := instance(u.Account)
+	if err != nil {
+		return a
+	}
+	switch acc := msg.(type) {
+	case *vless.Account:
+		a.ID, a.Flow = acc.Id, acc.Flow
+	case *vmess.Account:
+		a.ID = acc.Id
+	case *trojan.Account:
+		a.ID = acc.Password
+	}
+	return a
+}
+
+// link returns the share link of a on in, reached at host, named remark.
+func (in inbound) link(host string, a account, remark string) string {
+	if in.Protocol == "vmess" {
+		fields := map[string]string{
+			"v": "2", "ps": remark, "add": host, "port": strconv.Itoa(int(in.Port)),
+			"id": a.ID, "aid": "0", "scy": "auto", "net": in.Network, "type": "none",
+			"host": in.Host, "path": in.Path, "tls": "", "sni": in.SNI,
+		}
+		if in.Network == "grpc" {
+			fields["path"] = in.ServiceName
+		}
+		if in.Security == "tls" {
+			fields["tls"] = "tls"
+		}
+		data, _ := json.Marshal(fields)
+		return "vmess://" + base64.StdEncoding.EncodeToString(data)
+	}
+
+	q := url.Values{}
+	q.Set("type", in.Network)
+	q.Set("security", in.Security)
+	if in.Protocol == "vless" {
+		q.Set("encryption", "none")
+		if a.Flow != "" {
+			q.Set("flow", a.Flow)
+		}
+	}
+	set := func(key, value string) {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	set("host", in.Host)
+	set("path", in.Path)
+	set("serviceName", in.ServiceName)
+	set("mode", in.Mode)
+	set("sni", in.SNI)
+	if in.Security == "reality" {
+		q.Set("pbk", in.PublicKey)
+		q.Set("sid", in.ShortID)
+		q.Set("fp", "chrome")
+	}
+	u := url.URL{
+		Scheme:   in.Protocol,
+		User:     url.User(a.ID),
+		Host:     net.JoinHostPort(host, strconv.Itoa(int(in.Port))),
+		RawQuery: q.Encode(),
+		Fragment: remark,
+	}
+	return u.String()
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// ServerCmd groups the tools for people running their own xray servers.
+var ServerCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Tools for operators of xray servers (e.g., checking a server through its stats API)",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	ServerCmd.AddCommand(newCheckCommand(), newUserCommand())
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/common/uuid"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// userConfig holds the flags of the 'server user' commands.
+type userConfig struct {
+	api     apiConfig
+	Inbound string
+	Host    string
+}
+
+// addUserFlags adds the flags every 'server user' command has.
+func addUserFlags(cmd *cobra.Command, cfg *userConfig) {
+	addAPIFlags(cmd, &cfg.api)
+	cmd.Flags().StringVarP(&cfg.Inbound, "inbound", "i", "", "Tag of the inbound the users belong to")
+	cmd.MarkFlagRequired("inbound")
+}
+
+func newUserCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Adds, removes and lists the users of an inbound of a running xray server",
+		Long: `Manages the users of a VLESS, VMess or Trojan inbound of a running xray server
+through its gRPC API, which needs the HandlerService:
+
+  "api": { "tag": "api", "listen": "127.0.0.1:10085", "services": ["HandlerService", "StatsService"] }
+
+Users added through the API live until xray restarts; add them to the config
+file of the server too to keep them. The share links printed for them are
+built from the settings of the inbound (port, transport, TLS or REALITY) and
+--host, the address clients reach the server at.
+
+The connection flags (--tls, --token, ...) are those of 'server check'.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(newUserAddCommand(), newUserRmCommand(), newUserListCommand())
+	return cmd
+}
+
+func newUserAddCommand() *cobra.Command {
+	cfg := &userConfig{}
+	var (
+		a      account
+		level  uint32
+		remark string
+		saveDB bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add ADDRESS",
+		Short: "Adds a user to an inbound and prints its share link",
+		Long: `Adds a user to the inbound --inbound of the xray server whose API is at ADDRESS
+and prints the share link of the user. The UUID (VLESS, VMess) or password
+(Trojan) is generated unless --id gives it. --save-db stores the link in the
+database, to test it or hand it out in a subscription.
+
+Examples:
+  xray-knife server user add 127.0.0.1:10085 -i vless-in --email alice --host vpn.example.com
+  xray-knife server user add 127.0.0.1:10085 -i vless-in --email bob --flow xtls-rprx-vision --host vpn.example.com --save-db
+  xray-knife server user add 127.0.0.1:10085 -i trojan-in --email carol --id s3cret --host vpn.example.com`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host, err := linkHost(args[0], cfg.Host)
+			if err != nil {
+				return err
+			}
+			conn, err := dial(args[0], &cfg.api)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), cfg.api.Timeout)
+			defer cancel()
+			client := command.NewHandlerServiceClient(conn)
+
+			in, err := findInbound(ctx, client, cfg.Inbound)
+			if err != nil {
+				return err
+			}
+			if a.Flow != "" && in.Protocol != "vless" {
+				return fmt.Errorf("--flow is only for vless, inbound %s is %s", in.Tag, in.Protocol)
+			}
+			if a.ID == "" {
+				a.ID = newSecret(in.Protocol)
+			}
+			_, err = client.AlterInbound(ctx, &command.AlterInboundRequest{
+				Tag:       in.Tag,
+				Operation: serial.ToTypedMessage(&command.AddUserOperation{User: a.typed(in.Protocol, level)}),
+			})
+			if err != nil {
+				return fmt.Errorf("could not add %s to %s: %w", a.Email, in.Tag, err)
+			}
+
+			if remark == "" {
+				remark = a.Email
+			}
+			link := in.link(host, a, remark)
+			customlog.Printf(customlog.Success, "Added %s to %s\n", a.Email, in.Tag)
+			fmt.Println(link)
+			if saveDB {
+				if _, err := subs.SaveLinks(core.NewAutomaticCore(false, false), []string{link}, 1); err != nil {
+					return err
+				}
+				customlog.Printf(customlog.Info, "Saved the link to the database\n")
+			}
+			return nil
+		},
+	}
+
+	addUserFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.Host, "host", "", "Address clients reach the server at (default the host of ADDRESS, unless it is a loopback address)")
+	flags.StringVar(&a.Email, "email", "", "Email of the user, which names it on the server")
+	flags.StringVar(&a.ID, "id", "", "UUID (vless, vmess) or password (trojan) of the user (default generated)")
+	flags.StringVar(&a.Flow, "flow", "", "Flow of a vless user, e.g. xtls-rprx-vision")
+	flags.Uint32Var(&level, "level", 0, "Policy level of the user")
+	flags.StringVar(&remark, "remark", "", "Remark of the share link (default the email)")
+	flags.BoolVar(&saveDB, "save-db", false, "Also store the share link in the database")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func newUserRmCommand() *cobra.Command {
+	cfg := &userConfig{}
+	var email string
+
+	cmd := &cobra.Command{
+		Use:   "rm ADDRESS",
+		Short: "Removes a user from an inbound",
+		Long: `Removes the user --email from the inbound --inbound of the xray server whose
+API is at ADDRESS. Its connections are cut once they close.
+
+Examples:
+  xray-knife server user rm 127.0.0.1:10085 -i vless-in --email alice`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, err := dial(args[0], &cfg.api)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), cfg.api.Timeout)
+			defer cancel()
+
+			_, err = command.NewHandlerServiceClient(conn).AlterInbound(ctx, &command.AlterInboundRequest{
+				Tag:       cfg.Inbound,
+				Operation: serial.ToTypedMessage(&command.RemoveUserOperation{Email: email}),
+			})
+			if err != nil {
+				return fmt.Errorf("could not remove %s from %s: %w", email, cfg.Inbound, err)
+			}
+			customlog.Printf(customlog.Success, "Removed %s from %s\n", email, cfg.Inbound)
+			return nil
+		},
+	}
+
+	addUserFlags(cmd, cfg)
+	cmd.Flags().StringVar(&email, "email", "", "Email of the user to remove")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func newUserListCommand() *cobra.Command {
+	cfg := &userConfig{}
+	var links bool
+
+	cmd := &cobra.Command{
+		Use:   "list ADDRESS",
+		Short: "Lists the users of an inbound",
+		Long: `Lists the users of the inbound --inbound of the xray server whose API is at
+ADDRESS, or with --links prints their share links.
+
+Examples:
+  xray-knife server user list 127.0.0.1:10085 -i vless-in
+  xray-knife server user list 127.0.0.1:10085 -i vless-in --links --host vpn.example.com > users.txt`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host := ""
+			if links {
+				var err error
+				if host, err = linkHost(args[0], cfg.Host); err != nil {
+					return err
+				}
+			}
+			conn, err := dial(args[0], &cfg.api)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), cfg.api.Timeout)
+			defer cancel()
+			client := command.NewHandlerServiceClient(conn)
+
+			in, err := findInbound(ctx, client, cfg.Inbound)
+			if err != nil {
+				return err
+			}
+			resp, err := client.GetInboundUsers(ctx, &command.GetInboundUserRequest{Tag: in.Tag})
+			if err != nil {
+				return fmt.Errorf("could not list the users of %s: %w", in.Tag, err)
+			}
+
+			if links {
+				for _, u := range resp.Users {
+					a := accountOf(u)
+					fmt.Println(in.link(host, a, a.Email))
+				}
+				return nil
+			}
+			if len(resp.Users) == 0 {
+				fmt.Printf("Inbound %s has no users.\n", in.Tag)
+				return nil
+			}
+			w := utils.NewTableWriter(os.Stdout, 3, 0)
+			fmt.Fprintln(w, "EMAIL\tID\tFLOW\tLEVEL")
+			fmt.Fprintln(w, "-----\t--\t----\t-----")
+			for _, u := range resp.Users {
+				a := accountOf(u)
+				flow := a.Flow
+				if flow == "" {
+					flow = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", a.Email, a.ID, flow, u.Level)
+			}
+			return w.Flush()
+		},
+	}
+
+	addUserFlags(cmd, cfg)
+	cmd.Flags().BoolVar(&links, "links", false, "Print the share links of the users")
+	cmd.Flags().StringVar(&cfg.Host, "host", "", "With --links, the address clients reach the server at (default the host of ADDRESS, unless it is a loopback address)")
+	return cmd
+}
+
+// findInbound returns the inbound tagged tag.
+func findInbound(ctx context.Context, client command.HandlerServiceClient, tag string) (inbound, error) {
+	resp, err := client.ListInbounds(ctx, &command.ListInboundsRequest{})
+	if err != nil {
+		return inbound{}, fmt.Errorf("could not list the inbounds: %w", err)
+	}
+	var tags []string
+	for _, cfg := range resp.Inbounds {
+		if cfg.Tag == tag {
+			return parseInbound(cfg)
+		}
+		if cfg.Tag != "" {
+			tags = append(tags, cfg.Tag)
+		}
+	}
+	return inbound{}, fmt.Errorf("no inbound tagged %q (the server has %v)", tag, tags)
+}
+
+// linkHost returns the address share links point to: host, else the host of
+// the API address when clients can reach it.
+func linkHost(apiAddr, host string) (string, error) {
+	if host != "" {
+		return host, nil
+	}
+	h, _, err := net.SplitHostPort(apiAddr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", apiAddr, err)
+	}
+	if ip := net.ParseIP(h); h == "localhost" || (ip != nil && (ip.IsLoopback() || ip.IsUnspecified())) {
+		return "", fmt.Errorf("the API is at %s, give --host, the address clients reach the server at", h)
+	}
+	return h, nil
+}
+
+// newSecret returns a new UUID for vless and vmess, or a password for trojan.
+func newSecret(proto string) string {
+	if proto == "trojan" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		return hex.EncodeToString(b)
+	}
+	id := uuid.New()
+	return id.String()
+}
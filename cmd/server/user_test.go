@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/app/proxyman"
+	"github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/proxy/trojan"
+	"github.com/xtls/xray-core/proxy/vless"
+	vlessinbound "github.com/xtls/xray-core/proxy/vless/inbound"
+	"github.com/xtls/xray-core/transport/internet"
+	"github.com/xtls/xray-core/transport/internet/reality"
+	"github.com/xtls/xray-core/transport/internet/websocket"
+	"google.golang.org/grpc"
+
+	pkgcore "github.com/lilendian0x00/xray-knife/v9/pkg/core"
+)
+
+var realityKey = make([]byte, 32)
+
+func init() {
+	realityKey[0] = 1
+}
+
+// vlessInbound is a VLESS over WebSocket inbound with REALITY.
+func vlessInbound(tag string) *core.InboundHandlerConfig {
+	stream := &internet.StreamConfig{
+		ProtocolName: "websocket",
+		TransportSettings: []*internet.TransportConfig{{
+			ProtocolName: "websocket",
+			Settings:     serial.ToTypedMessage(&websocket.Config{Path: "/ws", Host: "cdn.example.com"}),
+		}},
+		SecurityType: serial.GetMessageType(&reality.Config{}),
+		SecuritySettings: []*serial.TypedMessage{serial.ToTypedMessage(&reality.Config{
+			ServerNames: []string{"www.example.org"},
+			PrivateKey:  realityKey,
+			ShortIds:    [][]byte{{0xab, 0xcd}},
+		})},
+	}
+	return &core.InboundHandlerConfig{
+		Tag: tag,
+		ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+			PortList:       &net.PortList{Range: []*net.PortRange{{From: 8443, To: 8443}}},
+			StreamSettings: stream,
+		}),
+		ProxySettings: serial.ToTypedMessage(&vlessinbound.Config{}),
+	}
+}
+
+func TestInboundLink(t *testing.T) {
+	in, err := parseInbound(vlessInbound("vless-in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _ := ecdh.X25519().NewPrivateKey(realityKey)
+	if in.Protocol != "vless" || in.Port != 8443 || in.Network != "ws" || in.Path != "/ws" || in.Security != "reality" ||
+		in.SNI != "www.example.org" || in.ShortID != "abcd" || in.PublicKey != base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()) {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	link := in.link("vpn.example.com", account{ID: "d342d11e-d424-4583-b36e-524ab1f0afa4", Flow: "xtls-rprx-vision"}, "alice 1")
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Host != "vpn.example.com:8443" || q.Get("type") != "ws" || q.Get("pbk") != in.PublicKey || q.Get("flow") != "xtls-rprx-vision" || u.Fragment != "alice 1" {
+		t.Errorf("link = %s", link)
+	}
+	p, err := pkgcore.NewAutomaticCore(false, false).CreateProtocol(link)
+	if err == nil {
+		err = p.Parse()
+	}
+	if err != nil {
+		t.Errorf("link %s does not parse: %v", link, err)
+	}
+
+	in.Protocol = "vmess"
+	if link := in.link("vpn.example.com", account{ID: "d342d11e-d424-4583-b36e-524ab1f0afa4"}, "bob"); !strings.HasPrefix(link, "vmess://") {
+		t.Errorf("vmess link = %s", link)
+	}
+}
+
+// fakeHandler keeps the users added to one VLESS inbound.
+type fakeHandler struct {
+	command.UnimplementedHandlerServiceServer
+	users []*protocol.User
+}
+
+func (f *fakeHandler) ListInbounds(context.Context, *command.ListInboundsRequest) (*command.ListInboundsResponse, error) {
+	return &command.ListInboundsResponse{Inbounds: []*core.InboundHandlerConfig{vlessInbound("vless-in")}}, nil
+}
+
+func (f *fakeHandler) AlterInbound(_ context.Context, req *command.AlterInboundRequest) (*command.AlterInboundResponse, error) {
+	op, err := req.Operation.GetInstance()
+	if err != nil {
+		return nil, err
+	}
+	if add, ok := op.(*command.AddUserOperation); ok {
+		f.users = append(f.users, add.User)
+	}
+	return &command.AlterInboundResponse{}, nil
+}
+
+func TestUserAdd(t *testing.T) {
+	fake := &fakeHandler{}
+	addr := startAPI(t, func(srv *grpc.Server) { command.RegisterHandlerServiceServer(srv, fake) })
+
+	cmd := newUserAddCommand()
+	cmd.SetArgs([]string{addr, "-i", "vless-in", "--email", "alice", "--host", "vpn.example.com"})
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.users) != 1 || fake.users[0].Email != "alice" {
+		t.Fatalf("users = %v", fake.users)
+	}
+	acc := accountOf(fake.users[0])
+	if msg, _ := fake.users[0].Account.GetInstance(); msg == nil {
+		t.Fatal("user has no account")
+	} else if _, ok := msg.(*vless.Account); !ok || len(acc.ID) != 36 {
+		t.Errorf("account = %T %+v, want a vless account with a generated UUID", msg, acc)
+	}
+
+	cmd = newUserAddCommand()
+	cmd.SilenceErrors = true
+	cmd.SetArgs([]string{"127.0.0.1:1", "-i", "vless-in", "--email", "bob"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--host") {
+		t.Errorf("loopback API without --host: err = %v", err)
+	}
+}
+
+func TestAccountRoundTrip(t *testing.T) {
+	a := account{Email: "carol", ID: "s3cret"}
+	if got := accountOf(a.typed("trojan", 0)); got != a {
+		t.Errorf("trojan account = %+v, want %+v", got, a)
+	}
+	if msg, _ := a.typed("trojan", 0).Account.GetInstance(); msg.(*trojan.Account).Password != "s3cret" {
+		t.Errorf("trojan account = %v", msg)
+	}
+}
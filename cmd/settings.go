@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/cmd/subs"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/settings"
+	"github.com/spf13/cobra"
+)
+
+// testCommands are the commands that test configs, which the test.* settings
+// apply to.
+var testCommands = map[string]bool{
+	"http":          true,
+	"test":          true,
+	"http daemon":   true,
+	"http compare":  true,
+	"bot":           true,
+	"proxy monitor": true,
+}
+
+// applySettings makes the settings of the config file the defaults of the
+// flags of cmd. Flags given on the command line win.
+func applySettings(cmd *cobra.Command, s settings.Settings) error {
+	path := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	set := func(flag, value string) error {
+		f := cmd.Flags().Lookup(flag)
+		if f == nil || f.Changed || value == "" {
+			return nil
+		}
+		return f.Value.Set(value)
+	}
+
+	core := s.Core
+	if path == "proxy" {
+		// The proxy names sing-box differently and has no automatic choice.
+		switch core {
+		case "singbox":
+			core = "sing-box"
+		case "auto":
+			core = ""
+		}
+	}
+	if err := set("core", core); err != nil {
+		return err
+	}
+
+	// Set for every command: the web UI and API fetch subscriptions too.
+	if s.FetchMaxWorkers != 0 {
+		subs.MaxWorkers = s.FetchMaxWorkers
+	}
+	if path == "subs fetch" {
+		if s.FetchDelayPerHost != 0 {
+			if err := set("delay-per-host", s.FetchDelayPerHost.String()); err != nil {
+				return err
+			}
+		}
+		return set("per-host", s.FetchPerHost)
+	}
+
+	if !testCommands[path] {
+		return nil
+	}
+	if err := set("url", s.TestURL); err != nil {
+		return err
+	}
+	if err := set("geo-url", s.GeoURLs); err != nil {
+		return err
+	}
+	if err := set("ip-providers", s.IPInfoProviders); err != nil {
+		return err
+	}
+	if err := set("ipinfo-token", s.IPInfoToken); err != nil {
+		return err
+	}
+	if s.MaxDelay != 0 {
+		if err := set("mdelay", strconv.Itoa(int(s.MaxDelay))); err != nil {
+			return err
+		}
+	}
+	// The probe timeout of 'proxy monitor' has its own meaning and default.
+	if s.Timeout != 0 && path != "proxy monitor" {
+		return set("timeout", strconv.Itoa(int(s.Timeout)))
+	}
+	return nil
+}
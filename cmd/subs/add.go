@@ -2,7 +2,7 @@ package subs
 
 import (
 	"fmt"
-	"net/url"
+	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/database"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
@@ -13,6 +13,14 @@ var (
 	addURL       string
 	addRemark    string
 	addUserAgent string
+	addAuth      authFlags
+	addSelector  string
+	addPattern   string
+	addTelegram  string
+	addImperson  string
+	addMirrors   []string
+	addRace      bool
+	addExclude   []string
 )
 
 // AddCmd adds a new subscription to the DB.
@@ -22,27 +30,141 @@ var AddCmd = &cobra.Command{
 	Long: `Adds a new subscription URL to the local database.
 The subscription can later be fetched with 'subs fetch --id <ID>'.
 
+Besides http(s) URLs, a local file holding a subscription body (base64 or one link
+per line) can be added as a path or a file:// URL. It is stored as an absolute
+file:// URL and read again on every fetch, so lists shared as files stay in sync.
+
+Private panels that need an Authorization header, basic auth or a session cookie
+can be given them with --header, --basic-auth and --cookie. They are stored
+encrypted with a key kept in secret.key next to the database and sent on every fetch.
+
+A URL serving an HTML page, like the web preview of a public Telegram channel,
+has its config links scraped from the page. --html-selector narrows the search
+to the elements holding them and --html-pattern sets the regex that matches a
+link (its first group, if it has one).
+
+Providers often publish the same subscription on several mirrors. Add them to a
+single subscription with --mirror instead of one subscription each, which only
+fetches the same configs twice: a fetch tries the URL first and the mirrors in
+order after it. With --race-mirrors all of them are requested at once and the
+first to answer is read. 'subs show --verbose' shows which one served the last
+fetch.
+
+--exclude drops the links of the subscription a rule matches on every fetch, so
+recurring provider junk like traffic and expiry notices never enters the DB. A
+rule reads "field op value" with field one of remark, link, protocol, address
+and port: with ~ and !~ the value is a regular expression the field matches or
+not, with = and != a comma-separated list of values it equals or not. A link is
+dropped when any rule matches it.
+
+--telegram adds a public Telegram channel instead of a URL. Every fetch reads the
+latest pages of its web preview (t.me/s/<channel>, see 'subs fetch
+--telegram-pages') and collects the config links posted in its messages.
+
 Examples:
   xray-knife subs add --url "https://example.com/sub"
-  xray-knife subs add --url "https://example.com/sub" --remark "My VPN" --user-agent "clash"`,
+  xray-knife subs add --url "https://example.com/sub" --remark "My VPN" --user-agent "clash"
+  xray-knife subs add --url ./shared-list.txt --remark "Offline list"
+  xray-knife subs add --url file:///home/me/lists/friends.txt
+  xray-knife subs add --url "https://panel.example.com/sub" -H "Authorization: Bearer s3cret"
+  xray-knife subs add --url "https://example.com/sub" --basic-auth me:pass --cookie "session=abc"
+  xray-knife subs add --url "https://example.com/sub" --mirror "https://mirror.example.net/sub" --mirror "https://cdn.example.org/sub"
+  xray-knife subs add --url "https://example.com/sub" --exclude "remark~剩余|到期|官网" --exclude "port!=443"
+  xray-knife subs add --telegram @somechannel
+  xray-knife subs add --url "https://example.com/blog" --html-pattern "<code>(vless://[^<]+)</code>"`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate URL before storing
-		if _, err := url.ParseRequestURI(addURL); err != nil {
-			return fmt.Errorf("invalid URL %q: %w", addURL, err)
+		var subURL string
+		var err error
+		if addTelegram != "" {
+			if subURL, err = TelegramChannelURL(addTelegram); err != nil {
+				return err
+			}
+			if addRemark == "" {
+				addRemark = "@" + strings.TrimPrefix(subURL, "https://t.me/s/")
+			}
+		} else if subURL, err = ResolveSubscriptionURL(addURL); err != nil {
+			// Validate URL before storing
+			return err
 		}
 
-		err := database.AddSubscription(addURL, addRemark, addUserAgent)
+		auth, err := addAuth.apply(cmd, database.SubscriptionAuth{})
 		if err != nil {
 			return err
 		}
-		customlog.Printf(customlog.Success, "Successfully added subscription: %s\n", addURL)
+		if !auth.IsZero() && IsLocalSubscription(subURL) {
+			return fmt.Errorf("--header, --basic-auth and --cookie don't apply to local subscriptions")
+		}
+
+		if _, err := newScrapeOptions(addSelector, addPattern); err != nil {
+			return err
+		}
+		if err := validateImpersonation(addImperson); err != nil {
+			return err
+		}
+		mirrors, err := resolveMirrors(subURL, addMirrors)
+		if err != nil {
+			return err
+		}
+		if addRace && len(mirrors) == 0 {
+			return fmt.Errorf("--race-mirrors needs at least one --mirror")
+		}
+		exclude, err := resolveExcludeRules(addExclude)
+		if err != nil {
+			return err
+		}
+
+		err = database.AddSubscription(subURL, addRemark, addUserAgent)
+		if err != nil {
+			return err
+		}
+		if !auth.IsZero() || addSelector != "" || addPattern != "" || addImperson != "" || len(mirrors) > 0 || len(exclude) > 0 {
+			sub, err := database.GetSubscriptionByURL(subURL)
+			if err != nil {
+				return err
+			}
+			if !auth.IsZero() {
+				if err := database.SetSubscriptionAuth(sub.ID, auth); err != nil {
+					return err
+				}
+			}
+			if addSelector != "" || addPattern != "" {
+				if err := database.SetSubscriptionScrape(sub.ID, addSelector, addPattern); err != nil {
+					return err
+				}
+			}
+			if addImperson != "" {
+				if err := database.SetSubscriptionImpersonate(sub.ID, addImperson); err != nil {
+					return err
+				}
+			}
+			if len(mirrors) > 0 {
+				if err := database.SetSubscriptionMirrors(sub.ID, mirrors, addRace); err != nil {
+					return err
+				}
+			}
+			if len(exclude) > 0 {
+				if err := database.SetSubscriptionExcludeRules(sub.ID, exclude); err != nil {
+					return err
+				}
+			}
+		}
+		customlog.Printf(customlog.Success, "Successfully added subscription: %s\n", subURL)
 		return nil
 	},
 }
 
 func init() {
-	AddCmd.Flags().StringVarP(&addURL, "url", "u", "", "URL of the subscription")
+	AddCmd.Flags().StringVarP(&addURL, "url", "u", "", "URL of the subscription, or a local file path")
+	AddCmd.Flags().StringVar(&addTelegram, "telegram", "", "Public Telegram channel to scrape for configs, e.g. @channel")
 	AddCmd.Flags().StringVarP(&addRemark, "remark", "r", "", "A memorable name for the subscription")
-	AddCmd.Flags().StringVarP(&addUserAgent, "user-agent", "a", "", "Custom User-Agent for fetching the subscription")
-	AddCmd.MarkFlagRequired("url")
+	AddCmd.Flags().StringVarP(&addUserAgent, "user-agent", "a", "", "Custom User-Agent or client preset ("+userAgentPresetNames()+") for fetching the subscription")
+	AddCmd.Flags().StringVar(&addImperson, "impersonate", "", "TLS fingerprint to fetch with: "+strings.Join(ImpersonationNames, ", ")+" (default chrome)")
+	addAuth.register(AddCmd, false)
+	AddCmd.Flags().StringVar(&addSelector, "html-selector", "", "CSS selector of the elements holding the links, for HTML pages")
+	AddCmd.Flags().StringVar(&addPattern, "html-pattern", "", "Regex matching the links, group 1 if any (default: known config schemes)")
+	AddCmd.Flags().StringArrayVar(&addMirrors, "mirror", nil, "Another URL serving the same subscription, tried when the URL fails (repeatable)")
+	AddCmd.Flags().BoolVar(&addRace, "race-mirrors", false, "Request the URL and all mirrors at once and read the first to answer")
+	AddCmd.Flags().StringArrayVar(&addExclude, "exclude", nil, "Drop the fetched links matching this rule, e.g. \"remark~expired\" or \"port!=443\" (repeatable)")
+	AddCmd.MarkFlagsOneRequired("url", "telegram")
+	AddCmd.MarkFlagsMutuallyExclusive("url", "telegram")
 }
@@ -0,0 +1,48 @@
+package subs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+// AliasCmd shows or renames the alias of a stored config.
+var AliasCmd = &cobra.Command{
+	Use:   "alias <config> [alias]",
+	Short: "Shows or sets the short alias of a stored config",
+	Long: `Every stored config gets a short alias when it is first saved, such as "de-1" for
+a remark starting with the German flag or "vless-12" otherwise. Unlike IDs, aliases
+stay the same while configs come and go, and they are accepted wherever a config
+ID or link is: 'xray-knife proxy --config de-1', 'xray-knife http -c de-1',
+'xray-knife subs note de-1' and so on.
+
+With only a config (ID or alias), its alias is printed. A second argument renames
+it; aliases are up to 32 lowercase letters, digits, '.', '_' and '-', and must be
+unique.
+
+Examples:
+  xray-knife subs alias 57
+  xray-knife subs alias de-1 fast-1`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := database.GetConfigByRef(args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			fmt.Println(config.Alias.String)
+			return nil
+		}
+
+		alias := strings.ToLower(strings.TrimSpace(args[1]))
+		if err := database.SetConfigAlias(config.ID, alias); err != nil {
+			return err
+		}
+		customlog.Printf(customlog.Success, "Config ID %d is now %q.\n", config.ID, alias)
+		return nil
+	},
+}
@@ -0,0 +1,101 @@
+package subs
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/spf13/cobra"
+)
+
+// authFlags are the flags setting the credentials of a private subscription.
+type authFlags struct {
+	headers   []string
+	basicAuth string
+	cookies   string
+	clear     bool
+}
+
+func (f *authFlags) register(cmd *cobra.Command, withClear bool) {
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&f.headers, "header", "H", nil, `Extra request header "Name: value" sent when fetching, e.g. "Authorization: Bearer ..." (repeatable)`)
+	flags.StringVar(&f.basicAuth, "basic-auth", "", "HTTP basic auth credentials as user:password")
+	flags.StringVar(&f.cookies, "cookie", "", `Cookies sent when fetching, e.g. "session=abc; lang=en"`)
+	if withClear {
+		flags.BoolVar(&f.clear, "clear-auth", false, "Remove the stored headers, basic auth and cookies")
+	}
+}
+
+// changed reports whether any credential flag was given.
+func (f *authFlags) changed(cmd *cobra.Command) bool {
+	for _, name := range []string{"header", "basic-auth", "cookie", "clear-auth"} {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply updates auth with the given flags: --clear-auth drops everything first,
+// then --header replaces all headers, --basic-auth and --cookie their part.
+func (f *authFlags) apply(cmd *cobra.Command, auth database.SubscriptionAuth) (database.SubscriptionAuth, error) {
+	if f.clear {
+		auth = database.SubscriptionAuth{}
+	}
+	if cmd.Flags().Changed("header") {
+		auth.Headers = nil
+		for _, h := range f.headers {
+			name, value, ok := strings.Cut(h, ":")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" || strings.ContainsAny(name, " \t") {
+				return auth, fmt.Errorf(`invalid --header %q, want "Name: value"`, h)
+			}
+			if strings.EqualFold(name, "Host") {
+				return auth, fmt.Errorf("--header cannot set Host")
+			}
+			if auth.Headers == nil {
+				auth.Headers = make(map[string]string)
+			}
+			auth.Headers[textproto.CanonicalMIMEHeaderKey(name)] = strings.TrimSpace(value)
+		}
+	}
+	if cmd.Flags().Changed("basic-auth") {
+		auth.Username, auth.Password = "", ""
+		if f.basicAuth != "" {
+			user, pass, ok := strings.Cut(f.basicAuth, ":")
+			if !ok || user == "" {
+				return auth, fmt.Errorf("invalid --basic-auth, want user:password")
+			}
+			auth.Username, auth.Password = user, pass
+		}
+	}
+	if cmd.Flags().Changed("cookie") {
+		auth.Cookies = strings.TrimSpace(f.cookies)
+	}
+	return auth, nil
+}
+
+// describeAuth names the kinds of credentials set, without their values.
+func describeAuth(auth database.SubscriptionAuth) string {
+	var kinds []string
+	if len(auth.Headers) > 0 {
+		names := make([]string, 0, len(auth.Headers))
+		for name := range auth.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		kinds = append(kinds, "headers ("+strings.Join(names, ", ")+")")
+	}
+	if auth.Username != "" {
+		kinds = append(kinds, "basic auth ("+auth.Username+")")
+	}
+	if auth.Cookies != "" {
+		kinds = append(kinds, "cookies")
+	}
+	if len(kinds) == 0 {
+		return "-"
+	}
+	return strings.Join(kinds, ", ")
+}
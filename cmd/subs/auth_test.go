@@ -0,0 +1,49 @@
+package subs
+
+import (
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/spf13/cobra"
+)
+
+func TestAuthFlagsApply(t *testing.T) {
+	parse := func(args ...string) (*cobra.Command, *authFlags) {
+		t.Helper()
+		var f authFlags
+		cmd := &cobra.Command{Use: "test"}
+		f.register(cmd, true)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd, &f
+	}
+	stored := database.SubscriptionAuth{Headers: map[string]string{"X-Old": "1"}, Username: "me", Password: "pw", Cookies: "a=b"}
+
+	cmd, f := parse("-H", "authorization: Bearer x", "-H", "X-Panel:  y ", "--cookie", "")
+	auth, err := f.apply(cmd, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.Headers) != 2 || auth.Headers["Authorization"] != "Bearer x" || auth.Headers["X-Panel"] != "y" {
+		t.Errorf("headers = %v", auth.Headers)
+	}
+	if auth.Username != "me" || auth.Cookies != "" {
+		t.Errorf("auth = %+v", auth)
+	}
+
+	cmd, f = parse("--clear-auth", "--basic-auth", "new:p:w")
+	if auth, err = f.apply(cmd, stored); err != nil {
+		t.Fatal(err)
+	}
+	if auth.Headers != nil || auth.Cookies != "" || auth.Username != "new" || auth.Password != "p:w" {
+		t.Errorf("auth = %+v", auth)
+	}
+
+	for _, args := range [][]string{{"-H", "no-colon"}, {"-H", "Host: evil"}, {"--basic-auth", "nopass"}} {
+		cmd, f := parse(args...)
+		if _, err := f.apply(cmd, stored); err == nil {
+			t.Errorf("%v was accepted", args)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package subs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bestTop     int
+	bestRuns    int
+	bestSubID   int64
+	bestWeights string
+	bestPreset  string
+	bestExplain bool
+	bestOut     string
+	bestHook    string
+)
+
+// rankedConfig is a config with its score over the recent test runs.
+type rankedConfig struct {
+	link     string
+	location string // exit country of the latest test
+	ip       string // exit IP of the latest test
+	score    score.Breakdown
+	note     string // why the scoring hook changed the score
+}
+
+// BestCmd ranks the tested configs by the weighted scoring formula.
+var BestCmd = &cobra.Command{
+	Use:   "best",
+	Short: "Ranks configs by a weighted score over their recent HTTP test history",
+	Long: `Ranks the configs tested by 'xray-knife http --save-db' over the last --runs
+test runs. Each config gets a score from 0 to 100, the weighted mean of:
+
+  latency  median delay of its passed tests
+  jitter   how much those delays vary
+  speed    mean download speed (needs 'http --speedtest')
+  streak   how many of the latest tests it passed in a row
+  age      how long ago it last passed
+
+The weights are read from ` + score.ConfigFileName + ` in the data directory, so the ranking can be
+tuned to the use case, e.g. for gaming:
+
+  score.latency = 0.5
+  score.jitter  = 0.3
+  score.speed   = 0
+  score.streak  = 0.2
+  score.age     = 0
+  score.runs    = 20
+
+or for streaming, where throughput matters more than a few milliseconds:
+
+  score.latency = 0.1
+  score.speed   = 0.6
+
+Factors left out keep their default weight (` + score.DefaultWeights().String() + `).
+--preset NAME ranks with the weights saved in a test preset ('test --save-preset'),
+and --weights overrides them for one run. --explain shows how each config's score was
+made up, to check that the weights do what you want.
+
+For rules the weights can't express, a scoring hook re-scores the ranking with your
+own logic: score.hook in the config file, or --hook for one run (--hook "" turns the
+configured one off), is a command reading the ranked configs as JSON on stdin:
+
+  {"weights": {"latency": 0.35, ...}, "configs": [{"link": "vless://...",
+   "score": 81.2, "factors": {...}, "median_delay_ms": 210, "jitter_ms": 12,
+   "download_mbps": 0, "passed": 4, "tests": 5, "streak": 3,
+   "last_pass": "2025-01-02T15:04:05Z", "location": "DE", "ip": "203.0.113.7"}]}
+
+and writing on stdout the configs whose score it changes:
+
+  {"configs": [{"link": "vless://...", "score": 40, "note": "hosting ASN"},
+               {"link": "trojan://...", "drop": true}]}
+
+Configs it leaves out keep their score; dropped ones are left out of the ranking.
+The hook applies wherever the best configs are picked, such as 'proxy pool'.
+
+Examples:
+  xray-knife subs best
+  xray-knife subs best --top 5 --explain
+  xray-knife subs best --weights latency=1,speed=0 --runs 3
+  xray-knife subs best --preset mobile-sim
+  xray-knife subs best --sub-id 2 --top 20 -o best.txt
+  xray-knife subs best --hook "python3 penalize_asn.py" --explain`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bestTop < 0 {
+			return fmt.Errorf("--top must be >= 0")
+		}
+		cfg, err := score.LoadProfileConfig()
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("runs") {
+			if bestRuns < 1 {
+				return fmt.Errorf("--runs must be >= 1")
+			}
+			cfg.Runs = bestRuns
+		}
+		if bestPreset != "" {
+			preset, err := database.GetTestPreset(bestPreset)
+			if err != nil {
+				return err
+			}
+			if preset.Weights == "" {
+				customlog.Printf(customlog.Warning, "Preset %s has no scoring weights, ranking with those of the config file\n", bestPreset)
+			} else if err := cfg.Weights.Parse(preset.Weights); err != nil {
+				return fmt.Errorf("preset %s: %w", bestPreset, err)
+			}
+		}
+		if bestWeights != "" {
+			if err := cfg.Weights.Parse(bestWeights); err != nil {
+				return err
+			}
+		}
+		if bestPreset != "" || bestWeights != "" {
+			if err := cfg.Weights.Validate(); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("hook") {
+			cfg.Hook = bestHook
+		}
+
+		results, err := database.GetRecentHttpTestResults(cfg.Runs, bestSubID)
+		if err != nil {
+			return err
+		}
+		ranked := rankConfigs(results, cfg.Weights, time.Now())
+		if ranked, err = applyScoreHook(cmd.Context(), cfg, ranked); err != nil {
+			return err
+		}
+		if len(ranked) == 0 {
+			customlog.Printf(customlog.Warning, "No config passed in the last %d test runs. Run 'xray-knife http --save-db' first.\n", cfg.Runs)
+			return nil
+		}
+		if bestTop > 0 && len(ranked) > bestTop {
+			ranked = ranked[:bestTop]
+		}
+
+		if bestOut != "" {
+			links := make([]string, len(ranked))
+			for i, r := range ranked {
+				links[i] = r.link
+			}
+			if err := utils.WriteIntoFile(bestOut, []byte(strings.Join(links, "\n")+"\n")); err != nil {
+				return err
+			}
+			if bestOut != "-" {
+				customlog.Printf(customlog.Success, "Wrote the %d best configs to %s\n", len(ranked), bestOut)
+			}
+			return nil
+		}
+
+		if cfg.Hook != "" {
+			customlog.Printf(customlog.Info, "Scored over the last %d test runs with %s, re-scored by %q\n\n", cfg.Runs, cfg.Weights, cfg.Hook)
+		} else {
+			customlog.Printf(customlog.Info, "Scored over the last %d test runs with %s\n\n", cfg.Runs, cfg.Weights)
+		}
+		if bestExplain {
+			for i, r := range ranked {
+				explainScore(i+1, r, cfg.Weights)
+			}
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "RANK\tSCORE\tDELAY\tPASSED\tLOCATION\tLINK")
+		fmt.Fprintln(w, "----\t-----\t-----\t------\t--------\t----")
+		for i, r := range ranked {
+			fmt.Fprintf(w, "%d\t%.1f\t%dms\t%d/%d\t%s\t%s\n", i+1, r.score.Total, r.score.MedianDelay,
+				r.score.Passed, r.score.Tests, orUnknown(r.location), r.link)
+		}
+		return w.Flush()
+	},
+}
+
+// BestConfigs returns the links of the top best-scored configs over the recent
+// test runs, with the scoring settings and hook of the profile; all of them when
+// top is 0.
+func BestConfigs(top int, subID int64) ([]string, error) {
+	cfg, err := score.LoadProfileConfig()
+	if err != nil {
+		return nil, err
+	}
+	results, err := database.GetRecentHttpTestResults(cfg.Runs, subID)
+	if err != nil {
+		return nil, err
+	}
+	ranked := rankConfigs(results, cfg.Weights, time.Now())
+	if ranked, err = applyScoreHook(context.Background(), cfg, ranked); err != nil {
+		return nil, err
+	}
+	if top > 0 && len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	links := make([]string, len(ranked))
+	for i, r := range ranked {
+		links[i] = r.link
+	}
+	return links, nil
+}
+
+// rankConfigs scores every config in results, which are newest first, and
+// returns the ones that passed at least once, best first.
+func rankConfigs(results []database.TimedHttpTestResult, w score.Weights, now time.Time) []rankedConfig {
+	samples := make(map[string][]score.Sample)
+	locations := make(map[string]string)
+	ips := make(map[string]string)
+	var order []string
+	for _, r := range results {
+		if _, seen := samples[r.ConfigLink]; !seen {
+			order = append(order, r.ConfigLink)
+		}
+		passed := r.Status == "passed"
+		samples[r.ConfigLink] = append(samples[r.ConfigLink], score.Sample{
+			Passed:       passed,
+			Delay:        r.DelayMs,
+			DownloadMbps: r.DownloadMbps,
+			At:           r.TestedAt,
+		})
+		if _, ok := locations[r.ConfigLink]; !ok && passed && r.IPLocation.Valid && r.IPLocation.String != "null" {
+			locations[r.ConfigLink] = r.IPLocation.String
+		}
+		if _, ok := ips[r.ConfigLink]; !ok && passed && r.IPAddress.Valid && r.IPAddress.String != "null" {
+			ips[r.ConfigLink] = r.IPAddress.String
+		}
+	}
+
+	var ranked []rankedConfig
+	for _, link := range order {
+		b := score.Score(samples[link], w, now)
+		if b.Passed == 0 {
+			continue
+		}
+		ranked = append(ranked, rankedConfig{link: link, location: locations[link], ip: ips[link], score: b})
+	}
+	sortRanked(ranked)
+	return ranked
+}
+
+// sortRanked orders configs best first.
+func sortRanked(ranked []rankedConfig) {
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score.Total != ranked[j].score.Total {
+			return ranked[i].score.Total > ranked[j].score.Total
+		}
+		return ranked[i].score.MedianDelay < ranked[j].score.MedianDelay
+	})
+}
+
+// applyScoreHook re-scores ranked with the scoring hook of cfg, if any, and
+// returns the configs it kept, best first.
+func applyScoreHook(ctx context.Context, cfg score.Config, ranked []rankedConfig) ([]rankedConfig, error) {
+	if cfg.Hook == "" || len(ranked) == 0 {
+		return ranked, nil
+	}
+	in := make([]score.HookConfig, len(ranked))
+	for i, r := range ranked {
+		b := r.score
+		in[i] = score.HookConfig{
+			Link: r.link, Score: b.Total, Factors: b.Factors,
+			MedianDelay: b.MedianDelay, Jitter: b.Jitter, Download: b.Download,
+			Passed: b.Passed, Tests: b.Tests, Streak: b.Streak, LastPass: b.LastPass,
+			Location: r.location, IP: r.ip,
+		}
+	}
+	verdicts, err := score.RunHook(ctx, cfg.Hook, cfg.Weights, in)
+	if err != nil {
+		return nil, err
+	}
+	kept := ranked[:0:0]
+	for _, r := range ranked {
+		v, ok := verdicts[r.link]
+		if ok && v.Drop {
+			continue
+		}
+		if ok && v.Score != nil && *v.Score != r.score.Total {
+			r.note = fmt.Sprintf("re-scored from %.1f", r.score.Total)
+			r.score.Total = *v.Score
+		}
+		if v.Note != "" {
+			r.note = strings.TrimPrefix(r.note+": "+v.Note, ": ")
+		}
+		kept = append(kept, r)
+	}
+	sortRanked(kept)
+	return kept, nil
+}
+
+// explainScore prints how a config's score adds up from the weighted factors.
+func explainScore(rank int, r rankedConfig, w score.Weights) {
+	b := r.score
+	fmt.Printf("%d. %.1f points, %s\n   %s\n", rank, b.Total, orUnknown(r.location), r.link)
+
+	details := map[string]string{
+		"latency": fmt.Sprintf("median %dms", b.MedianDelay),
+		"jitter":  fmt.Sprintf("±%.0fms over %d passed tests", b.Jitter, b.Passed),
+		"speed":   "not measured",
+		"streak":  fmt.Sprintf("passed the last %d of %d tests in a row", b.Streak, b.Tests),
+		"age":     "last passed " + formatAge(time.Since(b.LastPass)) + " ago",
+	}
+	if b.Passed < 2 {
+		details["jitter"] = "unknown from a single passed test"
+	}
+	if b.Download > 0 {
+		details["speed"] = fmt.Sprintf("%.1f mbps down", b.Download)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range score.FactorNames() {
+		fmt.Fprintf(tw, "   %s\t%.2f × %g\t= %4.1f\t%s\n", name, b.Factors[name], w.Get(name), b.Contribution(w, name), details[name])
+	}
+	tw.Flush()
+	if r.note != "" {
+		fmt.Printf("   hook: %s\n", r.note)
+	}
+	fmt.Println()
+}
+
+// formatAge rounds d to a short human-readable duration.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return unknownCountry
+	}
+	return s
+}
+
+func init() {
+	flags := BestCmd.Flags()
+	flags.IntVar(&bestTop, "top", 10, "Show only the N best configs (0 = all)")
+	flags.IntVar(&bestRuns, "runs", score.DefaultRuns, "Score over the last N test runs (overrides score.runs)")
+	flags.Int64Var(&bestSubID, "sub-id", 0, "Only rank configs seen in this subscription")
+	flags.StringVar(&bestWeights, "weights", "", "Override factor weights for this run, e.g. latency=1,speed=0")
+	flags.StringVar(&bestPreset, "preset", "", "Rank with the scoring weights of this test preset")
+	flags.BoolVar(&bestExplain, "explain", false, "Show each config's score breakdown")
+	flags.StringVarP(&bestOut, "out", "o", "", "Write the links of the best configs to this file ('-' for stdout)")
+	flags.StringVar(&bestHook, "hook", "", "Command re-scoring the ranked configs over JSON (overrides score.hook, \"\" turns it off)")
+}
@@ -0,0 +1,70 @@
+package subs
+
+import (
+	"context"
+	"database/sql"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/score"
+)
+
+func TestRankConfigs(t *testing.T) {
+	now := time.Now()
+	result := func(link, status string, delay int64, at time.Time, loc string) database.TimedHttpTestResult {
+		return database.TimedHttpTestResult{
+			HttpTestResult: database.HttpTestResult{ConfigLink: link, Status: status, DelayMs: delay, IPLocation: sql.NullString{String: loc, Valid: loc != ""}},
+			TestedAt:       at,
+		}
+	}
+	// Newest run first: "steady" passed both runs, "flaky" is faster but failed the latest one.
+	results := []database.TimedHttpTestResult{
+		result("vless://steady", "passed", 300, now, "DE"),
+		result("vless://flaky", "failed", -1, now, ""),
+		result("vless://dead", "failed", -1, now, ""),
+		result("vless://steady", "passed", 320, now.Add(-time.Hour), "NL"),
+		result("vless://flaky", "passed", 100, now.Add(-time.Hour), "FR"),
+	}
+
+	ranked := rankConfigs(results, score.DefaultWeights(), now)
+	if len(ranked) != 2 {
+		t.Fatalf("ranked %d configs, want 2 (dead never passed)", len(ranked))
+	}
+	if ranked[0].link != "vless://steady" || ranked[0].location != "DE" {
+		t.Errorf("best = %+v", ranked[0])
+	}
+
+	// Ranking on latency alone puts the faster config first.
+	ranked = rankConfigs(results, score.Weights{Latency: 1}, now)
+	if ranked[0].link != "vless://flaky" || ranked[0].location != "FR" {
+		t.Errorf("best on latency = %+v", ranked[0])
+	}
+}
+
+func TestApplyScoreHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook of this test is an sh script")
+	}
+	ranked := []rankedConfig{
+		{link: "vless://a", score: score.Breakdown{Total: 90}},
+		{link: "vless://b", score: score.Breakdown{Total: 80}},
+		{link: "vless://c", score: score.Breakdown{Total: 70}},
+	}
+	cfg := score.DefaultConfig()
+	cfg.Hook = `cat >/dev/null; echo '{"configs":[{"link":"vless://a","score":50,"note":"penalized ASN"},{"link":"vless://c","drop":true}]}'`
+	got, err := applyScoreHook(context.Background(), cfg, ranked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].link != "vless://b" || got[1].link != "vless://a" {
+		t.Fatalf("re-ranked = %+v", got)
+	}
+	if got[1].score.Total != 50 || got[1].note != "re-scored from 90.0: penalized ASN" {
+		t.Errorf("a = %.1f, %q", got[1].score.Total, got[1].note)
+	}
+	if ranked[0].score.Total != 90 {
+		t.Error("the hook changed the ranking passed in")
+	}
+}
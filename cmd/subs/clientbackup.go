@@ -0,0 +1,635 @@
+package subs
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Backup formats understood by 'subs import'.
+const (
+	formatV2rayN  = "v2rayn"
+	formatNekoBox = "nekobox"
+)
+
+// importedServer is a server entry read from a GUI client backup, normalized to the
+// fields needed to build a share link.
+type importedServer struct {
+	Protocol      string // vmess, vless, trojan, ss, socks, hysteria2
+	Remark        string
+	Address       string
+	Port          string
+	ID            string // UUID, or password for trojan/ss/hysteria2
+	AlterID       string
+	Cipher        string // vmess security, ss method
+	Flow          string
+	Network       string
+	HeaderType    string
+	Host          string
+	Path          string
+	ServiceName   string
+	Authority     string
+	Mode          string
+	Security      string // tls, reality, or empty
+	SNI           string
+	ALPN          string
+	Fingerprint   string
+	PublicKey     string
+	ShortID       string
+	SpiderX       string
+	AllowInsecure bool
+	Username      string
+	ObfsPassword  string
+}
+
+// importedSubscription is a subscription URL found in a backup.
+type importedSubscription struct {
+	Remark    string
+	URL       string
+	UserAgent string
+	Enabled   bool
+}
+
+// clientBackup is everything read from one backup.
+type clientBackup struct {
+	Servers       []importedServer
+	Subscriptions []importedSubscription
+	// Skipped counts entries of protocols xray-knife cannot load, by protocol name.
+	Skipped map[string]int
+}
+
+func (b *clientBackup) skip(protocol string) {
+	if b.Skipped == nil {
+		b.Skipped = make(map[string]int)
+	}
+	b.Skipped[protocol]++
+}
+
+// Link builds the share link for the server.
+func (s importedServer) Link() (string, error) {
+	if s.Address == "" || s.Port == "" {
+		return "", fmt.Errorf("missing address or port")
+	}
+	hostPort := net.JoinHostPort(s.Address, s.Port)
+	fragment := ""
+	if s.Remark != "" {
+		fragment = "#" + url.PathEscape(s.Remark)
+	}
+
+	switch s.Protocol {
+	case "vmess":
+		tls := ""
+		if s.Security == "tls" {
+			tls = "tls"
+		}
+		path := s.Path
+		host := s.Host
+		if s.Network == "grpc" {
+			path, host = s.ServiceName, s.Authority
+		}
+		if s.AlterID == "" {
+			s.AlterID = "0"
+		}
+		payload := map[string]string{
+			"v": "2", "ps": s.Remark, "add": s.Address, "port": s.Port, "id": s.ID,
+			"aid": s.AlterID, "scy": s.Cipher, "net": s.Network, "type": s.HeaderType,
+			"host": host, "path": path, "tls": tls, "sni": s.SNI, "alpn": s.ALPN, "fp": s.Fingerprint,
+		}
+		if s.AllowInsecure {
+			payload["allowInsecure"] = "1"
+		}
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(raw), nil
+
+	case "vless", "trojan":
+		q := url.Values{}
+		if s.Protocol == "vless" {
+			q.Set("encryption", "none")
+		}
+		set := func(k, v string) {
+			if v != "" {
+				q.Set(k, v)
+			}
+		}
+		set("type", s.Network)
+		set("security", s.Security)
+		set("flow", s.Flow)
+		set("headerType", s.HeaderType)
+		set("host", s.Host)
+		set("path", s.Path)
+		set("serviceName", s.ServiceName)
+		set("authority", s.Authority)
+		set("mode", s.Mode)
+		set("sni", s.SNI)
+		set("alpn", s.ALPN)
+		set("fp", s.Fingerprint)
+		set("pbk", s.PublicKey)
+		set("sid", s.ShortID)
+		set("spx", s.SpiderX)
+		if s.AllowInsecure {
+			q.Set("allowInsecure", "1")
+		}
+		return fmt.Sprintf("%s://%s@%s?%s%s", s.Protocol, url.PathEscape(s.ID), hostPort, q.Encode(), fragment), nil
+
+	case "ss":
+		if s.Cipher == "" {
+			return "", fmt.Errorf("missing shadowsocks method")
+		}
+		user := base64.RawURLEncoding.EncodeToString([]byte(s.Cipher + ":" + s.ID))
+		return fmt.Sprintf("ss://%s@%s%s", user, hostPort, fragment), nil
+
+	case "socks":
+		if s.Username == "" {
+			return fmt.Sprintf("socks://%s%s", hostPort, fragment), nil
+		}
+		user := base64.StdEncoding.EncodeToString([]byte(s.Username + ":" + s.ID))
+		return fmt.Sprintf("socks://%s@%s%s", user, hostPort, fragment), nil
+
+	case "hysteria2":
+		q := url.Values{}
+		if s.SNI != "" {
+			q.Set("sni", s.SNI)
+		}
+		if s.AllowInsecure {
+			q.Set("insecure", "1")
+		}
+		if s.ObfsPassword != "" {
+			q.Set("obfs", "salamander")
+			q.Set("obfs-password", s.ObfsPassword)
+		}
+		return fmt.Sprintf("hysteria2://%s@%s?%s%s", url.PathEscape(s.ID), hostPort, q.Encode(), fragment), nil
+	}
+	return "", fmt.Errorf("unsupported protocol %q", s.Protocol)
+}
+
+// flexString decodes a JSON string, number, bool, or string list (joined by commas),
+// since client versions disagree on the types of fields like port and alpn.
+type flexString string
+
+func (f *flexString) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case nil:
+		*f = ""
+	case string:
+		*f = flexString(t)
+	case float64:
+		*f = flexString(strconv.FormatFloat(t, 'f', -1, 64))
+	case bool:
+		*f = flexString(strconv.FormatBool(t))
+	case []any:
+		parts := make([]string, 0, len(t))
+		for _, p := range t {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		*f = flexString(strings.Join(parts, ","))
+	default:
+		return fmt.Errorf("unexpected JSON value %s", b)
+	}
+	return nil
+}
+
+func (f flexString) String() string { return strings.TrimSpace(string(f)) }
+
+// v2rayNProfile is a server in guiNConfig.json ("vmess" list, v2rayN 5.x and older)
+// or a row of the ProfileItem table in guiNDB.db (v2rayN 6.x and newer). Both use the
+// same field names; JSON decoding matches them case-insensitively.
+type v2rayNProfile struct {
+	ConfigType     flexString `json:"configType"`
+	Address        flexString `json:"address"`
+	Port           flexString `json:"port"`
+	ID             flexString `json:"id"`
+	AlterID        flexString `json:"alterId"`
+	Security       flexString `json:"security"`
+	Network        flexString `json:"network"`
+	Remarks        flexString `json:"remarks"`
+	HeaderType     flexString `json:"headerType"`
+	RequestHost    flexString `json:"requestHost"`
+	Path           flexString `json:"path"`
+	StreamSecurity flexString `json:"streamSecurity"`
+	AllowInsecure  flexString `json:"allowInsecure"`
+	Flow           flexString `json:"flow"`
+	SNI            flexString `json:"sni"`
+	ALPN           flexString `json:"alpn"`
+	Fingerprint    flexString `json:"fingerprint"`
+	PublicKey      flexString `json:"publicKey"`
+	ShortID        flexString `json:"shortId"`
+	SpiderX        flexString `json:"spiderX"`
+}
+
+// v2rayNSubItem is a subscription in guiNConfig.json ("subItem") or the SubItem table.
+type v2rayNSubItem struct {
+	Remarks   flexString `json:"remarks"`
+	URL       flexString `json:"url"`
+	Enabled   flexString `json:"enabled"`
+	UserAgent flexString `json:"userAgent"`
+}
+
+// v2rayNConfigTypes maps v2rayN's EConfigType values to protocol names.
+var v2rayNConfigTypes = map[string]string{
+	"1":  "vmess",
+	"2":  "custom",
+	"3":  "ss",
+	"4":  "socks",
+	"5":  "vless",
+	"6":  "trojan",
+	"7":  "hysteria2",
+	"8":  "tuic",
+	"9":  "wireguard",
+	"10": "http",
+	"11": "anytls",
+}
+
+func (p v2rayNProfile) server() importedServer {
+	s := importedServer{
+		Protocol:      v2rayNConfigTypes[p.ConfigType.String()],
+		Remark:        p.Remarks.String(),
+		Address:       p.Address.String(),
+		Port:          p.Port.String(),
+		ID:            p.ID.String(),
+		AlterID:       p.AlterID.String(),
+		Flow:          p.Flow.String(),
+		Network:       p.Network.String(),
+		Host:          p.RequestHost.String(),
+		Path:          p.Path.String(),
+		Security:      p.StreamSecurity.String(),
+		SNI:           p.SNI.String(),
+		ALPN:          p.ALPN.String(),
+		Fingerprint:   p.Fingerprint.String(),
+		PublicKey:     p.PublicKey.String(),
+		ShortID:       p.ShortID.String(),
+		SpiderX:       p.SpiderX.String(),
+		AllowInsecure: isTrue(p.AllowInsecure.String()),
+	}
+	if ht := p.HeaderType.String(); ht != "none" {
+		s.HeaderType = ht
+	}
+	switch s.Protocol {
+	case "vmess", "ss":
+		s.Cipher = p.Security.String()
+	case "hysteria2":
+		// v2rayN keeps the salamander obfs password in path.
+		s.ObfsPassword, s.Path = s.Path, ""
+	}
+	if s.Network == "grpc" {
+		// v2rayN stores the service name in path, the authority in requestHost
+		// and the gRPC mode in headerType.
+		s.ServiceName, s.Authority, s.Mode = s.Path, s.Host, s.HeaderType
+		s.Path, s.Host, s.HeaderType = "", "", ""
+	}
+	return s
+}
+
+func (si v2rayNSubItem) subscription() importedSubscription {
+	enabled := si.Enabled.String()
+	return importedSubscription{
+		Remark:    si.Remarks.String(),
+		URL:       si.URL.String(),
+		UserAgent: si.UserAgent.String(),
+		Enabled:   enabled == "" || isTrue(enabled),
+	}
+}
+
+func isTrue(s string) bool {
+	switch strings.ToLower(s) {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// readV2rayNBackup reads a guiNConfig.json, a guiNDB.db, or a v2rayN backup zip
+// holding either of them.
+func readV2rayNBackup(path string) (*clientBackup, error) {
+	b := &clientBackup{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip":
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer zr.Close()
+		found := false
+		for _, f := range zr.File {
+			switch strings.ToLower(filepath.Base(f.Name)) {
+			case "guinconfig.json":
+				data, err := readZipFile(f)
+				if err != nil {
+					return nil, err
+				}
+				if err := b.addV2rayNConfig(data); err != nil {
+					return nil, fmt.Errorf("%s: %w", f.Name, err)
+				}
+				found = true
+			case "guindb.db":
+				if err := b.addV2rayNDBFromZip(f); err != nil {
+					return nil, fmt.Errorf("%s: %w", f.Name, err)
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no guiNConfig.json or guiNDB.db in %s", path)
+		}
+	case ".db":
+		if err := b.addV2rayNDB(path); err != nil {
+			return nil, err
+		}
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.addV2rayNConfig(data); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *clientBackup) addV2rayNConfig(data []byte) error {
+	var cfg struct {
+		Vmess   []v2rayNProfile `json:"vmess"`
+		SubItem []v2rayNSubItem `json:"subItem"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("not a v2rayN config: %w", err)
+	}
+	b.addV2rayNProfiles(cfg.Vmess)
+	for _, si := range cfg.SubItem {
+		if sub := si.subscription(); sub.URL != "" {
+			b.Subscriptions = append(b.Subscriptions, sub)
+		}
+	}
+	return nil
+}
+
+func (b *clientBackup) addV2rayNProfiles(profiles []v2rayNProfile) {
+	for _, p := range profiles {
+		s := p.server()
+		switch s.Protocol {
+		case "vmess", "vless", "trojan", "ss", "socks", "hysteria2":
+			b.Servers = append(b.Servers, s)
+		case "":
+			b.skip("type " + p.ConfigType.String())
+		default:
+			b.skip(s.Protocol)
+		}
+	}
+}
+
+func (b *clientBackup) addV2rayNDBFromZip(f *zip.File) error {
+	tmp, err := os.CreateTemp("", "xray-knife-guiNDB-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	rc, err := f.Open()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return b.addV2rayNDB(tmp.Name())
+}
+
+// addV2rayNDB reads the ProfileItem and SubItem tables of a guiNDB.db. Rows are
+// scanned into maps and decoded like the JSON config, so columns added or dropped
+// across v2rayN versions do not matter.
+func (b *clientBackup) addV2rayNDB(path string) error {
+	db, err := sqlx.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var profiles []v2rayNProfile
+	if err := scanTable(db, "ProfileItem", &profiles); err != nil {
+		return err
+	}
+	b.addV2rayNProfiles(profiles)
+
+	var subs []v2rayNSubItem
+	if err := scanTable(db, "SubItem", &subs); err != nil {
+		return err
+	}
+	for _, si := range subs {
+		if sub := si.subscription(); sub.URL != "" {
+			b.Subscriptions = append(b.Subscriptions, sub)
+		}
+	}
+	return nil
+}
+
+func scanTable(db *sqlx.DB, table string, dest any) error {
+	rows, err := db.Queryx("SELECT * FROM " + table)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+	var records []map[string]any
+	for rows.Next() {
+		rec := make(map[string]any)
+		if err := rows.MapScan(rec); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		for k, v := range rec {
+			if raw, ok := v.([]byte); ok {
+				rec[k] = string(raw)
+			}
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// nekoProfile is a NekoRay / NekoBox for PC profile (config/profiles/<id>.json).
+type nekoProfile struct {
+	Type string   `json:"type"`
+	Bean nekoBean `json:"bean"`
+}
+
+type nekoBean struct {
+	Name   flexString  `json:"name"`
+	Addr   flexString  `json:"addr"`
+	Port   flexString  `json:"port"`
+	ID     flexString  `json:"id"`   // vmess uuid
+	AID    flexString  `json:"aid"`  // vmess alterId
+	Sec    flexString  `json:"sec"`  // vmess security
+	Pass   flexString  `json:"pass"` // vless uuid, trojan/ss password
+	Flow   flexString  `json:"flow"`
+	Method flexString  `json:"method"` // ss
+	User   flexString  `json:"username"`
+	Passwd flexString  `json:"password"` // socks
+	Stream *nekoStream `json:"stream"`
+}
+
+type nekoStream struct {
+	Net      flexString `json:"net"`
+	Sec      flexString `json:"sec"`
+	Host     flexString `json:"host"`
+	Path     flexString `json:"path"`
+	SNI      flexString `json:"sni"`
+	ALPN     flexString `json:"alpn"`
+	Insecure flexString `json:"insecure"`
+	HeadType flexString `json:"h_type"`
+	FP       flexString `json:"utls"`
+	PBK      flexString `json:"pbk"`
+	SID      flexString `json:"sid"`
+	SPX      flexString `json:"spx"`
+}
+
+func (p nekoProfile) server() importedServer {
+	bean := p.Bean
+	s := importedServer{
+		Protocol: p.Type,
+		Remark:   bean.Name.String(),
+		Address:  bean.Addr.String(),
+		Port:     bean.Port.String(),
+		Flow:     bean.Flow.String(),
+	}
+	switch p.Type {
+	case "vmess":
+		s.ID, s.AlterID, s.Cipher = bean.ID.String(), bean.AID.String(), bean.Sec.String()
+	case "vless", "trojan":
+		s.ID = bean.Pass.String()
+	case "shadowsocks":
+		s.Protocol, s.ID, s.Cipher = "ss", bean.Pass.String(), bean.Method.String()
+	case "socks":
+		s.Username, s.ID = bean.User.String(), bean.Passwd.String()
+	}
+	if st := bean.Stream; st != nil {
+		s.Network = st.Net.String()
+		s.Security = st.Sec.String()
+		s.Host = st.Host.String()
+		s.Path = st.Path.String()
+		s.SNI = st.SNI.String()
+		s.ALPN = st.ALPN.String()
+		s.Fingerprint = st.FP.String()
+		s.PublicKey = st.PBK.String()
+		s.ShortID = st.SID.String()
+		s.SpiderX = st.SPX.String()
+		s.AllowInsecure = isTrue(st.Insecure.String())
+		if ht := st.HeadType.String(); ht != "none" {
+			s.HeaderType = ht
+		}
+		if s.Network == "grpc" {
+			s.ServiceName, s.Path = s.Path, ""
+		}
+	}
+	if s.Security == "none" {
+		s.Security = ""
+	}
+	return s
+}
+
+// readNekoBoxBackup reads a NekoRay / NekoBox for PC profile, a profiles directory,
+// or a zip of the config directory.
+func readNekoBoxBackup(path string) (*clientBackup, error) {
+	b := &clientBackup{}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case info.IsDir():
+		files, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			// Accept the config directory itself.
+			files, _ = filepath.Glob(filepath.Join(path, "profiles", "*.json"))
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			b.addNekoProfile(data)
+		}
+	case strings.EqualFold(filepath.Ext(path), ".zip"):
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if filepath.Base(filepath.Dir(f.Name)) != "profiles" || !strings.HasSuffix(f.Name, ".json") {
+				continue
+			}
+			data, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+			b.addNekoProfile(data)
+		}
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		b.addNekoProfile(data)
+	}
+
+	if len(b.Servers) == 0 && len(b.Skipped) == 0 {
+		return nil, fmt.Errorf("no NekoBox profiles found in %s", path)
+	}
+	return b, nil
+}
+
+func (b *clientBackup) addNekoProfile(data []byte) {
+	var p nekoProfile
+	if err := json.Unmarshal(data, &p); err != nil || p.Type == "" {
+		b.skip("invalid profile")
+		return
+	}
+	switch p.Type {
+	case "vmess", "vless", "trojan", "shadowsocks", "socks":
+		b.Servers = append(b.Servers, p.server())
+	default:
+		b.skip(p.Type)
+	}
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,111 @@
+package subs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+)
+
+const v2rayNConfigJSON = `{
+  "vmess": [
+    {"configType": 1, "address": "vm.example.com", "port": 443, "id": "0b5a3c9e-1b2c-4d5e-8f90-123456789abc",
+     "alterId": 0, "security": "auto", "network": "ws", "remarks": "VMess WS", "headerType": "none",
+     "requestHost": "cdn.example.com", "path": "/ws", "streamSecurity": "tls", "sni": "cdn.example.com",
+     "alpn": ["h2", "http/1.1"], "fingerprint": "chrome"},
+    {"configType": 5, "address": "vl.example.com", "port": "8443", "id": "0b5a3c9e-1b2c-4d5e-8f90-123456789abc",
+     "security": "none", "network": "grpc", "remarks": "VLESS gRPC", "headerType": "multi", "path": "svc",
+     "streamSecurity": "reality", "sni": "www.microsoft.com", "fingerprint": "chrome", "publicKey": "pbk123", "shortId": "ab"},
+    {"configType": 3, "address": "ss.example.com", "port": 8388, "id": "secret", "security": "aes-256-gcm", "remarks": "SS"},
+    {"configType": 8, "address": "tuic.example.com", "port": 443, "remarks": "TUIC"}
+  ],
+  "subItem": [
+    {"remarks": "main", "url": "https://sub.example.com/a", "enabled": true},
+    {"remarks": "old", "url": "https://sub.example.com/b", "enabled": false}
+  ]
+}`
+
+func TestReadV2rayNBackup_ConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guiNConfig.json")
+	if err := os.WriteFile(path, []byte(v2rayNConfigJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := readV2rayNBackup(path)
+	if err != nil {
+		t.Fatalf("readV2rayNBackup: %v", err)
+	}
+	if len(b.Servers) != 3 {
+		t.Fatalf("expected 3 servers, got %d", len(b.Servers))
+	}
+	if b.Skipped["tuic"] != 1 {
+		t.Errorf("expected the tuic server to be skipped, got %v", b.Skipped)
+	}
+	if len(b.Subscriptions) != 2 || b.Subscriptions[1].Enabled {
+		t.Errorf("unexpected subscriptions: %+v", b.Subscriptions)
+	}
+
+	grpc := b.Servers[1]
+	if grpc.ServiceName != "svc" || grpc.Mode != "multi" || grpc.HeaderType != "" {
+		t.Errorf("gRPC fields not mapped: %+v", grpc)
+	}
+
+	// Every converted link must round-trip through the parsers.
+	c := core.NewAutomaticCore(false, false)
+	wantRemarks := []string{"VMess WS", "VLESS gRPC", "SS"}
+	for i, s := range b.Servers {
+		link, err := s.Link()
+		if err != nil {
+			t.Fatalf("Link(%s): %v", s.Protocol, err)
+		}
+		p, err := c.CreateProtocol(link)
+		if err != nil {
+			t.Fatalf("CreateProtocol(%q): %v", link, err)
+		}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("Parse(%q): %v", link, err)
+		}
+		g := p.ConvertToGeneralConfig()
+		if g.Remark != wantRemarks[i] {
+			t.Errorf("remark = %q, want %q", g.Remark, wantRemarks[i])
+		}
+	}
+}
+
+func TestReadNekoBoxBackup_ProfilesDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	profiles := map[string]string{
+		"0.json": `{"type":"vless","bean":{"name":"neko vless","addr":"1.2.3.4","port":443,"pass":"0b5a3c9e-1b2c-4d5e-8f90-123456789abc",
+			"flow":"xtls-rprx-vision","stream":{"net":"tcp","sec":"tls","sni":"a.example.com","utls":"firefox","insecure":true}}}`,
+		"1.json": `{"type":"trojan","bean":{"name":"neko trojan","addr":"5.6.7.8","port":443,"pass":"pw","stream":{"net":"ws","sec":"tls","host":"h.example.com","path":"/t"}}}`,
+		"2.json": `{"type":"custom","bean":{"name":"core config"}}`,
+	}
+	for name, data := range profiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := readNekoBoxBackup(filepath.Dir(dir))
+	if err != nil {
+		t.Fatalf("readNekoBoxBackup: %v", err)
+	}
+	if len(b.Servers) != 2 || b.Skipped["custom"] != 1 {
+		t.Fatalf("got %d servers, skipped %v", len(b.Servers), b.Skipped)
+	}
+
+	link, err := b.Servers[0].Link()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"vless://0b5a3c9e-", "flow=xtls-rprx-vision", "fp=firefox", "allowInsecure=1", "#neko%20vless"} {
+		if !strings.Contains(link, want) {
+			t.Errorf("link %q does not contain %q", link, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package subs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// maxCompressionLayers bounds how many compressed or base64 layers around a
+// payload are removed, so a crafted body can't keep the reader unwrapping.
+const maxCompressionLayers = 4
+
+// acceptEncoding is the Accept-Encoding of subscription requests: the codings
+// decodeContent handles.
+const acceptEncoding = "gzip, deflate, br"
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// isGzip reports whether head starts a gzip stream.
+func isGzip(head []byte) bool {
+	return bytes.HasPrefix(head, gzipMagic)
+}
+
+// isZlib reports whether head starts a zlib stream, the format of the HTTP
+// "deflate" encoding, with one of the headers zlib writes for its compression
+// levels. Other valid headers are rare enough not to be worth mistaking text for.
+func isZlib(head []byte) bool {
+	return len(head) >= 2 && head[0] == 0x78 && bytes.IndexByte([]byte{0x01, 0x5e, 0x9c, 0xda}, head[1]) >= 0
+}
+
+// decodeContent undoes the Content-Encoding of a response body, which some
+// servers send whatever the request asked for. Codings are listed in the order
+// they were applied. A gzip or deflate coding the body doesn't actually carry is
+// skipped, since servers mislabel bodies too; unknown codings are left to the
+// sniffing in readLinks.
+func decodeContent(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	if strings.TrimSpace(encoding) == "" {
+		return body, nil
+	}
+	codings := strings.Split(encoding, ",")
+	var r io.Reader = body
+	for i := len(codings) - 1; i >= 0; i-- {
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(3)
+		switch strings.ToLower(strings.TrimSpace(codings[i])) {
+		case "gzip", "x-gzip":
+			if !isGzip(head) {
+				r = br
+				continue
+			}
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode gzip subscription body: %w", err)
+			}
+			r = gz
+		case "deflate":
+			if isZlib(head) {
+				zr, err := zlib.NewReader(br)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode deflate subscription body: %w", err)
+				}
+				r = zr
+			} else if !isGzip(head) && !startsWithScheme(head) {
+				// Some servers send raw deflate without the zlib wrapper.
+				r = flate.NewReader(br)
+			} else {
+				r = br
+			}
+		case "br":
+			r = brotli.NewReader(br)
+		default:
+			r = br
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, body}, nil
+}
+
+// uncompress removes the gzip and zlib layers around a payload found by its
+// magic bytes, including a gzip stream that was base64 encoded afterwards. It
+// returns br itself when the payload isn't compressed.
+func uncompress(br *bufio.Reader) (*bufio.Reader, error) {
+	for range maxCompressionLayers {
+		head, err := br.Peek(streamPeekSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		var r io.Reader
+		switch {
+		case isGzip(head):
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode gzip subscription body: %w", err)
+			}
+			// One stream: a base64 layer may have left a line break after it.
+			gz.Multistream(false)
+			r = gz
+		case isZlib(head):
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode deflate subscription body: %w", err)
+			}
+			r = zr
+		case base64Compressed(head):
+			r = utils.NewBase64StreamDecoder(br)
+		default:
+			return br, nil
+		}
+		br = bufio.NewReaderSize(r, streamPeekSize)
+	}
+	return br, nil
+}
+
+// base64Compressed reports whether head is base64 that decodes to a gzip or zlib
+// stream.
+func base64Compressed(head []byte) bool {
+	var decoded [3]byte
+	n, err := io.ReadFull(utils.NewBase64StreamDecoder(bytes.NewReader(head)), decoded[:])
+	return err == nil && n == len(decoded) && (isGzip(decoded[:]) || isZlib(decoded[:]))
+}
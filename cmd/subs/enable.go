@@ -0,0 +1,156 @@
+package subs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+// DisableCmd and EnableCmd switch stored configs off and on in bulk.
+var (
+	DisableCmd = newConfigStateCommand(false)
+	EnableCmd  = newConfigStateCommand(true)
+)
+
+func newConfigStateCommand(enable bool) *cobra.Command {
+	var (
+		where  string
+		dryRun bool
+		limit  int
+	)
+	verb, past := "disable", "Disabled"
+	if enable {
+		verb, past = "enable", "Enabled"
+	}
+
+	cmd := &cobra.Command{
+		Use:   verb + " [config...] [--where <filter>]",
+		Short: strings.ToUpper(verb[:1]) + verb[1:] + "s stored configs by ID, alias or a filter",
+		Long: `Disables or enables stored configs in bulk, without a confirmation prompt.
+Disabled configs stay in the database, and are kept disabled when fetched again,
+but are skipped by 'xray-knife http --from-db' and the proxy's database mode.
+
+Configs are selected by ID or alias, by a --where filter, or both. A filter is a small
+expression language, not raw SQL; values are always passed as parameters:
+
+  field = 'value'          also !=, <, <=, >, >=
+  field [NOT] LIKE 'v2%'
+  field [NOT] IN ('ss', 'trojan')
+  field IS [NOT] NULL
+  AND, OR, NOT and parentheses
+
+Fields: ` + strings.Join(database.ConfigFilterFields, ", ") + `. 'sub' matches any
+subscription the config was seen in. Dates can be compared with
+date('now', '-30 day') or datetime('now', '-12 hours').
+
+Use --dry-run to list what a filter matches before changing anything.
+
+Examples:
+  xray-knife subs ` + verb + ` 12 15 16
+  xray-knife subs ` + verb + ` de-1 de-2
+  xray-knife subs ` + verb + ` --where "protocol = 'ss' AND last_seen < date('now', '-30 day')"
+  xray-knife subs ` + verb + ` --where "sub = 3 AND remark LIKE '%test%'" --dry-run`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := configStateFilter(args, where)
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				return printMatchingConfigs(filter, limit)
+			}
+
+			changed, err := database.SetConfigsEnabled(filter, enable)
+			if err != nil {
+				return err
+			}
+			customlog.Printf(customlog.Success, "%s %d config(s).\n", past, changed)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&where, "where", "w", "", "Filter selecting the configs, e.g. \"protocol = 'ss' AND last_seen < date('now', '-30 day')\"")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only list the configs that would be "+strings.ToLower(past))
+	cmd.Flags().IntVar(&limit, "limit", 50, "With --dry-run, maximum number of configs to list")
+	return cmd
+}
+
+// configStateFilter builds the filter from the config IDs or aliases given as
+// arguments and --where.
+func configStateFilter(args []string, where string) (*database.ConfigFilter, error) {
+	if len(args) == 0 && strings.TrimSpace(where) == "" {
+		return nil, fmt.Errorf("give config IDs, aliases or a --where filter")
+	}
+
+	var filter *database.ConfigFilter
+	if len(args) > 0 {
+		placeholders := make([]string, len(args))
+		ids := make([]interface{}, len(args))
+		for i, arg := range args {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				config, err := database.GetConfigByRef(arg)
+				if err != nil {
+					return nil, err
+				}
+				id = config.ID
+			}
+			placeholders[i] = "?"
+			ids[i] = id
+		}
+		filter = &database.ConfigFilter{SQL: "id IN (" + strings.Join(placeholders, ", ") + ")", Args: ids}
+	}
+	if strings.TrimSpace(where) != "" {
+		f, err := database.ParseConfigFilter(where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --where filter: %w", err)
+		}
+		if filter == nil {
+			return f, nil
+		}
+		filter = filter.And(f)
+	}
+	return filter, nil
+}
+
+func printMatchingConfigs(filter *database.ConfigFilter, limit int) error {
+	total, err := database.CountConfigsMatching(filter)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		fmt.Println("No configs match.")
+		return nil
+	}
+	configs, err := database.ListConfigsMatching(filter, limit, 0)
+	if err != nil {
+		return err
+	}
+
+	w := utils.NewTableWriter(os.Stdout, 3, 0)
+	fmt.Fprintln(w, "ID\tSTATE\tPROTOCOL\tREMARK\tLAST SEEN")
+	fmt.Fprintln(w, "--\t-----\t--------\t------\t---------")
+	for _, c := range configs {
+		state := "enabled"
+		if !c.Enabled {
+			state = "disabled"
+		}
+		lastSeen := "N/A"
+		if c.LastSeenAt.Valid {
+			lastSeen = c.LastSeenAt.Time.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.ID, state, c.Protocol.String, truncate(c.Remark.String, 40), lastSeen)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	customlog.Printf(customlog.Info, "%d config(s) match (dry run, nothing changed).\n", total)
+	return nil
+}
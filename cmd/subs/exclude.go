@@ -0,0 +1,166 @@
+package subs
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// excludeFields are the parts of a link an exclusion rule can look at.
+var excludeFields = []string{"remark", "link", "protocol", "address", "port"}
+
+// excludeOps are the operators of an exclusion rule, longest first so "!=" isn't
+// read as "!" followed by "=".
+var excludeOps = []string{"!~", "!=", "~", "="}
+
+// ExcludeRule drops the links of a subscription whose field matches it at fetch
+// time. It reads "field op value": with ~ and !~ the value is a regular
+// expression the field matches or not, with = and != a comma-separated list of
+// values the field equals (case-insensitively) or not. The protocol of a link
+// is its scheme, e.g. ss or vless. Examples:
+//
+//	remark~剩余|到期|官网   drops the traffic and expiry notices of a panel
+//	port!=443              keeps only configs on port 443
+//	protocol=ss,socks      drops Shadowsocks and SOCKS configs
+type ExcludeRule struct {
+	Field string
+	Op    string
+	Value string
+
+	pattern *regexp.Regexp
+	values  []string
+}
+
+// ParseExcludeRule parses a rule such as "remark~expired" or "port!=443".
+func ParseExcludeRule(s string) (ExcludeRule, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, "!~=")
+	if i <= 0 {
+		return ExcludeRule{}, fmt.Errorf("invalid exclusion rule %q: want field op value, e.g. port!=443", s)
+	}
+	r := ExcludeRule{Field: strings.ToLower(strings.TrimSpace(s[:i]))}
+	if !slices.Contains(excludeFields, r.Field) {
+		return ExcludeRule{}, fmt.Errorf("invalid exclusion rule %q: unknown field %q (supported: %s)", s, r.Field, strings.Join(excludeFields, ", "))
+	}
+	for _, op := range excludeOps {
+		if value, ok := strings.CutPrefix(s[i:], op); ok {
+			r.Op, r.Value = op, strings.TrimSpace(value)
+			break
+		}
+	}
+	if r.Op == "" || r.Value == "" {
+		return ExcludeRule{}, fmt.Errorf("invalid exclusion rule %q: want field op value with op one of %s", s, strings.Join(excludeOps, " "))
+	}
+	if r.Op == "~" || r.Op == "!~" {
+		pattern, err := regexp.Compile(r.Value)
+		if err != nil {
+			return ExcludeRule{}, fmt.Errorf("invalid exclusion rule %q: %w", s, err)
+		}
+		r.pattern = pattern
+	} else {
+		for _, v := range strings.Split(r.Value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				r.values = append(r.values, strings.ToLower(v))
+			}
+		}
+	}
+	return r, nil
+}
+
+// ParseExcludeRules parses rules, as stored on a subscription.
+func ParseExcludeRules(rules []string) ([]ExcludeRule, error) {
+	parsed := make([]ExcludeRule, 0, len(rules))
+	for _, s := range rules {
+		r, err := ParseExcludeRule(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+func (r ExcludeRule) String() string {
+	return r.Field + r.Op + r.Value
+}
+
+// matches reports whether the rule drops a link with the given field.
+func (r ExcludeRule) matches(field string) bool {
+	switch r.Op {
+	case "~":
+		return r.pattern.MatchString(field)
+	case "!~":
+		return !r.pattern.MatchString(field)
+	case "=":
+		return slices.Contains(r.values, strings.ToLower(field))
+	default:
+		return !slices.Contains(r.values, strings.ToLower(field))
+	}
+}
+
+// excludeCore parses links for the rules on their address or port.
+var excludeCore = sync.OnceValue(func() core.Core { return core.NewAutomaticCore(false, false) })
+
+// excluded reports whether any of rules drops link. A field the link has no
+// value for, such as the port of a link that can't be parsed, is empty.
+func excluded(rules []ExcludeRule, link string) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	var parsed map[string]string
+	for _, r := range rules {
+		var field string
+		switch r.Field {
+		case "remark":
+			field = utils.LinkRemark(link)
+		case "link":
+			field = link
+		case "protocol":
+			field, _, _ = strings.Cut(link, "://")
+		default:
+			if parsed == nil {
+				parsed = linkFields(link)
+			}
+			field = parsed[r.Field]
+		}
+		if r.matches(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkFields parses link for its address and port.
+func linkFields(link string) (fields map[string]string) {
+	fields = make(map[string]string)
+	defer func() { recover() }()
+	proto, err := excludeCore().CreateProtocol(link)
+	if err != nil || proto.Parse() != nil {
+		return fields
+	}
+	g := proto.ConvertToGeneralConfig()
+	fields["address"], fields["port"] = g.Address, g.Port
+	return fields
+}
+
+// resolveExcludeRules checks the --exclude rules of add and update and returns
+// them as stored. Empty rules are dropped, so --exclude "" clears them all.
+func resolveExcludeRules(rules []string) ([]string, error) {
+	var resolved []string
+	for _, s := range rules {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		r, err := ParseExcludeRule(s)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, r.String())
+	}
+	return resolved, nil
+}
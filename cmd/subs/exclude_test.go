@@ -0,0 +1,58 @@
+package subs
+
+import "testing"
+
+func TestExcludeRules(t *testing.T) {
+	links := map[string]string{
+		"notice": "vless://3f6b1b1e-8d1c-4c2a-9c3e-2b7a1d5e9f00@example.com:443?type=tcp#%E5%89%A9%E4%BD%99%E6%B5%81%E9%87%8F%EF%BC%9A10GB",
+		"https":  "trojan://secret@example.org:443?sni=example.org#DE",
+		"alt":    "trojan://secret@example.org:8443?sni=example.org#NL",
+		"ss":     "ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4:443#SS",
+		"broken": "vmess://not-base64",
+	}
+	tests := []struct {
+		rules []string
+		drop  []string
+	}{
+		{[]string{"remark~剩余|到期|官网"}, []string{"notice"}},
+		{[]string{"port!=443"}, []string{"alt", "broken"}},
+		{[]string{"port!=443,8443"}, []string{"broken"}},
+		{[]string{"protocol=SS"}, []string{"ss"}},
+		{[]string{"remark!~^(DE|NL)$"}, []string{"notice", "ss", "broken"}},
+		{[]string{"address=1.2.3.4", "link~not-base64"}, []string{"ss", "broken"}},
+	}
+	for _, tt := range tests {
+		rules, err := ParseExcludeRules(tt.rules)
+		if err != nil {
+			t.Fatalf("ParseExcludeRules(%q): %v", tt.rules, err)
+		}
+		drop := make(map[string]bool)
+		for _, name := range tt.drop {
+			drop[name] = true
+		}
+		for name, link := range links {
+			if got := excluded(rules, link); got != drop[name] {
+				t.Errorf("rules %q: excluded(%s) = %v, want %v", tt.rules, name, got, drop[name])
+			}
+		}
+	}
+}
+
+func TestParseExcludeRule(t *testing.T) {
+	for _, s := range []string{" port != 443 ", "Remark~x", "link!~^vless://"} {
+		if _, err := ParseExcludeRule(s); err != nil {
+			t.Errorf("ParseExcludeRule(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "port", "~x", "host=a", "remark~(", "port!=", "remark!x"} {
+		if _, err := ParseExcludeRule(s); err == nil {
+			t.Errorf("ParseExcludeRule(%q) accepted", s)
+		}
+	}
+	if r, _ := ParseExcludeRule(" port != 443 "); r.String() != "port!=443" {
+		t.Errorf("String() = %q", r.String())
+	}
+	if rules, err := resolveExcludeRules([]string{"", "port!=443"}); err != nil || len(rules) != 1 {
+		t.Errorf("resolveExcludeRules = %q, %v", rules, err)
+	}
+}
@@ -0,0 +1,519 @@
+package subs
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/upload"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+
+	"github.com/spf13/cobra"
+)
+
+// unknownCountry is the group name for results without exit location data.
+const unknownCountry = "unknown"
+
+// publishGist is the --publish target uploading the export to a secret GitHub gist.
+const publishGist = "gist"
+
+// capabilities maps the --require names to whether a result has them; they are
+// recorded by 'http --udp' and 'http --policy'.
+var capabilities = map[string]func(database.HttpTestResult) bool{
+	"udp":  func(r database.HttpTestResult) bool { return r.UDP },
+	"smtp": func(r database.HttpTestResult) bool { return r.SMTP == pkghttp.PolicyOpen },
+	"p2p":  func(r database.HttpTestResult) bool { return r.P2P == pkghttp.PolicyOpen },
+}
+
+// Export formats.
+const (
+	exportPlain  = "plain"
+	exportBase64 = "base64" // newline-joined links, base64 encoded, as V2RayN/V2RayNG import them
+)
+
+// ExportConfig holds the configuration for the export command
+type ExportConfig struct {
+	RunID      int64
+	SubID      int64
+	MaxDelay   int64
+	Require    []string
+	Top        int
+	GroupBy    string
+	Format     string
+	Chunk      int
+	Flag       bool
+	OutputFile string
+	OutputDir  string
+	Publish    string
+	GistID     string
+	GistToken  string
+	SinceLast  bool
+	StateName  string
+	Changelog  string
+}
+
+// ExportCommand holds state for the export subcommand.
+type ExportCommand struct {
+	config *ExportConfig
+}
+
+// exportGroup is a set of passed configs sharing a group key, fastest first.
+type exportGroup struct {
+	name    string
+	results []database.HttpTestResult
+}
+
+// NewExportCommand builds the cobra command for exporting tested configs.
+func NewExportCommand() *cobra.Command {
+	ec := &ExportCommand{config: &ExportConfig{}}
+	return ec.createCommand()
+}
+
+func (ec *ExportCommand) createCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports configs that passed the latest HTTP test, fastest first.",
+		Long: `Exports the configs that passed an HTTP test run saved to the DB
+('xray-knife http --save-db'), sorted by latency. Configs of subscriptions with a
+higher priority ('subs update --priority') come before the others.
+
+With --group-by country, configs are split by the exit country detected during the
+test (--rip, on by default) and written to one file per country in --out-dir,
+e.g. export/DE.txt and export/NL.txt. Configs without location data go to unknown.txt.
+
+--format base64 writes the base64-encoded bundle that V2RayN, V2RayNG and most
+mobile clients import from the clipboard or a subscription URL. --chunk-size N
+splits each output file into files of at most N configs (fast_001.txt,
+fast_002.txt, ...), small enough for clients that choke on huge imports.
+
+--flag prefixes each remark with the exit country's flag and ISO code, e.g.
+"🇩🇪 DE | My server", as most public lists do. Running it on an already
+annotated remark replaces the old prefix instead of stacking a second one.
+
+--require keeps only configs with the given capabilities, which the test run
+must have checked: udp ('http --udp'), and smtp for mail-capable or p2p for
+BitTorrent-friendly exits ('http --policy').
+
+--publish gist uploads the export to a secret GitHub gist and prints its raw URL,
+a personal subscription link to add on mobile devices. The token needs the gist
+scope and is read from --gist-token or GITHUB_TOKEN. Pass the printed gist ID
+with --gist-id on later exports to update the same gist; its raw URL stays the
+same, so clients pick up the new configs on their next refresh.
+
+--since-last writes only what changed since the last --since-last export to the
+same output: one "+link" line per config added and one "-link" line per config
+removed, a small file to sync to devices over slow links. With --changelog FILE
+the output gets the full export as usual and the changes go to FILE instead.
+Exports are tracked per output file (or stdout); --state names the tracked export
+instead, e.g. one per device. The first export lists every config as added.
+
+Examples:
+  xray-knife subs export
+  xray-knife subs export --sub-id 2 --max-delay 800 -o fast.txt
+  xray-knife subs export --group-by country --top 5 --out-dir by-country
+  xray-knife subs export --format base64 --chunk-size 50 -o bundle.txt
+  xray-knife subs export --flag --top 20
+  xray-knife subs export --require p2p,udp -o p2p.txt
+  xray-knife subs export --top 30 --format base64 --publish gist
+  xray-knife subs export --top 30 --format base64 --publish gist --gist-id 4f1c0d...
+  xray-knife subs export --top 50 --since-last -o delta.txt
+  xray-knife subs export --top 50 --since-last --state phone --changelog changes.txt -o phone.txt`,
+		PreRunE:      ec.validateFlags,
+		RunE:         ec.runCommand,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.Int64Var(&ec.config.RunID, "run-id", 0, "Export results of this test run (default: the latest run)")
+	flags.Int64Var(&ec.config.SubID, "sub-id", 0, "Only export configs seen in this subscription")
+	flags.Int64Var(&ec.config.MaxDelay, "max-delay", 0, "Skip configs slower than this many ms (0 = no limit)")
+	flags.StringSliceVar(&ec.config.Require, "require", nil, "Only export configs with these capabilities (udp, smtp, p2p)")
+	flags.IntVar(&ec.config.Top, "top", 0, "Keep only the N fastest configs per group (0 = all)")
+	flags.StringVar(&ec.config.GroupBy, "group-by", "", "Group configs into separate files (country)")
+	flags.StringVar(&ec.config.Format, "format", exportPlain, "Output format (plain, base64)")
+	flags.IntVar(&ec.config.Chunk, "chunk-size", 0, "Split output into files of at most N configs (0 = no split)")
+	flags.BoolVar(&ec.config.Flag, "flag", false, "Prefix remarks with the exit country's flag emoji and ISO code")
+	flags.StringVarP(&ec.config.OutputFile, "out", "o", "-", "Output file, '-' for stdout (ignored with --group-by)")
+	flags.StringVar(&ec.config.OutputDir, "out-dir", "export", "Output directory for --group-by")
+	flags.StringVar(&ec.config.Publish, "publish", "", "Also publish the export and print its URL (gist)")
+	flags.StringVar(&ec.config.GistID, "gist-id", "", "With --publish gist, update this gist instead of creating a new one")
+	flags.StringVar(&ec.config.GistToken, "gist-token", "", "GitHub token with the gist scope (default: $GITHUB_TOKEN)")
+	flags.BoolVar(&ec.config.SinceLast, "since-last", false, "Only write the configs added and removed since the last --since-last export")
+	flags.StringVar(&ec.config.StateName, "state", "", "With --since-last, name of the tracked export (default: the output file)")
+	flags.StringVar(&ec.config.Changelog, "changelog", "", "With --since-last, write the full export to the output and the changes to this file")
+	return cmd
+}
+
+func (ec *ExportCommand) validateFlags(cmd *cobra.Command, args []string) error {
+	switch ec.config.GroupBy {
+	case "", "country":
+	default:
+		return fmt.Errorf("invalid --group-by %q (supported: country)", ec.config.GroupBy)
+	}
+	switch ec.config.Format {
+	case exportPlain, exportBase64:
+	default:
+		return fmt.Errorf("invalid --format %q (supported: %s, %s)", ec.config.Format, exportPlain, exportBase64)
+	}
+	if ec.config.Chunk < 0 {
+		return fmt.Errorf("--chunk-size must be >= 0")
+	}
+	if ec.config.Chunk > 0 && ec.config.GroupBy == "" && ec.config.OutputFile == "-" {
+		return fmt.Errorf("--chunk-size needs an output file (-o) or --group-by")
+	}
+	if ec.config.Top < 0 {
+		return fmt.Errorf("--top must be >= 0")
+	}
+	if ec.config.MaxDelay < 0 {
+		return fmt.Errorf("--max-delay must be >= 0")
+	}
+	for _, c := range ec.config.Require {
+		if _, ok := capabilities[c]; !ok {
+			return fmt.Errorf("invalid --require %q (supported: udp, smtp, p2p)", c)
+		}
+	}
+	switch ec.config.Publish {
+	case "":
+		if ec.config.GistID != "" || ec.config.GistToken != "" {
+			return fmt.Errorf("--gist-id and --gist-token require --publish gist")
+		}
+	case publishGist:
+		if ec.config.GroupBy != "" || ec.config.Chunk > 0 {
+			return fmt.Errorf("--publish cannot be combined with --group-by or --chunk-size")
+		}
+		if ec.config.GistToken == "" {
+			ec.config.GistToken = os.Getenv("GITHUB_TOKEN")
+		}
+		if ec.config.GistToken == "" {
+			return fmt.Errorf("--publish gist needs a GitHub token with the gist scope: set GITHUB_TOKEN or --gist-token")
+		}
+	default:
+		return fmt.Errorf("invalid --publish %q (supported: %s)", ec.config.Publish, publishGist)
+	}
+	if !ec.config.SinceLast {
+		if ec.config.StateName != "" || ec.config.Changelog != "" {
+			return fmt.Errorf("--state and --changelog require --since-last")
+		}
+		return nil
+	}
+	if ec.config.GroupBy != "" || ec.config.Publish != "" || ec.config.Chunk > 0 {
+		return fmt.Errorf("--since-last cannot be combined with --group-by, --publish or --chunk-size")
+	}
+	if ec.config.Changelog == "" && ec.config.Format != exportPlain {
+		return fmt.Errorf("--since-last writes +/- lines and needs --format plain, or --changelog for the changes")
+	}
+	if ec.config.Changelog == "-" {
+		return fmt.Errorf("--changelog needs a file")
+	}
+	return nil
+}
+
+func (ec *ExportCommand) runCommand(cmd *cobra.Command, args []string) error {
+	results, err := database.GetPassedHttpTestResults(ec.config.RunID, ec.config.SubID)
+	if err != nil {
+		return err
+	}
+	if ec.config.MaxDelay > 0 {
+		kept := results[:0]
+		for _, r := range results {
+			if r.DelayMs <= ec.config.MaxDelay {
+				kept = append(kept, r)
+			}
+		}
+		results = kept
+	}
+	if len(ec.config.Require) > 0 {
+		results = requireCapabilities(results, ec.config.Require)
+	}
+	if ec.config.Flag {
+		for i := range results {
+			results[i].ConfigLink = annotateCountry(results[i].ConfigLink, results[i].IPLocation.String)
+		}
+	}
+	if len(results) == 0 {
+		customlog.Printf(customlog.Warning, "No passed configs to export. Run 'xray-knife http' against the DB first.\n")
+		return nil
+	}
+
+	if ec.config.GroupBy == "" {
+		group := ec.trim(exportGroup{name: "all", results: results})
+		if ec.config.SinceLast {
+			return ec.exportChanges(group.results)
+		}
+		if ec.config.Publish != "" {
+			return ec.publish(cmd.Context(), group.results)
+		}
+		if ec.config.OutputFile == "-" {
+			data := ec.encode(group.results)
+			if ec.config.Format == exportBase64 {
+				data = append(data, '\n')
+			}
+			return utils.WriteIntoFile("-", data)
+		}
+		paths, err := ec.writeChunks(ec.config.OutputFile, group.results)
+		if err != nil {
+			return err
+		}
+		customlog.Printf(customlog.Success, "Exported %d configs to %s\n", len(group.results), strings.Join(paths, ", "))
+		return nil
+	}
+
+	groups := groupByCountry(results)
+	if err := os.MkdirAll(ec.config.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "COUNTRY\tCONFIGS\tBEST DELAY\tFILE")
+	fmt.Fprintln(w, "-------\t-------\t----------\t----")
+	for _, g := range groups {
+		g = ec.trim(g)
+		paths, err := ec.writeChunks(filepath.Join(ec.config.OutputDir, g.name+".txt"), g.results)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\t%dms\t%s\n", g.name, len(g.results), g.results[0].DelayMs, strings.Join(paths, ", "))
+	}
+	return w.Flush()
+}
+
+// requireCapabilities keeps the results having every capability in names.
+func requireCapabilities(results []database.HttpTestResult, names []string) []database.HttpTestResult {
+	kept := results[:0]
+	for _, r := range results {
+		ok := true
+		for _, name := range names {
+			ok = ok && capabilities[name](r)
+		}
+		if ok {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// publish uploads the export to a gist, also writing it to -o when a file is given.
+func (ec *ExportCommand) publish(ctx context.Context, results []database.HttpTestResult) error {
+	data := ec.encode(results)
+	name := "xray-knife.txt"
+	if ec.config.OutputFile != "-" {
+		if err := os.WriteFile(ec.config.OutputFile, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", ec.config.OutputFile, err)
+		}
+		name = filepath.Base(ec.config.OutputFile)
+	}
+
+	description := fmt.Sprintf("xray-knife export: %d configs", len(results))
+	gist, err := upload.PublishGist(ctx, ec.config.GistToken, ec.config.GistID, name, description, data)
+	if err != nil {
+		return err
+	}
+	if ec.config.GistID == "" {
+		customlog.Printf(customlog.Success, "Published %d configs to a new secret gist. Update it later with --gist-id %s\n", len(results), gist.ID)
+	} else {
+		customlog.Printf(customlog.Success, "Updated gist %s with %d configs.\n", gist.ID, len(results))
+	}
+	fmt.Println(gist.RawURL())
+	return nil
+}
+
+// exportChanges writes what changed since the last export to the same target,
+// or the full export and a changelog, then records this export as the last one.
+func (ec *ExportCommand) exportChanges(results []database.HttpTestResult) error {
+	name, err := ec.stateName()
+	if err != nil {
+		return err
+	}
+	var previous []string
+	state, err := database.GetExportState(name)
+	switch {
+	case err == nil:
+		previous = state.LinkSet()
+	case errors.Is(err, database.ErrNotFound):
+		customlog.Printf(customlog.Info, "No earlier export to %s, every config is new.\n", name)
+	default:
+		return err
+	}
+
+	current := linkList(results)
+	added, removed := diffLinks(previous, current)
+	changes := formatChanges(added, removed)
+	if ec.config.Changelog != "" {
+		data := ec.encode(results)
+		if ec.config.OutputFile == "-" && ec.config.Format == exportBase64 {
+			data = append(data, '\n')
+		}
+		if err := utils.WriteIntoFile(ec.config.OutputFile, data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", ec.config.OutputFile, err)
+		}
+		if err := os.WriteFile(ec.config.Changelog, changes, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", ec.config.Changelog, err)
+		}
+	} else if err := utils.WriteIntoFile(ec.config.OutputFile, changes); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ec.config.OutputFile, err)
+	}
+
+	if err := database.SaveExportState(name, current); err != nil {
+		return err
+	}
+	customlog.Printf(customlog.Success, "Exported %d configs to %s: %d added, %d removed since the last export.\n", len(current), name, len(added), len(removed))
+	return nil
+}
+
+// stateName returns the name --since-last tracks the export under: --state, or
+// the absolute path of the output file.
+func (ec *ExportCommand) stateName() (string, error) {
+	if ec.config.StateName != "" {
+		return ec.config.StateName, nil
+	}
+	if ec.config.OutputFile == "-" {
+		return "stdout", nil
+	}
+	path, err := filepath.Abs(ec.config.OutputFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ec.config.OutputFile, err)
+	}
+	return path, nil
+}
+
+// formatChanges renders a changelog: a "+link" line per added link followed by
+// a "-link" line per removed one.
+func formatChanges(added, removed []string) []byte {
+	var b strings.Builder
+	for _, l := range added {
+		b.WriteString("+" + l + "\n")
+	}
+	for _, l := range removed {
+		b.WriteString("-" + l + "\n")
+	}
+	return []byte(b.String())
+}
+
+// trim applies --top to a group.
+func (ec *ExportCommand) trim(g exportGroup) exportGroup {
+	if ec.config.Top > 0 && len(g.results) > ec.config.Top {
+		g.results = g.results[:ec.config.Top]
+	}
+	return g
+}
+
+// writeChunks writes results to path, or with --chunk-size to numbered files next
+// to it (name_001.txt, name_002.txt, ...). It returns the paths written.
+func (ec *ExportCommand) writeChunks(path string, results []database.HttpTestResult) ([]string, error) {
+	size := ec.config.Chunk
+	if size == 0 || len(results) <= size {
+		if err := os.WriteFile(path, ec.encode(results), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return []string{path}, nil
+	}
+
+	var paths []string
+	for i := 0; i < len(results); i += size {
+		chunk := results[i:min(i+size, len(results))]
+		p := utils.ChunkFileName(path, len(paths)+1)
+		if err := os.WriteFile(p, ec.encode(chunk), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", p, err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// encode renders results in the selected --format.
+func (ec *ExportCommand) encode(results []database.HttpTestResult) []byte {
+	links := linksOf(results)
+	if ec.config.Format != exportBase64 {
+		return links
+	}
+	return []byte(base64.StdEncoding.EncodeToString(links))
+}
+
+// groupByCountry splits sorted results by exit country, keeping their order.
+// Groups are sorted by size, largest first. The location is reported through
+// the config under test, so anything but an ISO country code counts as unknown
+// rather than ending up in a file name.
+func groupByCountry(results []database.HttpTestResult) []exportGroup {
+	index := make(map[string]int)
+	var groups []exportGroup
+	for _, r := range results {
+		country := unknownCountry
+		if loc := strings.ToUpper(strings.TrimSpace(r.IPLocation.String)); r.IPLocation.Valid && utils.CountryFlag(loc) != "" {
+			country = loc
+		}
+		i, ok := index[country]
+		if !ok {
+			i = len(groups)
+			index[country] = i
+			groups = append(groups, exportGroup{name: country})
+		}
+		groups[i].results = append(groups[i].results, r)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].results) > len(groups[j].results)
+	})
+	return groups
+}
+
+// annotateCountry prefixes the link's remark with the flag and ISO code of country,
+// replacing an earlier annotation. Links with an unknown country are returned as is.
+func annotateCountry(link, country string) string {
+	code := strings.ToUpper(strings.TrimSpace(country))
+	flag := utils.CountryFlag(code)
+	if flag == "" {
+		return link
+	}
+	remark := stripCountryPrefix(utils.LinkRemark(link))
+	prefix := flag + " " + code
+	if remark != "" {
+		prefix += " | " + remark
+	}
+	annotated, err := utils.SetLinkRemark(link, prefix)
+	if err != nil {
+		return link
+	}
+	return annotated
+}
+
+// stripCountryPrefix removes a leading "<flag> <CC> | " written by annotateCountry.
+func stripCountryPrefix(remark string) string {
+	runes := []rune(remark)
+	if len(runes) < 2 || !isRegionalIndicator(runes[0]) || !isRegionalIndicator(runes[1]) {
+		return remark
+	}
+	rest := strings.TrimSpace(string(runes[2:]))
+	if len(rest) >= 2 && utils.CountryFlag(rest[:2]) != "" {
+		rest = strings.TrimSpace(rest[2:])
+	}
+	return strings.TrimSpace(strings.TrimPrefix(rest, "|"))
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func linkList(results []database.HttpTestResult) []string {
+	links := make([]string, len(results))
+	for i, r := range results {
+		links[i] = r.ConfigLink
+	}
+	return links
+}
+
+func linksOf(results []database.HttpTestResult) []byte {
+	var b strings.Builder
+	for _, r := range results {
+		b.WriteString(r.ConfigLink)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,79 @@
+package subs
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+func TestAnnotateCountry(t *testing.T) {
+	tests := []struct {
+		name, link, country, want string
+	}{
+		{"adds prefix", "trojan://pw@h:443?security=tls#My%20server", "de", "🇩🇪 DE | My server"},
+		{"no remark", "trojan://pw@h:443", "NL", "🇳🇱 NL"},
+		{"replaces old prefix", "trojan://pw@h:443#%F0%9F%87%A9%F0%9F%87%AA%20DE%20%7C%20Fast", "FR", "🇫🇷 FR | Fast"},
+		{"unknown country", "trojan://pw@h:443#x", "XX", "x"},
+		{"vmess", "vmess://eyJhZGQiOiIxLjIuMy40IiwicHMiOiJ2bSJ9", "US", "🇺🇸 US | vm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utils.LinkRemark(annotateCountry(tt.link, tt.country))
+			if got != tt.want {
+				t.Errorf("remark = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByCountry(t *testing.T) {
+	loc := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	results := []database.HttpTestResult{
+		{ConfigLink: "a", IPLocation: loc("de")},
+		{ConfigLink: "b", IPLocation: loc("../../x")},
+		{ConfigLink: "c", IPLocation: loc("DE")},
+		{ConfigLink: "d", IPLocation: loc("null")},
+		{ConfigLink: "e"},
+		{ConfigLink: "f", IPLocation: loc("..")},
+		{ConfigLink: "g", IPLocation: loc("NL")},
+	}
+	groups := groupByCountry(results)
+	got := map[string]int{}
+	for _, g := range groups {
+		got[g.name] = len(g.results)
+	}
+	if len(got) != 3 || got["DE"] != 2 || got[unknownCountry] != 4 || got["NL"] != 1 {
+		t.Errorf("groups = %v, want DE:2 NL:1 %s:4", got, unknownCountry)
+	}
+	if groups[0].name != unknownCountry {
+		t.Errorf("largest group = %s, want %s first", groups[0].name, unknownCountry)
+	}
+}
+
+func TestRequireCapabilities(t *testing.T) {
+	results := []database.HttpTestResult{
+		{ConfigLink: "a", UDP: true, SMTP: "open", P2P: "open"},
+		{ConfigLink: "b", UDP: true, SMTP: "blocked", P2P: "open"},
+		{ConfigLink: "c", SMTP: "open"},
+		{ConfigLink: "d"},
+	}
+	got := requireCapabilities(results, []string{"p2p", "udp"})
+	if len(got) != 2 || got[0].ConfigLink != "a" || got[1].ConfigLink != "b" {
+		t.Errorf("requireCapabilities(p2p, udp) = %+v", got)
+	}
+	got = requireCapabilities(got, []string{"smtp"})
+	if len(got) != 1 || got[0].ConfigLink != "a" {
+		t.Errorf("requireCapabilities(smtp) = %+v", got)
+	}
+}
+
+func TestFormatChanges(t *testing.T) {
+	if got := string(formatChanges([]string{"d", "e"}, []string{"b"})); got != "+d\n+e\n-b\n" {
+		t.Errorf("formatChanges = %q", got)
+	}
+	if got := formatChanges(nil, nil); len(got) != 0 {
+		t.Errorf("formatChanges without changes = %q", got)
+	}
+}
@@ -1,8 +1,14 @@
 package subs
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -11,6 +17,7 @@ import (
 	"github.com/alitto/pond/v2"
 	"github.com/lilendian0x00/xray-knife/v9/database"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
 
@@ -23,10 +30,46 @@ type FetchConfig struct {
 	SubscriptionURL string
 	UserAgent       string
 	OutputFile      string
+	ChunkSize       int
 	Proxy           string
 	FetchAll        bool
 	FileInput       string
 	Workers         int
+	BatchSize       int
+	DisableAfter    int
+	PerHost         int
+	DelayPerHost    time.Duration
+	KeepSnapshots   int
+	SnapshotMaxAge  time.Duration
+	HTMLSelector    string
+	HTMLPattern     string
+	TelegramPages   int
+	Impersonate     string
+	MaxRedirects    int
+	MaxPerSub       int
+	Sample          string
+}
+
+// DefaultMaxWorkers is the highest --workers accepted unless raised.
+const DefaultMaxWorkers = 20
+
+// MaxWorkersEnv names the environment variable overriding MaxWorkers.
+const MaxWorkersEnv = "XRAY_KNIFE_MAX_WORKERS"
+
+// MaxWorkers is the highest --workers accepted; a higher value is lowered to it
+// with a warning. It is set from the fetch.max-workers setting.
+var MaxWorkers = DefaultMaxWorkers
+
+// maxWorkers returns MaxWorkers, or the value of MaxWorkersEnv if that is a
+// positive number.
+func maxWorkers() int {
+	if v := os.Getenv(MaxWorkersEnv); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		customlog.Printf(customlog.Warning, "Ignoring %s=%q: not a positive number.\n", MaxWorkersEnv, v)
+	}
+	return max(MaxWorkers, 1)
 }
 
 // FetchCommand holds state for the fetch subcommand.
@@ -52,20 +95,79 @@ func (fc *FetchCommand) createCommand() *cobra.Command {
 
 Supports multiple input modes:
   --id <N>       Fetch from a subscription stored in the DB by its ID.
-  --url <URL>    One-off fetch from a URL (configs saved to DB but not linked to a subscription).
+  --url <URL>    One-off fetch from a URL or local file (configs saved to DB but not linked to a subscription).
   --all          Fetch from all enabled subscriptions in the DB.
   --file <PATH>  Read subscription URLs from a file (one per line) and fetch each concurrently.
 
+Anywhere a URL is expected, a local path or file:// URL works too: the file is read
+like a subscription body (base64 or one link per line).
+
 Use --workers to control concurrency for --file and --all modes (default: 3).
-Fetched configs are parsed, deduplicated, and upserted into the local database.
-Optionally write the fetched configs to a file with --out.
+It is capped at ` + strconv.Itoa(DefaultMaxWorkers) + `; mirror lists of hundreds of URLs can raise the cap with
+fetch.max-workers in the config file or the ` + MaxWorkersEnv + ` variable.
+Each unique URL is requested once: repeated URLs in --file are skipped, and
+subscriptions sharing a URL and User-Agent in --all share a single download.
+Fetches are also polite towards each provider: at most --per-host downloads run
+against one domain at a time (default: 1), and --delay-per-host spaces out
+consecutive downloads from the same domain. URLs are queued alternating between
+domains, so workers don't all wait on one busy provider.
+Subscriptions are streamed: links are parsed and upserted into the local database
+in batches of --batch-size, so memory stays bounded even for very large payloads.
+All workers share one writer that commits each batch in a single transaction.
+Optionally write the fetched configs to a file with --out; --chunk-size N splits
+it into files of at most N configs (configs_001.txt, configs_002.txt, ...) for
+clients that choke on importing tens of thousands of lines.
+
+The raw payload of every successful fetch of a DB subscription is archived,
+compressed, when it changed since the last fetch. --keep-snapshots sets how many
+are kept per subscription and --snapshot-max-age drops old ones; browse them with
+'xray-knife subs snapshot'.
+
+Subscriptions with mirrors ('subs add --mirror') fall back to them in order when
+their URL can't be fetched, or race them all with --race-mirrors; the mirror
+that served the fetch is recorded.
+
+Links matching the exclusion rules of a subscription ('subs add --exclude'), such
+as the traffic and expiry notices panels slip in as fake configs, are dropped
+before --max-per-sub picks its sample and never reach the DB or --out.
+
+Panels often answer with a format picked by the client they see: --useragent
+takes a User-Agent or the name of a client preset (clash, v2rayng, shadowrocket,
+...). Requests carry Chrome's TLS fingerprint unless --impersonate picks
+firefox, safari or none (Go's own), for panels that block one of them.
+
+Links are scraped from HTML pages (a public Telegram channel preview, a paste
+site, a blog post) instead of failing to decode them. --html-selector limits the
+search to matching elements and --html-pattern replaces the built-in link regex;
+both override the values stored with 'subs add' or 'subs update'. Telegram
+channels (t.me/s/<channel>, added with 'subs add --telegram') are read from the
+latest post back, --telegram-pages pages of about 20 posts each.
+
+Shared subscription links are often shorteners or redirect chains. Up to
+--max-redirects redirects are followed, and where a DB subscription finally led
+is recorded ('subs show --verbose'). A warning is printed when that destination
+changes between fetches, or when an https link ends up on plain http, as the
+shortener or a hop of the chain may have been hijacked.
+
+Some subscriptions carry tens of thousands of configs. --max-per-sub N keeps at
+most N links of each downloaded payload, picked by --sample: first (the first N
+served), random (N drawn from the whole payload) or spread (N shared out evenly
+between the protocols, so a long tail of one protocol doesn't crowd out the
+rest). How many links were skipped is reported and, for DB subscriptions, shown
+by 'subs show --verbose'.
 
 Examples:
   xray-knife subs fetch --id 1
   xray-knife subs fetch --url "https://example.com/sub"
+  xray-knife subs fetch --url ./configs-from-a-friend.txt
   xray-knife subs fetch --all
   xray-knife subs fetch --file urls.txt --workers 5
-  xray-knife subs fetch --file urls.txt --out configs.txt`,
+  xray-knife subs fetch --file urls.txt --out configs.txt
+  xray-knife subs fetch --all --chunk-size 5000
+  xray-knife subs fetch --all --workers 8 --per-host 2 --delay-per-host 3s
+  xray-knife subs fetch --id 3 --useragent v2rayng --impersonate firefox
+  xray-knife subs fetch --all --max-per-sub 2000 --sample spread
+  xray-knife subs fetch --url "https://t.me/s/somechannel" --html-selector ".tgme_widget_message_text"`,
 		RunE:         fc.runCommand,
 		PreRunE:      fc.validateFlags,
 		SilenceUsage: true,
@@ -77,13 +179,27 @@ Examples:
 func (fc *FetchCommand) addFlags(cmd *cobra.Command) {
 	flags := cmd.Flags()
 	flags.Int64Var(&fc.config.SubscriptionID, "id", 0, "The ID of the subscription from the DB")
-	flags.StringVarP(&fc.config.SubscriptionURL, "url", "u", "", "A one-off subscription URL to fetch from")
-	flags.StringVarP(&fc.config.UserAgent, "useragent", "a", "", "Custom User-agent to be used (overrides DB value)")
+	flags.StringVarP(&fc.config.SubscriptionURL, "url", "u", "", "A one-off subscription URL or local file to fetch from")
+	flags.StringVarP(&fc.config.UserAgent, "useragent", "a", "", "Custom User-agent or preset ("+userAgentPresetNames()+") to be used (overrides DB value)")
+	flags.StringVar(&fc.config.Impersonate, "impersonate", "", "TLS fingerprint to fetch with: "+strings.Join(ImpersonationNames, ", ")+" (overrides DB value, default chrome)")
 	flags.StringVarP(&fc.config.OutputFile, "out", "o", "configs.txt", "Output file for fetched configs (default: configs.txt).")
+	flags.IntVar(&fc.config.ChunkSize, "chunk-size", 0, "Split the output file into files of at most N configs (0 = no split)")
 	flags.StringVarP(&fc.config.Proxy, "proxy", "p", "", "Proxy to use for fetching the subscription")
 	flags.BoolVar(&fc.config.FetchAll, "all", false, "Fetch from all enabled subscriptions in the DB")
 	flags.StringVarP(&fc.config.FileInput, "file", "f", "", "File containing subscription URLs (one per line)")
 	flags.IntVarP(&fc.config.Workers, "workers", "w", 3, "Number of concurrent workers for --file and --all modes")
+	flags.IntVar(&fc.config.BatchSize, "batch-size", 500, "Number of configs parsed and committed to the DB per transaction")
+	flags.IntVar(&fc.config.DisableAfter, "disable-after", 5, "Disable a DB subscription after this many consecutive failed fetches (0 = never)")
+	flags.IntVar(&fc.config.PerHost, "per-host", 1, "Maximum concurrent fetches against one provider domain for --file and --all modes (0 = unlimited)")
+	flags.DurationVar(&fc.config.DelayPerHost, "delay-per-host", 0, "Minimum delay between fetches from the same provider domain, e.g. 2s")
+	flags.IntVar(&fc.config.KeepSnapshots, "keep-snapshots", 10, "Archived payloads to keep per DB subscription (0 = don't archive)")
+	flags.DurationVar(&fc.config.SnapshotMaxAge, "snapshot-max-age", 0, "Also drop archived payloads older than this, e.g. 720h (the latest is always kept)")
+	flags.StringVar(&fc.config.HTMLSelector, "html-selector", "", "CSS selector of the elements holding the links of an HTML page (overrides DB value)")
+	flags.IntVar(&fc.config.TelegramPages, "telegram-pages", DefaultTelegramPages, "Pages of posts read from each Telegram channel")
+	flags.StringVar(&fc.config.HTMLPattern, "html-pattern", "", "Regex matching the links in a page or body, group 1 if any (overrides DB value)")
+	flags.IntVar(&fc.config.MaxRedirects, "max-redirects", DefaultMaxRedirects, "Redirects to follow before giving up on a subscription URL")
+	flags.IntVar(&fc.config.MaxPerSub, "max-per-sub", 0, "Keep at most N links of each subscription (0 = all)")
+	flags.StringVar(&fc.config.Sample, "sample", sampleFirst, "Links kept with --max-per-sub: "+strings.Join(sampleStrategies, ", "))
 
 	cmd.MarkFlagsMutuallyExclusive("id", "url", "all", "file")
 }
@@ -95,25 +211,98 @@ func (fc *FetchCommand) validateFlags(cmd *cobra.Command, args []string) error {
 	if fc.config.Workers < 1 {
 		return fmt.Errorf("--workers must be at least 1, got %d", fc.config.Workers)
 	}
-	if fc.config.Workers > 20 {
-		return fmt.Errorf("--workers must be at most 20, got %d", fc.config.Workers)
+	if limit := maxWorkers(); fc.config.Workers > limit {
+		customlog.Printf(customlog.Warning, "--workers %d is above the limit of %d, using %d; raise it with fetch.max-workers or %s.\n", fc.config.Workers, limit, limit, MaxWorkersEnv)
+		fc.config.Workers = limit
 	}
-	return nil
+	if fc.config.SubscriptionURL != "" {
+		subURL, err := ResolveSubscriptionURL(fc.config.SubscriptionURL)
+		if err != nil {
+			return err
+		}
+		fc.config.SubscriptionURL = subURL
+	}
+	if _, err := newScrapeOptions(fc.config.HTMLSelector, fc.config.HTMLPattern); err != nil {
+		return err
+	}
+	if err := validateImpersonation(fc.config.Impersonate); err != nil {
+		return err
+	}
+	if fc.config.ChunkSize < 0 {
+		return fmt.Errorf("--chunk-size must be >= 0, got %d", fc.config.ChunkSize)
+	}
+	if fc.config.ChunkSize > 0 && (fc.config.OutputFile == "" || fc.config.OutputFile == "-") {
+		return fmt.Errorf("--chunk-size needs an output file (--out)")
+	}
+	if fc.config.TelegramPages < 1 {
+		return fmt.Errorf("--telegram-pages must be at least 1, got %d", fc.config.TelegramPages)
+	}
+	if fc.config.MaxRedirects < 1 {
+		return fmt.Errorf("--max-redirects must be at least 1, got %d", fc.config.MaxRedirects)
+	}
+	if fc.config.KeepSnapshots < 0 {
+		return fmt.Errorf("--keep-snapshots must not be negative, got %d", fc.config.KeepSnapshots)
+	}
+	if fc.config.SnapshotMaxAge < 0 {
+		return fmt.Errorf("--snapshot-max-age must not be negative, got %s", fc.config.SnapshotMaxAge)
+	}
+	if fc.config.BatchSize < 1 {
+		return fmt.Errorf("--batch-size must be at least 1, got %d", fc.config.BatchSize)
+	}
+	if fc.config.DisableAfter < 0 {
+		return fmt.Errorf("--disable-after must be >= 0, got %d", fc.config.DisableAfter)
+	}
+	if fc.config.PerHost < 0 {
+		return fmt.Errorf("--per-host must be >= 0, got %d", fc.config.PerHost)
+	}
+	if fc.config.DelayPerHost < 0 {
+		return fmt.Errorf("--delay-per-host must be >= 0, got %s", fc.config.DelayPerHost)
+	}
+	if fc.config.DelayPerHost > 0 && fc.config.PerHost == 0 {
+		return fmt.Errorf("--delay-per-host needs --per-host to be at least 1")
+	}
+	if fc.config.MaxPerSub < 0 {
+		return fmt.Errorf("--max-per-sub must be >= 0, got %d", fc.config.MaxPerSub)
+	}
+	if fc.config.Sample == "" {
+		fc.config.Sample = sampleFirst
+	}
+	return validateSampleStrategy(fc.config.Sample)
+}
+
+// Fetch runs a fetch as 'subs fetch' does with the equivalent flags, for callers that
+// trigger fetches without the CLI. Zero Workers and BatchSize take the flag defaults.
+func Fetch(ctx context.Context, config FetchConfig) error {
+	if config.Workers == 0 {
+		config.Workers = 3
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = 500
+	}
+	fc := &FetchCommand{config: &config, core: core.NewAutomaticCore(false, false)}
+	if err := fc.validateFlags(nil, nil); err != nil {
+		return err
+	}
+	return fc.run(ctx)
 }
 
 // runCommand executes the fetch command logic
 func (fc *FetchCommand) runCommand(cmd *cobra.Command, args []string) error {
+	return fc.run(cmd.Context())
+}
+
+func (fc *FetchCommand) run(ctx context.Context) error {
 	if fc.config.FetchAll {
-		return fc.fetchAllSubscriptions()
+		return fc.fetchAllSubscriptions(ctx)
 	}
 	if fc.config.FileInput != "" {
-		return fc.fetchFromFile()
+		return fc.fetchFromFile(ctx)
 	}
-	return fc.fetchSingle()
+	return fc.fetchSingle(ctx)
 }
 
 // fetchSingle handles --id and --url modes (no concurrency needed)
-func (fc *FetchCommand) fetchSingle() error {
+func (fc *FetchCommand) fetchSingle(ctx context.Context) error {
 	var subToFetch Subscription
 	var subscriptionID sql.NullInt64
 
@@ -124,10 +313,21 @@ func (fc *FetchCommand) fetchSingle() error {
 		}
 		subToFetch.Url = dbSub.URL
 		subToFetch.UserAgent = dbSub.UserAgent.String
+		subToFetch.Impersonate = fc.impersonationFor(*dbSub)
+		if subToFetch.Auth, err = dbSub.Credentials(); err != nil {
+			return err
+		}
+		subToFetch.HTMLSelector, subToFetch.HTMLPattern = fc.scrapeFor(*dbSub)
+		subToFetch.Mirrors, subToFetch.RaceMirrors = dbSub.MirrorURLs(), dbSub.RaceMirrors
+		if subToFetch.Exclude, err = ParseExcludeRules(dbSub.ExcludeRuleList()); err != nil {
+			return fmt.Errorf("subscription %d: %w", dbSub.ID, err)
+		}
 		subscriptionID = sql.NullInt64{Int64: dbSub.ID, Valid: true}
 		customlog.Printf(customlog.Processing, "Fetching from DB subscription ID %d: %s\n", dbSub.ID, dbSub.URL)
 	} else {
 		subToFetch.Url = fc.config.SubscriptionURL
+		subToFetch.Impersonate = fc.config.Impersonate
+		subToFetch.HTMLSelector, subToFetch.HTMLPattern = fc.config.HTMLSelector, fc.config.HTMLPattern
 		subscriptionID.Valid = false // One-off fetch, not linked to a subscription
 		customlog.Printf(customlog.Processing, "Fetching from URL: %s\n", subToFetch.Url)
 		customlog.Printf(customlog.Warning, "One-off fetch: configs will not be linked to any subscription.\n")
@@ -137,8 +337,10 @@ func (fc *FetchCommand) fetchSingle() error {
 		subToFetch.UserAgent = fc.config.UserAgent
 	}
 	subToFetch.Proxy = fc.config.Proxy
+	subToFetch.TelegramPages = fc.config.TelegramPages
+	subToFetch.MaxRedirects = fc.config.MaxRedirects
 
-	return fc.doFetch(&subToFetch, subscriptionID)
+	return fc.doFetch(ctx, &subToFetch, subscriptionID)
 }
 
 // fetchResult stores per-URL results for concurrent fetching
@@ -150,7 +352,7 @@ type fetchResult struct {
 }
 
 // fetchAllSubscriptions handles --all mode with concurrency
-func (fc *FetchCommand) fetchAllSubscriptions() error {
+func (fc *FetchCommand) fetchAllSubscriptions(ctx context.Context) error {
 	subs, err := database.ListSubscriptions()
 	if err != nil {
 		return err
@@ -169,86 +371,126 @@ func (fc *FetchCommand) fetchAllSubscriptions() error {
 		return nil
 	}
 
+	// Subscriptions with the same URL and User-Agent get the same payload; fetch it once.
+	groups := fc.groupSubscriptions(enabled)
+	if shared := len(enabled) - len(groups); shared > 0 {
+		customlog.Printf(customlog.Info, "%d subscription(s) share a URL with another; each unique URL is fetched once.\n", shared)
+	}
+
 	workers := fc.config.Workers
-	if workers > len(enabled) {
-		workers = len(enabled)
+	if workers > len(groups) {
+		workers = len(groups)
 	}
 
 	customlog.Printf(customlog.Processing, "Fetching from %d enabled subscription(s) with %d worker(s)...\n", len(enabled), workers)
 
+	out := fc.newOutputWriter()
+	defer out.Close()
+	// All workers share a single writer so DB writes are serialized into large transactions.
+	writer := database.NewConfigBatchWriter(fc.config.BatchSize)
+
 	pool := pond.NewPool(workers)
 	defer pool.StopAndWait()
+	limiter := newHostLimiter(fc.config.PerHost, fc.config.DelayPerHost)
+	groups = interleaveByHost(groups, func(g []database.Subscription) string { return g[0].URL })
 
 	var (
-		mu          sync.Mutex
-		allConfigs  []database.SubscriptionConfig
-		totalRaw    int
+		totalRaw    int64
 		failedCount int32
 		doneCount   int32
 	)
 
-	for _, sub := range enabled {
-		sub := sub // capture loop variable
+	for _, group := range groups {
+		group := group // capture loop variable
 		pool.Submit(func() {
-			remark := fmt.Sprintf("#%d", sub.ID)
-			if sub.Remark.Valid && sub.Remark.String != "" {
-				remark = sub.Remark.String
+			// Subscriptions still queued when the user interrupts are skipped.
+			if ctx.Err() != nil {
+				return
+			}
+			first := group[0]
+			release, err := limiter.acquire(ctx, first.URL)
+			if err != nil {
+				return
 			}
+			defer release()
+
+			remarks := make([]string, len(group))
+			subIDs := make([]sql.NullInt64, len(group))
+			for i, sub := range group {
+				remarks[i] = subscriptionLabel(sub)
+				subIDs[i] = sql.NullInt64{Int64: sub.ID, Valid: true}
+			}
+			remark := strings.Join(remarks, ", ")
 
 			idx := atomic.AddInt32(&doneCount, 1)
-			customlog.Printf(customlog.Processing, "[%d/%d] Fetching %q (%s)\n", idx, len(enabled), remark, sub.URL)
+			customlog.Printf(customlog.Processing, "[%d/%d] Fetching %q (%s)\n", idx, len(groups), remark, first.URL)
 
 			subToFetch := Subscription{
-				Url:       sub.URL,
-				UserAgent: sub.UserAgent.String,
-				Proxy:     fc.config.Proxy,
+				Url:           first.URL,
+				UserAgent:     fc.userAgentFor(first),
+				Impersonate:   fc.impersonationFor(first),
+				Proxy:         fc.config.Proxy,
+				TelegramPages: fc.config.TelegramPages,
+				MaxRedirects:  fc.config.MaxRedirects,
 			}
-			if fc.config.UserAgent != "" {
-				subToFetch.UserAgent = fc.config.UserAgent
+			subToFetch.HTMLSelector, subToFetch.HTMLPattern = fc.scrapeFor(first)
+			subToFetch.Mirrors, subToFetch.RaceMirrors = first.MirrorURLs(), first.RaceMirrors
+
+			var rawCount, saved, skipped int
+			var fetchErr error
+			subToFetch.Auth, fetchErr = first.Credentials()
+			if fetchErr == nil {
+				subToFetch.Exclude, fetchErr = ParseExcludeRules(first.ExcludeRuleList())
 			}
-
-			rawLinks, fetchErr := subToFetch.FetchAll()
-			if fetchErr != nil {
-				customlog.Printf(customlog.Failure, "Failed to fetch subscription %d (%s): %v\n", sub.ID, remark, fetchErr)
-				atomic.AddInt32(&failedCount, 1)
-				return
+			if fetchErr == nil {
+				rawCount, saved, skipped, fetchErr = fc.streamFetch(ctx, &subToFetch, subIDs, writer, out)
 			}
-
-			subID := sql.NullInt64{Int64: sub.ID, Valid: true}
-			dbConfigs := fc.parseLinks(rawLinks, subID)
-
-			if len(dbConfigs) > 0 {
-				if err := database.UpsertSubscriptionConfigs(dbConfigs); err != nil {
-					customlog.Printf(customlog.Failure, "Failed to save configs for subscription %d: %v\n", sub.ID, err)
-					atomic.AddInt32(&failedCount, 1)
+			atomic.AddInt64(&totalRaw, int64(rawCount))
+			if fetchErr != nil {
+				if ctx.Err() != nil {
 					return
 				}
-				if err := database.UpdateSubscriptionFetched(sub.ID, time.Now()); err != nil {
-					customlog.Printf(customlog.Warning, "Failed to update last fetched timestamp for %d: %v\n", sub.ID, err)
+				for _, sub := range group {
+					customlog.Printf(customlog.Failure, "Failed to fetch subscription %d (%s): %v\n", sub.ID, subscriptionLabel(sub), fetchErr)
+					atomic.AddInt32(&failedCount, 1)
+					fc.recordFailure(sub.ID, fetchErr)
 				}
-				customlog.Printf(customlog.Success, "Subscription %d (%s): fetched %d links, saved %d configs.\n", sub.ID, remark, len(rawLinks), len(dbConfigs))
-			} else {
-				customlog.Printf(customlog.Warning, "Subscription %d (%s): no valid configs found.\n", sub.ID, remark)
+				return
 			}
 
-			mu.Lock()
-			allConfigs = append(allConfigs, dbConfigs...)
-			totalRaw += len(rawLinks)
-			mu.Unlock()
+			for _, sub := range group {
+				checkResolvedURL(sub.ID, subToFetch.Url, subToFetch.ResolvedURL)
+				checkFetchedFrom(sub.ID, &subToFetch)
+				if saved > 0 {
+					writer.MarkFetched(sub.ID, time.Now())
+					writer.MarkSkipped(sub.ID, skipped)
+					customlog.Printf(customlog.Success, "Subscription %d (%s): fetched %d links, saved %d configs%s.\n", sub.ID, subscriptionLabel(sub), rawCount, saved, skippedNote(skipped, subToFetch.Excluded))
+				} else {
+					customlog.Printf(customlog.Warning, "Subscription %d (%s): no valid configs found.\n", sub.ID, subscriptionLabel(sub))
+				}
+			}
 		})
 	}
 
 	pool.StopAndWait()
 
-	failed := atomic.LoadInt32(&failedCount)
-	customlog.Printf(customlog.Finished, "All done: %d links fetched, %d configs saved, %d failed.\n", totalRaw, len(allConfigs), failed)
-
-	if fc.config.OutputFile != "" && len(allConfigs) > 0 {
-		if err := fc.saveConfigsToFile(allConfigs); err != nil {
-			return fmt.Errorf("failed to save configurations to file: %w", err)
+	// The rows of a subscription that failed to save in a batch triggered by
+	// another worker are only reported here.
+	writer.Flush()
+	for id, err := range writer.Failed() {
+		customlog.Printf(customlog.Failure, "Failed to save the configs of subscription %d: %v\n", id, err)
+		atomic.AddInt32(&failedCount, 1)
+		if id != 0 {
+			fc.recordFailure(id, err)
 		}
-		customlog.Printf(customlog.Success, "%d configs have been written into %q\n", len(allConfigs), fc.config.OutputFile)
 	}
+	if ctx.Err() != nil {
+		return fc.interrupted(writer, out)
+	}
+
+	failed := atomic.LoadInt32(&failedCount)
+	customlog.Printf(customlog.Finished, "All done: %d links fetched, %d configs saved, %d failed.\n", totalRaw, writer.Written(), failed)
+	fc.reportOutput(out)
 
 	if failed > 0 {
 		return fmt.Errorf("%d out of %d subscriptions failed to fetch", failed, len(enabled))
@@ -256,12 +498,112 @@ func (fc *FetchCommand) fetchAllSubscriptions() error {
 	return nil
 }
 
+// subscriptionLabel is the remark of a subscription, or its ID when it has none.
+func subscriptionLabel(sub database.Subscription) string {
+	if sub.Remark.Valid && sub.Remark.String != "" {
+		return sub.Remark.String
+	}
+	return fmt.Sprintf("#%d", sub.ID)
+}
+
+// userAgentFor returns the User-Agent a subscription is fetched with; --useragent
+// overrides the stored one.
+func (fc *FetchCommand) userAgentFor(sub database.Subscription) string {
+	if fc.config.UserAgent != "" {
+		return fc.config.UserAgent
+	}
+	return sub.UserAgent.String
+}
+
+// impersonationFor returns the browser a subscription is fetched as; --impersonate
+// overrides the stored one.
+func (fc *FetchCommand) impersonationFor(sub database.Subscription) string {
+	if fc.config.Impersonate != "" {
+		return fc.config.Impersonate
+	}
+	return sub.Impersonate.String
+}
+
+// scrapeFor returns the HTML selector and pattern a subscription is fetched with;
+// --html-selector and --html-pattern override the stored ones.
+func (fc *FetchCommand) scrapeFor(sub database.Subscription) (selector, pattern string) {
+	selector, pattern = sub.HTMLSelector.String, sub.HTMLPattern.String
+	if fc.config.HTMLSelector != "" {
+		selector = fc.config.HTMLSelector
+	}
+	if fc.config.HTMLPattern != "" {
+		pattern = fc.config.HTMLPattern
+	}
+	return selector, pattern
+}
+
+// groupSubscriptions groups subscriptions that would send the same request (same
+// URL, mirrors, User-Agent, fingerprint and credentials) and read the response alike (same scraping and exclusion rules), keeping the order in which each URL first appears.
+func (fc *FetchCommand) groupSubscriptions(subs []database.Subscription) [][]database.Subscription {
+	var groups [][]database.Subscription
+	index := make(map[[8]string]int)
+	for _, sub := range subs {
+		// Equal credentials encrypt differently, so such subscriptions are simply fetched apart.
+		selector, pattern := fc.scrapeFor(sub)
+		mirrors := fmt.Sprint(sub.RaceMirrors, sub.MirrorURLs())
+		key := [8]string{normalizeSubURL(sub.URL), mirrors, fc.userAgentFor(sub), fc.impersonationFor(sub), sub.Auth.String, selector, pattern, sub.ExcludeRules.String}
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], sub)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []database.Subscription{sub})
+	}
+	return groups
+}
+
+// uniqueURLs drops repeated URLs, keeping the first occurrence of each, and returns
+// how many were dropped.
+func uniqueURLs(urls []string) ([]string, int) {
+	seen := make(map[string]bool, len(urls))
+	unique := urls[:0:0]
+	for _, u := range urls {
+		key := normalizeSubURL(u)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, strings.TrimSpace(u))
+	}
+	return unique, len(urls) - len(unique)
+}
+
+// normalizeSubURL returns the form of a subscription URL used to spot duplicates:
+// the scheme and host are lower-cased and a default port is dropped.
+func normalizeSubURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	return u.String()
+}
+
 // fetchFromFile handles --file mode with concurrency via pond
-func (fc *FetchCommand) fetchFromFile() error {
+func (fc *FetchCommand) fetchFromFile(ctx context.Context) error {
 	urls := utils.ParseFileByNewline(fc.config.FileInput)
 	if len(urls) == 0 {
 		return fmt.Errorf("no URLs found in file %q", fc.config.FileInput)
 	}
+	// One-off fetches are not linked to a subscription, so a repeated URL adds nothing.
+	urls, dups := uniqueURLs(urls)
+	if dups > 0 {
+		customlog.Printf(customlog.Info, "Skipping %d duplicate URL(s) in %q.\n", dups, fc.config.FileInput)
+	}
 
 	workers := fc.config.Workers
 	if workers > len(urls) {
@@ -270,13 +612,19 @@ func (fc *FetchCommand) fetchFromFile() error {
 
 	customlog.Printf(customlog.Processing, "Found %d URL(s) in %q — fetching with %d worker(s)...\n", len(urls), fc.config.FileInput, workers)
 
+	out := fc.newOutputWriter()
+	defer out.Close()
+	// All workers share a single writer so DB writes are serialized into large transactions.
+	writer := database.NewConfigBatchWriter(fc.config.BatchSize)
+
 	pool := pond.NewPool(workers)
 	defer pool.StopAndWait()
+	limiter := newHostLimiter(fc.config.PerHost, fc.config.DelayPerHost)
+	urls = interleaveByHost(urls, func(u string) string { return u })
 
 	var (
-		mu          sync.Mutex
-		allConfigs  []database.SubscriptionConfig
-		totalRaw    int
+		totalRaw    int64
+		totalSaved  int64
 		failedCount int32
 		doneCount   int32
 	)
@@ -284,58 +632,66 @@ func (fc *FetchCommand) fetchFromFile() error {
 	for _, rawURL := range urls {
 		rawURL := rawURL // capture loop variable
 		pool.Submit(func() {
+			if ctx.Err() != nil {
+				return
+			}
+			release, err := limiter.acquire(ctx, rawURL)
+			if err != nil {
+				return
+			}
+			defer release()
+
 			idx := atomic.AddInt32(&doneCount, 1)
 			customlog.Printf(customlog.Processing, "[%d/%d] Fetching from %s\n", idx, len(urls), rawURL)
 
 			subToFetch := Subscription{
-				Url:   rawURL,
-				Proxy: fc.config.Proxy,
+				Url:           rawURL,
+				Impersonate:   fc.config.Impersonate,
+				Proxy:         fc.config.Proxy,
+				HTMLSelector:  fc.config.HTMLSelector,
+				HTMLPattern:   fc.config.HTMLPattern,
+				TelegramPages: fc.config.TelegramPages,
+				MaxRedirects:  fc.config.MaxRedirects,
 			}
 			if fc.config.UserAgent != "" {
 				subToFetch.UserAgent = fc.config.UserAgent
 			}
 
-			rawLinks, fetchErr := subToFetch.FetchAll()
+			// One-off fetches from file are not linked to a subscription
+			subID := sql.NullInt64{Valid: false}
+			rawCount, saved, skipped, fetchErr := fc.streamFetch(ctx, &subToFetch, []sql.NullInt64{subID}, writer, out)
+			atomic.AddInt64(&totalRaw, int64(rawCount))
+			atomic.AddInt64(&totalSaved, int64(saved))
 			if fetchErr != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				customlog.Printf(customlog.Failure, "Failed to fetch %s: %v\n", rawURL, fetchErr)
 				atomic.AddInt32(&failedCount, 1)
 				return
 			}
 
-			// One-off fetches from file are not linked to a subscription
-			subID := sql.NullInt64{Valid: false}
-			dbConfigs := fc.parseLinks(rawLinks, subID)
-
-			if len(dbConfigs) > 0 {
-				if err := database.UpsertSubscriptionConfigs(dbConfigs); err != nil {
-					customlog.Printf(customlog.Failure, "Failed to save configs from %s: %v\n", rawURL, err)
-					atomic.AddInt32(&failedCount, 1)
-					return
-				}
-				customlog.Printf(customlog.Success, "%s: fetched %d links, saved %d configs.\n", rawURL, len(rawLinks), len(dbConfigs))
+			if saved > 0 {
+				customlog.Printf(customlog.Success, "%s: fetched %d links, saved %d configs%s.\n", rawURL, rawCount, saved, skippedNote(skipped, 0))
 			} else {
 				customlog.Printf(customlog.Warning, "%s: no valid configs found.\n", rawURL)
 			}
-
-			mu.Lock()
-			allConfigs = append(allConfigs, dbConfigs...)
-			totalRaw += len(rawLinks)
-			mu.Unlock()
 		})
 	}
 
 	pool.StopAndWait()
 
-	failed := atomic.LoadInt32(&failedCount)
-	customlog.Printf(customlog.Finished, "All done: %d links fetched, %d configs saved, %d failed.\n", totalRaw, len(allConfigs), failed)
-
-	if fc.config.OutputFile != "" && len(allConfigs) > 0 {
-		if err := fc.saveConfigsToFile(allConfigs); err != nil {
-			return fmt.Errorf("failed to save configurations to file: %w", err)
-		}
-		customlog.Printf(customlog.Success, "%d configs have been written into %q\n", len(allConfigs), fc.config.OutputFile)
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to save configurations to database: %w", err)
+	}
+	if ctx.Err() != nil {
+		return fc.interrupted(writer, out)
 	}
 
+	failed := atomic.LoadInt32(&failedCount)
+	customlog.Printf(customlog.Finished, "All done: %d links fetched, %d configs saved, %d failed.\n", totalRaw, totalSaved, failed)
+	fc.reportOutput(out)
+
 	if failed > 0 {
 		return fmt.Errorf("%d out of %d URLs failed to fetch", failed, len(urls))
 	}
@@ -343,42 +699,236 @@ func (fc *FetchCommand) fetchFromFile() error {
 }
 
 // doFetch is the shared logic for single-URL fetch (used by fetchSingle)
-func (fc *FetchCommand) doFetch(sub *Subscription, subscriptionID sql.NullInt64) error {
-	rawLinks, err := sub.FetchAll()
+func (fc *FetchCommand) doFetch(ctx context.Context, sub *Subscription, subscriptionID sql.NullInt64) error {
+	out := fc.newOutputWriter()
+	defer out.Close()
+	writer := database.NewConfigBatchWriter(fc.config.BatchSize)
+
+	rawCount, saved, skipped, err := fc.streamFetch(ctx, sub, []sql.NullInt64{subscriptionID}, writer, out)
 	if err != nil {
+		if flushErr := writer.Flush(); flushErr != nil {
+			customlog.Printf(customlog.Warning, "Failed to save partially fetched configs: %v\n", flushErr)
+		}
+		if ctx.Err() != nil {
+			return fc.interrupted(writer, out)
+		}
+		if subscriptionID.Valid {
+			fc.recordFailure(subscriptionID.Int64, err)
+		}
 		return fmt.Errorf("failed to fetch configurations: %w", err)
 	}
-
-	dbConfigs := fc.parseLinks(rawLinks, subscriptionID)
-	if len(dbConfigs) == 0 {
+	if subscriptionID.Valid {
+		checkResolvedURL(subscriptionID.Int64, sub.Url, sub.ResolvedURL)
+		checkFetchedFrom(subscriptionID.Int64, sub)
+	} else if sub.ResolvedURL != "" && sub.ResolvedURL != sub.Url {
+		customlog.Printf(customlog.Info, "Followed redirects to %s\n", sub.ResolvedURL)
+	}
+	if saved == 0 {
 		customlog.Printf(customlog.Warning, "No valid configs found.\n")
 		return nil
 	}
 
-	if err := database.UpsertSubscriptionConfigs(dbConfigs); err != nil {
+	if subscriptionID.Valid {
+		writer.MarkFetched(subscriptionID.Int64, time.Now())
+		writer.MarkSkipped(subscriptionID.Int64, skipped)
+	}
+	if err := writer.Flush(); err != nil {
 		return fmt.Errorf("failed to save configurations to database: %w", err)
 	}
-	customlog.Printf(customlog.Success, "Fetched %d links, saved/updated %d configs in the database.\n", len(rawLinks), len(dbConfigs))
-
+	customlog.Printf(customlog.Success, "Fetched %d links, saved/updated %d configs in the database%s.\n", rawCount, saved, skippedNote(skipped, sub.Excluded))
 	if subscriptionID.Valid {
-		if err := database.UpdateSubscriptionFetched(subscriptionID.Int64, time.Now()); err != nil {
-			customlog.Printf(customlog.Warning, "Failed to update last fetched timestamp: %v\n", err)
-		}
+		reportParseErrors(subscriptionID.Int64)
 	}
 
-	if fc.config.OutputFile != "" {
-		if err := fc.saveConfigsToFile(dbConfigs); err != nil {
+	fc.reportOutput(out)
+	return nil
+}
+
+// streamFetch streams links from the subscription, parses them in batches of BatchSize
+// and hands them to the shared batch writer, so memory stays bounded for multi-megabyte
+// payloads. The configs are saved for every subscription in subIDs, so subscriptions
+// sharing a URL are downloaded once. With --max-per-sub only the sampled links are
+// parsed. It returns the number of links read, configs queued and links left out by
+// the sample, even on error; links already read when the stream fails are still
+// handed to the writer.
+func (fc *FetchCommand) streamFetch(ctx context.Context, sub *Subscription, subIDs []sql.NullInt64, writer *database.ConfigBatchWriter, out *outputWriter) (int, int, int, error) {
+	saved := 0
+	batch := make([]string, 0, fc.config.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		dbConfigs, groups := fc.parseLinks(batch, subIDs[0])
+		batch = batch[:0]
+		if len(dbConfigs) == 0 {
+			return nil
+		}
+		toSave := dbConfigs
+		for _, subID := range subIDs[1:] {
+			for _, c := range dbConfigs {
+				c.SubscriptionID = subID
+				toSave = append(toSave, c)
+			}
+		}
+		if err := writer.Add(toSave); err != nil {
+			return fmt.Errorf("failed to save configurations to database: %w", err)
+		}
+		writer.AddGroups(groups)
+		if err := out.write(dbConfigs); err != nil {
 			return fmt.Errorf("failed to save configurations to file: %w", err)
 		}
-		customlog.Printf(customlog.Success, "%d configs have been written into %q\n", len(dbConfigs), fc.config.OutputFile)
+		saved += len(dbConfigs)
+		return nil
 	}
 
-	return nil
+	var rec *snapshotRecorder
+	if fc.config.KeepSnapshots > 0 && hasSubscription(subIDs) {
+		rec = newSnapshotRecorder()
+		sub.Raw = rec
+		defer func() { sub.Raw = nil }()
+	}
+
+	rawCount, skipped, err := streamSample(ctx, sub, fc.config.Sample, fc.config.MaxPerSub, func(link string) error {
+		batch = append(batch, link)
+		if len(batch) >= fc.config.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err == nil && rec != nil {
+		fc.saveSnapshots(rec, subIDs, rawCount)
+	}
+	return rawCount, saved, skipped, err
+}
+
+// streamSample streams the links of sub and calls yield for those a sample of
+// maxLinks picked by strategy keeps (every link when maxLinks is 0). Links the
+// Exclude rules of sub drop are counted in sub.Excluded and never sampled.
+// Links held back for a random or spread sample are yielded once the payload
+// ends. It returns the number of links read and left out, even on error.
+func streamSample(ctx context.Context, sub *Subscription, strategy string, maxLinks int, yield func(link string) error) (int, int, error) {
+	sampler := newLinkSampler(strategy, maxLinks)
+	sub.Excluded = 0
+	rawCount, err := sub.Stream(ctx, func(link string) error {
+		if excluded(sub.Exclude, link) {
+			sub.Excluded++
+			return nil
+		}
+		if !sampler.offer(link) {
+			return nil
+		}
+		return yield(link)
+	})
+	for _, link := range sampler.drain() {
+		if yieldErr := yield(link); yieldErr != nil {
+			if err == nil {
+				err = yieldErr
+			}
+			break
+		}
+	}
+	return rawCount, sampler.skipped(), err
+}
+
+// skippedNote describes the links --max-per-sub left out and the exclusion rules
+// dropped, for the end of a fetch summary.
+func skippedNote(skipped, excluded int) string {
+	var notes []string
+	if excluded > 0 {
+		notes = append(notes, fmt.Sprintf("%d excluded by rules", excluded))
+	}
+	if skipped > 0 {
+		notes = append(notes, fmt.Sprintf("%d skipped by --max-per-sub", skipped))
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+// checkResolvedURL records where a DB subscription's URL led and warns when it
+// leads somewhere else than on the last fetch, or from https to plain http: a
+// hijacked shortener or redirect hop serves configs of someone else's choosing.
+func checkResolvedURL(subID int64, subURL, resolved string) {
+	if resolved == "" {
+		return
+	}
+	previous, err := database.RecordResolvedURL(subID, resolved)
+	if err != nil {
+		customlog.Printf(customlog.Warning, "%v\n", err)
+		return
+	}
+	if previous != "" && !sameDestination(previous, resolved) {
+		customlog.Printf(customlog.Warning, "Subscription %d now leads to %s instead of %s. If the provider didn't announce a move, the link may have been hijacked; check it before using its configs.\n", subID, resolved, previous)
+	}
+	if strings.HasPrefix(strings.ToLower(subURL), "https://") && strings.HasPrefix(strings.ToLower(resolved), "http://") {
+		customlog.Printf(customlog.Warning, "Subscription %d was redirected from https to plain http (%s); its configs could have been altered on the way.\n", subID, resolved)
+	}
+}
+
+// checkFetchedFrom records which URL of a DB subscription with mirrors served the
+// last fetch, and says so when it was a mirror.
+func checkFetchedFrom(subID int64, sub *Subscription) {
+	if len(sub.Mirrors) == 0 || sub.FetchedFrom == "" {
+		return
+	}
+	if err := database.RecordFetchedFrom(subID, sub.FetchedFrom); err != nil {
+		customlog.Printf(customlog.Warning, "%v\n", err)
+		return
+	}
+	if sub.FetchedFrom != sub.Url {
+		customlog.Printf(customlog.Info, "Subscription %d was fetched from its mirror %s.\n", subID, sub.FetchedFrom)
+	}
+}
+
+// sameDestination reports whether two resolved URLs point at the same resource.
+// The query is ignored, as shorteners and panels often add one-time tokens.
+func sameDestination(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host) && ua.Path == ub.Path
+}
+
+// recordFailure extends the failure streak of a DB subscription and tells the user
+// when the streak got it disabled.
+func (fc *FetchCommand) recordFailure(subID int64, fetchErr error) {
+	streak, disabled, err := database.RecordSubscriptionFailure(subID, fetchErr.Error(), fc.config.DisableAfter)
+	if err != nil {
+		customlog.Printf(customlog.Warning, "%v\n", err)
+		return
+	}
+	if disabled {
+		customlog.Printf(customlog.Warning, "Subscription %d failed %d times in a row and has been disabled. Re-enable it with 'xray-knife subs update --id %d --enabled true'.\n", subID, streak, subID)
+	}
+}
+
+// interrupted reports what was saved before the user stopped the fetch.
+func (fc *FetchCommand) interrupted(writer *database.ConfigBatchWriter, out *outputWriter) error {
+	customlog.Printf(customlog.Warning, "Fetch interrupted: %d configs saved before stopping.\n", writer.Written())
+	fc.reportOutput(out)
+	return context.Canceled
 }
 
 // parseLinks accepts the subscriptionID to correctly populate the struct
-func (fc *FetchCommand) parseLinks(rawLinks []string, subID sql.NullInt64) []database.SubscriptionConfig {
+func (fc *FetchCommand) parseLinks(rawLinks []string, subID sql.NullInt64) ([]database.SubscriptionConfig, []database.ConfigGroup) {
+	return parseConfigLinks(fc.core, rawLinks, subID)
+}
+
+// parseConfigLinks turns raw links into DB rows, filling in protocol and remark when
+// the core can parse the link. Links that fail to parse are kept with the class of
+// the failure, so they can be reviewed with list-configs --parse-errors.
+// Composite links (relay://, balancer://, sub://) are expanded: their members become
+// rows of their own and the link itself a group of them.
+func parseConfigLinks(c core.Core, rawLinks []string, subID sql.NullInt64) ([]database.SubscriptionConfig, []database.ConfigGroup) {
 	var dbConfigs []database.SubscriptionConfig
+	var groups []database.ConfigGroup
 	now := time.Now()
 
 	for _, link := range rawLinks {
@@ -387,40 +937,188 @@ func (fc *FetchCommand) parseLinks(rawLinks []string, subID sql.NullInt64) []dat
 			continue
 		}
 
-		dbConf := database.SubscriptionConfig{
-			SubscriptionID: subID,
-			ConfigLink:     trimmedLink,
-			LastSeenAt:     sql.NullTime{Time: now, Valid: true},
-		}
-
-		// Parse protocol info with panic recovery — malformed links must not crash the program
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					// Silently skip — the config is still saved with unknown protocol
-				}
-			}()
-			proto, err := fc.core.CreateProtocol(trimmedLink)
+		if protocol.IsComposite(trimmedLink) {
+			comp, err := protocol.ParseComposite(trimmedLink)
 			if err == nil {
-				if err := proto.Parse(); err == nil {
-					g := proto.ConvertToGeneralConfig()
-					dbConf.Protocol = sql.NullString{String: g.Protocol, Valid: g.Protocol != ""}
-					dbConf.Remark = sql.NullString{String: g.Remark, Valid: g.Remark != ""}
+				group := database.ConfigGroup{
+					Kind:           string(comp.Kind),
+					Link:           trimmedLink,
+					Remark:         sql.NullString{String: comp.Remark, Valid: comp.Remark != ""},
+					SubscriptionID: subID,
+					LastSeenAt:     sql.NullTime{Time: now, Valid: true},
+				}
+				for _, member := range comp.Links {
+					group.Members = append(group.Members, newConfigRow(c, member, subID, now))
 				}
+				dbConfigs = append(dbConfigs, group.Members...)
+				groups = append(groups, group)
+				continue
+			}
+			// Keep the link with the reason it couldn't be expanded.
+			var perr *protocol.ParseError
+			errors.As(err, &perr)
+			dbConf := newConfigRow(c, trimmedLink, subID, now)
+			dbConf.ParseError = sql.NullString{String: string(perr.Class), Valid: true}
+			dbConf.ParseErrorDetail = sql.NullString{String: perr.Err.Error(), Valid: true}
+			dbConfigs = append(dbConfigs, dbConf)
+			continue
+		}
+
+		dbConfigs = append(dbConfigs, newConfigRow(c, trimmedLink, subID, now))
+	}
+	return dbConfigs, groups
+}
+
+// newConfigRow builds the DB row of a single config link.
+func newConfigRow(c core.Core, link string, subID sql.NullInt64, now time.Time) database.SubscriptionConfig {
+	dbConf := database.SubscriptionConfig{
+		SubscriptionID: subID,
+		ConfigLink:     link,
+		LastSeenAt:     sql.NullTime{Time: now, Valid: true},
+		DedupKey:       sql.NullString{String: utils.ConfigDedupKey(link), Valid: true},
+	}
+	if perr := parseConfigInfo(c, &dbConf); perr != nil {
+		dbConf.ParseError = sql.NullString{String: string(perr.Class), Valid: true}
+		dbConf.ParseErrorDetail = sql.NullString{String: perr.Err.Error(), Valid: true}
+	}
+	return dbConf
+}
+
+// reportParseErrors warns about the stored configs of a subscription that could not be parsed.
+func reportParseErrors(subID int64) {
+	counts, err := database.CountParseErrors(subID)
+	if err != nil || len(counts) == 0 {
+		return
+	}
+	total := 0
+	var parts []string
+	for _, class := range protocol.ParseErrorClasses {
+		if n := counts[string(class)]; n > 0 {
+			total += n
+			parts = append(parts, fmt.Sprintf("%s=%d", class, n))
+		}
+	}
+	customlog.Printf(customlog.Warning, "%d configs could not be parsed (%s); see 'subs list-configs --id %d --parse-errors'.\n",
+		total, strings.Join(parts, ", "), subID)
+}
+
+// parseConfigInfo fills in the protocol and remark of dbConf from its link. Malformed
+// links must not crash the program, so a panicking parser is reported as a parse error.
+func parseConfigInfo(c core.Core, dbConf *database.SubscriptionConfig) (perr *protocol.ParseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr = &protocol.ParseError{Class: protocol.ParseErrPanic, Err: fmt.Errorf("%v", r)}
+		}
+	}()
+
+	proto, err := c.CreateProtocol(dbConf.ConfigLink)
+	if err != nil {
+		return protocol.ClassifyParseError(dbConf.ConfigLink, err)
+	}
+	if err := proto.Parse(); err != nil {
+		return protocol.ClassifyParseError(dbConf.ConfigLink, err)
+	}
+	g := proto.ConvertToGeneralConfig()
+	dbConf.Protocol = sql.NullString{String: g.Protocol, Valid: g.Protocol != ""}
+	dbConf.Remark = sql.NullString{String: g.Remark, Valid: g.Remark != ""}
+	return nil
+}
+
+// outputWriter streams fetched links into the --out file as batches arrive,
+// moving on to the next numbered file every chunkSize links with --chunk-size.
+// It is safe for concurrent use; a nil *outputWriter discards everything.
+type outputWriter struct {
+	mu        sync.Mutex
+	path      string
+	chunkSize int
+	file      *os.File
+	inFile    int      // links in the current file
+	paths     []string // files written, in order
+	count     int
+}
+
+// newOutputWriter returns a writer for --out, or nil when no output file is set.
+func (fc *FetchCommand) newOutputWriter() *outputWriter {
+	if fc.config.OutputFile == "" {
+		return nil
+	}
+	return &outputWriter{path: fc.config.OutputFile, chunkSize: fc.config.ChunkSize}
+}
+
+func (w *outputWriter) write(configs []database.SubscriptionConfig) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(configs) > 0 {
+		// Create (truncate) files lazily so empty fetches don't clobber them.
+		if w.file == nil || (w.chunkSize > 0 && w.inFile == w.chunkSize) {
+			if err := w.next(); err != nil {
+				return err
 			}
-		}()
+		}
+		n := len(configs)
+		if w.chunkSize > 0 {
+			n = min(n, w.chunkSize-w.inFile)
+		}
+		var sb strings.Builder
+		for _, c := range configs[:n] {
+			sb.WriteString(c.ConfigLink)
+			sb.WriteByte('\n')
+		}
+		if _, err := w.file.WriteString(sb.String()); err != nil {
+			return err
+		}
+		w.inFile += n
+		w.count += n
+		configs = configs[n:]
+	}
+	return nil
+}
 
-		dbConfigs = append(dbConfigs, dbConf)
+// next closes the current file and opens the following one.
+func (w *outputWriter) next() error {
+	if w.path == "-" {
+		w.file = os.Stdout
+		return nil
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	path := w.path
+	if w.chunkSize > 0 {
+		path = utils.ChunkFileName(w.path, len(w.paths)+1)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-	return dbConfigs
+	w.file, w.inFile = f, 0
+	w.paths = append(w.paths, path)
+	return nil
 }
 
-// saveConfigsToFile saves the parsed (filtered) configurations to a file
-func (fc *FetchCommand) saveConfigsToFile(configs []database.SubscriptionConfig) error {
-	var links []string
-	for _, c := range configs {
-		links = append(links, c.ConfigLink)
+func (w *outputWriter) Close() error {
+	if w == nil || w.file == nil || w.file == os.Stdout {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// reportOutput prints how many configs ended up in the output files.
+func (fc *FetchCommand) reportOutput(out *outputWriter) {
+	if out == nil || out.count == 0 {
+		return
+	}
+	if len(out.paths) > 1 {
+		customlog.Printf(customlog.Success, "%d configs have been written into %d files, %q to %q\n", out.count, len(out.paths), out.paths[0], out.paths[len(out.paths)-1])
+		return
+	}
+	path := fc.config.OutputFile
+	if len(out.paths) == 1 {
+		path = out.paths[0]
 	}
-	content := strings.Join(links, "\n") + "\n"
-	return utils.WriteIntoFile(fc.config.OutputFile, []byte(content))
+	customlog.Printf(customlog.Success, "%d configs have been written into %q\n", out.count, path)
 }
@@ -0,0 +1,83 @@
+package subs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+)
+
+func TestOutputWriter_Chunks(t *testing.T) {
+	dir := t.TempDir()
+	w := &outputWriter{path: filepath.Join(dir, "configs.txt"), chunkSize: 2}
+	batch := func(links ...string) []database.SubscriptionConfig {
+		var out []database.SubscriptionConfig
+		for _, l := range links {
+			out = append(out, database.SubscriptionConfig{ConfigLink: l})
+		}
+		return out
+	}
+	for _, b := range [][]database.SubscriptionConfig{batch("a", "b", "c"), batch(), batch("d", "e")} {
+		if err := w.write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"configs_001.txt": "a\nb\n", "configs_002.txt": "c\nd\n", "configs_003.txt": "e\n"}
+	var names []string
+	for _, p := range w.paths {
+		names = append(names, filepath.Base(p))
+	}
+	if !reflect.DeepEqual(names, []string{"configs_001.txt", "configs_002.txt", "configs_003.txt"}) {
+		t.Fatalf("wrote %v", names)
+	}
+	for name, content := range want {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(b) != content {
+			t.Errorf("%s = %q, %v; want %q", name, b, err, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "configs.txt")); err == nil {
+		t.Error("the unsplit output file was written too")
+	}
+	if w.count != 5 {
+		t.Errorf("count = %d, want 5", w.count)
+	}
+}
+
+func TestOutputWriter_NoChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	w := &outputWriter{path: path}
+	w.write([]database.SubscriptionConfig{{ConfigLink: "a"}, {ConfigLink: "b"}})
+	w.write([]database.SubscriptionConfig{{ConfigLink: "c"}})
+	w.Close()
+	if b, _ := os.ReadFile(path); strings.Count(string(b), "\n") != 3 {
+		t.Errorf("%s = %q, want 3 links", path, b)
+	}
+}
+
+func TestValidateFlagsLowersWorkers(t *testing.T) {
+	t.Setenv(MaxWorkersEnv, "")
+	fc := &FetchCommand{config: &FetchConfig{FileInput: "urls.txt", Workers: DefaultMaxWorkers + 5, BatchSize: 1, TelegramPages: 1, MaxRedirects: 1}}
+	if err := fc.validateFlags(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fc.config.Workers != DefaultMaxWorkers {
+		t.Errorf("Workers = %d, want it lowered to %d", fc.config.Workers, DefaultMaxWorkers)
+	}
+
+	t.Setenv(MaxWorkersEnv, "100")
+	fc.config.Workers = 80
+	if err := fc.validateFlags(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fc.config.Workers != 80 {
+		t.Errorf("Workers = %d with %s=100, want 80 kept", fc.config.Workers, MaxWorkersEnv)
+	}
+}
@@ -0,0 +1,149 @@
+package subs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// Fetcher fetches subscriptions for Go programs embedding xray-knife. Unlike
+// 'subs fetch' it prints nothing, doesn't touch the database and writes no
+// files: everything a fetch found is in the FetchResult it returns. The zero
+// Fetcher is ready to use, and one Fetcher may run fetches concurrently.
+type Fetcher struct {
+	// Proxy, UserAgent and Impersonate apply to every fetch, overriding those
+	// of the subscription when set.
+	Proxy       string
+	UserAgent   string
+	Impersonate string
+	// MaxPerSub keeps at most that many links of each payload, picked by Sample
+	// (first, random or spread; "" for first). 0 keeps every link.
+	MaxPerSub int
+	Sample    string
+	// Core parses the fetched links; nil for an automatic core.
+	Core core.Core
+}
+
+// FetchedConfig is a link of a fetched subscription.
+type FetchedConfig struct {
+	Link     string
+	Protocol string
+	Remark   string
+	// ParseError is why the link couldn't be parsed, nil when it was.
+	ParseError *protocol.ParseError
+}
+
+// FetchResult is the outcome of a fetch.
+type FetchResult struct {
+	// URL is the subscription URL fetched, ResolvedURL where its redirects led
+	// and FetchedFrom the URL or mirror that served the payload.
+	URL         string
+	ResolvedURL string
+	FetchedFrom string
+	// Configs are the links kept, composite links expanded into their members,
+	// in the order they were read.
+	Configs []FetchedConfig
+	// Read is the number of links in the payload, Excluded how many of them
+	// the Exclude rules of the subscription dropped and Skipped how many
+	// MaxPerSub left out.
+	Read     int
+	Excluded int
+	Skipped  int
+	// Duration is how long the fetch took.
+	Duration time.Duration
+}
+
+// Links returns the links of the configs.
+func (r FetchResult) Links() []string {
+	links := make([]string, len(r.Configs))
+	for i, c := range r.Configs {
+		links[i] = c.Link
+	}
+	return links
+}
+
+// Parsed returns the configs that could be parsed.
+func (r FetchResult) Parsed() []FetchedConfig {
+	var parsed []FetchedConfig
+	for _, c := range r.Configs {
+		if c.ParseError == nil {
+			parsed = append(parsed, c)
+		}
+	}
+	return parsed
+}
+
+// FetchSubscription downloads sub and parses its links. sub itself isn't
+// changed. On error the result still holds the links read before the fetch
+// failed; cancelling ctx stops the download and returns ctx.Err().
+func (f *Fetcher) FetchSubscription(ctx context.Context, sub Subscription) (FetchResult, error) {
+	if sub.Url == "" {
+		return FetchResult{}, errors.New("subscription has no URL")
+	}
+	if f.MaxPerSub < 0 {
+		return FetchResult{}, fmt.Errorf("MaxPerSub must be >= 0, got %d", f.MaxPerSub)
+	}
+	strategy := f.Sample
+	if strategy == "" {
+		strategy = sampleFirst
+	}
+	if err := validateSampleStrategy(strategy); err != nil {
+		return FetchResult{}, err
+	}
+	if err := validateImpersonation(f.Impersonate); err != nil {
+		return FetchResult{}, err
+	}
+	if f.Proxy != "" {
+		sub.Proxy = f.Proxy
+	}
+	if f.UserAgent != "" {
+		sub.UserAgent = f.UserAgent
+	}
+	if f.Impersonate != "" {
+		sub.Impersonate = f.Impersonate
+	}
+	sub.Raw = nil
+	c := f.Core
+	if c == nil {
+		c = core.NewAutomaticCore(false, false)
+	}
+
+	start := time.Now()
+	var links []string
+	read, skipped, err := streamSample(ctx, &sub, strategy, f.MaxPerSub, func(link string) error {
+		links = append(links, link)
+		return nil
+	})
+	result := FetchResult{
+		URL:         sub.Url,
+		ResolvedURL: sub.ResolvedURL,
+		FetchedFrom: sub.FetchedFrom,
+		Configs:     fetchedConfigs(c, links),
+		Read:        read,
+		Excluded:    sub.Excluded,
+		Skipped:     skipped,
+		Duration:    time.Since(start),
+	}
+	return result, err
+}
+
+// fetchedConfigs parses links as 'subs fetch' does before saving them.
+func fetchedConfigs(c core.Core, links []string) []FetchedConfig {
+	rows, _ := parseConfigLinks(c, links, sql.NullInt64{})
+	configs := make([]FetchedConfig, len(rows))
+	for i, row := range rows {
+		configs[i] = FetchedConfig{Link: row.ConfigLink, Protocol: row.Protocol.String, Remark: row.Remark.String}
+		if row.ParseError.Valid {
+			configs[i].ParseError = &protocol.ParseError{
+				Class: protocol.ParseErrorClass(row.ParseError.String),
+				Err:   errors.New(row.ParseErrorDetail.String),
+			}
+		}
+	}
+	return configs
+}
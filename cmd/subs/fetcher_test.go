@@ -0,0 +1,77 @@
+package subs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+func TestFetcher_FetchSubscription(t *testing.T) {
+	payload := "vless://3f6b1b1e-8d1c-4c2a-9c3e-2b7a1d5e9f00@example.com:443?type=tcp#A\n" +
+		"trojan://secret@example.org:443?sni=example.org#B\n" +
+		"vmess://not-base64\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sub", http.StatusFound)
+	})
+	mux.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var f Fetcher
+	sub := Subscription{Url: server.URL + "/old"}
+	result, err := f.FetchSubscription(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("FetchSubscription: %v", err)
+	}
+	if sub.ResolvedURL != "" {
+		t.Error("FetchSubscription changed the subscription passed in")
+	}
+	if result.ResolvedURL != server.URL+"/sub" || result.FetchedFrom == "" {
+		t.Errorf("ResolvedURL = %q, FetchedFrom = %q", result.ResolvedURL, result.FetchedFrom)
+	}
+	if result.Read != 3 || len(result.Configs) != 3 || result.Skipped != 0 {
+		t.Fatalf("read %d, kept %d, skipped %d; want 3, 3, 0", result.Read, len(result.Configs), result.Skipped)
+	}
+	if c := result.Configs[0]; c.Protocol != protocol.VlessIdentifier || c.Remark != "A" || c.ParseError != nil {
+		t.Errorf("first config = %+v", c)
+	}
+	if c := result.Configs[2]; c.ParseError == nil {
+		t.Errorf("broken link parsed: %+v", c)
+	}
+	if n := len(result.Parsed()); n != 2 {
+		t.Errorf("Parsed() has %d configs, want 2", n)
+	}
+
+	f.MaxPerSub = 1
+	result, err = f.FetchSubscription(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("FetchSubscription with MaxPerSub: %v", err)
+	}
+	if links := result.Links(); len(links) != 1 || result.Skipped != 2 {
+		t.Errorf("MaxPerSub 1 kept %q and skipped %d", links, result.Skipped)
+	}
+
+	f.MaxPerSub = 0
+	sub.Exclude, err = ParseExcludeRules([]string{"remark~^B$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = f.FetchSubscription(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("FetchSubscription with Exclude: %v", err)
+	}
+	if len(result.Configs) != 2 || result.Excluded != 1 || result.Configs[1].Link != "vmess://not-base64" {
+		t.Errorf("Exclude kept %q and excluded %d", result.Links(), result.Excluded)
+	}
+
+	f.Sample = "most"
+	if _, err := f.FetchSubscription(context.Background(), sub); err == nil {
+		t.Error("unknown sample strategy accepted")
+	}
+}
@@ -0,0 +1,98 @@
+package subs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	groupsSubID int64
+	groupsID    int64
+	groupsLinks bool
+)
+
+// GroupsCmd lists the chains and balancer groups expanded from composite links.
+var GroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "Lists the relay chains and balancer groups found in subscriptions",
+	Long: `Some subscriptions share composite links bundling several configs: relay:// links
+describe a chain of hops, balancer:// and sub:// links a group of alternatives.
+Fetching expands them into ordinary configs, which are tested like any other,
+and remembers the group they came from in order.
+
+--id shows the members of one group, entry hop first for a chain. With --links only
+the member links are printed, one per line. Run a group with 'xray-knife proxy
+--group <ID>': a chain as a fixed chain, a balancer group as the rotation pool.
+
+Examples:
+  xray-knife subs groups
+  xray-knife subs groups --sub-id 2
+  xray-knife subs groups --id 4
+  xray-knife subs groups --id 4 --links > hops.txt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if groupsID != 0 {
+			group, err := database.GetConfigGroup(groupsID)
+			if err != nil {
+				return err
+			}
+			if groupsLinks {
+				for _, m := range group.Members {
+					fmt.Println(m.ConfigLink)
+				}
+				return nil
+			}
+			printGroup(group)
+			return nil
+		}
+		if groupsLinks {
+			return fmt.Errorf("--links requires --id")
+		}
+
+		groups, err := database.ListConfigGroups(groupsSubID)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			fmt.Println("No relay or balancer links found. They are expanded when a subscription is fetched.")
+			return nil
+		}
+		w := utils.NewTableWriter(os.Stdout, 3, 0)
+		fmt.Fprintln(w, "ID\tKIND\tMEMBERS\tSUB ID\tREMARK")
+		fmt.Fprintln(w, "--\t----\t-------\t------\t------")
+		for _, g := range groups {
+			subID := "-"
+			if g.SubscriptionID.Valid {
+				subID = fmt.Sprint(g.SubscriptionID.Int64)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", g.ID, g.Kind, len(g.Members), subID, truncate(g.Remark.String, 40))
+		}
+		return w.Flush()
+	},
+}
+
+// printGroup shows a group and its members.
+func printGroup(g *database.ConfigGroup) {
+	fmt.Printf("Group ID %d (%s)\n", g.ID, g.Kind)
+	if g.Remark.Valid {
+		fmt.Printf("  Remark: %s\n", g.Remark.String)
+	}
+	fmt.Printf("  Link:   %s\n\n", truncate(g.Link, 80))
+
+	w := utils.NewTableWriter(os.Stdout, 3, 0)
+	fmt.Fprintln(w, "#\tCONFIG ID\tALIAS\tPROTOCOL\tREMARK")
+	for i, m := range g.Members {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", i+1, m.ID, m.Alias.String, m.Protocol.String, truncate(m.Remark.String, 40))
+	}
+	w.Flush()
+}
+
+func init() {
+	GroupsCmd.Flags().Int64Var(&groupsSubID, "sub-id", 0, "Only list the groups of this subscription")
+	GroupsCmd.Flags().Int64Var(&groupsID, "id", 0, "Show the members of this group")
+	GroupsCmd.Flags().BoolVar(&groupsLinks, "links", false, "Print only the member links (with --id)")
+	GroupsCmd.MarkFlagsMutuallyExclusive("sub-id", "id")
+}
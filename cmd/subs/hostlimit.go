@@ -0,0 +1,125 @@
+package subs
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// hostLimiter keeps concurrent fetches polite towards each provider: at most
+// perHost fetches run against one host at a time, and consecutive fetches from
+// the same host start at least delay apart.
+type hostLimiter struct {
+	perHost int
+	delay   time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem       chan struct{}
+	nextStart time.Time
+}
+
+func newHostLimiter(perHost int, delay time.Duration) *hostLimiter {
+	return &hostLimiter{perHost: perHost, delay: delay, hosts: make(map[string]*hostSlot)}
+}
+
+// acquire waits until a fetch of rawURL may start and returns the function that
+// releases its slot. It returns ctx's error if ctx is done first.
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	if l == nil || l.perHost <= 0 {
+		return func() {}, nil
+	}
+	slot := l.slot(fetchHost(rawURL))
+
+	select {
+	case slot.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slot.sem }
+
+	if l.delay > 0 {
+		// Reserve the next start time under the lock, then sleep outside it.
+		l.mu.Lock()
+		start := time.Now()
+		if slot.nextStart.After(start) {
+			start = slot.nextStart
+		}
+		slot.nextStart = start.Add(l.delay)
+		l.mu.Unlock()
+
+		if wait := time.Until(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
+func (l *hostLimiter) slot(host string) *hostSlot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.hosts[host]
+	if !ok {
+		s = &hostSlot{sem: make(chan struct{}, l.perHost)}
+		l.hosts[host] = s
+	}
+	return s
+}
+
+// fetchHost returns the provider a subscription URL is fetched from: its registrable
+// domain (so sub1.example.com and sub2.example.com share one limit), or the IP.
+func fetchHost(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(rawURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// interleaveByHost reorders items so consecutive ones come from different
+// providers, taking one from each host in turn. With the items of a host queued
+// back to back, every worker would soon wait on that host's limit while the
+// fetches of the other hosts sit behind them. Items of one host keep their order.
+func interleaveByHost[T any](items []T, urlOf func(T) string) []T {
+	var hosts []string
+	byHost := make(map[string][]T)
+	for _, item := range items {
+		host := fetchHost(urlOf(item))
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], item)
+	}
+	out := make([]T, 0, len(items))
+	for len(out) < len(items) {
+		for _, host := range hosts {
+			if queue := byHost[host]; len(queue) > 0 {
+				out = append(out, queue[0])
+				byHost[host] = queue[1:]
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package subs
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchHost(t *testing.T) {
+	cases := map[string]string{
+		"https://sub1.Example.com/a":    "example.com",
+		"https://sub2.example.com:8443": "example.com",
+		"http://example.co.uk/sub":      "example.co.uk",
+		"http://1.2.3.4:8080/sub":       "1.2.3.4",
+		"https://localhost/sub":         "localhost",
+	}
+	for in, want := range cases {
+		if got := fetchHost(in); got != want {
+			t.Errorf("fetchHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHostLimiterCapsPerHost(t *testing.T) {
+	l := newHostLimiter(1, 0)
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background(), "https://a.example.com/sub")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Fatalf("peak concurrency = %d, want 1", peak)
+	}
+}
+
+func TestHostLimiterOtherHostsNotBlocked(t *testing.T) {
+	l := newHostLimiter(1, time.Hour)
+	release, err := l.acquire(context.Background(), "https://a.example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other, err := l.acquire(ctx, "https://other.org/sub")
+	if err != nil {
+		t.Fatalf("fetch from another host was blocked: %v", err)
+	}
+	other()
+}
+
+func TestHostLimiterDelay(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	l := newHostLimiter(2, delay)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(context.Background(), "https://example.com/sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Fatalf("3 fetches took %s, want at least %s", elapsed, 2*delay)
+	}
+}
+
+func TestHostLimiterCancelled(t *testing.T) {
+	l := newHostLimiter(1, 0)
+	release, err := l.acquire(context.Background(), "https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx, "https://example.com/other"); err == nil {
+		t.Fatal("acquire succeeded on a cancelled context while the host was busy")
+	}
+}
+
+func TestInterleaveByHost(t *testing.T) {
+	urls := []string{
+		"https://a.example.com/1",
+		"https://b.example.com/2", // same provider as a.example.com
+		"https://other.org/1",
+		"https://example.com/3",
+		"https://10.0.0.1/sub",
+	}
+	got := interleaveByHost(urls, func(u string) string { return u })
+	want := []string{
+		"https://a.example.com/1",
+		"https://other.org/1",
+		"https://10.0.0.1/sub",
+		"https://b.example.com/2",
+		"https://example.com/3",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("interleaveByHost() = %v, want %v", got, want)
+	}
+}
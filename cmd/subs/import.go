@@ -0,0 +1,224 @@
+package subs
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+
+	"github.com/spf13/cobra"
+)
+
+// ImportConfig holds the configuration for the import command
+type ImportConfig struct {
+	Format    string
+	NoSubs    bool
+	DryRun    bool
+	BatchSize int
+}
+
+// ImportCommand holds state for the import subcommand.
+type ImportCommand struct {
+	config *ImportConfig
+	core   core.Core
+}
+
+// NewImportCommand builds the cobra command for importing GUI client backups.
+func NewImportCommand() *cobra.Command {
+	ic := &ImportCommand{
+		config: &ImportConfig{},
+		core:   core.NewAutomaticCore(false, false), // For parsing remarks/protocols
+	}
+	return ic.createCommand()
+}
+
+func (ic *ImportCommand) createCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <path>",
+		Short: "Imports servers and subscriptions from a V2RayN or NekoBox backup.",
+		Long: `Reads the backup or config files of popular GUI clients and loads their servers
+into the xray-knife DB. Subscription URLs found in the backup are added as
+subscriptions too (skip with --no-subs); URLs already in the DB are left alone.
+
+Supported formats:
+  v2rayn   guiNConfig.json (v2rayN 5.x and older), guiNDB.db (v2rayN 6.x and newer),
+           or a v2rayN backup .zip containing either of them.
+  nekobox  a NekoRay / NekoBox for PC profile (config/profiles/<id>.json), the
+           profiles or config directory, or a .zip of the config directory.
+           NekoBox for Android backups are not supported.
+
+VMess, VLESS, Trojan, Shadowsocks, SOCKS, and (v2rayN) Hysteria2 servers are imported;
+other protocols are skipped and counted.
+
+Examples:
+  xray-knife subs import --format v2rayn guiNConfig.json
+  xray-knife subs import --format v2rayn backup_20240101.zip --no-subs
+  xray-knife subs import --format nekobox ~/.config/nekoray/config --dry-run`,
+		Args:         cobra.ExactArgs(1),
+		PreRunE:      ic.validateFlags,
+		RunE:         ic.runCommand,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&ic.config.Format, "format", "", "Backup format (v2rayn, nekobox)")
+	flags.BoolVar(&ic.config.NoSubs, "no-subs", false, "Do not import subscription URLs from the backup")
+	flags.BoolVar(&ic.config.DryRun, "dry-run", false, "Print the converted links without writing to the DB")
+	flags.IntVar(&ic.config.BatchSize, "batch-size", 500, "Number of configs committed to the DB per transaction")
+	cmd.MarkFlagRequired("format")
+	return cmd
+}
+
+func (ic *ImportCommand) validateFlags(cmd *cobra.Command, args []string) error {
+	switch ic.config.Format {
+	case formatV2rayN, formatNekoBox:
+	default:
+		return fmt.Errorf("invalid --format %q (supported: %s, %s)", ic.config.Format, formatV2rayN, formatNekoBox)
+	}
+	if ic.config.BatchSize < 1 {
+		return fmt.Errorf("--batch-size must be at least 1, got %d", ic.config.BatchSize)
+	}
+	return nil
+}
+
+func (ic *ImportCommand) runCommand(cmd *cobra.Command, args []string) error {
+	var (
+		backup *clientBackup
+		err    error
+	)
+	switch ic.config.Format {
+	case formatV2rayN:
+		backup, err = readV2rayNBackup(args[0])
+	case formatNekoBox:
+		backup, err = readNekoBoxBackup(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s backup: %w", ic.config.Format, err)
+	}
+
+	var links []string
+	for _, s := range backup.Servers {
+		link, err := s.Link()
+		if err != nil {
+			customlog.Printf(customlog.Warning, "Skipping %s server %q: %v\n", s.Protocol, s.Remark, err)
+			continue
+		}
+		links = append(links, link)
+	}
+
+	if ic.config.DryRun {
+		for _, l := range links {
+			fmt.Println(l)
+		}
+		ic.reportSkipped(backup)
+		return nil
+	}
+
+	saved, err := SaveLinks(ic.core, links, ic.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	addedSubs := 0
+	if !ic.config.NoSubs && len(backup.Subscriptions) > 0 {
+		if addedSubs, err = importSubscriptions(backup.Subscriptions); err != nil {
+			return err
+		}
+	}
+
+	customlog.Printf(customlog.Finished, "Imported %d configs and %d new subscriptions from %s.\n", saved, addedSubs, args[0])
+	ic.reportSkipped(backup)
+	if addedSubs > 0 {
+		customlog.Printf(customlog.Info, "Run 'xray-knife subs fetch --all' to fetch the imported subscriptions.\n")
+	}
+	return nil
+}
+
+// SaveLinks stores config links that don't belong to a subscription, committing
+// batchSize of them per transaction, and returns how many configs were stored.
+func SaveLinks(c core.Core, links []string, batchSize int) (int, error) {
+	if len(links) == 0 {
+		return 0, nil
+	}
+	writer := database.NewConfigBatchWriter(batchSize)
+	configs, groups := parseConfigLinks(c, links, sql.NullInt64{})
+	if err := writer.Add(configs); err != nil {
+		return 0, fmt.Errorf("failed to save configurations to database: %w", err)
+	}
+	writer.AddGroups(groups)
+	if err := writer.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to save configurations to database: %w", err)
+	}
+	return len(configs), nil
+}
+
+func (ic *ImportCommand) reportSkipped(backup *clientBackup) {
+	if len(backup.Skipped) == 0 {
+		return
+	}
+	names := make([]string, 0, len(backup.Skipped))
+	for name := range backup.Skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, backup.Skipped[name]))
+	}
+	customlog.Printf(customlog.Warning, "Skipped unsupported entries (%s).\n", strings.Join(parts, ", "))
+}
+
+// importSubscriptions adds the backup's subscription URLs that are not in the DB yet,
+// keeping them disabled if they were disabled in the client. It returns how many were added.
+func importSubscriptions(subs []importedSubscription) (int, error) {
+	existing, err := database.ListSubscriptions()
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, s := range existing {
+		known[s.URL] = true
+	}
+
+	added := 0
+	disabled := make(map[string]bool)
+	for _, s := range subs {
+		if known[s.URL] {
+			continue
+		}
+		if _, err := url.ParseRequestURI(s.URL); err != nil {
+			customlog.Printf(customlog.Warning, "Skipping subscription %q: invalid URL\n", s.URL)
+			continue
+		}
+		if err := database.AddSubscription(s.URL, s.Remark, s.UserAgent); err != nil {
+			return added, err
+		}
+		known[s.URL] = true
+		added++
+		if !s.Enabled {
+			disabled[s.URL] = true
+		}
+	}
+
+	if len(disabled) == 0 {
+		return added, nil
+	}
+	all, err := database.ListSubscriptions()
+	if err != nil {
+		return added, err
+	}
+	off := false
+	for _, s := range all {
+		if disabled[s.URL] {
+			if err := database.UpdateSubscription(s.ID, nil, nil, nil, &off); err != nil {
+				return added, err
+			}
+		}
+	}
+	return added, nil
+}
@@ -3,9 +3,11 @@ package subs
 import (
 	"fmt"
 	"os"
-	"text/tabwriter"
+	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -13,6 +15,9 @@ var (
 	listConfigsSubID    int64
 	listConfigsProtocol string
 	listConfigsLimit    int
+	listParseErrors     bool
+	listParseErrorClass string
+	listMaxColWidth     int
 )
 
 // ListConfigsCmd lists configs from the DB.
@@ -20,13 +25,30 @@ var ListConfigsCmd = &cobra.Command{
 	Use:   "list-configs",
 	Short: "Lists fetched configs stored in the database",
 	Long: `Lists proxy configurations that were fetched from subscriptions and stored in the database.
-Results can be filtered by subscription ID and protocol.
+Results can be filtered by subscription ID and protocol. The same server published by
+several subscriptions is stored once; SOURCES lists every subscription it was seen in.
+
+NOTES shows the note and custom fields set with 'xray-knife subs note'. Configs switched
+off with 'xray-knife subs disable' are marked as disabled.
+
+Links that could not be parsed are still stored. --parse-errors lists only those,
+with the class of the failure (unknown_scheme, bad_base64, missing_host, bad_port,
+bad_uuid, malformed, panic) and the parser's message.
+
+Columns are aligned by the width text takes up in the terminal, so Persian, Chinese
+and emoji remarks line up; --max-col-width cuts every cell to that many columns.
 
 Examples:
   xray-knife subs list-configs
   xray-knife subs list-configs --id 1
-  xray-knife subs list-configs --protocol vless --limit 20`,
+  xray-knife subs list-configs --protocol vless --limit 20
+  xray-knife subs list-configs --parse-errors --class bad_uuid
+  xray-knife subs list-configs --max-col-width 30`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if listParseErrors || listParseErrorClass != "" {
+			return listUnparsedConfigs()
+		}
+
 		configs, err := database.ListSubscriptionConfigs(listConfigsSubID, listConfigsProtocol, listConfigsLimit)
 		if err != nil {
 			return err
@@ -37,20 +59,23 @@ Examples:
 			return nil
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "ID\tSUB ID\tPROTOCOL\tREMARK\tLAST SEEN")
-		fmt.Fprintln(w, "--\t------\t--------\t------\t---------")
+		w := utils.NewTableWriter(os.Stdout, 3, listMaxColWidth)
+		fmt.Fprintln(w, "ID\tALIAS\tSOURCES\tPROTOCOL\tREMARK\tLAST SEEN\tNOTES")
+		fmt.Fprintln(w, "--\t-----\t-------\t--------\t------\t---------\t-----")
 
 		for _, c := range configs {
-			subID := "N/A"
-			if c.SubscriptionID.Valid {
-				subID = fmt.Sprintf("%d", c.SubscriptionID.Int64)
+			sources := "N/A"
+			if c.Sources.Valid && c.Sources.String != "" {
+				sources = c.Sources.String
 			}
 
 			protocol := "unknown"
 			if c.Protocol.Valid && c.Protocol.String != "" {
 				protocol = c.Protocol.String
 			}
+			if !c.Enabled {
+				protocol += " (disabled)"
+			}
 
 			remark := "N/A"
 			if c.Remark.Valid && c.Remark.String != "" {
@@ -62,15 +87,85 @@ Examples:
 				lastSeen = c.LastSeenAt.Time.Format("2006-01-02 15:04")
 			}
 
-			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.ID, subID, protocol, remark, lastSeen)
+			notes := "-"
+			if c.Notes.Valid || c.Metadata.Valid {
+				notes = strings.TrimSpace(c.Notes.String + " " + formatMetadata(c.Metadata))
+			}
+
+			alias := "-"
+			if c.Alias.Valid {
+				alias = c.Alias.String
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", c.ID, alias, sources, protocol, remark, lastSeen, truncate(notes, 40))
 		}
 
 		return w.Flush()
 	},
 }
 
+// listUnparsedConfigs prints the configs whose links failed to parse, followed by
+// the totals per error class.
+func listUnparsedConfigs() error {
+	if listParseErrorClass != "" && !validParseErrorClass(listParseErrorClass) {
+		return fmt.Errorf("unknown parse error class %q", listParseErrorClass)
+	}
+	configs, err := database.ListUnparsedConfigs(listConfigsSubID, listParseErrorClass, listConfigsLimit)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		fmt.Println("No configs with parse errors found.")
+		return nil
+	}
+
+	w := utils.NewTableWriter(os.Stdout, 3, listMaxColWidth)
+	fmt.Fprintln(w, "ID\tSOURCES\tCLASS\tERROR\tLINK")
+	fmt.Fprintln(w, "--\t-------\t-----\t-----\t----")
+	for _, c := range configs {
+		sources := "N/A"
+		if c.Sources.Valid && c.Sources.String != "" {
+			sources = c.Sources.String
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.ID, sources, c.ParseError.String,
+			truncate(c.ParseErrorDetail.String, 60), truncate(c.ConfigLink, 50))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	counts, err := database.CountParseErrors(listConfigsSubID)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	for _, class := range protocol.ParseErrorClasses {
+		if n := counts[string(class)]; n > 0 {
+			fmt.Printf("%-15s %d\n", class, n)
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n terminal columns for table output.
+func truncate(s string, n int) string {
+	return utils.TruncateWidth(s, n)
+}
+
+func validParseErrorClass(class string) bool {
+	for _, c := range protocol.ParseErrorClasses {
+		if string(c) == class {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	ListConfigsCmd.Flags().Int64Var(&listConfigsSubID, "id", 0, "Filter by subscription ID")
 	ListConfigsCmd.Flags().StringVar(&listConfigsProtocol, "protocol", "", "Filter by protocol (e.g. vless, vmess, trojan)")
 	ListConfigsCmd.Flags().IntVar(&listConfigsLimit, "limit", 50, "Maximum number of configs to display")
+	ListConfigsCmd.Flags().BoolVar(&listParseErrors, "parse-errors", false, "List only configs whose links could not be parsed, and why")
+	ListConfigsCmd.Flags().StringVar(&listParseErrorClass, "class", "", "With --parse-errors, only show this error class (e.g. bad_uuid)")
+	ListConfigsCmd.Flags().IntVar(&listMaxColWidth, "max-col-width", 0, "Cut table cells to this many terminal columns (0 = no limit)")
 }
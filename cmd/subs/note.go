@@ -0,0 +1,174 @@
+package subs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	noteSet   []string
+	noteUnset []string
+	noteClear bool
+)
+
+// NoteCmd shows or edits the notes and custom fields of a stored config.
+var NoteCmd = &cobra.Command{
+	Use:   "note <config> [text]",
+	Short: "Shows or sets the notes and custom fields of a stored config",
+	Long: `Attaches a free-form note and custom key/value fields to a config stored in the
+database, e.g. when it was bought or who shared it. Notes and fields are kept when
+the config is fetched again. The config is given by ID or alias.
+
+Without text or flags, the config's details are shown, with the certificate
+of its server from the latest 'http --cert' test. Text replaces the note;
+--set key=value and --unset key edit the custom fields, and --clear removes the note
+and every field.
+
+Examples:
+  xray-knife subs note 57
+  xray-knife subs note de-1 "bought 2024-05"
+  xray-knife subs note 57 --set provider=acme --set expires=2025-05-01
+  xray-knife subs note 57 --unset expires
+  xray-knife subs note 57 --clear`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := database.GetConfigByRef(args[0])
+		if err != nil {
+			return err
+		}
+		id := config.ID
+
+		if len(args) == 1 && len(noteSet) == 0 && len(noteUnset) == 0 && !noteClear {
+			return printConfigDetails(config)
+		}
+		if noteClear && (len(args) == 2 || len(noteSet) > 0 || len(noteUnset) > 0) {
+			return fmt.Errorf("--clear cannot be combined with text, --set or --unset")
+		}
+
+		notes, metadata := config.Notes, config.Metadata
+		if noteClear {
+			notes, metadata = sql.NullString{}, sql.NullString{}
+		} else {
+			if len(args) == 2 {
+				text := strings.TrimSpace(args[1])
+				notes = sql.NullString{String: text, Valid: text != ""}
+			}
+			metadata, err = editMetadata(metadata, noteSet, noteUnset)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := database.SetConfigNotes(id, notes, metadata); err != nil {
+			return err
+		}
+		customlog.Printf(customlog.Success, "Updated notes of config ID %d.\n", id)
+		return nil
+	},
+}
+
+// editMetadata applies --set and --unset to a config's JSON metadata. An empty result is NULL.
+func editMetadata(metadata sql.NullString, set, unset []string) (sql.NullString, error) {
+	fields, err := decodeMetadata(metadata)
+	if err != nil {
+		return metadata, err
+	}
+	for _, kv := range set {
+		key, value, ok := strings.Cut(kv, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return metadata, fmt.Errorf("--set expects key=value, got %q", kv)
+		}
+		fields[key] = strings.TrimSpace(value)
+	}
+	for _, key := range unset {
+		delete(fields, strings.TrimSpace(key))
+	}
+
+	if len(fields) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return metadata, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// decodeMetadata returns the custom fields stored in a config's metadata column.
+func decodeMetadata(metadata sql.NullString) (map[string]string, error) {
+	fields := map[string]string{}
+	if !metadata.Valid || metadata.String == "" {
+		return fields, nil
+	}
+	if err := json.Unmarshal([]byte(metadata.String), &fields); err != nil {
+		return nil, fmt.Errorf("stored metadata is not a JSON object of strings: %w", err)
+	}
+	return fields, nil
+}
+
+// formatMetadata renders custom fields as "key=value" pairs sorted by key.
+func formatMetadata(metadata sql.NullString) string {
+	fields, err := decodeMetadata(metadata)
+	if err != nil {
+		return metadata.String
+	}
+	pairs := make([]string, 0, len(fields))
+	for k, v := range fields {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func printConfigDetails(c *database.SubscriptionConfig) error {
+	orNA := func(s sql.NullString) string {
+		if s.Valid && s.String != "" {
+			return s.String
+		}
+		return "N/A"
+	}
+	lastSeen := "N/A"
+	if c.LastSeenAt.Valid {
+		lastSeen = c.LastSeenAt.Time.Format("2006-01-02 15:04")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", c.ID)
+	fmt.Fprintf(w, "Alias:\t%s\n", orNA(c.Alias))
+	fmt.Fprintf(w, "Protocol:\t%s\n", orNA(c.Protocol))
+	fmt.Fprintf(w, "Remark:\t%s\n", orNA(c.Remark))
+	fmt.Fprintf(w, "Sources:\t%s\n", orNA(c.Sources))
+	fmt.Fprintf(w, "Added:\t%s\n", c.AddedAt.Format("2006-01-02 15:04"))
+	fmt.Fprintf(w, "Last seen:\t%s\n", lastSeen)
+	if c.ParseError.Valid {
+		fmt.Fprintf(w, "Parse error:\t%s: %s\n", c.ParseError.String, c.ParseErrorDetail.String)
+	}
+	if cert, err := database.GetLatestCertResult(c.ConfigLink); err == nil && cert != nil {
+		fmt.Fprintf(w, "Certificate:\tissued by %s for %s, expires %s (checked %s)\n",
+			cert.CertIssuer, cert.CertSANs, cert.CertExpires, cert.TestedAt.Format("2006-01-02 15:04"))
+		if cert.CertWarnings != "" {
+			fmt.Fprintf(w, "Certificate warnings:\t%s\n", cert.CertWarnings)
+		}
+	}
+	fmt.Fprintf(w, "Notes:\t%s\n", orNA(c.Notes))
+	fmt.Fprintf(w, "Fields:\t%s\n", orNA(sql.NullString{String: formatMetadata(c.Metadata), Valid: true}))
+	fmt.Fprintf(w, "Link:\t%s\n", c.ConfigLink)
+	return w.Flush()
+}
+
+func init() {
+	NoteCmd.Flags().StringArrayVar(&noteSet, "set", nil, "Set a custom field, as key=value (repeatable)")
+	NoteCmd.Flags().StringArrayVar(&noteUnset, "unset", nil, "Remove a custom field (repeatable)")
+	NoteCmd.Flags().BoolVar(&noteClear, "clear", false, "Remove the note and every custom field")
+}
@@ -0,0 +1,36 @@
+package subs
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestEditMetadata(t *testing.T) {
+	md, err := editMetadata(sql.NullString{}, []string{"provider=acme", " expires = 2025-05-01 "}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatMetadata(md); got != "expires=2025-05-01, provider=acme" {
+		t.Errorf("formatMetadata() = %q", got)
+	}
+
+	md, err = editMetadata(md, []string{"provider=other"}, []string{"expires"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.String != `{"provider":"other"}` {
+		t.Errorf("metadata = %q", md.String)
+	}
+
+	md, err = editMetadata(md, nil, []string{"provider"})
+	if err != nil || md.Valid {
+		t.Errorf("removing the last field = %v, %v; want NULL", md, err)
+	}
+
+	if _, err := editMetadata(sql.NullString{}, []string{"novalue"}, nil); err == nil {
+		t.Error("editMetadata accepted a --set without '='")
+	}
+	if _, err := editMetadata(sql.NullString{String: "[1]", Valid: true}, nil, nil); err == nil {
+		t.Error("editMetadata accepted metadata that is not an object")
+	}
+}
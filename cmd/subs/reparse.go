@@ -0,0 +1,105 @@
+package subs
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reparseSubID  int64
+	reparseDryRun bool
+)
+
+// ReparseCmd re-runs the parsers over the stored config links.
+var ReparseCmd = &cobra.Command{
+	Use:   "reparse",
+	Short: "Re-parses stored configs to refresh their protocol, remark and fingerprint",
+	Long: `Runs the current parsers over every stored config link and updates the protocol,
+remark, parse error and dedup fingerprint saved with it. Metadata is only computed
+when a link is fetched, so configs stored by an older version keep showing "unknown"
+until they are re-parsed.
+
+A config whose refreshed fingerprint matches another stored config is merged into it.
+
+Examples:
+  xray-knife subs reparse
+  xray-knife subs reparse --id 2 --dry-run`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configs, err := database.ListSubscriptionConfigs(reparseSubID, "", 0)
+		if err != nil {
+			return err
+		}
+		if len(configs) == 0 {
+			fmt.Println("No configs found. Use 'xray-knife subs fetch' to fetch configs from a subscription.")
+			return nil
+		}
+
+		changed := reparseConfigs(core.NewAutomaticCore(false, false), configs)
+		unparsed := 0
+		for _, c := range configs {
+			if c.ParseError.Valid {
+				unparsed++
+			}
+		}
+
+		if reparseDryRun {
+			for _, c := range changed {
+				fmt.Printf("%d\t%s\t%s\n", c.ID, describeParsed(c), truncate(c.ConfigLink, 60))
+			}
+			customlog.Printf(customlog.Info, "%d of %d configs would be updated (%d unparsable).\n", len(changed), len(configs), unparsed)
+			return nil
+		}
+
+		merged, err := database.UpdateParsedConfigs(changed)
+		if err != nil {
+			return err
+		}
+		customlog.Printf(customlog.Success, "Re-parsed %d configs: %d updated, %d merged into duplicates, %d unparsable.\n",
+			len(configs), len(changed)-merged, merged, unparsed)
+		return nil
+	},
+}
+
+// reparseConfigs re-parses configs in place and returns those whose stored metadata changed.
+func reparseConfigs(c core.Core, configs []database.SubscriptionConfig) []database.SubscriptionConfig {
+	var changed []database.SubscriptionConfig
+	for i := range configs {
+		old := configs[i]
+		conf := &configs[i]
+		conf.Protocol, conf.Remark = sql.NullString{}, sql.NullString{}
+		conf.ParseError, conf.ParseErrorDetail = sql.NullString{}, sql.NullString{}
+		conf.DedupKey = sql.NullString{String: utils.ConfigDedupKey(conf.ConfigLink), Valid: true}
+		if perr := parseConfigInfo(c, conf); perr != nil {
+			conf.ParseError = sql.NullString{String: string(perr.Class), Valid: true}
+			conf.ParseErrorDetail = sql.NullString{String: perr.Err.Error(), Valid: true}
+		}
+
+		if conf.Protocol != old.Protocol || conf.Remark != old.Remark || conf.DedupKey != old.DedupKey ||
+			conf.ParseError != old.ParseError || conf.ParseErrorDetail != old.ParseErrorDetail {
+			changed = append(changed, *conf)
+		}
+	}
+	return changed
+}
+
+// describeParsed summarizes the parse outcome of a config for --dry-run.
+func describeParsed(c database.SubscriptionConfig) string {
+	if c.ParseError.Valid {
+		return "error: " + c.ParseError.String
+	}
+	if c.Protocol.Valid {
+		return c.Protocol.String
+	}
+	return "unknown"
+}
+
+func init() {
+	ReparseCmd.Flags().Int64Var(&reparseSubID, "id", 0, "Only re-parse the configs of this subscription")
+	ReparseCmd.Flags().BoolVar(&reparseDryRun, "dry-run", false, "Show which configs would change without saving")
+}
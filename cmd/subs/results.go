@@ -0,0 +1,291 @@
+package subs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resultsRunsLimit int
+
+	diffRuns      []int64
+	diffThreshold float64
+	diffMinDelta  int64
+	diffShowAll   bool
+)
+
+// ResultsCmd groups the commands that inspect stored HTTP test runs.
+var ResultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "Inspects and compares stored HTTP test runs",
+	Long: `Inspects the HTTP test runs saved by 'xray-knife http' and compares them.
+
+Examples:
+  xray-knife subs results runs
+  xray-knife subs results diff --run 3 --run 5`,
+}
+
+// resultsRunsCmd lists the stored test runs so they can be picked for a diff.
+var resultsRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Lists the stored HTTP test runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runs, err := database.ListHttpTestRuns(resultsRunsLimit)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("No test runs found in the database.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "RUN\tSTARTED\tCONFIGS\tRESULTS\tPASSED")
+		fmt.Fprintln(w, "---\t-------\t-------\t-------\t------")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\n", r.ID, r.StartTime.Local().Format("2006-01-02 15:04"), r.ConfigCount, r.Results, r.Passed)
+		}
+		return w.Flush()
+	},
+}
+
+// resultsDiffCmd compares the outcome of every config between two test runs.
+var resultsDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compares two HTTP test runs config by config",
+	Long: `Compares two HTTP test runs and lists the configs whose outcome changed:
+
+  failed     passed in the first run but not in the second
+  recovered  failed in the first run but passed in the second
+  regressed  passed in both, but got slower by more than --threshold percent
+             and --min-delta milliseconds
+  improved   passed in both, but got faster by the same margins
+
+Configs tested in only one of the runs are counted in the summary. Without --run,
+the two most recent runs are compared. This is useful to check whether an ISP
+change, a fragment setting or another tweak made things better or worse.
+
+Examples:
+  xray-knife subs results diff
+  xray-knife subs results diff --run 3 --run 5
+  xray-knife subs results diff --run 3 --run 5 --threshold 50 --all`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if diffThreshold < 0 || diffMinDelta < 0 {
+			return fmt.Errorf("--threshold and --min-delta must be >= 0")
+		}
+		runA, runB, err := pickDiffRuns(diffRuns)
+		if err != nil {
+			return err
+		}
+		a, err := database.GetHttpTestResults(runA)
+		if err != nil {
+			return err
+		}
+		b, err := database.GetHttpTestResults(runB)
+		if err != nil {
+			return err
+		}
+
+		d := diffResults(a, b, diffThreshold, diffMinDelta)
+		customlog.Printf(customlog.Info, "Comparing run %d (%d configs) with run %d (%d configs)\n", runA, d.inA, runB, d.inB)
+
+		shown := 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "CHANGE\tRUN %d\tRUN %d\tDELTA\tLINK\n", runA, runB)
+		fmt.Fprintln(w, "------\t------\t------\t-----\t----")
+		for _, c := range d.changes {
+			if c.kind == changeUnchanged && !diffShowAll {
+				continue
+			}
+			shown++
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.kind.colored(), describeResult(c.a), describeResult(c.b), c.delta(), c.link)
+		}
+		if shown > 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+
+		customlog.Printf(customlog.Finished, "%d failed, %d recovered, %d regressed, %d improved, %d unchanged; %d only in run %d, %d only in run %d.\n",
+			d.counts[changeFailed], d.counts[changeRecovered], d.counts[changeRegressed], d.counts[changeImproved], d.counts[changeUnchanged],
+			d.onlyA, runA, d.onlyB, runB)
+		return nil
+	},
+}
+
+// pickDiffRuns returns the runs given with --run, or the two latest runs when none was given.
+func pickDiffRuns(runs []int64) (int64, int64, error) {
+	switch len(runs) {
+	case 2:
+		if runs[0] == runs[1] {
+			return 0, 0, fmt.Errorf("--run must name two different runs")
+		}
+		return runs[0], runs[1], nil
+	case 0:
+		latest, err := database.ListHttpTestRuns(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(latest) < 2 {
+			return 0, 0, fmt.Errorf("at least two test runs are needed to compare, found %d", len(latest))
+		}
+		return latest[1].ID, latest[0].ID, nil
+	default:
+		return 0, 0, fmt.Errorf("--run must be given exactly twice (or not at all for the two latest runs), got %d", len(runs))
+	}
+}
+
+type changeKind int
+
+// The order is the order changes are listed in.
+const (
+	changeFailed changeKind = iota
+	changeRecovered
+	changeRegressed
+	changeImproved
+	changeUnchanged
+)
+
+func (k changeKind) String() string {
+	return [...]string{"failed", "recovered", "regressed", "improved", "unchanged"}[k]
+}
+
+func (k changeKind) colored() string {
+	switch k {
+	case changeFailed:
+		return customlog.GetColor(customlog.Failure, k.String())
+	case changeRecovered, changeImproved:
+		return customlog.GetColor(customlog.Success, k.String())
+	case changeRegressed:
+		return customlog.GetColor(customlog.Warning, k.String())
+	}
+	return customlog.GetColor(customlog.None, k.String())
+}
+
+type resultChange struct {
+	kind changeKind
+	link string
+	a, b database.HttpTestResult
+}
+
+// delta is the latency change between the runs, when the config passed in both.
+func (c resultChange) delta() string {
+	if !resultPassed(c.a) || !resultPassed(c.b) {
+		return "-"
+	}
+	return fmt.Sprintf("%+dms", c.b.DelayMs-c.a.DelayMs)
+}
+
+type runDiff struct {
+	changes  []resultChange
+	counts   map[changeKind]int
+	inA, inB int
+	onlyA    int
+	onlyB    int
+}
+
+// diffResults compares the configs tested in both runs. A latency change counts as a
+// regression or improvement only when it exceeds both threshold percent and minDelta ms.
+func diffResults(a, b []database.HttpTestResult, threshold float64, minDelta int64) runDiff {
+	byLinkA, byLinkB := bestResults(a), bestResults(b)
+	d := runDiff{counts: map[changeKind]int{}, inA: len(byLinkA), inB: len(byLinkB)}
+
+	for link, ra := range byLinkA {
+		rb, ok := byLinkB[link]
+		if !ok {
+			d.onlyA++
+			continue
+		}
+		c := resultChange{kind: changeUnchanged, link: link, a: ra, b: rb}
+		passedA, passedB := resultPassed(ra), resultPassed(rb)
+		switch {
+		case passedA && !passedB:
+			c.kind = changeFailed
+		case !passedA && passedB:
+			c.kind = changeRecovered
+		case passedA && passedB:
+			diff := rb.DelayMs - ra.DelayMs
+			if abs64(diff) > minDelta && float64(abs64(diff)) > float64(ra.DelayMs)*threshold/100 {
+				if diff > 0 {
+					c.kind = changeRegressed
+				} else {
+					c.kind = changeImproved
+				}
+			}
+		}
+		d.counts[c.kind]++
+		d.changes = append(d.changes, c)
+	}
+	for link := range byLinkB {
+		if _, ok := byLinkA[link]; !ok {
+			d.onlyB++
+		}
+	}
+
+	sort.Slice(d.changes, func(i, j int) bool {
+		ci, cj := d.changes[i], d.changes[j]
+		if ci.kind != cj.kind {
+			return ci.kind < cj.kind
+		}
+		if di, dj := abs64(ci.b.DelayMs-ci.a.DelayMs), abs64(cj.b.DelayMs-cj.a.DelayMs); di != dj {
+			return di > dj
+		}
+		return ci.link < cj.link
+	})
+	return d
+}
+
+// bestResults keys a run's results by link, keeping the best one when a link was tested twice.
+func bestResults(results []database.HttpTestResult) map[string]database.HttpTestResult {
+	m := make(map[string]database.HttpTestResult, len(results))
+	for _, r := range results {
+		prev, ok := m[r.ConfigLink]
+		if !ok || (resultPassed(r) && (!resultPassed(prev) || r.DelayMs < prev.DelayMs)) {
+			m[r.ConfigLink] = r
+		}
+	}
+	return m
+}
+
+// resultPassed reports whether the config worked; a semi-pass only failed the speed test.
+func resultPassed(r database.HttpTestResult) bool {
+	return r.Status == "passed" || r.Status == "semi-passed"
+}
+
+func describeResult(r database.HttpTestResult) string {
+	if resultPassed(r) {
+		return strconv.FormatInt(r.DelayMs, 10) + "ms"
+	}
+	if r.Failure != "" {
+		return r.Status + " (" + r.Failure + ")"
+	}
+	return r.Status
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func init() {
+	resultsRunsCmd.Flags().IntVarP(&resultsRunsLimit, "limit", "l", 20, "Maximum number of runs to list")
+
+	resultsDiffCmd.Flags().Int64SliceVar(&diffRuns, "run", nil, "A test run to compare; give it twice, older run first (default: the two latest runs)")
+	resultsDiffCmd.Flags().Float64Var(&diffThreshold, "threshold", 25, "Minimum latency change, in percent, to count as a regression or improvement")
+	resultsDiffCmd.Flags().Int64Var(&diffMinDelta, "min-delta", 100, "Minimum latency change, in milliseconds, to count as a regression or improvement")
+	resultsDiffCmd.Flags().BoolVar(&diffShowAll, "all", false, "Also list configs whose outcome did not change")
+
+	ResultsCmd.AddCommand(resultsRunsCmd)
+	ResultsCmd.AddCommand(resultsDiffCmd)
+}
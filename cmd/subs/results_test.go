@@ -0,0 +1,65 @@
+package subs
+
+import (
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+)
+
+func TestDiffResults(t *testing.T) {
+	res := func(link, status string, delay int64) database.HttpTestResult {
+		return database.HttpTestResult{ConfigLink: link, Status: status, DelayMs: delay}
+	}
+	a := []database.HttpTestResult{
+		res("vless://failed", "passed", 300),
+		res("vless://recovered", "timeout", -1),
+		res("vless://regressed", "passed", 200),
+		res("vless://improved", "passed", 900),
+		res("vless://jitter", "passed", 200),
+		res("vless://semi", "semi-passed", 400),
+		res("vless://gone", "passed", 100),
+		// A link tested twice counts with its best result.
+		res("vless://twice", "failed", -1),
+		res("vless://twice", "passed", 500),
+	}
+	b := []database.HttpTestResult{
+		res("vless://failed", "failed", -1),
+		res("vless://recovered", "passed", 250),
+		res("vless://regressed", "passed", 700),
+		res("vless://improved", "passed", 300),
+		res("vless://jitter", "passed", 260),
+		res("vless://semi", "passed", 420),
+		res("vless://twice", "passed", 520),
+		res("vless://new", "passed", 100),
+	}
+
+	d := diffResults(a, b, 25, 100)
+	want := map[string]changeKind{
+		"vless://failed":    changeFailed,
+		"vless://recovered": changeRecovered,
+		"vless://regressed": changeRegressed,
+		"vless://improved":  changeImproved,
+		"vless://jitter":    changeUnchanged,
+		"vless://semi":      changeUnchanged,
+		"vless://twice":     changeUnchanged,
+	}
+	if len(d.changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(d.changes), len(want))
+	}
+	for _, c := range d.changes {
+		if c.kind != want[c.link] {
+			t.Errorf("%s: got %s, want %s", c.link, c.kind, want[c.link])
+		}
+	}
+	for i := 1; i < len(d.changes); i++ {
+		if d.changes[i].kind < d.changes[i-1].kind {
+			t.Errorf("changes not sorted by kind: %s after %s", d.changes[i].kind, d.changes[i-1].kind)
+		}
+	}
+	if d.onlyA != 1 || d.onlyB != 1 {
+		t.Errorf("onlyA, onlyB = %d, %d, want 1, 1", d.onlyA, d.onlyB)
+	}
+	if d.inA != 8 || d.inB != 8 {
+		t.Errorf("inA, inB = %d, %d, want 8, 8", d.inA, d.inB)
+	}
+}
@@ -18,7 +18,8 @@ var rmYes bool
 var RmCmd = &cobra.Command{
 	Use:   "rm [ID]",
 	Short: "Removes a subscription from the DB by its ID",
-	Long: `Removes a subscription and all its associated configs from the database.
+	Long: `Removes a subscription and the configs only it provided from the database.
+Configs that other subscriptions also publish are kept.
 This action is irreversible. By default, you will be prompted to confirm.
 
 Examples:
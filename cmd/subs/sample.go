@@ -0,0 +1,135 @@
+package subs
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// Strategies picking the links kept from a subscription with --max-per-sub.
+const (
+	sampleFirst  = "first"  // the first N links, in the order served
+	sampleRandom = "random" // N links drawn uniformly from the whole payload
+	sampleSpread = "spread" // N links shared out evenly between the protocols
+)
+
+var sampleStrategies = []string{sampleFirst, sampleRandom, sampleSpread}
+
+func validateSampleStrategy(name string) error {
+	for _, s := range sampleStrategies {
+		if name == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --sample %q (supported: %s)", name, strings.Join(sampleStrategies, ", "))
+}
+
+// linkSampler caps the links taken from one subscription payload. The first
+// strategy passes links through as they stream in; the others can only decide
+// once the payload ends, so they hold a reservoir of at most limit links per
+// bucket (one bucket for random, one per protocol for spread) and hand the
+// sample over from drain. A nil *linkSampler keeps everything.
+type linkSampler struct {
+	strategy string
+	limit    int
+	seen     int
+	kept     int
+	buckets  map[string]*reservoir
+}
+
+// reservoir is a uniform sample of the links offered to it (algorithm R).
+type reservoir struct {
+	seen  int
+	links []string
+}
+
+// newLinkSampler returns a sampler keeping limit links, or nil when limit is 0.
+func newLinkSampler(strategy string, limit int) *linkSampler {
+	if limit <= 0 {
+		return nil
+	}
+	if strategy == "" {
+		strategy = sampleFirst
+	}
+	return &linkSampler{strategy: strategy, limit: limit, buckets: make(map[string]*reservoir)}
+}
+
+// offer reports whether link is to be kept right away.
+func (s *linkSampler) offer(link string) bool {
+	if s == nil {
+		return true
+	}
+	s.seen++
+	if s.strategy == sampleFirst {
+		if s.kept < s.limit {
+			s.kept++
+			return true
+		}
+		return false
+	}
+
+	key := ""
+	if s.strategy == sampleSpread {
+		key = linkScheme(link)
+	}
+	r := s.buckets[key]
+	if r == nil {
+		r = &reservoir{}
+		s.buckets[key] = r
+	}
+	r.seen++
+	if len(r.links) < s.limit {
+		r.links = append(r.links, link)
+	} else if i := rand.IntN(r.seen); i < s.limit {
+		r.links[i] = link
+	}
+	return false
+}
+
+// drain returns the links held back for the sample. With spread, protocols take
+// turns, so a protocol gets its share unless it has fewer links than that.
+func (s *linkSampler) drain() []string {
+	if s == nil || len(s.buckets) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sample []string
+	for round := 0; len(sample) < s.limit; round++ {
+		added := false
+		for _, k := range keys {
+			if links := s.buckets[k].links; round < len(links) && len(sample) < s.limit {
+				sample = append(sample, links[round])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	clear(s.buckets)
+	s.kept += len(sample)
+	return sample
+}
+
+// skipped returns how many offered links were left out.
+func (s *linkSampler) skipped() int {
+	if s == nil {
+		return 0
+	}
+	return s.seen - s.kept
+}
+
+// linkScheme returns the lower-cased scheme of a link, e.g. "vless".
+func linkScheme(link string) string {
+	scheme, _, ok := strings.Cut(link, "://")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
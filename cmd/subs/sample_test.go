@@ -0,0 +1,56 @@
+package subs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLinkSampler(t *testing.T) {
+	var links []string
+	for i := range 30 {
+		links = append(links, fmt.Sprintf("vless://%d", i))
+	}
+	links = append(links, "trojan://a", "trojan://b", "ss://a")
+
+	offer := func(s *linkSampler) (kept []string) {
+		for _, l := range links {
+			if s.offer(l) {
+				kept = append(kept, l)
+			}
+		}
+		return append(kept, s.drain()...)
+	}
+
+	if kept := offer(newLinkSampler(sampleFirst, 3)); !reflect.DeepEqual(kept, []string{"vless://0", "vless://1", "vless://2"}) {
+		t.Errorf("first kept %v", kept)
+	}
+
+	s := newLinkSampler(sampleRandom, 5)
+	kept := offer(s)
+	seen := map[string]bool{}
+	for _, l := range kept {
+		seen[l] = true
+	}
+	if len(kept) != 5 || len(seen) != 5 || s.skipped() != len(links)-5 {
+		t.Errorf("random kept %v, skipped %d", kept, s.skipped())
+	}
+
+	// Every protocol gets a turn before vless takes the rest.
+	s = newLinkSampler(sampleSpread, 6)
+	counts := map[string]int{}
+	for _, l := range offer(s) {
+		counts[linkScheme(l)]++
+	}
+	if want := map[string]int{"ss": 1, "trojan": 2, "vless": 3}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("spread kept %v, want %v", counts, want)
+	}
+
+	var none *linkSampler
+	if !none.offer("vless://x") || none.drain() != nil || none.skipped() != 0 {
+		t.Error("nil sampler must keep everything")
+	}
+	if newLinkSampler(sampleSpread, 0) != nil {
+		t.Error("a zero cap must not sample")
+	}
+}
@@ -0,0 +1,411 @@
+package subs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// defaultLinkPattern matches config links of the protocols xray-knife parses.
+var defaultLinkPattern = regexp.MustCompile(`(?i)\b(?:vmess|vless|trojan|ss|socks(?:5h?)?|wireguard|hysteria2|hy2|juicity|mierus?|naive\+(?:https|quic))://[^\s"'<>` + "`" + `]+`)
+
+// scrapeOptions select the links to extract from an HTML page (a Telegram channel
+// preview, a blog post, ...) served instead of a subscription body.
+type scrapeOptions struct {
+	// selector limits extraction to the text of the matching elements.
+	selector cssSelector
+	// pattern replaces defaultLinkPattern; its first group, if any, is the link.
+	pattern *regexp.Regexp
+}
+
+// newScrapeOptions compiles a CSS selector and a regular expression, either of
+// which may be empty.
+func newScrapeOptions(selector, pattern string) (scrapeOptions, error) {
+	var opts scrapeOptions
+	if selector != "" {
+		sel, err := parseSelector(selector)
+		if err != nil {
+			return opts, fmt.Errorf("invalid HTML selector %q: %w", selector, err)
+		}
+		opts.selector = sel
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return opts, fmt.Errorf("invalid HTML pattern: %w", err)
+		}
+		opts.pattern = re
+	}
+	return opts, nil
+}
+
+// looksLikeHTML reports whether the start of a body is an HTML document rather
+// than a subscription payload.
+func looksLikeHTML(head []byte) bool {
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if len(head) == 0 || head[0] != '<' {
+		return false
+	}
+	lower := bytes.ToLower(head)
+	for _, tag := range []string{"<!doctype html", "<html", "<head", "<body", "<div", "<p>", "<meta"} {
+		if bytes.Contains(lower, []byte(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrapeLinks extracts the config links of an HTML page in the order they appear,
+// each once. Links are looked for in the page text (or the text of the elements
+// matching the selector) and in link targets.
+func scrapeLinks(r io.Reader, opts scrapeOptions) ([]string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML page: %w", err)
+	}
+	roots := []*html.Node{doc}
+	if opts.selector != nil {
+		roots = opts.selector.selectAll(doc)
+	}
+
+	var text strings.Builder
+	for _, root := range roots {
+		writeText(&text, root)
+		text.WriteByte('\n')
+	}
+	return matchLinks(text.String(), opts.pattern), nil
+}
+
+// matchLinks returns the links pattern (or defaultLinkPattern) finds in text, each once.
+func matchLinks(text string, pattern *regexp.Regexp) []string {
+	group := 0
+	if pattern == nil {
+		pattern = defaultLinkPattern
+	} else if pattern.NumSubexp() > 0 {
+		group = 1
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+		link := strings.TrimSpace(m[group])
+		if link == "" || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+	return links
+}
+
+// writeText writes the text of n to b, putting block elements and line breaks on
+// their own lines and the href of every link on a line after it.
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Script, atom.Style, atom.Noscript, atom.Template:
+			return
+		case atom.Br:
+			b.WriteByte('\n')
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && isBlock(n.DataAtom)
+	if block {
+		b.WriteByte('\n')
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c)
+	}
+	if n.Type == html.ElementNode && n.DataAtom == atom.A {
+		for _, a := range n.Attr {
+			if a.Key == "href" {
+				b.WriteString("\n" + a.Val + "\n")
+			}
+		}
+	}
+	if block {
+		b.WriteByte('\n')
+	}
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Li, atom.Tr, atom.Td, atom.Th, atom.Pre, atom.Blockquote,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Section, atom.Article,
+		atom.Header, atom.Footer, atom.Ul, atom.Ol, atom.Table, atom.Textarea:
+		return true
+	}
+	return false
+}
+
+// cssSelector is a comma-separated list of selectors. The supported subset of CSS
+// covers what is needed to pick posts out of a page: type, #id, .class and
+// [attr], [attr=v], [attr~=v], [attr^=v], [attr$=v], [attr*=v] selectors, joined
+// by the descendant (space) and child (>) combinators.
+type cssSelector []complexSelector
+
+// complexSelector is a chain of compound selectors; combinators[i] (' ' or '>')
+// joins parts[i] and parts[i+1].
+type complexSelector struct {
+	parts       []compoundSelector
+	combinators []byte
+}
+
+type compoundSelector struct {
+	tag     string // "" matches any element
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	name, op, value string
+}
+
+// parseSelector parses a CSS selector list.
+func parseSelector(s string) (cssSelector, error) {
+	var list cssSelector
+	for _, part := range strings.Split(s, ",") {
+		sel, err := parseComplex(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sel)
+	}
+	return list, nil
+}
+
+func parseComplex(s string) (complexSelector, error) {
+	var sel complexSelector
+	if s == "" {
+		return sel, fmt.Errorf("empty selector")
+	}
+	for i := 0; i < len(s); {
+		if len(sel.parts) > 0 {
+			// A combinator: whitespace, '>', or both.
+			comb := byte(' ')
+			for i < len(s) && (s[i] == ' ' || s[i] == '>' || s[i] == '\t') {
+				if s[i] == '>' {
+					if comb == '>' {
+						return sel, fmt.Errorf("unexpected '>'")
+					}
+					comb = '>'
+				}
+				i++
+			}
+			sel.combinators = append(sel.combinators, comb)
+		}
+		compound, n, err := parseCompound(s[i:])
+		if err != nil {
+			return sel, err
+		}
+		sel.parts = append(sel.parts, compound)
+		i += n
+	}
+	return sel, nil
+}
+
+// parseCompound parses a compound selector at the start of s and returns how many
+// bytes it took.
+func parseCompound(s string) (compoundSelector, int, error) {
+	var c compoundSelector
+	i := 0
+	if i < len(s) && s[i] == '*' {
+		i++
+	} else {
+		n := identLen(s[i:])
+		c.tag = strings.ToLower(s[i : i+n])
+		i += n
+	}
+	for i < len(s) {
+		switch s[i] {
+		case '#', '.':
+			n := identLen(s[i+1:])
+			if n == 0 {
+				return c, 0, fmt.Errorf("missing name after %q", s[i])
+			}
+			if s[i] == '#' {
+				c.id = s[i+1 : i+1+n]
+			} else {
+				c.classes = append(c.classes, s[i+1:i+1+n])
+			}
+			i += 1 + n
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return c, 0, fmt.Errorf("unterminated '['")
+			}
+			attr, err := parseAttr(s[i+1 : i+end])
+			if err != nil {
+				return c, 0, err
+			}
+			c.attrs = append(c.attrs, attr)
+			i += end + 1
+		case ' ', '\t', '>':
+			return c, i, nil
+		default:
+			return c, 0, fmt.Errorf("unsupported syntax at %q", s[i:])
+		}
+	}
+	if i == 0 {
+		return c, 0, fmt.Errorf("empty selector")
+	}
+	return c, i, nil
+}
+
+func parseAttr(s string) (attrSelector, error) {
+	for _, op := range []string{"~=", "^=", "$=", "*=", "="} {
+		if name, value, ok := strings.Cut(s, op); ok {
+			value = strings.TrimSpace(value)
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return attrSelector{}, fmt.Errorf("missing attribute name in [%s]", s)
+			}
+			return attrSelector{name: strings.ToLower(name), op: op, value: value}, nil
+		}
+	}
+	name := strings.TrimSpace(s)
+	if name == "" {
+		return attrSelector{}, fmt.Errorf("empty []")
+	}
+	return attrSelector{name: strings.ToLower(name)}, nil
+}
+
+// identLen returns the length of the CSS identifier at the start of s.
+func identLen(s string) int {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80 {
+			n++
+			continue
+		}
+		break
+	}
+	return n
+}
+
+// selectAll returns the elements under root matching the selector, in document
+// order. Elements inside an already selected one are not returned again.
+func (sel cssSelector) selectAll(root *html.Node) []*html.Node {
+	var found []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && sel.match(n) {
+			found = append(found, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return found
+}
+
+func (sel cssSelector) match(n *html.Node) bool {
+	for _, s := range sel {
+		if s.match(n, len(s.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether n matches parts[:i+1], with parts[i] matching n itself.
+func (s complexSelector) match(n *html.Node, i int) bool {
+	if !s.parts[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if s.combinators[i-1] == '>' {
+		p := n.Parent
+		return p != nil && p.Type == html.ElementNode && s.match(p, i-1)
+	}
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if s.match(p, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c compoundSelector) match(n *html.Node) bool {
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && attrValue(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attrValue(n, "class"))
+		for _, want := range c.classes {
+			if !contains(classes, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrSelector) match(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key != a.name {
+			continue
+		}
+		switch a.op {
+		case "":
+			return true
+		case "=":
+			return attr.Val == a.value
+		case "~=":
+			return contains(strings.Fields(attr.Val), a.value)
+		case "^=":
+			return a.value != "" && strings.HasPrefix(attr.Val, a.value)
+		case "$=":
+			return a.value != "" && strings.HasSuffix(attr.Val, a.value)
+		case "*=":
+			return a.value != "" && strings.Contains(attr.Val, a.value)
+		}
+	}
+	return false
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package subs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const telegramPage = `<!DOCTYPE html>
+<html><head><title>Free configs</title>
+<script>var x = "vless://not-a-config@script";</script>
+</head><body>
+<div class="tgme_header">Channel with vless://header-link@example.com:443</div>
+<div class="tgme_widget_message_wrap">
+  <div class="tgme_widget_message_text js-message_text">New servers:<br/>vless://uuid@a.example.com:443?security=tls#A<br/>trojan://pass@b.example.com:443#B</div>
+</div>
+<div class="tgme_widget_message_wrap">
+  <div class="tgme_widget_message_text"><code>ss://YWVzLTEyOC1nY206cGFzcw@c.example.com:8388#C</code>
+  <a href="vmess://eyJhZGQiOiJkLmV4YW1wbGUuY29tIn0=">tap to copy</a></div>
+  <div class="tgme_widget_message_text">vless://uuid@a.example.com:443?security=tls#A</div>
+</div>
+</body></html>`
+
+func TestScrapeLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		pattern  string
+		want     []string
+	}{
+		{
+			name: "whole page",
+			want: []string{
+				"vless://header-link@example.com:443",
+				"vless://uuid@a.example.com:443?security=tls#A",
+				"trojan://pass@b.example.com:443#B",
+				"ss://YWVzLTEyOC1nY206cGFzcw@c.example.com:8388#C",
+				"vmess://eyJhZGQiOiJkLmV4YW1wbGUuY29tIn0=",
+			},
+		},
+		{
+			name:     "class selector",
+			selector: ".tgme_widget_message_text",
+			want: []string{
+				"vless://uuid@a.example.com:443?security=tls#A",
+				"trojan://pass@b.example.com:443#B",
+				"ss://YWVzLTEyOC1nY206cGFzcw@c.example.com:8388#C",
+				"vmess://eyJhZGQiOiJkLmV4YW1wbGUuY29tIn0=",
+			},
+		},
+		{
+			name:     "child combinator and tag",
+			selector: "div.tgme_widget_message_text > code",
+			want:     []string{"ss://YWVzLTEyOC1nY206cGFzcw@c.example.com:8388#C"},
+		},
+		{
+			name:     "attribute selector and selector list",
+			selector: `a[href^="vmess://"], .tgme_header`,
+			want: []string{
+				"vless://header-link@example.com:443",
+				"vmess://eyJhZGQiOiJkLmV4YW1wbGUuY29tIn0=",
+			},
+		},
+		{
+			name:     "pattern with group",
+			selector: ".tgme_widget_message_text",
+			pattern:  `(trojan://\S+)`,
+			want:     []string{"trojan://pass@b.example.com:443#B"},
+		},
+		{
+			name:     "no match",
+			selector: "#missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := newScrapeOptions(tt.selector, tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := scrapeLinks(strings.NewReader(telegramPage), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelector_Invalid(t *testing.T) {
+	for _, s := range []string{"", "div,", "a >> b", "div:first-child", "[href", ".", "div#"} {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("parseSelector(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestReadLinks_Scrape(t *testing.T) {
+	collect := func(body string, opts scrapeOptions) []string {
+		t.Helper()
+		var links []string
+		if _, err := readLinks(strings.NewReader(body), opts, func(link string) error {
+			links = append(links, link)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return links
+	}
+
+	// HTML is detected without any option.
+	if got := collect(telegramPage, scrapeOptions{}); len(got) != 5 {
+		t.Errorf("HTML page: got %d links, want 5: %q", len(got), got)
+	}
+
+	// A pattern alone applies to plain text bodies too.
+	opts, err := newScrapeOptions("", `link: (\S+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect("link: vless://a@x:1\nnoise\nlink: trojan://b@y:2\n", opts)
+	want := []string{"vless://a@x:1", "trojan://b@y:2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pattern: got %q, want %q", got, want)
+	}
+}
+
+func TestLooksLikeHTML(t *testing.T) {
+	for body, want := range map[string]bool{
+		"  <!DOCTYPE html><html></html>":      true,
+		"<div>vless://a@b:1</div>":            true,
+		"vless://a@b:1#<html>":                false,
+		"dmxlc3M6Ly9hQGI6MQ==":                false,
+		"<?xml version=\"1.0\"?><rss></rss>":  false,
+		"\n<HTML><BODY>trojan://x@y:1</BODY>": true,
+		"":                                    false,
+	} {
+		if got := looksLikeHTML([]byte(body)); got != want {
+			t.Errorf("looksLikeHTML(%q) = %v, want %v", body, got, want)
+		}
+	}
+}
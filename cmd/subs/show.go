@@ -3,24 +3,40 @@ package subs
 import (
 	"fmt"
 	"os"
-	"text/tabwriter"
+	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/spf13/cobra"
 )
 
-var showVerbose bool
+var (
+	showVerbose     bool
+	showMaxColWidth int
+)
 
 // ShowCmd lists all subscriptions in the DB.
 var ShowCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Shows all subscriptions available in the DB",
 	Long: `Lists all subscriptions stored in the local database in a table format.
-By default, long URLs are truncated. Use --verbose to see full URLs.
+By default, long URLs are truncated. Use --verbose to see full URLs, the kinds of
+credentials stored for private subscriptions (never their values), where the URL
+led after redirects on the last fetch and the error of the last failed fetch. FAILS is the number of consecutive failed fetches;
+'subs fetch' disables a subscription once it reaches --disable-after. PRIO is the
+priority set with 'subs update --priority'. With --verbose, SKIPPED is how many
+links the last fetch left out with --max-per-sub, MIRRORS how many mirrors the
+subscription has ("raced" when they are requested at once) and FETCHED FROM the
+mirror that served the last fetch, or "url" when its own URL did. EXCLUDE lists
+the rules dropping fetched links ('subs add --exclude').
+
+Columns are aligned by the width text takes up in the terminal, so Persian, Chinese
+and emoji remarks line up; --max-col-width cuts every cell to that many columns.
 
 Examples:
   xray-knife subs show
-  xray-knife subs show --verbose`,
+  xray-knife subs show --verbose
+  xray-knife subs show --verbose --max-col-width 60`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		subs, err := database.ListSubscriptions()
 		if err != nil {
@@ -32,9 +48,15 @@ Examples:
 			return nil
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "ID\tREMARK\tURL\tENABLED\tCONFIGS\tLAST FETCHED")
-		fmt.Fprintln(w, "--\t------\t---\t-------\t-------\t------------")
+		w := utils.NewTableWriter(os.Stdout, 3, showMaxColWidth)
+		header := "ID\tREMARK\tURL\tENABLED\tPRIO\tCONFIGS\tFAILS\tLAST FETCHED"
+		divider := "--\t------\t---\t-------\t----\t-------\t-----\t------------"
+		if showVerbose {
+			header += "\tSKIPPED\tMIRRORS\tFETCHED FROM\tEXCLUDE\tAUTH\tRESOLVED TO\tLAST ERROR"
+			divider += "\t-------\t-------\t------------\t-------\t----\t-----------\t----------"
+		}
+		fmt.Fprintln(w, header)
+		fmt.Fprintln(w, divider)
 
 		for _, sub := range subs {
 			remark := "N/A"
@@ -48,19 +70,60 @@ Examples:
 			}
 
 			displayURL := sub.URL
-			if !showVerbose && len(displayURL) > 50 {
-				displayURL = displayURL[:47] + "..."
+			if !showVerbose {
+				displayURL = truncate(displayURL, 50)
 			}
 
 			configCount, _ := database.CountSubscriptionConfigs(sub.ID)
 
-			fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%d\t%s\n", sub.ID, remark, displayURL, sub.Enabled, configCount, lastFetched)
+			fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%d\t%d\t%d\t%s", sub.ID, remark, displayURL, sub.Enabled, sub.Priority, configCount, sub.FailureCount, lastFetched)
+			if showVerbose {
+				lastError := "-"
+				if sub.FailureCount > 0 && sub.LastError.Valid {
+					lastError = sub.LastError.String
+				}
+				auth := "unreadable"
+				if creds, err := sub.Credentials(); err == nil {
+					auth = describeAuth(creds)
+				}
+				resolved := "-"
+				if sub.ResolvedURL.Valid && sub.ResolvedURL.String != sub.URL {
+					resolved = sub.ResolvedURL.String
+				}
+				mirrors, fetchedFrom := describeMirrors(sub)
+				exclude := "-"
+				if rules := sub.ExcludeRuleList(); len(rules) > 0 {
+					exclude = strings.Join(rules, "; ")
+				}
+				fmt.Fprintf(w, "\t%d\t%s\t%s\t%s\t%s\t%s\t%s", sub.SkippedConfigs, mirrors, fetchedFrom, exclude, auth, resolved, lastError)
+			}
+			fmt.Fprintln(w)
 		}
 
 		return w.Flush()
 	},
 }
 
+// describeMirrors returns the MIRRORS and FETCHED FROM cells of a subscription.
+func describeMirrors(sub database.Subscription) (mirrors, fetchedFrom string) {
+	mirrors, fetchedFrom = "-", "-"
+	if n := len(sub.MirrorURLs()); n > 0 {
+		mirrors = fmt.Sprint(n)
+		if sub.RaceMirrors {
+			mirrors += " raced"
+		}
+	}
+	switch {
+	case !sub.FetchedFrom.Valid:
+	case sub.FetchedFrom.String == sub.URL:
+		fetchedFrom = "url"
+	default:
+		fetchedFrom = sub.FetchedFrom.String
+	}
+	return mirrors, fetchedFrom
+}
+
 func init() {
-	ShowCmd.Flags().BoolVarP(&showVerbose, "verbose", "v", false, "Show full URLs without truncation")
+	ShowCmd.Flags().BoolVarP(&showVerbose, "verbose", "v", false, "Show full URLs and the last fetch error")
+	ShowCmd.Flags().IntVar(&showMaxColWidth, "max-col-width", 0, "Cut table cells to this many terminal columns (0 = no limit)")
 }
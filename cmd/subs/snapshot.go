@@ -0,0 +1,399 @@
+package subs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+// maxSnapshotSize caps the raw payload kept in a snapshot; larger payloads are not archived.
+const maxSnapshotSize = 64 << 20
+
+// snapshotRecorder compresses a subscription payload while it is streamed. Writes
+// never fail, so archiving can't break a fetch.
+type snapshotRecorder struct {
+	buf      bytes.Buffer
+	gz       *gzip.Writer
+	hash     hash.Hash
+	size     int64
+	overflow bool
+}
+
+func newSnapshotRecorder() *snapshotRecorder {
+	r := &snapshotRecorder{hash: sha256.New()}
+	r.gz = gzip.NewWriter(&r.buf)
+	return r
+}
+
+func (r *snapshotRecorder) Write(p []byte) (int, error) {
+	if r.overflow {
+		return len(p), nil
+	}
+	r.size += int64(len(p))
+	if r.size > maxSnapshotSize {
+		r.overflow = true
+		return len(p), nil
+	}
+	r.hash.Write(p)
+	r.gz.Write(p)
+	return len(p), nil
+}
+
+// snapshot finishes the recording and returns it as a snapshot of subID.
+func (r *snapshotRecorder) snapshot(subID int64, links int, at time.Time) (database.SubscriptionSnapshot, error) {
+	if r.overflow {
+		return database.SubscriptionSnapshot{}, fmt.Errorf("payload is larger than %d MB", maxSnapshotSize>>20)
+	}
+	if err := r.gz.Close(); err != nil {
+		return database.SubscriptionSnapshot{}, err
+	}
+	return database.SubscriptionSnapshot{
+		SubscriptionID: subID,
+		FetchedAt:      at,
+		LastSeenAt:     at,
+		SHA256:         hex.EncodeToString(r.hash.Sum(nil)),
+		Size:           r.size,
+		Links:          links,
+		Payload:        r.buf.Bytes(),
+	}, nil
+}
+
+// saveSnapshots archives a recorded payload for every DB subscription it was fetched
+// for and applies the retention settings. Failures are only reported.
+func (fc *FetchCommand) saveSnapshots(rec *snapshotRecorder, subIDs []sql.NullInt64, links int) {
+	now := time.Now().UTC()
+	var cutoff time.Time
+	if fc.config.SnapshotMaxAge > 0 {
+		cutoff = now.Add(-fc.config.SnapshotMaxAge)
+	}
+
+	snap, err := rec.snapshot(0, links, now)
+	if err != nil {
+		customlog.Printf(customlog.Warning, "Subscription payload not archived: %v\n", err)
+		return
+	}
+	for _, subID := range subIDs {
+		if !subID.Valid {
+			continue
+		}
+		snap.SubscriptionID = subID.Int64
+		if _, err := database.SaveSubscriptionSnapshot(snap); err != nil {
+			customlog.Printf(customlog.Warning, "%v\n", err)
+			continue
+		}
+		if _, err := database.PruneSubscriptionSnapshots(subID.Int64, fc.config.KeepSnapshots, cutoff); err != nil {
+			customlog.Printf(customlog.Warning, "%v\n", err)
+		}
+	}
+}
+
+// hasSubscription reports whether any of subIDs is a DB subscription.
+func hasSubscription(subIDs []sql.NullInt64) bool {
+	for _, id := range subIDs {
+		if id.Valid {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotLinks decompresses a snapshot and returns its links.
+func snapshotLinks(s *database.SubscriptionSnapshot) ([]string, error) {
+	raw, err := snapshotPayload(s)
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	_, err = readLinks(bytes.NewReader(raw), scrapeOptions{}, func(link string) error {
+		links = append(links, link)
+		return nil
+	})
+	return links, err
+}
+
+func snapshotPayload(s *database.SubscriptionSnapshot) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(s.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %d is corrupt: %w", s.ID, err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %d is corrupt: %w", s.ID, err)
+	}
+	return raw, nil
+}
+
+// parseSnapshotTime accepts an absolute local time ("2024-05-01", "2024-05-01 14:30",
+// RFC 3339) or a duration ago ("36h", "7d").
+func parseSnapshotTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use e.g. 2024-05-01, \"2024-05-01 14:30\", 36h or 7d)", s)
+}
+
+var (
+	snapshotSubID int64
+
+	snapshotAt  string
+	snapshotID  int64
+	snapshotRaw bool
+	snapshotOut string
+
+	snapshotFrom string
+	snapshotTo   string
+)
+
+// SnapshotCmd groups the commands that inspect archived subscription payloads.
+var SnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Inspects the archived payloads of past subscription fetches",
+	Long: `Every successful fetch of a DB subscription archives its raw payload, compressed,
+when it differs from the previous one. This lets you recover configs a provider
+has removed, or audit what changed between two fetches.
+
+Retention is set on fetch with --keep-snapshots (default: 10 per subscription,
+0 disables archiving) and --snapshot-max-age.
+
+Times are local, e.g. 2024-05-01 or "2024-05-01 14:30", or a duration ago such as
+36h or 7d.
+
+Examples:
+  xray-knife subs snapshot list --id 1
+  xray-knife subs snapshot show --id 1 --at 2024-05-01
+  xray-knife subs snapshot show --id 1 --at 7d --out old-configs.txt
+  xray-knife subs snapshot diff --id 1 --from 30d`,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "Lists the archived payloads of a subscription",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshots, err := database.ListSubscriptionSnapshots(snapshotSubID)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			fmt.Printf("No snapshots of subscription %d.\n", snapshotSubID)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "SNAPSHOT\tFIRST FETCHED\tLAST SEEN\tLINKS\tSIZE\tSHA256")
+		fmt.Fprintln(w, "--------\t-------------\t---------\t-----\t----\t------")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", s.ID, s.FetchedAt.Local().Format("2006-01-02 15:04"),
+				s.LastSeenAt.Local().Format("2006-01-02 15:04"), s.Links, formatBytes(s.Size), s.SHA256[:12])
+		}
+		return w.Flush()
+	},
+}
+
+var snapshotShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Prints the configs of an archived payload",
+	Long: `Prints the configs a subscription served at a given time (--at), or of one snapshot
+(--snapshot), one per line. Without either, the latest snapshot is shown. --raw
+prints the payload exactly as it was served.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if snapshotAt != "" && snapshotID != 0 {
+			return fmt.Errorf("--at and --snapshot cannot be combined")
+		}
+		at, err := parseSnapshotTime(snapshotAt)
+		if err != nil {
+			return err
+		}
+		snap, err := database.GetSubscriptionSnapshot(snapshotSubID, snapshotID, at)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		if snapshotRaw {
+			if data, err = snapshotPayload(snap); err != nil {
+				return err
+			}
+		} else {
+			links, err := snapshotLinks(snap)
+			if err != nil {
+				return err
+			}
+			data = []byte(strings.Join(links, "\n") + "\n")
+		}
+
+		if snapshotOut == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(snapshotOut, data, 0644); err != nil {
+			return err
+		}
+		customlog.Printf(customlog.Success, "Snapshot %d (fetched %s, %d links) written to %q\n",
+			snap.ID, snap.FetchedAt.Local().Format("2006-01-02 15:04"), snap.Links, snapshotOut)
+		return nil
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Lists the configs added and removed between two archived payloads",
+	Long: `Compares the payloads a subscription served at two times and lists the configs
+that were added (+) and removed (-). --from defaults to the snapshot before the
+latest one, --to to the latest one.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, to, err := pickSnapshotPair(snapshotSubID, snapshotFrom, snapshotTo)
+		if err != nil {
+			return err
+		}
+		oldLinks, err := snapshotLinks(from)
+		if err != nil {
+			return err
+		}
+		newLinks, err := snapshotLinks(to)
+		if err != nil {
+			return err
+		}
+
+		added, removed := diffLinks(oldLinks, newLinks)
+		for _, l := range removed {
+			fmt.Println(customlog.GetColor(customlog.Failure, "- ") + l)
+		}
+		for _, l := range added {
+			fmt.Println(customlog.GetColor(customlog.Success, "+ ") + l)
+		}
+		customlog.Printf(customlog.Finished, "Snapshot %d (%s) -> %d (%s): %d added, %d removed.\n",
+			from.ID, from.FetchedAt.Local().Format("2006-01-02 15:04"), to.ID, to.FetchedAt.Local().Format("2006-01-02 15:04"),
+			len(added), len(removed))
+		return nil
+	},
+}
+
+// pickSnapshotPair resolves the --from and --to snapshots of a diff.
+func pickSnapshotPair(subID int64, fromStr, toStr string) (*database.SubscriptionSnapshot, *database.SubscriptionSnapshot, error) {
+	toAt, err := parseSnapshotTime(toStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := database.GetSubscriptionSnapshot(subID, 0, toAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var from *database.SubscriptionSnapshot
+	if fromStr != "" {
+		fromAt, err := parseSnapshotTime(fromStr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if from, err = database.GetSubscriptionSnapshot(subID, 0, fromAt); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		snapshots, err := database.ListSubscriptionSnapshots(subID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			if snapshots[i].FetchedAt.Before(to.FetchedAt) {
+				from, err = database.GetSubscriptionSnapshot(subID, snapshots[i].ID, time.Time{})
+				if err != nil {
+					return nil, nil, err
+				}
+				break
+			}
+		}
+		if from == nil {
+			return nil, nil, fmt.Errorf("subscription %d has no snapshot older than %d to compare with", subID, to.ID)
+		}
+	}
+	if from.ID == to.ID {
+		return nil, nil, fmt.Errorf("--from and --to both resolve to snapshot %d", to.ID)
+	}
+	return from, to, nil
+}
+
+// diffLinks returns the links only in newLinks (added) and only in oldLinks (removed).
+func diffLinks(oldLinks, newLinks []string) (added, removed []string) {
+	inOld := make(map[string]bool, len(oldLinks))
+	for _, l := range oldLinks {
+		inOld[l] = true
+	}
+	inNew := make(map[string]bool, len(newLinks))
+	for _, l := range newLinks {
+		if !inNew[l] && !inOld[l] {
+			added = append(added, l)
+		}
+		inNew[l] = true
+	}
+	for _, l := range oldLinks {
+		if !inNew[l] {
+			removed = append(removed, l)
+			inNew[l] = true // report duplicates once
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func init() {
+	SnapshotCmd.PersistentFlags().Int64Var(&snapshotSubID, "id", 0, "The ID of the subscription")
+	SnapshotCmd.MarkPersistentFlagRequired("id")
+
+	snapshotShowCmd.Flags().StringVar(&snapshotAt, "at", "", "Show the payload served at this time (default: the latest)")
+	snapshotShowCmd.Flags().Int64Var(&snapshotID, "snapshot", 0, "Show this snapshot, as listed by 'snapshot list'")
+	snapshotShowCmd.Flags().BoolVar(&snapshotRaw, "raw", false, "Print the payload as served instead of one config per line")
+	snapshotShowCmd.Flags().StringVarP(&snapshotOut, "out", "o", "", "Write to this file instead of stdout")
+
+	snapshotDiffCmd.Flags().StringVar(&snapshotFrom, "from", "", "Older side of the comparison (default: the snapshot before --to)")
+	snapshotDiffCmd.Flags().StringVar(&snapshotTo, "to", "", "Newer side of the comparison (default: the latest snapshot)")
+
+	SnapshotCmd.AddCommand(snapshotListCmd)
+	SnapshotCmd.AddCommand(snapshotShowCmd)
+	SnapshotCmd.AddCommand(snapshotDiffCmd)
+}
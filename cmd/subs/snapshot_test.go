@@ -0,0 +1,72 @@
+package subs
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRecorderRoundTrip(t *testing.T) {
+	payload := "vless://a#one\nss://b#two\n"
+	rec := newSnapshotRecorder()
+	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
+	// Write in pieces, the way io.TeeReader hands it over.
+	rec.Write([]byte(encoded[:7]))
+	rec.Write([]byte(encoded[7:]))
+
+	snap, err := rec.snapshot(3, 2, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.SubscriptionID != 3 || snap.Size != int64(len(encoded)) || len(snap.SHA256) != 64 {
+		t.Errorf("snapshot = %+v", snap)
+	}
+	raw, err := snapshotPayload(&snap)
+	if err != nil || string(raw) != encoded {
+		t.Fatalf("payload = %q, %v; want %q", raw, err, encoded)
+	}
+	links, err := snapshotLinks(&snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vless://a#one", "ss://b#two"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("links = %q, want %q", links, want)
+	}
+}
+
+func TestParseSnapshotTime(t *testing.T) {
+	day, err := parseSnapshotTime("2024-05-01")
+	if err != nil || !day.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("date: %v, %v", day, err)
+	}
+	minute, err := parseSnapshotTime("2024-05-01 14:30")
+	if err != nil || !minute.Equal(time.Date(2024, 5, 1, 14, 30, 0, 0, time.Local)) {
+		t.Errorf("date and time: %v, %v", minute, err)
+	}
+	if _, err := parseSnapshotTime("2024-05-01T14:30:00Z"); err != nil {
+		t.Errorf("RFC 3339: %v", err)
+	}
+
+	ago, err := parseSnapshotTime("7d")
+	if err != nil || time.Since(ago) < 7*24*time.Hour-time.Hour || time.Since(ago) > 7*24*time.Hour+time.Hour {
+		t.Errorf("7d: %v, %v", ago, err)
+	}
+	ago, err = parseSnapshotTime("90m")
+	if err != nil || time.Since(ago) < 90*time.Minute || time.Since(ago) > 91*time.Minute {
+		t.Errorf("90m: %v, %v", ago, err)
+	}
+
+	for _, bad := range []string{"yesterday", "-3h", "2024-13-01"} {
+		if _, err := parseSnapshotTime(bad); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+func TestDiffLinks(t *testing.T) {
+	added, removed := diffLinks([]string{"a", "b", "b", "c"}, []string{"c", "d", "a", "d"})
+	if !reflect.DeepEqual(added, []string{"d"}) || !reflect.DeepEqual(removed, []string{"b"}) {
+		t.Errorf("added %q, removed %q", added, removed)
+	}
+}
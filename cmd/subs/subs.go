@@ -15,10 +15,18 @@ and the proxy configs they contain.
 
 Examples:
   xray-knife subs add --url "https://example.com/sub" --remark "My VPN"
+  xray-knife subs add --telegram @somechannel
   xray-knife subs show
   xray-knife subs fetch --id 1
   xray-knife subs fetch --all
-  xray-knife subs list-configs --id 1`,
+  xray-knife subs list-configs --id 1
+  xray-knife subs groups
+  xray-knife subs alias de-1 fast-1
+  xray-knife subs snapshot show --id 1 --at 2024-05-01
+  xray-knife subs disable --where "protocol = 'ss' AND last_seen < date('now', '-30 day')"
+  xray-knife subs results diff --run 3 --run 5
+  xray-knife subs best --top 5 --explain
+  xray-knife subs import --format v2rayn guiNConfig.json`,
 }
 
 func addSubcommandPalettes() {
@@ -28,6 +36,18 @@ func addSubcommandPalettes() {
 	SubsCmd.AddCommand(RmCmd)
 	SubsCmd.AddCommand(UpdateCmd)
 	SubsCmd.AddCommand(ListConfigsCmd)
+	SubsCmd.AddCommand(GroupsCmd)
+	SubsCmd.AddCommand(ReparseCmd)
+	SubsCmd.AddCommand(NoteCmd)
+	SubsCmd.AddCommand(AliasCmd)
+	SubsCmd.AddCommand(DisableCmd)
+	SubsCmd.AddCommand(EnableCmd)
+	SubsCmd.AddCommand(SnapshotCmd)
+	SubsCmd.AddCommand(TestTargetCmd)
+	SubsCmd.AddCommand(ResultsCmd)
+	SubsCmd.AddCommand(NewExportCommand())
+	SubsCmd.AddCommand(BestCmd)
+	SubsCmd.AddCommand(NewImportCommand())
 }
 
 func init() {
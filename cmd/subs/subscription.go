@@ -1,84 +1,562 @@
 package subs
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/lilendian0x00/xray-knife/v9/utils"
-	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
-
 	"github.com/imroc/req/v3"
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
 // TODO: Make a database to store subscriptions
 type Subscription struct {
 	Remark      string
 	Url         string
-	UserAgent   string
+	UserAgent   string // a User-Agent or the name of a preset, see userAgentPresets
+	Impersonate string // browser fingerprint, one of ImpersonationNames ("" = DefaultImpersonation)
 	Method      string
 	ConfigLinks []string
 	Proxy       string
+	// Auth holds the headers, basic auth and cookies private panels require.
+	Auth database.SubscriptionAuth
+	// HTMLSelector and HTMLPattern pick the links out of an HTML page served
+	// instead of a subscription body; see scrapeOptions.
+	HTMLSelector string
+	HTMLPattern  string
+	// TelegramPages is how many pages of a t.me/s/ channel are read, 0 for
+	// DefaultTelegramPages.
+	TelegramPages int
+	// Raw, when set, receives the response body as Stream reads it.
+	Raw io.Writer
+	// MaxRedirects is how many redirects a fetch follows, 0 for
+	// DefaultMaxRedirects.
+	MaxRedirects int
+	// ResolvedURL is where Url led after redirects on the last request.
+	ResolvedURL string
+	// Mirrors are other URLs serving the same payload. Stream falls back to
+	// them in order when Url can't be fetched or, with RaceMirrors, requests
+	// all of them at once and reads the first to answer.
+	Mirrors     []string
+	RaceMirrors bool
+	// FetchedFrom is the URL or mirror the last Stream read from.
+	FetchedFrom string
+	// Exclude drops the links any of its rules match; Excluded is how many
+	// the last fetch dropped.
+	Exclude  []ExcludeRule
+	Excluded int
 }
 
-func (s *Subscription) FetchAll() ([]string, error) {
-	u, err := url.Parse(s.Url)
+// DefaultMaxRedirects is how many redirects a fetch follows by default, enough
+// for a shortener in front of a panel's own redirects.
+const DefaultMaxRedirects = 10
+
+// localPath returns the file a subscription URL refers to, for file:// URLs and plain
+// paths. ok is false for network URLs.
+func localPath(raw string) (path string, ok bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		return raw, true, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !strings.EqualFold(u.Scheme, "file") {
+		return "", false, nil
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", true, fmt.Errorf("invalid file URL %q: only local files are supported, use file:///path/to/file", raw)
+	}
+	if u.Path == "" {
+		return "", true, fmt.Errorf("invalid file URL %q: missing path", raw)
+	}
+	return filepath.FromSlash(u.Path), true, nil
+}
+
+// IsLocalSubscription reports whether a subscription URL is a file:// URL or a path.
+func IsLocalSubscription(raw string) bool {
+	_, ok, _ := localPath(raw)
+	return ok
+}
+
+// ResolveSubscriptionURL validates a subscription URL before it is stored or fetched.
+// Local paths and file:// URLs are turned into an absolute file:// URL, so they keep
+// working from any directory, and must name an existing file.
+func ResolveSubscriptionURL(raw string) (string, error) {
+	path, local, err := localPath(raw)
+	if err != nil {
+		return "", err
+	}
+	if !local {
+		if _, err := url.ParseRequestURI(raw); err != nil {
+			return "", fmt.Errorf("invalid URL %q: %w", raw, err)
+		}
+		return raw, nil
+	}
+
+	if path, err = filepath.Abs(path); err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", raw, err)
+	}
+	info, err := os.Stat(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid subscription URL %q: %w", s.Url, err)
+		return "", fmt.Errorf("invalid subscription %q: not a URL or a readable file: %w", raw, err)
 	}
-	if s.Method == "" {
-		s.Method = "GET"
+	if info.IsDir() {
+		return "", fmt.Errorf("invalid subscription %q: %s is a directory", raw, path)
 	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
 
-	client := req.C().ImpersonateChrome()
+// resolveMirrors validates the mirrors of the subscription at subURL like
+// ResolveSubscriptionURL does, dropping repeats and the subscription's own URL.
+func resolveMirrors(subURL string, mirrors []string) ([]string, error) {
+	if len(mirrors) > 0 {
+		if _, ok := telegramChannel(subURL); ok {
+			return nil, fmt.Errorf("mirrors don't apply to Telegram channels")
+		}
+	}
+	seen := map[string]bool{normalizeSubURL(subURL): true}
+	var resolved []string
+	for _, m := range mirrors {
+		if strings.TrimSpace(m) == "" {
+			continue
+		}
+		m, err := ResolveSubscriptionURL(strings.TrimSpace(m))
+		if err != nil {
+			return nil, fmt.Errorf("mirror: %w", err)
+		}
+		if key := normalizeSubURL(m); !seen[key] {
+			seen[key] = true
+			resolved = append(resolved, m)
+		}
+	}
+	return resolved, nil
+}
+
+// ctxReadCloser stops reading a local file once its context is cancelled.
+type ctxReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r ctxReadCloser) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
 
-	r := client.R()
+// open sends the subscription request and returns the response body on a 2xx status.
+// Local files are read directly; the proxy, User-Agent and credentials don't apply to them.
+// Cancelling ctx aborts both the request and any read from the returned body.
+// Mirrors are tried when Url fails, and only then: a payload that breaks off
+// halfway isn't read again from a mirror.
+func (s *Subscription) open(ctx context.Context) (io.ReadCloser, error) {
+	s.FetchedFrom = ""
+	if len(s.Mirrors) == 0 {
+		body, err := s.openURL(ctx, s.Url)
+		if err == nil {
+			s.FetchedFrom = s.Url
+		}
+		return body, err
+	}
+	urls := append([]string{s.Url}, s.Mirrors...)
+	if s.RaceMirrors {
+		return s.openFirst(ctx, urls)
+	}
+
+	var errs []error
+	for _, u := range urls {
+		body, err := s.openURL(ctx, u)
+		if err == nil {
+			s.FetchedFrom = u
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+	}
+	return nil, fmt.Errorf("no mirror could be fetched: %w", errors.Join(errs...))
+}
+
+// openFirst requests all urls at once and returns the body of the first to answer
+// with a 2xx status. The other requests are cancelled.
+func (s *Subscription) openFirst(ctx context.Context, urls []string) (io.ReadCloser, error) {
+	type opened struct {
+		index    int
+		body     io.ReadCloser
+		resolved string
+		err      error
+	}
+	results := make(chan opened, len(urls))
+	cancels := make([]context.CancelFunc, len(urls))
+	for i, u := range urls {
+		reqCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func() {
+			body, resolved, err := s.request(reqCtx, u)
+			results <- opened{i, body, resolved, err}
+		}()
+	}
+
+	var errs []error
+	for i := range urls {
+		r := <-results
+		if r.err != nil {
+			cancels[r.index]()
+			errs = append(errs, fmt.Errorf("%s: %w", urls[r.index], r.err))
+			continue
+		}
+		for j, cancel := range cancels {
+			if j != r.index {
+				cancel()
+			}
+		}
+		// Requests that answer anyway are closed as they come in.
+		go func(left int) {
+			for ; left > 0; left-- {
+				if late := <-results; late.body != nil {
+					late.body.Close()
+				}
+			}
+		}(len(urls) - i - 1)
+		s.FetchedFrom = urls[r.index]
+		if r.index == 0 && r.resolved != "" {
+			s.ResolvedURL = r.resolved
+		}
+		return cancelOnClose{ReadCloser: r.body, cancel: cancels[r.index]}, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("no mirror could be fetched: %w", errors.Join(errs...))
+}
+
+// cancelOnClose releases the context of a request once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// openURL is open for another URL of the same source, such as the next page.
+func (s *Subscription) openURL(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	body, resolved, err := s.request(ctx, rawURL)
+	if err == nil && rawURL == s.Url && resolved != "" {
+		s.ResolvedURL = resolved
+	}
+	return body, err
+}
+
+// request opens rawURL and returns the body and, for network URLs, where the
+// redirects led. It doesn't change s, so requests can run at once.
+func (s *Subscription) request(ctx context.Context, rawURL string) (io.ReadCloser, string, error) {
+	if path, local, err := localPath(rawURL); local {
+		if err != nil {
+			return nil, "", err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read subscription file: %w", err)
+		}
+		return ctxReadCloser{ctx: ctx, ReadCloser: f}, "", nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid subscription URL %q: %w", rawURL, err)
+	}
+	method := s.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	client := newFetchClient(s.Impersonate)
+	maxRedirects := s.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	client.SetRedirectPolicy(req.MaxRedirectPolicy(maxRedirects))
+
+	// Asking for the codings decodeContent handles keeps the client from
+	// decoding gzip itself, which fails on bodies mislabeled as gzip.
+	r := client.R().SetContext(ctx).SetHeader("Accept-Encoding", acceptEncoding)
 	if s.UserAgent != "" {
-		r.SetHeader("User-Agent", s.UserAgent)
+		r.SetHeader("User-Agent", resolveUserAgent(s.UserAgent))
+	}
+	for name, value := range s.Auth.Headers {
+		r.SetHeader(name, value)
+	}
+	if s.Auth.Username != "" {
+		r.SetBasicAuth(s.Auth.Username, s.Auth.Password)
+	}
+	if s.Auth.Cookies != "" {
+		r.SetHeader("Cookie", s.Auth.Cookies)
 	}
 
 	if s.Proxy != "" {
 		client.SetProxyURL(s.Proxy)
 	}
 
-	response, err := r.Send(s.Method, u.String())
+	response, err := r.Send(method, u.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch subscription: %w", err)
+		return nil, "", fmt.Errorf("failed to fetch subscription: %w", err)
 	}
-	defer response.Body.Close()
 
 	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return nil, fmt.Errorf("server returned HTTP %d for %s", response.StatusCode, s.Url)
+		response.Body.Close()
+		return nil, "", fmt.Errorf("server returned HTTP %d for %s", response.StatusCode, rawURL)
 	}
-
-	body, err := io.ReadAll(response.Body)
+	body, err := decodeContent(response.Body, response.Header.Get("Content-Encoding"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		response.Body.Close()
+		return nil, "", err
 	}
+	// The response belongs to the last request of the redirect chain.
+	var resolved string
+	if response.Response.Request != nil {
+		resolved = response.Response.Request.URL.String()
+	}
+	return body, resolved, nil
+}
 
+// FetchAll fetches the subscription and returns its links.
+func (s *Subscription) FetchAll() ([]string, error) {
 	var links []string
-	decoded, err := utils.Base64Decode(string(body))
+	if _, err := s.Stream(context.Background(), func(link string) error {
+		links = append(links, link)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s.ConfigLinks = links
+	return links, nil
+}
+
+// streamPeekSize is how much of the body Stream inspects to detect base64 encoding.
+const streamPeekSize = 4096
+
+// Stream fetches the subscription and calls yield for every non-empty link as it is
+// read, without holding the whole payload in memory. Base64 payloads are decoded on
+// the fly. It stops at the first error returned by yield and reports how many links
+// were yielded. Cancelling ctx stops the download and returns ctx.Err().
+// Telegram channel previews (t.me/s/<channel>) are read page by page.
+func (s *Subscription) Stream(ctx context.Context, yield func(link string) error) (int, error) {
+	scrape, err := newScrapeOptions(s.HTMLSelector, s.HTMLPattern)
+	if err != nil {
+		return 0, err
+	}
+	if channel, ok := telegramChannel(s.Url); ok {
+		count, err := s.streamTelegram(ctx, channel, scrape, yield)
+		if err != nil && ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		return count, err
+	}
+	body, err := s.open(ctx)
 	if err != nil {
-		// Probably It's not base64 encoded!, let's try parsing without decoding
-		customlog.Printf(customlog.Processing, "Couldn't decode the body! let's try parsing without decoding...\n")
-		links = strings.Split(string(body), "\n")
-	} else {
-		// Configs are separated by newline char
-		links = strings.Split(string(decoded), "\n")
+		return 0, err
+	}
+	defer body.Close()
+
+	var src io.Reader = body
+	if s.Raw != nil {
+		src = io.TeeReader(body, s.Raw)
+	}
+	count, err := readLinks(src, scrape, yield)
+	if err != nil && ctx.Err() != nil {
+		return count, ctx.Err()
+	}
+	return count, err
+}
+
+// readLinks calls yield for every non-empty link of a subscription payload. Base64
+// payloads are decoded on the fly, whether the whole body or each line is encoded,
+// and a gzip or zlib compression, a UTF-8 byte order mark or a data: URI wrapping
+// the body is removed first. Links are scraped from HTML pages, and from any body
+// when scrape has a pattern.
+func readLinks(r io.Reader, scrape scrapeOptions, yield func(link string) error) (int, error) {
+	br, err := uncompress(bufio.NewReaderSize(r, streamPeekSize))
+	if err != nil {
+		return 0, err
+	}
+	peek := func() ([]byte, error) {
+		head, err := br.Peek(streamPeekSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		return head, nil
+	}
+	head, err := peek()
+	if err != nil {
+		return 0, err
+	}
+	if bytes.HasPrefix(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		if head, err = peek(); err != nil {
+			return 0, err
+		}
+	}
+
+	if scrape.selector != nil || looksLikeHTML(head) {
+		links, err := scrapeLinks(br, scrape)
+		if err != nil {
+			return 0, err
+		}
+		return yieldAll(links, yield)
+	}
+	if scrape.pattern != nil {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read subscription body: %w", err)
+		}
+		return yieldAll(matchLinks(string(data), scrape.pattern), yield)
 	}
 
-	// Filter out empty and whitespace-only lines
-	var filtered []string
-	for _, l := range links {
-		if trimmed := strings.TrimSpace(l); trimmed != "" {
-			filtered = append(filtered, trimmed)
+	var reader io.Reader = br
+	if header, ok := dataURIHeader(head); ok {
+		br.Discard(len(header) + 1)
+		if !strings.HasSuffix(strings.ToLower(header), ";base64") {
+			// A plain data URI is percent-encoded as a whole.
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return 0, fmt.Errorf("failed to read subscription body: %w", err)
+			}
+			text, err := url.PathUnescape(string(data))
+			if err != nil {
+				return 0, fmt.Errorf("invalid data URI subscription: %w", err)
+			}
+			return scanLinks(strings.NewReader(text), yield)
+		}
+		if head, err = peek(); err != nil {
+			return 0, err
 		}
 	}
 
-	s.ConfigLinks = filtered
-	return filtered, nil
+	switch {
+	case base64Lines(head, len(head) == streamPeekSize):
+		return scanLinks(br, func(line string) error {
+			decoded, err := utils.Base64Decode(line)
+			if err != nil {
+				return yield(line)
+			}
+			for _, link := range strings.Split(string(decoded), "\n") {
+				if link = strings.TrimSpace(link); link != "" {
+					if err := yield(link); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	case detectBase64(head):
+		reader = utils.NewBase64StreamDecoder(br)
+	}
+	return scanLinks(reader, yield)
+}
+
+// scanLinks calls yield for every non-empty line of r and returns how many there were.
+func scanLinks(r io.Reader, yield func(link string) error) (int, error) {
+	scanner := bufio.NewScanner(r)
+	// Allow very long lines (e.g. vmess base64 blobs)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	count := 0
+	for scanner.Scan() {
+		link := strings.TrimSpace(scanner.Text())
+		if link == "" {
+			continue
+		}
+		if err := yield(link); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read subscription body: %w", err)
+	}
+	return count, nil
+}
+
+// yieldAll calls yield for each of links and returns how many were yielded.
+func yieldAll(links []string, yield func(link string) error) (int, error) {
+	for i, link := range links {
+		if err := yield(link); err != nil {
+			return i, err
+		}
+	}
+	return len(links), nil
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// dataURIHeader returns the media type and parameters of a body wrapped in a data:
+// URI, e.g. "data:text/plain;base64" for "data:text/plain;base64,dmxlc3M6Ly8...".
+func dataURIHeader(head []byte) (string, bool) {
+	if len(head) < 5 || !strings.EqualFold(string(head[:5]), "data:") {
+		return "", false
+	}
+	comma := bytes.IndexByte(head, ',')
+	if comma < 0 || bytes.ContainsAny(head[:comma], " \r\n") {
+		return "", false
+	}
+	return string(head[:comma]), true
+}
+
+// detectBase64 reports whether the start of a subscription body is base64 encoded,
+// by decoding it leniently and looking for a URI scheme separator.
+func detectBase64(head []byte) bool {
+	decoded, err := io.ReadAll(utils.NewBase64StreamDecoder(bytes.NewReader(head)))
+	return err == nil && bytes.Contains(decoded, []byte("://"))
+}
+
+// base64Lines reports whether every line at the start of a subscription body is a
+// link encoded on its own, as opposed to one base64 stream wrapped over lines. When
+// truncated, the last line of head may be incomplete and isn't checked. A wrapped
+// stream gives itself away by lines that don't decode to exactly one link.
+func base64Lines(head []byte, truncated bool) bool {
+	lines := strings.Split(strings.TrimSpace(string(head)), "\n")
+	if truncated && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) < 2 {
+		return false
+	}
+	for _, line := range lines {
+		decoded, err := utils.Base64Decode(line)
+		if err != nil || !startsWithScheme(decoded) || bytes.ContainsAny(decoded, "\r\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// startsWithScheme reports whether b starts with a URI scheme and "://".
+func startsWithScheme(b []byte) bool {
+	i := bytes.Index(b, []byte("://"))
+	if i <= 0 {
+		return false
+	}
+	for _, c := range b[:i] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
 }
 
 func (s *Subscription) RemoveDuplicate(verbose bool) {
@@ -1,11 +1,25 @@
 package subs
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"database/sql"
 	"encoding/base64"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/lilendian0x00/xray-knife/v9/database"
 )
 
 func TestFetchAll_Base64Encoded(t *testing.T) {
@@ -160,3 +174,426 @@ func TestRemoveDuplicate_NoDuplicates(t *testing.T) {
 		t.Fatalf("expected 3 links, got %d", len(s.ConfigLinks))
 	}
 }
+
+func TestStream_Base64Encoded(t *testing.T) {
+	configs := "vless://uuid@example.com:443?type=tcp#Config1\ntrojan://pass@host:443#T\n\nss://abc@host:8388#S\n"
+	// Unpadded and wrapped at 20 columns, as some providers do.
+	encoded := base64.RawStdEncoding.EncodeToString([]byte(configs))
+	var wrapped strings.Builder
+	for i := 0; i < len(encoded); i += 20 {
+		end := min(i+20, len(encoded))
+		wrapped.WriteString(encoded[i:end] + "\r\n")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(wrapped.String()))
+	}))
+	defer server.Close()
+
+	var got []string
+	s := Subscription{Url: server.URL}
+	n, err := s.Stream(context.Background(), func(link string) error {
+		got = append(got, link)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	if n != 3 || len(got) != 3 {
+		t.Fatalf("expected 3 links, got %d: %v", n, got)
+	}
+	if got[2] != "ss://abc@host:8388#S" {
+		t.Errorf("unexpected last link %q", got[2])
+	}
+}
+
+func TestStream_PlainText(t *testing.T) {
+	configs := "link1\n\n  \nlink2\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(configs))
+	}))
+	defer server.Close()
+
+	var got []string
+	s := Subscription{Url: server.URL}
+	if _, err := s.Stream(context.Background(), func(link string) error {
+		got = append(got, link)
+		return nil
+	}); err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	if len(got) != 2 || got[0] != "link1" || got[1] != "link2" {
+		t.Fatalf("unexpected links: %v", got)
+	}
+}
+
+func TestStream_StopsOnYieldError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("vless://a@h:1\nvless://b@h:2\nvless://c@h:3\n"))
+	}))
+	defer server.Close()
+
+	stop := errors.New("stop")
+	s := Subscription{Url: server.URL}
+	n, err := s.Stream(context.Background(), func(link string) error {
+		if strings.Contains(link, "b@") {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected stop error, got %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 yielded link before stopping, got %d", n)
+	}
+}
+
+func TestStream_LocalFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "list.txt")
+	encoded := base64.StdEncoding.EncodeToString([]byte("vless://a@h:1\n\nss://b@h:2\n"))
+	if err := os.WriteFile(path, []byte(encoded), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fileURL, err := ResolveSubscriptionURL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fileURL, "file:///") {
+		t.Errorf("resolved to %q, want a file:// URL", fileURL)
+	}
+
+	for _, u := range []string{path, fileURL} {
+		var links []string
+		s := Subscription{Url: u}
+		if _, err := s.Stream(context.Background(), func(link string) error {
+			links = append(links, link)
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: %v", u, err)
+		}
+		if len(links) != 2 || links[1] != "ss://b@h:2" {
+			t.Errorf("%s: links = %q", u, links)
+		}
+	}
+}
+
+func TestResolveSubscriptionURL(t *testing.T) {
+	dir := t.TempDir()
+	for _, bad := range []string{
+		filepath.Join(dir, "missing.txt"),
+		dir,
+		"file://remote-host/list.txt",
+		"https//example.com",
+	} {
+		if u, err := ResolveSubscriptionURL(bad); err == nil {
+			t.Errorf("%q resolved to %q, want an error", bad, u)
+		}
+	}
+	if u, err := ResolveSubscriptionURL("https://example.com/sub"); err != nil || u != "https://example.com/sub" {
+		t.Errorf("https URL: %q, %v", u, err)
+	}
+}
+
+func TestUniqueURLs(t *testing.T) {
+	urls := []string{
+		"https://example.com/sub",
+		" https://EXAMPLE.com:443/sub ",
+		"https://example.com/sub?token=1",
+		"http://example.com/sub",
+		"https://example.com/sub",
+	}
+	got, dups := uniqueURLs(urls)
+	want := []string{"https://example.com/sub", "https://example.com/sub?token=1", "http://example.com/sub"}
+	if dups != 2 || len(got) != len(want) {
+		t.Fatalf("uniqueURLs() = %v (%d dropped), want %v", got, dups, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("url[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGroupSubscriptions(t *testing.T) {
+	sub := func(id int64, url, ua string) database.Subscription {
+		return database.Subscription{ID: id, URL: url, UserAgent: sql.NullString{String: ua, Valid: ua != ""}}
+	}
+	subs := []database.Subscription{
+		sub(1, "https://example.com/sub", ""),
+		sub(2, "https://other.example/sub", ""),
+		sub(3, "https://Example.com:443/sub", ""),
+		sub(4, "https://example.com/sub", "v2rayNG"),
+	}
+
+	fc := &FetchCommand{config: &FetchConfig{}}
+	groups := fc.groupSubscriptions(subs)
+	if len(groups) != 3 || len(groups[0]) != 2 || groups[0][1].ID != 3 {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+
+	// --useragent overrides every stored User-Agent, so all requests to the URL match.
+	fc.config.UserAgent = "custom"
+	if groups := fc.groupSubscriptions(subs); len(groups) != 2 || len(groups[0]) != 3 {
+		t.Fatalf("unexpected groups with --useragent: %+v", groups)
+	}
+}
+
+func TestFetchAll_SendsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		cookie, err := r.Cookie("session")
+		if !ok || user != "me" || pass != "pw" || err != nil || cookie.Value != "abc" || r.Header.Get("X-Token") != "t0k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("vless://uuid@host:443#Private\n"))
+	}))
+	defer server.Close()
+
+	s := Subscription{Url: server.URL}
+	if _, err := s.FetchAll(); err == nil {
+		t.Fatal("fetch without credentials succeeded")
+	}
+
+	s.Auth = database.SubscriptionAuth{
+		Headers:  map[string]string{"X-Token": "t0k"},
+		Username: "me",
+		Password: "pw",
+		Cookies:  "session=abc",
+	}
+	links, err := s.FetchAll()
+	if err != nil {
+		t.Fatalf("FetchAll error: %v", err)
+	}
+	if len(links) != 1 {
+		t.Errorf("expected 1 link, got %v", links)
+	}
+}
+
+func TestReadLinks_Encodings(t *testing.T) {
+	links := "vless://uuid@host:443?type=tcp#A\ntrojan://pw@host:443#B\nss://YWVzLTI1Ni1nY206cHc@host:8388#C"
+	std := base64.StdEncoding.EncodeToString([]byte(links))
+	wrap := func(encoded string) string {
+		wrapped := ""
+		for i := 0; i < len(encoded); i += 76 {
+			wrapped += encoded[i:min(i+76, len(encoded))] + "\r\n"
+		}
+		return wrapped
+	}
+	var perLine, chunks []string
+	for _, l := range strings.Split(links, "\n") {
+		perLine = append(perLine, base64.RawStdEncoding.EncodeToString([]byte(l)))
+		chunks = append(chunks, base64.StdEncoding.EncodeToString([]byte(l)))
+	}
+	// Make sure the URL-safe alphabet shows up after the part detectBase64 inspects.
+	urlSafeLinks := strings.Repeat("vless://uuid@host:443#pad\n", 200) + "vless://uuid@host:443?path=%3F%3F%3F#\xff\xfe~~"
+
+	tests := map[string]struct {
+		body string
+		want []string
+	}{
+		"plain":               {links, nil},
+		"padded":              {std, nil},
+		"unpadded":            {strings.TrimRight(std, "="), nil},
+		"wrapped":             {wrap(std), nil},
+		"url-safe":            {base64.RawURLEncoding.EncodeToString([]byte(links)), nil},
+		"each line encoded":   {strings.Join(perLine, "\n"), nil},
+		"concatenated chunks": {strings.Join(chunks, ""), nil},
+		"data URI base64":     {"data:text/plain;base64," + std, nil},
+		"data URI plain":      {"data:," + url.PathEscape(links), nil},
+		"byte order mark":     {"\xEF\xBB\xBF" + std, nil},
+		"late url-safe chars": {base64.URLEncoding.EncodeToString([]byte(urlSafeLinks)), strings.Split(urlSafeLinks, "\n")},
+		"gzip":                {gzipped(links), nil},
+		"zlib":                {zlibbed(links), nil},
+		"gzip of base64":      {gzipped(std), nil},
+		"base64 of gzip":      {base64.StdEncoding.EncodeToString([]byte(gzipped(links))), nil},
+		"wrapped base64 gzip": {wrap(base64.StdEncoding.EncodeToString([]byte(gzipped(links)))), nil},
+	}
+	for name, tt := range tests {
+		want := tt.want
+		if want == nil {
+			want = strings.Split(links, "\n")
+		}
+		var got []string
+		_, err := readLinks(strings.NewReader(tt.body), scrapeOptions{}, func(link string) error {
+			got = append(got, link)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: got %d links %q, want %d", name, len(got), got, len(want))
+		}
+	}
+}
+
+func TestFetchAll_FollowsRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/hop?token=1", http.StatusFound)
+	})
+	mux.HandleFunc("/hop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sub", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("vless://uuid@host:443#A\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := Subscription{Url: server.URL + "/short"}
+	if _, err := s.FetchAll(); err != nil {
+		t.Fatal(err)
+	}
+	if s.ResolvedURL != server.URL+"/sub" {
+		t.Errorf("ResolvedURL = %q, want %s/sub", s.ResolvedURL, server.URL)
+	}
+
+	s = Subscription{Url: server.URL + "/short", MaxRedirects: 1}
+	if _, err := s.FetchAll(); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("FetchAll past the redirect limit = %v, want an error", err)
+	}
+}
+
+func TestSameDestination(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://panel.example.com/sub/abc?t=1", "https://PANEL.example.com/sub/abc?t=2", true},
+		{"https://panel.example.com/sub/abc", "https://evil.example.net/sub/abc", false},
+		{"https://panel.example.com/sub/abc", "http://panel.example.com/sub/abc", false},
+		{"https://panel.example.com/sub/abc", "https://panel.example.com/sub/xyz", false},
+	}
+	for _, c := range cases {
+		if got := sameDestination(c.a, c.b); got != c.want {
+			t.Errorf("sameDestination(%s, %s) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestStream_Mirrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusBadGateway)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/mirror", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("vless://uuid@host:443#A\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := Subscription{Url: server.URL + "/down", Mirrors: []string{server.URL + "/mirror"}}
+	if links, err := s.FetchAll(); err != nil || len(links) != 1 {
+		t.Fatalf("FetchAll with a mirror = %v, %v; want the mirror's link", links, err)
+	}
+	if s.FetchedFrom != server.URL+"/mirror" {
+		t.Errorf("FetchedFrom = %q, want the mirror", s.FetchedFrom)
+	}
+
+	start := time.Now()
+	s = Subscription{Url: server.URL + "/slow", Mirrors: []string{server.URL + "/down", server.URL + "/mirror"}, RaceMirrors: true}
+	if links, err := s.FetchAll(); err != nil || len(links) != 1 {
+		t.Fatalf("FetchAll racing mirrors = %v, %v; want the mirror's link", links, err)
+	}
+	if s.FetchedFrom != server.URL+"/mirror" || time.Since(start) > 3*time.Second {
+		t.Errorf("race read %q after %s, want the answering mirror at once", s.FetchedFrom, time.Since(start))
+	}
+
+	s = Subscription{Url: server.URL + "/down", Mirrors: []string{server.URL + "/down?again"}}
+	if _, err := s.FetchAll(); err == nil || !strings.Contains(err.Error(), "no mirror") {
+		t.Errorf("FetchAll with all mirrors down = %v, want an error", err)
+	}
+}
+
+func TestResolveMirrors(t *testing.T) {
+	got, err := resolveMirrors("https://example.com/sub", []string{"https://mirror.example.net/sub", "https://EXAMPLE.com:443/sub", "", "https://mirror.example.net/sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "https://mirror.example.net/sub" {
+		t.Errorf("resolveMirrors() = %v, want only the distinct mirror", got)
+	}
+	if _, err := resolveMirrors("https://example.com/sub", []string{"::not a url"}); err == nil {
+		t.Error("resolveMirrors accepted an invalid mirror")
+	}
+	if _, err := resolveMirrors("https://t.me/s/channel", []string{"https://example.com/sub"}); err == nil {
+		t.Error("resolveMirrors accepted mirrors for a Telegram channel")
+	}
+}
+
+func gzipped(s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+func zlibbed(s string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+func brotlied(s string) string {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+func TestFetchAll_ContentEncoding(t *testing.T) {
+	links := "vless://uuid@host:443#A\ntrojan://pw@host:443#B"
+	var deflated bytes.Buffer
+	fw, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+	fw.Write([]byte(links))
+	fw.Close()
+
+	tests := map[string]struct {
+		encoding string
+		body     string
+	}{
+		"br":                 {"br", brotlied(links)},
+		"deflate":            {"deflate", zlibbed(links)},
+		"raw deflate":        {"deflate", deflated.String()},
+		"gzip then br":       {"gzip, br", brotlied(gzipped(links))},
+		"br of base64":       {"br", brotlied(base64.StdEncoding.EncodeToString([]byte(links)))},
+		"mislabeled gzip":    {"gzip", links},
+		"unknown coding":     {"compress", links},
+		"gzip without label": {"", gzipped(links)},
+	}
+	for name, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.encoding != "" {
+				w.Header().Set("Content-Encoding", tt.encoding)
+			}
+			w.Write([]byte(tt.body))
+		}))
+		s := Subscription{Url: server.URL}
+		got, err := s.FetchAll()
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: FetchAll error: %v", name, err)
+			continue
+		}
+		if strings.Join(got, "\n") != links {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+}
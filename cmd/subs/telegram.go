@@ -0,0 +1,128 @@
+package subs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultTelegramPages is how many pages of a Telegram channel a fetch reads.
+const DefaultTelegramPages = 5
+
+// telegramMessageSelector matches the text of the posts on a t.me/s/ page.
+const telegramMessageSelector = ".tgme_widget_message_text"
+
+// telegramPreviewURL is where the web previews of channels are served.
+var telegramPreviewURL = "https://t.me/s/"
+
+var telegramChannelName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{3,31}$`)
+
+// TelegramChannelURL returns the URL of the public web preview of a Telegram
+// channel, given as @name, name or a t.me link.
+func TelegramChannelURL(channel string) (string, error) {
+	name := strings.TrimSpace(channel)
+	if strings.Contains(name, "t.me/") {
+		if !strings.Contains(name, "://") {
+			name = "https://" + name
+		}
+		if ch, ok := telegramChannel(name); ok {
+			name = ch
+		} else if u, err := url.Parse(name); err == nil {
+			name = strings.Trim(u.Path, "/")
+		}
+	}
+	name = strings.TrimPrefix(name, "@")
+	if !telegramChannelName.MatchString(name) {
+		return "", fmt.Errorf("invalid Telegram channel %q, want @name with 5-32 letters, digits or underscores", channel)
+	}
+	return "https://t.me/s/" + name, nil
+}
+
+// telegramChannel returns the channel name of a t.me/s/ URL.
+func telegramChannel(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(u.Hostname(), "t.me") && !strings.EqualFold(u.Hostname(), "telegram.me") {
+		return "", false
+	}
+	name, ok := strings.CutPrefix(u.Path, "/s/")
+	name = strings.Trim(name, "/")
+	if !ok || !telegramChannelName.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// streamTelegram scrapes the config links posted in a public Telegram channel. It
+// starts at the latest posts and follows the "load more" links to older ones, up
+// to s.TelegramPages pages, yielding each link once.
+func (s *Subscription) streamTelegram(ctx context.Context, channel string, scrape scrapeOptions, yield func(link string) error) (int, error) {
+	if scrape.selector == nil {
+		scrape.selector, _ = parseSelector(telegramMessageSelector)
+	}
+	pages := s.TelegramPages
+	if pages <= 0 {
+		pages = DefaultTelegramPages
+	}
+
+	seen := make(map[string]bool)
+	count := 0
+	pageURL := telegramPreviewURL + channel
+	for page := 0; page < pages && pageURL != ""; page++ {
+		body, err := s.openURL(ctx, pageURL)
+		if err != nil {
+			if page > 0 {
+				// Keep what the newer pages gave.
+				break
+			}
+			return 0, err
+		}
+		raw, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return count, fmt.Errorf("failed to read %s: %w", pageURL, err)
+		}
+		if s.Raw != nil {
+			s.Raw.Write(raw)
+		}
+
+		doc, err := html.Parse(bytes.NewReader(raw))
+		if err != nil {
+			return count, fmt.Errorf("failed to parse %s: %w", pageURL, err)
+		}
+		var text strings.Builder
+		for _, n := range scrape.selector.selectAll(doc) {
+			writeText(&text, n)
+			text.WriteByte('\n')
+		}
+		for _, link := range matchLinks(text.String(), scrape.pattern) {
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+			if err := yield(link); err != nil {
+				return count, err
+			}
+			count++
+		}
+		pageURL = telegramOlderPage(doc, channel)
+	}
+	return count, nil
+}
+
+// telegramOlderPage returns the URL of the page with the posts before those of doc,
+// or "" on the first page of the channel.
+func telegramOlderPage(doc *html.Node, channel string) string {
+	more, _ := parseSelector("a.tme_messages_more[data-before]")
+	for _, n := range more.selectAll(doc) {
+		if before := attrValue(n, "data-before"); before != "" {
+			return telegramPreviewURL + channel + "?before=" + url.QueryEscape(before)
+		}
+	}
+	return ""
+}
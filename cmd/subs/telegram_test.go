@@ -0,0 +1,89 @@
+package subs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTelegramChannelURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"@free_configs":                        "https://t.me/s/free_configs",
+		"free_configs":                         "https://t.me/s/free_configs",
+		"https://t.me/free_configs":            "https://t.me/s/free_configs",
+		"t.me/s/free_configs":                  "https://t.me/s/free_configs",
+		"https://t.me/s/free_configs?before=9": "https://t.me/s/free_configs",
+	} {
+		got, err := TelegramChannelURL(in)
+		if err != nil || got != want {
+			t.Errorf("TelegramChannelURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "@abc", "@1channel", "@bad-name", "https://t.me/"} {
+		if got, err := TelegramChannelURL(in); err == nil {
+			t.Errorf("TelegramChannelURL(%q) = %q, want error", in, got)
+		}
+	}
+}
+
+func TestStreamTelegram_Pages(t *testing.T) {
+	pages := map[string]string{
+		"": `<html><body>
+<div class="tgme_channel_info_description">Join us! vless://not-a-post@x:1</div>
+<a class="tme_messages_more" data-before="30" href="/s/free_configs?before=30"></a>
+<div class="tgme_widget_message_text">vless://a@new.example.com:443#new<br>trojan://b@new.example.com:443</div>
+<div class="tgme_widget_message_text">vless://a@new.example.com:443#new</div>
+</body></html>`,
+		"30": `<html><body>
+<a class="tme_messages_more" data-before="10" href="/s/free_configs?before=10"></a>
+<div class="tgme_widget_message_text">ss://YWVzLTEyOC1nY206cGFzcw@old.example.com:8388</div>
+</body></html>`,
+		"10": `<html><body>
+<div class="tgme_widget_message_text">vless://c@oldest.example.com:443</div>
+</body></html>`,
+	}
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before := r.URL.Query().Get("before")
+		requested = append(requested, before)
+		if r.URL.Path != "/s/free_configs" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, pages[before])
+	}))
+	defer srv.Close()
+
+	old := telegramPreviewURL
+	telegramPreviewURL = srv.URL + "/s/"
+	defer func() { telegramPreviewURL = old }()
+
+	sub := Subscription{Url: "https://t.me/s/free_configs", TelegramPages: 2}
+	links, err := sub.FetchAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"vless://a@new.example.com:443#new",
+		"trojan://b@new.example.com:443",
+		"ss://YWVzLTEyOC1nY206cGFzcw@old.example.com:8388",
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("links = %q, want %q", links, want)
+	}
+	if !reflect.DeepEqual(requested, []string{"", "30"}) {
+		t.Errorf("requested pages before %q, want the 2 latest", requested)
+	}
+
+	sub.TelegramPages = 10
+	requested = nil
+	links, err = sub.FetchAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 4 || len(requested) != 3 {
+		t.Errorf("got %d links from %d pages, want 4 from 3 (stopping at the oldest page)", len(links), len(requested))
+	}
+}
@@ -0,0 +1,109 @@
+package subs
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	testTargetSubID  int64
+	testTargetConfig string
+	testTargetTag    string
+	testTargetURL    string
+	testTargetStatus int
+	testTargetClear  bool
+)
+
+// TestTargetCmd sets a custom test URL / expected status for a subscription, a tag or a single config.
+var TestTargetCmd = &cobra.Command{
+	Use:   "test-target",
+	Short: "Sets a custom test URL and expected HTTP status for a subscription, tag or config",
+	Long: `Overrides the global test destination used by 'xray-knife http' for the configs of
+a subscription, for a single config, or for the configs whose remark matches a tag.
+A tag is a regular expression, such as 'IR|🇮🇷' for the Iranian-facing configs, and
+applies to any tested link, in the database or not. Per-config and per-subscription
+overrides take precedence over tags; the first tag set wins among matching ones.
+When an expected status is set, any other status code fails the test.
+
+Examples:
+  xray-knife subs test-target --sub-id 2 --url "https://www.gstatic.com/generate_204" --expect 204
+  xray-knife subs test-target --config-id 57 --url "https://www.aparat.com" --expect 200
+  xray-knife subs test-target --config-id de-1 --expect 204
+  xray-knife subs test-target --tag "IR|🇮🇷" --url "https://www.aparat.com"
+  xray-knife subs test-target --sub-id 2 --clear`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets := 0
+		for _, set := range []bool{testTargetSubID != 0, testTargetConfig != "", testTargetTag != ""} {
+			if set {
+				targets++
+			}
+		}
+		if targets != 1 {
+			return fmt.Errorf("exactly one of --sub-id, --config-id or --tag is required")
+		}
+		if testTargetTag != "" {
+			if _, err := regexp.Compile(testTargetTag); err != nil {
+				return fmt.Errorf("invalid --tag: %w", err)
+			}
+		}
+
+		if testTargetClear {
+			testTargetURL, testTargetStatus = "", 0
+		} else {
+			if testTargetURL == "" && testTargetStatus == 0 {
+				return fmt.Errorf("at least one of --url or --expect is required (or --clear)")
+			}
+			if testTargetURL != "" {
+				u, err := url.Parse(testTargetURL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("--url must be an absolute http(s) URL, got %q", testTargetURL)
+				}
+			}
+			if testTargetStatus != 0 && (testTargetStatus < 100 || testTargetStatus > 599) {
+				return fmt.Errorf("--expect must be a valid HTTP status code, got %d", testTargetStatus)
+			}
+		}
+
+		if testTargetSubID != 0 {
+			if err := database.SetSubscriptionTestTarget(testTargetSubID, testTargetURL, testTargetStatus); err != nil {
+				return err
+			}
+			customlog.Printf(customlog.Success, "Updated test target of subscription ID %d.\n", testTargetSubID)
+			return nil
+		}
+		if testTargetTag != "" {
+			if err := database.SetTagTestTarget(testTargetTag, testTargetURL, testTargetStatus); err != nil {
+				return err
+			}
+			customlog.Printf(customlog.Success, "Updated test target of tag %q.\n", testTargetTag)
+			return nil
+		}
+
+		config, err := database.GetConfigByRef(testTargetConfig)
+		if err != nil {
+			return err
+		}
+		if err := database.SetConfigTestTarget(config.ID, testTargetURL, testTargetStatus); err != nil {
+			return err
+		}
+		customlog.Printf(customlog.Success, "Updated test target of config ID %d.\n", config.ID)
+		return nil
+	},
+}
+
+func init() {
+	TestTargetCmd.Flags().Int64Var(&testTargetSubID, "sub-id", 0, "ID of the subscription to configure")
+	TestTargetCmd.Flags().StringVar(&testTargetConfig, "config-id", "", "ID or alias of the config to configure (see 'subs list-configs')")
+	TestTargetCmd.Flags().StringVar(&testTargetTag, "tag", "", "Regular expression matched against config remarks, e.g. 'IR|🇮🇷'")
+	TestTargetCmd.Flags().StringVar(&testTargetURL, "url", "", "Test URL to use instead of the global one")
+	TestTargetCmd.Flags().IntVar(&testTargetStatus, "expect", 0, "Expected HTTP status code (0 = accept any)")
+	TestTargetCmd.Flags().BoolVar(&testTargetClear, "clear", false, "Remove the override")
+	TestTargetCmd.MarkFlagsMutuallyExclusive("sub-id", "config-id", "tag")
+	TestTargetCmd.MarkFlagsMutuallyExclusive("clear", "url")
+	TestTargetCmd.MarkFlagsMutuallyExclusive("clear", "expect")
+}
@@ -2,6 +2,7 @@ package subs
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/database"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
@@ -14,6 +15,14 @@ var (
 	updateRemark    string
 	updateUserAgent string
 	updateEnabled   string // "true"/"false"/""
+	updateAuth      authFlags
+	updateSelector  string
+	updatePattern   string
+	updateImperson  string
+	updatePriority  int
+	updateMirrors   []string
+	updateRace      bool
+	updateExclude   []string
 )
 
 // UpdateCmd updates an existing subscription in the DB.
@@ -23,10 +32,33 @@ var UpdateCmd = &cobra.Command{
 	Long: `Updates one or more fields of an existing subscription.
 Only the fields you specify will be changed; others remain untouched.
 
+--header replaces all stored headers, --basic-auth and --cookie replace their own
+part of the credentials (pass an empty string to remove it), and --clear-auth
+removes all of them. --html-selector and --html-pattern change how links are
+scraped from an HTML page; pass an empty string to go back to the defaults.
+
+--mirror replaces the mirrors of the subscription (pass an empty string to remove
+them all) and --race-mirrors switches between trying them in order and racing them.
+
+--exclude replaces the exclusion rules dropping fetched links (see 'subs add');
+pass an empty string to remove them all. Configs already in the DB are kept.
+
+--priority orders subscriptions (default 0, higher first). Configs of a higher
+priority come first in 'subs export' and the 'http daemon' best list, and a config
+several subscriptions carry takes its link, remark and test target from the one
+of the highest priority.
+
 Examples:
   xray-knife subs update --id 1 --remark "Renamed Sub"
   xray-knife subs update --id 3 --enabled false
-  xray-knife subs update --id 2 --url "https://new-url.com/sub" --user-agent "clash"`,
+  xray-knife subs update --id 2 --url "https://new-url.com/sub" --user-agent "clash"
+  xray-knife subs update --id 4 -H "Authorization: Bearer new-token"
+  xray-knife subs update --id 4 --clear-auth
+  xray-knife subs update --id 5 --html-selector "div.post pre"
+  xray-knife subs update --id 2 --priority 10
+  xray-knife subs update --id 2 --mirror "https://mirror.example.net/sub" --race-mirrors
+  xray-knife subs update --id 2 --exclude "remark~剩余|到期|官网" --exclude "port!=443"
+  xray-knife subs update --id 2 --exclude ""`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if updateID == 0 {
 			return fmt.Errorf("--id is required")
@@ -36,7 +68,11 @@ Examples:
 		var enabledPtr *bool
 
 		if cmd.Flags().Changed("url") {
-			urlPtr = &updateURL
+			subURL, err := ResolveSubscriptionURL(updateURL)
+			if err != nil {
+				return err
+			}
+			urlPtr = &subURL
 		}
 		if cmd.Flags().Changed("remark") {
 			remarkPtr = &updateRemark
@@ -57,13 +93,103 @@ Examples:
 			}
 		}
 
-		if urlPtr == nil && remarkPtr == nil && uaPtr == nil && enabledPtr == nil {
-			return fmt.Errorf("at least one field must be specified to update (--url, --remark, --user-agent, --enabled)")
+		authChanged := updateAuth.changed(cmd)
+		scrapeChanged := cmd.Flags().Changed("html-selector") || cmd.Flags().Changed("html-pattern")
+		impersonChanged := cmd.Flags().Changed("impersonate")
+		priorityChanged := cmd.Flags().Changed("priority")
+		mirrorsChanged := cmd.Flags().Changed("mirror") || cmd.Flags().Changed("race-mirrors")
+		excludeChanged := cmd.Flags().Changed("exclude")
+		if urlPtr == nil && remarkPtr == nil && uaPtr == nil && enabledPtr == nil && !authChanged && !scrapeChanged && !impersonChanged && !priorityChanged && !mirrorsChanged && !excludeChanged {
+			return fmt.Errorf("at least one field must be specified to update (--url, --remark, --user-agent, --enabled, --header, --basic-auth, --cookie, --clear-auth, --html-selector, --html-pattern, --impersonate, --priority, --mirror, --race-mirrors, --exclude)")
 		}
-
-		if err := database.UpdateSubscription(updateID, urlPtr, remarkPtr, uaPtr, enabledPtr); err != nil {
+		if err := validateImpersonation(updateImperson); err != nil {
+			return err
+		}
+		if _, err := newScrapeOptions(updateSelector, updatePattern); err != nil {
+			return err
+		}
+		exclude, err := resolveExcludeRules(updateExclude)
+		if err != nil {
 			return err
 		}
+
+		if urlPtr != nil || remarkPtr != nil || uaPtr != nil || enabledPtr != nil {
+			if err := database.UpdateSubscription(updateID, urlPtr, remarkPtr, uaPtr, enabledPtr); err != nil {
+				return err
+			}
+		}
+		if authChanged {
+			sub, err := database.GetSubscriptionByID(updateID)
+			if err != nil {
+				return err
+			}
+			current, err := sub.Credentials()
+			if err != nil && !updateAuth.clear {
+				return err
+			}
+			auth, err := updateAuth.apply(cmd, current)
+			if err != nil {
+				return err
+			}
+			if !auth.IsZero() && IsLocalSubscription(sub.URL) {
+				return fmt.Errorf("--header, --basic-auth and --cookie don't apply to local subscriptions")
+			}
+			if err := database.SetSubscriptionAuth(updateID, auth); err != nil {
+				return err
+			}
+		}
+		if scrapeChanged {
+			sub, err := database.GetSubscriptionByID(updateID)
+			if err != nil {
+				return err
+			}
+			selector, pattern := sub.HTMLSelector.String, sub.HTMLPattern.String
+			if cmd.Flags().Changed("html-selector") {
+				selector = updateSelector
+			}
+			if cmd.Flags().Changed("html-pattern") {
+				pattern = updatePattern
+			}
+			if err := database.SetSubscriptionScrape(updateID, selector, pattern); err != nil {
+				return err
+			}
+		}
+		if impersonChanged {
+			if err := database.SetSubscriptionImpersonate(updateID, updateImperson); err != nil {
+				return err
+			}
+		}
+		if priorityChanged {
+			if err := database.SetSubscriptionPriority(updateID, updatePriority); err != nil {
+				return err
+			}
+		}
+		if mirrorsChanged {
+			sub, err := database.GetSubscriptionByID(updateID)
+			if err != nil {
+				return err
+			}
+			mirrors, race := sub.MirrorURLs(), sub.RaceMirrors
+			if cmd.Flags().Changed("mirror") {
+				if mirrors, err = resolveMirrors(sub.URL, updateMirrors); err != nil {
+					return err
+				}
+			}
+			if cmd.Flags().Changed("race-mirrors") {
+				race = updateRace
+			}
+			if race && len(mirrors) == 0 {
+				return fmt.Errorf("--race-mirrors needs at least one mirror")
+			}
+			if err := database.SetSubscriptionMirrors(updateID, mirrors, race); err != nil {
+				return err
+			}
+		}
+		if excludeChanged {
+			if err := database.SetSubscriptionExcludeRules(updateID, exclude); err != nil {
+				return err
+			}
+		}
 		customlog.Printf(customlog.Success, "Successfully updated subscription ID %d.\n", updateID)
 		return nil
 	},
@@ -71,9 +197,17 @@ Examples:
 
 func init() {
 	UpdateCmd.Flags().Int64Var(&updateID, "id", 0, "ID of the subscription to update (required)")
-	UpdateCmd.Flags().StringVarP(&updateURL, "url", "u", "", "New URL for the subscription")
+	UpdateCmd.Flags().StringVarP(&updateURL, "url", "u", "", "New URL for the subscription, or a local file path")
 	UpdateCmd.Flags().StringVarP(&updateRemark, "remark", "r", "", "New remark (pass empty string to clear)")
-	UpdateCmd.Flags().StringVarP(&updateUserAgent, "user-agent", "a", "", "New User-Agent (pass empty string to clear)")
+	UpdateCmd.Flags().StringVarP(&updateUserAgent, "user-agent", "a", "", "New User-Agent or client preset ("+userAgentPresetNames()+"), pass empty string to clear")
 	UpdateCmd.Flags().StringVar(&updateEnabled, "enabled", "", "Enable or disable the subscription (true/false)")
+	updateAuth.register(UpdateCmd, true)
+	UpdateCmd.Flags().StringVar(&updateSelector, "html-selector", "", "New CSS selector for HTML pages (pass empty string to clear)")
+	UpdateCmd.Flags().StringVar(&updatePattern, "html-pattern", "", "New link regex (pass empty string to clear)")
+	UpdateCmd.Flags().StringVar(&updateImperson, "impersonate", "", "New TLS fingerprint: "+strings.Join(ImpersonationNames, ", ")+" (pass empty string for the default)")
+	UpdateCmd.Flags().IntVar(&updatePriority, "priority", 0, "New priority; higher subscriptions come first and win shared configs")
+	UpdateCmd.Flags().StringArrayVar(&updateMirrors, "mirror", nil, "New mirror URLs, replacing the stored ones (repeatable, pass empty string to clear)")
+	UpdateCmd.Flags().BoolVar(&updateRace, "race-mirrors", false, "Race the URL and its mirrors instead of trying them in order")
+	UpdateCmd.Flags().StringArrayVar(&updateExclude, "exclude", nil, "New exclusion rules, replacing the stored ones (repeatable, pass empty string to clear)")
 	UpdateCmd.MarkFlagRequired("id")
 }
@@ -0,0 +1,77 @@
+package subs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/imroc/req/v3"
+)
+
+// userAgentPresets are the User-Agents of popular clients. Panels pick the
+// format of a subscription (clash YAML, sing-box JSON, base64 links) by the
+// client they see in the User-Agent, so fetching as the right client matters.
+var userAgentPresets = map[string]string{
+	"clash":        "clash-verge/v1.7.7",
+	"clash-meta":   "ClashMetaForAndroid/2.11.1.Meta",
+	"v2rayng":      "v2rayNG/1.9.16",
+	"v2rayn":       "v2rayN/7.0.0",
+	"shadowrocket": "Shadowrocket/2070 CFNetwork/1496.0.7 Darwin/23.5.0",
+	"sing-box":     "sing-box 1.10.1",
+	"hiddify":      "HiddifyNext/2.5.7 (android) like ClashMeta v2ray sing-box",
+	"streisand":    "Streisand/1.6.30",
+}
+
+// ImpersonationNames are the TLS and HTTP/2 fingerprints a subscription can be
+// fetched with; "none" is Go's own stack.
+var ImpersonationNames = []string{"chrome", "firefox", "safari", "none"}
+
+// DefaultImpersonation is the fingerprint used when none is chosen.
+const DefaultImpersonation = "chrome"
+
+// resolveUserAgent expands a preset name to its User-Agent; anything else is
+// used verbatim.
+func resolveUserAgent(ua string) string {
+	if preset, ok := userAgentPresets[strings.ToLower(strings.TrimSpace(ua))]; ok {
+		return preset
+	}
+	return ua
+}
+
+// userAgentPresetNames lists the presets, for help texts.
+func userAgentPresetNames() string {
+	names := make([]string, 0, len(userAgentPresets))
+	for name := range userAgentPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// validateImpersonation checks an --impersonate value; "" keeps the default.
+func validateImpersonation(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, n := range ImpersonationNames {
+		if name == n {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --impersonate %q (supported: %s)", name, strings.Join(ImpersonationNames, ", "))
+}
+
+// newFetchClient returns a client that fingerprints like the named browser.
+func newFetchClient(impersonate string) *req.Client {
+	client := req.C()
+	switch impersonate {
+	case "firefox":
+		client.ImpersonateFirefox()
+	case "safari":
+		client.ImpersonateSafari()
+	case "none":
+	default:
+		client.ImpersonateChrome()
+	}
+	return client
+}
@@ -0,0 +1,52 @@
+package subs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveUserAgent(t *testing.T) {
+	for in, want := range map[string]string{
+		"v2rayng":      userAgentPresets["v2rayng"],
+		" Clash ":      userAgentPresets["clash"],
+		"curl/8.0":     "curl/8.0",
+		"":             "",
+		"shadowrocket": userAgentPresets["shadowrocket"],
+	} {
+		if got := resolveUserAgent(in); got != want {
+			t.Errorf("resolveUserAgent(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateImpersonation(t *testing.T) {
+	for _, name := range append([]string{""}, ImpersonationNames...) {
+		if err := validateImpersonation(name); err != nil {
+			t.Errorf("validateImpersonation(%q) = %v", name, err)
+		}
+	}
+	if err := validateImpersonation("edge"); err == nil {
+		t.Error("validateImpersonation(\"edge\") = nil, want error")
+	}
+}
+
+func TestFetchAll_UserAgentPreset(t *testing.T) {
+	for _, imp := range ImpersonationNames {
+		var got string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("User-Agent")
+			fmt.Fprint(w, "vless://a@example.com:443")
+		}))
+		sub := &Subscription{Url: srv.URL, UserAgent: "shadowrocket", Impersonate: imp}
+		links, err := sub.FetchAll()
+		srv.Close()
+		if err != nil || len(links) != 1 {
+			t.Fatalf("impersonate %s: FetchAll() = %v, %v", imp, links, err)
+		}
+		if got != userAgentPresets["shadowrocket"] {
+			t.Errorf("impersonate %s: User-Agent = %q, want the shadowrocket preset", imp, got)
+		}
+	}
+}
@@ -88,12 +88,11 @@ func newWebUICommand() *cobra.Command {
 for all of xray-knife's core functionalities, including proxy management,
 configuration testing, and scanning.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Find home directory to locate the config file
-			home, err := os.UserHomeDir()
+			// The config file lives in the profile's data directory
+			configDir, err := utils.DataDir()
 			if err != nil {
-				return fmt.Errorf("could not find user home directory: %w", err)
+				return err
 			}
-			configDir := filepath.Join(home, ".xray-knife")
 			configFilePath := filepath.Join(configDir, webuiConfigFilename)
 
 			// Determine final credentials based on priority: flags > env > file > generate
@@ -189,7 +188,7 @@ configuration testing, and scanning.`,
 				return fmt.Errorf("could not create web server: %w", err)
 			}
 
-			return server.Run()
+			return server.Run(cmd.Context())
 		},
 	}
 
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// aliasPattern is what a config alias may look like. All-digit aliases are
+// rejected separately, as they would read as config IDs.
+var aliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// ValidateAlias checks a user-chosen config alias.
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias %q: use up to 32 lowercase letters, digits, '.', '_' and '-'", alias)
+	}
+	if _, err := strconv.ParseInt(alias, 10, 64); err == nil {
+		return fmt.Errorf("invalid alias %q: it would be mistaken for a config ID", alias)
+	}
+	return nil
+}
+
+// aliasPrefix names the configs an alias is counted among: the country of a
+// remark starting with a flag emoji ("de" for "🇩🇪 Frankfurt"), else the
+// protocol, else "cfg".
+func aliasPrefix(protocol, remark sql.NullString) string {
+	runes := []rune(strings.TrimSpace(remark.String))
+	isFlagLetter := func(r rune) bool { return r >= 0x1F1E6 && r <= 0x1F1FF }
+	if len(runes) >= 2 && isFlagLetter(runes[0]) && isFlagLetter(runes[1]) {
+		return string([]rune{'a' + runes[0] - 0x1F1E6, 'a' + runes[1] - 0x1F1E6})
+	}
+	prefix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(protocol.String))
+	if prefix == "" {
+		return "cfg"
+	}
+	return prefix
+}
+
+// assignAliasesTx gives every config without an alias the next free one of its
+// prefix, such as "de-3" or "vless-12". Counters only grow, so an alias is
+// never handed out twice, even after its config was deleted.
+func assignAliasesTx(tx *sqlx.Tx) error {
+	ctx := context.Background()
+	var configs []struct {
+		ID       int64          `db:"id"`
+		Protocol sql.NullString `db:"protocol"`
+		Remark   sql.NullString `db:"remark"`
+	}
+	if err := tx.SelectContext(ctx, &configs, `SELECT id, protocol, remark FROM subscription_configs WHERE alias IS NULL ORDER BY id`); err != nil {
+		return fmt.Errorf("failed to list configs without alias: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+
+	next := make(map[string]int64)
+	for _, c := range configs {
+		prefix := aliasPrefix(c.Protocol, c.Remark)
+		n, ok := next[prefix]
+		if !ok {
+			err := tx.GetContext(ctx, &n, `SELECT next FROM alias_counters WHERE prefix = ?`, prefix)
+			if errors.Is(err, sql.ErrNoRows) {
+				n = 1
+			} else if err != nil {
+				return fmt.Errorf("failed to read alias counter %s: %w", prefix, err)
+			}
+		}
+		for {
+			// Skip aliases the user picked by hand.
+			alias := prefix + "-" + strconv.FormatInt(n, 10)
+			n++
+			res, err := tx.ExecContext(ctx, `UPDATE subscription_configs SET alias = ?
+				WHERE id = ? AND NOT EXISTS (SELECT 1 FROM subscription_configs WHERE alias = ?)`, alias, c.ID, alias)
+			if err != nil {
+				return fmt.Errorf("failed to set alias of config %d: %w", c.ID, err)
+			}
+			if changed, _ := res.RowsAffected(); changed > 0 {
+				break
+			}
+		}
+		next[prefix] = n
+	}
+
+	for prefix, n := range next {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO alias_counters (prefix, next) VALUES (?, ?)
+			ON CONFLICT(prefix) DO UPDATE SET next = excluded.next`, prefix, n); err != nil {
+			return fmt.Errorf("failed to save alias counter %s: %w", prefix, err)
+		}
+	}
+	return nil
+}
+
+// AssignMissingAliases gives an alias to every stored config still without one.
+func AssignMissingAliases() error {
+	tx, err := DB.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := assignAliasesTx(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetConfigAlias replaces the alias of a config.
+func SetConfigAlias(id int64, alias string) error {
+	if err := ValidateAlias(alias); err != nil {
+		return err
+	}
+	var owner int64
+	err := DB.GetContext(context.Background(), &owner, `SELECT id FROM subscription_configs WHERE alias = ?`, alias)
+	if err == nil && owner != id {
+		return fmt.Errorf("alias %q is already used by config %d", alias, owner)
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to look up alias %q: %w", alias, err)
+	}
+
+	res, err := DB.ExecContext(context.Background(), `UPDATE subscription_configs SET alias = ? WHERE id = ?`, alias, id)
+	if err != nil {
+		return fmt.Errorf("failed to set alias of config %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no config found with id %d", id)
+	}
+	return nil
+}
+
+// GetConfigByRef returns the stored config with the given ID or alias.
+func GetConfigByRef(ref string) (*SubscriptionConfig, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return GetSubscriptionConfig(id)
+	}
+	var config SubscriptionConfig
+	err := DB.GetContext(context.Background(), &config, selectSubscriptionConfigs+` WHERE alias = ?`, strings.ToLower(ref))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notFound("no config found with alias %q", ref)
+		}
+		return nil, fmt.Errorf("could not get config %q: %w", ref, err)
+	}
+	return &config, nil
+}
+
+// ResolveConfigLink returns ref when it is a config link, otherwise the link of
+// the stored config with that ID or alias.
+func ResolveConfigLink(ref string) (string, error) {
+	if ref == "" || strings.Contains(ref, "://") {
+		return ref, nil
+	}
+	config, err := GetConfigByRef(ref)
+	if err != nil {
+		return "", err
+	}
+	return config.ConfigLink, nil
+}
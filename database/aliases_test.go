@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigAliases(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	row := func(link, protocol, remark string) SubscriptionConfig {
+		return SubscriptionConfig{
+			ConfigLink: link,
+			LastSeenAt: now,
+			Protocol:   sql.NullString{String: protocol, Valid: protocol != ""},
+			Remark:     sql.NullString{String: remark, Valid: remark != ""},
+		}
+	}
+	alias := func(link string) string {
+		t.Helper()
+		var a sql.NullString
+		if err := DB.Get(&a, `SELECT alias FROM subscription_configs WHERE config_link = ?`, link); err != nil {
+			t.Fatal(err)
+		}
+		return a.String
+	}
+
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{
+		row("vless://a", "vless", "🇩🇪 Frankfurt"),
+		row("vless://b", "vless", "🇩🇪 Berlin"),
+		row("trojan://c", "trojan", "plain"),
+		row("weird://d", "", ""),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for link, want := range map[string]string{"vless://a": "de-1", "vless://b": "de-2", "trojan://c": "trojan-1", "weird://d": "cfg-1"} {
+		if got := alias(link); got != want {
+			t.Errorf("alias of %s = %q, want %q", link, got, want)
+		}
+	}
+
+	// A deleted config's alias is not handed out again, and hand-picked ones are skipped.
+	if _, err := DB.Exec(`DELETE FROM subscription_configs WHERE config_link = 'vless://b'`); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetConfigByRef("trojan-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfigAlias(c.ID, "de-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{row("vless://e", "vless", "🇩🇪 Munich")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := alias("vless://e"); got != "de-4" {
+		t.Errorf("alias of new config = %q, want de-4", got)
+	}
+
+	if err := SetConfigAlias(c.ID, "de-1"); err == nil {
+		t.Error("SetConfigAlias took an alias used by another config")
+	}
+	for _, bad := range []string{"42", "De 1", ""} {
+		if err := SetConfigAlias(c.ID, bad); err == nil {
+			t.Errorf("SetConfigAlias accepted %q", bad)
+		}
+	}
+
+	if link, err := ResolveConfigLink("DE-1"); err != nil || link != "vless://a" {
+		t.Errorf("ResolveConfigLink(DE-1) = %q, %v", link, err)
+	}
+	if link, err := ResolveConfigLink(c.ConfigLink); err != nil || link != c.ConfigLink {
+		t.Errorf("ResolveConfigLink(%s) = %q, %v; want the link itself", c.ConfigLink, link, err)
+	}
+	if got, err := GetConfigByRef("1"); err != nil || got.ConfigLink != "vless://a" {
+		t.Errorf("GetConfigByRef(1) = %+v, %v", got, err)
+	}
+	if _, err := ResolveConfigLink("nl-9"); err == nil {
+		t.Error("ResolveConfigLink found an unknown alias")
+	}
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConfigBatchWriter funnels config upserts from many concurrent fetchers into a single
+// writer, committing them in transactions of BatchSize rows. This avoids lock contention
+// between workers and the per-statement fsync cost of autocommit on slow disks.
+// When a batch fails, the rows of each subscription are retried in a transaction of
+// their own, so one bad row only fails its own subscription; rows that still fail are
+// dropped and the failure is reported for their subscription (see Failed).
+// It is safe for concurrent use.
+type ConfigBatchWriter struct {
+	mu        sync.Mutex
+	batchSize int
+	pending   []SubscriptionConfig
+	groups    []ConfigGroup
+	fetched   map[int64]time.Time
+	skipped   map[int64]int
+	written   int
+	failed    map[int64]error // by subscription ID, 0 for configs without one
+	reported  map[int64]bool  // failures already returned by Add
+}
+
+// NewConfigBatchWriter returns a writer that commits every batchSize configs.
+func NewConfigBatchWriter(batchSize int) *ConfigBatchWriter {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &ConfigBatchWriter{
+		batchSize: batchSize,
+		fetched:   make(map[int64]time.Time),
+		skipped:   make(map[int64]int),
+		failed:    make(map[int64]error),
+		reported:  make(map[int64]bool),
+	}
+}
+
+// Add queues configs and commits once a full batch is pending. It returns the error
+// of a subscription of configs whose rows could not be saved, so its fetch can stop;
+// the failures of other subscriptions are left to Failed.
+func (w *ConfigBatchWriter) Add(configs []SubscriptionConfig) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, configs...)
+	if len(w.pending) >= w.batchSize {
+		w.flushLocked()
+	}
+	for _, c := range configs {
+		id := c.SubscriptionID.Int64
+		if err, ok := w.failed[id]; ok {
+			w.reported[id] = true
+			return err
+		}
+	}
+	return nil
+}
+
+// AddGroups queues composite link groups, committed with the next batch. The
+// members of a group must have been added before it.
+func (w *ConfigBatchWriter) AddGroups(groups []ConfigGroup) {
+	w.mu.Lock()
+	w.groups = append(w.groups, groups...)
+	w.mu.Unlock()
+}
+
+// MarkFetched queues a last_fetched_at update (which also resets the failure streak),
+// committed with the next batch unless the rows of the subscription failed.
+func (w *ConfigBatchWriter) MarkFetched(subID int64, fetchTime time.Time) {
+	w.mu.Lock()
+	w.fetched[subID] = fetchTime
+	w.mu.Unlock()
+}
+
+// MarkSkipped queues an update of the number of links a fetch of the subscription
+// left out, committed with the next batch.
+func (w *ConfigBatchWriter) MarkSkipped(subID int64, skipped int) {
+	w.mu.Lock()
+	w.skipped[subID] = skipped
+	w.mu.Unlock()
+}
+
+// Flush commits everything still pending. Subscriptions whose rows could not be
+// saved are reported by Failed; the error is only about the ones Add hasn't returned.
+func (w *ConfigBatchWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushLocked()
+	var errs []error
+	for id, err := range w.failed {
+		if !w.reported[id] {
+			errs = append(errs, fmt.Errorf("subscription %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Failed returns the subscriptions whose rows could not be saved and why, keyed
+// by subscription ID (0 for configs without a subscription), leaving out the
+// failures Add already returned.
+func (w *ConfigBatchWriter) Failed() map[int64]error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	failed := make(map[int64]error)
+	for id, err := range w.failed {
+		if !w.reported[id] {
+			failed[id] = err
+		}
+	}
+	return failed
+}
+
+// Written returns how many configs have been committed so far.
+func (w *ConfigBatchWriter) Written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// flushLocked commits the pending rows in one transaction, or subscription by
+// subscription when that fails. Either way nothing stays queued.
+func (w *ConfigBatchWriter) flushLocked() {
+	if len(w.pending) == 0 && len(w.groups) == 0 && len(w.fetched) == 0 && len(w.skipped) == 0 {
+		return
+	}
+	defer func() {
+		w.pending = w.pending[:0]
+		w.groups = w.groups[:0]
+		clear(w.fetched)
+		clear(w.skipped)
+	}()
+
+	if err := w.commit(w.pending, w.groups, w.fetched, w.skipped); err == nil {
+		w.written += len(w.pending)
+		return
+	}
+
+	// Retry each subscription on its own to find the ones that fail.
+	configs := make(map[int64][]SubscriptionConfig)
+	groups := make(map[int64][]ConfigGroup)
+	ids := make(map[int64]bool)
+	for _, c := range w.pending {
+		configs[c.SubscriptionID.Int64] = append(configs[c.SubscriptionID.Int64], c)
+		ids[c.SubscriptionID.Int64] = true
+	}
+	for _, g := range w.groups {
+		groups[g.SubscriptionID.Int64] = append(groups[g.SubscriptionID.Int64], g)
+		ids[g.SubscriptionID.Int64] = true
+	}
+	for id := range w.fetched {
+		ids[id] = true
+	}
+	for id := range w.skipped {
+		ids[id] = true
+	}
+	for id := range ids {
+		fetched, skipped := map[int64]time.Time{}, map[int64]int{}
+		if t, ok := w.fetched[id]; ok {
+			fetched[id] = t
+		}
+		if n, ok := w.skipped[id]; ok {
+			skipped[id] = n
+		}
+		if err := w.commit(configs[id], groups[id], fetched, skipped); err != nil {
+			if _, ok := w.failed[id]; !ok {
+				w.failed[id] = err
+			}
+			continue
+		}
+		w.written += len(configs[id])
+	}
+}
+
+// commit saves configs, groups and subscription updates in one transaction. The
+// fetch time of a subscription whose rows failed earlier is left alone, so its
+// failure streak isn't reset.
+func (w *ConfigBatchWriter) commit(configs []SubscriptionConfig, groups []ConfigGroup, fetched map[int64]time.Time, skipped map[int64]int) error {
+	tx, err := DB.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(configs) > 0 {
+		if err := upsertSubscriptionConfigsTx(tx, configs); err != nil {
+			return err
+		}
+		if err := assignAliasesTx(tx); err != nil {
+			return err
+		}
+	}
+	if len(groups) > 0 {
+		if err := upsertConfigGroupsTx(tx, groups); err != nil {
+			return err
+		}
+	}
+	for id, t := range fetched {
+		if _, failed := w.failed[id]; failed {
+			continue
+		}
+		if _, err := tx.ExecContext(context.Background(), markFetchedQuery, t, id); err != nil {
+			return fmt.Errorf("could not update last fetched time for subscription %d: %w", id, err)
+		}
+	}
+	for id, n := range skipped {
+		if _, err := tx.ExecContext(context.Background(), `UPDATE subscriptions SET skipped_configs = ? WHERE id = ?`, n, id); err != nil {
+			return fmt.Errorf("could not update skipped configs for subscription %d: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit batch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigBatchWriterFailingBatch(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://good.example/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	good, err := GetSubscriptionByURL("https://good.example/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gone = 999 // deleted while its fetch was running
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	row := func(sub int64, link string) SubscriptionConfig {
+		return SubscriptionConfig{SubscriptionID: sql.NullInt64{Int64: sub, Valid: true}, ConfigLink: link, LastSeenAt: now}
+	}
+
+	w := NewConfigBatchWriter(2)
+	// The batch is flushed by the good subscription's Add, which must not fail.
+	if err := w.Add([]SubscriptionConfig{row(gone, "vless://x@1.1.1.1:443")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add([]SubscriptionConfig{row(good.ID, "vless://x@2.2.2.2:443")}); err != nil {
+		t.Fatalf("Add of the good subscription failed for the bad one: %v", err)
+	}
+	if got := w.Written(); got != 1 {
+		t.Errorf("Written() = %d, want the good row only", got)
+	}
+	// The bad row is dropped rather than retried with every later batch.
+	w.MarkFetched(good.ID, time.Now())
+	if err := w.Add([]SubscriptionConfig{row(good.ID, "vless://x@3.3.3.3:443"), row(good.ID, "vless://x@4.4.4.4:443")}); err != nil {
+		t.Fatalf("later batch: %v", err)
+	}
+	if got := w.Written(); got != 3 {
+		t.Errorf("Written() = %d after a later batch, want 3", got)
+	}
+	if err := w.Add([]SubscriptionConfig{row(gone, "vless://x@5.5.5.5:443")}); err == nil {
+		t.Error("Add of the failed subscription returned no error")
+	}
+
+	failed := w.Failed()
+	if len(failed) != 0 {
+		t.Errorf("Failed() = %v, want the failure already returned by Add left out", failed)
+	}
+	if err := w.Flush(); err != nil {
+		t.Errorf("Flush() = %v, want nil with every failure reported", err)
+	}
+	sub, err := GetSubscriptionByID(good.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sub.LastFetchedAt.Valid {
+		t.Error("fetch time of the good subscription not saved")
+	}
+	var n int
+	if err := DB.Get(&n, `SELECT COUNT(*) FROM subscription_configs`); err != nil || n != 3 {
+		t.Errorf("stored configs = %d, %v; want 3", n, err)
+	}
+}
+
+func TestConfigBatchWriterFlushReportsFailures(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	w := NewConfigBatchWriter(100)
+	bad := SubscriptionConfig{SubscriptionID: sql.NullInt64{Int64: 7, Valid: true}, ConfigLink: "vless://x@1.1.1.1:443"}
+	if err := w.Add([]SubscriptionConfig{bad}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err == nil {
+		t.Fatal("Flush() succeeded with a row of a missing subscription")
+	}
+	if failed := w.Failed(); len(failed) != 1 || failed[7] == nil {
+		t.Errorf("Failed() = %v, want subscription 7", failed)
+	}
+	if w.Written() != 0 {
+		t.Errorf("Written() = %d, want 0", w.Written())
+	}
+}
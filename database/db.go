@@ -6,6 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite"
@@ -20,32 +25,138 @@ var migrationsFS embed.FS
 // DB is the global connection pool for the application. It is initialized by InitDB.
 var DB *sqlx.DB
 
+// busyTimeout is how long a connection waits for another connection, possibly
+// in another xray-knife process, to release its lock before failing.
+const busyTimeout = 5 * time.Second
+
 // InitDB opens the SQLite connection, runs migrations, and sets the global DB.
 func InitDB(dbPath string) error {
 	// The `_pragma` params enable:
 	// - foreign_keys: enforce data integrity
-	// - busy_timeout: wait up to 5s instead of failing immediately on lock contention
+	// - busy_timeout: wait instead of failing immediately on lock contention
 	// - journal_mode=WAL: allow concurrent reads during writes
-	db, err := sqlx.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	// - synchronous=NORMAL: fsync only at checkpoints, which is safe in WAL mode and
+	//   much faster for bulk writes on slow disks
+	// _txlock=immediate takes the write lock when a transaction begins. A deferred
+	// transaction upgrades its read lock on the first write instead, which fails
+	// with SQLITE_BUSY at once, ignoring busy_timeout, when another process wrote
+	// in between.
+	db, err := open(fmt.Sprintf("%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		dbPath, busyTimeout.Milliseconds()))
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
-
-	if err = db.Ping(); err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return err
 	}
 
 	DB = db
+	setSecretKeyPath(dbPath)
 	//log.Println("Database connection established.")
 
-	// Run database migrations
+	// Run database migrations. Processes starting together (a daemon and a CLI
+	// query, say) take turns so a migration is never applied twice.
+	unlock, err := lockMigrations(dbPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if err := runMigrations(db.DB); err != nil {
 		return fmt.Errorf("database migration failed: %w", err)
 	}
+	// Configs stored before dedup keys existed get theirs now, duplicates among
+	// them merged, and those stored before aliases existed get an alias.
+	if err := BackfillDedupKeys(); err != nil {
+		return err
+	}
+	if err := AssignMissingAliases(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// InitDBReadOnly opens an existing database for reading only and sets the global
+// DB. It doesn't run migrations, so the database must already be up to date;
+// writes fail with an error. Use it for processes that only query the database
+// while another one, such as a running proxy or web UI, writes to it.
+func InitDBReadOnly(dbPath string) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot open database read-only: %w", err)
+	}
+	// mode=ro needs the file: URI form.
+	db, err := open(fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(%d)&_pragma=query_only(1)",
+		filepath.ToSlash(dbPath), busyTimeout.Milliseconds()))
+	if err != nil {
+		return err
+	}
+
+	var version uint
+	var dirty bool
+	if err := db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty); err != nil {
+		db.Close()
+		return fmt.Errorf("could not get db version: %w", err)
+	}
+	latest, err := latestMigration()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if dirty || version != latest {
+		db.Close()
+		return fmt.Errorf("database schema is at version %d but this build needs %d; run once without --readonly to migrate it", version, latest)
+	}
+
+	DB = db
+	setSecretKeyPath(dbPath)
+	return nil
+}
+
+// open opens and pings a connection pool for dsn.
+func open(dsn string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// lockMigrations takes an exclusive lock on a file next to the database and
+// returns the function releasing it.
+func lockMigrations(dbPath string) (func(), error) {
+	f, err := os.OpenFile(dbPath+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migration lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock database for migrations: %w", err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// latestMigration returns the version of the newest embedded migration.
+func latestMigration() (uint, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	var latest uint
+	for _, e := range entries {
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		latest = max(latest, uint(v))
+	}
+	return latest, nil
+}
+
 // runMigrations applies all pending database migrations.
 func runMigrations(db *sql.DB) error {
 	sourceDriver, err := iofs.New(migrationsFS, "migrations")
@@ -0,0 +1,658 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+func TestReadOnlyWhileWriting(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	if err := InitDBReadOnly(dbPath); err == nil {
+		t.Fatal("read-only open of a missing database succeeded")
+	}
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	writer := DB
+	defer writer.Close()
+	if err := AddSubscription("https://example.com/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitDBReadOnly(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	reader := DB
+	defer reader.Close()
+	if _, err := GetSubscriptionByURL("https://example.com/sub"); err != nil {
+		t.Errorf("read-only query: %v", err)
+	}
+	if err := AddSubscription("https://example.com/other", "", ""); err == nil {
+		t.Error("write through a read-only database succeeded")
+	}
+
+	// Writers in other connections queue up on the lock instead of failing.
+	DB = writer
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- AddSubscription(fmt.Sprintf("https://example.com/%d", i), "", "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent write: %v", err)
+		}
+	}
+}
+
+func TestInitDBConcurrent(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	// Each open gets its own pool, like separate processes starting at once.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := lockMigrations(dbPath)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer unlock()
+			db, err := open(dbPath + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+			errs <- runMigrations(db.DB)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRecordResolvedURL(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://short.example/x", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://short.example/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sub.ID
+	for _, step := range []struct{ resolved, previous string }{
+		{"https://panel.example.com/sub", ""},
+		{"https://other.example.net/sub", "https://panel.example.com/sub"},
+	} {
+		previous, err := RecordResolvedURL(id, step.resolved)
+		if err != nil || previous != step.previous {
+			t.Errorf("RecordResolvedURL(%s) = %q, %v; want %q", step.resolved, previous, err, step.previous)
+		}
+	}
+
+	// A new URL forgets where the old one led.
+	newURL := "https://short.example/y"
+	if err := UpdateSubscription(id, &newURL, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err := RecordResolvedURL(id, "https://panel.example.com/sub"); err != nil || previous != "" {
+		t.Errorf("after a URL change RecordResolvedURL = %q, %v; want no previous", previous, err)
+	}
+}
+
+func TestGetLatestCertResult(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	const link = "trojan://secret@vpn.example.com:443#de"
+	if cert, err := GetLatestCertResult(link); err != nil || cert != nil {
+		t.Fatalf("GetLatestCertResult() = %v, %v before any test; want nil", cert, err)
+	}
+	for _, r := range []HttpTestResult{
+		{ConfigLink: link, Status: "passed", CertIssuer: "R11", CertExpires: "2026-01-01"},
+		{ConfigLink: link, Status: "failed", CertIssuer: "R11", CertExpires: "2026-03-01", CertWarnings: "expiring"},
+		{ConfigLink: link, Status: "passed"}, // tested without --cert
+	} {
+		runID, err := CreateHttpTestRun("{}", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := InsertHttpTestResultsBatch(runID, []HttpTestResult{r}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := GetLatestCertResult(link)
+	if err != nil || cert == nil {
+		t.Fatalf("GetLatestCertResult() = %v, %v", cert, err)
+	}
+	if cert.CertExpires != "2026-03-01" || cert.CertWarnings != "expiring" {
+		t.Errorf("got the certificate expiring %s (%s), want the latest inspected one", cert.CertExpires, cert.CertWarnings)
+	}
+}
+
+func TestHttpTestResultFailure(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	runID, err := CreateHttpTestRun("{}", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = InsertHttpTestResultsBatch(runID, []HttpTestResult{
+		{ConfigLink: "vless://a@1.2.3.4:443", Status: "failed", DelayMs: -1, Failure: "blocked", BlockSignal: "rst"},
+		{ConfigLink: "vless://b@5.6.7.8:443", Status: "failed", DelayMs: -1, Failure: "down"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := GetHttpTestResults(runID)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("GetHttpTestResults() = %v, %v", results, err)
+	}
+	got := map[string]string{}
+	for _, r := range results {
+		got[r.ConfigLink] = r.Failure + "/" + r.BlockSignal
+	}
+	if got["vless://a@1.2.3.4:443"] != "blocked/rst" || got["vless://b@5.6.7.8:443"] != "down/" {
+		t.Errorf("stored failures = %v, want blocked/rst and down/", got)
+	}
+}
+
+func TestHttpTestResultMutation(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	runID, err := CreateHttpTestRun("{}", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const link = "vless://a@1.2.3.4:443?security=tls&fp=chrome"
+	err = InsertHttpTestResultsBatch(runID, []HttpTestResult{
+		{ConfigLink: link, Status: "passed", DelayMs: 300, Mutation: "fp=firefox", MutatedLink: "vless://a@1.2.3.4:443?security=tls&fp=firefox"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := GetHttpTestResults(runID)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("GetHttpTestResults() = %v, %v", results, err)
+	}
+	if r := results[0]; r.Mutation != "fp=firefox" || r.MutatedLink != "vless://a@1.2.3.4:443?security=tls&fp=firefox" {
+		t.Errorf("stored mutation = %q %q, want the variant that passed", r.Mutation, r.MutatedLink)
+	}
+}
+
+func TestSubscriptionPriority(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	var ids []int64
+	for _, u := range []string{"https://a.example/sub", "https://b.example/sub"} {
+		if err := AddSubscription(u, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		sub, err := GetSubscriptionByURL(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, sub.ID)
+	}
+	// Both subscriptions carry the same server under their own remark.
+	config := func(sub int64, link string) SubscriptionConfig {
+		return SubscriptionConfig{
+			SubscriptionID: sql.NullInt64{Int64: sub, Valid: true},
+			ConfigLink:     link,
+			DedupKey:       sql.NullString{String: "vless|1.2.3.4|443", Valid: true},
+			LastSeenAt:     sql.NullTime{Time: time.Now(), Valid: true},
+		}
+	}
+	owner := func() (int64, string) {
+		var c SubscriptionConfig
+		if err := DB.Get(&c, `SELECT subscription_id, config_link FROM subscription_configs`); err != nil {
+			t.Fatal(err)
+		}
+		return c.SubscriptionID.Int64, c.ConfigLink
+	}
+
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{config(ids[0], "vless://x@1.2.3.4:443#a")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{config(ids[1], "vless://x@1.2.3.4:443#b")}); err != nil {
+		t.Fatal(err)
+	}
+	if sub, link := owner(); sub != ids[0] || link != "vless://x@1.2.3.4:443#a" {
+		t.Errorf("equal priorities: owner = %d %s, want the first source", sub, link)
+	}
+
+	// Raising the priority hands the config over right away.
+	if err := SetSubscriptionPriority(ids[1], 5); err != nil {
+		t.Fatal(err)
+	}
+	if sub, _ := owner(); sub != ids[1] {
+		t.Errorf("after SetSubscriptionPriority owner = %d, want %d", sub, ids[1])
+	}
+	// The next fetch of the higher-priority source brings its link in.
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{config(ids[1], "vless://x@1.2.3.4:443#b")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{config(ids[0], "vless://x@1.2.3.4:443#a")}); err != nil {
+		t.Fatal(err)
+	}
+	if sub, link := owner(); sub != ids[1] || link != "vless://x@1.2.3.4:443#b" {
+		t.Errorf("owner = %d %s, want %d with its link", sub, link, ids[1])
+	}
+	if p, err := GetConfigPriorities(); err != nil || p["vless://x@1.2.3.4:443#b"] != 5 {
+		t.Errorf("GetConfigPriorities() = %v, %v", p, err)
+	}
+
+	// Exports put the prioritized config ahead of faster ones.
+	runID, err := CreateHttpTestRun("{}", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = InsertHttpTestResultsBatch(runID, []HttpTestResult{
+		{ConfigLink: "vless://fast@5.6.7.8:443", Status: "passed", DelayMs: 50},
+		{ConfigLink: "vless://x@1.2.3.4:443#b", Status: "passed", DelayMs: 500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := GetPassedHttpTestResults(runID, 0)
+	if err != nil || len(results) != 2 || results[0].ConfigLink != "vless://x@1.2.3.4:443#b" {
+		t.Errorf("GetPassedHttpTestResults() = %v, %v", results, err)
+	}
+}
+
+func TestSubscriptionMirrors(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://example.com/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrors := []string{"https://mirror.example.net/sub", "https://cdn.example.org/sub"}
+	if err := SetSubscriptionMirrors(sub.ID, mirrors, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordFetchedFrom(sub.ID, mirrors[1]); err != nil {
+		t.Fatal(err)
+	}
+	sub, err = GetSubscriptionByID(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sub.MirrorURLs(); len(got) != 2 || got[0] != mirrors[0] || got[1] != mirrors[1] || !sub.RaceMirrors {
+		t.Errorf("mirrors = %v (race %v), want %v raced", got, sub.RaceMirrors, mirrors)
+	}
+	if sub.FetchedFrom.String != mirrors[1] {
+		t.Errorf("FetchedFrom = %q, want %s", sub.FetchedFrom.String, mirrors[1])
+	}
+
+	if err := SetSubscriptionMirrors(sub.ID, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	sub, err = GetSubscriptionByID(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.MirrorURLs()) != 0 || sub.FetchedFrom.Valid {
+		t.Errorf("after clearing, mirrors = %v and fetched from %q, want none", sub.MirrorURLs(), sub.FetchedFrom.String)
+	}
+}
+
+func TestSubscriptionExcludeRules(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://example.com/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []string{"remark~剩余|到期", "port!=443"}
+	if err := SetSubscriptionExcludeRules(sub.ID, rules); err != nil {
+		t.Fatal(err)
+	}
+	if sub, err = GetSubscriptionByID(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := sub.ExcludeRuleList(); len(got) != 2 || got[0] != rules[0] || got[1] != rules[1] {
+		t.Errorf("ExcludeRuleList = %v, want %v", got, rules)
+	}
+
+	if err := SetSubscriptionExcludeRules(sub.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sub, err = GetSubscriptionByID(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := sub.ExcludeRuleList(); got != nil || sub.ExcludeRules.Valid {
+		t.Errorf("after clearing, ExcludeRuleList = %v", got)
+	}
+	if err := SetSubscriptionExcludeRules(sub.ID+1, rules); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetSubscriptionExcludeRules(unknown) err = %v", err)
+	}
+}
+
+func TestConfigSourcesAndDeleteSubscription(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	var ids []int64
+	for _, u := range []string{"https://a.example/sub", "https://b.example/sub"} {
+		if err := AddSubscription(u, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		sub, err := GetSubscriptionByURL(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, sub.ID)
+	}
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	config := func(sub int64, link, key string) SubscriptionConfig {
+		return SubscriptionConfig{
+			SubscriptionID: sql.NullInt64{Int64: sub, Valid: true},
+			ConfigLink:     link,
+			DedupKey:       sql.NullString{String: key, Valid: true},
+			LastSeenAt:     now,
+		}
+	}
+	// Both carry the shared server under their own remark; the first also has one of its own.
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{
+		config(ids[0], "vless://x@1.2.3.4:443#a", "shared"),
+		config(ids[0], "vless://y@5.6.7.8:443#a", "own"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{config(ids[1], "vless://x@1.2.3.4:443#b", "shared")}); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]string{}
+	rows, err := DB.Queryx(`SELECT dedup_key, GROUP_CONCAT(cs.subscription_id) FROM subscription_configs sc
+		JOIN config_sources cs ON cs.config_id = sc.id GROUP BY sc.id ORDER BY sc.id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var key, subs string
+		if err := rows.Scan(&key, &subs); err != nil {
+			t.Fatal(err)
+		}
+		sources[key] = subs
+	}
+	rows.Close()
+	if want := fmt.Sprintf("%d,%d", ids[0], ids[1]); sources["shared"] != want {
+		t.Errorf("sources of the shared config = %q, want %q", sources["shared"], want)
+	}
+	if want := fmt.Sprint(ids[0]); sources["own"] != want {
+		t.Errorf("sources of the own config = %q, want %q", sources["own"], want)
+	}
+
+	// Deleting the owner hands the shared config to the other source and drops the rest.
+	if err := DeleteSubscription(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	var remaining []SubscriptionConfig
+	if err := DB.Select(&remaining, `SELECT subscription_id, config_link FROM subscription_configs`); err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0].SubscriptionID.Int64 != ids[1] {
+		t.Errorf("configs after delete = %+v, want the shared one owned by %d", remaining, ids[1])
+	}
+}
+
+func TestTakeOverDuplicateLinkConflict(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://a.example/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://a.example/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	// The row holding the link has an older dedup key than the one it resolves to now.
+	if _, err := DB.Exec(`INSERT INTO subscription_configs (subscription_id, config_link, dedup_key, last_seen_at) VALUES
+		(?, 'vless://x@1.2.3.4:443#b', 'old', ?), (?, 'vless://x@1.2.3.4:443#a', 'new', ?)`, sub.ID, now, sub.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	err = UpsertSubscriptionConfigs([]SubscriptionConfig{{
+		SubscriptionID: sql.NullInt64{Int64: sub.ID, Valid: true},
+		ConfigLink:     "vless://x@1.2.3.4:443#b",
+		DedupKey:       sql.NullString{String: "new", Valid: true},
+		LastSeenAt:     now,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var configs []SubscriptionConfig
+	if err := DB.Select(&configs, `SELECT config_link, dedup_key FROM subscription_configs`); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].ConfigLink != "vless://x@1.2.3.4:443#b" || configs[0].DedupKey.String != "new" {
+		t.Errorf("configs = %+v, want one row with the new link and key", configs)
+	}
+}
+
+func TestBackfillDedupKeys(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://a.example/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://a.example/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rows stored before dedup keys existed: the same server twice, and another one.
+	links := []string{"vless://x@1.2.3.4:443#a", "vless://x@1.2.3.4:443#b", "trojan://p@5.6.7.8:443#c"}
+	for _, link := range links {
+		res, err := DB.Exec(`INSERT INTO subscription_configs (subscription_id, config_link, last_seen_at) VALUES (?, ?, ?)`, sub.ID, link, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		if _, err := DB.Exec(`INSERT INTO config_sources (config_id, subscription_id, last_seen_at) VALUES (?, ?, ?)`, id, sub.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := DB.Exec(`UPDATE subscription_configs SET notes = 'keep me' WHERE config_link = ?`, links[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BackfillDedupKeys(); err != nil {
+		t.Fatal(err)
+	}
+	var configs []SubscriptionConfig
+	if err := DB.Select(&configs, `SELECT config_link, dedup_key, notes FROM subscription_configs ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("configs = %+v, want the duplicate merged", configs)
+	}
+	if configs[0].ConfigLink != links[0] || configs[0].Notes.String != "keep me" {
+		t.Errorf("merged config = %+v, want the first link with the notes of the second", configs[0])
+	}
+	for _, c := range configs {
+		if c.DedupKey.String != utils.ConfigDedupKey(c.ConfigLink) {
+			t.Errorf("dedup key of %s = %q, want %q", c.ConfigLink, c.DedupKey.String, utils.ConfigDedupKey(c.ConfigLink))
+		}
+	}
+
+	// A later run has nothing left to do.
+	if err := BackfillDedupKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateParsedConfigsMerge(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	row := func(link, key string) SubscriptionConfig {
+		return SubscriptionConfig{ConfigLink: link, LastSeenAt: now, DedupKey: sql.NullString{String: key, Valid: true}}
+	}
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{row("vless://x@1.2.3.4:443#a", "a"), row("vless://x@1.2.3.4:443#b", "b")}); err != nil {
+		t.Fatal(err)
+	}
+	var configs []SubscriptionConfig
+	if err := DB.Select(&configs, `SELECT id, config_link FROM subscription_configs ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	keep, merged := configs[0].ID, configs[1].ID
+	// The merged row carries a test target and was disabled by the user.
+	if err := SetConfigTestTarget(merged, "https://example.com/ping", 204); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(`UPDATE subscription_configs SET enabled = 0 WHERE id = ?`, merged); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-parsing finds both are the same server.
+	update := configs[1]
+	update.DedupKey = sql.NullString{String: "a", Valid: true}
+	update.Protocol = sql.NullString{String: "vless", Valid: true}
+	n, err := UpdateParsedConfigs([]SubscriptionConfig{update})
+	if err != nil || n != 1 {
+		t.Fatalf("UpdateParsedConfigs() = %d, %v; want 1 merged", n, err)
+	}
+	if _, err := GetSubscriptionConfig(merged); !errors.Is(err, ErrNotFound) {
+		t.Errorf("merged config still exists: %v", err)
+	}
+	c, err := GetSubscriptionConfig(keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TestURL.String != "https://example.com/ping" || c.ExpectedStatus.Int64 != 204 {
+		t.Errorf("test target = %q %d, want the merged config's", c.TestURL.String, c.ExpectedStatus.Int64)
+	}
+	if c.Enabled {
+		t.Error("merged config was disabled, the surviving one should be too")
+	}
+
+	// A config without a duplicate just gets its new metadata.
+	c.Remark = sql.NullString{String: "renamed", Valid: true}
+	if n, err := UpdateParsedConfigs([]SubscriptionConfig{*c}); err != nil || n != 0 {
+		t.Fatalf("UpdateParsedConfigs() = %d, %v; want 0 merged", n, err)
+	}
+	if c, err := GetSubscriptionConfig(keep); err != nil || c.Remark.String != "renamed" {
+		t.Errorf("remark = %v, %v; want renamed", c, err)
+	}
+}
+
+func TestRecordSubscriptionFailure(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://a.example/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://a.example/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The streak grows with each failure and disables the subscription once, at the threshold.
+	for i, wantDisabled := range []bool{false, false, true, false} {
+		streak, disabled, err := RecordSubscriptionFailure(sub.ID, fmt.Sprintf("HTTP 50%d", i), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if streak != i+1 || disabled != wantDisabled {
+			t.Errorf("failure %d: streak %d, disabled %v; want %d, %v", i+1, streak, disabled, i+1, wantDisabled)
+		}
+	}
+	got, err := GetSubscriptionByID(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Enabled || got.FailureCount != 4 || got.LastError.String != "HTTP 503" {
+		t.Errorf("after failures: enabled %v, failure count %d, last error %q", got.Enabled, got.FailureCount, got.LastError.String)
+	}
+
+	// A successful fetch ends the streak.
+	if err := UpdateSubscriptionFetched(sub.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = GetSubscriptionByID(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got.FailureCount != 0 || got.LastError.Valid {
+		t.Errorf("after a fetch: failure count %d, last error %v; want them reset", got.FailureCount, got.LastError)
+	}
+
+	// Without a threshold a subscription is never disabled.
+	enabled := true
+	if err := UpdateSubscription(sub.ID, nil, nil, nil, &enabled); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if _, disabled, err := RecordSubscriptionFailure(sub.ID, "timeout", 0); err != nil || disabled {
+			t.Fatalf("RecordSubscriptionFailure() disabled = %v, err = %v", disabled, err)
+		}
+	}
+
+	if _, _, err := RecordSubscriptionFailure(999, "timeout", 3); err == nil {
+		t.Error("RecordSubscriptionFailure() of a missing subscription succeeded")
+	}
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExportState is the link set last written by 'subs export --since-last' to an
+// export target, which the next export is diffed against.
+type ExportState struct {
+	Name string `db:"name"`
+	// Links holds one exported link per line.
+	Links      string    `db:"links"`
+	ExportedAt time.Time `db:"exported_at"`
+}
+
+// LinkSet returns the links of the state.
+func (s ExportState) LinkSet() []string {
+	if s.Links == "" {
+		return nil
+	}
+	return strings.Split(s.Links, "\n")
+}
+
+// GetExportState returns the state of the export target called name.
+func GetExportState(name string) (*ExportState, error) {
+	var states []ExportState
+	if err := DB.Select(&states, `SELECT name, links, exported_at FROM export_states WHERE name = ?`, name); err != nil {
+		return nil, fmt.Errorf("failed to get export state %s: %w", name, err)
+	}
+	if len(states) == 0 {
+		return nil, notFound("no earlier export to %q", name)
+	}
+	return &states[0], nil
+}
+
+// SaveExportState records links as the last export to name.
+func SaveExportState(name string, links []string) error {
+	_, err := DB.Exec(`
+		INSERT INTO export_states (name, links) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			links = excluded.links,
+			exported_at = CURRENT_TIMESTAMP`, name, strings.Join(links, "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to save export state %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExportStates(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if _, err := GetExportState("phone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetExportState before any export: err = %v", err)
+	}
+	if err := SaveExportState("phone", []string{"vless://a", "trojan://b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveExportState("phone", []string{"trojan://b", "ss://c"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetExportState("phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links := got.LinkSet(); !slices.Equal(links, []string{"trojan://b", "ss://c"}) {
+		t.Errorf("LinkSet = %v", links)
+	}
+
+	if err := SaveExportState("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetExportState("empty"); err != nil || got.LinkSet() != nil {
+		t.Errorf("GetExportState(empty) = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,413 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ConfigFilter is a --where expression compiled to a parameterized SQL condition on
+// subscription_configs. Only whitelisted fields, operators and date functions are
+// accepted; every literal is bound as an argument, never spliced into the query.
+type ConfigFilter struct {
+	SQL  string
+	Args []interface{}
+}
+
+// And returns a filter matching the configs both f and other match.
+func (f *ConfigFilter) And(other *ConfigFilter) *ConfigFilter {
+	return &ConfigFilter{
+		SQL:  "(" + f.SQL + ") AND (" + other.SQL + ")",
+		Args: append(append([]interface{}{}, f.Args...), other.Args...),
+	}
+}
+
+// configFilterFields maps the field names accepted in a filter to their columns.
+var configFilterFields = map[string]string{
+	"id":           "id",
+	"protocol":     "protocol",
+	"remark":       "remark",
+	"link":         "config_link",
+	"added":        "added_at",
+	"added_at":     "added_at",
+	"last_seen":    "last_seen_at",
+	"last_seen_at": "last_seen_at",
+	"parse_error":  "parse_error",
+	"notes":        "notes",
+	"enabled":      "enabled",
+	"alias":        "alias",
+}
+
+// ConfigFilterFields lists the field names a filter may use, for help output.
+var ConfigFilterFields = []string{"id", "protocol", "remark", "link", "added", "last_seen", "parse_error", "notes", "enabled", "alias", "sub"}
+
+// subFilterField matches configs by any subscription they were seen in.
+const subFilterField = "sub"
+
+// dateModifier is the subset of SQLite date modifiers allowed in date()/datetime().
+var dateModifier = regexp.MustCompile(`^[+-]?\d+(\.\d+)? (second|minute|hour|day|month|year)s?$|^start of (day|month|year)$`)
+
+// ParseConfigFilter compiles an expression such as
+//
+//	protocol = 'ss' AND last_seen < date('now', '-30 day')
+//
+// Conditions are "field op value", "field [NOT] LIKE 'pattern'", "field IN (v, ...)"
+// and "field IS [NOT] NULL", combined with AND, OR, NOT and parentheses. Values are
+// quoted strings, numbers, TRUE/FALSE and date()/datetime() of 'now' plus modifiers.
+func ParseConfigFilter(expr string) (*ConfigFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+	p := &filterParser{tokens: tokens}
+	sql, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return &ConfigFilter{SQL: sql, Args: p.args}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenizeFilter(s string) ([]filterToken, error) {
+	var tokens []filterToken
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, filterToken{tokComma, ",", i})
+			i++
+		case c == '\'' || c == '"':
+			// A doubled quote inside a string stands for the quote itself.
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(r) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if r[i] == c {
+					if i+1 < len(r) && r[i+1] == c {
+						b.WriteRune(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteRune(r[i])
+				i++
+			}
+			tokens = append(tokens, filterToken{tokString, b.String(), start})
+		case strings.ContainsRune("=!<>", c):
+			start := i
+			i++
+			if i < len(r) && (r[i] == '=' || (c == '<' && r[i] == '>')) {
+				i++
+			}
+			op := string(r[start:i])
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected \"!\" at position %d", start)
+			}
+			tokens = append(tokens, filterToken{tokOp, op, start})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(r) && unicode.IsDigit(r[i+1])):
+			start := i
+			i++
+			for i < len(r) && (unicode.IsDigit(r[i]) || r[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokNumber, string(r[start:i]), start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(r) && (unicode.IsLetter(r[i]) || unicode.IsDigit(r[i]) || r[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokIdent, string(r[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	args   []interface{}
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos >= len(p.tokens) {
+		return filterToken{kind: tokEOF, text: "end of filter", pos: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the next token when it is the given (case-insensitive) keyword.
+func (p *filterParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(kind tokenKind, what string) error {
+	if t := p.next(); t.kind != kind {
+		return fmt.Errorf("expected %s, got %q", what, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = left + " OR " + right
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		left = left + " AND " + right
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (string, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(tokRParen, `")"`); err != nil {
+			return "", err
+		}
+		return "(" + inner + ")", nil
+	}
+	return p.parseCondition()
+}
+
+func (p *filterParser) parseCondition() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return "", fmt.Errorf("expected a field name, got %q", t.text)
+	}
+	name := strings.ToLower(t.text)
+	column, ok := configFilterFields[name]
+	if !ok && name != subFilterField {
+		return "", fmt.Errorf("unknown field %q (valid fields: %s)", t.text, strings.Join(ConfigFilterFields, ", "))
+	}
+
+	cond, err := p.parseComparison(column)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", t.text, err)
+	}
+	if name == subFilterField {
+		// The condition applies to the config's sources rather than to a column.
+		return "id IN (SELECT config_id FROM config_sources WHERE " + cond + ")", nil
+	}
+	return cond, nil
+}
+
+// parseComparison parses the operator and operand(s) of a condition on column. For
+// the sub field, column is empty and the condition is built on subscription_id.
+func (p *filterParser) parseComparison(column string) (string, error) {
+	if column == "" {
+		column = "subscription_id"
+	}
+
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if !p.keyword("NULL") {
+			return "", fmt.Errorf("expected NULL after IS")
+		}
+		if not {
+			return column + " IS NOT NULL", nil
+		}
+		return column + " IS NULL", nil
+	}
+
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("LIKE"):
+		v, err := p.parseValue()
+		if err != nil {
+			return "", err
+		}
+		if not {
+			return column + " NOT LIKE " + v, nil
+		}
+		return column + " LIKE " + v, nil
+	case p.keyword("IN"):
+		if err := p.expect(tokLParen, `"(" after IN`); err != nil {
+			return "", err
+		}
+		var values []string
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return "", err
+			}
+			values = append(values, v)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(tokRParen, `")"`); err != nil {
+			return "", err
+		}
+		op := " IN ("
+		if not {
+			op = " NOT IN ("
+		}
+		return column + op + strings.Join(values, ", ") + ")", nil
+	case not:
+		return "", fmt.Errorf("expected LIKE or IN after NOT")
+	}
+
+	t := p.next()
+	if t.kind != tokOp {
+		return "", fmt.Errorf("expected an operator, got %q", t.text)
+	}
+	op := t.text
+	switch op {
+	case "==":
+		op = "="
+	case "<>":
+		op = "!="
+	}
+	v, err := p.parseValue()
+	if err != nil {
+		return "", err
+	}
+	return column + " " + op + " " + v, nil
+}
+
+// parseValue parses a literal or date function, binds it and returns its placeholder.
+func (p *filterParser) parseValue() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		p.args = append(p.args, t.text)
+		return "?", nil
+	case tokNumber:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			p.args = append(p.args, n)
+		} else if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			p.args = append(p.args, f)
+		} else {
+			return "", fmt.Errorf("invalid number %q", t.text)
+		}
+		return "?", nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			p.args = append(p.args, 1)
+			return "?", nil
+		case "false":
+			p.args = append(p.args, 0)
+			return "?", nil
+		case "date", "datetime":
+			return p.parseDateFunc(strings.ToLower(t.text))
+		}
+	}
+	return "", fmt.Errorf("expected a value, got %q", t.text)
+}
+
+// parseDateFunc parses the arguments of date('now', modifier...) or datetime(...).
+func (p *filterParser) parseDateFunc(fn string) (string, error) {
+	if err := p.expect(tokLParen, `"(" after `+fn); err != nil {
+		return "", err
+	}
+	var placeholders []string
+	for i := 0; ; i++ {
+		t := p.next()
+		if t.kind != tokString {
+			return "", fmt.Errorf("%s() takes quoted arguments, got %q", fn, t.text)
+		}
+		arg := strings.TrimSpace(t.text)
+		if i == 0 && !strings.EqualFold(arg, "now") {
+			return "", fmt.Errorf("%s() must start with 'now', got %q", fn, t.text)
+		}
+		if i > 0 && !dateModifier.MatchString(strings.ToLower(arg)) {
+			return "", fmt.Errorf("unsupported %s() modifier %q (e.g. '-30 day', '+2 hours', 'start of month')", fn, t.text)
+		}
+		p.args = append(p.args, strings.ToLower(arg))
+		placeholders = append(placeholders, "?")
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(tokRParen, `")"`); err != nil {
+		return "", err
+	}
+	return fn + "(" + strings.Join(placeholders, ", ") + ")", nil
+}
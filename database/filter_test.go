@@ -0,0 +1,73 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		sql  string
+		args []interface{}
+	}{
+		{
+			expr: "protocol='ss' AND last_seen < date('now','-30 day')",
+			sql:  "protocol = ? AND last_seen_at < date(?, ?)",
+			args: []interface{}{"ss", "now", "-30 day"},
+		},
+		{
+			expr: `remark LIKE "%test%" or (id >= 10 and not enabled = true)`,
+			sql:  "remark LIKE ? OR (id >= ? AND NOT enabled = ?)",
+			args: []interface{}{"%test%", int64(10), 1},
+		},
+		{
+			expr: "protocol NOT IN ('ss', 'vmess') AND notes IS NOT NULL",
+			sql:  "protocol NOT IN (?, ?) AND notes IS NOT NULL",
+			args: []interface{}{"ss", "vmess"},
+		},
+		{
+			expr: "sub = 3 AND parse_error IS NULL",
+			sql:  "id IN (SELECT config_id FROM config_sources WHERE subscription_id = ?) AND parse_error IS NULL",
+			args: []interface{}{int64(3)},
+		},
+		{
+			expr: "remark <> 'it''s'",
+			sql:  "remark != ?",
+			args: []interface{}{"it's"},
+		},
+	}
+	for _, tt := range tests {
+		f, err := ParseConfigFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseConfigFilter(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if f.SQL != tt.sql {
+			t.Errorf("ParseConfigFilter(%q) SQL = %q, want %q", tt.expr, f.SQL, tt.sql)
+		}
+		if !reflect.DeepEqual(f.Args, tt.args) {
+			t.Errorf("ParseConfigFilter(%q) args = %#v, want %#v", tt.expr, f.Args, tt.args)
+		}
+	}
+}
+
+func TestParseConfigFilterRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"password = 'x'",
+		"protocol = 'ss'; DROP TABLE subscriptions",
+		"protocol = ss",
+		"last_seen < date('2020-01-01')",
+		"last_seen < date('now', 'unixepoch')",
+		"last_seen < strftime('%s', 'now')",
+		"(protocol = 'ss'",
+		"protocol = 'ss' AND",
+		"remark = 'unterminated",
+		"protocol 'ss'",
+	} {
+		if f, err := ParseConfigFilter(expr); err == nil {
+			t.Errorf("ParseConfigFilter(%q) = %q, want an error", expr, f.SQL)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ConfigGroup is a composite link (see protocol.ParseComposite) whose member
+// configs are stored as ordinary configs and linked to it in order.
+type ConfigGroup struct {
+	ID             int64          `db:"id"`
+	Kind           string         `db:"kind"` // "chain" or "balancer"
+	Link           string         `db:"link"`
+	Remark         sql.NullString `db:"remark"`
+	SubscriptionID sql.NullInt64  `db:"subscription_id"`
+	AddedAt        time.Time      `db:"added_at"`
+	LastSeenAt     sql.NullTime   `db:"last_seen_at"`
+	// Members are the member configs, entry hop first for a chain. When saving,
+	// only ConfigLink and DedupKey are used to find the stored rows.
+	Members []SubscriptionConfig `db:"-"`
+}
+
+const upsertConfigGroupQuery = `
+		INSERT INTO config_groups (kind, link, remark, subscription_id, last_seen_at)
+		VALUES (:kind, :link, :remark, :subscription_id, :last_seen_at)
+		ON CONFLICT(link) DO UPDATE SET
+			last_seen_at = excluded.last_seen_at,
+			remark = excluded.remark,
+			subscription_id = COALESCE(config_groups.subscription_id, excluded.subscription_id)
+		RETURNING id
+	`
+
+// upsertConfigGroupsTx saves groups and replaces their member lists. The member
+// configs must already be stored in tx.
+func upsertConfigGroupsTx(tx *sqlx.Tx, groups []ConfigGroup) error {
+	ctx := context.Background()
+	stmt, err := tx.PrepareNamedContext(ctx, upsertConfigGroupQuery)
+	if err != nil {
+		return fmt.Errorf("could not prepare named statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, g := range groups {
+		var groupID int64
+		if err := stmt.GetContext(ctx, &groupID, g); err != nil {
+			return fmt.Errorf("failed to save group %s: %w", g.Link, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM config_group_members WHERE group_id = ?`, groupID); err != nil {
+			return fmt.Errorf("failed to clear members of group %d: %w", groupID, err)
+		}
+		for pos, m := range g.Members {
+			// A member merged into a duplicate is found by its dedup key.
+			var configID int64
+			err := tx.GetContext(ctx, &configID, `
+				SELECT id FROM subscription_configs WHERE config_link = ?
+				UNION ALL
+				SELECT id FROM subscription_configs WHERE dedup_key = ?
+				LIMIT 1`, m.ConfigLink, m.DedupKey)
+			if err != nil {
+				return fmt.Errorf("failed to look up member %s of group %d: %w", m.ConfigLink, groupID, err)
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO config_group_members (group_id, position, config_id) VALUES (?, ?, ?)`,
+				groupID, pos, configID); err != nil {
+				return fmt.Errorf("failed to add member to group %d: %w", groupID, err)
+			}
+		}
+	}
+	return nil
+}
+
+const selectConfigGroups = `SELECT id, kind, link, remark, subscription_id, added_at, last_seen_at FROM config_groups`
+
+// ListConfigGroups lists the groups with their members, of one subscription
+// when subID is not 0.
+func ListConfigGroups(subID int64) ([]ConfigGroup, error) {
+	var groups []ConfigGroup
+	query := selectConfigGroups + ` ORDER BY id`
+	args := []any{}
+	if subID != 0 {
+		query = selectConfigGroups + ` WHERE subscription_id = ? ORDER BY id`
+		args = append(args, subID)
+	}
+	if err := DB.Select(&groups, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list config groups: %w", err)
+	}
+	for i := range groups {
+		members, err := configGroupMembers(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].Members = members
+	}
+	return groups, nil
+}
+
+// GetConfigGroup returns a group with its members.
+func GetConfigGroup(id int64) (*ConfigGroup, error) {
+	var g ConfigGroup
+	if err := DB.Get(&g, selectConfigGroups+` WHERE id = ?`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("config group with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get config group %d: %w", id, err)
+	}
+	members, err := configGroupMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	g.Members = members
+	return &g, nil
+}
+
+func configGroupMembers(groupID int64) ([]SubscriptionConfig, error) {
+	var members []SubscriptionConfig
+	query := `SELECT sc.id, sc.subscription_id, sc.config_link, sc.protocol, sc.remark, sc.added_at, sc.last_seen_at, sc.enabled, sc.alias
+		FROM config_group_members m JOIN subscription_configs sc ON sc.id = m.config_id
+		WHERE m.group_id = ? ORDER BY m.position`
+	if err := DB.Select(&members, query, groupID); err != nil {
+		return nil, fmt.Errorf("failed to list members of config group %d: %w", groupID, err)
+	}
+	return members, nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigGroupMembers(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	row := func(link, key string) SubscriptionConfig {
+		return SubscriptionConfig{ConfigLink: link, LastSeenAt: now, DedupKey: sql.NullString{String: key, Valid: true}}
+	}
+	existing := row("trojan://p@b.example.com:443#Old name", "trojan|b")
+	if err := UpsertSubscriptionConfigs([]SubscriptionConfig{existing}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The exit hop is the stored config under another remark.
+	members := []SubscriptionConfig{row("vless://id@a.example.com:443#Entry", "vless|a"), row("trojan://p@b.example.com:443#Exit", "trojan|b")}
+	group := ConfigGroup{Kind: "chain", Link: "relay://abc", LastSeenAt: now, Members: members}
+	w := NewConfigBatchWriter(100)
+	if err := w.Add(members); err != nil {
+		t.Fatal(err)
+	}
+	w.AddGroups([]ConfigGroup{group})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := ListConfigGroups(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Members) != 2 {
+		t.Fatalf("groups = %+v", groups)
+	}
+	got := groups[0].Members
+	if got[0].ConfigLink != members[0].ConfigLink || got[1].ConfigLink != existing.ConfigLink {
+		t.Errorf("members = %s, %s; want the entry hop, then the stored duplicate", got[0].ConfigLink, got[1].ConfigLink)
+	}
+
+	// Fetching the link again replaces the member list.
+	group.Members = members[:1]
+	w.AddGroups([]ConfigGroup{group})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	g, err := GetConfigGroup(groups[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Members) != 1 {
+		t.Errorf("members after refetch = %d, want 1", len(g.Members))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package database
+
+import "os"
+
+// lockFile is a no-op where file locks aren't available; concurrent first runs
+// of a new version may then race on the migrations.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
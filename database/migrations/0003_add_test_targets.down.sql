@@ -0,0 +1,6 @@
+DROP TABLE tag_test_targets;
+
+ALTER TABLE subscription_configs DROP COLUMN expected_status;
+ALTER TABLE subscription_configs DROP COLUMN test_url;
+ALTER TABLE subscriptions DROP COLUMN expected_status;
+ALTER TABLE subscriptions DROP COLUMN test_url;
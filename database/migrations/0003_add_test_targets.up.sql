@@ -0,0 +1,11 @@
+ALTER TABLE subscriptions ADD COLUMN test_url TEXT;
+ALTER TABLE subscriptions ADD COLUMN expected_status INTEGER;
+ALTER TABLE subscription_configs ADD COLUMN test_url TEXT;
+ALTER TABLE subscription_configs ADD COLUMN expected_status INTEGER;
+
+CREATE TABLE tag_test_targets (
+                                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                tag TEXT NOT NULL UNIQUE,
+                                test_url TEXT NOT NULL DEFAULT '',
+                                expected_status INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,3 @@
+DROP TABLE config_sources;
+DROP INDEX idx_subscription_configs_dedup_key;
+ALTER TABLE subscription_configs DROP COLUMN dedup_key;
@@ -0,0 +1,16 @@
+ALTER TABLE subscription_configs ADD COLUMN dedup_key TEXT;
+CREATE UNIQUE INDEX idx_subscription_configs_dedup_key ON subscription_configs(dedup_key) WHERE dedup_key IS NOT NULL;
+
+CREATE TABLE config_sources (
+                                config_id INTEGER NOT NULL,
+                                subscription_id INTEGER NOT NULL,
+                                first_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                last_seen_at DATETIME,
+                                PRIMARY KEY (config_id, subscription_id),
+                                FOREIGN KEY(config_id) REFERENCES subscription_configs(id) ON DELETE CASCADE,
+                                FOREIGN KEY(subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_config_sources_subscription_id ON config_sources(subscription_id);
+
+INSERT INTO config_sources (config_id, subscription_id, first_seen_at, last_seen_at)
+SELECT id, subscription_id, added_at, last_seen_at FROM subscription_configs WHERE subscription_id IS NOT NULL;
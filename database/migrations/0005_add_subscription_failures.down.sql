@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions DROP COLUMN last_error;
+ALTER TABLE subscriptions DROP COLUMN failure_count;
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions ADD COLUMN failure_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN last_error TEXT;
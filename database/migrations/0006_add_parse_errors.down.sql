@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subscription_configs_parse_error;
+ALTER TABLE subscription_configs DROP COLUMN parse_error_detail;
+ALTER TABLE subscription_configs DROP COLUMN parse_error;
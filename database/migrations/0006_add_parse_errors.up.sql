@@ -0,0 +1,3 @@
+ALTER TABLE subscription_configs ADD COLUMN parse_error TEXT;
+ALTER TABLE subscription_configs ADD COLUMN parse_error_detail TEXT;
+CREATE INDEX idx_subscription_configs_parse_error ON subscription_configs(parse_error) WHERE parse_error IS NOT NULL;
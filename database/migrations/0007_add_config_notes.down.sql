@@ -0,0 +1,2 @@
+ALTER TABLE subscription_configs DROP COLUMN metadata;
+ALTER TABLE subscription_configs DROP COLUMN notes;
@@ -0,0 +1,2 @@
+ALTER TABLE subscription_configs ADD COLUMN notes TEXT;
+ALTER TABLE subscription_configs ADD COLUMN metadata TEXT;
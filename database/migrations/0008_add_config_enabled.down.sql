@@ -0,0 +1 @@
+ALTER TABLE subscription_configs DROP COLUMN enabled;
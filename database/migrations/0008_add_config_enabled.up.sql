@@ -0,0 +1 @@
+ALTER TABLE subscription_configs ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT 1;
@@ -0,0 +1,12 @@
+CREATE TABLE subscription_snapshots (
+                                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                subscription_id INTEGER NOT NULL,
+                                fetched_at DATETIME NOT NULL,
+                                last_seen_at DATETIME NOT NULL,
+                                sha256 TEXT NOT NULL,
+                                size INTEGER NOT NULL,
+                                links INTEGER NOT NULL,
+                                payload BLOB NOT NULL,
+                                FOREIGN KEY(subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_subscription_snapshots_subscription_id ON subscription_snapshots(subscription_id, fetched_at);
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions DROP COLUMN html_pattern;
+ALTER TABLE subscriptions DROP COLUMN html_selector;
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions ADD COLUMN html_selector TEXT;
+ALTER TABLE subscriptions ADD COLUMN html_pattern TEXT;
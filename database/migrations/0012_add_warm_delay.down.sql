@@ -0,0 +1 @@
+ALTER TABLE http_test_results DROP COLUMN warm_delay_ms;
@@ -0,0 +1 @@
+ALTER TABLE http_test_results ADD COLUMN warm_delay_ms INTEGER DEFAULT 0;
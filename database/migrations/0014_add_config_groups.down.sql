@@ -0,0 +1,2 @@
+DROP TABLE config_group_members;
+DROP TABLE config_groups;
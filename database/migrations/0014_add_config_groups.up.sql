@@ -0,0 +1,21 @@
+CREATE TABLE config_groups (
+                                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                kind TEXT NOT NULL,
+                                link TEXT NOT NULL UNIQUE,
+                                remark TEXT,
+                                subscription_id INTEGER,
+                                added_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                last_seen_at DATETIME,
+                                FOREIGN KEY(subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_config_groups_subscription_id ON config_groups(subscription_id);
+
+CREATE TABLE config_group_members (
+                                group_id INTEGER NOT NULL,
+                                position INTEGER NOT NULL,
+                                config_id INTEGER NOT NULL,
+                                PRIMARY KEY (group_id, position),
+                                FOREIGN KEY(group_id) REFERENCES config_groups(id) ON DELETE CASCADE,
+                                FOREIGN KEY(config_id) REFERENCES subscription_configs(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_config_group_members_config_id ON config_group_members(config_id);
@@ -0,0 +1,4 @@
+DROP TABLE alias_counters;
+DROP INDEX idx_subscription_configs_unaliased;
+DROP INDEX idx_subscription_configs_alias;
+ALTER TABLE subscription_configs DROP COLUMN alias;
@@ -0,0 +1,8 @@
+ALTER TABLE subscription_configs ADD COLUMN alias TEXT;
+CREATE UNIQUE INDEX idx_subscription_configs_alias ON subscription_configs(alias) WHERE alias IS NOT NULL;
+CREATE INDEX idx_subscription_configs_unaliased ON subscription_configs(id) WHERE alias IS NULL;
+
+CREATE TABLE alias_counters (
+                                prefix TEXT PRIMARY KEY,
+                                next INTEGER NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN resolved_url TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results DROP COLUMN nat_type;
+ALTER TABLE http_test_results DROP COLUMN udp;
@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results ADD COLUMN udp INTEGER DEFAULT 0;
+ALTER TABLE http_test_results ADD COLUMN nat_type TEXT DEFAULT '';
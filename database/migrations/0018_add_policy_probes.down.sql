@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results DROP COLUMN p2p;
+ALTER TABLE http_test_results DROP COLUMN smtp;
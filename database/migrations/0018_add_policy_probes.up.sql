@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results ADD COLUMN smtp TEXT DEFAULT '';
+ALTER TABLE http_test_results ADD COLUMN p2p TEXT DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE http_test_results DROP COLUMN cert_warnings;
+ALTER TABLE http_test_results DROP COLUMN cert_expires;
+ALTER TABLE http_test_results DROP COLUMN cert_sans;
+ALTER TABLE http_test_results DROP COLUMN cert_issuer;
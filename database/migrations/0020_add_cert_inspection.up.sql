@@ -0,0 +1,4 @@
+ALTER TABLE http_test_results ADD COLUMN cert_issuer TEXT DEFAULT '';
+ALTER TABLE http_test_results ADD COLUMN cert_sans TEXT DEFAULT '';
+ALTER TABLE http_test_results ADD COLUMN cert_expires TEXT DEFAULT '';
+ALTER TABLE http_test_results ADD COLUMN cert_warnings TEXT DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
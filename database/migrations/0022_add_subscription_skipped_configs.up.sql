@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN skipped_configs INTEGER NOT NULL DEFAULT 0;
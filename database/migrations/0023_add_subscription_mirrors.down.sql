@@ -0,0 +1,3 @@
+ALTER TABLE subscriptions DROP COLUMN fetched_from;
+ALTER TABLE subscriptions DROP COLUMN race_mirrors;
+ALTER TABLE subscriptions DROP COLUMN mirrors;
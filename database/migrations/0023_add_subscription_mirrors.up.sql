@@ -0,0 +1,3 @@
+ALTER TABLE subscriptions ADD COLUMN mirrors TEXT;
+ALTER TABLE subscriptions ADD COLUMN race_mirrors BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN fetched_from TEXT;
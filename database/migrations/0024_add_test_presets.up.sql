@@ -0,0 +1,6 @@
+CREATE TABLE test_presets (
+                                name TEXT PRIMARY KEY,
+                                flags TEXT NOT NULL,
+                                weights TEXT NOT NULL DEFAULT '',
+                                updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
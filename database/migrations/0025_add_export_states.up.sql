@@ -0,0 +1,5 @@
+CREATE TABLE export_states (
+                                name TEXT PRIMARY KEY,
+                                links TEXT NOT NULL,
+                                exported_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN exclude_rules TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results DROP COLUMN block_signal;
+ALTER TABLE http_test_results DROP COLUMN failure;
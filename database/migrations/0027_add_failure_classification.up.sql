@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results ADD COLUMN failure TEXT DEFAULT '';
+ALTER TABLE http_test_results ADD COLUMN block_signal TEXT DEFAULT '';
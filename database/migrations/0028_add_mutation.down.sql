@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results DROP COLUMN mutated_link;
+ALTER TABLE http_test_results DROP COLUMN mutation;
@@ -0,0 +1,2 @@
+ALTER TABLE http_test_results ADD COLUMN mutation TEXT DEFAULT '';
+ALTER TABLE http_test_results ADD COLUMN mutated_link TEXT DEFAULT '';
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestPreset is a named set of test flags, with the scoring weights that rank
+// what they tested.
+type TestPreset struct {
+	Name string `db:"name"`
+	// Flags holds one "flag=value" line per flag, e.g. "thread=8".
+	Flags string `db:"flags"`
+	// Weights are factor=weight pairs as 'subs best --weights' takes them, empty
+	// for the weights of the config file.
+	Weights   string    `db:"weights"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// presetPattern is what a preset name may look like.
+var presetPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// ValidatePresetName checks the name of a test preset.
+func ValidatePresetName(name string) error {
+	if !presetPattern.MatchString(name) {
+		return fmt.Errorf("invalid preset name %q: use up to 32 lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// FlagValues returns the flags of the preset by name.
+func (p TestPreset) FlagValues() map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(p.Flags, "\n") {
+		if name, value, ok := strings.Cut(line, "="); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// SetFlagValues stores values as the flags of the preset, sorted by name.
+func (p *TestPreset) SetFlagValues(values map[string]string) {
+	lines := make([]string, 0, len(values))
+	for name, value := range values {
+		lines = append(lines, name+"="+value)
+	}
+	sort.Strings(lines)
+	p.Flags = strings.Join(lines, "\n")
+}
+
+// SaveTestPreset stores p, replacing a preset of the same name.
+func SaveTestPreset(p TestPreset) error {
+	if err := ValidatePresetName(p.Name); err != nil {
+		return err
+	}
+	_, err := DB.Exec(`
+		INSERT INTO test_presets (name, flags, weights) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			flags = excluded.flags,
+			weights = excluded.weights,
+			updated_at = CURRENT_TIMESTAMP`, p.Name, p.Flags, p.Weights)
+	if err != nil {
+		return fmt.Errorf("failed to save preset %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// GetTestPreset returns the preset called name.
+func GetTestPreset(name string) (*TestPreset, error) {
+	var presets []TestPreset
+	if err := DB.Select(&presets, `SELECT name, flags, weights, updated_at FROM test_presets WHERE name = ?`, name); err != nil {
+		return nil, fmt.Errorf("failed to get preset %s: %w", name, err)
+	}
+	if len(presets) == 0 {
+		return nil, notFound("preset %q not found", name)
+	}
+	return &presets[0], nil
+}
+
+// ListTestPresets returns the presets by name.
+func ListTestPresets() ([]TestPreset, error) {
+	var presets []TestPreset
+	if err := DB.Select(&presets, `SELECT name, flags, weights, updated_at FROM test_presets ORDER BY name`); err != nil {
+		return nil, fmt.Errorf("failed to list presets: %w", err)
+	}
+	return presets, nil
+}
+
+// DeleteTestPreset removes the preset called name.
+func DeleteTestPreset(name string) error {
+	res, err := DB.Exec(`DELETE FROM test_presets WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete preset %s: %w", name, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("preset %q not found", name)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTestPresets(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	p := TestPreset{Name: "mobile-sim", Weights: "speed=0.6"}
+	p.SetFlagValues(map[string]string{"thread": "4", "url": "https://example.com/?a=b", "stages": "latency,speed"})
+	if err := SaveTestPreset(p); err != nil {
+		t.Fatal(err)
+	}
+	p.Weights = ""
+	if err := SaveTestPreset(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTestPreset(TestPreset{Name: "Mobile Sim"}); err == nil {
+		t.Error("saved a preset with an invalid name")
+	}
+
+	got, err := GetTestPreset("mobile-sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := got.FlagValues()
+	if got.Weights != "" || values["url"] != "https://example.com/?a=b" || values["stages"] != "latency,speed" || len(values) != 3 {
+		t.Errorf("preset = %+v, flags %v", got, values)
+	}
+	if presets, err := ListTestPresets(); err != nil || len(presets) != 1 {
+		t.Errorf("ListTestPresets = %v, %v", presets, err)
+	}
+
+	if err := DeleteTestPreset("mobile-sim"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetTestPreset("mobile-sim"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTestPreset after delete: err = %v", err)
+	}
+	if err := DeleteTestPreset("mobile-sim"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteTestPreset twice: err = %v", err)
+	}
+}
@@ -3,12 +3,28 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
+// ErrNotFound is matched, with errors.Is, by the errors returned for a missing row.
+var ErrNotFound = errors.New("not found")
+
+type notFoundError struct{ msg string }
+
+func (e notFoundError) Error() string        { return e.msg }
+func (e notFoundError) Is(target error) bool { return target == ErrNotFound }
+
+func notFound(format string, args ...interface{}) error {
+	return notFoundError{msg: fmt.Sprintf(format, args...)}
+}
+
 // Data Models
 
 type Subscription struct {
@@ -19,6 +35,106 @@ type Subscription struct {
 	Enabled       bool           `db:"enabled"`
 	LastFetchedAt sql.NullTime   `db:"last_fetched_at"`
 	CreatedAt     time.Time      `db:"created_at"`
+	// Optional test destination overriding the global one for all configs of this subscription.
+	TestURL        sql.NullString `db:"test_url"`
+	ExpectedStatus sql.NullInt64  `db:"expected_status"`
+	// Consecutive failed fetches and the error of the last one; reset by a successful fetch.
+	FailureCount int            `db:"failure_count"`
+	LastError    sql.NullString `db:"last_error"`
+	// Encrypted SubscriptionAuth sent with fetch requests; see Subscription.Credentials.
+	Auth sql.NullString `db:"auth"`
+	// CSS selector and regular expression picking the links out of an HTML page
+	// served instead of a subscription body.
+	HTMLSelector sql.NullString `db:"html_selector"`
+	HTMLPattern  sql.NullString `db:"html_pattern"`
+	// Browser whose TLS fingerprint fetches use (chrome, firefox, safari, none).
+	Impersonate sql.NullString `db:"impersonate"`
+	// Where the URL led after following redirects on the last successful fetch.
+	ResolvedURL sql.NullString `db:"resolved_url"`
+	// Higher priorities come first in exports and own the configs they share
+	// with lower ones; see SetSubscriptionPriority.
+	Priority int `db:"priority"`
+	// Links the last successful fetch left out with --max-per-sub.
+	SkippedConfigs int `db:"skipped_configs"`
+	// Other URLs serving the same payload, one per line, tried after URL in
+	// order or, with RaceMirrors, all at once; see MirrorURLs.
+	Mirrors     sql.NullString `db:"mirrors"`
+	RaceMirrors bool           `db:"race_mirrors"`
+	// The URL or mirror the last successful fetch got its payload from.
+	FetchedFrom sql.NullString `db:"fetched_from"`
+	// Rules such as "remark~expired" or "port!=443", one per line, dropping the
+	// links they match at fetch time; see ExcludeRuleList.
+	ExcludeRules sql.NullString `db:"exclude_rules"`
+}
+
+// SubscriptionAuth holds the credentials a private subscription is fetched with.
+type SubscriptionAuth struct {
+	Headers  map[string]string `json:"headers,omitempty"`
+	Username string            `json:"username,omitempty"` // HTTP basic auth
+	Password string            `json:"password,omitempty"`
+	Cookies  string            `json:"cookies,omitempty"` // Cookie header value, e.g. "session=abc; lang=en"
+}
+
+// IsZero reports whether no credential is set.
+func (a SubscriptionAuth) IsZero() bool {
+	return len(a.Headers) == 0 && a.Username == "" && a.Password == "" && a.Cookies == ""
+}
+
+// Credentials decrypts the credentials stored for the subscription, if any.
+func (s Subscription) Credentials() (SubscriptionAuth, error) {
+	var auth SubscriptionAuth
+	if !s.Auth.Valid || s.Auth.String == "" {
+		return auth, nil
+	}
+	plaintext, err := decryptSecret(s.Auth.String)
+	if err != nil {
+		return auth, fmt.Errorf("credentials of subscription %d: %w", s.ID, err)
+	}
+	if err := json.Unmarshal(plaintext, &auth); err != nil {
+		return auth, fmt.Errorf("credentials of subscription %d: %w", s.ID, err)
+	}
+	return auth, nil
+}
+
+// MirrorURLs returns the mirrors of the subscription in the order they are tried.
+func (s Subscription) MirrorURLs() []string {
+	if !s.Mirrors.Valid {
+		return nil
+	}
+	var mirrors []string
+	for _, m := range strings.Split(s.Mirrors.String, "\n") {
+		if m = strings.TrimSpace(m); m != "" {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
+
+// ExcludeRuleList returns the exclusion rules of the subscription.
+func (s Subscription) ExcludeRuleList() []string {
+	if !s.ExcludeRules.Valid {
+		return nil
+	}
+	var rules []string
+	for _, r := range strings.Split(s.ExcludeRules.String, "\n") {
+		if r = strings.TrimSpace(r); r != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// SubscriptionSnapshot is the gzip-compressed raw payload of a subscription fetch. An
+// identical payload fetched again only moves LastSeenAt forward.
+type SubscriptionSnapshot struct {
+	ID             int64     `db:"id"`
+	SubscriptionID int64     `db:"subscription_id"`
+	FetchedAt      time.Time `db:"fetched_at"`
+	LastSeenAt     time.Time `db:"last_seen_at"`
+	SHA256         string    `db:"sha256"`
+	Size           int64     `db:"size"` // uncompressed
+	Links          int       `db:"links"`
+	Payload        []byte    `db:"payload"`
 }
 
 type SubscriptionConfig struct {
@@ -29,6 +145,31 @@ type SubscriptionConfig struct {
 	Remark         sql.NullString `db:"remark"`
 	AddedAt        time.Time      `db:"added_at"`
 	LastSeenAt     sql.NullTime   `db:"last_seen_at"`
+	// Optional per-config test destination, takes precedence over the subscription's.
+	TestURL        sql.NullString `db:"test_url"`
+	ExpectedStatus sql.NullInt64  `db:"expected_status"`
+	// Identifies the server independently of the link's remark (see utils.ConfigDedupKey).
+	DedupKey sql.NullString `db:"dedup_key"`
+	// Class of the failure when the link could not be parsed (see protocol.ParseErrorClass),
+	// and the parser's message. The link is stored either way.
+	ParseError       sql.NullString `db:"parse_error"`
+	ParseErrorDetail sql.NullString `db:"parse_error_detail"`
+	// Free-form notes and a JSON object of user-defined fields, kept across fetches.
+	Notes    sql.NullString `db:"notes"`
+	Metadata sql.NullString `db:"metadata"`
+	// Disabled configs are kept but skipped by tests and the proxy.
+	Enabled bool `db:"enabled"`
+	// Short name accepted wherever a config ID or link is, e.g. "de-1".
+	Alias sql.NullString `db:"alias"`
+	// Comma-separated IDs of every subscription the config was seen in (list queries only).
+	Sources sql.NullString `db:"sources"`
+}
+
+// TestTarget is the effective test destination for a single config link.
+type TestTarget struct {
+	ConfigLink     string `db:"config_link"`
+	TestURL        string `db:"test_url"`
+	ExpectedStatus int    `db:"expected_status"`
 }
 
 type HttpTestRun struct {
@@ -39,6 +180,13 @@ type HttpTestRun struct {
 	ConfigCount int        `db:"config_count"`
 }
 
+// HttpTestRunSummary is a test run with the number of results it stored and how many passed.
+type HttpTestRunSummary struct {
+	HttpTestRun
+	Results int `db:"results"`
+	Passed  int `db:"passed"`
+}
+
 type HttpTestResult struct {
 	ID            int64          `db:"id"`
 	RunID         int64          `db:"run_id"`
@@ -52,6 +200,26 @@ type HttpTestResult struct {
 	IPLocation    sql.NullString `db:"ip_location"`
 	TTFBMs        int64          `db:"ttfb_ms"`
 	ConnectTimeMs int64          `db:"connect_time_ms"`
+	WarmDelayMs   int64          `db:"warm_delay_ms"` // delay over a reused connection, 0 = not measured
+	UDP           bool           `db:"udp"`           // UDP is relayed
+	NATType       string         `db:"nat_type"`      // NAT type found by the UDP test, "" = not tested
+	SMTP          string         `db:"smtp"`          // outgoing SMTP: open, blocked, "" = not probed
+	P2P           string         `db:"p2p"`           // BitTorrent and trackers: open, blocked, "" = not probed
+	Leaks         string         `db:"leaks"`         // comma-separated leaks found by the leak check
+	CertIssuer    string         `db:"cert_issuer"`   // issuer of the config server's certificate, "" = not inspected
+	CertSANs      string         `db:"cert_sans"`     // comma-separated names the certificate is valid for
+	CertExpires   string         `db:"cert_expires"`  // expiry date of the certificate, YYYY-MM-DD
+	CertWarnings  string         `db:"cert_warnings"` // comma-separated problems: expired, expiring, mismatch, self-signed, untrusted
+	Failure       string         `db:"failure"`       // why a failed test failed: blocked, down, "" = not classified
+	BlockSignal   string         `db:"block_signal"`  // what showed a block: rst, block-page:<country>, cert:<issuer>
+	Mutation      string         `db:"mutation"`      // variant a failed config passed as, e.g. fp=firefox, "" = none
+	MutatedLink   string         `db:"mutated_link"`  // link of that variant
+}
+
+// TimedHttpTestResult is a test result with the start time of its run.
+type TimedHttpTestResult struct {
+	HttpTestResult
+	TestedAt time.Time `db:"tested_at"`
 }
 
 type CfScanResult struct {
@@ -79,9 +247,209 @@ func AddSubscription(url, remark, userAgent string) error {
 	return nil
 }
 
+// SetSubscriptionAuth encrypts and stores the credentials of a subscription. Zero
+// credentials clear the stored ones.
+func SetSubscriptionAuth(id int64, auth SubscriptionAuth) error {
+	var value sql.NullString
+	if !auth.IsZero() {
+		plaintext, err := json.Marshal(auth)
+		if err != nil {
+			return err
+		}
+		sealed, err := encryptSecret(plaintext)
+		if err != nil {
+			return fmt.Errorf("could not encrypt credentials: %w", err)
+		}
+		value = sql.NullString{String: sealed, Valid: true}
+	}
+	res, err := DB.ExecContext(context.Background(), `UPDATE subscriptions SET auth = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return fmt.Errorf("could not store credentials of subscription %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no subscription with ID %d", id)
+	}
+	return nil
+}
+
+// SetSubscriptionScrape stores how links are extracted from the HTML page of a
+// subscription. Empty values clear the stored ones.
+func SetSubscriptionScrape(id int64, selector, pattern string) error {
+	res, err := DB.ExecContext(context.Background(), `UPDATE subscriptions SET html_selector = ?, html_pattern = ? WHERE id = ?`,
+		sql.NullString{String: selector, Valid: selector != ""}, sql.NullString{String: pattern, Valid: pattern != ""}, id)
+	if err != nil {
+		return fmt.Errorf("could not store HTML options of subscription %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no subscription with ID %d", id)
+	}
+	return nil
+}
+
+// SetSubscriptionImpersonate stores the browser a subscription is fetched as. An
+// empty name goes back to the default.
+func SetSubscriptionImpersonate(id int64, name string) error {
+	res, err := DB.ExecContext(context.Background(), `UPDATE subscriptions SET impersonate = ? WHERE id = ?`,
+		sql.NullString{String: name, Valid: name != ""}, id)
+	if err != nil {
+		return fmt.Errorf("could not store impersonation of subscription %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no subscription with ID %d", id)
+	}
+	return nil
+}
+
+// SetSubscriptionMirrors stores the mirrors of a subscription and whether they
+// are raced. No mirrors clear the stored ones along with the mirror last used.
+func SetSubscriptionMirrors(id int64, mirrors []string, race bool) error {
+	query := `UPDATE subscriptions SET mirrors = ?, race_mirrors = ? WHERE id = ?`
+	if len(mirrors) == 0 {
+		query = `UPDATE subscriptions SET mirrors = ?, race_mirrors = ?, fetched_from = NULL WHERE id = ?`
+	}
+	value := sql.NullString{String: strings.Join(mirrors, "\n"), Valid: len(mirrors) > 0}
+	res, err := DB.ExecContext(context.Background(), query, value, race, id)
+	if err != nil {
+		return fmt.Errorf("could not store mirrors of subscription %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no subscription with ID %d", id)
+	}
+	return nil
+}
+
+// SetSubscriptionExcludeRules stores the exclusion rules of a subscription. No
+// rules clear the stored ones.
+func SetSubscriptionExcludeRules(id int64, rules []string) error {
+	value := sql.NullString{String: strings.Join(rules, "\n"), Valid: len(rules) > 0}
+	res, err := DB.ExecContext(context.Background(), `UPDATE subscriptions SET exclude_rules = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return fmt.Errorf("could not store exclusion rules of subscription %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no subscription with ID %d", id)
+	}
+	return nil
+}
+
+// RecordFetchedFrom stores the URL or mirror a successful fetch of a subscription
+// got its payload from.
+func RecordFetchedFrom(id int64, fetchedFrom string) error {
+	if _, err := DB.ExecContext(context.Background(), `UPDATE subscriptions SET fetched_from = ? WHERE id = ?`, fetchedFrom, id); err != nil {
+		return fmt.Errorf("could not store where subscription %d was fetched from: %w", id, err)
+	}
+	return nil
+}
+
+// reownConfigsQuery hands configs to their source of the highest priority, the
+// first seen among equals, when it outranks the current owner. Append an AND
+// clause to pick the configs.
+const reownConfigsQuery = `
+		UPDATE subscription_configs SET subscription_id = (
+			SELECT cs.subscription_id FROM config_sources cs
+			JOIN subscriptions s ON s.id = cs.subscription_id
+			WHERE cs.config_id = subscription_configs.id
+			ORDER BY s.priority DESC, cs.first_seen_at, cs.subscription_id
+			LIMIT 1
+		)
+		WHERE EXISTS (
+			SELECT 1 FROM config_sources cs
+			JOIN subscriptions s ON s.id = cs.subscription_id
+			WHERE cs.config_id = subscription_configs.id
+			  AND s.priority > (SELECT priority FROM subscriptions WHERE id = subscription_configs.subscription_id)
+		)`
+
+// SetSubscriptionPriority changes the priority of a subscription and hands every
+// config it shares with other subscriptions to the highest-priority one of them.
+func SetSubscriptionPriority(id int64, priority int) error {
+	tx, err := DB.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(context.Background(), `UPDATE subscriptions SET priority = ? WHERE id = ?`, priority, id)
+	if err != nil {
+		return fmt.Errorf("could not set priority of subscription %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound("no subscription with ID %d", id)
+	}
+
+	reown := reownConfigsQuery + ` AND id IN (SELECT config_id FROM config_sources WHERE subscription_id = ?)`
+	if _, err := tx.ExecContext(context.Background(), reown, id); err != nil {
+		return fmt.Errorf("could not reassign configs of subscription %d: %w", id, err)
+	}
+	return tx.Commit()
+}
+
+// GetConfigPriorities maps the links of configs owned by a subscription with a
+// non-zero priority to that priority.
+func GetConfigPriorities() (map[string]int, error) {
+	var rows []struct {
+		ConfigLink string `db:"config_link"`
+		Priority   int    `db:"priority"`
+	}
+	query := `
+		SELECT sc.config_link, s.priority
+		FROM subscription_configs sc
+		JOIN subscriptions s ON s.id = sc.subscription_id
+		WHERE s.priority != 0`
+	if err := DB.SelectContext(context.Background(), &rows, query); err != nil {
+		return nil, fmt.Errorf("could not get config priorities: %w", err)
+	}
+	priorities := make(map[string]int, len(rows))
+	for _, r := range rows {
+		priorities[r.ConfigLink] = r.Priority
+	}
+	return priorities, nil
+}
+
+// RecordResolvedURL stores where a subscription's URL led on a successful fetch
+// and returns where it led the time before ("" if unknown).
+func RecordResolvedURL(id int64, resolved string) (string, error) {
+	tx, err := DB.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return "", fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	if err := tx.GetContext(context.Background(), &previous, `SELECT resolved_url FROM subscriptions WHERE id = ?`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", notFound("no subscription with ID %d", id)
+		}
+		return "", fmt.Errorf("could not get resolved URL of subscription %d: %w", id, err)
+	}
+	if _, err := tx.ExecContext(context.Background(), `UPDATE subscriptions SET resolved_url = ? WHERE id = ?`, resolved, id); err != nil {
+		return "", fmt.Errorf("could not store resolved URL of subscription %d: %w", id, err)
+	}
+	return previous.String, tx.Commit()
+}
+
+// DeleteSubscription deletes a subscription and the configs only it provided. Configs
+// that other subscriptions also carry are handed over to one of them.
 func DeleteSubscription(id int64) error {
-	query := `DELETE FROM subscriptions WHERE id = ?`
-	res, err := DB.ExecContext(context.Background(), query, id)
+	tx, err := DB.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	reassign := `
+		UPDATE subscription_configs SET subscription_id = (
+			SELECT MIN(cs.subscription_id) FROM config_sources cs
+			WHERE cs.config_id = subscription_configs.id AND cs.subscription_id != ?
+		)
+		WHERE subscription_id = ? AND EXISTS (
+			SELECT 1 FROM config_sources cs
+			WHERE cs.config_id = subscription_configs.id AND cs.subscription_id != ?
+		)`
+	if _, err := tx.ExecContext(context.Background(), reassign, id, id, id); err != nil {
+		return fmt.Errorf("could not reassign shared configs of subscription %d: %w", id, err)
+	}
+
+	res, err := tx.ExecContext(context.Background(), `DELETE FROM subscriptions WHERE id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("could not delete subscription with id %d: %w", id, err)
 	}
@@ -90,14 +458,14 @@ func DeleteSubscription(id int64) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("no subscription found with id %d", id)
+		return notFound("no subscription found with id %d", id)
 	}
-	return nil
+	return tx.Commit()
 }
 
 func ListSubscriptions() ([]Subscription, error) {
 	var subs []Subscription
-	query := `SELECT id, url, remark, user_agent, enabled, last_fetched_at, created_at FROM subscriptions ORDER BY id`
+	query := `SELECT id, url, remark, user_agent, enabled, last_fetched_at, created_at, test_url, expected_status, failure_count, last_error, auth, html_selector, html_pattern, impersonate, resolved_url, priority, skipped_configs, mirrors, race_mirrors, fetched_from, exclude_rules FROM subscriptions ORDER BY id`
 	err := DB.SelectContext(context.Background(), &subs, query)
 	if err != nil {
 		return nil, fmt.Errorf("could not list subscriptions: %w", err)
@@ -105,13 +473,27 @@ func ListSubscriptions() ([]Subscription, error) {
 	return subs, nil
 }
 
+// GetSubscriptionByURL returns the subscription with the given URL.
+func GetSubscriptionByURL(url string) (*Subscription, error) {
+	var sub Subscription
+	query := `SELECT id, url, remark, user_agent, enabled, last_fetched_at, created_at, test_url, expected_status, failure_count, last_error, auth, html_selector, html_pattern, impersonate, resolved_url, priority, skipped_configs, mirrors, race_mirrors, fetched_from, exclude_rules FROM subscriptions WHERE url = ?`
+	err := DB.GetContext(context.Background(), &sub, query, url)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notFound("no subscription found with url %s", url)
+		}
+		return nil, fmt.Errorf("could not get subscription: %w", err)
+	}
+	return &sub, nil
+}
+
 func GetSubscriptionByID(id int64) (*Subscription, error) {
 	var sub Subscription
-	query := `SELECT id, url, remark, user_agent, enabled, last_fetched_at, created_at FROM subscriptions WHERE id = ?`
+	query := `SELECT id, url, remark, user_agent, enabled, last_fetched_at, created_at, test_url, expected_status, failure_count, last_error, auth, html_selector, html_pattern, impersonate, resolved_url, priority, skipped_configs, mirrors, race_mirrors, fetched_from, exclude_rules FROM subscriptions WHERE id = ?`
 	err := DB.GetContext(context.Background(), &sub, query, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("no subscription found with id %d", id)
+			return nil, notFound("no subscription found with id %d", id)
 		}
 		return nil, fmt.Errorf("could not get subscription: %w", err)
 	}
@@ -119,17 +501,49 @@ func GetSubscriptionByID(id int64) (*Subscription, error) {
 }
 
 func UpdateSubscriptionFetched(id int64, fetchTime time.Time) error {
-	query := `UPDATE subscriptions SET last_fetched_at = ? WHERE id = ?`
-	_, err := DB.ExecContext(context.Background(), query, fetchTime, id)
+	_, err := DB.ExecContext(context.Background(), markFetchedQuery, fetchTime, id)
 	return err
 }
 
+// markFetchedQuery records a successful fetch, which also ends any failure streak.
+const markFetchedQuery = `UPDATE subscriptions SET last_fetched_at = ?, failure_count = 0, last_error = NULL WHERE id = ?`
+
+// RecordSubscriptionFailure increments the failure streak of a subscription. Once the
+// streak reaches disableAfter (if > 0), the subscription is disabled. It returns the
+// new streak and whether this call disabled the subscription.
+func RecordSubscriptionFailure(id int64, fetchErr string, disableAfter int) (int, bool, error) {
+	tx, err := DB.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var streak int
+	var enabled bool
+	err = tx.QueryRowxContext(context.Background(),
+		`UPDATE subscriptions SET failure_count = failure_count + 1, last_error = ? WHERE id = ? RETURNING failure_count, enabled`,
+		fetchErr, id).Scan(&streak, &enabled)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not record failure for subscription %d: %w", id, err)
+	}
+
+	disabled := false
+	if disableAfter > 0 && streak >= disableAfter && enabled {
+		if _, err := tx.ExecContext(context.Background(), `UPDATE subscriptions SET enabled = 0 WHERE id = ?`, id); err != nil {
+			return 0, false, fmt.Errorf("could not disable subscription %d: %w", id, err)
+		}
+		disabled = true
+	}
+	return streak, disabled, tx.Commit()
+}
+
 func UpdateSubscription(id int64, urlVal, remark, userAgent *string, enabled *bool) error {
 	setClauses := []string{}
 	args := []interface{}{}
 
 	if urlVal != nil {
-		setClauses = append(setClauses, "url = ?")
+		// A new URL leads somewhere else; don't compare it with where the old one went.
+		setClauses = append(setClauses, "url = ?", "resolved_url = NULL", "fetched_from = NULL")
 		args = append(args, *urlVal)
 	}
 	if remark != nil {
@@ -151,6 +565,10 @@ func UpdateSubscription(id int64, urlVal, remark, userAgent *string, enabled *bo
 	if enabled != nil {
 		setClauses = append(setClauses, "enabled = ?")
 		args = append(args, *enabled)
+		// Re-enabling gives the subscription a fresh start.
+		if *enabled {
+			setClauses = append(setClauses, "failure_count = 0")
+		}
 	}
 
 	if len(setClauses) == 0 {
@@ -169,22 +587,71 @@ func UpdateSubscription(id int64, urlVal, remark, userAgent *string, enabled *bo
 		return err
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("no subscription found with id %d", id)
+		return notFound("no subscription found with id %d", id)
+	}
+	return nil
+}
+
+// SetSubscriptionTestTarget sets the test URL and expected status used for all
+// configs of a subscription. An empty URL and zero status clear the override.
+func SetSubscriptionTestTarget(id int64, testURL string, expectedStatus int) error {
+	query := `UPDATE subscriptions SET test_url = ?, expected_status = ? WHERE id = ?`
+	res, err := DB.ExecContext(context.Background(), query,
+		sql.NullString{String: testURL, Valid: testURL != ""},
+		sql.NullInt64{Int64: int64(expectedStatus), Valid: expectedStatus != 0},
+		id)
+	if err != nil {
+		return fmt.Errorf("could not set test target for subscription %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("no subscription found with id %d", id)
 	}
 	return nil
 }
 
+// selectSubscriptionConfigs selects configs together with their sources.
+const selectSubscriptionConfigs = `SELECT id, subscription_id, config_link, protocol, remark, added_at, last_seen_at, test_url, expected_status,
+		dedup_key, parse_error, parse_error_detail, notes, metadata, enabled, alias,
+		(SELECT GROUP_CONCAT(subscription_id) FROM (SELECT subscription_id FROM config_sources WHERE config_id = subscription_configs.id ORDER BY subscription_id)) AS sources
+		FROM subscription_configs`
+
+// configSourceFilter restricts a subscription_configs query to configs seen in a subscription.
+const configSourceFilter = " AND id IN (SELECT config_id FROM config_sources WHERE subscription_id = ?)"
+
 func ListSubscriptionConfigs(subID int64, protocol string, limit int) ([]SubscriptionConfig, error) {
-	query := `SELECT id, subscription_id, config_link, protocol, remark, added_at, last_seen_at FROM subscription_configs WHERE 1=1`
+	return listSubscriptionConfigs(subID, protocol, false, limit)
+}
+
+// ListUnparsedConfigs lists the stored configs whose links could not be parsed,
+// optionally only those of one error class.
+func ListUnparsedConfigs(subID int64, class string, limit int) ([]SubscriptionConfig, error) {
+	return listSubscriptionConfigs(subID, class, true, limit)
+}
+
+// listSubscriptionConfigs lists configs filtered by protocol, or by parse error class
+// when unparsed is set.
+func listSubscriptionConfigs(subID int64, filter string, unparsed bool, limit int) ([]SubscriptionConfig, error) {
+	query := selectSubscriptionConfigs + ` WHERE 1=1`
 	args := []interface{}{}
 
 	if subID > 0 {
-		query += " AND subscription_id = ?"
+		query += configSourceFilter
 		args = append(args, subID)
 	}
-	if protocol != "" {
+	switch {
+	case unparsed:
+		query += " AND parse_error IS NOT NULL"
+		if filter != "" {
+			query += " AND parse_error = ?"
+			args = append(args, filter)
+		}
+	case filter != "":
 		query += " AND protocol = ?"
-		args = append(args, protocol)
+		args = append(args, filter)
 	}
 
 	query += " ORDER BY last_seen_at DESC"
@@ -202,12 +669,65 @@ func ListSubscriptionConfigs(subID int64, protocol string, limit int) ([]Subscri
 	return configs, nil
 }
 
+// CountParseErrors returns how many stored configs failed to parse, per error class.
+func CountParseErrors(subID int64) (map[string]int, error) {
+	query := `SELECT parse_error, COUNT(*) AS n FROM subscription_configs WHERE parse_error IS NOT NULL`
+	args := []interface{}{}
+	if subID > 0 {
+		query += configSourceFilter
+		args = append(args, subID)
+	}
+	query += " GROUP BY parse_error"
+
+	var rows []struct {
+		Class string `db:"parse_error"`
+		N     int    `db:"n"`
+	}
+	if err := DB.SelectContext(context.Background(), &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("could not count parse errors: %w", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.Class] = r.N
+	}
+	return counts, nil
+}
+
+// GetSubscriptionConfig returns a single stored config with its sources.
+func GetSubscriptionConfig(id int64) (*SubscriptionConfig, error) {
+	var config SubscriptionConfig
+	err := DB.GetContext(context.Background(), &config, selectSubscriptionConfigs+` WHERE id = ?`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notFound("no config found with id %d", id)
+		}
+		return nil, fmt.Errorf("could not get config %d: %w", id, err)
+	}
+	return &config, nil
+}
+
+// SetConfigNotes replaces the notes and metadata of a config; NULL values clear them.
+func SetConfigNotes(id int64, notes, metadata sql.NullString) error {
+	res, err := DB.ExecContext(context.Background(), `UPDATE subscription_configs SET notes = ?, metadata = ? WHERE id = ?`, notes, metadata, id)
+	if err != nil {
+		return fmt.Errorf("could not update notes of config %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("no config found with id %d", id)
+	}
+	return nil
+}
+
 func CountSubscriptionConfigs(subID int64) (int, error) {
 	query := `SELECT COUNT(*) FROM subscription_configs WHERE 1=1`
 	args := []interface{}{}
 
 	if subID > 0 {
-		query += " AND subscription_id = ?"
+		query += configSourceFilter
 		args = append(args, subID)
 	}
 
@@ -219,8 +739,201 @@ func CountSubscriptionConfigs(subID int64) (int, error) {
 	return count, nil
 }
 
+// Subscription Snapshots
+
+// SaveSubscriptionSnapshot stores a snapshot, unless it has the same content as the
+// subscription's latest one, whose LastSeenAt is then updated. It reports whether a
+// new snapshot was stored.
+func SaveSubscriptionSnapshot(s SubscriptionSnapshot) (bool, error) {
+	ctx := context.Background()
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var latest struct {
+		ID     int64  `db:"id"`
+		SHA256 string `db:"sha256"`
+	}
+	err = tx.GetContext(ctx, &latest, `SELECT id, sha256 FROM subscription_snapshots WHERE subscription_id = ? ORDER BY fetched_at DESC, id DESC LIMIT 1`, s.SubscriptionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("could not look up latest snapshot of subscription %d: %w", s.SubscriptionID, err)
+	}
+
+	stored := false
+	if err == nil && latest.SHA256 == s.SHA256 {
+		_, err = tx.ExecContext(ctx, `UPDATE subscription_snapshots SET last_seen_at = ? WHERE id = ?`, s.LastSeenAt, latest.ID)
+	} else {
+		_, err = tx.NamedExecContext(ctx, `INSERT INTO subscription_snapshots (subscription_id, fetched_at, last_seen_at, sha256, size, links, payload)
+			VALUES (:subscription_id, :fetched_at, :last_seen_at, :sha256, :size, :links, :payload)`, s)
+		stored = true
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not save snapshot of subscription %d: %w", s.SubscriptionID, err)
+	}
+	return stored, tx.Commit()
+}
+
+// PruneSubscriptionSnapshots deletes the snapshots of a subscription beyond the keep
+// most recent ones, and those last seen before olderThan when it is not zero. The
+// latest snapshot is always kept. It returns how many snapshots were deleted.
+func PruneSubscriptionSnapshots(subID int64, keep int, olderThan time.Time) (int64, error) {
+	query := `DELETE FROM subscription_snapshots WHERE subscription_id = ?
+		AND id != (SELECT id FROM subscription_snapshots WHERE subscription_id = ? ORDER BY fetched_at DESC, id DESC LIMIT 1)
+		AND (id NOT IN (SELECT id FROM subscription_snapshots WHERE subscription_id = ? ORDER BY fetched_at DESC, id DESC LIMIT ?)`
+	args := []interface{}{subID, subID, subID, keep}
+	if !olderThan.IsZero() {
+		query += ` OR last_seen_at < ?`
+		args = append(args, olderThan.UTC())
+	}
+	query += `)`
+
+	res, err := DB.ExecContext(context.Background(), query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not prune snapshots of subscription %d: %w", subID, err)
+	}
+	return res.RowsAffected()
+}
+
+// ListSubscriptionSnapshots lists the snapshots of a subscription, oldest first,
+// without their payloads.
+func ListSubscriptionSnapshots(subID int64) ([]SubscriptionSnapshot, error) {
+	var snapshots []SubscriptionSnapshot
+	err := DB.SelectContext(context.Background(), &snapshots, `SELECT id, subscription_id, fetched_at, last_seen_at, sha256, size, links
+		FROM subscription_snapshots WHERE subscription_id = ? ORDER BY fetched_at, id`, subID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list snapshots of subscription %d: %w", subID, err)
+	}
+	return snapshots, nil
+}
+
+// GetSubscriptionSnapshot returns a snapshot by ID, or when id is 0, the subscription's
+// snapshot that was current at the given time (the latest one when at is zero).
+func GetSubscriptionSnapshot(subID, id int64, at time.Time) (*SubscriptionSnapshot, error) {
+	query := `SELECT * FROM subscription_snapshots WHERE subscription_id = ?`
+	args := []interface{}{subID}
+	switch {
+	case id != 0:
+		query += ` AND id = ?`
+		args = append(args, id)
+	case !at.IsZero():
+		query += ` AND fetched_at <= ?`
+		args = append(args, at.UTC())
+	}
+	query += ` ORDER BY fetched_at DESC, id DESC LIMIT 1`
+
+	var s SubscriptionSnapshot
+	if err := DB.GetContext(context.Background(), &s, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if id != 0 {
+				return nil, notFound("no snapshot %d of subscription %d", id, subID)
+			}
+			if !at.IsZero() {
+				return nil, notFound("subscription %d has no snapshot from before %s", subID, at.Format("2006-01-02 15:04"))
+			}
+			return nil, notFound("subscription %d has no snapshots", subID)
+		}
+		return nil, fmt.Errorf("could not get snapshot of subscription %d: %w", subID, err)
+	}
+	return &s, nil
+}
+
+// CountConfigsMatching counts the stored configs matching a filter.
+func CountConfigsMatching(filter *ConfigFilter) (int, error) {
+	var count int
+	err := DB.GetContext(context.Background(), &count, `SELECT COUNT(*) FROM subscription_configs WHERE `+filter.SQL, filter.Args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not count matching configs: %w", err)
+	}
+	return count, nil
+}
+
+// ListConfigsMatching lists up to limit stored configs matching a filter, skipping
+// the first offset ones.
+func ListConfigsMatching(filter *ConfigFilter, limit, offset int) ([]SubscriptionConfig, error) {
+	query := selectSubscriptionConfigs + ` WHERE ` + filter.SQL + ` ORDER BY id`
+	args := append([]interface{}{}, filter.Args...)
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+	var configs []SubscriptionConfig
+	if err := DB.SelectContext(context.Background(), &configs, query, args...); err != nil {
+		return nil, fmt.Errorf("could not list matching configs: %w", err)
+	}
+	return configs, nil
+}
+
+// SetConfigsEnabled enables or disables every config matching a filter and returns
+// how many changed state.
+func SetConfigsEnabled(filter *ConfigFilter, enabled bool) (int64, error) {
+	query := `UPDATE subscription_configs SET enabled = ? WHERE enabled != ? AND (` + filter.SQL + `)`
+	args := append([]interface{}{enabled, enabled}, filter.Args...)
+	res, err := DB.ExecContext(context.Background(), query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not update matching configs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
 // Subscription Configs
 
+// subscription_id keeps the subscription of the highest priority a config was seen
+// in, the first one among equals; every source is tracked in config_sources.
+const upsertSubscriptionConfigQuery = `
+		INSERT INTO subscription_configs (subscription_id, config_link, protocol, remark, last_seen_at, dedup_key, parse_error, parse_error_detail) 
+		VALUES (:subscription_id, :config_link, :protocol, :remark, :last_seen_at, :dedup_key, :parse_error, :parse_error_detail)
+		ON CONFLICT(config_link) DO UPDATE SET 
+			last_seen_at = excluded.last_seen_at,
+			subscription_id = CASE
+				WHEN (SELECT priority FROM subscriptions WHERE id = excluded.subscription_id) >
+				     (SELECT priority FROM subscriptions WHERE id = subscription_configs.subscription_id)
+				THEN excluded.subscription_id
+				ELSE COALESCE(subscription_configs.subscription_id, excluded.subscription_id)
+			END,
+			remark = excluded.remark,
+			protocol = excluded.protocol,
+			parse_error = excluded.parse_error,
+			parse_error_detail = excluded.parse_error_detail,
+			dedup_key = COALESCE(subscription_configs.dedup_key, excluded.dedup_key)
+		RETURNING id
+	`
+
+// touchDuplicateConfigQuery refreshes a stored config that another link resolved to.
+const touchDuplicateConfigQuery = `
+		UPDATE subscription_configs SET
+			last_seen_at = ?,
+			subscription_id = COALESCE(subscription_id, ?)
+		WHERE id = ?
+	`
+
+// ownsConfigQuery reports whether a subscription owns a config or has a higher
+// priority than its owner.
+const ownsConfigQuery = `
+		SELECT COALESCE(sc.subscription_id = s.id OR s.priority > owner.priority, 0)
+		FROM subscription_configs sc, subscriptions s
+		LEFT JOIN subscriptions owner ON owner.id = sc.subscription_id
+		WHERE s.id = ? AND sc.id = ?
+	`
+
+// takeOverDuplicateConfigQuery stores the link and remark a config's owner, or a
+// subscription outranking it, carries the config under.
+const takeOverDuplicateConfigQuery = `
+		UPDATE subscription_configs SET
+			last_seen_at = :last_seen_at,
+			subscription_id = :subscription_id,
+			config_link = :config_link,
+			remark = :remark,
+			protocol = :protocol
+		WHERE id = :id
+	`
+
+const upsertConfigSourceQuery = `
+		INSERT INTO config_sources (config_id, subscription_id, last_seen_at) VALUES (?, ?, ?)
+		ON CONFLICT(config_id, subscription_id) DO UPDATE SET last_seen_at = excluded.last_seen_at
+	`
+
 func UpsertSubscriptionConfigs(configs []SubscriptionConfig) error {
 	tx, err := DB.BeginTxx(context.Background(), nil)
 	if err != nil {
@@ -228,35 +941,242 @@ func UpsertSubscriptionConfigs(configs []SubscriptionConfig) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareNamedContext(context.Background(), `
-		INSERT INTO subscription_configs (subscription_id, config_link, protocol, remark, last_seen_at) 
-		VALUES (:subscription_id, :config_link, :protocol, :remark, :last_seen_at)
-		ON CONFLICT(config_link) DO UPDATE SET 
-			last_seen_at = excluded.last_seen_at,
-			subscription_id = COALESCE(excluded.subscription_id, subscription_configs.subscription_id),
-			remark = excluded.remark,
-			protocol = excluded.protocol
-	`)
+	if err := upsertSubscriptionConfigsTx(tx, configs); err != nil {
+		return err
+	}
+	if err := assignAliasesTx(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsertSubscriptionConfigsTx upserts configs inside an existing transaction. A config
+// whose dedup key matches a stored config (the same server under another remark) is
+// merged into that row instead of creating a duplicate, and its subscription is
+// recorded as an additional source. When that subscription owns the row or has a
+// higher priority than its owner, it (becomes the owner and) its link wins.
+func upsertSubscriptionConfigsTx(tx *sqlx.Tx, configs []SubscriptionConfig) error {
+	ctx := context.Background()
+	stmt, err := tx.PrepareNamedContext(ctx, upsertSubscriptionConfigQuery)
 	if err != nil {
 		return fmt.Errorf("could not prepare named statement: %w", err)
 	}
 	defer stmt.Close()
 
 	for _, config := range configs {
-		if _, err := stmt.ExecContext(context.Background(), config); err != nil {
+		var id int64
+		if config.DedupKey.Valid {
+			err := tx.GetContext(ctx, &id, `SELECT id FROM subscription_configs WHERE dedup_key = ?`, config.DedupKey.String)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("failed to look up duplicate of config %s: %w", config.ConfigLink, err)
+			}
+		}
+
+		if id != 0 {
+			var owns bool
+			if config.SubscriptionID.Valid {
+				if err := tx.GetContext(ctx, &owns, ownsConfigQuery, config.SubscriptionID.Int64, id); err != nil {
+					return fmt.Errorf("failed to compare sources of config %s: %w", config.ConfigLink, err)
+				}
+			}
+			if owns {
+				// Another row may still hold this link under an older dedup key
+				// (or none); it is the same config, so fold it in first.
+				var other int64
+				err := tx.GetContext(ctx, &other, `SELECT id FROM subscription_configs WHERE config_link = ? AND id != ?`, config.ConfigLink, id)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("failed to look up config %s: %w", config.ConfigLink, err)
+				}
+				if other != 0 {
+					if err := mergeConfigTx(tx, other, id); err != nil {
+						return err
+					}
+				}
+				config.ID = id
+				if _, err := tx.NamedExecContext(ctx, takeOverDuplicateConfigQuery, config); err != nil {
+					return fmt.Errorf("failed to update duplicate of config %s: %w", config.ConfigLink, err)
+				}
+			} else if _, err := tx.ExecContext(ctx, touchDuplicateConfigQuery, config.LastSeenAt, config.SubscriptionID, id); err != nil {
+				return fmt.Errorf("failed to update duplicate of config %s: %w", config.ConfigLink, err)
+			}
+		} else if err := stmt.GetContext(ctx, &id, config); err != nil {
 			return fmt.Errorf("failed to execute upsert for config %s: %w", config.ConfigLink, err)
 		}
+
+		if config.SubscriptionID.Valid {
+			if _, err := tx.ExecContext(ctx, upsertConfigSourceQuery, id, config.SubscriptionID.Int64, config.LastSeenAt); err != nil {
+				return fmt.Errorf("failed to record source of config %s: %w", config.ConfigLink, err)
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateParsedConfigs stores re-parsed metadata (protocol, remark, parse error and
+// dedup key) of existing configs. A config whose new dedup key belongs to another
+// stored config is merged into it: its sources move over and the row is removed.
+// It returns how many configs were merged.
+func UpdateParsedConfigs(configs []SubscriptionConfig) (int, error) {
+	ctx := context.Background()
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	merged := 0
+	for _, config := range configs {
+		var dupID int64
+		if config.DedupKey.Valid {
+			err := tx.GetContext(ctx, &dupID, `SELECT id FROM subscription_configs WHERE dedup_key = ? AND id != ?`, config.DedupKey.String, config.ID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return 0, fmt.Errorf("failed to look up duplicate of config %d: %w", config.ID, err)
+			}
+		}
+
+		if dupID != 0 {
+			if err := mergeConfigTx(tx, config.ID, dupID); err != nil {
+				return 0, err
+			}
+			merged++
+			continue
+		}
+
+		_, err := tx.NamedExecContext(ctx, `UPDATE subscription_configs SET
+			protocol = :protocol, remark = :remark, dedup_key = :dedup_key,
+			parse_error = :parse_error, parse_error_detail = :parse_error_detail
+			WHERE id = :id`, config)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update config %d: %w", config.ID, err)
+		}
 	}
+	return merged, tx.Commit()
+}
 
+// mergeConfigTx folds config id into its duplicate dupID and deletes it.
+func mergeConfigTx(tx *sqlx.Tx, id, dupID int64) error {
+	ctx := context.Background()
+	moveSources := `
+		INSERT INTO config_sources (config_id, subscription_id, first_seen_at, last_seen_at)
+		SELECT ?, subscription_id, first_seen_at, last_seen_at FROM config_sources WHERE config_id = ?
+		ON CONFLICT(config_id, subscription_id) DO UPDATE SET
+			first_seen_at = MIN(config_sources.first_seen_at, excluded.first_seen_at),
+			last_seen_at = COALESCE(MAX(config_sources.last_seen_at, excluded.last_seen_at), config_sources.last_seen_at, excluded.last_seen_at)`
+	if _, err := tx.ExecContext(ctx, moveSources, dupID, id); err != nil {
+		return fmt.Errorf("failed to move sources of config %d: %w", id, err)
+	}
+	// The surviving row keeps its own notes, metadata fields and test target, filling
+	// gaps from the merged one, and stays disabled if either was.
+	touch := `
+		UPDATE subscription_configs SET
+			last_seen_at = COALESCE(MAX(subscription_configs.last_seen_at, old.last_seen_at), subscription_configs.last_seen_at, old.last_seen_at),
+			subscription_id = COALESCE(subscription_configs.subscription_id, old.subscription_id),
+			notes = COALESCE(subscription_configs.notes, old.notes),
+			metadata = COALESCE(json_patch(old.metadata, subscription_configs.metadata), subscription_configs.metadata, old.metadata),
+			test_url = COALESCE(subscription_configs.test_url, old.test_url),
+			expected_status = COALESCE(subscription_configs.expected_status, old.expected_status),
+			enabled = MIN(subscription_configs.enabled, old.enabled)
+		FROM (SELECT last_seen_at, subscription_id, notes, metadata, test_url, expected_status, enabled FROM subscription_configs WHERE id = ?) AS old
+		WHERE subscription_configs.id = ?`
+	if _, err := tx.ExecContext(ctx, touch, id, dupID); err != nil {
+		return fmt.Errorf("failed to merge config %d into %d: %w", id, dupID, err)
+	}
+	if _, err := tx.ExecContext(ctx, reownConfigsQuery+` AND id = ?`, dupID); err != nil {
+		return fmt.Errorf("failed to pick the owner of config %d: %w", dupID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE config_group_members SET config_id = ? WHERE config_id = ?`, dupID, id); err != nil {
+		return fmt.Errorf("failed to move group memberships of config %d: %w", id, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM subscription_configs WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete merged config %d: %w", id, err)
+	}
+	return nil
+}
+
+// BackfillDedupKeys computes the dedup key of every stored config still without
+// one. A config whose key another config already has is merged into it.
+func BackfillDedupKeys() error {
+	ctx := context.Background()
+	tx, err := DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var configs []struct {
+		ID         int64  `db:"id"`
+		ConfigLink string `db:"config_link"`
+	}
+	if err := tx.SelectContext(ctx, &configs, `SELECT id, config_link FROM subscription_configs WHERE dedup_key IS NULL ORDER BY id`); err != nil {
+		return fmt.Errorf("could not list configs without a dedup key: %w", err)
+	}
+	for _, config := range configs {
+		key := utils.ConfigDedupKey(config.ConfigLink)
+		var dupID int64
+		err := tx.GetContext(ctx, &dupID, `SELECT id FROM subscription_configs WHERE dedup_key = ?`, key)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to look up duplicate of config %d: %w", config.ID, err)
+		}
+		if dupID != 0 {
+			if err := mergeConfigTx(tx, config.ID, dupID); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE subscription_configs SET dedup_key = ? WHERE id = ?`, key, config.ID); err != nil {
+			return fmt.Errorf("failed to set dedup key of config %d: %w", config.ID, err)
+		}
+	}
 	return tx.Commit()
 }
 
+// SetConfigTestTarget sets the test URL and expected status for a single config.
+// An empty URL and zero status clear the override.
+func SetConfigTestTarget(id int64, testURL string, expectedStatus int) error {
+	query := `UPDATE subscription_configs SET test_url = ?, expected_status = ? WHERE id = ?`
+	res, err := DB.ExecContext(context.Background(), query,
+		sql.NullString{String: testURL, Valid: testURL != ""},
+		sql.NullInt64{Int64: int64(expectedStatus), Valid: expectedStatus != 0},
+		id)
+	if err != nil {
+		return fmt.Errorf("could not set test target for config %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("no config found with id %d", id)
+	}
+	return nil
+}
+
+// GetTestTargets returns the effective test destination of every config that has an
+// override, either on the config itself or inherited from its subscription.
+func GetTestTargets() ([]TestTarget, error) {
+	query := `
+		SELECT sc.config_link,
+		       COALESCE(sc.test_url, s.test_url, '') AS test_url,
+		       COALESCE(sc.expected_status, s.expected_status, 0) AS expected_status
+		FROM subscription_configs sc
+		LEFT JOIN subscriptions s ON sc.subscription_id = s.id
+		WHERE sc.test_url IS NOT NULL OR sc.expected_status IS NOT NULL
+		   OR s.test_url IS NOT NULL OR s.expected_status IS NOT NULL
+	`
+	var targets []TestTarget
+	err := DB.SelectContext(context.Background(), &targets, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not get test targets: %w", err)
+	}
+	return targets, nil
+}
+
 func GetConfigsFromDB(subID int64, protocol string, limit int) ([]string, error) {
-	query := `SELECT config_link FROM subscription_configs WHERE 1=1`
+	query := `SELECT config_link FROM subscription_configs WHERE enabled = 1`
 	args := []interface{}{}
 
 	if subID > 0 {
-		query += " AND subscription_id = ?"
+		query += configSourceFilter
 		args = append(args, subID)
 	}
 	if protocol != "" {
@@ -284,8 +1204,9 @@ func GetConfigsForProxy() ([]string, error) {
 	query := `
 		SELECT DISTINCT sc.config_link 
 		FROM subscription_configs sc
-		JOIN subscriptions s ON sc.subscription_id = s.id
-		WHERE s.enabled = 1
+		JOIN config_sources cs ON cs.config_id = sc.id
+		JOIN subscriptions s ON cs.subscription_id = s.id
+		WHERE s.enabled = 1 AND sc.enabled = 1
 	`
 	var links []string
 	err := DB.SelectContext(context.Background(), &links, query)
@@ -318,8 +1239,8 @@ func InsertHttpTestResultsBatch(runID int64, results []HttpTestResult) error {
 	defer tx.Rollback()
 
 	stmt, err := tx.PrepareNamedContext(context.Background(), `
-        INSERT INTO http_test_results (run_id, config_link, status, reason, delay_ms, download_mbps, upload_mbps, ip_address, ip_location, ttfb_ms, connect_time_ms)
-        VALUES (:run_id, :config_link, :status, :reason, :delay_ms, :download_mbps, :upload_mbps, :ip_address, :ip_location, :ttfb_ms, :connect_time_ms)
+        INSERT INTO http_test_results (run_id, config_link, status, reason, delay_ms, download_mbps, upload_mbps, ip_address, ip_location, ttfb_ms, connect_time_ms, warm_delay_ms, udp, nat_type, smtp, p2p, leaks, cert_issuer, cert_sans, cert_expires, cert_warnings, failure, block_signal, mutation, mutated_link)
+        VALUES (:run_id, :config_link, :status, :reason, :delay_ms, :download_mbps, :upload_mbps, :ip_address, :ip_location, :ttfb_ms, :connect_time_ms, :warm_delay_ms, :udp, :nat_type, :smtp, :p2p, :leaks, :cert_issuer, :cert_sans, :cert_expires, :cert_warnings, :failure, :block_signal, :mutation, :mutated_link)
     `)
 	if err != nil {
 		return fmt.Errorf("could not prepare named statement for http_test_results: %w", err)
@@ -355,6 +1276,119 @@ func GetHttpTestHistory(limit int) ([]HttpTestResult, error) {
 	return results, nil
 }
 
+// GetPassedHttpTestResults returns the passed results of a test run (the latest one when
+// runID is 0), configs of higher-priority subscriptions first and fastest first among
+// equals. A non-zero subID keeps only configs seen in that subscription.
+func GetPassedHttpTestResults(runID, subID int64) ([]HttpTestResult, error) {
+	query := `SELECT * FROM http_test_results WHERE status = 'passed'`
+	args := []interface{}{}
+
+	if runID > 0 {
+		query += " AND run_id = ?"
+		args = append(args, runID)
+	} else {
+		query += " AND run_id = (SELECT id FROM http_test_runs ORDER BY start_time DESC LIMIT 1)"
+	}
+	if subID > 0 {
+		query += ` AND config_link IN (
+			SELECT sc.config_link FROM subscription_configs sc
+			JOIN config_sources cs ON cs.config_id = sc.id
+			WHERE cs.subscription_id = ?)`
+		args = append(args, subID)
+	}
+	query += ` ORDER BY COALESCE((
+			SELECT s.priority FROM subscription_configs sc JOIN subscriptions s ON s.id = sc.subscription_id
+			WHERE sc.config_link = http_test_results.config_link), 0) DESC, delay_ms ASC`
+
+	var results []HttpTestResult
+	if err := DB.SelectContext(context.Background(), &results, query, args...); err != nil {
+		return nil, fmt.Errorf("could not get passed http test results: %w", err)
+	}
+	return results, nil
+}
+
+// ListHttpTestRuns returns the most recent test runs, newest first.
+func ListHttpTestRuns(limit int) ([]HttpTestRunSummary, error) {
+	query := `
+        SELECT r.*,
+               COUNT(res.id) AS results,
+               COUNT(CASE WHEN res.status IN ('passed', 'semi-passed') THEN 1 END) AS passed
+        FROM http_test_runs r
+        LEFT JOIN http_test_results res ON res.run_id = r.id
+        GROUP BY r.id
+        ORDER BY r.id DESC
+        LIMIT ?
+    `
+	var runs []HttpTestRunSummary
+	if err := DB.SelectContext(context.Background(), &runs, query, limit); err != nil {
+		return nil, fmt.Errorf("could not list http test runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetHttpTestResults returns every result stored for a test run.
+func GetHttpTestResults(runID int64) ([]HttpTestResult, error) {
+	var exists bool
+	if err := DB.GetContext(context.Background(), &exists, `SELECT EXISTS(SELECT 1 FROM http_test_runs WHERE id = ?)`, runID); err != nil {
+		return nil, fmt.Errorf("could not look up http test run %d: %w", runID, err)
+	}
+	if !exists {
+		return nil, notFound("no http test run with ID %d", runID)
+	}
+
+	var results []HttpTestResult
+	if err := DB.SelectContext(context.Background(), &results, `SELECT * FROM http_test_results WHERE run_id = ? ORDER BY id`, runID); err != nil {
+		return nil, fmt.Errorf("could not get results of http test run %d: %w", runID, err)
+	}
+	return results, nil
+}
+
+// GetRecentHttpTestResults returns the results of the last runs test runs, newest
+// first, each with the start time of its run. A non-zero subID keeps only configs
+// seen in that subscription.
+func GetRecentHttpTestResults(runs int, subID int64) ([]TimedHttpTestResult, error) {
+	query := `
+        SELECT res.*, r.start_time AS tested_at
+        FROM http_test_results res
+        JOIN http_test_runs r ON r.id = res.run_id
+        WHERE res.run_id IN (SELECT id FROM http_test_runs ORDER BY id DESC LIMIT ?)`
+	args := []interface{}{runs}
+	if subID > 0 {
+		query += ` AND res.config_link IN (
+			SELECT sc.config_link FROM subscription_configs sc
+			JOIN config_sources cs ON cs.config_id = sc.id
+			WHERE cs.subscription_id = ?)`
+		args = append(args, subID)
+	}
+	query += " ORDER BY res.run_id DESC, res.id"
+
+	var results []TimedHttpTestResult
+	if err := DB.SelectContext(context.Background(), &results, query, args...); err != nil {
+		return nil, fmt.Errorf("could not get recent http test results: %w", err)
+	}
+	return results, nil
+}
+
+// GetLatestCertResult returns the newest test result of configLink that inspected
+// its server's certificate, with the start time of its run, or nil when none did.
+func GetLatestCertResult(configLink string) (*TimedHttpTestResult, error) {
+	var result TimedHttpTestResult
+	err := DB.GetContext(context.Background(), &result, `
+        SELECT res.*, r.start_time AS tested_at
+        FROM http_test_results res
+        JOIN http_test_runs r ON r.id = res.run_id
+        WHERE res.config_link = ? AND res.cert_issuer != ''
+        ORDER BY res.run_id DESC, res.id DESC
+        LIMIT 1`, configLink)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get the certificate of the config: %w", err)
+	}
+	return &result, nil
+}
+
 // CF Scanner //
 
 func UpsertCfScanResultsBatch(results []CfScanResult) error {
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// secretKeyFile is the name of the key that encrypts secrets stored in the
+// database. It lives next to the database file, readable by its owner only, so
+// a copied or leaked database alone doesn't reveal subscription credentials.
+const secretKeyFile = "secret.key"
+
+// secretPrefix marks values encrypted with the secret key (AES-256-GCM).
+const secretPrefix = "v1:"
+
+var (
+	secretMu      sync.Mutex
+	secretKeyPath string // set by InitDB
+	secretKey     []byte
+)
+
+// setSecretKeyPath points the secret key at the directory of the database.
+func setSecretKeyPath(dbPath string) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretKeyPath = filepath.Join(filepath.Dir(dbPath), secretKeyFile)
+	secretKey = nil
+}
+
+// loadSecretKey reads the secret key, creating it on first use.
+func loadSecretKey() ([]byte, error) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	if secretKey != nil {
+		return secretKey, nil
+	}
+	if secretKeyPath == "" {
+		return nil, errors.New("database is not initialized")
+	}
+
+	key, err := os.ReadFile(secretKeyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = createSecretKey(secretKeyPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret key %s is corrupt (%d bytes, want 32)", secretKeyPath, len(key))
+	}
+	secretKey = key
+	return key, nil
+}
+
+// createSecretKey writes a new random key to path. If another process created
+// the key meanwhile, that one is used.
+func createSecretKey(path string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("could not generate secret key: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(key)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return key, nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret seals plaintext with the secret key.
+func encryptSecret(plaintext []byte) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a value sealed by encryptSecret.
+func decryptSecret(value string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(value, secretPrefix)
+	if !ok {
+		return nil, errors.New("unknown secret format")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt secret: %w", err)
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("corrupt secret: too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt secret, was %s replaced? %w", secretKeyFile, err)
+	}
+	return plaintext, nil
+}
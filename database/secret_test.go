@@ -0,0 +1,73 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSubscriptionAuthEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitDB(filepath.Join(dir, "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := AddSubscription("https://example.com/sub", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := GetSubscriptionByURL("https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth, err := sub.Credentials(); err != nil || !auth.IsZero() {
+		t.Errorf("credentials of a public subscription = %+v, %v", auth, err)
+	}
+
+	want := SubscriptionAuth{Headers: map[string]string{"Authorization": "Bearer s3cret"}, Username: "me", Password: "pw"}
+	if err := SetSubscriptionAuth(sub.ID, want); err != nil {
+		t.Fatal(err)
+	}
+	sub, err = GetSubscriptionByID(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sub.Auth.String, "s3cret") || !strings.HasPrefix(sub.Auth.String, secretPrefix) {
+		t.Errorf("stored credentials are not encrypted: %q", sub.Auth.String)
+	}
+	got, err := sub.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Headers["Authorization"] != "Bearer s3cret" || got.Username != "me" || got.Password != "pw" {
+		t.Errorf("credentials = %+v", got)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, secretKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("secret key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Another key can't open the credentials.
+	if err := os.WriteFile(filepath.Join(dir, secretKeyFile), make([]byte, 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setSecretKeyPath(filepath.Join(dir, "test.db"))
+	if _, err := sub.Credentials(); err == nil {
+		t.Error("credentials decrypted with the wrong key")
+	}
+
+	if err := SetSubscriptionAuth(sub.ID, SubscriptionAuth{}); err != nil {
+		t.Fatal(err)
+	}
+	if sub, _ = GetSubscriptionByID(sub.ID); sub.Auth.Valid {
+		t.Errorf("cleared credentials are still stored: %q", sub.Auth.String)
+	}
+	if err := SetSubscriptionAuth(999, want); err == nil {
+		t.Error("credentials stored for a missing subscription")
+	}
+}
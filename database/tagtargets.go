@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// TagTestTarget is the test destination of the configs whose remark matches
+// Tag, a regular expression.
+type TagTestTarget struct {
+	ID             int64  `db:"id"`
+	Tag            string `db:"tag"`
+	TestURL        string `db:"test_url"`
+	ExpectedStatus int    `db:"expected_status"`
+}
+
+// SetTagTestTarget sets the test URL and expected status for the configs whose
+// remark matches tag. An empty URL and zero status remove the override.
+func SetTagTestTarget(tag, testURL string, expectedStatus int) error {
+	if testURL == "" && expectedStatus == 0 {
+		res, err := DB.ExecContext(context.Background(), `DELETE FROM tag_test_targets WHERE tag = ?`, tag)
+		if err != nil {
+			return fmt.Errorf("could not clear test target for tag %q: %w", tag, err)
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return notFound("no test target found for tag %q", tag)
+		}
+		return nil
+	}
+	_, err := DB.ExecContext(context.Background(), `
+		INSERT INTO tag_test_targets (tag, test_url, expected_status) VALUES (?, ?, ?)
+		ON CONFLICT(tag) DO UPDATE SET
+			test_url = excluded.test_url,
+			expected_status = excluded.expected_status`, tag, testURL, expectedStatus)
+	if err != nil {
+		return fmt.Errorf("could not set test target for tag %q: %w", tag, err)
+	}
+	return nil
+}
+
+// GetTagTestTargets returns the per-tag test destinations in the order they
+// were first set, which is the order they are matched in.
+func GetTagTestTargets() ([]TagTestTarget, error) {
+	var targets []TagTestTarget
+	err := DB.SelectContext(context.Background(), &targets, `SELECT id, tag, test_url, expected_status FROM tag_test_targets ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get tag test targets: %w", err)
+	}
+	return targets, nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagTestTargets(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Close()
+
+	if err := SetTagTestTarget("IR|🇮🇷", "https://www.aparat.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTagTestTarget("DE", "https://www.gstatic.com/generate_204", 204); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTagTestTarget("IR|🇮🇷", "https://www.digikala.com", 200); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := GetTagTestTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0].Tag != "IR|🇮🇷" || targets[0].TestURL != "https://www.digikala.com" || targets[0].ExpectedStatus != 200 {
+		t.Fatalf("GetTagTestTargets() = %+v, want the updated IR target first", targets)
+	}
+
+	if err := SetTagTestTarget("DE", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if targets, _ := GetTagTestTargets(); len(targets) != 1 {
+		t.Errorf("after clearing DE: %+v", targets)
+	}
+	if err := SetTagTestTarget("DE", "", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("clearing a missing tag: err = %v, want ErrNotFound", err)
+	}
+}
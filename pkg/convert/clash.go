@@ -0,0 +1,271 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+// yamlMap is a YAML mapping that keeps the order of its keys.
+type yamlMap []yamlField
+
+type yamlField struct {
+	key   string
+	value any
+}
+
+// set appends key unless value is the zero value of its type.
+func (m *yamlMap) set(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case int:
+		if v == 0 {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case yamlMap:
+		if len(v) == 0 {
+			return
+		}
+	}
+	*m = append(*m, yamlField{key, value})
+}
+
+// writeClash writes a Clash (mihomo) config with the outbounds it can express,
+// a selector defaulting to a latency test over them and a catch-all rule, and
+// returns the outbounds it left out.
+func writeClash(w io.Writer, outbounds []outbound) ([]Skipped, error) {
+	var proxies []yamlMap
+	var names []string
+	var skipped []Skipped
+	for _, o := range outbounds {
+		proxy, err := clashProxy(o)
+		if err != nil {
+			skipped = append(skipped, Skipped{Link: o.link, Reason: err.Error()})
+			continue
+		}
+		proxies = append(proxies, proxy)
+		names = append(names, o.name)
+	}
+	if len(proxies) == 0 {
+		return skipped, ErrNothingConverted
+	}
+
+	doc := yamlMap{
+		{"proxies", proxies},
+		{"proxy-groups", []yamlMap{
+			{{"name", "PROXY"}, {"type", "select"}, {"proxies", append([]string{"auto"}, names...)}},
+			{{"name", "auto"}, {"type", "url-test"}, {"url", urlTestURL}, {"interval", int(urlTestInterval.Seconds())}, {"proxies", names}},
+		}},
+		{"rules", []string{"MATCH,PROXY"}},
+	}
+	var b strings.Builder
+	writeYAML(&b, doc, "")
+	_, err := io.WriteString(w, b.String())
+	return skipped, err
+}
+
+// writeYAML renders m in block style; lists of strings are written inline.
+func writeYAML(b *strings.Builder, m yamlMap, indent string) {
+	for _, f := range m {
+		b.WriteString(indent + f.key + ":")
+		switch v := f.value.(type) {
+		case yamlMap:
+			b.WriteByte('\n')
+			writeYAML(b, v, indent+"  ")
+		case []yamlMap:
+			b.WriteByte('\n')
+			for _, item := range v {
+				b.WriteString(indent + "  - ")
+				var sub strings.Builder
+				writeYAML(&sub, item, indent+"    ")
+				// The first key goes on the dash line.
+				b.WriteString(strings.TrimPrefix(sub.String(), indent+"    "))
+			}
+		default:
+			b.WriteString(" " + yamlScalar(v) + "\n")
+		}
+	}
+}
+
+func yamlScalar(value any) string {
+	switch v := value.(type) {
+	case string:
+		// A JSON string is a valid double-quoted YAML scalar.
+		s, _ := json.Marshal(v)
+		return string(s)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = yamlScalar(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// clashProxy maps a sing-box outbound to a Clash proxy.
+func clashProxy(o outbound) (yamlMap, error) {
+	p := yamlMap{{"name", o.name}}
+	var server option.ServerOptions
+	var tls *option.OutboundTLSOptions
+	var transport *option.V2RayTransportOptions
+	sniKey := "servername"
+
+	switch opts := o.options.Options.(type) {
+	case *option.VMessOutboundOptions:
+		server, tls, transport = opts.ServerOptions, opts.TLS, opts.Transport
+		cipher := opts.Security
+		if cipher == "" {
+			cipher = "auto"
+		}
+		p = append(p, yamlField{"type", "vmess"})
+		p = appendServer(p, server)
+		p = append(p, yamlField{"uuid", opts.UUID}, yamlField{"alterId", opts.AlterId}, yamlField{"cipher", cipher})
+	case *option.VLESSOutboundOptions:
+		server, tls, transport = opts.ServerOptions, opts.TLS, opts.Transport
+		p = append(p, yamlField{"type", "vless"})
+		p = appendServer(p, server)
+		p = append(p, yamlField{"uuid", opts.UUID})
+		p.set("flow", opts.Flow)
+	case *option.TrojanOutboundOptions:
+		server, tls, transport = opts.ServerOptions, opts.TLS, opts.Transport
+		sniKey = "sni"
+		p = append(p, yamlField{"type", "trojan"})
+		p = appendServer(p, server)
+		p = append(p, yamlField{"password", opts.Password})
+	case *option.ShadowsocksOutboundOptions:
+		if opts.Plugin != "" {
+			return nil, fmt.Errorf("shadowsocks plugin %s is not supported by the clash target", opts.Plugin)
+		}
+		p = append(p, yamlField{"type", "ss"})
+		p = appendServer(p, opts.ServerOptions)
+		p = append(p, yamlField{"cipher", opts.Method}, yamlField{"password", opts.Password}, yamlField{"udp", true})
+		return p, nil
+	case *option.Hysteria2OutboundOptions:
+		server, tls = opts.ServerOptions, opts.TLS
+		sniKey = "sni"
+		p = append(p, yamlField{"type", "hysteria2"})
+		p = appendServer(p, server)
+		p = append(p, yamlField{"password", opts.Password})
+		if opts.Obfs != nil {
+			p.set("obfs", opts.Obfs.Type)
+			p.set("obfs-password", opts.Obfs.Password)
+		}
+	case *option.SOCKSOutboundOptions:
+		p = append(p, yamlField{"type", "socks5"})
+		p = appendServer(p, opts.ServerOptions)
+		p.set("username", opts.Username)
+		p.set("password", opts.Password)
+		return p, nil
+	case *option.HTTPOutboundOptions:
+		// naive links are HTTP outbounds too, but need naive's padding.
+		if !protocol.IsProxyLink(o.link) {
+			return nil, fmt.Errorf("%s is not supported by the clash target", o.options.Type)
+		}
+		p = append(p, yamlField{"type", "http"})
+		p = appendServer(p, opts.ServerOptions)
+		p.set("username", opts.Username)
+		p.set("password", opts.Password)
+		if opts.TLS != nil && opts.TLS.Enabled {
+			p = append(p, yamlField{"tls", true})
+			p.set("sni", opts.TLS.ServerName)
+			p.set("skip-cert-verify", opts.TLS.Insecure)
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("%s is not supported by the clash target", o.options.Type)
+	}
+
+	if tls != nil && tls.Enabled {
+		if sniKey == "servername" {
+			p = append(p, yamlField{"tls", true})
+		}
+		p.set(sniKey, tls.ServerName)
+		p.set("skip-cert-verify", tls.Insecure)
+		p.set("alpn", []string(tls.ALPN))
+		if tls.UTLS != nil && tls.UTLS.Enabled {
+			p.set("client-fingerprint", tls.UTLS.Fingerprint)
+		}
+		if tls.Reality != nil && tls.Reality.Enabled {
+			reality := yamlMap{{"public-key", tls.Reality.PublicKey}}
+			reality.set("short-id", tls.Reality.ShortID)
+			p = append(p, yamlField{"reality-opts", reality})
+		}
+	}
+	return appendTransport(p, transport, tls != nil && tls.Enabled)
+}
+
+func appendServer(p yamlMap, server option.ServerOptions) yamlMap {
+	return append(p, yamlField{"server", strings.Trim(server.Server, "[]")}, yamlField{"port", int(server.ServerPort)})
+}
+
+// appendTransport adds the network of a V2Ray transport and its options.
+func appendTransport(p yamlMap, t *option.V2RayTransportOptions, tls bool) (yamlMap, error) {
+	if t == nil || t.Type == "" {
+		return p, nil
+	}
+	switch t.Type {
+	case "ws":
+		ws := yamlMap{}
+		ws.set("path", t.WebsocketOptions.Path)
+		ws.set("headers", hostHeader(t.WebsocketOptions.Headers.Build().Get("Host")))
+		if t.WebsocketOptions.MaxEarlyData > 0 {
+			ws.set("max-early-data", int(t.WebsocketOptions.MaxEarlyData))
+			ws.set("early-data-header-name", t.WebsocketOptions.EarlyDataHeaderName)
+		}
+		p = append(p, yamlField{"network", "ws"})
+		p.set("ws-opts", ws)
+	case "httpupgrade":
+		ws := yamlMap{}
+		ws.set("path", t.HTTPUpgradeOptions.Path)
+		ws.set("headers", hostHeader(t.HTTPUpgradeOptions.Host))
+		ws.set("v2ray-http-upgrade", true)
+		p = append(p, yamlField{"network", "ws"}, yamlField{"ws-opts", ws})
+	case "grpc":
+		p = append(p, yamlField{"network", "grpc"})
+		p.set("grpc-opts", yamlMap{{"grpc-service-name", t.GRPCOptions.ServiceName}})
+	case "http":
+		path := t.HTTPOptions.Path
+		if path == "" {
+			path = "/"
+		}
+		if tls {
+			h2 := yamlMap{}
+			h2.set("host", []string(t.HTTPOptions.Host))
+			h2.set("path", path)
+			p = append(p, yamlField{"network", "h2"}, yamlField{"h2-opts", h2})
+			break
+		}
+		httpOpts := yamlMap{{"path", []string{path}}}
+		if len(t.HTTPOptions.Host) > 0 {
+			httpOpts.set("headers", yamlMap{{"Host", []string(t.HTTPOptions.Host)}})
+		}
+		p = append(p, yamlField{"network", "http"}, yamlField{"http-opts", httpOpts})
+	default:
+		return nil, fmt.Errorf("%s transport is not supported by the clash target", t.Type)
+	}
+	return p, nil
+}
+
+func hostHeader(host string) yamlMap {
+	if host == "" {
+		return nil
+	}
+	return yamlMap{{"Host", host}}
+}
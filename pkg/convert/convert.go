@@ -0,0 +1,127 @@
+// Package convert turns config links into the subscription formats other
+// clients import: Clash (mihomo) YAML, a sing-box outbounds JSON and base64.
+package convert
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+// Targets a subscription can be converted to.
+const (
+	TargetClash   = "clash"
+	TargetSingbox = "singbox"
+	TargetBase64  = "base64"
+)
+
+// Targets lists the supported targets.
+var Targets = []string{TargetClash, TargetSingbox, TargetBase64}
+
+// ErrNothingConverted is returned when none of the links fit the target.
+var ErrNothingConverted = errors.New("none of the configs could be converted")
+
+// ParseTarget validates a target name, accepting "mihomo" and "sing-box" too.
+func ParseTarget(name string) (string, error) {
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case TargetClash, TargetSingbox, TargetBase64:
+		return name, nil
+	case "mihomo":
+		return TargetClash, nil
+	case "sing-box":
+		return TargetSingbox, nil
+	}
+	return "", fmt.Errorf("unknown target %q (supported: %s)", name, strings.Join(Targets, ", "))
+}
+
+// ContentType is the media type of a converted subscription.
+func ContentType(target string) string {
+	switch target {
+	case TargetClash:
+		return "text/yaml; charset=utf-8"
+	case TargetSingbox:
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Skipped is a link left out of a conversion.
+type Skipped struct {
+	Link   string
+	Reason string
+}
+
+// Convert writes links to w in the format of target and returns the links the
+// target can't express. Clash and sing-box output fails with ErrNothingConverted
+// when no link is left.
+func Convert(w io.Writer, target string, links []string) ([]Skipped, error) {
+	if target == TargetBase64 {
+		_, err := io.WriteString(w, base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))))
+		return nil, err
+	}
+
+	outbounds, skipped := parseOutbounds(links)
+	var err error
+	switch target {
+	case TargetClash:
+		var unsupported []Skipped
+		unsupported, err = writeClash(w, outbounds)
+		skipped = append(skipped, unsupported...)
+	case TargetSingbox:
+		err = writeSingbox(w, outbounds)
+	default:
+		return nil, fmt.Errorf("unknown target %q", target)
+	}
+	return skipped, err
+}
+
+// outbound is a parsed link with the unique name it gets in the output.
+type outbound struct {
+	name    string
+	link    string
+	options *option.Outbound
+}
+
+// parseOutbounds builds the sing-box outbound of every link, naming each after
+// the remark of its config.
+func parseOutbounds(links []string) ([]outbound, []Skipped) {
+	core := &singbox.Core{}
+	taken := make(map[string]bool)
+	var out []outbound
+	var skipped []Skipped
+	for _, link := range links {
+		p, err := core.CreateProtocol(link)
+		if err == nil {
+			err = p.Parse()
+		}
+		if err != nil {
+			skipped = append(skipped, Skipped{Link: link, Reason: err.Error()})
+			continue
+		}
+		sp := p.(singbox.Protocol)
+		opts, err := sp.CraftOutboundOptions(false)
+		if err != nil {
+			skipped = append(skipped, Skipped{Link: link, Reason: err.Error()})
+			continue
+		}
+		gc := sp.ConvertToGeneralConfig()
+		name := strings.TrimSpace(gc.Remark)
+		if name == "" {
+			name = net.JoinHostPort(strings.Trim(gc.Address, "[]"), gc.Port)
+		}
+		for base, n := name, 2; taken[name]; n++ {
+			name = base + " " + strconv.Itoa(n)
+		}
+		taken[name] = true
+		out = append(out, outbound{name: name, link: link, options: opts})
+	}
+	return out, skipped
+}
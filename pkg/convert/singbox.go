@@ -0,0 +1,51 @@
+package convert
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// The latency test of the generated groups.
+const (
+	urlTestURL      = "https://www.gstatic.com/generate_204"
+	urlTestInterval = 5 * time.Minute
+)
+
+// writeSingbox writes the outbounds section of a sing-box config: a selector
+// defaulting to a latency test over every config, the configs and direct.
+func writeSingbox(w io.Writer, outbounds []outbound) error {
+	if len(outbounds) == 0 {
+		return ErrNothingConverted
+	}
+	tags := make([]string, len(outbounds))
+	configs := make([]option.Outbound, len(outbounds))
+	for i, o := range outbounds {
+		tags[i] = o.name
+		configs[i] = *o.options
+		configs[i].Tag = o.name
+	}
+
+	list := []option.Outbound{
+		{Type: "selector", Tag: "select", Options: &option.SelectorOutboundOptions{
+			Outbounds: append([]string{"auto"}, tags...),
+			Default:   "auto",
+		}},
+		{Type: "urltest", Tag: "auto", Options: &option.URLTestOutboundOptions{
+			Outbounds: tags,
+			URL:       urlTestURL,
+			Interval:  badoption.Duration(urlTestInterval),
+		}},
+	}
+	list = append(list, configs...)
+	list = append(list, option.Outbound{Type: "direct", Tag: "direct", Options: &option.DirectOutboundOptions{}})
+
+	enc := json.NewEncoderContext(context.Background(), w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(option.Options{Outbounds: list})
+}
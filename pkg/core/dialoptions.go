@@ -0,0 +1,20 @@
+package core
+
+import (
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
+)
+
+// DialOptionsCore is implemented by cores that inject socket options (TCP Fast Open,
+// interface binding, fwmark, domain strategy, Happy Eyeballs) into the outbounds
+// they build.
+type DialOptionsCore interface {
+	SetDialOptions(o protocol.DialOptions)
+}
+
+// SetDialOptions sets the socket options of both underlying cores.
+func (c *AutomaticCore) SetDialOptions(o protocol.DialOptions) {
+	c.xrayCore.(*xray.Core).SetDialOptions(o)
+	c.singboxCore.(*singbox.Core).SetDialOptions(o)
+}
@@ -0,0 +1,18 @@
+package core
+
+import (
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
+)
+
+// DNSServerCore is implemented by cores that resolve config servers with their
+// own DNS client, which can be pointed at another DNS server. The xray core
+// resolves them with the process resolver instead.
+type DNSServerCore interface {
+	SetDNSServer(addr string)
+}
+
+// SetDNSServer sets the DNS server of the sing-box core; the xray core goes
+// through the process resolver.
+func (c *AutomaticCore) SetDNSServer(addr string) {
+	c.singboxCore.(*singbox.Core).SetDNSServer(addr)
+}
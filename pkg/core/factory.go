@@ -11,6 +11,7 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
 type CoreType uint8
@@ -30,6 +31,13 @@ type Core interface {
 	SetInbound(inbound protocol.Protocol) error
 }
 
+// PooledCore is implemented by cores that can load many outbounds into a single
+// instance, avoiding the startup cost of one instance per config during bulk tests.
+// The returned clients are index-aligned with outbounds.
+type PooledCore interface {
+	MakeHttpClientPool(ctx context.Context, outbounds []protocol.Protocol, maxDelay time.Duration) ([]protocol.PooledClient, protocol.Instance, error)
+}
+
 // CoreFactory is the factory method to create concrete cores.
 func CoreFactory(coreType CoreType, insecureTLS bool, verbose bool) Core {
 	switch coreType {
@@ -70,7 +78,30 @@ func (c *AutomaticCore) selectCoreForLink(configLink string) (Core, error) {
 	switch uri.Scheme {
 	case protocol.Hysteria2Identifier, "hy2":
 		return c.singboxCore, nil
-	case protocol.VmessIdentifier, protocol.VlessIdentifier, protocol.TrojanIdentifier, protocol.ShadowsocksIdentifier, protocol.SocksIdentifier, protocol.WireguardIdentifier:
+	case protocol.NaiveHTTPSScheme, protocol.NaiveQUICScheme:
+		return c.singboxCore, nil
+	case protocol.JuicityIdentifier, protocol.MieruIdentifier, "mierus":
+		// Parsed by sing-box's protocol set, which reports them as untestable.
+		return c.singboxCore, nil
+	case protocol.VmessIdentifier, protocol.VlessIdentifier, protocol.TrojanIdentifier:
+		// xray-core dropped the QUIC transport; sing-box still implements it.
+		if utils.LinkNetwork(configLink) == "quic" {
+			return c.singboxCore, nil
+		}
+		return c.xrayCore, nil
+	case protocol.ShadowsocksIdentifier:
+		// sing-box implements every mode of the SIP003 plugins; xray only some.
+		if link, err := protocol.ParseShadowsocksLink(configLink); err == nil && link.Plugin != nil {
+			return c.singboxCore, nil
+		}
+		return c.xrayCore, nil
+	case protocol.SocksIdentifier, protocol.Socks5Scheme, protocol.Socks5HScheme, protocol.WireguardIdentifier:
+		return c.xrayCore, nil
+	case protocol.HTTPProxyIdentifier, protocol.HTTPSProxyScheme:
+		// Only a host:port URL is a proxy; anything else is a web page.
+		if !protocol.IsProxyLink(configLink) {
+			return nil, fmt.Errorf("%s is not a proxy link, expected %s://[user:pass@]host:port", configLink, uri.Scheme)
+		}
 		return c.xrayCore, nil
 	default:
 		return nil, fmt.Errorf("unsupported protocol for automatic core: %s", uri.Scheme)
@@ -110,3 +141,68 @@ func (c *AutomaticCore) MakeInstance(ctx context.Context, outbound protocol.Prot
 func (c *AutomaticCore) SetInbound(inbound protocol.Protocol) error {
 	return errors.New("SetInbound is not supported on AutomaticCore")
 }
+
+// MakeHttpClientPool splits the outbounds between the underlying cores and builds one
+// pooled instance per core.
+func (c *AutomaticCore) MakeHttpClientPool(ctx context.Context, outbounds []protocol.Protocol, maxDelay time.Duration) ([]protocol.PooledClient, protocol.Instance, error) {
+	clients := make([]protocol.PooledClient, len(outbounds))
+	groups := map[Core][]int{}
+	for i, outbound := range outbounds {
+		selectedCore, err := c.selectCoreForLink(outbound.ConvertToGeneralConfig().OrigLink)
+		if err != nil {
+			clients[i].Err = err
+			continue
+		}
+		groups[selectedCore] = append(groups[selectedCore], i)
+	}
+
+	instances := multiInstance{}
+	for selectedCore, indices := range groups {
+		pooled, ok := selectedCore.(PooledCore)
+		if !ok {
+			instances.Close()
+			return nil, nil, fmt.Errorf("core %s does not support pooling", selectedCore.Name())
+		}
+		subset := make([]protocol.Protocol, len(indices))
+		for j, idx := range indices {
+			subset[j] = outbounds[idx]
+		}
+		subClients, instance, err := pooled.MakeHttpClientPool(ctx, subset, maxDelay)
+		if err != nil && subClients == nil {
+			instances.Close()
+			return nil, nil, err
+		}
+		// On error with clients, every outbound of this core failed to build
+		// and the clients only carry their errors.
+		if err == nil {
+			instances = append(instances, instance)
+		}
+		for j, idx := range indices {
+			clients[idx] = subClients[j]
+		}
+	}
+
+	return clients, instances, nil
+}
+
+// multiInstance starts and closes several instances as one.
+type multiInstance []protocol.Instance
+
+func (m multiInstance) Start() error {
+	for _, i := range m {
+		if err := i.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiInstance) Close() error {
+	var errs []error
+	for _, i := range m {
+		if err := i.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
+)
+
+// IPVersionCore is implemented by cores that can force the address family config
+// servers are dialed over: 4 or 6, or 0 for whatever the resolver returns first.
+// A server whose domain has no record of that family then fails instead of
+// silently falling back to the other one.
+type IPVersionCore interface {
+	SetIPVersion(v int)
+}
+
+// ParseIPVersion parses an --ip-version value into the families to test: "4", "6",
+// "both" (4 then 6), or "" / "any" for the system's default.
+func ParseIPVersion(s string) ([]int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "any":
+		return []int{0}, nil
+	case "4", "ipv4", "v4":
+		return []int{4}, nil
+	case "6", "ipv6", "v6":
+		return []int{6}, nil
+	case "both", "dual":
+		return []int{4, 6}, nil
+	default:
+		return nil, fmt.Errorf("invalid IP version %q (use 4, 6, or both)", s)
+	}
+}
+
+// AddressMatchesIPVersion reports whether a server address can be dialed over IP
+// version v. Domains always can; the core resolves them to the right family.
+func AddressMatchesIPVersion(address string, v int) bool {
+	ip := net.ParseIP(strings.Trim(address, "[]"))
+	if ip == nil || v == 0 {
+		return true
+	}
+	if v == 4 {
+		return ip.To4() != nil
+	}
+	return ip.To4() == nil
+}
+
+// SetIPVersion forces the address family on both underlying cores.
+func (c *AutomaticCore) SetIPVersion(v int) {
+	c.xrayCore.(*xray.Core).SetIPVersion(v)
+	c.singboxCore.(*singbox.Core).SetIPVersion(v)
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIPVersion(t *testing.T) {
+	for in, want := range map[string][]int{"": {0}, "4": {4}, "IPv6": {6}, "both": {4, 6}} {
+		got, err := ParseIPVersion(in)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseIPVersion(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseIPVersion("5"); err == nil {
+		t.Error("ParseIPVersion(\"5\") succeeded")
+	}
+}
+
+func TestAddressMatchesIPVersion(t *testing.T) {
+	tests := []struct {
+		address string
+		v       int
+		want    bool
+	}{
+		{"example.com", 6, true},
+		{"1.2.3.4", 4, true},
+		{"1.2.3.4", 6, false},
+		{"[2001:db8::1]", 6, true},
+		{"2001:db8::1", 4, false},
+		{"2001:db8::1", 0, true},
+	}
+	for _, tt := range tests {
+		if got := AddressMatchesIPVersion(tt.address, tt.v); got != tt.want {
+			t.Errorf("AddressMatchesIPVersion(%q, %d) = %v, want %v", tt.address, tt.v, got, tt.want)
+		}
+	}
+}
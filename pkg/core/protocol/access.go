@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"context"
+	"time"
+)
+
+// AccessEntry is a connection a core instance relayed, as recorded in the proxy
+// access log.
+type AccessEntry struct {
+	Time        time.Time `json:"time"` // when the connection was opened
+	Network     string    `json:"network"`
+	Destination string    `json:"destination"` // host:port the client asked for
+	Outbound    string    `json:"outbound"`    // tag of the outbound that carried it
+	// Exit is the config the outbound connects through, filled in by the proxy.
+	Exit     string `json:"exit,omitempty"`
+	Up       int64  `json:"up"`   // bytes sent by the client
+	Down     int64  `json:"down"` // bytes received by the client
+	Duration int64  `json:"durationMs"`
+}
+
+// AccessRecorder receives an entry each time a connection closes. It is called
+// from the goroutines of the core and must be safe for concurrent use.
+type AccessRecorder func(AccessEntry)
+
+type accessRecorderKey struct{}
+
+// WithAccessRecorder returns a context that makes the instances built with it
+// report their connections to rec.
+func WithAccessRecorder(ctx context.Context, rec AccessRecorder) context.Context {
+	return context.WithValue(ctx, accessRecorderKey{}, rec)
+}
+
+// AccessRecorderFrom returns the recorder set by WithAccessRecorder, or nil.
+func AccessRecorderFrom(ctx context.Context) AccessRecorder {
+	rec, _ := ctx.Value(accessRecorderKey{}).(AccessRecorder)
+	return rec
+}
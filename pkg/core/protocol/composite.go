@@ -0,0 +1,146 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// Schemes of links that bundle several configs instead of describing one.
+const (
+	RelayScheme    = "relay"
+	BalancerScheme = "balancer"
+	SubScheme      = "sub"
+)
+
+// CompositeKind is how the configs of a composite link are meant to be used.
+type CompositeKind string
+
+const (
+	// CompositeChain configs are hops, dialed through one another in order.
+	CompositeChain CompositeKind = "chain"
+	// CompositeBalancer configs are alternatives for the same route.
+	CompositeBalancer CompositeKind = "balancer"
+)
+
+// Composite is a link expanded into the configs it bundles.
+type Composite struct {
+	Kind   CompositeKind
+	Remark string
+	// Links are the member config links, entry hop first for a chain.
+	Links []string
+}
+
+// IsComposite reports whether link uses one of the composite schemes.
+func IsComposite(link string) bool {
+	scheme, _, ok := strings.Cut(strings.TrimSpace(link), "://")
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(scheme) {
+	case RelayScheme, BalancerScheme, SubScheme:
+		return true
+	}
+	return false
+}
+
+// ParseComposite expands a composite link. relay:// links are chains, balancer://
+// and sub:// links are groups of alternatives. The member links are given either
+// base64-encoded after the scheme, with an optional #remark:
+//
+//	relay://<base64 of a JSON array or of one link per line>#remark
+//
+// or as a JSON array in the fragment, after an optional name:
+//
+//	balancer://name#["vless://...","trojan://..."]
+//
+// Members can't be composite links themselves.
+func ParseComposite(link string) (*Composite, error) {
+	link = strings.TrimSpace(link)
+	scheme, rest, ok := strings.Cut(link, "://")
+	if !ok || !IsComposite(link) {
+		return nil, &ParseError{Class: ParseErrUnknownScheme, Err: fmt.Errorf("not a composite link")}
+	}
+	c := &Composite{Kind: CompositeBalancer}
+	if strings.EqualFold(scheme, RelayScheme) {
+		c.Kind = CompositeChain
+	}
+
+	body, fragment, _ := strings.Cut(rest, "#")
+	// A raw JSON fragment is used as is, so the members keep their escapes.
+	if !strings.HasPrefix(fragment, "[") {
+		if unescaped, err := url.PathUnescape(fragment); err == nil {
+			fragment = unescaped
+		}
+	}
+	if strings.HasPrefix(fragment, "[") {
+		if err := json.Unmarshal([]byte(fragment), &c.Links); err != nil {
+			return nil, &ParseError{Class: ParseErrMalformed, Err: fmt.Errorf("invalid member list: %w", err)}
+		}
+		c.Remark, _ = url.PathUnescape(body)
+	} else {
+		decoded, err := utils.Base64Decode(body)
+		if err != nil {
+			return nil, &ParseError{Class: ParseErrBadBase64, Err: err}
+		}
+		if c.Links, err = splitMembers(string(decoded)); err != nil {
+			return nil, &ParseError{Class: ParseErrMalformed, Err: err}
+		}
+		c.Remark = fragment
+	}
+	c.Remark = strings.TrimSpace(c.Remark)
+
+	if err := c.validate(); err != nil {
+		return nil, &ParseError{Class: ParseErrMalformed, Err: err}
+	}
+	return c, nil
+}
+
+// splitMembers reads the decoded payload of a composite link: a JSON array of
+// links, one link per line, or links on a single line separated by '|'.
+func splitMembers(payload string) ([]string, error) {
+	payload = strings.TrimSpace(payload)
+	if strings.HasPrefix(payload, "[") {
+		var links []string
+		if err := json.Unmarshal([]byte(payload), &links); err != nil {
+			return nil, fmt.Errorf("invalid member list: %w", err)
+		}
+		return links, nil
+	}
+	if u, err := url.Parse(payload); err == nil && (u.Scheme == "http" || u.Scheme == "https") && !strings.ContainsAny(payload, "\n|") {
+		return nil, fmt.Errorf("link points at the subscription %s; add it with 'subs add' instead", payload)
+	}
+	if strings.Contains(payload, "\n") {
+		return strings.Split(payload, "\n"), nil
+	}
+	return strings.Split(payload, "|"), nil
+}
+
+func (c *Composite) validate() error {
+	var links []string
+	for _, l := range c.Links {
+		if l = strings.TrimSpace(l); l != "" {
+			links = append(links, l)
+		}
+	}
+	c.Links = links
+	if len(links) == 0 {
+		return errors.New("composite link has no members")
+	}
+	if c.Kind == CompositeChain && len(links) < 2 {
+		return fmt.Errorf("a relay needs at least 2 hops, got %d", len(links))
+	}
+	for i, l := range links {
+		if !strings.Contains(l, "://") {
+			return fmt.Errorf("member %d is not a config link", i+1)
+		}
+		if IsComposite(l) {
+			return fmt.Errorf("member %d is a composite link itself", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseComposite(t *testing.T) {
+	hop1 := "vless://11111111-1111-1111-1111-111111111111@a.example.com:443?security=tls#Entry%20hop"
+	hop2 := "trojan://secret@b.example.com:443#Exit"
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name string
+		link string
+		want Composite
+	}{
+		{"relay lines", "relay://" + b64(hop1+"\n"+hop2) + "#My%20relay",
+			Composite{Kind: CompositeChain, Remark: "My relay", Links: []string{hop1, hop2}}},
+		{"relay json", "relay://" + b64(`["`+hop1+`","`+hop2+`"]`),
+			Composite{Kind: CompositeChain, Links: []string{hop1, hop2}}},
+		{"balancer pipes", "balancer://" + b64(hop1+"|"+hop2),
+			Composite{Kind: CompositeBalancer, Links: []string{hop1, hop2}}},
+		{"fragment json keeps escapes", "balancer://Fast%20pair#[\"" + hop1 + "\",\"" + hop2 + "\"]",
+			Composite{Kind: CompositeBalancer, Remark: "Fast pair", Links: []string{hop1, hop2}}},
+		{"sub", "sub://" + b64(hop2), Composite{Kind: CompositeBalancer, Links: []string{hop2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseComposite(tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("ParseComposite() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCompositeErrors(t *testing.T) {
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := map[string]ParseErrorClass{
+		"relay://" + b64("trojan://p@b.example.com:443"):                            ParseErrMalformed, // single hop
+		"sub://" + b64("https://example.com/sub"):                                   ParseErrMalformed, // nested subscription
+		"balancer://" + b64("relay://abc|trojan://p@b.example.com:443"):             ParseErrMalformed,
+		"balancer://x#[not json":                                                    ParseErrMalformed,
+		"relay://%%%":                                                               ParseErrBadBase64,
+		"balancer://" + b64("not a link"):                                           ParseErrMalformed,
+		"vless://11111111-1111-1111-1111-111111111111@a.example.com:443#plain link": ParseErrUnknownScheme,
+	}
+	for link, class := range tests {
+		_, err := ParseComposite(link)
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Class != class {
+			t.Errorf("ParseComposite(%q) error = %v, want class %s", link, err, class)
+		}
+	}
+}
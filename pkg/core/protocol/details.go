@@ -0,0 +1,242 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// Details is the aligned "Key: value" view printed for a parsed config. Every
+// protocol builds its DetailsStr from one, so all configs read the same way.
+type Details struct {
+	fields   []detailField
+	warnings []string
+}
+
+type detailField struct {
+	key   string
+	value string
+}
+
+// NewDetails starts a detail view with the Protocol and Remark fields.
+func NewDetails(protocolName, remark string) *Details {
+	d := &Details{}
+	return d.Add("Protocol", protocolName).Add("Remark", remark)
+}
+
+// Add appends a field. Empty values are shown as "none".
+func (d *Details) Add(key string, value any) *Details {
+	s := fmt.Sprint(value)
+	if value == nil || s == "" {
+		s = "none"
+	}
+	d.fields = append(d.fields, detailField{key: key, value: s})
+	return d
+}
+
+// AddIfSet appends a field only when it has a value.
+func (d *Details) AddIfSet(key string, value any) *Details {
+	if value == nil || fmt.Sprint(value) == "" {
+		return d
+	}
+	return d.Add(key, value)
+}
+
+// Warn records a risky setting, listed below the fields.
+func (d *Details) Warn(format string, a ...any) *Details {
+	d.warnings = append(d.warnings, fmt.Sprintf(format, a...))
+	return d
+}
+
+// Warnings returns the recorded warnings.
+func (d *Details) Warnings() []string {
+	return d.warnings
+}
+
+// Transport describes the stream settings of a config.
+type Transport struct {
+	Network      string
+	HeaderType   string // "http" for TCP HTTP obfuscation, the packet header for kcp and quic
+	Host         string
+	Path         string
+	ServiceName  string
+	Authority    string
+	UserAgent    string // gRPC user agent
+	Mode         string
+	Extra        string // xhttp extra JSON
+	EarlyData    string // ws ed= parameter, if not embedded in Path
+	EarlyDataHdr string // ws eh= parameter
+	Seed         string // kcp seed, if not carried in Path
+	QUICSecurity string
+	QUICKey      string
+}
+
+// AddTransport appends the network and the fields that matter for it.
+func (d *Details) AddTransport(t Transport) *Details {
+	network := t.Network
+	if network == "" {
+		network = "tcp"
+	}
+	if t.HeaderType == "http" {
+		d.Add("Network", network+" (http header)")
+	} else {
+		d.Add("Network", network)
+	}
+
+	switch {
+	case network == "ws", network == "httpupgrade":
+		path, ed := ParseEarlyData(t.Path, t.EarlyData, t.EarlyDataHdr)
+		d.Add("Host", t.Host).Add("Path", path)
+		if ed.MaxBytes > 0 {
+			d.Add("Early data", fmt.Sprintf("%d bytes (%s)", ed.MaxBytes, ed.Header))
+		}
+	case t.HeaderType == "http", network == "h2", network == "http":
+		d.Add("Host", t.Host).Add("Path", t.Path)
+	case network == "xhttp", network == "splithttp":
+		d.Add("Host", t.Host).Add("Path", t.Path).AddIfSet("Mode", t.Mode).AddIfSet("Extra", t.Extra)
+	case network == "kcp":
+		seed := t.Seed
+		if seed == "" {
+			seed = t.Path
+		}
+		d.Add("Header", t.HeaderType).Add("KCP Seed", seed)
+	case network == "quic":
+		d.Add("Header", t.HeaderType).Add("QUIC security", t.QUICSecurity).AddIfSet("QUIC key", t.QUICKey)
+	case network == "grpc":
+		d.Add("ServiceName", t.ServiceName).AddIfSet("Authority", t.Authority).AddIfSet("Mode", t.Mode).AddIfSet("User-Agent", t.UserAgent)
+	}
+	return d
+}
+
+// TLS describes the security layer of a config.
+type TLS struct {
+	Security      string // "tls", "reality", or empty/"none"
+	SNI           string
+	Host          string // SNI fallback
+	ALPN          string
+	Fingerprint   string
+	AllowInsecure any
+	PublicKey     string
+	ShortID       string
+	SpiderX       string
+}
+
+// AddTLS appends a summary such as "TLS: REALITY (fp=chrome)" followed by the
+// settings of that security layer, and warns about risky ones.
+func (d *Details) AddTLS(t TLS) *Details {
+	insecure := IsTruthy(t.AllowInsecure)
+	switch t.Security {
+	case "reality":
+		d.Add("TLS", tlsSummary("REALITY", t.Fingerprint, false))
+		d.Add("SNI", t.SNI).Add("Public key", t.PublicKey).Add("ShortID", t.ShortID).AddIfSet("SpiderX", t.SpiderX)
+		if t.PublicKey == "" {
+			d.Warn("REALITY public key (pbk) is missing; the handshake cannot succeed")
+		}
+	case "tls":
+		sni := t.SNI
+		if sni == "" {
+			sni = t.Host
+		}
+		d.Add("TLS", tlsSummary("TLS", t.Fingerprint, insecure))
+		d.Add("SNI", sni).Add("ALPN", t.ALPN)
+		if insecure {
+			d.Warn("allowInsecure is enabled: the server certificate is not verified and the connection can be intercepted")
+		}
+	default:
+		d.Add("TLS", "none")
+	}
+	return d
+}
+
+func tlsSummary(name, fingerprint string, insecure bool) string {
+	var attrs []string
+	if fingerprint != "" {
+		attrs = append(attrs, "fp="+fingerprint)
+	}
+	if insecure {
+		attrs = append(attrs, "insecure")
+	}
+	if len(attrs) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(attrs, ", "))
+}
+
+// IsTruthy reports whether a link flag such as allowInsecure or insecure is on.
+func IsTruthy(v any) bool {
+	switch b := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return b
+	case float64:
+		return b != 0
+	case int:
+		return b != 0
+	}
+	switch strings.ToLower(strings.TrimSpace(fmt.Sprint(v))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// shadowsocksAEAD lists the Shadowsocks methods that are not considered broken.
+var shadowsocksAEAD = map[string]bool{
+	"aes-128-gcm":             true,
+	"aes-192-gcm":             true,
+	"aes-256-gcm":             true,
+	"chacha20-poly1305":       true,
+	"chacha20-ietf-poly1305":  true,
+	"xchacha20-poly1305":      true,
+	"xchacha20-ietf-poly1305": true,
+}
+
+// ShadowsocksCipherWarning returns a warning for an unencrypted or legacy stream
+// cipher method, or "" when the method is fine.
+func ShadowsocksCipherWarning(method string) string {
+	m := strings.ToLower(method)
+	switch {
+	case m == "none" || m == "plain":
+		return "cipher is none: traffic is not encrypted"
+	case shadowsocksAEAD[m], strings.HasPrefix(m, "2022-blake3-"):
+		return ""
+	default:
+		return fmt.Sprintf("cipher %s is a legacy stream cipher without authentication and is easy to detect", method)
+	}
+}
+
+// String renders the view, colored unless color output is disabled (--no-color,
+// NO_COLOR, or a non-terminal stdout).
+func (d *Details) String() string {
+	return d.Render(customlog.ColorEnabled())
+}
+
+// Render renders the fields with their values aligned, followed by the warnings.
+func (d *Details) Render(colored bool) string {
+	const warnKey = "Warning"
+	width := 0
+	for _, f := range d.fields {
+		width = max(width, len(f.key))
+	}
+	if len(d.warnings) > 0 {
+		width = max(width, len(warnKey))
+	}
+
+	var b strings.Builder
+	line := func(key, value string, logType customlog.Type) {
+		pad := strings.Repeat(" ", width-len(key))
+		if colored {
+			key = customlog.Paint(logType, key)
+		}
+		fmt.Fprintf(&b, "%s:%s %s\n", key, pad, value)
+	}
+	for _, f := range d.fields {
+		line(f.key, f.value, customlog.Label)
+	}
+	for _, w := range d.warnings {
+		line(warnKey, w, customlog.Warning)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetailsRenderAligned(t *testing.T) {
+	d := NewDetails("vless", "").
+		Add("Address", "example.com").
+		AddIfSet("Mode", "")
+	got := d.Render(false)
+	want := "Protocol: vless\n" +
+		"Remark:   none\n" +
+		"Address:  example.com\n"
+	if got != want {
+		t.Errorf("Render() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestDetailsTLSSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		tls      TLS
+		summary  string
+		warnings int
+	}{
+		{"reality", TLS{Security: "reality", Fingerprint: "chrome", PublicKey: "pbk"}, "TLS: REALITY (fp=chrome)", 0},
+		{"reality without pbk", TLS{Security: "reality"}, "TLS: REALITY SNI:", 1},
+		{"insecure tls", TLS{Security: "tls", Fingerprint: "firefox", AllowInsecure: "1"}, "TLS: TLS (fp=firefox, insecure)", 1},
+		{"insecure bool", TLS{Security: "tls", AllowInsecure: true}, "TLS: TLS (insecure)", 1},
+		{"none", TLS{}, "TLS: none", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetails("trojan", "r").AddTLS(tt.tls)
+			out := d.Render(false)
+			if !strings.Contains(strings.Join(strings.Fields(out), " "), tt.summary) {
+				t.Errorf("missing %q in:\n%s", tt.summary, out)
+			}
+			if len(d.Warnings()) != tt.warnings {
+				t.Errorf("got %d warnings %v, want %d", len(d.Warnings()), d.Warnings(), tt.warnings)
+			}
+		})
+	}
+}
+
+func TestShadowsocksCipherWarning(t *testing.T) {
+	for method, risky := range map[string]bool{
+		"chacha20-ietf-poly1305":  false,
+		"AES-256-GCM":             false,
+		"2022-blake3-aes-128-gcm": false,
+		"aes-256-cfb":             true,
+		"rc4-md5":                 true,
+		"none":                    true,
+	} {
+		if got := ShadowsocksCipherWarning(method) != ""; got != risky {
+			t.Errorf("ShadowsocksCipherWarning(%q) risky = %v, want %v", method, got, risky)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+)
+
+// Domain strategies accepted by DialOptions. They decide which address families a
+// config server's domain is resolved to before it is dialed; as-is (or empty)
+// leaves it to the core.
+const (
+	DomainStrategyAsIs       = "as-is"
+	DomainStrategyPreferIPv4 = "prefer-ipv4"
+	DomainStrategyPreferIPv6 = "prefer-ipv6"
+	DomainStrategyIPv4Only   = "ipv4-only"
+	DomainStrategyIPv6Only   = "ipv6-only"
+)
+
+// DialOptions are socket settings injected into every outbound a core builds, for
+// multi-homed hosts and policy routing. The zero value leaves the core defaults.
+type DialOptions struct {
+	TCPFastOpen    bool   `json:"tcpFastOpen,omitempty"`
+	Interface      string `json:"interface,omitempty"`      // bind outgoing connections to this network interface
+	Mark           uint32 `json:"mark,omitempty"`           // SO_MARK set on outgoing sockets (Linux)
+	DomainStrategy string `json:"domainStrategy,omitempty"` // one of the DomainStrategy* values
+	// HappyEyeballs, when non-zero, races the server's addresses: the next one is tried
+	// if the previous hasn't connected after this long.
+	HappyEyeballs time.Duration `json:"happyEyeballs,omitempty"`
+	// Fragment splits the TLS ClientHello to config servers into small pieces,
+	// which gets past DPI that filters on the SNI but doesn't reassemble.
+	Fragment bool `json:"fragment,omitempty"`
+}
+
+// IsZero reports whether o changes nothing.
+func (o DialOptions) IsZero() bool {
+	return o == DialOptions{}
+}
+
+// Validate checks the domain strategy and Happy Eyeballs delay.
+func (o DialOptions) Validate() error {
+	switch o.DomainStrategy {
+	case "", DomainStrategyAsIs, DomainStrategyPreferIPv4, DomainStrategyPreferIPv6, DomainStrategyIPv4Only, DomainStrategyIPv6Only:
+	default:
+		return fmt.Errorf("invalid domain strategy %q (use as-is, prefer-ipv4, prefer-ipv6, ipv4-only or ipv6-only)", o.DomainStrategy)
+	}
+	if o.HappyEyeballs < 0 {
+		return fmt.Errorf("happy eyeballs delay must not be negative, got %s", o.HappyEyeballs)
+	}
+	if o.HappyEyeballs > 0 && (o.DomainStrategy == DomainStrategyIPv4Only || o.DomainStrategy == DomainStrategyIPv6Only) {
+		return fmt.Errorf("happy eyeballs needs both address families and cannot be used with %s", o.DomainStrategy)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDialOptionsValidate(t *testing.T) {
+	valid := []DialOptions{
+		{},
+		{DomainStrategy: "as-is"},
+		{DomainStrategy: DomainStrategyPreferIPv6, HappyEyeballs: 250 * time.Millisecond},
+		{TCPFastOpen: true, Interface: "wg0", Mark: 100},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("%+v: %v", o, err)
+		}
+	}
+
+	invalid := []DialOptions{
+		{DomainStrategy: "UseIPv4"},
+		{HappyEyeballs: -time.Second},
+		{DomainStrategy: DomainStrategyIPv4Only, HappyEyeballs: time.Second},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%+v was accepted", o)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultEarlyDataHeader is the header that carries websocket early data unless a
+// link names another one with eh=.
+const DefaultEarlyDataHeader = "Sec-WebSocket-Protocol"
+
+// EarlyData is the websocket 0-RTT setting of a link. Links carry it either as
+// separate ed=<bytes>&eh=<header> parameters or embedded in the path ("/ws?ed=2048").
+type EarlyData struct {
+	MaxBytes uint32
+	Header   string
+}
+
+// ParseEarlyData extracts the early data setting from a transport path and the
+// link's ed/eh parameters (which win over the path). It returns the path with the
+// ed parameter removed.
+func ParseEarlyData(path, ed, eh string) (string, EarlyData) {
+	var data EarlyData
+	if base, rawQuery, found := strings.Cut(path, "?"); found {
+		if q, err := url.ParseQuery(rawQuery); err == nil && q.Has("ed") {
+			if n, err := strconv.ParseUint(q.Get("ed"), 10, 32); err == nil {
+				data.MaxBytes = uint32(n)
+			}
+			q.Del("ed")
+			path = base
+			if len(q) > 0 {
+				path += "?" + q.Encode()
+			}
+		}
+	}
+	if n, err := strconv.ParseUint(strings.TrimSpace(ed), 10, 32); err == nil {
+		data.MaxBytes = uint32(n)
+	}
+	if data.MaxBytes > 0 {
+		data.Header = strings.TrimSpace(eh)
+		if data.Header == "" {
+			data.Header = DefaultEarlyDataHeader
+		}
+	}
+	return path, data
+}
+
+// XrayPath returns path with the early data embedded as "?ed=N", the form xray-core
+// reads for ws and httpupgrade. xray always sends early data in
+// Sec-WebSocket-Protocol, so a custom header cannot be expressed.
+func (d EarlyData) XrayPath(path string) string {
+	if d.MaxBytes == 0 {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "ed=" + strconv.FormatUint(uint64(d.MaxBytes), 10)
+}
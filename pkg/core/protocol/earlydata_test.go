@@ -0,0 +1,32 @@
+package protocol
+
+import "testing"
+
+func TestParseEarlyData(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		ed, eh   string
+		wantPath string
+		want     EarlyData
+		xrayPath string
+	}{
+		{"none", "/ws", "", "", "/ws", EarlyData{}, "/ws"},
+		{"embedded in path", "/ws?ed=2048", "", "", "/ws", EarlyData{2048, DefaultEarlyDataHeader}, "/ws?ed=2048"},
+		{"other path params kept", "/ws?ed=2048&token=x", "", "", "/ws?token=x", EarlyData{2048, DefaultEarlyDataHeader}, "/ws?token=x&ed=2048"},
+		{"link params", "/ws", "4096", "X-Early", "/ws", EarlyData{4096, "X-Early"}, "/ws?ed=4096"},
+		{"link params win", "/ws?ed=2048", "1024", "", "/ws", EarlyData{1024, DefaultEarlyDataHeader}, "/ws?ed=1024"},
+		{"invalid size", "/ws", "lots", "X-Early", "/ws", EarlyData{}, "/ws"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, got := ParseEarlyData(tt.path, tt.ed, tt.eh)
+			if path != tt.wantPath || got != tt.want {
+				t.Errorf("ParseEarlyData() = %q, %+v; want %q, %+v", path, got, tt.wantPath, tt.want)
+			}
+			if x := got.XrayPath(path); x != tt.xrayPath {
+				t.Errorf("XrayPath() = %q, want %q", x, tt.xrayPath)
+			}
+		})
+	}
+}
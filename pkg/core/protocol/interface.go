@@ -1,5 +1,10 @@
 package protocol
 
+import (
+	"errors"
+	"net/http"
+)
+
 const (
 	VmessIdentifier       = "vmess"
 	VlessIdentifier       = "vless"
@@ -7,7 +12,16 @@ const (
 	ShadowsocksIdentifier = "ss"
 	WireguardIdentifier   = "wireguard"
 	SocksIdentifier       = "socks"
+	Socks5Scheme          = "socks5"
+	Socks5HScheme         = "socks5h"
+	HTTPProxyIdentifier   = "http"
+	HTTPSProxyScheme      = "https"
 	Hysteria2Identifier   = "hysteria2"
+	JuicityIdentifier     = "juicity"
+	MieruIdentifier       = "mieru"
+	NaiveIdentifier       = "naive"
+	NaiveHTTPSScheme      = "naive+https"
+	NaiveQUICScheme       = "naive+quic"
 	TunIdentifier         = "tun"
 )
 const (
@@ -22,6 +36,17 @@ type Instance interface {
 	Close() error
 }
 
+// ErrForeignInstance is returned when an instance is handed to a core that did
+// not create it.
+var ErrForeignInstance = errors.New("instance was created by another core")
+
+// PooledClient is the HTTP client of one outbound inside a pooled core instance.
+// Err is set (and Client is nil) when that outbound could not be built.
+type PooledClient struct {
+	Client *http.Client
+	Err    error
+}
+
 type Protocol interface {
 	Parse() error
 	DetailsStr() string
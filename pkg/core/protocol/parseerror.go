@@ -0,0 +1,194 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseErrorClass groups the reasons a config link could not be parsed, so
+// skipped links can be counted and listed by cause.
+type ParseErrorClass string
+
+const (
+	ParseErrUnknownScheme ParseErrorClass = "unknown_scheme"
+	ParseErrBadBase64     ParseErrorClass = "bad_base64"
+	ParseErrMissingHost   ParseErrorClass = "missing_host"
+	ParseErrBadPort       ParseErrorClass = "bad_port"
+	ParseErrBadUUID       ParseErrorClass = "bad_uuid"
+	// ParseErrMalformed covers every other rejection by a parser.
+	ParseErrMalformed ParseErrorClass = "malformed"
+	// ParseErrPanic means the parser crashed on the link.
+	ParseErrPanic ParseErrorClass = "panic"
+)
+
+// ParseErrorClasses lists every class, in the order they are reported.
+var ParseErrorClasses = []ParseErrorClass{
+	ParseErrUnknownScheme, ParseErrBadBase64, ParseErrMissingHost,
+	ParseErrBadPort, ParseErrBadUUID, ParseErrMalformed, ParseErrPanic,
+}
+
+// ParseError is a parse failure together with its class.
+type ParseError struct {
+	Class ParseErrorClass
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// uuidPattern matches the canonical textual form of a UUID.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// knownSchemes are the link schemes some core can parse.
+var knownSchemes = map[string]bool{
+	VmessIdentifier: true, VlessIdentifier: true, TrojanIdentifier: true, ShadowsocksIdentifier: true,
+	WireguardIdentifier: true, SocksIdentifier: true, Hysteria2Identifier: true, "hy2": true,
+	JuicityIdentifier: true, MieruIdentifier: true, "mierus": true,
+	NaiveHTTPSScheme: true, NaiveQUICScheme: true,
+	Socks5Scheme: true, Socks5HScheme: true, HTTPProxyIdentifier: true, HTTPSProxyScheme: true,
+}
+
+// ClassifyParseError wraps err, returned while creating or parsing link, in a
+// *ParseError. The class is derived from the link itself, since every parser
+// words its errors differently.
+func ClassifyParseError(link string, err error) *ParseError {
+	return &ParseError{Class: classifyLink(strings.TrimSpace(link)), Err: err}
+}
+
+func classifyLink(link string) ParseErrorClass {
+	scheme, rest, ok := strings.Cut(link, "://")
+	if !ok {
+		return ParseErrUnknownScheme
+	}
+	scheme = strings.ToLower(scheme)
+	if !knownSchemes[scheme] {
+		return ParseErrUnknownScheme
+	}
+	if (scheme == HTTPProxyIdentifier || scheme == HTTPSProxyScheme) && !IsProxyLink(scheme+"://"+rest) {
+		// A web page or subscription URL rather than a broken proxy link.
+		return ParseErrUnknownScheme
+	}
+
+	if scheme == VmessIdentifier {
+		return classifyVmess(rest)
+	}
+
+	u, err := url.Parse(scheme + "://" + rest)
+	if err != nil {
+		if strings.Contains(err.Error(), "port") {
+			return ParseErrBadPort
+		}
+		return ParseErrMalformed
+	}
+	if scheme == ShadowsocksIdentifier && u.User == nil {
+		// SIP002's predecessor encodes the whole "method:pass@host:port" in base64.
+		if _, err := decodeBase64(u.Host); err != nil {
+			return ParseErrBadBase64
+		}
+		return ParseErrMalformed
+	}
+	if u.Hostname() == "" {
+		return ParseErrMissingHost
+	}
+	if port := u.Port(); (port != "" || !defaultPort(scheme)) && !validPort(port) {
+		return ParseErrBadPort
+	}
+	if scheme == VlessIdentifier && !validID(u.User.Username()) {
+		return ParseErrBadUUID
+	}
+	if scheme == JuicityIdentifier && !uuidPattern.MatchString(u.User.Username()) {
+		return ParseErrBadUUID
+	}
+	if scheme == ShadowsocksIdentifier && u.User != nil {
+		if _, hasPassword := u.User.Password(); !hasPassword {
+			if _, err := decodeBase64(u.User.Username()); err != nil {
+				return ParseErrBadBase64
+			}
+		}
+	}
+	return ParseErrMalformed
+}
+
+func classifyVmess(payload string) ParseErrorClass {
+	payload, _, _ = strings.Cut(payload, "#")
+	decoded, err := decodeBase64(payload)
+	if err != nil {
+		// Some clients write vmess as a URL with the UUID in userinfo instead.
+		if u, uerr := url.Parse("vmess://" + payload); uerr == nil && u.User != nil {
+			if u.Hostname() == "" {
+				return ParseErrMissingHost
+			}
+			if !validID(u.User.Username()) {
+				return ParseErrBadUUID
+			}
+			return ParseErrMalformed
+		}
+		return ParseErrBadBase64
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return ParseErrMalformed
+	}
+	if s, _ := fields["add"].(string); strings.TrimSpace(s) == "" {
+		return ParseErrMissingHost
+	}
+	if !validPort(strings.TrimSpace(fmt.Sprint(fields["port"]))) {
+		return ParseErrBadPort
+	}
+	if id, _ := fields["id"].(string); !validID(id) {
+		return ParseErrBadUUID
+	}
+	return ParseErrMalformed
+}
+
+// validID reports whether id is usable as a VMess/VLESS user ID: a UUID, or a
+// string of up to 30 bytes that xray maps to one.
+func validID(id string) bool {
+	return uuidPattern.MatchString(id) || (id != "" && len(id) <= 30 && !strings.ContainsAny(id, " \t"))
+}
+
+// defaultPort reports whether links of scheme may leave the port out of the host;
+// mieru links carry their ports in the query and naive ones default to 443.
+func defaultPort(scheme string) bool {
+	switch scheme {
+	case Hysteria2Identifier, "hy2", MieruIdentifier, "mierus", NaiveHTTPSScheme, NaiveQUICScheme:
+		return true
+	}
+	return false
+}
+
+func validPort(port string) bool {
+	if port == "" {
+		return false
+	}
+	// Port ranges ("443-445") are accepted by hysteria2 and wireguard links.
+	for _, p := range strings.Split(port, "-") {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		s = unescaped
+	}
+	s = strings.TrimRight(s, "=")
+	if b, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// IsProxyLink reports whether link is a plain proxy URL that can be used as a
+// config: socks://, socks5:// or socks5h://, or an http:// or https:// URL of a
+// host and port with nothing after them but an sni parameter and a remark,
+// which tells a proxy from a web page or a subscription URL.
+func IsProxyLink(link string) bool {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case SocksIdentifier, Socks5Scheme, Socks5HScheme:
+		return true
+	case HTTPProxyIdentifier, HTTPSProxyScheme:
+		if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+			return false
+		}
+		for key := range u.Query() {
+			if key != "sni" {
+				return false
+			}
+		}
+		return (u.Path == "" || u.Path == "/") && u.Opaque == ""
+	}
+	return false
+}
+
+// ProxyUser returns the credentials of a proxy link: user:pass, escaped as in
+// any URL, or the base64 of "user:pass" as v2rayN writes socks:// links.
+func ProxyUser(u *url.Userinfo) (user, pass string) {
+	if u == nil {
+		return "", ""
+	}
+	if pass, ok := u.Password(); ok {
+		return u.Username(), pass
+	}
+	if decoded, err := utils.Base64Decode(u.Username()); err == nil {
+		if user, pass, ok := strings.Cut(string(decoded), ":"); ok {
+			return user, pass
+		}
+	}
+	return u.Username(), ""
+}
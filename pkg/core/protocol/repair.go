@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// linkRepairs are the fixes RepairLink tries, in order, each with what it tells
+// the user it did. They undo the damage links commonly take in public
+// subscriptions: copied out of web pages and chats, or written by tools that
+// don't escape what they put in.
+var linkRepairs = []struct {
+	fixed  string
+	repair func(scheme, rest string) string
+}{
+	{"removed quotes or brackets around the link", nil}, // done by splitLink
+	{"lowercased the scheme", nil},                      // done by splitLink
+	{"removed whitespace from the base64 payload", repairBase64Whitespace},
+	{"decoded HTML entities (&amp;) in the query", repairHTMLEntities},
+	{"escaped % signs not starting an escape sequence", repairStrayPercent},
+	{"escaped #, ?, /, @ or spaces in the user or password", repairUserinfo},
+	{"encoded spaces", repairSpaces},
+	{"bracketed the IPv6 address of the server", repairIPv6Host},
+}
+
+// RepairLink applies the known repairs for almost-valid config links to link:
+// spaces in a path or remark, '#' and other reserved characters left unescaped
+// in a password, HTML entities in the query, stray '%' signs, unbracketed IPv6
+// servers, whitespace in a base64 payload, an upper-case scheme, and quotes or
+// brackets around the link. It returns the repaired link and what was fixed, or
+// link and no fixes when nothing applied. Whether the repaired link parses is
+// up to the caller to check.
+func RepairLink(link string) (string, []string) {
+	var fixes []string
+	scheme, rest, unwrapped, lowered := splitLink(link)
+	if scheme == "" {
+		return link, nil
+	}
+	if unwrapped {
+		fixes = append(fixes, linkRepairs[0].fixed)
+	}
+	if lowered {
+		fixes = append(fixes, linkRepairs[1].fixed)
+	}
+	for _, r := range linkRepairs[2:] {
+		if repaired := r.repair(scheme, rest); repaired != rest {
+			rest = repaired
+			fixes = append(fixes, r.fixed)
+		}
+	}
+	if len(fixes) == 0 {
+		return link, nil
+	}
+	return scheme + "://" + rest, fixes
+}
+
+// linkWrappers are the pairs links are found wrapped in when copied out of
+// markdown, HTML or chat messages.
+var linkWrappers = [][2]string{{`"`, `"`}, {"'", "'"}, {"`", "`"}, {"<", ">"}, {"(", ")"}, {"[", "]"}}
+
+// splitLink trims link, unwraps it and splits it at "://". unwrapped and lowered
+// report whether it was wrapped or its scheme wasn't lower case. scheme is ""
+// for text without a scheme.
+func splitLink(link string) (scheme, rest string, unwrapped, lowered bool) {
+	link = strings.TrimSpace(link)
+	for again := true; again; {
+		again = false
+		for _, w := range linkWrappers {
+			if len(link) > 2 && strings.HasPrefix(link, w[0]) && strings.HasSuffix(link, w[1]) {
+				link = strings.TrimSpace(link[1 : len(link)-1])
+				unwrapped, again = true, true
+			}
+		}
+	}
+	scheme, rest, ok := strings.Cut(link, "://")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, " /?#@") {
+		return "", "", false, false
+	}
+	if lower := strings.ToLower(scheme); lower != scheme {
+		scheme, lowered = lower, true
+	}
+	return scheme, rest, unwrapped, lowered
+}
+
+// isBase64Vmess reports whether rest is the base64 payload of a vmess link
+// rather than the URL form some clients write.
+func isBase64Vmess(scheme, rest string) bool {
+	if scheme != VmessIdentifier {
+		return false
+	}
+	payload, _, _ := strings.Cut(rest, "#")
+	return !strings.Contains(payload, "@")
+}
+
+// repairBase64Whitespace drops the line breaks and spaces a vmess payload picks
+// up when it is wrapped or pasted.
+func repairBase64Whitespace(scheme, rest string) string {
+	if !isBase64Vmess(scheme, rest) {
+		return rest
+	}
+	payload, remark, hasRemark := strings.Cut(rest, "#")
+	payload = strings.Join(strings.Fields(payload), "")
+	if hasRemark {
+		return payload + "#" + remark
+	}
+	return payload
+}
+
+// repairHTMLEntities decodes the &amp; separators of a query copied out of HTML.
+func repairHTMLEntities(scheme, rest string) string {
+	if isBase64Vmess(scheme, rest) {
+		return rest
+	}
+	return strings.NewReplacer("&amp;", "&", "&#38;", "&").Replace(rest)
+}
+
+var strayPercent = regexp.MustCompile(`%([^0-9A-Fa-f]|[0-9A-Fa-f][^0-9A-Fa-f]|[0-9A-Fa-f]?$)`)
+
+// repairStrayPercent escapes '%' signs that don't start an escape sequence, like
+// the one in a password "50%off", which make the link fail to parse.
+func repairStrayPercent(scheme, rest string) string {
+	if isBase64Vmess(scheme, rest) {
+		return rest
+	}
+	for {
+		loc := strayPercent.FindStringIndex(rest)
+		if loc == nil {
+			return rest
+		}
+		rest = rest[:loc[0]] + "%25" + rest[loc[0]+1:]
+	}
+}
+
+// serverAfterAt matches the start of what follows the '@' of a link's userinfo:
+// a host or IPv6 address and a port, or a host followed by a path or query for
+// schemes with a default port.
+var serverAfterAt = regexp.MustCompile(`^(\[[0-9A-Fa-f:.]+\]|[^\s@/?#:\[\]]+|[0-9A-Fa-f:]+)(:\d+([/?#]|$)|[/?])`)
+
+// userinfoEnd returns the index in rest of the '@' ending the userinfo, or -1.
+// It is the last '@' followed by something that looks like a server, so '@' in
+// a password or a remark is told apart from it.
+func userinfoEnd(rest string) int {
+	for at := strings.LastIndex(rest, "@"); at >= 0; at = strings.LastIndex(rest[:at], "@") {
+		if serverAfterAt.MatchString(rest[at+1:]) {
+			return at
+		}
+	}
+	return -1
+}
+
+// repairUserinfo escapes the reserved characters a password is often written
+// with: '#' and '?' cut the link short, '/' ends the authority and ' ' isn't
+// allowed at all.
+func repairUserinfo(scheme, rest string) string {
+	if isBase64Vmess(scheme, rest) {
+		return rest
+	}
+	at := userinfoEnd(rest)
+	if at < 0 {
+		return rest
+	}
+	userinfo := strings.NewReplacer("#", "%23", "?", "%3F", "/", "%2F", " ", "%20", "@", "%40").Replace(rest[:at])
+	return userinfo + rest[at:]
+}
+
+// repairSpaces encodes the spaces left in a path, a query value or a remark.
+func repairSpaces(scheme, rest string) string {
+	if isBase64Vmess(scheme, rest) {
+		return rest
+	}
+	return strings.ReplaceAll(strings.TrimSpace(rest), " ", "%20")
+}
+
+// repairIPv6Host brackets an IPv6 server written without brackets, whose last
+// group is taken for the port.
+func repairIPv6Host(scheme, rest string) string {
+	if isBase64Vmess(scheme, rest) {
+		return rest
+	}
+	start := userinfoEnd(rest) + 1
+	end := start + strings.IndexAny(rest[start:], "/?#")
+	if end < start {
+		end = len(rest)
+	}
+	hostport := rest[start:end]
+	if strings.HasPrefix(hostport, "[") || strings.Count(hostport, ":") < 2 {
+		return rest
+	}
+	// "2001:db8::1:443" is a valid address too; the decimal last group of a
+	// link's server is its port.
+	host, port := hostport, ""
+	if i := strings.LastIndex(hostport, ":"); validPort(hostport[i+1:]) && net.ParseIP(hostport[:i]) != nil {
+		host, port = hostport[:i], hostport[i:]
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+		return rest
+	}
+	return rest[:start] + "[" + host + "]" + port + rest[end:]
+}
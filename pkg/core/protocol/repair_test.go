@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestRepairLink(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString([]byte(`{"add":"1.2.3.4","port":"443","id":"b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5"}`))
+	const id = "b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5"
+	tests := []struct {
+		name  string
+		link  string
+		want  string
+		fixes []string
+	}{
+		{
+			name:  "hash in password",
+			link:  "trojan://pa#ss@example.com:443?security=tls#remark",
+			want:  "trojan://pa%23ss@example.com:443?security=tls#remark",
+			fixes: []string{"escaped #, ?, /, @ or spaces in the user or password"},
+		},
+		{
+			name:  "at sign in password, at sign in remark",
+			link:  "trojan://p@ss@example.com:443#me@channel",
+			want:  "trojan://p%40ss@example.com:443#me@channel",
+			fixes: []string{"escaped #, ?, /, @ or spaces in the user or password"},
+		},
+		{
+			name:  "spaces in path and remark",
+			link:  "vless://" + id + "@example.com:443?type=ws&path=/my path#my config",
+			want:  "vless://" + id + "@example.com:443?type=ws&path=/my%20path#my%20config",
+			fixes: []string{"encoded spaces"},
+		},
+		{
+			name:  "html entities",
+			link:  "vless://" + id + "@example.com:443?type=ws&amp;security=tls",
+			want:  "vless://" + id + "@example.com:443?type=ws&security=tls",
+			fixes: []string{"decoded HTML entities (&amp;) in the query"},
+		},
+		{
+			name:  "stray percent",
+			link:  "trojan://50%off@example.com:443?path=%2F#100%",
+			want:  "trojan://50%25off@example.com:443?path=%2F#100%25",
+			fixes: []string{"escaped % signs not starting an escape sequence"},
+		},
+		{
+			name:  "unbracketed ipv6",
+			link:  "vless://" + id + "@2001:db8::1:443?type=tcp",
+			want:  "vless://" + id + "@[2001:db8::1]:443?type=tcp",
+			fixes: []string{"bracketed the IPv6 address of the server"},
+		},
+		{
+			name:  "wrapped and upper case",
+			link:  ` "VLESS://` + id + `@example.com:443" `,
+			want:  "vless://" + id + "@example.com:443",
+			fixes: []string{"removed quotes or brackets around the link", "lowercased the scheme"},
+		},
+		{
+			name:  "wrapped vmess payload",
+			link:  "vmess://" + payload[:20] + "\n  " + payload[20:],
+			want:  "vmess://" + payload,
+			fixes: []string{"removed whitespace from the base64 payload"},
+		},
+		{
+			name: "valid link",
+			link: "vless://" + id + "@[2001:db8::1]:443?type=ws&path=%2Fws#a%20b",
+			want: "vless://" + id + "@[2001:db8::1]:443?type=ws&path=%2Fws#a%20b",
+		},
+		{
+			name: "no scheme",
+			link: "just some text",
+			want: "just some text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fixes := RepairLink(tt.link)
+			if got != tt.want {
+				t.Errorf("RepairLink() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(fixes, tt.fixes) {
+				t.Errorf("fixes = %q, want %q", fixes, tt.fixes)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// ShadowsocksLink is an ss:// link broken into its parts.
+type ShadowsocksLink struct {
+	Method   string
+	Password string
+	Address  string
+	Port     string
+	Remark   string
+	// Query holds the parameters after the server.
+	Query url.Values
+	// Plugin is the SIP003 plugin of the plugin parameter, or nil.
+	Plugin *ShadowsocksPlugin
+}
+
+// ParseShadowsocksLink parses the forms of ss:// links found in the wild:
+//
+//	ss://base64(method:password)@host:port#remark   (SIP002, any base64 alphabet and padding)
+//	ss://method:password@host:port#remark           (SIP002 with percent-encoded userinfo, the form of 2022 ciphers)
+//	ss://base64(method:password@host:port)#remark   (legacy)
+//
+// Valid keys of 2022-blake3 ciphers are re-encoded in the padded standard base64
+// the cores expect; CheckShadowsocks2022Keys reports the invalid ones.
+func ParseShadowsocksLink(link string) (*ShadowsocksLink, error) {
+	rest, ok := strings.CutPrefix(link, ShadowsocksIdentifier+"://")
+	if !ok {
+		return nil, fmt.Errorf("shadowsocks unreconized: %s", link)
+	}
+	s := &ShadowsocksLink{Query: url.Values{}}
+
+	rest, fragment, _ := strings.Cut(rest, "#")
+	if remark, err := url.PathUnescape(fragment); err == nil {
+		s.Remark = remark
+	} else {
+		s.Remark = fragment
+	}
+	rest, query, _ := strings.Cut(rest, "?")
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+		s.Query = values
+		if v := values.Get("plugin"); v != "" {
+			if s.Plugin, err = ParseShadowsocksPlugin(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	rest = strings.TrimSuffix(rest, "/")
+
+	var userinfo, hostPort string
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		userinfo, hostPort = rest[:i], rest[i+1:]
+		unescaped, err := url.PathUnescape(userinfo)
+		if err != nil {
+			return nil, errors.New("error when decoding secret part")
+		}
+		// base64 has no ':', so a colon means the plain form.
+		if strings.Contains(unescaped, ":") {
+			userinfo = unescaped
+		} else {
+			decoded, err := utils.Base64Decode(unescaped)
+			if err != nil {
+				return nil, errors.New("error when decoding secret part")
+			}
+			userinfo = string(decoded)
+		}
+	} else {
+		decoded, err := utils.Base64Decode(rest)
+		if err != nil {
+			return nil, errors.New("invalid config link")
+		}
+		i := strings.LastIndex(string(decoded), "@")
+		if i < 0 {
+			return nil, errors.New("invalid config link")
+		}
+		userinfo, hostPort = string(decoded[:i]), string(decoded[i+1:])
+	}
+
+	method, password, ok := strings.Cut(userinfo, ":")
+	if !ok || method == "" {
+		return nil, errors.New("error when decoding secret part")
+	}
+	s.Method = strings.ToLower(method)
+	s.Password = password
+
+	var err error
+	s.Address, s.Port, err = net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.ParseUint(s.Port, 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid port %q", s.Port)
+	}
+
+	if keys, err := normalize2022Keys(s.Method, s.Password); err == nil {
+		s.Password = keys
+	}
+	return s, nil
+}
+
+// Shadowsocks2022KeySize returns the size in bytes of the keys of a 2022-blake3
+// method, or 0 for the other methods.
+func Shadowsocks2022KeySize(method string) int {
+	switch strings.ToLower(method) {
+	case "2022-blake3-aes-128-gcm":
+		return 16
+	case "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305":
+		return 32
+	}
+	return 0
+}
+
+// CheckShadowsocks2022Keys returns why password doesn't hold valid keys for a
+// 2022-blake3 method, or nil. Other methods take any password.
+func CheckShadowsocks2022Keys(method, password string) error {
+	_, err := normalize2022Keys(method, password)
+	return err
+}
+
+// normalize2022Keys checks the colon-separated pre-shared keys of a 2022 password
+// (the identity keys of the relays, then the user key) and encodes them in padded
+// standard base64.
+func normalize2022Keys(method, password string) (string, error) {
+	size := Shadowsocks2022KeySize(method)
+	if size == 0 {
+		return password, nil
+	}
+	keys := strings.Split(password, ":")
+	for i, k := range keys {
+		key, err := utils.Base64Decode(k)
+		if err != nil || len(key) != size {
+			return "", fmt.Errorf("%s needs base64 keys of %d bytes, got %q", method, size, k)
+		}
+		keys[i] = base64.StdEncoding.EncodeToString(key)
+	}
+	return strings.Join(keys, ":"), nil
+}
+
+// SIP003 plugins the cores implement natively.
+const (
+	ShadowsocksPluginObfs  = "obfs-local"
+	ShadowsocksPluginV2Ray = "v2ray-plugin"
+)
+
+// shadowsocksPluginAliases maps the names plugins go by in links to the ones above.
+var shadowsocksPluginAliases = map[string]string{
+	"obfs-local":   ShadowsocksPluginObfs,
+	"simple-obfs":  ShadowsocksPluginObfs,
+	"v2ray-plugin": ShadowsocksPluginV2Ray,
+	"xray-plugin":  ShadowsocksPluginV2Ray,
+}
+
+// ShadowsocksPlugin is the SIP003 plugin of an ss:// link, given in the plugin
+// parameter as name;key=value;flag with '\' escaping ';', '=' and '\'.
+type ShadowsocksPlugin struct {
+	// Name is the plugin, with the aliases of obfs-local and v2ray-plugin resolved.
+	Name string
+	// Opts is the options as they appear after the name.
+	Opts string
+	// Args is the options decoded; flags such as tls map to "".
+	Args map[string]string
+}
+
+// ParseShadowsocksPlugin parses the value of the plugin parameter of an ss:// link.
+func ParseShadowsocksPlugin(value string) (*ShadowsocksPlugin, error) {
+	name, opts := value, ""
+	if i := indexUnescaped(value, ';'); i >= 0 {
+		name, opts = value[:i], value[i+1:]
+	}
+	p := &ShadowsocksPlugin{Name: strings.TrimSpace(name), Opts: opts, Args: map[string]string{}}
+	if p.Name == "" {
+		return nil, errors.New("invalid plugin: no name")
+	}
+	if alias, ok := shadowsocksPluginAliases[strings.ToLower(p.Name)]; ok {
+		p.Name = alias
+	}
+	for opts != "" {
+		opt := opts
+		if i := indexUnescaped(opts, ';'); i >= 0 {
+			opt, opts = opts[:i], opts[i+1:]
+		} else {
+			opts = ""
+		}
+		key, val := opt, ""
+		if i := indexUnescaped(opt, '='); i >= 0 {
+			key, val = opt[:i], opt[i+1:]
+		}
+		if key = unescapePluginOpt(key); key != "" {
+			p.Args[key] = unescapePluginOpt(val)
+		}
+	}
+	return p, nil
+}
+
+// Arg returns the option key, or def when it is not set.
+func (p *ShadowsocksPlugin) Arg(key, def string) string {
+	if v, ok := p.Args[key]; ok {
+		return v
+	}
+	return def
+}
+
+// Check returns why the plugin can't be used, or nil.
+func (p *ShadowsocksPlugin) Check() error {
+	switch p.Name {
+	case ShadowsocksPluginObfs:
+		if mode := p.Arg("obfs", "http"); mode != "http" && mode != "tls" {
+			return fmt.Errorf("%s: unknown obfs mode %q", p.Name, mode)
+		}
+	case ShadowsocksPluginV2Ray:
+		if mode := p.Arg("mode", "websocket"); mode != "websocket" && mode != "quic" {
+			return fmt.Errorf("%s: unknown mode %q", p.Name, mode)
+		}
+	default:
+		return fmt.Errorf("shadowsocks plugin %q is not supported", p.Name)
+	}
+	return nil
+}
+
+// String returns the plugin as the value of the plugin parameter.
+func (p *ShadowsocksPlugin) String() string {
+	if p.Opts == "" {
+		return p.Name
+	}
+	return p.Name + ";" + p.Opts
+}
+
+// indexUnescaped returns the index of the first c in s not escaped by '\', or -1.
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapePluginOpt(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestParseShadowsocksLink(t *testing.T) {
+	key16 := "MDEyMzQ1Njc4OWFiY2RlZg=="                     // 16 bytes
+	key32 := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name     string
+		link     string
+		method   string
+		password string
+		host     string
+		remark   string
+	}{
+		{"aead base64 userinfo", "ss://" + b64("aes-256-gcm:secret") + "@example.com:443#My%20Node",
+			"aes-256-gcm", "secret", "example.com", "My Node"},
+		{"2022 plain userinfo", "ss://2022-blake3-aes-128-gcm:MDEyMzQ1Njc4OWFiY2RlZg%3D%3D@1.2.3.4:8388#ss2022",
+			"2022-blake3-aes-128-gcm", key16, "1.2.3.4", "ss2022"},
+		{"2022 url-safe unpadded base64 userinfo", "ss://" + raw("2022-blake3-aes-256-gcm:"+key32) + "@1.2.3.4:8388",
+			"2022-blake3-aes-256-gcm", key32, "1.2.3.4", ""},
+		{"2022 unpadded key", "ss://2022-blake3-chacha20-poly1305:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY@1.2.3.4:8388",
+			"2022-blake3-chacha20-poly1305", key32, "1.2.3.4", ""},
+		{"2022 relay keys", "ss://2022-blake3-aes-128-gcm:" + key16 + ":" + key16 + "@1.2.3.4:8388",
+			"2022-blake3-aes-128-gcm", key16 + ":" + key16, "1.2.3.4", ""},
+		{"upper-case method", "ss://2022-BLAKE3-AES-128-GCM:" + key16 + "@1.2.3.4:8388",
+			"2022-blake3-aes-128-gcm", key16, "1.2.3.4", ""},
+		{"legacy whole link base64", "ss://" + b64("2022-blake3-aes-128-gcm:"+key16+"@1.2.3.4:8388") + "#old",
+			"2022-blake3-aes-128-gcm", key16, "1.2.3.4", "old"},
+		{"plugin query", "ss://" + b64("chacha20-ietf-poly1305:pw") + "@[2001:db8::1]:443/?plugin=v2ray-plugin%3Bmode%3Dwebsocket#q",
+			"chacha20-ietf-poly1305", "pw", "2001:db8::1", "q"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseShadowsocksLink(tt.link)
+			if err != nil {
+				t.Fatalf("ParseShadowsocksLink() error = %v", err)
+			}
+			if s.Method != tt.method || s.Password != tt.password || s.Address != tt.host || s.Remark != tt.remark {
+				t.Errorf("got %s:%s@%s #%s, want %s:%s@%s #%s", s.Method, s.Password, s.Address, s.Remark, tt.method, tt.password, tt.host, tt.remark)
+			}
+		})
+	}
+
+	for _, keys := range []string{key16, "not-base64!", key32 + ":" + key16} {
+		if err := CheckShadowsocks2022Keys("2022-blake3-aes-256-gcm", keys); err == nil {
+			t.Errorf("CheckShadowsocks2022Keys(%q) accepted keys of the wrong size", keys)
+		}
+	}
+	if err := CheckShadowsocks2022Keys("aes-256-gcm", "any password"); err != nil {
+		t.Errorf("CheckShadowsocks2022Keys() rejected the password of a non-2022 method: %v", err)
+	}
+
+	for _, link := range []string{
+		"ss://" + b64("aes-256-gcm") + "@1.2.3.4:8388", // no password
+		"ss://" + b64("aes-256-gcm:pw") + "@1.2.3.4:99999",
+	} {
+		if _, err := ParseShadowsocksLink(link); err == nil {
+			t.Errorf("ParseShadowsocksLink(%q) succeeded", link)
+		}
+	}
+}
+
+func TestParseShadowsocksPlugin(t *testing.T) {
+	tests := []struct {
+		value string
+		name  string
+		args  map[string]string
+	}{
+		{"simple-obfs;obfs=http;obfs-host=www.bing.com", ShadowsocksPluginObfs,
+			map[string]string{"obfs": "http", "obfs-host": "www.bing.com"}},
+		{"v2ray-plugin;tls;host=example.com;path=/ws\\;v2", ShadowsocksPluginV2Ray,
+			map[string]string{"tls": "", "host": "example.com", "path": "/ws;v2"}},
+		{"xray-plugin", ShadowsocksPluginV2Ray, map[string]string{}},
+		{"kcptun;key=a\\=b", "kcptun", map[string]string{"key": "a=b"}},
+	}
+	for _, tt := range tests {
+		p, err := ParseShadowsocksPlugin(tt.value)
+		if err != nil {
+			t.Fatalf("ParseShadowsocksPlugin(%q) error = %v", tt.value, err)
+		}
+		if p.Name != tt.name || !reflect.DeepEqual(p.Args, tt.args) {
+			t.Errorf("ParseShadowsocksPlugin(%q) = %s %v, want %s %v", tt.value, p.Name, p.Args, tt.name, tt.args)
+		}
+		if supported := tt.name != "kcptun"; (p.Check() == nil) != supported {
+			t.Errorf("ParseShadowsocksPlugin(%q).Check() = %v", tt.value, p.Check())
+		}
+	}
+
+	s, err := ParseShadowsocksLink("ss://YWVzLTI1Ni1nY206cHc@1.2.3.4:80/?plugin=obfs-local%3Bobfs%3Dtls#x")
+	if err != nil {
+		t.Fatalf("ParseShadowsocksLink() error = %v", err)
+	}
+	if s.Plugin == nil || s.Plugin.String() != "obfs-local;obfs=tls" {
+		t.Errorf("ParseShadowsocksLink() plugin = %v", s.Plugin)
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
+)
+
+// TestShadowsocks2022 runs a 2022-blake3 server on xray and reaches a local site
+// through it with a client of each core, from a link in the plain SIP002 form.
+func TestShadowsocks2022(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer site.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	key := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+	server := xray.NewXrayService(false, false)
+	if err := server.SetInbound(&xray.Shadowsocks{Address: "127.0.0.1", Port: port, Encryption: "2022-blake3-aes-256-gcm", Password: key}); err != nil {
+		t.Fatal(err)
+	}
+	direct := xray.NewRouter("direct", nil, nil)
+	if err := direct.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	instance, err := server.MakeInstance(context.Background(), direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+
+	// Unpadded key, as some panels emit it.
+	link := "ss://2022-blake3-aes-256-gcm:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY@127.0.0.1:" + port + "#ss2022"
+	for _, coreType := range []CoreType{XrayCoreType, SingboxCoreType} {
+		c := CoreFactory(coreType, false, false)
+		t.Run(c.Name(), func(t *testing.T) {
+			p, err := c.CreateProtocol(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			client, inst, err := c.MakeHttpClient(context.Background(), p, 5*time.Second)
+			if err != nil {
+				t.Fatalf("MakeHttpClient() error = %v", err)
+			}
+			defer inst.Close()
+			res, err := client.Get(site.URL)
+			if err != nil {
+				t.Fatalf("request through the ss2022 server failed: %v", err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if string(body) != "ok" {
+				t.Errorf("body = %q, want ok", body)
+			}
+		})
+	}
+}
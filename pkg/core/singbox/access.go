@@ -0,0 +1,121 @@
+package singbox
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	box "github.com/sagernet/sing-box"
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common/bufio"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// trackAccess makes instance report each connection it routes to rec.
+func trackAccess(instance *box.Box, rec protocol.AccessRecorder) {
+	instance.Router().AppendTracker(&accessTracker{box: instance, rec: rec})
+}
+
+// accessTracker wraps the routed connections to count their bytes.
+type accessTracker struct {
+	box *box.Box
+	rec protocol.AccessRecorder
+}
+
+// entry starts the access entry of a connection routed to matchOutbound, or to
+// the default outbound when nil.
+func (t *accessTracker) entry(metadata adapter.InboundContext, matchOutbound adapter.Outbound) *accessConn {
+	if matchOutbound == nil {
+		matchOutbound = t.box.Outbound().Default()
+	}
+	a := &accessConn{rec: t.rec, entry: protocol.AccessEntry{
+		Time:        time.Now(),
+		Network:     metadata.Network,
+		Destination: metadata.Destination.String(),
+	}}
+	if matchOutbound != nil {
+		a.entry.Outbound = matchOutbound.Tag()
+	}
+	return a
+}
+
+func (t *accessTracker) RoutedConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, matchedRule adapter.Rule, matchOutbound adapter.Outbound) net.Conn {
+	a := t.entry(metadata, matchOutbound)
+	// Reads are what the client sends, writes what it receives.
+	return &accessTCPConn{
+		ExtendedConn: bufio.NewInt64CounterConn(conn, []*atomic.Int64{&a.up}, []*atomic.Int64{&a.down}),
+		accessConn:   a,
+	}
+}
+
+func (t *accessTracker) RoutedPacketConnection(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext, matchedRule adapter.Rule, matchOutbound adapter.Outbound) N.PacketConn {
+	a := t.entry(metadata, matchOutbound)
+	return &accessUDPConn{
+		PacketConn: bufio.NewInt64CounterPacketConn(conn, []*atomic.Int64{&a.up}, nil, []*atomic.Int64{&a.down}, nil),
+		accessConn: a,
+	}
+}
+
+// accessConn is the access entry of a connection, recorded once when it closes.
+type accessConn struct {
+	rec      protocol.AccessRecorder
+	entry    protocol.AccessEntry
+	up, down atomic.Int64
+	once     sync.Once
+}
+
+func (a *accessConn) record() {
+	a.once.Do(func() {
+		a.entry.Up, a.entry.Down = a.up.Load(), a.down.Load()
+		a.entry.Duration = time.Since(a.entry.Time).Milliseconds()
+		a.rec(a.entry)
+	})
+}
+
+type accessTCPConn struct {
+	N.ExtendedConn
+	*accessConn
+}
+
+func (c *accessTCPConn) Close() error {
+	defer c.record()
+	return c.ExtendedConn.Close()
+}
+
+func (c *accessTCPConn) Upstream() any {
+	return c.ExtendedConn
+}
+
+func (c *accessTCPConn) ReaderReplaceable() bool {
+	return true
+}
+
+func (c *accessTCPConn) WriterReplaceable() bool {
+	return true
+}
+
+type accessUDPConn struct {
+	N.PacketConn
+	*accessConn
+}
+
+func (c *accessUDPConn) Close() error {
+	defer c.record()
+	return c.PacketConn.Close()
+}
+
+func (c *accessUDPConn) Upstream() any {
+	return c.PacketConn
+}
+
+func (c *accessUDPConn) ReaderReplaceable() bool {
+	return true
+}
+
+func (c *accessUDPConn) WriterReplaceable() bool {
+	return true
+}
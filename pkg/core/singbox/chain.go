@@ -109,6 +109,9 @@ func (c *Core) MakeChainedInstance(ctx context.Context, hops []protocol.Protocol
 	if err != nil {
 		return nil, fmt.Errorf("chain: failed to create sing-box instance: %w", err)
 	}
+	if rec := protocol.AccessRecorderFrom(ctx); rec != nil {
+		trackAccess(singboxInstance, rec)
+	}
 
 	return singboxInstance, nil
 }
@@ -0,0 +1,49 @@
+package singbox
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// dnsServerTag is the tag of the DNS server set with SetDNSServer.
+const dnsServerTag = "dns-server"
+
+// SetDNSServer makes the test clients built by this core resolve config servers
+// with the DNS server at addr (host:port) instead of the system's, e.g. a shared
+// cache. "" restores the default.
+func (c *Core) SetDNSServer(addr string) {
+	c.DNSServer = addr
+}
+
+// applyDNSServer adds c.DNSServer to opts as the resolver of every outbound.
+func (c *Core) applyDNSServer(opts *option.Options) error {
+	if c.DNSServer == "" {
+		return nil
+	}
+	host, portStr, err := net.SplitHostPort(c.DNSServer)
+	if err != nil {
+		return fmt.Errorf("invalid DNS server %q: %w", c.DNSServer, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid DNS server port %q", portStr)
+	}
+	opts.DNS = &option.DNSOptions{RawDNSOptions: option.RawDNSOptions{
+		Servers: []option.DNSServerOptions{{
+			Type: C.DNSTypeUDP,
+			Tag:  dnsServerTag,
+			Options: &option.RemoteDNSServerOptions{
+				DNSServerAddressOptions: option.DNSServerAddressOptions{Server: host, ServerPort: uint16(port)},
+			},
+		}},
+	}}
+	if opts.Route == nil {
+		opts.Route = &option.RouteOptions{}
+	}
+	opts.Route.DefaultDomainResolver = &option.DomainResolveOptions{Server: dnsServerTag}
+	return nil
+}
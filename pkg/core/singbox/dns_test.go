@@ -0,0 +1,37 @@
+package singbox
+
+import (
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestApplyDNSServer(t *testing.T) {
+	c := NewSingboxService(false, false)
+	var opts option.Options
+	if err := c.applyDNSServer(&opts); err != nil || opts.DNS != nil {
+		t.Fatalf("without a DNS server: DNS %+v, err %v", opts.DNS, err)
+	}
+
+	c.SetDNSServer("127.0.0.1:5353")
+	if err := c.applyDNSServer(&opts); err != nil {
+		t.Fatal(err)
+	}
+	servers := opts.DNS.Servers
+	if len(servers) != 1 || servers[0].Type != C.DNSTypeUDP {
+		t.Fatalf("servers = %+v", servers)
+	}
+	addr := servers[0].Options.(*option.RemoteDNSServerOptions).DNSServerAddressOptions
+	if addr.Server != "127.0.0.1" || addr.ServerPort != 5353 {
+		t.Errorf("server = %+v", addr)
+	}
+	if opts.Route.DefaultDomainResolver.Server != servers[0].Tag {
+		t.Errorf("default domain resolver = %q, want %q", opts.Route.DefaultDomainResolver.Server, servers[0].Tag)
+	}
+
+	c.SetDNSServer("localhost")
+	if err := c.applyDNSServer(&opts); err == nil {
+		t.Error("a DNS server without a port was accepted")
+	}
+}
@@ -0,0 +1,33 @@
+package singbox
+
+import (
+	"net"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// grpcServerName returns the TLS server name of a gRPC config. sing-box has no
+// separate :authority setting and derives it from the server name, so a link that
+// only sets an authority is honored through the SNI.
+func grpcServerName(sni, authority string) string {
+	if sni != "" || authority == "" {
+		return sni
+	}
+	if host, _, err := net.SplitHostPort(authority); err == nil {
+		return host
+	}
+	return authority
+}
+
+// warnGRPC records the gRPC link settings that sing-box cannot express.
+func warnGRPC(d *protocol.Details, sni, authority, mode, userAgent string) {
+	if mode == "multi" {
+		d.Warn("sing-box has no gRPC multi mode; the standard (gun) mode is used")
+	}
+	if sni != "" && authority != "" && grpcServerName("", authority) != sni {
+		d.Warn("sing-box cannot send a gRPC authority different from the SNI; authority %s is ignored", authority)
+	}
+	if userAgent != "" {
+		d.Warn("sing-box cannot set a gRPC user agent; userAgent is ignored")
+	}
+}
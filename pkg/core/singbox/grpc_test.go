@@ -0,0 +1,43 @@
+package singbox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestVless_GrpcOutbound(t *testing.T) {
+	tests := []struct {
+		name       string
+		link       string
+		serverName string
+		warning    string
+	}{
+		{"authority without sni", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&type=grpc&serviceName=%2Fsvc&authority=cdn.example.com#a", "cdn.example.com", ""},
+		{"sni wins", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&sni=h.example.com&type=grpc&serviceName=svc&authority=cdn.example.com#b", "h.example.com", "authority cdn.example.com is ignored"},
+		{"multi mode", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&sni=h.example.com&type=grpc&serviceName=svc&mode=multi&userAgent=ua#c", "h.example.com", "no gRPC multi mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVless(tt.link).(*Vless)
+			if err := v.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			out, err := v.CraftOutboundOptions(false)
+			if err != nil {
+				t.Fatalf("CraftOutboundOptions() error = %v", err)
+			}
+			opts := out.Options.(*option.VLESSOutboundOptions)
+			if opts.Transport.GRPCOptions.ServiceName != "svc" {
+				t.Errorf("service name = %q, want svc", opts.Transport.GRPCOptions.ServiceName)
+			}
+			if opts.TLS.ServerName != tt.serverName {
+				t.Errorf("server name = %q, want %q", opts.TLS.ServerName, tt.serverName)
+			}
+			if details := v.DetailsStr(); tt.warning != "" && !strings.Contains(details, tt.warning) {
+				t.Errorf("details miss warning %q:\n%s", tt.warning, details)
+			}
+		})
+	}
+}
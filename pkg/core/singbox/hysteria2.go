@@ -9,7 +9,6 @@ import (
 
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 
-	"github.com/fatih/color"
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/option"
 	sing_hysteria2 "github.com/sagernet/sing-box/protocol/hysteria2"
@@ -36,6 +35,10 @@ func (h *Hysteria2) Parse() error {
 	}
 
 	h.Password = uri.User.String() // Hysteria2 password (auth string)
+	// Clients percent-encode passwords with reserved characters.
+	if unescaped, err := url.PathUnescape(h.Password); err == nil {
+		h.Password = unescaped
+	}
 
 	h.Address, h.Port, err = net.SplitHostPort(uri.Host)
 	if err != nil {
@@ -68,25 +71,19 @@ func (h *Hysteria2) Parse() error {
 }
 
 func (h *Hysteria2) DetailsStr() string {
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n",
-		color.RedString("Protocol"), h.Name(),
-		color.RedString("Remark"), h.Remark,
-		color.RedString("Address"), h.Address,
-		color.RedString("Port"), h.Port,
-		color.RedString("Password"), h.Password,
-		color.RedString("SNI"), h.SNI)
-
-	if h.Insecure != "" {
-		info += fmt.Sprintf("%s: %v\n",
-			color.RedString("Insecure"), h.Insecure)
-	}
-
+	d := protocol.NewDetails(h.Name(), h.Remark).
+		Add("Address", h.Address).
+		Add("Port", h.Port).
+		Add("Password", h.Password).
+		Add("SNI", h.SNI)
 	if h.ObfusType != "" {
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("Obfuscation Type"), h.ObfusType,
-			color.RedString("Obfuscation Password"), h.ObfusPassword)
+		d.Add("Obfuscation Type", h.ObfusType).Add("Obfuscation Password", h.ObfusPassword)
+	}
+	if protocol.IsTruthy(h.Insecure) {
+		d.Add("Insecure", true)
+		d.Warn("insecure is enabled: the server certificate is not verified and the connection can be intercepted")
 	}
-	return info
+	return d.String()
 }
 
 func (h *Hysteria2) GetLink() string {
@@ -55,6 +55,7 @@ type Vless struct {
 	Flow           string `json:"flow"`
 	QuicSecurity   string `json:"quicSecurity"`
 	Key            string `json:"key"`      // Quic key
+	Seed           string `json:"seed"`     // KCP seed
 	Security       string `json:"security"` // reality or tls
 	PublicKey      string `json:"pbk"`
 	ShortIds       string `json:"sid"`        // Mandatory, the shortId list available to the client, which can be used to distinguish different clients
@@ -62,6 +63,8 @@ type Vless struct {
 	HeaderType     string `json:"headerType"` // TCP HTTP Obfuscation
 	Host           string `json:"host"`       // HTTP, WS
 	Path           string `json:"path"`
+	EarlyData      string `json:"ed"` // WS early data size
+	EarlyDataHdr   string `json:"eh"` // WS early data header
 	Port           string `json:"port"`
 	SNI            string `json:"sni"`           // Server name indication
 	ALPN           string `json:"alpn"`          // Application-Layer Protocol Negotiation
@@ -69,7 +72,9 @@ type Vless struct {
 	AllowInsecure  string `json:"allowInsecure"` // Insecure TLS
 	Type           string `json:"type"`          // Network
 	Remark         string `json:"ps"`            // Config's name
+	Authority      string `json:"authority"`     // GRPC
 	ServiceName    string `json:"serviceName"`   // GRPC
+	UserAgent      string `json:"userAgent"`     // GRPC
 	Mode           string `json:"mode"`          // GRPC
 	OrigLink       string `json:"-"`             // Original link
 }
@@ -80,7 +85,8 @@ type Shadowsocks struct {
 	Encryption string
 	Password   string
 	Remark     string
-	OrigLink   string // Original link
+	Plugin     *protocol.ShadowsocksPlugin // SIP003 plugin, or nil
+	OrigLink   string                      // Original link
 }
 
 type Trojan struct {
@@ -90,10 +96,13 @@ type Trojan struct {
 	Flow           string `json:"flow"`
 	QuicSecurity   string `json:"quicSecurity"`
 	Key            string `json:"key"`        // Quic key
+	Seed           string `json:"seed"`       // KCP seed
 	Security       string `json:"security"`   // tls
 	HeaderType     string `json:"headerType"` // TCP HTTP Obfuscation
 	Host           string `json:"host"`       // HTTP, WS
 	Path           string `json:"path"`
+	EarlyData      string `json:"ed"` // WS early data size
+	EarlyDataHdr   string `json:"eh"` // WS early data header
 	Port           string `json:"port"`
 	SNI            string `json:"sni"`           // Server name indication
 	ALPN           string `json:"alpn"`          // Application-Layer Protocol Negotiation
@@ -101,7 +110,9 @@ type Trojan struct {
 	AllowInsecure  string `json:"allowInsecure"` // Insecure TLS
 	Type           string `json:"type"`          // Network
 	Remark         string // Config's name
+	Authority      string `json:"authority"`   // GRPC
 	ServiceName    string `json:"serviceName"` // GRPC
+	UserAgent      string `json:"userAgent"`   // GRPC
 	Mode           string `json:"mode"`        // GRPC
 
 	// Yes, Trojan can have reality too xD
@@ -133,6 +144,58 @@ type Socks struct {
 	OrigLink string // Original link
 }
 
+// HTTPProxy is a plain HTTP proxy, or one behind TLS with an https:// link.
+type HTTPProxy struct {
+	Remark   string
+	Address  string
+	Port     string
+	Username string
+	Password string
+	TLS      bool
+	SNI      string // from the sni parameter, or the address when it is a name
+	OrigLink string // Original link
+}
+
+type Juicity struct {
+	Remark            string
+	Address           string
+	Port              string
+	UUID              string
+	Password          string
+	CongestionControl string `json:"congestion_control"`
+	SNI               string `json:"sni"`
+	AllowInsecure     string `json:"allow_insecure"`
+	PinnedCertChain   string `json:"pinned_certchain_sha256"`
+	OrigLink          string // Original link
+}
+
+type Mieru struct {
+	Remark        string
+	Address       string
+	Ports         []string // Single ports or ranges, paired with Transports
+	Transports    []string // TCP or UDP
+	Username      string
+	Password      string
+	Profile       string `json:"profile"`
+	MTU           string `json:"mtu"`
+	Multiplexing  string `json:"multiplexing"`
+	HandshakeMode string `json:"handshake-mode"`
+	OrigLink      string // Original link
+}
+
+type Naive struct {
+	Remark       string
+	Address      string
+	Port         string
+	Username     string
+	Password     string
+	QUIC         bool   // naive+quic:// rather than naive+https://
+	Padding      string `json:"padding"`
+	SNI          string `json:"sni"`
+	ExtraHeaders string `json:"extra-headers"` // "Name: value" pairs separated by \r\n
+	OrigLink     string // Original link
+}
+
 type Hysteria2 struct {
 	Remark        string
 	Address       string
@@ -0,0 +1,36 @@
+package singbox
+
+import (
+	"fmt"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// SetIPVersion makes instances built by this core dial config servers over IPv4 (4)
+// or IPv6 (6) only. 0 restores the default.
+func (c *Core) SetIPVersion(v int) {
+	c.IPVersion = v
+}
+
+// forceIPVersion sets the domain strategy of outOpts so its server is only resolved
+// to addresses of c.IPVersion.
+func (c *Core) forceIPVersion(outOpts *option.Outbound) error {
+	var strategy C.DomainStrategy
+	switch c.IPVersion {
+	case 4:
+		strategy = C.DomainStrategyIPv4Only
+	case 6:
+		strategy = C.DomainStrategyIPv6Only
+	default:
+		return nil
+	}
+	wrapper, ok := outOpts.Options.(option.DialerOptionsWrapper)
+	if !ok {
+		return fmt.Errorf("cannot force the IP version of %s outbounds", outOpts.Type)
+	}
+	dialer := wrapper.TakeDialerOptions()
+	dialer.DomainStrategy = option.DomainStrategy(strategy) //nolint:staticcheck
+	wrapper.ReplaceDialerOptions(dialer)
+	return nil
+}
@@ -0,0 +1,28 @@
+package singbox
+
+import (
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestForceIPVersion(t *testing.T) {
+	c := NewSingboxService(false, false)
+	out := &option.Outbound{Type: "socks", Options: &option.SOCKSOutboundOptions{}}
+
+	if err := c.forceIPVersion(out); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.Options.(*option.SOCKSOutboundOptions).DomainStrategy; s != option.DomainStrategy(C.DomainStrategyAsIS) {
+		t.Errorf("default strategy = %v, want as-is", s)
+	}
+
+	c.SetIPVersion(6)
+	if err := c.forceIPVersion(out); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.Options.(*option.SOCKSOutboundOptions).DomainStrategy; s != option.DomainStrategy(C.DomainStrategyIPv6Only) {
+		t.Errorf("strategy = %v, want ipv6_only", s)
+	}
+}
@@ -2,12 +2,42 @@ package singbox
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 )
 
+// errXHTTPUnsupported is returned for xhttp (splithttp) links, which only xray implements.
+var errXHTTPUnsupported = errors.New("xhttp transport is not supported by sing-box, use the xray core")
+
+// errKCPUnsupported is returned for mKCP links, which only xray implements.
+var errKCPUnsupported = errors.New("mKCP transport is not supported by sing-box, use the xray core")
+
+// errJuicityUnsupported and errMieruUnsupported are returned when building an outbound
+// for a protocol that no bundled core implements; such links are parsed and stored only.
+var (
+	errJuicityUnsupported = errors.New("juicity is not implemented by the sing-box or xray core, the link can be stored but not tested")
+	errMieruUnsupported   = errors.New("mieru is not implemented by the sing-box or xray core, the link can be stored but not tested")
+)
+
+// quicInternalServerName is the TLS server name V2Ray's QUIC transport uses when a
+// link has no TLS settings.
+const quicInternalServerName = "quic.internal.v2fly.org"
+
+// checkQUIC rejects the legacy V2Ray QUIC options that sing-box does not implement:
+// packet encryption (quicSecurity) and packet header disguises.
+func checkQUIC(security, header string) error {
+	if security != "" && security != "none" {
+		return fmt.Errorf("QUIC security %q is not supported by sing-box", security)
+	}
+	if header != "" && header != "none" {
+		return fmt.Errorf("QUIC header type %q is not supported by sing-box", header)
+	}
+	return nil
+}
+
 func (c *Core) CreateProtocol(configLink string) (protocol.Protocol, error) {
 	// Remove any spaces
 	configLink = strings.TrimSpace(configLink)
@@ -27,14 +57,22 @@ func (c *Core) CreateProtocol(configLink string) (protocol.Protocol, error) {
 		return NewShadowsocks(configLink), nil
 	case protocol.TrojanIdentifier:
 		return NewTrojan(configLink), nil
-	case protocol.SocksIdentifier:
+	case protocol.SocksIdentifier, protocol.Socks5Scheme, protocol.Socks5HScheme:
 		return NewSocks(configLink), nil
+	case protocol.HTTPProxyIdentifier, protocol.HTTPSProxyScheme:
+		return NewHTTPProxy(configLink), nil
 	case protocol.WireguardIdentifier:
 		return NewWireguard(configLink), nil
 	case protocol.Hysteria2Identifier:
 		return NewHysteria2(configLink), nil
 	case "hy2":
 		return NewHysteria2(configLink), nil
+	case protocol.JuicityIdentifier:
+		return NewJuicity(configLink), nil
+	case protocol.MieruIdentifier, mierusScheme:
+		return NewMieru(configLink), nil
+	case protocol.NaiveHTTPSScheme, protocol.NaiveQUICScheme:
+		return NewNaive(configLink), nil
 
 	default:
 		return nil, errors.New("invalid singbox protocol")
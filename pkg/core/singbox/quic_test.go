@@ -0,0 +1,42 @@
+package singbox
+
+import (
+	"testing"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestVless_QUICOutbound(t *testing.T) {
+	v := NewVless("vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=none&type=quic&quicSecurity=none&headerType=none#q").(*Vless)
+	if err := v.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	out, err := v.CraftOutboundOptions(false)
+	if err != nil {
+		t.Fatalf("CraftOutboundOptions() error = %v", err)
+	}
+	opts := out.Options.(*option.VLESSOutboundOptions)
+	if opts.Transport.Type != "quic" {
+		t.Errorf("transport = %q, want quic", opts.Transport.Type)
+	}
+	if !opts.TLS.Enabled || opts.TLS.ServerName != quicInternalServerName || opts.TLS.UTLS != nil {
+		t.Errorf("unexpected TLS options for QUIC: %+v", opts.TLS)
+	}
+}
+
+func TestLegacyTransportsRejected(t *testing.T) {
+	links := []string{
+		"vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=none&type=quic&quicSecurity=aes-128-gcm&key=k#q",
+		"vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=none&type=quic&headerType=wechat-video#q",
+		"vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=none&type=kcp&seed=s#k",
+	}
+	for _, link := range links {
+		v := NewVless(link).(*Vless)
+		if err := v.Parse(); err != nil {
+			t.Fatalf("Parse(%q) error = %v", link, err)
+		}
+		if _, err := v.CraftOutboundOptions(false); err == nil {
+			t.Errorf("CraftOutboundOptions(%q) succeeded, want an error", link)
+		}
+	}
+}
@@ -4,15 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net"
-	"net/url"
 	"strconv"
-	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/option"
 	sing_shadowsocks "github.com/sagernet/sing-box/protocol/shadowsocks"
@@ -29,81 +25,42 @@ func (s *Shadowsocks) Name() string {
 }
 
 func (s *Shadowsocks) Parse() error {
-	if !strings.HasPrefix(s.OrigLink, protocol.ShadowsocksIdentifier) {
-		return fmt.Errorf("shadowsocks unreconized: %s", s.OrigLink)
-	}
-
-	uri, err := url.Parse(s.OrigLink)
-	if err != nil {
-		return err
-	}
-
-	secondPart := strings.SplitN(s.OrigLink[5:], "@", 2)
-
-	var decoded []byte
-	// Encryption part - b64 encoded (EncryptionType : Password)
-	if len(secondPart) > 1 {
-		decoded, err = utils.Base64Decode(secondPart[0])
-		if err != nil {
-			return errors.New("Error when decoding secret part ")
-		}
-	} else {
-		return errors.New("Invalid config link ")
-	}
-
-	//link := "ss://" + string(decoded) + "@" + secondPart[1]
-	//uri, err := url.Parse(link)
-	//if err != nil {
-	//	return err
-	//}
-	creds := strings.SplitN(string(decoded), ":", 2)
-	if len(creds) != 2 {
-		return errors.New("error when decoding secret part")
-	}
-
-	s.Encryption = creds[0] // Encryption Type
-	s.Password = creds[1]   // Encryption Password
-
-	//hostPortRemark := strings.SplitN(secondPart[1], ":", 2)
-
-	s.Address, s.Port, err = net.SplitHostPort(uri.Host)
+	link, err := protocol.ParseShadowsocksLink(s.OrigLink)
 	if err != nil {
 		return err
 	}
+	s.Encryption = link.Method
+	s.Password = link.Password
+	s.Address = link.Address
+	s.Port = link.Port
+	s.Remark = link.Remark
+	s.Plugin = link.Plugin
 
 	if utils.IsIPv6(s.Address) {
 		s.Address = "[" + s.Address + "]"
 	}
-
-	s.Remark, err = url.PathUnescape(uri.Fragment)
-	if err != nil {
-		s.Remark = uri.Fragment
-	}
-
-	//s.Address = hostPortRemark[0]
-	//
-	//PortRemark := strings.SplitN(hostPortRemark[1], "#", 2)
-	//s.Port = PortRemark[0]
-
-	//remarkStr, _, _ := strings.Cut(PortRemark[1], "\n")
-
-	//s.Remark, err = url.PathUnescape(remarkStr)
-	//if err != nil {
-	//	s.Remark = remarkStr
-	//}
-
 	return nil
 }
 
 func (s *Shadowsocks) DetailsStr() string {
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n%s: %s\n",
-		color.RedString("Protocol"), s.Name(),
-		color.RedString("Remark"), s.Remark,
-		color.RedString("IP"), s.Address,
-		color.RedString("Port"), s.Port,
-		color.RedString("Encryption"), s.Encryption,
-		color.RedString("Password"), s.Password)
-	return info
+	d := protocol.NewDetails(s.Name(), s.Remark).
+		Add("Address", s.Address).
+		Add("Port", s.Port).
+		Add("Encryption", s.Encryption).
+		Add("Password", s.Password)
+	if s.Plugin != nil {
+		d.Add("Plugin", s.Plugin.String())
+		if err := s.Plugin.Check(); err != nil {
+			d.Warn("%v", err)
+		}
+	}
+	if w := protocol.ShadowsocksCipherWarning(s.Encryption); w != "" {
+		d.Warn("%s", w)
+	}
+	if err := protocol.CheckShadowsocks2022Keys(s.Encryption, s.Password); err != nil {
+		d.Warn("%v", err)
+	}
+	return d.String()
 }
 
 func (s *Shadowsocks) GetLink() string {
@@ -128,6 +85,9 @@ func (s *Shadowsocks) CraftInboundOptions() *option.Inbound {
 }
 
 func (s *Shadowsocks) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, error) {
+	if err := protocol.CheckShadowsocks2022Keys(s.Encryption, s.Password); err != nil {
+		return nil, err
+	}
 	port, _ := strconv.Atoi(s.Port)
 
 	opts := option.ShadowsocksOutboundOptions{
@@ -139,6 +99,14 @@ func (s *Shadowsocks) CraftOutboundOptions(allowInsecure bool) (*option.Outbound
 		Password: s.Password,
 		Method:   s.Encryption,
 	}
+	// sing-box implements the SIP003 plugins itself, from the options of the link.
+	if s.Plugin != nil {
+		if err := s.Plugin.Check(); err != nil {
+			return nil, err
+		}
+		opts.Plugin = s.Plugin.Name
+		opts.PluginOptions = s.Plugin.Opts
+	}
 
 	return &option.Outbound{
 		Type:    "shadowsocks",
@@ -10,13 +10,16 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 
 	box "github.com/sagernet/sing-box"
+	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/adapter/endpoint"
 	"github.com/sagernet/sing-box/adapter/inbound"
 	boxOutbound "github.com/sagernet/sing-box/adapter/outbound"
 	boxService "github.com/sagernet/sing-box/adapter/service"
 	"github.com/sagernet/sing-box/dns"
+	dnsTransport "github.com/sagernet/sing-box/dns/transport"
 	"github.com/sagernet/sing-box/log"
 	"github.com/sagernet/sing-box/option"
+	boxHttp "github.com/sagernet/sing-box/protocol/http"
 	"github.com/sagernet/sing-box/protocol/hysteria2"
 	"github.com/sagernet/sing-box/protocol/shadowsocks"
 	"github.com/sagernet/sing-box/protocol/socks"
@@ -37,6 +40,16 @@ type Core struct {
 	Log     logger.ContextLogger
 
 	AllowInsecure bool
+
+	// IPVersion, when 4 or 6, is the only address family config servers are dialed over.
+	IPVersion int
+
+	// Dial holds the socket options injected into every built outbound.
+	Dial protocol.DialOptions
+
+	// DNSServer, when set, is the host:port of the DNS server test clients
+	// resolve config servers with.
+	DNSServer string
 }
 
 func (c *Core) Name() string {
@@ -116,6 +129,12 @@ func (c *Core) MakeInstance(ctx context.Context, outbound protocol.Protocol) (pr
 	if err != nil {
 		return nil, err
 	}
+	if err := c.applyDialOptions(outOpts); err != nil {
+		return nil, err
+	}
+	if err := c.forceIPVersion(outOpts); err != nil {
+		return nil, err
+	}
 
 	opts := option.Options{
 		Inbounds: []option.Inbound{},
@@ -146,6 +165,9 @@ func (c *Core) MakeInstance(ctx context.Context, outbound protocol.Protocol) (pr
 	if err != nil {
 		return nil, err
 	}
+	if rec := protocol.AccessRecorderFrom(ctx); rec != nil {
+		trackAccess(singboxInstance, rec)
+	}
 
 	return singboxInstance, nil
 }
@@ -159,6 +181,12 @@ func (c *Core) MakeHttpClient(ctx context.Context, outbound protocol.Protocol, m
 	}
 	outboundTag := "http_client_outbound"
 	outOpts.Tag = outboundTag
+	if err := c.applyDialOptions(outOpts); err != nil {
+		return nil, nil, err
+	}
+	if err := c.forceIPVersion(outOpts); err != nil {
+		return nil, nil, err
+	}
 
 	opts := option.Options{
 		Inbounds: []option.Inbound{},
@@ -176,17 +204,11 @@ func (c *Core) MakeHttpClient(ctx context.Context, outbound protocol.Protocol, m
 		}
 	}
 
-	ctx = service.ContextWithDefaultRegistry(ctx)
-	outboundRegistry := boxOutbound.NewRegistry()
-	hysteria2.RegisterOutbound(outboundRegistry)
-	shadowsocks.RegisterOutbound(outboundRegistry)
-	socks.RegisterOutbound(outboundRegistry)
-	trojan.RegisterOutbound(outboundRegistry)
-	vless.RegisterOutbound(outboundRegistry)
-	vmess.RegisterOutbound(outboundRegistry)
-	wireguard.RegisterOutbound(outboundRegistry)
+	if err := c.applyDNSServer(&opts); err != nil {
+		return nil, nil, err
+	}
 
-	ctx = box.Context(ctx, inbound.NewRegistry(), outboundRegistry, endpoint.NewRegistry(), dns.NewTransportRegistry(), boxService.NewRegistry())
+	ctx = clientBoxContext(ctx)
 
 	instance, err := box.New(box.Options{
 		Options: opts,
@@ -211,12 +233,41 @@ func (c *Core) MakeHttpClient(ctx context.Context, outbound protocol.Protocol, m
 		return nil, nil, fmt.Errorf("outbound adapter not found for tag: %s. Available: %v", outboundTag, available)
 	}
 
-	dialFunc := func(ctx context.Context, network, addr string) (net.Conn, error) {
-		return outboundAdapter.DialContext(ctx, network, M.ParseSocksaddr(addr))
+	tr := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext:       makeDialFunc(outboundAdapter, out.Name()),
 	}
 
-	if out.Name() == protocol.WireguardIdentifier {
-		dialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return &http.Client{
+		Transport: tr,
+		Timeout:   maxDelay,
+	}, instance, nil
+}
+
+// clientBoxContext returns a context carrying the registries needed to build
+// outbound-only sing-box instances.
+func clientBoxContext(ctx context.Context) context.Context {
+	ctx = service.ContextWithDefaultRegistry(ctx)
+	outboundRegistry := boxOutbound.NewRegistry()
+	hysteria2.RegisterOutbound(outboundRegistry)
+	boxHttp.RegisterOutbound(outboundRegistry)
+	shadowsocks.RegisterOutbound(outboundRegistry)
+	socks.RegisterOutbound(outboundRegistry)
+	trojan.RegisterOutbound(outboundRegistry)
+	vless.RegisterOutbound(outboundRegistry)
+	vmess.RegisterOutbound(outboundRegistry)
+	wireguard.RegisterOutbound(outboundRegistry)
+
+	dnsRegistry := dns.NewTransportRegistry()
+	dnsTransport.RegisterUDP(dnsRegistry)
+
+	return box.Context(ctx, inbound.NewRegistry(), outboundRegistry, endpoint.NewRegistry(), dnsRegistry, boxService.NewRegistry())
+}
+
+// makeDialFunc returns a DialContext that goes through the given outbound adapter.
+func makeDialFunc(outboundAdapter adapter.Outbound, protocolName string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if protocolName == protocol.WireguardIdentifier {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
 			host, port, err := net.SplitHostPort(addr)
 			if err != nil {
 				return nil, err
@@ -228,16 +279,97 @@ func (c *Core) MakeHttpClient(ctx context.Context, outbound protocol.Protocol, m
 			return outboundAdapter.DialContext(ctx, network, M.ParseSocksaddr(ips[0].To4().String()+":"+port))
 		}
 	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return outboundAdapter.DialContext(ctx, network, M.ParseSocksaddr(addr))
+	}
+}
+
+// MakeHttpClientPool loads all outbounds into a single sing-box instance, each under its
+// own tag, and returns one HTTP client per outbound.
+func (c *Core) MakeHttpClientPool(ctx context.Context, outbounds []protocol.Protocol, maxDelay time.Duration) ([]protocol.PooledClient, protocol.Instance, error) {
+	clients := make([]protocol.PooledClient, len(outbounds))
+	tags := make([]string, len(outbounds))
+	names := make([]string, len(outbounds))
+	var outOptions []option.Outbound
+
+	for i, outbound := range outbounds {
+		out, ok := outbound.(Protocol)
+		if !ok {
+			clients[i].Err = fmt.Errorf("protocol is not supported by sing-box")
+			continue
+		}
+		outOpts, err := out.CraftOutboundOptions(c.AllowInsecure)
+		if err != nil {
+			clients[i].Err = err
+			continue
+		}
+		outOpts.Tag = fmt.Sprintf("pool-%d", i)
+		if err := c.applyDialOptions(outOpts); err != nil {
+			clients[i].Err = err
+			continue
+		}
+		if err := c.forceIPVersion(outOpts); err != nil {
+			clients[i].Err = err
+			continue
+		}
+		tags[i] = outOpts.Tag
+		names[i] = out.Name()
+		outOptions = append(outOptions, *outOpts)
+	}
 
-	tr := &http.Transport{
-		DisableKeepAlives: true,
-		DialContext:       dialFunc,
+	if len(outOptions) == 0 {
+		return clients, nil, fmt.Errorf("no outbound in the pool could be built")
 	}
 
-	return &http.Client{
-		Transport: tr,
-		Timeout:   maxDelay,
-	}, instance, nil
+	opts := option.Options{
+		Inbounds:  []option.Inbound{},
+		Outbounds: outOptions,
+		Log: &option.LogOptions{
+			Disabled: true,
+		},
+	}
+	if c.Verbose {
+		opts.Log = &option.LogOptions{
+			Disabled: false,
+			Level:    "trace",
+		}
+	}
+
+	if err := c.applyDNSServer(&opts); err != nil {
+		return nil, nil, err
+	}
+
+	instance, err := box.New(box.Options{
+		Options: opts,
+		Context: clientBoxContext(ctx),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return nil, nil, err
+	}
+
+	for i, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		outboundAdapter, ok := instance.Outbound().Outbound(tag)
+		if !ok {
+			clients[i].Err = fmt.Errorf("outbound adapter not found for tag: %s", tag)
+			continue
+		}
+		clients[i].Client = &http.Client{
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				DialContext:       makeDialFunc(outboundAdapter, names[i]),
+			},
+			Timeout: maxDelay,
+		}
+	}
+
+	return clients, instance, nil
 }
 
 //
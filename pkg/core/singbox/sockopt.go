@@ -0,0 +1,69 @@
+package singbox
+
+import (
+	"fmt"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// SetDialOptions sets the dialer options of the outbounds built by this core.
+func (c *Core) SetDialOptions(o protocol.DialOptions) {
+	c.Dial = o
+}
+
+// applyDialOptions copies c.Dial into the dialer options of outOpts.
+func (c *Core) applyDialOptions(outOpts *option.Outbound) error {
+	if c.Dial.IsZero() {
+		return nil
+	}
+	wrapper, ok := outOpts.Options.(option.DialerOptionsWrapper)
+	if !ok {
+		return fmt.Errorf("cannot set dialer options of %s outbounds", outOpts.Type)
+	}
+	dialer := wrapper.TakeDialerOptions()
+
+	if c.Dial.TCPFastOpen {
+		dialer.TCPFastOpen = true
+	}
+	if c.Dial.Interface != "" {
+		dialer.BindInterface = c.Dial.Interface
+	}
+	if c.Dial.Mark != 0 {
+		dialer.RoutingMark = option.FwMark(c.Dial.Mark)
+	}
+	var strategy C.DomainStrategy
+	switch c.Dial.DomainStrategy {
+	case protocol.DomainStrategyPreferIPv4:
+		strategy = C.DomainStrategyPreferIPv4
+	case protocol.DomainStrategyPreferIPv6:
+		strategy = C.DomainStrategyPreferIPv6
+	case protocol.DomainStrategyIPv4Only:
+		strategy = C.DomainStrategyIPv4Only
+	case protocol.DomainStrategyIPv6Only:
+		strategy = C.DomainStrategyIPv6Only
+	}
+	if c.Dial.HappyEyeballs > 0 {
+		// sing-box races the other family after fallback_delay with a prefer_* strategy.
+		if strategy == C.DomainStrategyAsIS {
+			strategy = C.DomainStrategyPreferIPv4
+		}
+		dialer.FallbackDelay = badoption.Duration(c.Dial.HappyEyeballs)
+	}
+	if strategy != C.DomainStrategyAsIS {
+		dialer.DomainStrategy = option.DomainStrategy(strategy) //nolint:staticcheck
+	}
+	wrapper.ReplaceDialerOptions(dialer)
+
+	// sing-box fragments the ClientHello of its own TLS client, so outbounds
+	// without TLS have nothing to split.
+	if tlsWrapper, ok := outOpts.Options.(option.OutboundTLSOptionsWrapper); ok && c.Dial.Fragment {
+		if tls := tlsWrapper.TakeOutboundTLSOptions(); tls != nil && tls.Enabled {
+			tls.Fragment = true
+		}
+	}
+	return nil
+}
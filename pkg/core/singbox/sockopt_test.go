@@ -0,0 +1,55 @@
+package singbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestApplyDialOptions(t *testing.T) {
+	c := NewSingboxService(false, false)
+	c.SetDialOptions(protocol.DialOptions{
+		TCPFastOpen:   true,
+		Interface:     "eth1",
+		Mark:          255,
+		HappyEyeballs: 300 * time.Millisecond,
+	})
+	out := &option.Outbound{Type: "socks", Options: &option.SOCKSOutboundOptions{}}
+	if err := c.applyDialOptions(out); err != nil {
+		t.Fatal(err)
+	}
+
+	d := out.Options.(*option.SOCKSOutboundOptions).DialerOptions
+	if !d.TCPFastOpen || d.BindInterface != "eth1" || d.RoutingMark != 255 {
+		t.Errorf("dialer options = %+v", d)
+	}
+	// Happy Eyeballs without a strategy prefers IPv4 and races IPv6 after the delay.
+	if d.DomainStrategy != option.DomainStrategy(C.DomainStrategyPreferIPv4) || time.Duration(d.FallbackDelay) != 300*time.Millisecond {
+		t.Errorf("strategy %v, fallback delay %v", d.DomainStrategy, d.FallbackDelay)
+	}
+}
+
+func TestApplyDialOptions_Fragment(t *testing.T) {
+	c := NewSingboxService(false, false)
+	c.SetDialOptions(protocol.DialOptions{Fragment: true})
+	opts := &option.VLESSOutboundOptions{}
+	opts.TLS = &option.OutboundTLSOptions{Enabled: true, ServerName: "example.com"}
+	if err := c.applyDialOptions(&option.Outbound{Type: "vless", Options: opts}); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.TLS.Fragment {
+		t.Error("ClientHello of a TLS outbound isn't fragmented")
+	}
+
+	plain := &option.VLESSOutboundOptions{}
+	if err := c.applyDialOptions(&option.Outbound{Type: "vless", Options: plain}); err != nil {
+		t.Fatal(err)
+	}
+	if plain.TLS != nil && plain.TLS.Fragment {
+		t.Error("outbound without TLS got a fragmented ClientHello")
+	}
+}
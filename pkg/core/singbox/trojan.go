@@ -13,7 +13,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/option"
 	sing_trojan "github.com/sagernet/sing-box/protocol/trojan"
@@ -41,6 +40,10 @@ func (t *Trojan) Parse() error {
 	}
 
 	t.Password = uri.User.String()
+	// Clients percent-encode passwords with reserved characters.
+	if unescaped, err := url.PathUnescape(t.Password); err == nil {
+		t.Password = unescaped
+	}
 	t.Address, t.Port, err = net.SplitHostPort(uri.Host)
 	if err != nil {
 		return fmt.Errorf("failed to split host and port for Trojan link: %w", err)
@@ -81,7 +84,11 @@ func (t *Trojan) Parse() error {
 	t.AllowInsecure = query.Get("allowInsecure")
 	t.QuicSecurity = query.Get("quicSecurity") // For QUIC transport
 	t.Key = query.Get("key")                   // For QUIC transport
-	// t.Authority = query.Get("authority") // Not a standard Trojan query param
+	t.Seed = query.Get("seed")                 // For KCP transport
+	t.EarlyData = query.Get("ed")              // WS early data size
+	t.EarlyDataHdr = query.Get("eh")           // WS early data header
+	t.Authority = query.Get("authority")       // grpc
+	t.UserAgent = query.Get("userAgent")       // grpc
 
 	unescapedRemark, err := url.PathUnescape(uri.Fragment)
 	if err != nil {
@@ -91,7 +98,7 @@ func (t *Trojan) Parse() error {
 	}
 
 	// Apply defaults or adjustments
-	if t.Type == "ws" || t.Type == "http" { // For Sing-box, common transports for Trojan
+	if t.Type == "ws" || t.Type == "httpupgrade" || t.Type == "http" { // For Sing-box, common transports for Trojan
 		if t.Path == "" {
 			t.Path = "/"
 		}
@@ -110,75 +117,43 @@ func (t *Trojan) Parse() error {
 }
 
 func (t *Trojan) DetailsStr() string {
-	copyV := *t
-	if copyV.Flow == "" || copyV.Type == "grpc" {
-		copyV.Flow = "none"
+	d := protocol.NewDetails(t.Name(), t.Remark).
+		Add("Address", t.Address).
+		Add("Port", t.Port).
+		Add("Password", t.Password).
+		AddTransport(protocol.Transport{
+			Network:      t.Type,
+			HeaderType:   t.HeaderType,
+			Host:         t.Host,
+			Path:         t.Path,
+			EarlyData:    t.EarlyData,
+			EarlyDataHdr: t.EarlyDataHdr,
+			ServiceName:  t.ServiceName,
+			Authority:    t.Authority,
+			UserAgent:    t.UserAgent,
+			Mode:         t.Mode,
+			Seed:         t.Seed,
+			QUICSecurity: t.QuicSecurity,
+			QUICKey:      t.Key,
+		}).
+		AddTLS(protocol.TLS{
+			Security:      t.Security,
+			SNI:           t.SNI,
+			Host:          t.Host,
+			ALPN:          t.ALPN,
+			Fingerprint:   t.TlsFingerprint,
+			AllowInsecure: t.AllowInsecure,
+			PublicKey:     t.PublicKey,
+			ShortID:       t.ShortIds,
+			SpiderX:       t.SpiderX,
+		})
+	if t.Security != "tls" && t.Security != "reality" {
+		d.Warn("no TLS: the trojan password and traffic are sent in cleartext")
 	}
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n%s: %s\n",
-		color.RedString("Protocol"), t.Name(),
-		color.RedString("Remark"), t.Remark,
-		color.RedString("Network"), t.Type,
-		color.RedString("Address"), t.Address,
-		color.RedString("Port"), t.Port,
-		color.RedString("Password"), t.Password,
-		color.RedString("Flow"), copyV.Flow,
-	)
-
-	if copyV.Type == "" {
-
-	} else if copyV.Type == "http" || copyV.Type == "httpupgrade" || copyV.Type == "ws" || copyV.Type == "h2" || copyV.Type == "splithttp" {
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("Host"), copyV.Host,
-			color.RedString("Path"), copyV.Path)
-	} else if copyV.Type == "kcp" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("KCP Seed"), copyV.Path)
-	} else if copyV.Type == "grpc" {
-		if copyV.ServiceName == "" {
-			copyV.ServiceName = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n", color.RedString("ServiceName"), copyV.ServiceName)
+	if t.Type == "grpc" {
+		warnGRPC(d, t.SNI, t.Authority, t.Mode, t.UserAgent)
 	}
-
-	if copyV.Security == "reality" {
-		info += fmt.Sprintf("%s: reality\n", color.RedString("TLS"))
-		if copyV.SpiderX == "" {
-			copyV.SpiderX = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("Public key"), copyV.PublicKey,
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ShortID"), copyV.ShortIds,
-			color.RedString("SpiderX"), copyV.SpiderX,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint,
-		)
-	} else if copyV.Security == "tls" {
-		info += fmt.Sprintf("%s: tls\n", color.RedString("TLS"))
-		if len(copyV.SNI) == 0 {
-			if copyV.Host != "" {
-				copyV.SNI = copyV.Host
-			} else {
-				copyV.SNI = "none"
-			}
-		}
-		if len(copyV.ALPN) == 0 {
-			copyV.ALPN = "none"
-		}
-		if copyV.TlsFingerprint == "" {
-			copyV.TlsFingerprint = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ALPN"), copyV.ALPN,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint)
-
-		if t.AllowInsecure != "" {
-			info += fmt.Sprintf("%s: %v\n",
-				color.RedString("Insecure"), t.AllowInsecure)
-		}
-	} else {
-		info += fmt.Sprintf("%s: none\n", color.RedString("TLS"))
-	}
-	return info
+	return d.String()
 }
 
 func (t *Trojan) GetLink() string {
@@ -289,14 +264,20 @@ func (t *Trojan) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, err
 	}
 
 	switch t.Type {
-	case "tcp":
-		break
+	case "", "tcp", "raw":
+		// Plain TCP is sing-box's default and has no transport options.
+		transport = nil
+	case "xhttp", "splithttp":
+		return nil, errXHTTPUnsupported
+	case "kcp":
+		return nil, errKCPUnsupported
 	case "ws":
+		path, ed := protocol.ParseEarlyData(t.Path, t.EarlyData, t.EarlyDataHdr)
 		transport.WebsocketOptions = option.V2RayWebsocketOptions{
-			Path:                t.Path,
+			Path:                path,
 			Headers:             badoption.HTTPHeader{},
-			MaxEarlyData:        0,
-			EarlyDataHeaderName: "",
+			MaxEarlyData:        ed.MaxBytes,
+			EarlyDataHeaderName: ed.Header,
 		}
 		transport.WebsocketOptions.Headers["host"] = badoption.Listable[string]{t.Host}
 		transport.WebsocketOptions.Headers["User-Agent"] = badoption.Listable[string]{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.131 Safari/537.36"}
@@ -317,9 +298,11 @@ func (t *Trojan) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, err
 		}
 		break
 	case "httpupgrade":
+		// sing-box has no early data for httpupgrade; keep ?ed= out of the request path.
+		path, _ := protocol.ParseEarlyData(t.Path, "", "")
 		transport.HTTPUpgradeOptions = option.V2RayHTTPUpgradeOptions{
 			Host:    t.Host,
-			Path:    t.Path,
+			Path:    path,
 			Headers: nil,
 		}
 		break
@@ -335,10 +318,17 @@ func (t *Trojan) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, err
 		}
 		break
 	case "quic":
+		if err := checkQUIC(t.QuicSecurity, t.HeaderType); err != nil {
+			return nil, err
+		}
 		transport.QUICOptions = option.V2RayQUICOptions{}
 		break
 	}
 
+	serverName := t.SNI
+	if t.Type == "grpc" {
+		serverName = grpcServerName(t.SNI, t.Authority)
+	}
 	opts := option.TrojanOutboundOptions{
 		DialerOptions: option.DialerOptions{},
 		ServerOptions: option.ServerOptions{
@@ -350,7 +340,7 @@ func (t *Trojan) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, err
 		OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
 			TLS: &option.OutboundTLSOptions{
 				Enabled:    tls,
-				ServerName: t.SNI,
+				ServerName: serverName,
 				ALPN:       alpn,
 				UTLS: &option.OutboundUTLSOptions{
 					Enabled:     true,
@@ -368,6 +358,15 @@ func (t *Trojan) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, err
 		}
 	}
 
+	if t.Type == "quic" {
+		// QUIC runs on the standard TLS stack, and V2Ray's QUIC uses TLS against an
+		// internal server name when the link has none.
+		opts.TLS.UTLS = nil
+		if !tls {
+			opts.TLS.Enabled, opts.TLS.Insecure, opts.TLS.ServerName = true, true, quicInternalServerName
+		}
+	}
+
 	return &option.Outbound{
 		Type:    t.Name(),
 		Options: &opts,
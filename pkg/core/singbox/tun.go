@@ -51,7 +51,13 @@ func (t *Tun) Name() string {
 func (t *Tun) Parse() error { return nil }
 
 func (t *Tun) DetailsStr() string {
-	return fmt.Sprintf("%s (iface=%s, v4=%s, mtu=%d, autoroute=%v)", t.Name(), t.InterfaceName, t.Inet4Address, t.MTU, t.AutoRoute)
+	return protocol.NewDetails(t.Name(), t.Remark).
+		Add("Interface", t.InterfaceName).
+		Add("IPv4", t.Inet4Address).
+		AddIfSet("IPv6", t.Inet6Address).
+		Add("MTU", t.MTU).
+		Add("AutoRoute", t.AutoRoute).
+		String()
 }
 
 func (t *Tun) GetLink() string {
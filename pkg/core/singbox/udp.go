@@ -0,0 +1,31 @@
+package singbox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	box "github.com/sagernet/sing-box"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// ListenPacket returns a UDP connection relayed by the outbound of an instance
+// made by MakeHttpClient.
+func (c *Core) ListenPacket(ctx context.Context, instance protocol.Instance, dest string) (net.PacketConn, error) {
+	boxInstance, ok := instance.(*box.Box)
+	if !ok {
+		return nil, protocol.ErrForeignInstance
+	}
+	outboundAdapter, ok := boxInstance.Outbound().Outbound("http_client_outbound")
+	if !ok {
+		return nil, fmt.Errorf("outbound adapter not found for tag: http_client_outbound")
+	}
+	if !slices.Contains(outboundAdapter.Network(), N.NetworkUDP) {
+		return nil, fmt.Errorf("%s outbound does not relay UDP", outboundAdapter.Type())
+	}
+	return outboundAdapter.ListenPacket(ctx, M.ParseSocksaddr(dest))
+}
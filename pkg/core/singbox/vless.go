@@ -14,7 +14,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/option"
 	sing_vless "github.com/sagernet/sing-box/protocol/vless"
@@ -91,7 +90,7 @@ func (v *Vless) Parse() error {
 	//}
 	//v.Port = uint16(portUint)
 
-	if v.HeaderType == "http" || v.Type == "ws" || v.Type == "h2" {
+	if v.HeaderType == "http" || v.Type == "ws" || v.Type == "httpupgrade" || v.Type == "h2" {
 		if v.Path == "" {
 			v.Path = "/"
 		}
@@ -101,73 +100,49 @@ func (v *Vless) Parse() error {
 }
 
 func (v *Vless) DetailsStr() string {
-	copyV := *v
-	if copyV.Flow == "" || copyV.Type == "grpc" {
-		copyV.Flow = "none"
+	d := protocol.NewDetails(v.Name(), v.Remark).
+		Add("Address", v.Address).
+		Add("Port", v.Port).
+		Add("UUID", v.ID)
+	if v.Type != "grpc" {
+		d.Add("Flow", v.Flow)
 	}
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n%s: %s\n",
-		color.RedString("Protocol"), v.Name(),
-		color.RedString("Remark"), v.Remark,
-		color.RedString("Network"), v.Type,
-		color.RedString("Address"), v.Address,
-		color.RedString("Port"), v.Port,
-		color.RedString("UUID"), v.ID,
-		color.RedString("Flow"), copyV.Flow)
-	if copyV.Type == "" {
-
-	} else if copyV.HeaderType == "http" || copyV.Type == "httpupgrade" || copyV.Type == "ws" || copyV.Type == "h2" || copyV.Type == "splithttp" {
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("Host"), copyV.Host,
-			color.RedString("Path"), copyV.Path)
-	} else if copyV.Type == "kcp" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("KCP Seed"), copyV.Path)
-	} else if copyV.Type == "grpc" {
-		if copyV.ServiceName == "" {
-			copyV.ServiceName = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n", color.RedString("ServiceName"), copyV.ServiceName)
+	d.AddTransport(protocol.Transport{
+		Network:      v.Type,
+		HeaderType:   v.HeaderType,
+		Host:         v.Host,
+		Path:         v.Path,
+		EarlyData:    v.EarlyData,
+		EarlyDataHdr: v.EarlyDataHdr,
+		ServiceName:  v.ServiceName,
+		Authority:    v.Authority,
+		UserAgent:    v.UserAgent,
+		Mode:         v.Mode,
+		Seed:         v.Seed,
+		QUICSecurity: v.QuicSecurity,
+		QUICKey:      v.Key,
+	})
+	d.AddTLS(protocol.TLS{
+		Security:      v.Security,
+		SNI:           v.SNI,
+		Host:          v.Host,
+		ALPN:          v.ALPN,
+		Fingerprint:   v.TlsFingerprint,
+		AllowInsecure: v.AllowInsecure,
+		PublicKey:     v.PublicKey,
+		ShortID:       v.ShortIds,
+		SpiderX:       v.SpiderX,
+	})
+	if v.Security != "tls" && v.Security != "reality" {
+		d.Warn("no TLS: traffic to the server is not encrypted")
 	}
-
-	if copyV.Security == "reality" {
-		info += fmt.Sprintf("%s: reality\n", color.RedString("TLS"))
-		if copyV.SpiderX == "" {
-			copyV.SpiderX = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("Public key"), copyV.PublicKey,
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ShortID"), copyV.ShortIds,
-			color.RedString("SpiderX"), copyV.SpiderX,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint,
-		)
-	} else if copyV.Security == "tls" {
-		info += fmt.Sprintf("%s: tls\n", color.RedString("TLS"))
-		if len(copyV.SNI) == 0 {
-			if copyV.Host != "" {
-				copyV.SNI = copyV.Host
-			} else {
-				copyV.SNI = "none"
-			}
-		}
-		if len(copyV.ALPN) == 0 {
-			copyV.ALPN = "none"
-		}
-		if copyV.TlsFingerprint == "" {
-			copyV.TlsFingerprint = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ALPN"), copyV.ALPN,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint)
-
-		if v.AllowInsecure != "" {
-			info += fmt.Sprintf("%s: %v\n",
-				color.RedString("Insecure"), v.AllowInsecure)
-		}
-	} else {
-		info += fmt.Sprintf("%s: none\n", color.RedString("TLS"))
+	if v.Flow != "" && v.Type != "" && v.Type != "tcp" && v.Type != "raw" {
+		d.Warn("flow %s only works over raw TCP and is ignored on %s", v.Flow, v.Type)
+	}
+	if v.Type == "grpc" {
+		warnGRPC(d, v.SNI, v.Authority, v.Mode, v.UserAgent)
 	}
-	return info
+	return d.String()
 }
 
 func (v *Vless) GetLink() string {
@@ -279,14 +254,20 @@ func (v *Vless) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 	}
 
 	switch v.Type {
-	case "tcp":
-		return nil, errors.New("tcp transport not supported")
+	case "", "tcp", "raw":
+		// Plain TCP is sing-box's default and has no transport options.
+		transport = nil
+	case "xhttp", "splithttp":
+		return nil, errXHTTPUnsupported
+	case "kcp":
+		return nil, errKCPUnsupported
 	case "ws":
+		path, ed := protocol.ParseEarlyData(v.Path, v.EarlyData, v.EarlyDataHdr)
 		transport.WebsocketOptions = option.V2RayWebsocketOptions{
-			Path:                v.Path,
+			Path:                path,
 			Headers:             badoption.HTTPHeader{},
-			MaxEarlyData:        0,
-			EarlyDataHeaderName: "",
+			MaxEarlyData:        ed.MaxBytes,
+			EarlyDataHeaderName: ed.Header,
 		}
 		transport.WebsocketOptions.Headers["host"] = badoption.Listable[string]{v.Host}
 		transport.WebsocketOptions.Headers["User-Agent"] = badoption.Listable[string]{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.131 Safari/537.36"}
@@ -307,9 +288,11 @@ func (v *Vless) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		}
 		break
 	case "httpupgrade":
+		// sing-box has no early data for httpupgrade; keep ?ed= out of the request path.
+		path, _ := protocol.ParseEarlyData(v.Path, "", "")
 		transport.HTTPUpgradeOptions = option.V2RayHTTPUpgradeOptions{
 			Host: v.Host,
-			Path: v.Path,
+			Path: path,
 		}
 		break
 	case "grpc":
@@ -324,10 +307,17 @@ func (v *Vless) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		}
 		break
 	case "quic":
+		if err := checkQUIC(v.QuicSecurity, v.HeaderType); err != nil {
+			return nil, err
+		}
 		transport.QUICOptions = option.V2RayQUICOptions{}
 		break
 	}
 
+	serverName := v.SNI
+	if v.Type == "grpc" {
+		serverName = grpcServerName(v.SNI, v.Authority)
+	}
 	opts := option.VLESSOutboundOptions{
 		DialerOptions: option.DialerOptions{},
 		ServerOptions: option.ServerOptions{
@@ -339,7 +329,7 @@ func (v *Vless) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
 			TLS: &option.OutboundTLSOptions{
 				Enabled:    tls,
-				ServerName: v.SNI,
+				ServerName: serverName,
 				ALPN:       alpn,
 				UTLS: &option.OutboundUTLSOptions{
 					Enabled:     true,
@@ -358,6 +348,15 @@ func (v *Vless) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		}
 	}
 
+	if v.Type == "quic" {
+		// QUIC runs on the standard TLS stack, and V2Ray's QUIC uses TLS against an
+		// internal server name when the link has none.
+		opts.TLS.UTLS = nil
+		if !tls {
+			opts.TLS.Enabled, opts.TLS.Insecure, opts.TLS.ServerName = true, true, quicInternalServerName
+		}
+	}
+
 	return &option.Outbound{
 		Type:    v.Name(),
 		Options: &opts,
@@ -14,7 +14,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/option"
 	sing_vmess "github.com/sagernet/sing-box/protocol/vmess"
@@ -138,7 +137,7 @@ func (v *Vmess) Parse() error {
 		}
 	}
 
-	if v.Type == "http" || v.Network == "ws" || v.Network == "h2" {
+	if v.Type == "http" || v.Network == "ws" || v.Network == "httpupgrade" || v.Network == "h2" {
 		if v.Path == "" {
 			v.Path = "/"
 		}
@@ -148,62 +147,58 @@ func (v *Vmess) Parse() error {
 }
 
 func (v *Vmess) DetailsStr() string {
-	copyV := *v
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n",
-		color.RedString("Protocol"), v.Name(),
-		color.RedString("Remark"), copyV.Remark,
-		color.RedString("Network"), copyV.Network,
-		color.RedString("Address"), copyV.Address,
-		color.RedString("Port"), copyV.Port,
-		color.RedString("UUID"), copyV.ID)
-
-	if copyV.Network == "" {
-
-	} else if copyV.Type == "http" || copyV.Network == "httpupgrade" || copyV.Network == "ws" || copyV.Network == "h2" {
-		if copyV.Type == "" {
-			copyV.Type = "none"
-		}
-		if copyV.Host == "" {
-			copyV.Host = "none"
-		}
-		if copyV.Path == "" {
-			copyV.Path = "none"
-		}
-
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("Type"), copyV.Type,
-			color.RedString("Host"), copyV.Host,
-			color.RedString("Path"), copyV.Path)
-	} else if copyV.Network == "kcp" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("KCP Seed"), copyV.Path)
-	} else if copyV.Network == "grpc" {
-		if copyV.Host == "" {
-			copyV.Host = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n", color.RedString("ServiceName"), copyV.Path)
+	transport := protocol.Transport{
+		Network: v.Network,
+		Host:    v.Host,
+		Path:    v.Path,
 	}
-
-	if len(copyV.TLS) != 0 && copyV.TLS != "none" {
-		if len(copyV.SNI) == 0 {
-			if copyV.Host != "" {
-				copyV.SNI = copyV.Host
-			} else {
-				copyV.SNI = "none"
-			}
-		}
-		if len(copyV.ALPN) == 0 {
-			copyV.ALPN = "none"
-		}
-		if len(copyV.TlsFingerprint) == 0 {
-			copyV.TlsFingerprint = "none"
+	if v.Type == "http" {
+		transport.HeaderType = "http"
+	}
+	switch v.Network {
+	case "kcp":
+		// VMess links carry the mKCP header in type and the seed in path.
+		transport.HeaderType = v.Type
+	case "quic":
+		// ...and the QUIC header in type, the security in host and the key in path.
+		transport.HeaderType, transport.QUICSecurity, transport.QUICKey = v.Type, v.Host, v.Path
+	}
+	if v.Network == "grpc" {
+		// VMess links carry the gRPC service name in path, the authority in host and the mode in type.
+		transport.ServiceName, transport.Authority = v.Path, v.Host
+		if v.Type == "gun" || v.Type == "multi" {
+			transport.Mode = v.Type
 		}
-		info += fmt.Sprintf("%s: tls\n%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("TLS"),
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ALPN"), copyV.ALPN,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint)
 	}
-	return info
+	security := ""
+	if v.TLS != "" && v.TLS != "none" {
+		security = "tls"
+	}
+
+	d := protocol.NewDetails(v.Name(), v.Remark).
+		Add("Address", v.Address).
+		Add("Port", v.Port).
+		Add("UUID", v.ID).
+		AddIfSet("Cipher", v.Security).
+		AddTransport(transport).
+		AddTLS(protocol.TLS{
+			Security:      security,
+			SNI:           v.SNI,
+			Host:          v.Host,
+			ALPN:          v.ALPN,
+			Fingerprint:   v.TlsFingerprint,
+			AllowInsecure: v.AllowInsecure,
+		})
+	if aid, _ := strconv.Atoi(fmt.Sprint(v.Aid)); aid > 0 {
+		d.Warn("alterId is %d: legacy VMess (MD5) authentication is deprecated and easy to fingerprint", aid)
+	}
+	if security == "" && (v.Security == "none" || v.Security == "zero") {
+		d.Warn("VMess cipher is %s and TLS is off: traffic is sent in cleartext", v.Security)
+	}
+	if v.Network == "grpc" {
+		warnGRPC(d, v.SNI, v.Host, v.Type, "")
+	}
+	return d.String()
 }
 
 func (v *Vmess) GetLink() string {
@@ -366,12 +361,21 @@ func (v *Vmess) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 	}
 
 	switch v.Network {
-	case "tcp":
-		break
+	case "", "tcp", "raw":
+		// Plain TCP is sing-box's default and has no transport options.
+		transport = nil
+	case "xhttp", "splithttp":
+		return nil, errXHTTPUnsupported
+	case "kcp":
+		return nil, errKCPUnsupported
 	case "ws":
+		// VMess links only carry early data embedded in the path ("/ws?ed=2048").
+		path, ed := protocol.ParseEarlyData(v.Path, "", "")
 		transport.WebsocketOptions = option.V2RayWebsocketOptions{
-			Path:    v.Path,
-			Headers: badoption.HTTPHeader{},
+			Path:                path,
+			Headers:             badoption.HTTPHeader{},
+			MaxEarlyData:        ed.MaxBytes,
+			EarlyDataHeaderName: ed.Header,
 		}
 		transport.WebsocketOptions.Headers["Host"] = badoption.Listable[string]{v.Host}
 		transport.WebsocketOptions.Headers["User-Agent"] = badoption.Listable[string]{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.131 Safari/537.36"}
@@ -391,9 +395,11 @@ func (v *Vmess) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		}
 		break
 	case "httpupgrade":
+		// sing-box has no early data for httpupgrade; keep ?ed= out of the request path.
+		path, _ := protocol.ParseEarlyData(v.Path, "", "")
 		transport.HTTPUpgradeOptions = option.V2RayHTTPUpgradeOptions{
 			Host:    v.Host,
-			Path:    v.Path,
+			Path:    path,
 			Headers: nil,
 		}
 		break
@@ -410,10 +416,17 @@ func (v *Vmess) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		}
 		break
 	case "quic":
+		if err := checkQUIC(v.Host, v.Type); err != nil {
+			return nil, err
+		}
 		transport.QUICOptions = option.V2RayQUICOptions{}
 		break
 	}
 
+	serverName := v.SNI
+	if v.Network == "grpc" {
+		serverName = grpcServerName(v.SNI, v.Host)
+	}
 	opts := option.VMessOutboundOptions{
 		DialerOptions: option.DialerOptions{},
 		ServerOptions: option.ServerOptions{
@@ -427,7 +440,7 @@ func (v *Vmess) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
 			TLS: &option.OutboundTLSOptions{
 				Enabled:    tls,
-				ServerName: v.SNI,
+				ServerName: serverName,
 				ALPN:       alpn,
 				UTLS: &option.OutboundUTLSOptions{
 					Enabled:     true,
@@ -438,6 +451,15 @@ func (v *Vmess) CraftOutboundOptions(allowInsecure bool) (*option.Outbound, erro
 		},
 	}
 
+	if v.Network == "quic" {
+		// QUIC runs on the standard TLS stack, and V2Ray's QUIC uses TLS against an
+		// internal server name when the link has none.
+		opts.TLS.UTLS = nil
+		if !tls {
+			opts.TLS.Enabled, opts.TLS.Insecure, opts.TLS.ServerName = true, true, quicInternalServerName
+		}
+	}
+
 	return &option.Outbound{
 		Type:    v.Name(),
 		Options: &opts,
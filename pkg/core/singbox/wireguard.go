@@ -13,7 +13,6 @@ import (
 
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 
-	"github.com/fatih/color"
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/option"
 	sing_wireguard "github.com/sagernet/sing-box/protocol/wireguard"
@@ -88,17 +87,13 @@ func (w *Wireguard) Parse() error {
 }
 
 func (w *Wireguard) DetailsStr() string {
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %d\n%s: %s\n%s: %v\n%s: %s\n",
-		color.RedString("Protocol"), w.Name(),
-		color.RedString("Remark"), w.Remark,
-		color.RedString("Endpoint"), w.Endpoint,
-		color.RedString("MTU"), w.Mtu,
-		color.RedString("Local Addresses"), w.LocalAddress,
-		color.RedString("Public Key"), w.PublicKey,
-		color.RedString("Secret Key"), w.SecretKey,
-	)
-
-	return info
+	return protocol.NewDetails(w.Name(), w.Remark).
+		Add("Endpoint", w.Endpoint).
+		Add("MTU", w.Mtu).
+		Add("Local Addresses", w.LocalAddress).
+		Add("Public Key", w.PublicKey).
+		Add("Secret Key", w.SecretKey).
+		String()
 }
 
 func (w *Wireguard) GetLink() string {
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
+)
+
+// UDPCore is implemented by cores that can relay UDP through an instance made by
+// MakeHttpClient. dest is the first address the packets go to; some protocols
+// open their UDP session towards it, but the returned connection can write to
+// any address.
+type UDPCore interface {
+	ListenPacket(ctx context.Context, instance protocol.Instance, dest string) (net.PacketConn, error)
+}
+
+// ListenPacket relays UDP through whichever underlying core made instance.
+func (c *AutomaticCore) ListenPacket(ctx context.Context, instance protocol.Instance, dest string) (net.PacketConn, error) {
+	conn, err := c.xrayCore.(*xray.Core).ListenPacket(ctx, instance, dest)
+	if !errors.Is(err, protocol.ErrForeignInstance) {
+		return conn, err
+	}
+	return c.singboxCore.(*singbox.Core).ListenPacket(ctx, instance, dest)
+}
@@ -0,0 +1,113 @@
+package xray
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/xtls/xray-core/app/dispatcher"
+	"github.com/xtls/xray-core/app/stats"
+	"github.com/xtls/xray-core/common"
+	"github.com/xtls/xray-core/common/buf"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/outbound"
+	"github.com/xtls/xray-core/transport"
+)
+
+// trackAccess makes the outbounds connections are routed to (the default one and
+// the router's direct and block) report each connection they carry to rec. The
+// upstream and the inner hops of a chain only carry the traffic of those, so they
+// are left alone.
+func trackAccess(server *core.Instance, rec protocol.AccessRecorder) error {
+	ohm, ok := server.GetFeature(outbound.ManagerType()).(outbound.Manager)
+	if !ok {
+		return nil
+	}
+	def := ohm.GetDefaultHandler()
+	if def == nil || def.Tag() == "" {
+		return nil
+	}
+	// Re-adding the default handler first keeps it the default.
+	handlers := []outbound.Handler{def}
+	for _, tag := range []string{directTag, blockTag} {
+		if h := ohm.GetHandler(tag); h != nil && tag != def.Tag() {
+			handlers = append(handlers, h)
+		}
+	}
+	ctx := context.Background()
+	for _, h := range handlers {
+		if err := ohm.RemoveHandler(ctx, h.Tag()); err != nil {
+			return err
+		}
+		if err := ohm.AddHandler(ctx, &accessHandler{Handler: h, rec: rec}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accessHandler counts the bytes of the connections its outbound carries.
+type accessHandler struct {
+	outbound.Handler
+	rec protocol.AccessRecorder
+}
+
+func (h *accessHandler) Dispatch(ctx context.Context, link *transport.Link) {
+	entry := protocol.AccessEntry{Time: time.Now(), Outbound: h.Tag()}
+	if obs := session.OutboundsFromContext(ctx); len(obs) > 0 {
+		target := obs[len(obs)-1].Target
+		entry.Network = target.Network.SystemString()
+		entry.Destination = target.NetAddr()
+	}
+	var up atomic.Int64
+	// A SizeStatWriter also gets the bytes xray splices past it.
+	down := &stats.Counter{}
+	h.Handler.Dispatch(ctx, &transport.Link{
+		Reader: countReader(link.Reader, &up),
+		Writer: &dispatcher.SizeStatWriter{Counter: down, Writer: link.Writer},
+	})
+	entry.Up, entry.Down = up.Load(), down.Value()
+	entry.Duration = time.Since(entry.Time).Milliseconds()
+	h.rec(entry)
+}
+
+// countReader counts what is read from r, keeping it a buf.TimeoutReader if it is one.
+func countReader(r buf.Reader, n *atomic.Int64) buf.Reader {
+	c := &countingReader{Reader: r, n: n}
+	if _, ok := r.(buf.TimeoutReader); ok {
+		return &countingTimeoutReader{c}
+	}
+	return c
+}
+
+type countingReader struct {
+	buf.Reader
+	n *atomic.Int64
+}
+
+func (r *countingReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	mb, err := r.Reader.ReadMultiBuffer()
+	r.n.Add(int64(mb.Len()))
+	return mb, err
+}
+
+func (r *countingReader) Interrupt() {
+	common.Interrupt(r.Reader)
+}
+
+func (r *countingReader) Close() error {
+	return common.Close(r.Reader)
+}
+
+type countingTimeoutReader struct {
+	*countingReader
+}
+
+func (r *countingTimeoutReader) ReadMultiBufferTimeout(d time.Duration) (buf.MultiBuffer, error) {
+	mb, err := r.Reader.(buf.TimeoutReader).ReadMultiBufferTimeout(d)
+	r.n.Add(int64(mb.Len()))
+	return mb, err
+}
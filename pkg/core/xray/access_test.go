@@ -0,0 +1,72 @@
+package xray
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+func TestMakeInstance_AccessRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 4096))
+	}))
+	defer srv.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	c := NewXrayService(false, false)
+	if err := c.SetInbound(&Socks{Remark: "Listener", Address: "127.0.0.1", Port: strconv.Itoa(port)}); err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter("direct", nil, nil)
+	if err := router.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	entries := make(chan protocol.AccessEntry, 1)
+	ctx := protocol.WithAccessRecorder(context.Background(), func(e protocol.AccessEntry) { entries <- e })
+	instance, err := c.MakeInstance(ctx, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:             http.ProxyURL(&url.URL{Scheme: "socks5", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}),
+		DisableKeepAlives: true,
+	}}
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	select {
+	case e := <-entries:
+		if want := strings.TrimPrefix(srv.URL, "http://"); e.Destination != want || e.Network != "tcp" || e.Outbound != "direct" {
+			t.Errorf("entry %s %s via %s, want tcp %s via direct", e.Network, e.Destination, e.Outbound, want)
+		}
+		if e.Up == 0 || e.Down < 4096 {
+			t.Errorf("entry counted %d bytes up and %d down, want the request and a 4 KB response", e.Up, e.Down)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no access entry recorded")
+	}
+}
@@ -83,6 +83,12 @@ func (c *Core) MakeChainedInstance(ctx context.Context, hops []protocol.Protocol
 	if err != nil {
 		return nil, fmt.Errorf("chain: failed to create xray instance: %w", err)
 	}
+	if rec := protocol.AccessRecorderFrom(ctx); rec != nil {
+		if err := trackAccess(server, rec); err != nil {
+			server.Close()
+			return nil, err
+		}
+	}
 	return server, nil
 }
 
@@ -0,0 +1,42 @@
+package xray
+
+import (
+	"encoding/json"
+
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// fragmentTag is the freedom outbound that dials config servers and splits the
+// TLS ClientHello when Dial.Fragment is set.
+const fragmentTag = "fragment"
+
+// fragmentSettings split the ClientHello into 100-200 byte pieces sent 10-20ms
+// apart, the values commonly used against SNI filtering.
+const fragmentSettings = `{"fragment":{"packets":"tlshello","length":"100-200","interval":"10-20"}}`
+
+// viaFragment dials the server of ob through the fragment outbound, which takes
+// over the socket options of ob.
+func (c *Core) viaFragment(ob *conf.OutboundDetourConfig) {
+	if !c.Dial.Fragment || ob.Tag == fragmentTag {
+		return
+	}
+	if ob.StreamSetting == nil {
+		ob.StreamSetting = &conf.StreamConfig{}
+	}
+	ob.StreamSetting.SocketSettings = &conf.SocketConfig{DialerProxy: fragmentTag}
+}
+
+// buildFragmentOutbound builds the fragment outbound, dialing with the socket
+// options of the core.
+func (c *Core) buildFragmentOutbound() (*core.OutboundHandlerConfig, error) {
+	raw := json.RawMessage(fragmentSettings)
+	ob := &conf.OutboundDetourConfig{
+		Tag:      fragmentTag,
+		Protocol: "freedom",
+		Settings: &raw,
+	}
+	c.applyDialOptions(ob)
+	c.forceIPVersion(ob)
+	return ob.Build()
+}
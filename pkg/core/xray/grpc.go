@@ -0,0 +1,22 @@
+package xray
+
+import (
+	"strings"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// grpcConfig builds the gRPC transport settings from link parameters. Only
+// mode=multi enables multiMode; "gun" and an empty mode use the standard mode.
+// An empty userAgent keeps grpc-go's default.
+func grpcConfig(serviceName, authority, mode, userAgent string) *conf.GRPCConfig {
+	return &conf.GRPCConfig{
+		Authority:          authority,
+		ServiceName:        strings.TrimPrefix(serviceName, "/"),
+		MultiMode:          mode == "multi",
+		IdleTimeout:        60,
+		HealthCheckTimeout: 20,
+		InitialWindowsSize: 65536,
+		UserAgent:          userAgent,
+	}
+}
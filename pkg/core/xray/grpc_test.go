@@ -0,0 +1,56 @@
+package xray
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestVless_GrpcOutbound(t *testing.T) {
+	tests := []struct {
+		name      string
+		link      string
+		multiMode bool
+		authority string
+		userAgent string
+	}{
+		{"gun", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&sni=h.example.com&type=grpc&serviceName=%2Fsvc&mode=gun#g", false, "", ""},
+		{"multi with authority and user agent", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&sni=h.example.com&type=grpc&serviceName=svc&mode=multi&authority=cdn.example.com&userAgent=Mozilla%2F5.0#m", true, "cdn.example.com", "Mozilla/5.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Vless{OrigLink: tt.link}
+			if err := v.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			out, err := v.BuildOutboundDetourConfig(false)
+			if err != nil {
+				t.Fatalf("BuildOutboundDetourConfig() error = %v", err)
+			}
+			g := out.StreamSetting.GRPCSettings
+			if g == nil || g.ServiceName != "svc" || g.MultiMode != tt.multiMode || g.Authority != tt.authority || g.UserAgent != tt.userAgent {
+				t.Fatalf("unexpected grpc settings: %+v", g)
+			}
+			if _, err := out.Build(); err != nil {
+				t.Errorf("xray rejected the outbound: %v", err)
+			}
+		})
+	}
+}
+
+func TestVmess_GrpcMode(t *testing.T) {
+	for mode, want := range map[string]bool{"": false, "none": false, "gun": false, "multi": true} {
+		js := `{"v":"2","ps":"g","add":"1.2.3.4","port":"443","id":"b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5","aid":"0","net":"grpc","type":"` + mode + `","host":"cdn.example.com","path":"svc","tls":"tls"}`
+		v := &Vmess{OrigLink: "vmess://" + base64.StdEncoding.EncodeToString([]byte(js))}
+		if err := v.Parse(); err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		out, err := v.BuildOutboundDetourConfig(false)
+		if err != nil {
+			t.Fatalf("BuildOutboundDetourConfig() error = %v", err)
+		}
+		g := out.StreamSetting.GRPCSettings
+		if g.MultiMode != want || g.Authority != "cdn.example.com" {
+			t.Errorf("type=%q: multiMode = %v, authority = %q", mode, g.MultiMode, g.Authority)
+		}
+	}
+}
@@ -62,7 +62,10 @@ func (h *Http) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
 }
 
 func (h *Http) DetailsStr() string {
-	return fmt.Sprintf("Protocol: http\nRemark: %s\nAddress: %s\nPort: %s\n", h.Remark, h.Address, h.Port)
+	return protocol.NewDetails("http", h.Remark).
+		Add("Address", h.Address).
+		Add("Port", h.Port).
+		String()
 }
 
 func (h *Http) GetLink() string {
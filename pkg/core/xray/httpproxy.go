@@ -0,0 +1,112 @@
+package xray
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+func NewHTTPProxy(link string) Protocol {
+	return &HTTPProxy{OrigLink: link}
+}
+
+func (h *HTTPProxy) Name() string {
+	return protocol.HTTPProxyIdentifier
+}
+
+// Parse reads a link of the form http(s)://user:pass@host:port?sni=...#remark.
+func (h *HTTPProxy) Parse() error {
+	if !protocol.IsProxyLink(h.OrigLink) {
+		return fmt.Errorf("http proxy link must be http(s)://[user:pass@]host:port, got %s", h.OrigLink)
+	}
+	uri, err := url.Parse(h.OrigLink)
+	if err != nil {
+		return err
+	}
+	h.TLS = uri.Scheme == protocol.HTTPSProxyScheme
+	h.Address, h.Port = uri.Hostname(), uri.Port()
+	if _, err := strconv.ParseUint(h.Port, 10, 16); err != nil {
+		return fmt.Errorf("invalid http proxy port %q", h.Port)
+	}
+	h.Username, h.Password = protocol.ProxyUser(uri.User)
+	h.Remark = uri.Fragment
+	h.SNI = uri.Query().Get("sni")
+	if h.TLS && h.SNI == "" && net.ParseIP(h.Address) == nil {
+		h.SNI = h.Address
+	}
+	return nil
+}
+
+func (h *HTTPProxy) DetailsStr() string {
+	d := protocol.NewDetails(h.Name(), h.Remark).
+		Add("Network", "tcp").
+		Add("Address", h.Address).
+		Add("Port", h.Port).
+		AddIfSet("Username", h.Username).
+		AddIfSet("Password", h.Password)
+	if h.TLS {
+		d.Add("TLS", "tls").AddIfSet("SNI", h.SNI)
+	} else {
+		d.Warn("HTTP proxies without TLS do not encrypt credentials")
+	}
+	return d.String()
+}
+
+func (h *HTTPProxy) GetLink() string {
+	return h.OrigLink
+}
+
+func (h *HTTPProxy) ConvertToGeneralConfig() (g protocol.GeneralConfig) {
+	g.Protocol = h.Name()
+	g.Address = h.Address
+	g.Port = h.Port
+	g.ID = h.Username
+	g.Network = "tcp"
+	if h.TLS {
+		g.TLS = "tls"
+		g.SNI = h.SNI
+	}
+	g.Remark = h.Remark
+	g.OrigLink = h.GetLink()
+	return g
+}
+
+func (h *HTTPProxy) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDetourConfig, error) {
+	port, _ := strconv.ParseUint(h.Port, 10, 16)
+	settings, err := json.Marshal(map[string]interface{}{
+		"address": h.Address,
+		"port":    port,
+		"user":    h.Username,
+		"pass":    h.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(settings)
+
+	p := conf.TransportProtocol("tcp")
+	s := &conf.StreamConfig{Network: &p}
+	if h.TLS {
+		s.Security = "tls"
+		s.TLSSettings = &conf.TLSConfig{
+			ServerName: h.SNI,
+			Insecure:   allowInsecure,
+		}
+	}
+	return &conf.OutboundDetourConfig{
+		Tag:           "proxy",
+		Protocol:      h.Name(),
+		Settings:      &raw,
+		StreamSetting: s,
+	}, nil
+}
+
+func (h *HTTPProxy) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
+	return nil, fmt.Errorf("http proxy links cannot be used as an inbound")
+}
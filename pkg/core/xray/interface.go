@@ -51,6 +51,7 @@ type Vless struct {
 	Flow           string `json:"flow"`
 	QuicSecurity   string `json:"quicSecurity"`
 	Key            string `json:"key"`      // Quic key
+	Seed           string `json:"seed"`     // KCP seed
 	Security       string `json:"security"` // reality or tls
 	PublicKey      string `json:"pbk"`
 	ShortIds       string `json:"sid"`        // Mandatory, the shortId list available to the client, which can be used to distinguish different clients
@@ -58,6 +59,8 @@ type Vless struct {
 	HeaderType     string `json:"headerType"` // TCP HTTP Obfuscation
 	Host           string `json:"host"`       // HTTP, WS
 	Path           string `json:"path"`
+	EarlyData      string `json:"ed"` // WS early data size
+	EarlyDataHdr   string `json:"eh"` // WS early data header
 	Port           string `json:"port"`
 	SNI            string `json:"sni"`           // Server name indication
 	ALPN           string `json:"alpn"`          // Application-Layer Protocol Negotiation
@@ -67,6 +70,7 @@ type Vless struct {
 	Remark         string `json:"ps"`            // Config's name
 	Authority      string `json:"authority"`     // GRPC
 	ServiceName    string `json:"serviceName"`   // GRPC
+	UserAgent      string `json:"userAgent"`     // GRPC
 	Mode           string `json:"mode"`          // XHTTP - GRPC
 	Extra          string `json:"extra"`         // XHTTP - EXTRA
 	CertFile       string `json:"-"`
@@ -80,7 +84,8 @@ type Shadowsocks struct {
 	Encryption string
 	Password   string
 	Remark     string
-	OrigLink   string // Original link
+	Plugin     *protocol.ShadowsocksPlugin // SIP003 plugin, or nil
+	OrigLink   string                      // Original link
 }
 
 type Trojan struct {
@@ -90,10 +95,13 @@ type Trojan struct {
 	Flow           string `json:"flow"`
 	QuicSecurity   string `json:"quicSecurity"`
 	Key            string `json:"key"`        // Quic key
+	Seed           string `json:"seed"`       // KCP seed
 	Security       string `json:"security"`   // tls
 	HeaderType     string `json:"headerType"` // TCP HTTP Obfuscation
 	Host           string `json:"host"`       // HTTP, WS
 	Path           string `json:"path"`
+	EarlyData      string `json:"ed"` // WS early data size
+	EarlyDataHdr   string `json:"eh"` // WS early data header
 	Port           string `json:"port"`
 	SNI            string `json:"sni"`           // Server name indication
 	ALPN           string `json:"alpn"`          // Application-Layer Protocol Negotiation
@@ -103,7 +111,9 @@ type Trojan struct {
 	Remark         string // Config's name
 	Authority      string `json:"authority"`   // GRPC
 	ServiceName    string `json:"serviceName"` // GRPC
+	UserAgent      string `json:"userAgent"`   // GRPC
 	Mode           string `json:"mode"`        // XHTTP, GRPC
+	Extra          string `json:"extra"`       // XHTTP - EXTRA
 
 	// Yes, Trojan can have reality too xD
 	PublicKey string `json:"pbk"`
@@ -134,6 +144,18 @@ type Socks struct {
 	OrigLink string // Original link
 }
 
+// HTTPProxy is a plain HTTP proxy, or one behind TLS with an https:// link.
+type HTTPProxy struct {
+	Remark   string
+	Address  string
+	Port     string
+	Username string
+	Password string
+	TLS      bool
+	SNI      string // from the sni parameter, or the address when it is a name
+	OrigLink string // Original link
+}
+
 type Hysteria2 struct {
 	Remark        string
 	Address       string
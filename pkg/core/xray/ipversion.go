@@ -0,0 +1,33 @@
+package xray
+
+import (
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// SetIPVersion makes instances built by this core dial config servers over IPv4 (4)
+// or IPv6 (6) only. 0 restores the default.
+func (c *Core) SetIPVersion(v int) {
+	c.IPVersion = v
+}
+
+// forceIPVersion sets the socket domain strategy of ob so its server is only
+// dialed over c.IPVersion. The Force* strategies fail rather than fall back when
+// the domain has no record of that family.
+func (c *Core) forceIPVersion(ob *conf.OutboundDetourConfig) {
+	var strategy string
+	switch c.IPVersion {
+	case 4:
+		strategy = "ForceIPv4"
+	case 6:
+		strategy = "ForceIPv6"
+	default:
+		return
+	}
+	if ob.StreamSetting == nil {
+		ob.StreamSetting = &conf.StreamConfig{}
+	}
+	if ob.StreamSetting.SocketSettings == nil {
+		ob.StreamSetting.SocketSettings = &conf.SocketConfig{}
+	}
+	ob.StreamSetting.SocketSettings.DomainStrategy = strategy
+}
@@ -0,0 +1,26 @@
+package xray
+
+import (
+	"testing"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+func TestForceIPVersion(t *testing.T) {
+	c := NewXrayService(false, false)
+	ob := &conf.OutboundDetourConfig{Protocol: "freedom"}
+
+	c.forceIPVersion(ob)
+	if ob.StreamSetting != nil {
+		t.Errorf("stream settings added without an IP version: %+v", ob.StreamSetting)
+	}
+
+	c.SetIPVersion(4)
+	c.forceIPVersion(ob)
+	if ob.StreamSetting == nil || ob.StreamSetting.SocketSettings == nil || ob.StreamSetting.SocketSettings.DomainStrategy != "ForceIPv4" {
+		t.Fatalf("socket settings = %+v", ob.StreamSetting)
+	}
+	if _, err := ob.Build(); err != nil {
+		t.Errorf("outbound with a forced IP version doesn't build: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package xray
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// kcpHeaders are the packet header disguises xray accepts for mKCP.
+var kcpHeaders = map[string]bool{
+	"none":         true,
+	"srtp":         true,
+	"utp":          true,
+	"wechat-video": true,
+	"dtls":         true,
+	"wireguard":    true,
+	"dns":          true,
+}
+
+// errQUICRemoved is returned for type=quic links, which xray-core no longer supports.
+var errQUICRemoved = errors.New("QUIC transport was removed from xray-core, use the sing-box core")
+
+// kcpConfig builds the mKCP transport settings from link parameters. seed is the
+// obfuscation password; domain is only used by the dns header.
+func kcpConfig(headerType, seed, domain string) (*conf.KCPConfig, error) {
+	if headerType == "" {
+		headerType = "none"
+	}
+	if !kcpHeaders[headerType] {
+		return nil, fmt.Errorf("unsupported mKCP header type %q", headerType)
+	}
+	header := map[string]string{"type": headerType}
+	if headerType == "dns" && domain != "" {
+		header["domain"] = domain
+	}
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conf.KCPConfig{HeaderConfig: raw}
+	if seed != "" {
+		c.Seed = &seed
+	}
+	return c, nil
+}
+
+// kcpSeed returns the mKCP seed of the link: seed=, or path= as written by older clients.
+func (v *Vless) kcpSeed() string {
+	if v.Seed != "" {
+		return v.Seed
+	}
+	return v.Path
+}
+
+// kcpSeed returns the mKCP seed of the link: seed=, or path= as written by older clients.
+func (t *Trojan) kcpSeed() string {
+	if t.Seed != "" {
+		return t.Seed
+	}
+	return t.Path
+}
@@ -0,0 +1,82 @@
+package xray
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestKcpConfig(t *testing.T) {
+	tests := []struct {
+		name, header, seed, domain string
+		wantHeader                 string
+		wantErr                    bool
+	}{
+		{name: "defaults", wantHeader: `{"type":"none"}`},
+		{name: "wechat with seed", header: "wechat-video", seed: "s3cret", wantHeader: `{"type":"wechat-video"}`},
+		{name: "dns domain", header: "dns", domain: "dl.example.com", wantHeader: `{"domain":"dl.example.com","type":"dns"}`},
+		{name: "tcp header type", header: "http", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := kcpConfig(tt.header, tt.seed, tt.domain)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("kcpConfig() error = %v", err)
+			}
+			if string(c.HeaderConfig) != tt.wantHeader {
+				t.Errorf("header = %s, want %s", c.HeaderConfig, tt.wantHeader)
+			}
+			if (tt.seed == "") != (c.Seed == nil) || (c.Seed != nil && *c.Seed != tt.seed) {
+				t.Errorf("seed = %v, want %q", c.Seed, tt.seed)
+			}
+			if _, err := c.Build(); err != nil {
+				t.Errorf("xray rejected the settings: %v", err)
+			}
+		})
+	}
+}
+
+func TestKcpLinks(t *testing.T) {
+	vmessJSON := `{"v":"2","ps":"k","add":"1.2.3.4","port":"443","id":"b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5","aid":"0","net":"kcp","type":"srtp","path":"vmess-seed","tls":""}`
+
+	vless := &Vless{OrigLink: "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=none&type=kcp&headerType=utp&seed=vless-seed#k"}
+	if err := vless.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	out, err := vless.BuildOutboundDetourConfig(false)
+	if err != nil {
+		t.Fatalf("vless BuildOutboundDetourConfig() error = %v", err)
+	}
+	if k := out.StreamSetting.KCPSettings; k.Seed == nil || *k.Seed != "vless-seed" || string(k.HeaderConfig) != `{"type":"utp"}` {
+		t.Errorf("unexpected vless kcp settings: %+v", k)
+	}
+
+	vmess := &Vmess{OrigLink: "vmess://" + base64.StdEncoding.EncodeToString([]byte(vmessJSON))}
+	if err := vmess.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	out, err = vmess.BuildOutboundDetourConfig(false)
+	if err != nil {
+		t.Fatalf("vmess BuildOutboundDetourConfig() error = %v", err)
+	}
+	if k := out.StreamSetting.KCPSettings; k.Seed == nil || *k.Seed != "vmess-seed" || string(k.HeaderConfig) != `{"type":"srtp"}` {
+		t.Errorf("unexpected vmess kcp settings: %+v", k)
+	}
+	if _, err := out.Build(); err != nil {
+		t.Errorf("xray rejected the vmess outbound: %v", err)
+	}
+
+	quic := &Vless{OrigLink: "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=none&type=quic&quicSecurity=none#q"}
+	if err := quic.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, err := quic.BuildOutboundDetourConfig(false); !errors.Is(err, errQUICRemoved) {
+		t.Errorf("quic: err = %v, want errQUICRemoved", err)
+	}
+}
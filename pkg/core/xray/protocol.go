@@ -27,8 +27,10 @@ func (c *Core) CreateProtocol(configLink string) (protocol.Protocol, error) {
 		return NewShadowsocks(configLink), nil
 	case protocol.TrojanIdentifier:
 		return NewTrojan(configLink), nil
-	case protocol.SocksIdentifier:
+	case protocol.SocksIdentifier, protocol.Socks5Scheme, protocol.Socks5HScheme:
 		return NewSocks(configLink), nil
+	case protocol.HTTPProxyIdentifier, protocol.HTTPSProxyScheme:
+		return NewHTTPProxy(configLink), nil
 	case protocol.WireguardIdentifier:
 		return NewWireguard(configLink), nil
 	default:
@@ -0,0 +1,199 @@
+package xray
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+const (
+	directTag = "direct"
+	blockTag  = "block"
+)
+
+// privateRanges is what the "private" route rule expands to, so no geoip.dat is needed.
+var privateRanges = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7", "fe80::/10",
+}
+
+// Router is a local outbound that sends traffic straight out (freedom) or drops it
+// (blackhole), so the proxy can run without any remote config. Destinations matching
+// a Block rule are dropped and those matching an Allow rule go direct; everything
+// else gets the Default action.
+type Router struct {
+	Default string // "direct" or "block"
+	Block   []string
+	Allow   []string
+
+	domains map[string][]string // outbound tag -> domain matchers
+	ips     map[string][]string // outbound tag -> IPs/CIDRs
+}
+
+// NewRouter returns a Router outbound; call Parse to validate its rules.
+func NewRouter(defaultAction string, block, allow []string) *Router {
+	return &Router{Default: defaultAction, Block: block, Allow: allow}
+}
+
+func (r *Router) Name() string {
+	return r.Default
+}
+
+// Parse validates the default action and sorts the rules into domain and IP matchers.
+// A rule is an IP or CIDR, "private", a domain (matching its subdomains too), or
+// one of xray's "full:", "domain:", "keyword:" and "regexp:" matchers.
+func (r *Router) Parse() error {
+	if r.Default != directTag && r.Default != blockTag {
+		return fmt.Errorf("unknown outbound %q (expected direct or block)", r.Default)
+	}
+	r.domains = map[string][]string{}
+	r.ips = map[string][]string{}
+	for _, set := range []struct {
+		tag   string
+		rules []string
+	}{{blockTag, r.Block}, {directTag, r.Allow}} {
+		for _, rule := range set.rules {
+			if err := r.addRule(set.tag, strings.TrimSpace(rule)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Router) addRule(tag, rule string) error {
+	switch {
+	case rule == "":
+		return errors.New("empty route rule")
+	case rule == "private":
+		r.ips[tag] = append(r.ips[tag], privateRanges...)
+	case net.ParseIP(rule) != nil:
+		r.ips[tag] = append(r.ips[tag], rule)
+	case strings.Contains(rule, "/"):
+		if _, _, err := net.ParseCIDR(rule); err != nil {
+			return fmt.Errorf("invalid route rule %q: %w", rule, err)
+		}
+		r.ips[tag] = append(r.ips[tag], rule)
+	case strings.HasPrefix(rule, "full:"), strings.HasPrefix(rule, "domain:"),
+		strings.HasPrefix(rule, "keyword:"), strings.HasPrefix(rule, "regexp:"):
+		r.domains[tag] = append(r.domains[tag], rule)
+	case strings.Contains(rule, ":"):
+		return fmt.Errorf("unsupported route rule %q", rule)
+	default:
+		// xray treats a bare string as a keyword; a domain rule is what users expect.
+		r.domains[tag] = append(r.domains[tag], "domain:"+rule)
+	}
+	return nil
+}
+
+func (r *Router) DetailsStr() string {
+	d := protocol.NewDetails(r.Name(), "Local router")
+	if len(r.Block) > 0 {
+		d.Add("Block", strings.Join(r.Block, ", "))
+	}
+	if len(r.Allow) > 0 {
+		d.Add("Allow", strings.Join(r.Allow, ", "))
+	}
+	d.Add("Otherwise", r.Default)
+	return d.String()
+}
+
+// GetLink returns an empty string: a local router has no shareable link.
+func (r *Router) GetLink() string {
+	return ""
+}
+
+func (r *Router) ConvertToGeneralConfig() (g protocol.GeneralConfig) {
+	g.Protocol = r.Name()
+	g.Remark = "Local router"
+	return g
+}
+
+// BuildOutboundDetourConfig builds the outbound of the default action.
+func (r *Router) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDetourConfig, error) {
+	return routerOutbound(r.Default)
+}
+
+func (r *Router) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
+	return nil, errors.New("a local router cannot be used as an inbound")
+}
+
+// routing returns the outbound of the other action and the routing rules, when any
+// rule is set. The default action's outbound comes first, so xray falls back to it.
+func (r *Router) routing() ([]*conf.OutboundDetourConfig, *conf.RouterConfig, error) {
+	var rules []json.RawMessage
+	for _, tag := range []string{blockTag, directTag} {
+		for _, m := range []struct {
+			key    string
+			values []string
+		}{{"domain", r.domains[tag]}, {"ip", r.ips[tag]}} {
+			if len(m.values) == 0 {
+				continue
+			}
+			rule, err := json.Marshal(map[string]interface{}{"type": "field", m.key: m.values, "outboundTag": tag})
+			if err != nil {
+				return nil, nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil, nil
+	}
+
+	other := directTag
+	if r.Default == directTag {
+		other = blockTag
+	}
+	out, err := routerOutbound(other)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Match IP rules against the resolved address of domain destinations too.
+	strategy := "IPIfNonMatch"
+	return []*conf.OutboundDetourConfig{out}, &conf.RouterConfig{RuleList: rules, DomainStrategy: &strategy}, nil
+}
+
+// addRouting adds the other action's outbound and the router app for r's rules.
+func addRouting(config *core.Config, r *Router) error {
+	outbounds, routerConfig, err := r.routing()
+	if err != nil || routerConfig == nil {
+		return err
+	}
+	for _, ob := range outbounds {
+		built, err := ob.Build()
+		if err != nil {
+			return err
+		}
+		config.Outbound = append(config.Outbound, built)
+	}
+	builtRouter, err := routerConfig.Build()
+	if err != nil {
+		return fmt.Errorf("invalid route rules: %w", err)
+	}
+	config.App = append(config.App, serial.ToTypedMessage(builtRouter))
+	return nil
+}
+
+func routerOutbound(tag string) (*conf.OutboundDetourConfig, error) {
+	out := &conf.OutboundDetourConfig{Tag: tag}
+	switch tag {
+	case directTag:
+		out.Protocol = "freedom"
+	case blockTag:
+		out.Protocol = "blackhole"
+	default:
+		return nil, fmt.Errorf("unknown outbound %q", tag)
+	}
+	settings := json.RawMessage(`{}`)
+	out.Settings = &settings
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package xray
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRouter_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     string
+		block   []string
+		allow   []string
+		wantErr bool
+	}{
+		{name: "direct", def: "direct"},
+		{name: "block with allow list", def: "block", allow: []string{"example.com", "1.1.1.1", "10.0.0.0/8"}},
+		{name: "matchers", def: "direct", block: []string{"full:a.example.com", "keyword:ads", "regexp:^x\\.", "private"}},
+		{name: "unknown action", def: "freedom", wantErr: true},
+		{name: "bad cidr", def: "direct", block: []string{"10.0.0.0/33"}, wantErr: true},
+		{name: "geosite needs data files", def: "direct", block: []string{"geosite:ads"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(tt.def, tt.block, tt.allow)
+			err := r.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			instance, err := NewXrayService(false, false).MakeInstance(context.Background(), r)
+			if err != nil {
+				t.Fatalf("MakeInstance() error = %v", err)
+			}
+			instance.Close()
+		})
+	}
+}
+
+func TestRouter_BareDomainMatchesSubdomains(t *testing.T) {
+	r := NewRouter("direct", []string{"example.com"}, nil)
+	if err := r.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.domains[blockTag]; len(got) != 1 || got[0] != "domain:example.com" {
+		t.Errorf("block domains = %v, want [domain:example.com]", got)
+	}
+}
@@ -3,7 +3,6 @@ package xray
 import (
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net"
 	"net/url"
@@ -15,7 +14,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/xtls/xray-core/infra/conf"
 )
 
@@ -28,81 +26,42 @@ func (s *Shadowsocks) Name() string {
 }
 
 func (s *Shadowsocks) Parse() error {
-	if !strings.HasPrefix(s.OrigLink, protocol.ShadowsocksIdentifier) {
-		return fmt.Errorf("shadowsocks unreconized: %s", s.OrigLink)
-	}
-
-	uri, err := url.Parse(s.OrigLink)
-	if err != nil {
-		return err
-	}
-
-	secondPart := strings.SplitN(s.OrigLink[5:], "@", 2)
-
-	var decoded []byte
-	// Encryption part - b64 encoded (EncryptionType : Password)
-	if len(secondPart) > 1 {
-		decoded, err = utils.Base64Decode(secondPart[0])
-		if err != nil {
-			return errors.New("error when decoding secret part")
-		}
-	} else {
-		return errors.New("invalid config link")
-	}
-
-	//link := "ss://" + string(decoded) + "@" + secondPart[1]
-	//uri, err := url.Parse(link)
-	//if err != nil {
-	//	return err
-	//}
-	creds := strings.SplitN(string(decoded), ":", 2)
-	if len(creds) != 2 {
-		return errors.New("error when decoding secret part")
-	}
-
-	s.Encryption = creds[0] // Encryption Type
-	s.Password = creds[1]   // Encryption Password
-
-	//hostPortRemark := strings.SplitN(secondPart[1], ":", 2)
-
-	s.Address, s.Port, err = net.SplitHostPort(uri.Host)
+	link, err := protocol.ParseShadowsocksLink(s.OrigLink)
 	if err != nil {
 		return err
 	}
+	s.Encryption = link.Method
+	s.Password = link.Password
+	s.Address = link.Address
+	s.Port = link.Port
+	s.Remark = link.Remark
+	s.Plugin = link.Plugin
 
 	if utils.IsIPv6(s.Address) {
 		s.Address = "[" + s.Address + "]"
 	}
-
-	s.Remark, err = url.PathUnescape(uri.Fragment)
-	if err != nil {
-		s.Remark = uri.Fragment
-	}
-
-	//s.Address = hostPortRemark[0]
-	//
-	//PortRemark := strings.SplitN(hostPortRemark[1], "#", 2)
-	//s.Port = PortRemark[0]
-
-	//remarkStr, _, _ := strings.Cut(PortRemark[1], "\n")
-
-	//s.Remark, err = url.PathUnescape(remarkStr)
-	//if err != nil {
-	//	s.Remark = remarkStr
-	//}
-
 	return nil
 }
 
 func (s *Shadowsocks) DetailsStr() string {
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n%s: %s\n",
-		color.RedString("Protocol"), s.Name(),
-		color.RedString("Remark"), s.Remark,
-		color.RedString("IP"), s.Address,
-		color.RedString("Port"), s.Port,
-		color.RedString("Encryption"), s.Encryption,
-		color.RedString("Password"), s.Password)
-	return info
+	d := protocol.NewDetails(s.Name(), s.Remark).
+		Add("Address", s.Address).
+		Add("Port", s.Port).
+		Add("Encryption", s.Encryption).
+		Add("Password", s.Password)
+	if s.Plugin != nil {
+		d.Add("Plugin", s.Plugin.String())
+		if err := s.Plugin.Check(); err != nil {
+			d.Warn("%v", err)
+		}
+	}
+	if w := protocol.ShadowsocksCipherWarning(s.Encryption); w != "" {
+		d.Warn("%s", w)
+	}
+	if err := protocol.CheckShadowsocks2022Keys(s.Encryption, s.Password); err != nil {
+		d.Warn("%v", err)
+	}
+	return d.String()
 }
 
 func (s *Shadowsocks) GetLink() string {
@@ -116,6 +75,9 @@ func (s *Shadowsocks) GetLink() string {
 		// We construct the final URL string manually as url.URL doesn't handle this specific format directly
 		hostPart := net.JoinHostPort(s.Address, s.Port)
 		link := fmt.Sprintf("ss://%s@%s", encodedCreds, hostPart)
+		if s.Plugin != nil {
+			link += "/?plugin=" + url.QueryEscape(s.Plugin.String())
+		}
 		if s.Remark != "" {
 			link += "#" + url.PathEscape(s.Remark)
 		}
@@ -135,28 +97,106 @@ func (s *Shadowsocks) ConvertToGeneralConfig() (g protocol.GeneralConfig) {
 }
 
 func (s *Shadowsocks) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDetourConfig, error) {
+	if err := protocol.CheckShadowsocks2022Keys(s.Encryption, s.Password); err != nil {
+		return nil, err
+	}
 	out := &conf.OutboundDetourConfig{}
 	out.Tag = "proxy"
 	out.Protocol = s.Name()
 
 	streamConf := &conf.StreamConfig{}
+	if s.Plugin != nil {
+		if err := s.pluginStream(streamConf, allowInsecure); err != nil {
+			return nil, err
+		}
+	}
 
 	out.StreamSetting = streamConf
-	oset := json.RawMessage([]byte(fmt.Sprintf(`{
-  "servers": [
-	{
-		"address": "%s",
-		"port": %v,
-		"password": "%s",
-		"method": "%s",
-		"uot": false
+	port, err := strconv.ParseUint(s.Port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", s.Port)
 	}
-  ]
-}`, s.Address, s.Port, s.Password, s.Encryption)))
+	// Marshalled rather than formatted: plain passwords may hold any character.
+	settings, err := json.Marshal(map[string]any{
+		"servers": []map[string]any{{
+			"address":  s.Address,
+			"port":     port,
+			"password": s.Password,
+			"method":   s.Encryption,
+			"uot":      false,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	oset := json.RawMessage(settings)
 	out.Settings = &oset
 	return out, nil
 }
 
+// pluginStream sets up st as the transport the SIP003 plugin of the link wraps the
+// connection in. Only the modes xray carries the same way the plugin does are
+// translated: v2ray-plugin multiplexes the connection below shadowsocks, which
+// xray's mux can't, and xray has no TLS obfuscation. The automatic core leaves
+// those to sing-box.
+func (s *Shadowsocks) pluginStream(st *conf.StreamConfig, allowInsecure bool) error {
+	if err := s.Plugin.Check(); err != nil {
+		return err
+	}
+	unsupported := fmt.Errorf("%s %s is not supported by the xray core, use the sing-box core", s.Plugin.Name, s.Plugin.Opts)
+
+	switch s.Plugin.Name {
+	case protocol.ShadowsocksPluginObfs:
+		if s.Plugin.Arg("obfs", "http") != "http" {
+			return unsupported
+		}
+		// simple-obfs sends a websocket upgrade request before the first payload
+		// and then relays the stream as is, as xray's HTTP header does.
+		host := s.Plugin.Arg("obfs-host", strings.Trim(s.Address, "[]"))
+		if s.Port != "80" {
+			host = net.JoinHostPort(host, s.Port)
+		}
+		header, err := json.Marshal(map[string]any{
+			"type": "http",
+			"request": map[string]any{
+				"path": []string{s.Plugin.Arg("obfs-uri", "/")},
+				"headers": map[string][]string{
+					"Host":       {host},
+					"User-Agent": {"curl/7.81.0"},
+					"Upgrade":    {"websocket"},
+					"Connection": {"Upgrade"},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		network := conf.TransportProtocol("tcp")
+		st.Network = &network
+		st.TCPSettings = &conf.TCPConfig{HeaderConfig: header}
+
+	case protocol.ShadowsocksPluginV2Ray:
+		if s.Plugin.Arg("mode", "websocket") != "websocket" || s.Plugin.Arg("mux", "1") != "0" {
+			return unsupported
+		}
+		host := s.Plugin.Arg("host", "cloudfront.com")
+		network := conf.TransportProtocol("ws")
+		st.Network = &network
+		st.WSSettings = &conf.WebSocketConfig{
+			Path:    s.Plugin.Arg("path", "/"),
+			Headers: map[string]string{"Host": host},
+		}
+		if _, ok := s.Plugin.Args["tls"]; ok {
+			st.Security = "tls"
+			st.TLSSettings = &conf.TLSConfig{
+				ServerName: s.Plugin.Arg("host", ""),
+				Insecure:   allowInsecure,
+			}
+		}
+	}
+	return nil
+}
+
 func (s *Shadowsocks) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
 	port, err := strconv.ParseUint(s.Port, 10, 32)
 	if err != nil {
@@ -81,3 +81,39 @@ func TestShadowsocks_GetLink(t *testing.T) {
 		})
 	}
 }
+
+func TestShadowsocks_BuildOutboundPlugin(t *testing.T) {
+	const creds = "ss://YWVzLTI1Ni1nY206cHc@1.2.3.4:8388/?plugin="
+	tests := []struct {
+		plugin  string
+		network string
+		wantErr bool
+	}{
+		{"obfs-local;obfs=http;obfs-host=www.bing.com", "tcp", false},
+		{"v2ray-plugin;mux=0;tls;host=example.com", "ws", false},
+		{"obfs-local;obfs=tls", "", true},
+		{"v2ray-plugin;tls;host=example.com", "", true}, // multiplexed by default
+		{"kcptun", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plugin, func(t *testing.T) {
+			s := &Shadowsocks{OrigLink: creds + url.QueryEscape(tt.plugin)}
+			if err := s.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			out, err := s.BuildOutboundDetourConfig(false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildOutboundDetourConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if out.StreamSetting.Network == nil || string(*out.StreamSetting.Network) != tt.network {
+				t.Errorf("network = %v, want %s", out.StreamSetting.Network, tt.network)
+			}
+			if _, err := out.Build(); err != nil {
+				t.Errorf("Build() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package xray
+
+import (
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// SetDialOptions sets the socket options of the outbounds built by this core.
+func (c *Core) SetDialOptions(o protocol.DialOptions) {
+	c.Dial = o
+}
+
+// applyDialOptions copies c.Dial into the sockopt of ob.
+func (c *Core) applyDialOptions(ob *conf.OutboundDetourConfig) {
+	if c.Dial.IsZero() {
+		return
+	}
+	if ob.StreamSetting == nil {
+		ob.StreamSetting = &conf.StreamConfig{}
+	}
+	if ob.StreamSetting.SocketSettings == nil {
+		ob.StreamSetting.SocketSettings = &conf.SocketConfig{}
+	}
+	so := ob.StreamSetting.SocketSettings
+
+	if c.Dial.TCPFastOpen {
+		so.TFO = true
+	}
+	if c.Dial.Interface != "" {
+		so.Interface = c.Dial.Interface
+	}
+	if c.Dial.Mark != 0 {
+		so.Mark = int32(c.Dial.Mark)
+	}
+	switch c.Dial.DomainStrategy {
+	case protocol.DomainStrategyPreferIPv4:
+		so.DomainStrategy = "UseIPv4v6"
+	case protocol.DomainStrategyPreferIPv6:
+		so.DomainStrategy = "UseIPv6v4"
+	case protocol.DomainStrategyIPv4Only:
+		so.DomainStrategy = "ForceIPv4"
+	case protocol.DomainStrategyIPv6Only:
+		so.DomainStrategy = "ForceIPv6"
+	}
+	if c.Dial.HappyEyeballs > 0 {
+		// xray only races addresses it resolved itself, so resolve both families.
+		if so.DomainStrategy == "" {
+			so.DomainStrategy = "UseIP"
+		}
+		so.HappyEyeballsSettings = &conf.HappyEyeballsConfig{
+			PrioritizeIPv6:   c.Dial.DomainStrategy == protocol.DomainStrategyPreferIPv6,
+			TryDelayMs:       uint64(c.Dial.HappyEyeballs.Milliseconds()),
+			Interleave:       1,
+			MaxConcurrentTry: 4,
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package xray
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+func TestApplyDialOptions(t *testing.T) {
+	c := NewXrayService(false, false)
+	c.SetDialOptions(protocol.DialOptions{
+		TCPFastOpen:    true,
+		Interface:      "eth1",
+		Mark:           255,
+		DomainStrategy: protocol.DomainStrategyPreferIPv6,
+		HappyEyeballs:  250 * time.Millisecond,
+	})
+	ob := &conf.OutboundDetourConfig{Protocol: "freedom"}
+	c.applyDialOptions(ob)
+
+	so := ob.StreamSetting.SocketSettings
+	if so.TFO != true || so.Interface != "eth1" || so.Mark != 255 || so.DomainStrategy != "UseIPv6v4" {
+		t.Errorf("socket settings = %+v", so)
+	}
+	if he := so.HappyEyeballsSettings; he == nil || he.TryDelayMs != 250 || !he.PrioritizeIPv6 {
+		t.Errorf("happy eyeballs = %+v", he)
+	}
+	if _, err := ob.Build(); err != nil {
+		t.Errorf("outbound with dial options doesn't build: %v", err)
+	}
+
+	// A forced IP version wins over the domain strategy.
+	c.SetIPVersion(4)
+	c.forceIPVersion(ob)
+	if so.DomainStrategy != "ForceIPv4" {
+		t.Errorf("domain strategy = %q, want ForceIPv4", so.DomainStrategy)
+	}
+}
+
+func TestViaFragment(t *testing.T) {
+	c := NewXrayService(false, false)
+	c.SetDialOptions(protocol.DialOptions{Fragment: true, Interface: "eth1"})
+	ob := &conf.OutboundDetourConfig{Protocol: "freedom"}
+	c.applyDialOptions(ob)
+	c.viaFragment(ob)
+
+	// The fragment outbound dials the server, so it gets the socket options.
+	if ob.StreamSetting.SocketSettings.DialerProxy != fragmentTag {
+		t.Errorf("outbound socket settings %+v", ob.StreamSetting.SocketSettings)
+	}
+	if _, err := ob.Build(); err != nil {
+		t.Errorf("outbound through the fragment outbound doesn't build: %v", err)
+	}
+	if _, err := c.buildFragmentOutbound(); err != nil {
+		t.Errorf("fragment outbound doesn't build: %v", err)
+	}
+}
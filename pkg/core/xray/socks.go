@@ -10,9 +10,7 @@ import (
 	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
-	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	net2 "github.com/xtls/xray-core/common/net"
 	"github.com/xtls/xray-core/infra/conf"
 )
@@ -42,12 +40,7 @@ func (s *Socks) Parse() error {
 		return err
 	}
 
-	if len(uri.User.String()) != 0 {
-		userB64, _ := utils.Base64Decode(uri.User.String())
-		creds := strings.Split(string(userB64), ":")
-		s.Username = creds[0]
-		s.Password = creds[1]
-	}
+	s.Username, s.Password = protocol.ProxyUser(uri.User)
 
 	s.OrigLink = s.OrigLink
 
@@ -55,23 +48,15 @@ func (s *Socks) Parse() error {
 }
 
 func (s *Socks) DetailsStr() string {
-	copyV := *s
-
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n",
-		color.RedString("Protocol"), s.Name(),
-		color.RedString("Remark"), copyV.Remark,
-		color.RedString("Network"), "tcp",
-		color.RedString("Address"), copyV.Address,
-		color.RedString("Port"), copyV.Port,
-	)
-
-	if len(copyV.Username) != 0 && len(copyV.Password) != 0 {
-		info += color.RedString("Username") + ": " + copyV.Username
-		info += "\n"
-		info += color.RedString("Password") + ": " + copyV.Password
-		info += "\n"
+	d := protocol.NewDetails(s.Name(), s.Remark).
+		Add("Network", "tcp").
+		Add("Address", s.Address).
+		Add("Port", s.Port)
+	if s.Username != "" && s.Password != "" {
+		d.Add("Username", s.Username).Add("Password", s.Password)
 	}
-	return info
+	d.Warn("SOCKS does not encrypt traffic or credentials")
+	return d.String()
 }
 
 // GetLink generates a SOCKS config link from the struct's fields.
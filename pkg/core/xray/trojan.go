@@ -13,7 +13,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/xtls/xray-core/infra/conf"
 )
 
@@ -35,6 +34,10 @@ func (t *Trojan) Parse() error {
 	}
 
 	t.Password = uri.User.String()
+	// Clients percent-encode passwords with reserved characters.
+	if unescaped, err := url.PathUnescape(t.Password); err == nil {
+		t.Password = unescaped
+	}
 	t.Address, t.Port, err = net.SplitHostPort(uri.Host)
 	if err != nil {
 		return fmt.Errorf("failed to split host and port for Trojan link: %w", err)
@@ -69,13 +72,18 @@ func (t *Trojan) Parse() error {
 	t.HeaderType = query.Get("headerType")
 	t.ServiceName = query.Get("serviceName")
 	t.Mode = query.Get("mode")
+	t.Extra = query.Get("extra")
 	t.PublicKey = query.Get("pbk")
 	t.ShortIds = query.Get("sid")
 	t.SpiderX = query.Get("spx")
 	t.AllowInsecure = query.Get("allowInsecure")
 	t.QuicSecurity = query.Get("quicSecurity")
 	t.Key = query.Get("key")
+	t.Seed = query.Get("seed")
 	t.Authority = query.Get("authority")
+	t.UserAgent = query.Get("userAgent")
+	t.EarlyData = query.Get("ed")
+	t.EarlyDataHdr = query.Get("eh")
 
 	unescapedRemark, err := url.PathUnescape(uri.Fragment)
 	if err != nil {
@@ -85,7 +93,7 @@ func (t *Trojan) Parse() error {
 	}
 
 	// Apply defaults or adjustments
-	if t.HeaderType == "xhttp" || t.HeaderType == "http" || t.Type == "ws" || t.Type == "h2" || t.Type == "xhttp" {
+	if t.HeaderType == "xhttp" || t.HeaderType == "http" || t.Type == "ws" || t.Type == "httpupgrade" || t.Type == "h2" || t.Type == "xhttp" || t.Type == "splithttp" {
 		if t.Path == "" {
 			t.Path = "/"
 		}
@@ -105,73 +113,41 @@ func (t *Trojan) Parse() error {
 }
 
 func (t *Trojan) DetailsStr() string {
-	copyV := *t
-	if copyV.Flow == "" || copyV.Type == "grpc" {
-		copyV.Flow = "none"
-	}
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n%s: %s\n",
-		color.RedString("Protocol"), t.Name(),
-		color.RedString("Remark"), t.Remark,
-		color.RedString("Network"), t.Type,
-		color.RedString("Address"), t.Address,
-		color.RedString("Port"), t.Port,
-		color.RedString("Password"), t.Password,
-		color.RedString("Flow"), copyV.Flow,
-	)
-
-	if copyV.Type == "xhttp" || copyV.Type == "http" || copyV.Type == "httpupgrade" || copyV.Type == "ws" || copyV.Type == "h2" || copyV.Type == "splithttp" {
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("Host"), copyV.Host,
-			color.RedString("Path"), copyV.Path)
-	} else if copyV.Type == "kcp" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("KCP Seed"), copyV.Path)
-	} else if copyV.Type == "grpc" {
-		if copyV.ServiceName == "" {
-			copyV.ServiceName = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n", color.RedString("ServiceName"), copyV.ServiceName)
+	d := protocol.NewDetails(t.Name(), t.Remark).
+		Add("Address", t.Address).
+		Add("Port", t.Port).
+		Add("Password", t.Password).
+		AddTransport(protocol.Transport{
+			Network:      t.Type,
+			HeaderType:   t.HeaderType,
+			Host:         t.Host,
+			Path:         t.Path,
+			EarlyData:    t.EarlyData,
+			EarlyDataHdr: t.EarlyDataHdr,
+			ServiceName:  t.ServiceName,
+			Authority:    t.Authority,
+			UserAgent:    t.UserAgent,
+			Mode:         t.Mode,
+			Extra:        t.Extra,
+			Seed:         t.Seed,
+			QUICSecurity: t.QuicSecurity,
+			QUICKey:      t.Key,
+		}).
+		AddTLS(protocol.TLS{
+			Security:      t.Security,
+			SNI:           t.SNI,
+			Host:          t.Host,
+			ALPN:          t.ALPN,
+			Fingerprint:   t.TlsFingerprint,
+			AllowInsecure: t.AllowInsecure,
+			PublicKey:     t.PublicKey,
+			ShortID:       t.ShortIds,
+			SpiderX:       t.SpiderX,
+		})
+	if t.Security != "tls" && t.Security != "reality" {
+		d.Warn("no TLS: the trojan password and traffic are sent in cleartext")
 	}
-
-	if copyV.Security == "reality" {
-		info += fmt.Sprintf("%s: reality\n", color.RedString("TLS"))
-		if copyV.SpiderX == "" {
-			copyV.SpiderX = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("Public key"), copyV.PublicKey,
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ShortID"), copyV.ShortIds,
-			color.RedString("SpiderX"), copyV.SpiderX,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint,
-		)
-	} else if copyV.Security == "tls" {
-		info += fmt.Sprintf("%s: tls\n", color.RedString("TLS"))
-		if len(copyV.SNI) == 0 {
-			if copyV.Host != "" {
-				copyV.SNI = copyV.Host
-			} else {
-				copyV.SNI = "none"
-			}
-		}
-		if len(copyV.ALPN) == 0 {
-			copyV.ALPN = "none"
-		}
-		if copyV.TlsFingerprint == "" {
-			copyV.TlsFingerprint = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ALPN"), copyV.ALPN,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint)
-
-		if t.AllowInsecure != "" {
-			info += fmt.Sprintf("%s: %v\n",
-				color.RedString("Insecure"), t.AllowInsecure)
-		}
-	} else {
-		info += fmt.Sprintf("%s: none\n", color.RedString("TLS"))
-	}
-	return info
+	return d.String()
 }
 
 func (t *Trojan) GetLink() string {
@@ -199,16 +175,21 @@ func (t *Trojan) GetLink() string {
 		addQueryParam("type", t.Type)
 		addQueryParam("host", t.Host)
 		addQueryParam("path", t.Path)
+		addQueryParam("ed", t.EarlyData)
+		addQueryParam("eh", t.EarlyDataHdr)
 		addQueryParam("headerType", t.HeaderType)
 		addQueryParam("serviceName", t.ServiceName)
 		addQueryParam("mode", t.Mode)
+		addQueryParam("extra", t.Extra)
 		addQueryParam("pbk", t.PublicKey)
 		addQueryParam("sid", t.ShortIds)
 		addQueryParam("spx", t.SpiderX)
 		addQueryParam("allowInsecure", t.AllowInsecure)
 		addQueryParam("quicSecurity", t.QuicSecurity)
 		addQueryParam("key", t.Key)
+		addQueryParam("seed", t.Seed)
 		addQueryParam("authority", t.Authority)
+		addQueryParam("userAgent", t.UserAgent)
 
 		baseURL.RawQuery = params.Encode()
 
@@ -277,60 +258,37 @@ func (t *Trojan) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDe
 			`, string(pathb), string(hostb))))
 		}
 	case "kcp":
-		s.KCPSettings = &conf.KCPConfig{}
-		headerType := t.HeaderType
-		if headerType == "" {
-			headerType = "none"
+		kcp, err := kcpConfig(t.HeaderType, t.kcpSeed(), t.Host)
+		if err != nil {
+			return nil, err
 		}
-		s.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, headerType)))
+		s.KCPSettings = kcp
+	case "quic":
+		return nil, errQUICRemoved
 	case "ws":
+		path, ed := protocol.ParseEarlyData(t.Path, t.EarlyData, t.EarlyDataHdr)
 		s.WSSettings = &conf.WebSocketConfig{}
-		s.WSSettings.Path = t.Path
+		s.WSSettings.Path = ed.XrayPath(path)
 		s.WSSettings.Headers = map[string]string{
 			"Host":       t.Host,
 			"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.131 Safari/537.36",
 		}
 		break
 	//case "h2", "http":
-	case "xhttp":
-		s.XHTTPSettings = &conf.SplitHTTPConfig{
-			Host: t.Host,
-			Path: t.Path,
-			Mode: t.Mode,
-		}
-		//if v.Host != "" {
-		//	h := conf.StringList(strings.Split(v.Host, ","))
-		//	s.XHTTPSettings.Host = &h
-		//}
-		if t.Mode == "" {
-			s.XHTTPSettings.Mode = "auto"
+	case "xhttp", "splithttp":
+		xhttp, err := xhttpConfig(t.Host, t.Path, t.Mode, t.Extra)
+		if err != nil {
+			return nil, err
 		}
+		s.XHTTPSettings = xhttp
 	case "httpupgrade":
+		path, ed := protocol.ParseEarlyData(t.Path, t.EarlyData, t.EarlyDataHdr)
 		s.HTTPUPGRADESettings = &conf.HttpUpgradeConfig{
 			Host: t.Host,
-			Path: t.Path,
-		}
-	case "splithttp":
-		s.SplitHTTPSettings = &conf.SplitHTTPConfig{
-			Host: t.Host,
-			Path: t.Path,
+			Path: ed.XrayPath(path),
 		}
 	case "grpc":
-		if len(t.ServiceName) > 0 {
-			if t.ServiceName[0] == '/' {
-				t.ServiceName = t.ServiceName[1:]
-			}
-		}
-		// multiMode is true only when explicitly set to "multi"
-		multiMode := t.Mode == "multi"
-		s.GRPCSettings = &conf.GRPCConfig{
-			Authority:          t.Authority,
-			InitialWindowsSize: 65536,
-			HealthCheckTimeout: 20,
-			MultiMode:          multiMode,
-			IdleTimeout:        60,
-			ServiceName:        t.ServiceName,
-		}
+		s.GRPCSettings = grpcConfig(t.ServiceName, t.Authority, t.Mode, t.UserAgent)
 
 		t.Flow = ""
 		//case "quic":
@@ -459,50 +417,32 @@ func (t *Trojan) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
 			`, string(pathb), string(hostb))))
 		}
 	case "kcp":
-		streamConfig.KCPSettings = &conf.KCPConfig{}
-		headerType := t.HeaderType
-		if headerType == "" {
-			headerType = "none"
+		kcp, err := kcpConfig(t.HeaderType, t.kcpSeed(), t.Host)
+		if err != nil {
+			return nil, err
 		}
-		streamConfig.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, headerType)))
+		streamConfig.KCPSettings = kcp
+	case "quic":
+		return nil, errQUICRemoved
 	case "ws":
 		streamConfig.WSSettings = &conf.WebSocketConfig{}
 		streamConfig.WSSettings.Path = t.Path
 		streamConfig.WSSettings.Headers = map[string]string{
 			"Host": t.Host,
 		}
-	case "xhttp":
-		streamConfig.XHTTPSettings = &conf.SplitHTTPConfig{
-			Host: t.Host,
-			Path: t.Path,
-			Mode: t.Mode,
-		}
-		if t.Mode == "" {
-			streamConfig.XHTTPSettings.Mode = "auto"
+	case "xhttp", "splithttp":
+		xhttp, err := xhttpConfig(t.Host, t.Path, t.Mode, t.Extra)
+		if err != nil {
+			return nil, err
 		}
+		streamConfig.XHTTPSettings = xhttp
 	case "httpupgrade":
 		streamConfig.HTTPUPGRADESettings = &conf.HttpUpgradeConfig{
 			Host: t.Host,
 			Path: t.Path,
 		}
-	case "splithttp":
-		streamConfig.SplitHTTPSettings = &conf.SplitHTTPConfig{
-			Host: t.Host,
-			Path: t.Path,
-		}
 	case "grpc":
-		if len(t.ServiceName) > 0 {
-			if t.ServiceName[0] == '/' {
-				t.ServiceName = t.ServiceName[1:]
-			}
-		}
-		// multiMode is true only when explicitly set to "multi"
-		multiMode := t.Mode == "multi"
-		streamConfig.GRPCSettings = &conf.GRPCConfig{
-			Authority:   t.Authority,
-			ServiceName: t.ServiceName,
-			MultiMode:   multiMode,
-		}
+		streamConfig.GRPCSettings = grpcConfig(t.ServiceName, t.Authority, t.Mode, t.UserAgent)
 	}
 
 	// Inbound TLS/REALITY requires certs, which aren't in the link. Fallback to none.
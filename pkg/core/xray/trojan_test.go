@@ -31,6 +31,10 @@ func TestTrojan_GetLink(t *testing.T) {
 			name: "No query params or remark",
 			link: "trojan://password@test.com:1234",
 		},
+		{
+			name: "Percent-encoded password",
+			link: "trojan://pa%23ss%40word@test.com:443?security=tls#escaped",
+		},
 		{
 			name: "IPv6 Host",
 			link: "trojan://secret@[2001:db8::1]:443?security=tls&sni=ipv6.example.com&type=ws&host=ipv6.example.com&path=%2F#IPv6-Test",
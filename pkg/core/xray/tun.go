@@ -6,7 +6,6 @@ import (
 
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 
-	"github.com/fatih/color"
 	"github.com/xtls/xray-core/infra/conf"
 )
 
@@ -61,16 +60,11 @@ func (t *Tun) Parse() error {
 }
 
 func (t *Tun) DetailsStr() string {
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %d\n%s: %d\n",
-		color.RedString("Protocol"), t.ProtocolName(),
-		color.RedString("Interface"), t.Name,
-		color.RedString("MTU"), t.MTU,
-		color.RedString("UserLevel"), t.UserLevel,
-	)
-	if t.Remark != "" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("Remark"), t.Remark)
-	}
-	return info
+	return protocol.NewDetails(t.ProtocolName(), t.Remark).
+		Add("Interface", t.Name).
+		Add("MTU", t.MTU).
+		Add("UserLevel", t.UserLevel).
+		String()
 }
 
 // GetLink returns the interface name (TUN has no URL format).
@@ -0,0 +1,20 @@
+package xray
+
+import (
+	"context"
+	"net"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+
+	"github.com/xtls/xray-core/core"
+)
+
+// ListenPacket returns a UDP connection relayed by the outbound of an instance
+// made by MakeHttpClient.
+func (c *Core) ListenPacket(ctx context.Context, instance protocol.Instance, dest string) (net.PacketConn, error) {
+	xrayInstance, ok := instance.(*core.Instance)
+	if !ok {
+		return nil, protocol.ErrForeignInstance
+	}
+	return core.DialUDP(ctx, xrayInstance)
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/xtls/xray-core/infra/conf"
 )
 
@@ -105,7 +104,11 @@ func (v *Vless) Parse() error {
 	v.AllowInsecure = query.Get("allowInsecure") // "1", "true", or ""
 	v.QuicSecurity = query.Get("quicSecurity")   // QUIC security: "none", "aes-128-gcm", etc.
 	v.Key = query.Get("key")                     // QUIC key
+	v.Seed = query.Get("seed")                   // KCP seed
 	v.Authority = query.Get("authority")         // GRPC authority
+	v.UserAgent = query.Get("userAgent")         // GRPC user agent
+	v.EarlyData = query.Get("ed")                // WS early data size
+	v.EarlyDataHdr = query.Get("eh")             // WS early data header
 
 	unescapedRemark, err := url.PathUnescape(uri.Fragment)
 	if err != nil {
@@ -115,7 +118,7 @@ func (v *Vless) Parse() error {
 	}
 
 	// Apply defaults or adjustments after parsing
-	if v.HeaderType == "http" || v.Type == "ws" || v.Type == "h2" || v.Type == "xhttp" {
+	if v.HeaderType == "http" || v.Type == "ws" || v.Type == "httpupgrade" || v.Type == "h2" || v.Type == "xhttp" || v.Type == "splithttp" {
 		if v.Path == "" {
 			v.Path = "/"
 		}
@@ -133,77 +136,47 @@ func (v *Vless) Parse() error {
 }
 
 func (v *Vless) DetailsStr() string {
-	copyV := *v
-	if copyV.Flow == "" || copyV.Type == "grpc" {
-		copyV.Flow = "none"
+	d := protocol.NewDetails(v.Name(), v.Remark).
+		Add("Address", v.Address).
+		Add("Port", v.Port).
+		Add("UUID", v.ID)
+	if v.Type != "grpc" {
+		d.Add("Flow", v.Flow)
 	}
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n%s: %s\n",
-		color.RedString("Protocol"), v.Name(),
-		color.RedString("Remark"), v.Remark,
-		color.RedString("Network"), v.Type,
-		color.RedString("Address"), v.Address,
-		color.RedString("Port"), v.Port,
-		color.RedString("UUID"), v.ID,
-		color.RedString("Flow"), copyV.Flow)
-	if copyV.Type == "xhttp" || copyV.HeaderType == "http" || copyV.Type == "httpupgrade" || copyV.Type == "ws" || copyV.Type == "h2" || copyV.Type == "splithttp" {
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("Host"), copyV.Host,
-			color.RedString("Path"), copyV.Path)
-	} else if copyV.Type == "kcp" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("KCP Seed"), copyV.Path)
-	} else if copyV.Type == "grpc" {
-		if copyV.ServiceName == "" {
-			copyV.ServiceName = "none"
-		}
-		if copyV.Authority == "" {
-			copyV.Authority = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("ServiceName"), copyV.ServiceName,
-			color.RedString("Authority"), copyV.Authority)
+	d.AddTransport(protocol.Transport{
+		Network:      v.Type,
+		HeaderType:   v.HeaderType,
+		Host:         v.Host,
+		Path:         v.Path,
+		EarlyData:    v.EarlyData,
+		EarlyDataHdr: v.EarlyDataHdr,
+		ServiceName:  v.ServiceName,
+		Authority:    v.Authority,
+		UserAgent:    v.UserAgent,
+		Mode:         v.Mode,
+		Extra:        v.Extra,
+		Seed:         v.Seed,
+		QUICSecurity: v.QuicSecurity,
+		QUICKey:      v.Key,
+	})
+	d.AddTLS(protocol.TLS{
+		Security:      v.Security,
+		SNI:           v.SNI,
+		Host:          v.Host,
+		ALPN:          v.ALPN,
+		Fingerprint:   v.TlsFingerprint,
+		AllowInsecure: v.AllowInsecure,
+		PublicKey:     v.PublicKey,
+		ShortID:       v.ShortIds,
+		SpiderX:       v.SpiderX,
+	})
+	if v.Security != "tls" && v.Security != "reality" {
+		d.Warn("no TLS: traffic to the server is not encrypted")
 	}
-
-	if copyV.Security == "reality" {
-		info += fmt.Sprintf("%s: reality\n", color.RedString("TLS"))
-		if copyV.SpiderX == "" {
-			copyV.SpiderX = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("Public key"), copyV.PublicKey,
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ShortID"), copyV.ShortIds,
-			color.RedString("SpiderX"), copyV.SpiderX,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint,
-		)
-	} else if copyV.Security == "tls" {
-		info += fmt.Sprintf("%s: tls\n", color.RedString("TLS"))
-		if len(copyV.SNI) == 0 {
-			if copyV.Host != "" {
-				copyV.SNI = copyV.Host
-			} else {
-				copyV.SNI = "none"
-			}
-		}
-		if len(copyV.ALPN) == 0 {
-			copyV.ALPN = "none"
-		}
-		if copyV.TlsFingerprint == "" {
-			copyV.TlsFingerprint = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ALPN"), copyV.ALPN,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint)
-
-		if v.AllowInsecure != "" {
-			info += fmt.Sprintf("%s: %v\n",
-				color.RedString("Insecure"), v.AllowInsecure)
-		}
-	} else {
-		info += fmt.Sprintf("%s: none\n", color.RedString("TLS"))
+	if v.Flow != "" && v.Type != "" && v.Type != "tcp" && v.Type != "raw" {
+		d.Warn("flow %s only works over raw TCP and is ignored on %s", v.Flow, v.Type)
 	}
-
-	return info
+	return d.String()
 }
 
 func (v *Vless) GetLink() string {
@@ -232,6 +205,8 @@ func (v *Vless) GetLink() string {
 		addQueryParam("type", v.Type)
 		addQueryParam("host", v.Host)
 		addQueryParam("path", v.Path)
+		addQueryParam("ed", v.EarlyData)
+		addQueryParam("eh", v.EarlyDataHdr)
 		addQueryParam("flow", v.Flow)
 		addQueryParam("pbk", v.PublicKey)
 		addQueryParam("sid", v.ShortIds)
@@ -239,10 +214,13 @@ func (v *Vless) GetLink() string {
 		addQueryParam("headerType", v.HeaderType)
 		addQueryParam("serviceName", v.ServiceName)
 		addQueryParam("mode", v.Mode)
+		addQueryParam("extra", v.Extra)
 		addQueryParam("allowInsecure", v.AllowInsecure)
 		addQueryParam("quicSecurity", v.QuicSecurity)
 		addQueryParam("key", v.Key)
+		addQueryParam("seed", v.Seed)
 		addQueryParam("authority", v.Authority)
+		addQueryParam("userAgent", v.UserAgent)
 
 		baseURL.RawQuery = params.Encode()
 
@@ -332,67 +310,36 @@ func (v *Vless) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDet
 			`, string(pathb), string(hostb)))
 		}
 	case "kcp":
-		s.KCPSettings = &conf.KCPConfig{}
-		headerType := v.HeaderType
-		if headerType == "" {
-			headerType = "none"
+		kcp, err := kcpConfig(v.HeaderType, v.kcpSeed(), v.Host)
+		if err != nil {
+			return nil, err
 		}
-		s.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, headerType)))
+		s.KCPSettings = kcp
+	case "quic":
+		return nil, errQUICRemoved
 	case "ws":
+		path, ed := protocol.ParseEarlyData(v.Path, v.EarlyData, v.EarlyDataHdr)
 		s.WSSettings = &conf.WebSocketConfig{}
-		s.WSSettings.Path = v.Path
+		s.WSSettings.Path = ed.XrayPath(path)
 		s.WSSettings.Headers = map[string]string{
 			"Host":       v.Host,
 			"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.131 Safari/537.36",
 		}
 		break
-	case "xhttp":
-		s.XHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-			Mode: v.Mode,
-		}
-		// decode the percent-encoded JSON from the URL
-		if v.Extra != "" {
-			decoded, err := url.QueryUnescape(v.Extra)
-			if err != nil {
-				return nil, fmt.Errorf("invalid extra parameter: %w", err)
-			}
-			s.XHTTPSettings.Extra = json.RawMessage(decoded)
-		}
-
-		if v.Mode == "" {
-			s.XHTTPSettings.Mode = "auto"
+	case "xhttp", "splithttp":
+		xhttp, err := xhttpConfig(v.Host, v.Path, v.Mode, v.Extra)
+		if err != nil {
+			return nil, err
 		}
+		s.XHTTPSettings = xhttp
 	case "httpupgrade":
+		path, ed := protocol.ParseEarlyData(v.Path, v.EarlyData, v.EarlyDataHdr)
 		s.HTTPUPGRADESettings = &conf.HttpUpgradeConfig{
 			Host: v.Host,
-			Path: v.Path,
-		}
-	case "splithttp":
-		s.SplitHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
+			Path: ed.XrayPath(path),
 		}
 	case "grpc":
-		if len(v.ServiceName) > 0 {
-			if v.ServiceName[0] == '/' {
-				v.ServiceName = v.ServiceName[1:]
-			}
-		}
-		// multiMode is true only when explicitly set to "multi"
-		multiMode := v.Mode == "multi"
-
-		s.GRPCSettings = &conf.GRPCConfig{
-			Authority:           v.Authority,
-			ServiceName:         v.ServiceName,
-			MultiMode:           multiMode,
-			IdleTimeout:         60,
-			HealthCheckTimeout:  20,
-			PermitWithoutStream: false,
-			InitialWindowsSize:  65536,
-			UserAgent:           "",
-		}
+		s.GRPCSettings = grpcConfig(v.ServiceName, v.Authority, v.Mode, v.UserAgent)
 		v.Flow = ""
 	}
 
@@ -484,56 +431,32 @@ func (v *Vless) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
 			`, string(pathb), string(hostb)))
 		}
 	case "kcp":
-		streamConfig.KCPSettings = &conf.KCPConfig{}
-		headerType := v.HeaderType
-		if headerType == "" {
-			headerType = "none"
+		kcp, err := kcpConfig(v.HeaderType, v.kcpSeed(), v.Host)
+		if err != nil {
+			return nil, err
 		}
-		streamConfig.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, headerType)))
+		streamConfig.KCPSettings = kcp
+	case "quic":
+		return nil, errQUICRemoved
 	case "ws":
 		streamConfig.WSSettings = &conf.WebSocketConfig{}
 		streamConfig.WSSettings.Path = v.Path
 		streamConfig.WSSettings.Headers = map[string]string{
 			"Host": v.Host,
 		}
-	case "xhttp":
-		streamConfig.XHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-			Mode: v.Mode,
-		}
-		if v.Mode == "" {
-			streamConfig.XHTTPSettings.Mode = "auto"
+	case "xhttp", "splithttp":
+		xhttp, err := xhttpConfig(v.Host, v.Path, v.Mode, v.Extra)
+		if err != nil {
+			return nil, err
 		}
+		streamConfig.XHTTPSettings = xhttp
 	case "httpupgrade":
 		streamConfig.HTTPUPGRADESettings = &conf.HttpUpgradeConfig{
 			Host: v.Host,
 			Path: v.Path,
 		}
-	case "splithttp":
-		streamConfig.SplitHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-		}
 	case "grpc":
-		if len(v.ServiceName) > 0 {
-			if v.ServiceName[0] == '/' {
-				v.ServiceName = v.ServiceName[1:]
-			}
-		}
-		// multiMode is true only when explicitly set to "multi"
-		multiMode := v.Mode == "multi"
-
-		streamConfig.GRPCSettings = &conf.GRPCConfig{
-			Authority:           v.Authority,
-			ServiceName:         v.ServiceName,
-			MultiMode:           multiMode,
-			IdleTimeout:         60,
-			HealthCheckTimeout:  20,
-			PermitWithoutStream: false,
-			InitialWindowsSize:  65536,
-			UserAgent:           "",
-		}
+		streamConfig.GRPCSettings = grpcConfig(v.ServiceName, v.Authority, v.Mode, v.UserAgent)
 	}
 
 	if v.Security == "tls" && v.CertFile != "" && v.KeyFile != "" {
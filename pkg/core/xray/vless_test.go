@@ -78,3 +78,36 @@ func TestVless_GetLink(t *testing.T) {
 		})
 	}
 }
+
+func TestVless_EarlyDataPath(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"ws ed param", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&type=ws&host=h.example.com&path=%2Fws&ed=2048&eh=Sec-WebSocket-Protocol#ed", "/ws?ed=2048"},
+		{"httpupgrade default path", "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&type=httpupgrade&host=h.example.com#hu", "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Vless{OrigLink: tt.link}
+			if err := v.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			out, err := v.BuildOutboundDetourConfig(false)
+			if err != nil {
+				t.Fatalf("BuildOutboundDetourConfig() error = %v", err)
+			}
+			var got string
+			switch {
+			case out.StreamSetting.WSSettings != nil:
+				got = out.StreamSetting.WSSettings.Path
+			case out.StreamSetting.HTTPUPGRADESettings != nil:
+				got = out.StreamSetting.HTTPUPGRADESettings.Path
+			}
+			if got != tt.want {
+				t.Errorf("path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 
-	"github.com/fatih/color"
 	"github.com/xtls/xray-core/infra/conf"
 )
 
@@ -153,7 +152,7 @@ func (v *Vmess) Parse() error {
 		}
 	}
 
-	if v.Type == "xhttp" || v.Type == "http" || v.Network == "ws" || v.Network == "h2" {
+	if v.Type == "http" || v.Network == "xhttp" || v.Network == "splithttp" || v.Network == "ws" || v.Network == "httpupgrade" || v.Network == "h2" {
 		if v.Path == "" {
 			v.Path = "/"
 		}
@@ -163,69 +162,55 @@ func (v *Vmess) Parse() error {
 }
 
 func (v *Vmess) DetailsStr() string {
-	copyV := *v
-	info := fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %v\n%s: %s\n",
-		color.RedString("Protocol"), v.Name(),
-		color.RedString("Remark"), copyV.Remark,
-		color.RedString("Network"), copyV.Network,
-		color.RedString("Address"), copyV.Address,
-		color.RedString("Port"), copyV.Port,
-		color.RedString("UUID"), copyV.ID)
-
-	if copyV.Network == "" {
-
-	} else if copyV.Type == "xhttp" || copyV.Type == "http" || copyV.Network == "httpupgrade" || copyV.Network == "ws" || copyV.Network == "h2" {
-		if copyV.Type == "" {
-			copyV.Type = "none"
-		}
-		if copyV.Host == "" {
-			copyV.Host = "none"
-		}
-		if copyV.Path == "" {
-			copyV.Path = "none"
-		}
-
-		info += fmt.Sprintf("%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("Type"), copyV.Type,
-			color.RedString("Host"), copyV.Host,
-			color.RedString("Path"), copyV.Path)
-	} else if copyV.Network == "kcp" {
-		info += fmt.Sprintf("%s: %s\n", color.RedString("KCP Seed"), copyV.Path)
-	} else if copyV.Network == "grpc" {
-		if copyV.Host == "" {
-			copyV.Host = "none"
-		}
-		info += fmt.Sprintf("%s: %s\n%s: %s\n",
-			color.RedString("ServiceName"), copyV.Path,
-			color.RedString("Authority"), copyV.Host)
+	transport := protocol.Transport{
+		Network: v.Network,
+		Host:    v.Host,
+		Path:    v.Path,
 	}
-
-	if len(copyV.TLS) != 0 && copyV.TLS != "none" {
-		if len(copyV.SNI) == 0 {
-			if copyV.Host != "" {
-				copyV.SNI = copyV.Host
-			} else {
-				copyV.SNI = "none"
-			}
-		}
-		if len(copyV.ALPN) == 0 {
-			copyV.ALPN = "none"
-		}
-		if len(copyV.TlsFingerprint) == 0 {
-			copyV.TlsFingerprint = "none"
-		}
-		info += fmt.Sprintf("%s: tls\n%s: %s\n%s: %s\n%s: %s\n",
-			color.RedString("TLS"),
-			color.RedString("SNI"), copyV.SNI,
-			color.RedString("ALPN"), copyV.ALPN,
-			color.RedString("Fingerprint"), copyV.TlsFingerprint)
-
-		if v.AllowInsecure != "" {
-			info += fmt.Sprintf("%s: %v\n",
-				color.RedString("Insecure"), v.AllowInsecure)
-		}
+	if v.Type == "http" {
+		transport.HeaderType = "http"
 	}
-	return info
+	switch v.Network {
+	case "kcp":
+		// VMess links carry the mKCP header in type and the seed in path.
+		transport.HeaderType = v.Type
+	case "quic":
+		// ...and the QUIC header in type, the security in host and the key in path.
+		transport.HeaderType, transport.QUICSecurity, transport.QUICKey = v.Type, v.Host, v.Path
+	}
+	if v.Network == "grpc" {
+		// VMess links carry the gRPC service name in path, the authority in host and the mode in type.
+		transport.ServiceName, transport.Authority = v.Path, v.Host
+		if v.Type == "gun" || v.Type == "multi" {
+			transport.Mode = v.Type
+		}
+	}
+	security := ""
+	if v.TLS != "" && v.TLS != "none" {
+		security = "tls"
+	}
+
+	d := protocol.NewDetails(v.Name(), v.Remark).
+		Add("Address", v.Address).
+		Add("Port", v.Port).
+		Add("UUID", v.ID).
+		AddIfSet("Cipher", v.Security).
+		AddTransport(transport).
+		AddTLS(protocol.TLS{
+			Security:      security,
+			SNI:           v.SNI,
+			Host:          v.Host,
+			ALPN:          v.ALPN,
+			Fingerprint:   v.TlsFingerprint,
+			AllowInsecure: v.AllowInsecure,
+		})
+	if aid, _ := strconv.Atoi(fmt.Sprint(v.Aid)); aid > 0 {
+		d.Warn("alterId is %d: legacy VMess (MD5) authentication is deprecated and easy to fingerprint", aid)
+	}
+	if security == "" && (v.Security == "none" || v.Security == "zero") {
+		d.Warn("VMess cipher is %s and TLS is off: traffic is sent in cleartext", v.Security)
+	}
+	return d.String()
 }
 
 func (v *Vmess) GetLink() string {
@@ -291,9 +276,15 @@ func (v *Vmess) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDet
 		}
 		break
 	case "kcp":
-		s.KCPSettings = &conf.KCPConfig{}
-		s.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, v.Type)))
+		// VMess links carry the mKCP header type in type and the seed in path.
+		kcp, err := kcpConfig(v.Type, v.Path, v.Host)
+		if err != nil {
+			return nil, err
+		}
+		s.KCPSettings = kcp
 		break
+	case "quic":
+		return nil, errQUICRemoved
 	case "ws":
 		s.WSSettings = &conf.WebSocketConfig{}
 		s.WSSettings.Path = v.Path
@@ -303,19 +294,12 @@ func (v *Vmess) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDet
 		}
 		break
 		//case "h2", "http":
-	case "xhttp":
-		s.XHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-			Mode: v.Type,
-		}
-		//if v.Host != "" {
-		//	h := conf.StringList(strings.Split(v.Host, ","))
-		//	s.XHTTPSettings.Host = &h
-		//}
-		if v.Type == "" {
-			s.XHTTPSettings.Mode = "auto"
+	case "xhttp", "splithttp":
+		xhttp, err := xhttpConfig(v.Host, v.Path, v.Type, "")
+		if err != nil {
+			return nil, err
 		}
+		s.XHTTPSettings = xhttp
 		break
 	case "httpupgrade":
 		s.HTTPUPGRADESettings = &conf.HttpUpgradeConfig{
@@ -323,30 +307,9 @@ func (v *Vmess) BuildOutboundDetourConfig(allowInsecure bool) (*conf.OutboundDet
 			Path: v.Path,
 		}
 		break
-	case "splithttp":
-		s.SplitHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-		}
-		break
 	case "grpc":
-		if len(v.Path) > 0 {
-			if v.Path[0] == '/' {
-				v.Path = v.Path[1:]
-			}
-		}
-		multiMode := false
-		if v.Type != "gun" {
-			multiMode = true
-		}
-		s.GRPCSettings = &conf.GRPCConfig{
-			InitialWindowsSize: 65536,
-			HealthCheckTimeout: 20,
-			MultiMode:          multiMode,
-			IdleTimeout:        60,
-			Authority:          v.Host,
-			ServiceName:        v.Path,
-		}
+		// VMess links carry the service name in path, the authority in host and the mode in type.
+		s.GRPCSettings = grpcConfig(v.Path, v.Host, v.Type, "")
 		break
 		//case "quic":
 		//	t := "none"
@@ -431,51 +394,33 @@ func (v *Vmess) BuildInboundDetourConfig() (*conf.InboundDetourConfig, error) {
 			`, string(pathb), string(hostb))))
 		}
 	case "kcp":
-		streamConfig.KCPSettings = &conf.KCPConfig{}
-		streamConfig.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, v.Type)))
+		// VMess links carry the mKCP header type in type and the seed in path.
+		kcp, err := kcpConfig(v.Type, v.Path, v.Host)
+		if err != nil {
+			return nil, err
+		}
+		streamConfig.KCPSettings = kcp
+	case "quic":
+		return nil, errQUICRemoved
 	case "ws":
 		streamConfig.WSSettings = &conf.WebSocketConfig{}
 		streamConfig.WSSettings.Path = v.Path
 		streamConfig.WSSettings.Headers = map[string]string{
 			"Host": v.Host,
 		}
-	case "xhttp":
-		streamConfig.XHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-			Mode: v.Type,
-		}
-		if v.Type == "" {
-			streamConfig.XHTTPSettings.Mode = "auto"
+	case "xhttp", "splithttp":
+		xhttp, err := xhttpConfig(v.Host, v.Path, v.Type, "")
+		if err != nil {
+			return nil, err
 		}
+		streamConfig.XHTTPSettings = xhttp
 	case "httpupgrade":
 		streamConfig.HTTPUPGRADESettings = &conf.HttpUpgradeConfig{
 			Host: v.Host,
 			Path: v.Path,
 		}
-	case "splithttp":
-		streamConfig.SplitHTTPSettings = &conf.SplitHTTPConfig{
-			Host: v.Host,
-			Path: v.Path,
-		}
 	case "grpc":
-		if len(v.Path) > 0 {
-			if v.Path[0] == '/' {
-				v.Path = v.Path[1:]
-			}
-		}
-		multiMode := false
-		if v.Type != "gun" {
-			multiMode = true
-		}
-		streamConfig.GRPCSettings = &conf.GRPCConfig{
-			InitialWindowsSize: 65536,
-			HealthCheckTimeout: 20,
-			MultiMode:          multiMode,
-			IdleTimeout:        60,
-			Authority:          v.Host,
-			ServiceName:        v.Path,
-		}
+		streamConfig.GRPCSettings = grpcConfig(v.Path, v.Host, v.Type, "")
 	}
 
 	if v.TLS == "tls" && v.CertFile != "" && v.KeyFile != "" {
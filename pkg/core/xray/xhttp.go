@@ -0,0 +1,54 @@
+package xray
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// xhttpModes are the upload modes xray accepts for the xhttp transport.
+var xhttpModes = map[string]bool{
+	"auto":       true,
+	"packet-up":  true,
+	"stream-up":  true,
+	"stream-one": true,
+}
+
+// xhttpConfig builds the settings of the xhttp transport (called splithttp before
+// xray 24.11) from link parameters. extra is the JSON object of the extra= parameter,
+// which some panels percent-encode a second time.
+func xhttpConfig(host, path, mode, extra string) (*conf.SplitHTTPConfig, error) {
+	if path == "" {
+		path = "/"
+	}
+	switch mode {
+	case "", "none":
+		mode = "auto"
+	default:
+		if !xhttpModes[mode] {
+			return nil, fmt.Errorf("unsupported xhttp mode %q", mode)
+		}
+	}
+	c := &conf.SplitHTTPConfig{
+		Host: host,
+		Path: path,
+		Mode: mode,
+	}
+
+	extra = strings.TrimSpace(extra)
+	if extra == "" {
+		return c, nil
+	}
+	if !json.Valid([]byte(extra)) {
+		decoded, err := url.QueryUnescape(extra)
+		if err != nil || !json.Valid([]byte(decoded)) {
+			return nil, fmt.Errorf("invalid xhttp extra parameter: not a JSON object")
+		}
+		extra = decoded
+	}
+	c.Extra = json.RawMessage(extra)
+	return c, nil
+}
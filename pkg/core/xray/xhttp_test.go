@@ -0,0 +1,66 @@
+package xray
+
+import (
+	"testing"
+)
+
+func TestXhttpConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		mode      string
+		extra     string
+		wantPath  string
+		wantMode  string
+		wantExtra string
+		wantErr   bool
+	}{
+		{name: "defaults", wantPath: "/", wantMode: "auto"},
+		{name: "vmess header type none", path: "/x", mode: "none", wantPath: "/x", wantMode: "auto"},
+		{name: "stream-one", path: "/x", mode: "stream-one", wantPath: "/x", wantMode: "stream-one"},
+		{name: "unknown mode", mode: "gun", wantErr: true},
+		{name: "raw extra", extra: `{"xPaddingBytes":"100-1000"}`, wantPath: "/", wantMode: "auto", wantExtra: `{"xPaddingBytes":"100-1000"}`},
+		{name: "encoded extra", extra: `%7B%22noGRPCHeader%22%3Atrue%7D`, wantPath: "/", wantMode: "auto", wantExtra: `{"noGRPCHeader":true}`},
+		{name: "broken extra", extra: `{"xmux":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := xhttpConfig("h.example.com", tt.path, tt.mode, tt.extra)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("xhttpConfig() error = %v", err)
+			}
+			if c.Path != tt.wantPath || c.Mode != tt.wantMode || string(c.Extra) != tt.wantExtra {
+				t.Errorf("got path=%q mode=%q extra=%s", c.Path, c.Mode, c.Extra)
+			}
+		})
+	}
+}
+
+func TestVless_XhttpOutbound(t *testing.T) {
+	for _, network := range []string{"xhttp", "splithttp"} {
+		t.Run(network, func(t *testing.T) {
+			v := &Vless{OrigLink: "vless://b1b1b1b1-c2c2-d3d3-e4e4-f5f5f5f5f5f5@1.2.3.4:443?security=tls&sni=h.example.com&type=" + network +
+				"&host=h.example.com&path=%2Fsplit&mode=packet-up&extra=%7B%22xPaddingBytes%22%3A%22100-1000%22%7D#x"}
+			if err := v.Parse(); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			out, err := v.BuildOutboundDetourConfig(false)
+			if err != nil {
+				t.Fatalf("BuildOutboundDetourConfig() error = %v", err)
+			}
+			x := out.StreamSetting.XHTTPSettings
+			if x == nil || x.Path != "/split" || x.Mode != "packet-up" || string(x.Extra) != `{"xPaddingBytes":"100-1000"}` {
+				t.Fatalf("unexpected xhttp settings: %+v", x)
+			}
+			if _, err := out.Build(); err != nil {
+				t.Errorf("xray rejected the outbound: %v", err)
+			}
+		})
+	}
+}
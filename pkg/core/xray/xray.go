@@ -15,6 +15,7 @@ import (
 	commlog "github.com/xtls/xray-core/common/log"
 	xraynet "github.com/xtls/xray-core/common/net"
 	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/common/session"
 	"github.com/xtls/xray-core/core"
 
 	// The following deps are necessary as they register handlers in their init functions.
@@ -37,6 +38,12 @@ type Core struct {
 	LogLevel commlog.Severity
 
 	AllowInsecure bool
+
+	// IPVersion, when 4 or 6, is the only address family config servers are dialed over.
+	IPVersion int
+
+	// Dial holds the socket options injected into every built outbound.
+	Dial protocol.DialOptions
 }
 
 func (c *Core) Name() string {
@@ -97,6 +104,9 @@ func (c *Core) MakeInstance(ctx context.Context, outbound protocol.Protocol) (pr
 	if err != nil {
 		return nil, err
 	}
+	c.applyDialOptions(ob)
+	c.forceIPVersion(ob)
+	c.viaFragment(ob)
 	built, err1 := ob.Build()
 	if err1 != nil {
 		return nil, err1
@@ -127,11 +137,29 @@ func (c *Core) MakeInstance(ctx context.Context, outbound protocol.Protocol) (pr
 		clientConfig.Inbound = []*core.InboundHandlerConfig{ibcBuilt}
 	}
 	clientConfig.Outbound = []*core.OutboundHandlerConfig{built}
+	if r, ok := out.(*Router); ok {
+		if err := addRouting(clientConfig, r); err != nil {
+			return nil, err
+		}
+	}
+	if c.Dial.Fragment {
+		fragment, err := c.buildFragmentOutbound()
+		if err != nil {
+			return nil, err
+		}
+		clientConfig.Outbound = append(clientConfig.Outbound, fragment)
+	}
 
 	server, err2 := core.New(clientConfig)
 	if err2 != nil {
 		return nil, err2
 	}
+	if rec := protocol.AccessRecorderFrom(ctx); rec != nil {
+		if err := trackAccess(server, rec); err != nil {
+			server.Close()
+			return nil, err
+		}
+	}
 	return server, nil
 }
 
@@ -161,6 +189,92 @@ func (c *Core) MakeHttpClient(ctx context.Context, outbound protocol.Protocol, m
 	}, instance, nil
 }
 
+// MakeHttpClientPool loads all outbounds into a single xray instance, each under its own
+// tag, and returns one HTTP client per outbound. Requests made through a client are
+// forced onto that client's outbound, so no routing rules or inbounds are needed.
+func (c *Core) MakeHttpClientPool(ctx context.Context, outbounds []protocol.Protocol, maxDelay time.Duration) ([]protocol.PooledClient, protocol.Instance, error) {
+	clients := make([]protocol.PooledClient, len(outbounds))
+	var built []*core.OutboundHandlerConfig
+	tags := make([]string, len(outbounds))
+
+	for i, outbound := range outbounds {
+		out, ok := outbound.(Protocol)
+		if !ok {
+			clients[i].Err = fmt.Errorf("protocol is not supported by xray-core")
+			continue
+		}
+		ob, err := out.BuildOutboundDetourConfig(c.AllowInsecure)
+		if err != nil {
+			clients[i].Err = err
+			continue
+		}
+		ob.Tag = fmt.Sprintf("pool-%d", i)
+		c.applyDialOptions(ob)
+		c.forceIPVersion(ob)
+		c.viaFragment(ob)
+		handler, err := ob.Build()
+		if err != nil {
+			clients[i].Err = err
+			continue
+		}
+		tags[i] = ob.Tag
+		built = append(built, handler)
+	}
+
+	if len(built) == 0 {
+		return clients, nil, fmt.Errorf("no outbound in the pool could be built")
+	}
+	if c.Dial.Fragment {
+		fragment, err := c.buildFragmentOutbound()
+		if err != nil {
+			return nil, nil, err
+		}
+		built = append(built, fragment)
+	}
+
+	clientConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&applog.Config{
+				ErrorLogType:  c.LogType,
+				AccessLogType: c.LogType,
+				ErrorLogLevel: c.LogLevel,
+				EnableDnsLog:  false,
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+		Outbound: built,
+	}
+
+	instance, err := core.New(clientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		tag := tag
+		tr := &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dest, err := xraynet.ParseDestination(fmt.Sprintf("%s:%s", network, addr))
+				if err != nil {
+					return nil, err
+				}
+				return core.Dial(session.SetForcedOutboundTagToContext(ctx, tag), instance, dest)
+			},
+		}
+		clients[i].Client = &http.Client{
+			Transport: tr,
+			Timeout:   maxDelay,
+		}
+	}
+
+	return clients, instance, nil
+}
+
 //func (c *Core) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
 //	dest, err := xraynet.ParseDestination(fmt.Sprintf("%s:%s", network, addr))
 //	if err != nil {
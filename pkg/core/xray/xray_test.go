@@ -6,6 +6,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
 )
 
 // areURLEqual compares two URL strings by parsing them and comparing their components.
@@ -212,3 +214,43 @@ func TestCore_MakeHttpClient(t *testing.T) {
 		t.Errorf("instance.Close() error = %v", err)
 	}
 }
+
+func TestCore_MakeHttpClientPool(t *testing.T) {
+	// Loads several outbounds into one instance. It does not make a real network request.
+	x := NewXrayService(false, false)
+	links := []string{
+		"vless://00000000-0000-0000-0000-000000000000@1.1.1.1:80?type=ws&host=example.com&path=%2F",
+		"trojan://password@1.2.3.4:443?security=tls&sni=example.com&type=tcp#Trojan",
+		"vless://00000000-0000-0000-0000-000000000000@1.0.0.1:443?type=grpc&serviceName=svc&security=tls&sni=example.com",
+	}
+
+	var protos []protocol.Protocol
+	for _, link := range links {
+		p, err := x.CreateProtocol(link)
+		if err != nil {
+			t.Fatalf("CreateProtocol(%q) error = %v", link, err)
+		}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("Parse(%q) error = %v", link, err)
+		}
+		protos = append(protos, p)
+	}
+
+	clients, instance, err := x.MakeHttpClientPool(context.Background(), protos, 10*time.Second)
+	if err != nil {
+		t.Fatalf("MakeHttpClientPool() error = %v", err)
+	}
+	defer instance.Close()
+
+	if len(clients) != len(links) {
+		t.Fatalf("expected %d clients, got %d", len(links), len(clients))
+	}
+	for i, c := range clients {
+		if c.Err != nil {
+			t.Errorf("client %d: unexpected error %v", i, c.Err)
+		}
+		if c.Client == nil {
+			t.Errorf("client %d is nil", i)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Package dnscache runs an in-process DNS cache shared by the workers of a bulk
+// test, so the server names of thousands of configs are each resolved once
+// instead of once per config, per core instance and per retry.
+//
+// The cache is a small DNS server on the loopback interface. Install points the
+// process resolver at it, which covers the xray core, raw probes and direct
+// requests; sing-box instances are given its address as their DNS server.
+// Lookups the cache can't answer go to the system resolver, or to a custom one.
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultTTL is how long an answer is kept. Config servers rarely move during
+	// a test run, so it is much longer than a typical record TTL.
+	DefaultTTL = 10 * time.Minute
+	// DefaultNegativeTTL is how long a name without records is remembered.
+	DefaultNegativeTTL = time.Minute
+
+	// lookupTimeout bounds a lookup of the upstream resolver.
+	lookupTimeout = 5 * time.Second
+	// maxAnswers caps the addresses in an answer, keeping it within a UDP packet.
+	maxAnswers = 16
+)
+
+// Stats are the counters of a cache.
+type Stats struct {
+	Hits     int64 // questions answered from the cache
+	Misses   int64 // questions sent to the upstream resolver
+	Failures int64 // upstream lookups that failed; they aren't cached
+}
+
+// Lookups returns the number of questions the cache answered.
+func (s Stats) Lookups() int64 {
+	return s.Hits + s.Misses
+}
+
+// HitRate returns the share of questions answered from the cache, 0..1.
+func (s Stats) HitRate() float64 {
+	if s.Lookups() == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Lookups())
+}
+
+// Cache is a caching DNS server on the loopback interface. Concurrent questions
+// for the same name and type share one upstream lookup.
+type Cache struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	upstream *net.Resolver
+	conn     net.PacketConn
+
+	mu      sync.Mutex
+	entries map[question]*entry
+
+	hits, misses, failures atomic.Int64
+}
+
+type question struct {
+	name  string // lower case, fully qualified
+	qtype dnsmessage.Type
+}
+
+// entry is an answer, or a lookup in flight until ready is closed. expires is
+// zero while the lookup is in flight.
+type entry struct {
+	ready   chan struct{}
+	addrs   []netip.Addr
+	failed  bool
+	expires time.Time
+}
+
+// New starts a cache on a free port of 127.0.0.1. resolver is the host[:port]
+// of the DNS server answering what isn't cached, or "" for the system resolver.
+func New(resolver string) (*Cache, error) {
+	upstream, err := upstreamResolver(resolver)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not start the DNS cache: %w", err)
+	}
+	c := &Cache{
+		TTL:         DefaultTTL,
+		NegativeTTL: DefaultNegativeTTL,
+		upstream:    upstream,
+		conn:        conn,
+		entries:     make(map[question]*entry),
+	}
+	go c.serve()
+	return c, nil
+}
+
+// upstreamResolver returns a resolver asking the DNS server at addr, or the
+// system resolver when addr is empty.
+func upstreamResolver(addr string) (*net.Resolver, error) {
+	if addr == "" {
+		// Not net.DefaultResolver, which Install points at the cache itself.
+		return &net.Resolver{}, nil
+	}
+	server, err := ParseResolver(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}, nil
+}
+
+// ParseResolver checks the address of a DNS server, host or host:port, and
+// returns it with the port, 53 unless given.
+func ParseResolver(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), "53"
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 || host == "" || strings.ContainsAny(host, "/ ") {
+		return "", fmt.Errorf("invalid DNS resolver %q: use host or host:port, e.g. 1.1.1.1 or 9.9.9.9:53", addr)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Addr returns the host:port the cache answers on.
+func (c *Cache) Addr() string {
+	return c.conn.LocalAddr().String()
+}
+
+// Resolver returns a resolver asking the cache.
+func (c *Cache) Resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", c.Addr())
+		},
+	}
+}
+
+// Install makes the cache the resolver of this process and returns a function
+// restoring the previous one. Call it before the workers start.
+func (c *Cache) Install() (restore func()) {
+	prev := net.DefaultResolver
+	net.DefaultResolver = c.Resolver()
+	return func() { net.DefaultResolver = prev }
+}
+
+// Stats returns the counters of the cache so far.
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Failures: c.failures.Load()}
+}
+
+// Close stops the cache.
+func (c *Cache) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Cache) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		go func() {
+			if reply := c.answer(packet); reply != nil {
+				c.conn.WriteTo(reply, addr)
+			}
+		}()
+	}
+}
+
+// answer returns the reply to a DNS query, or nil for a packet that isn't one.
+func (c *Cache) answer(packet []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil || header.Response {
+		return nil
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil
+	}
+	reply := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			OpCode:             header.OpCode,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: questions,
+	}
+	switch {
+	case header.OpCode != 0 || len(questions) != 1:
+		reply.RCode = dnsmessage.RCodeNotImplemented
+	case questions[0].Class != dnsmessage.ClassINET:
+		reply.RCode = dnsmessage.RCodeNotImplemented
+	case questions[0].Type == dnsmessage.TypeA || questions[0].Type == dnsmessage.TypeAAAA:
+		q := questions[0]
+		addrs, ok := c.lookup(question{strings.ToLower(q.Name.String()), q.Type})
+		if !ok {
+			reply.RCode = dnsmessage.RCodeServerFailure
+			break
+		}
+		reply.Answers = resources(q, addrs, c.TTL)
+	default:
+		// Other types (HTTPS, MX...) have no answer here; an empty one makes the
+		// asker fall back to A and AAAA.
+	}
+	out, err := reply.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// lookup returns the addresses of q, from the cache or the upstream resolver.
+// ok is false when the upstream lookup failed.
+func (c *Cache) lookup(q question) (addrs []netip.Addr, ok bool) {
+	c.mu.Lock()
+	if e, found := c.entries[q]; found && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		c.mu.Unlock()
+		<-e.ready
+		if e.failed {
+			return nil, false
+		}
+		c.hits.Add(1)
+		return e.addrs, true
+	}
+	e := &entry{ready: make(chan struct{})}
+	c.entries[q] = e
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+	e.addrs, e.failed = c.resolve(q)
+	ttl := c.TTL
+	if len(e.addrs) == 0 {
+		ttl = c.NegativeTTL
+	}
+	c.mu.Lock()
+	e.expires = time.Now().Add(ttl)
+	if e.failed {
+		c.failures.Add(1)
+		delete(c.entries, q)
+	}
+	c.mu.Unlock()
+	close(e.ready)
+	return e.addrs, !e.failed
+}
+
+// resolve asks the upstream resolver for q. A name without records of q's type
+// isn't a failure: it has no addresses.
+func (c *Cache) resolve(q question) (addrs []netip.Addr, failed bool) {
+	network := "ip4"
+	if q.qtype == dnsmessage.TypeAAAA {
+		network = "ip6"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	found, err := c.upstream.LookupNetIP(ctx, network, q.name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		return nil, !(errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+	}
+	for _, a := range found {
+		a = a.Unmap()
+		if a.Is4() == (q.qtype == dnsmessage.TypeA) {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs, false
+}
+
+// resources returns the answer records of q for addrs.
+func resources(q dnsmessage.Question, addrs []netip.Addr, ttl time.Duration) []dnsmessage.Resource {
+	var out []dnsmessage.Resource
+	for _, a := range addrs[:min(len(addrs), maxAnswers)] {
+		header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: uint32(ttl.Seconds())}
+		if q.Type == dnsmessage.TypeA {
+			out = append(out, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: a.As4()}})
+		} else {
+			out = append(out, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: a.As16()}})
+		}
+	}
+	return out
+}
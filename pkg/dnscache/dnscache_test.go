@@ -0,0 +1,184 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeUpstream is a DNS server answering A questions for names in addrs,
+// NXDOMAIN for other names, and counting the questions it gets.
+type fakeUpstream struct {
+	conn    net.PacketConn
+	addrs   map[string]netip.Addr
+	queries atomic.Int64
+}
+
+func startUpstream(t *testing.T, addrs map[string]netip.Addr) *fakeUpstream {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	u := &fakeUpstream{conn: conn, addrs: addrs}
+	go u.serve()
+	return u
+}
+
+func (u *fakeUpstream) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := u.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if msg.Unpack(buf[:n]) != nil || len(msg.Questions) != 1 {
+			continue
+		}
+		u.queries.Add(1)
+		// Answer slowly, so concurrent questions overlap.
+		time.Sleep(20 * time.Millisecond)
+		q := msg.Questions[0]
+		msg.Response = true
+		ip, ok := u.addrs[strings.ToLower(q.Name.String())]
+		switch {
+		case !ok:
+			msg.RCode = dnsmessage.RCodeNameError
+		case q.Type == dnsmessage.TypeA:
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+				Body:   &dnsmessage.AResource{A: ip.As4()},
+			}}
+		}
+		out, _ := msg.Pack()
+		u.conn.WriteTo(out, addr)
+	}
+}
+
+func TestCacheSharesLookups(t *testing.T) {
+	want := netip.MustParseAddr("192.0.2.7")
+	upstream := startUpstream(t, map[string]netip.Addr{"server.example.": want})
+	cache, err := New(upstream.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	// A resolver merges concurrent lookups of a name itself, so each worker gets
+	// its own, like the core instances of a test do.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := cache.Resolver().LookupNetIP(context.Background(), "ip4", "server.example.")
+			if err == nil && (len(addrs) != 1 || addrs[0] != want) {
+				err = fmt.Errorf("got %v, want %v", addrs, want)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Twenty workers asked the cache; the upstream heard the name once.
+	if n := upstream.queries.Load(); n != 1 {
+		t.Errorf("upstream got %d questions, want 1", n)
+	}
+	s := cache.Stats()
+	if s.Lookups() != 20 || s.Misses != 1 || s.Failures != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+	if rate := s.HitRate(); rate != 0.95 {
+		t.Errorf("hit rate = %v, want 0.95", rate)
+	}
+}
+
+func TestCacheNegativeAnswers(t *testing.T) {
+	upstream := startUpstream(t, nil)
+	cache, err := New(upstream.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	resolver := cache.Resolver()
+	for i := 0; i < 3; i++ {
+		_, err := resolver.LookupNetIP(context.Background(), "ip4", "missing.example.")
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Fatalf("lookup %d: err = %v, want not found", i, err)
+		}
+	}
+	if n := upstream.queries.Load(); n != 1 {
+		t.Errorf("upstream got %d questions, want 1", n)
+	}
+
+	// Once the negative TTL is up, the name is asked again.
+	cache.mu.Lock()
+	for _, e := range cache.entries {
+		e.expires = time.Now().Add(-time.Second)
+	}
+	cache.mu.Unlock()
+	resolver.LookupNetIP(context.Background(), "ip4", "missing.example.")
+	if n := upstream.queries.Load(); n != 2 {
+		t.Errorf("upstream got %d questions after expiry, want 2", n)
+	}
+}
+
+func TestCacheInstall(t *testing.T) {
+	upstream := startUpstream(t, map[string]netip.Addr{"server.example.": netip.MustParseAddr("192.0.2.8")})
+	cache, err := New(upstream.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	prev := net.DefaultResolver
+	restore := cache.Install()
+	addrs, err := net.DefaultResolver.LookupNetIP(context.Background(), "ip4", "server.example.")
+	restore()
+	if err != nil || len(addrs) != 1 {
+		t.Fatalf("lookup through the process resolver: %v, %v", addrs, err)
+	}
+	if net.DefaultResolver != prev {
+		t.Error("restore didn't bring back the previous resolver")
+	}
+}
+
+func TestParseResolver(t *testing.T) {
+	for in, want := range map[string]string{
+		"1.1.1.1":           "1.1.1.1:53",
+		"9.9.9.9:5353":      "9.9.9.9:5353",
+		"dns.example":       "dns.example:53",
+		"[2606:4700::1111]": "[2606:4700::1111]:53",
+		"2606:4700::1111":   "[2606:4700::1111]:53",
+	} {
+		got, err := ParseResolver(in)
+		if err != nil || got != want {
+			t.Errorf("ParseResolver(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "https://dns.example/dns-query"} {
+		if _, err := ParseResolver(in); err == nil {
+			t.Errorf("ParseResolver(%q) accepted", in)
+		}
+	}
+}
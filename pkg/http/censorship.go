@@ -0,0 +1,105 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// Failure classes of Result.Failure.
+const (
+	// FailureBlocked means the test showed signs of censorship: a reset during
+	// the handshakes, an injected block page or a certificate of another issuer.
+	FailureBlocked = "blocked"
+	// FailureDown means nothing pointed at interference: the server refused,
+	// timed out or closed the connection.
+	FailureDown = "down"
+)
+
+// BlockPage is the fingerprint of the page a national filter injects in place of
+// a blocked site: strings only found in that page, any of which identifies it.
+type BlockPage struct {
+	Name    string
+	Markers []string
+}
+
+// BlockPages are the block pages recognized in test responses.
+var BlockPages = []BlockPage{
+	{Name: "iran", Markers: []string{"10.10.34.34", "10.10.34.35", "10.10.34.36", "peyvandha.ir"}},
+	{Name: "russia", Markers: []string{"eais.rkn.gov.ru", "blocklist.rkn.gov.ru"}},
+	{Name: "turkey", Markers: []string{"5651 sayılı"}},
+	{Name: "indonesia", Markers: []string{"internetpositif", "trustpositif"}},
+	{Name: "south-korea", Markers: []string{"warning.or.kr"}},
+}
+
+// matchBlockPage returns the name of the block page body is, or "".
+func matchBlockPage(body []byte) string {
+	for _, p := range BlockPages {
+		for _, m := range p.Markers {
+			if bytes.Contains(body, []byte(m)) {
+				return p.Name
+			}
+		}
+	}
+	return ""
+}
+
+// classifyFailure tells whether a failed test request was blocked or its server
+// is down, and for a block the signal that gave it away: "rst" for a connection
+// reset during the connect or TLS stage, "cert:<issuer>" for a certificate that
+// doesn't belong to the test URL.
+func classifyFailure(err error) (class, signal string) {
+	if issuer, ok := foreignCertIssuer(err); ok {
+		return FailureBlocked, "cert:" + issuer
+	}
+	stage := FailedStage(err)
+	if (stage == StageConnect || stage == StageTLS) && isReset(err) {
+		return FailureBlocked, "rst"
+	}
+	return FailureDown, ""
+}
+
+// foreignCertIssuer returns the issuer of a certificate the client's own TLS
+// handshake with the test URL, made inside the tunnel, rejected as not signed by
+// a trusted CA or not issued for the host, which is what an intercepting
+// middlebox presents. A certificate the outbound rejected in its handshake with
+// the config server, for a wrong sni say, means the config is misconfigured: it
+// fails the connect stage, or reaches the TLS stage flattened by the core.
+func foreignCertIssuer(err error) (string, bool) {
+	var verify *tls.CertificateVerificationError
+	if FailedStage(err) != StageTLS || !errors.As(err, &verify) {
+		return "", false
+	}
+	var cert *x509.Certificate
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &unknown):
+		cert = unknown.Cert
+	case errors.As(err, &hostname):
+		cert = hostname.Certificate
+	case len(verify.UnverifiedCertificates) > 0:
+		cert = verify.UnverifiedCertificates[0]
+	}
+	if cert == nil {
+		return "unknown", true
+	}
+	if cert.Issuer.CommonName != "" {
+		return cert.Issuer.CommonName, true
+	}
+	if len(cert.Issuer.Organization) > 0 {
+		return cert.Issuer.Organization[0], true
+	}
+	return "unknown", true
+}
+
+func isReset(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset by peer") || strings.Contains(msg, "forcibly closed by the remote host")
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	// Resets every connection once the client hello arrives.
+	resetting, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resetting.Close()
+	go func() {
+		for {
+			c, err := resetting.Accept()
+			if err != nil {
+				return
+			}
+			c.Read(make([]byte, 1024))
+			c.(*net.TCPConn).SetLinger(0)
+			c.Close()
+		}
+	}()
+
+	intercepting := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer intercepting.Close()
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	refused := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantClass  string
+		wantSignal string
+	}{
+		{"reset", "https://" + resetting.Addr().String(), FailureBlocked, "rst"},
+		{"untrusted certificate", intercepting.URL, FailureBlocked, "cert:Acme Co"},
+		{"refused", "http://" + refused, FailureDown, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MeasureDelayStaged(context.Background(), http.DefaultClient, tt.url, "GET", StageTimeouts{})
+			if err == nil {
+				t.Fatal("request succeeded")
+			}
+			class, signal := classifyFailure(err)
+			if class != tt.wantClass || signal != tt.wantSignal {
+				t.Errorf("classifyFailure(%v) = %q, %q, want %q, %q", err, class, signal, tt.wantClass, tt.wantSignal)
+			}
+		})
+	}
+}
+
+func TestClassifyFailureOwnHandshake(t *testing.T) {
+	cert := &x509.Certificate{Issuer: pkix.Name{CommonName: "Middlebox CA"}}
+	mismatch := &tls.CertificateVerificationError{
+		UnverifiedCertificates: []*x509.Certificate{cert},
+		Err:                    x509.HostnameError{Certificate: cert, Host: "www.example.com"},
+	}
+	tests := []struct {
+		name       string
+		err        error
+		wantClass  string
+		wantSignal string
+	}{
+		// The test URL's certificate, seen by the client's handshake inside the tunnel.
+		{"test url certificate", &StageError{Stage: StageTLS, Err: &url.Error{Op: "Get", URL: "https://www.example.com", Err: mismatch}}, FailureBlocked, "cert:Middlebox CA"},
+		// The outbound rejecting the config server's certificate, for a wrong sni.
+		{"outbound dial", &StageError{Stage: StageConnect, Err: mismatch}, FailureDown, ""},
+		{"flattened by the core", &StageError{Stage: StageTLS, Err: errors.New("proxy/vless/outbound: failed to dial > tls: failed to verify certificate: x509: certificate is valid for a.example.com, not wrong.example.com")}, FailureDown, ""},
+		{"flattened unknown authority", &StageError{Stage: StageTLS, Err: errors.New("x509: certificate signed by unknown authority")}, FailureDown, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, signal := classifyFailure(tt.err)
+			if class != tt.wantClass || signal != tt.wantSignal {
+				t.Errorf("classifyFailure() = %q, %q, want %q, %q", class, signal, tt.wantClass, tt.wantSignal)
+			}
+		})
+	}
+}
+
+func TestExamineWithClient_BlockPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><iframe src="http://10.10.34.34?type=Invalid Site&policy=MainPolicy"></iframe></body></html>`))
+	}))
+	defer srv.Close()
+
+	e := &Examiner{MaxDelay: 5000, TestEndpoint: srv.URL, TestEndpointHttpMethod: "GET"}
+	r, err := e.examineWithClient(context.Background(), Result{ConfigLink: "vless://x", Status: "passed"}, srv.Client())
+	if err == nil || r.Status != "failed" {
+		t.Fatalf("status = %s, want failed", r.Status)
+	}
+	if r.Failure != FailureBlocked || r.BlockSignal != "block-page:iran" {
+		t.Errorf("failure = %q, %q, want %q, %q", r.Failure, r.BlockSignal, FailureBlocked, "block-page:iran")
+	}
+}
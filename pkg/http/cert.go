@@ -0,0 +1,153 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// Certificate warnings reported in Result.CertWarnings.
+const (
+	CertExpired    = "expired"
+	CertExpiring   = "expiring"    // expires within CertExpiryWarning
+	CertMismatch   = "mismatch"    // not valid for the SNI of the config
+	CertSelfSigned = "self-signed" // signed by its own key
+	CertUntrusted  = "untrusted"   // doesn't chain up to a CA the system trusts
+)
+
+// CertExpiryWarning is how close to its expiry a certificate is reported as expiring.
+var CertExpiryWarning = 14 * 24 * time.Hour
+
+// CertInfo describes the certificate a config server presents.
+type CertInfo struct {
+	Subject  string
+	Issuer   string
+	SANs     []string
+	NotAfter time.Time
+	// Chain is the number of certificates the server sent.
+	Chain    int
+	Warnings []string
+}
+
+// InspectCert makes a TLS handshake with addr as a client of the config would,
+// offering sni and alpn, and returns what the certificate it presents looks like.
+// The certificate is not required to be valid: problems are listed in Warnings.
+func InspectCert(ctx context.Context, network, addr, sni string, alpn []string) (*CertInfo, error) {
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName:         sni,
+		NextProtos:         alpn,
+		InsecureSkipVerify: true,
+	}}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, errors.New("the server sent no certificate")
+	}
+	return describeCert(chain, sni, time.Now()), nil
+}
+
+// describeCert checks the chain a server sent for sni at time now.
+func describeCert(chain []*x509.Certificate, sni string, now time.Time) *CertInfo {
+	leaf := chain[0]
+	info := &CertInfo{
+		Subject:  certName(leaf.Subject.CommonName, leaf.Subject.Organization),
+		Issuer:   certName(leaf.Issuer.CommonName, leaf.Issuer.Organization),
+		SANs:     append(append([]string(nil), leaf.DNSNames...), ipStrings(leaf.IPAddresses)...),
+		NotAfter: leaf.NotAfter,
+		Chain:    len(chain),
+	}
+
+	switch {
+	case now.After(leaf.NotAfter):
+		info.Warnings = append(info.Warnings, CertExpired)
+	case leaf.NotAfter.Sub(now) < CertExpiryWarning:
+		info.Warnings = append(info.Warnings, CertExpiring)
+	}
+	if sni != "" && leaf.VerifyHostname(sni) != nil {
+		info.Warnings = append(info.Warnings, CertMismatch)
+	}
+	selfSigned := leaf.CheckSignatureFrom(leaf) == nil
+	if selfSigned {
+		info.Warnings = append(info.Warnings, CertSelfSigned)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, CurrentTime: now})
+	var unknown x509.UnknownAuthorityError
+	if !selfSigned && errors.As(err, &unknown) {
+		info.Warnings = append(info.Warnings, CertUntrusted)
+	}
+	return info
+}
+
+// inspectConfigCert inspects the certificate of the server of a TLS config and
+// records it in r. REALITY servers present the certificate of the site they
+// borrow and QUIC ones aren't reached over TCP, so only vless, vmess and trojan
+// with TLS are inspected. The server is dialed directly, over family v if set.
+func (e *Examiner) inspectConfigCert(ctx context.Context, r *Result, proto protocol.Protocol, v int) {
+	g := proto.ConvertToGeneralConfig()
+	switch g.Protocol {
+	case "vless", "vmess", "trojan":
+	default:
+		return
+	}
+	if g.TLS != "tls" {
+		return
+	}
+	sni := g.SNI
+	if sni == "" {
+		sni = g.Host
+	}
+	if sni == "" && net.ParseIP(g.Address) == nil {
+		sni = g.Address
+	}
+	network := "tcp"
+	if v != 0 {
+		network = fmt.Sprintf("tcp%d", v)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.Timeout)*time.Millisecond)
+	defer cancel()
+	info, err := InspectCert(ctx, network, net.JoinHostPort(g.Address, g.Port), sni, splitALPN(g.ALPN))
+	if err != nil {
+		if e.Verbose {
+			e.Logger.Printf("Certificate inspection failed: %v\n", err)
+		}
+		return
+	}
+	r.CertIssuer = info.Issuer
+	r.CertSANs = strings.Join(info.SANs, ",")
+	r.CertExpires = info.NotAfter.UTC().Format(time.DateOnly)
+	r.CertWarnings = strings.Join(info.Warnings, ",")
+}
+
+func certName(cn string, org []string) string {
+	if cn != "" {
+		return cn
+	}
+	if len(org) > 0 {
+		return org[0]
+	}
+	return "unknown"
+}
+
+func ipStrings(ips []net.IP) []string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInspectCert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	info, err := InspectCert(context.Background(), "tcp", addr, "example.com", []string{"http/1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Issuer != "Acme Co" || !slices.Contains(info.SANs, "example.com") || !slices.Contains(info.SANs, "127.0.0.1") {
+		t.Errorf("issuer %q, SANs %v; want Acme Co for example.com and 127.0.0.1", info.Issuer, info.SANs)
+	}
+	if !slices.Equal(info.Warnings, []string{CertSelfSigned}) {
+		t.Errorf("warnings = %v, want only %s", info.Warnings, CertSelfSigned)
+	}
+
+	// The same certificate, checked near its expiry and for another name.
+	chain := []*x509.Certificate{srv.Certificate()}
+	notAfter := chain[0].NotAfter
+	later := describeCert(chain, "vpn.example.org", notAfter.Add(-24*time.Hour))
+	if want := []string{CertExpiring, CertMismatch, CertSelfSigned}; !slices.Equal(later.Warnings, want) {
+		t.Errorf("warnings = %v, want %v", later.Warnings, want)
+	}
+	expired := describeCert(chain, "example.com", notAfter.Add(time.Hour))
+	if !slices.Contains(expired.Warnings, CertExpired) {
+		t.Errorf("warnings = %v, want %s", expired.Warnings, CertExpired)
+	}
+}
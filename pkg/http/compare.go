@@ -0,0 +1,268 @@
+package http
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// CoreComparison holds the results of testing one config through each core.
+type CoreComparison struct {
+	Link     string
+	Protocol string
+	// Results maps a core name to its result, nil when the core wasn't run.
+	Results map[string]*Result
+}
+
+// coreLoaded reports whether a result comes from a core that could load the config.
+func coreLoaded(r *Result) bool {
+	return r != nil && !(r.Status == "broken" && r.Protocol == nil)
+}
+
+func resultPassed(r *Result) bool {
+	return r != nil && r.Status == "passed"
+}
+
+// CoreStats summarizes the results of one core for one protocol.
+type CoreStats struct {
+	Tested         int // configs the core could load
+	Passed         int
+	MedianDelay    int64   // ms, over the passed configs
+	MedianDownload float32 // mbps, over the passed configs with a speed test
+	Wins           int     // configs passing on every core that were fastest on this one
+}
+
+// ProtocolComparison compares the cores on the configs of one protocol.
+type ProtocolComparison struct {
+	Protocol string
+	Configs  int
+	Cores    map[string]*CoreStats
+	// Faster is the core that won most head-to-head delay comparisons, "" on a tie.
+	Faster string
+}
+
+// PairCoreResults lines up the results of testing links through each of cores,
+// keeping the order of links.
+func PairCoreResults(links []string, cores []string, results map[string]ConfigResults) []CoreComparison {
+	byLink := make(map[string]*CoreComparison, len(links))
+	pairs := make([]CoreComparison, len(links))
+	for i, link := range links {
+		pairs[i] = CoreComparison{Link: link, Protocol: linkScheme(link), Results: make(map[string]*Result, len(cores))}
+		byLink[link] = &pairs[i]
+	}
+	for _, name := range cores {
+		for _, r := range results[name] {
+			p := byLink[r.ConfigLink]
+			if p == nil {
+				continue
+			}
+			p.Results[name] = r
+			if r.ProtocolInfo.Protocol != "" {
+				p.Protocol = r.ProtocolInfo.Protocol
+			}
+		}
+	}
+	return pairs
+}
+
+// linkScheme is the protocol of a link that no core could parse.
+func linkScheme(link string) string {
+	if scheme, _, ok := strings.Cut(link, "://"); ok {
+		return strings.ToLower(scheme)
+	}
+	return "unknown"
+}
+
+// CompareByProtocol summarizes the pairs per protocol, most configs first.
+func CompareByProtocol(pairs []CoreComparison, cores []string) []ProtocolComparison {
+	index := make(map[string]int)
+	var out []ProtocolComparison
+	delays := make(map[string]map[string][]int64)
+	speeds := make(map[string]map[string][]float32)
+
+	for _, p := range pairs {
+		i, ok := index[p.Protocol]
+		if !ok {
+			i = len(out)
+			index[p.Protocol] = i
+			pc := ProtocolComparison{Protocol: p.Protocol, Cores: make(map[string]*CoreStats, len(cores))}
+			for _, name := range cores {
+				pc.Cores[name] = &CoreStats{}
+			}
+			out = append(out, pc)
+			delays[p.Protocol] = make(map[string][]int64)
+			speeds[p.Protocol] = make(map[string][]float32)
+		}
+		pc := &out[i]
+		pc.Configs++
+
+		everywhere := true
+		winner := ""
+		for _, name := range cores {
+			r := p.Results[name]
+			if !coreLoaded(r) {
+				everywhere = false
+				continue
+			}
+			stats := pc.Cores[name]
+			stats.Tested++
+			if !resultPassed(r) {
+				everywhere = false
+				continue
+			}
+			stats.Passed++
+			delays[p.Protocol][name] = append(delays[p.Protocol][name], r.Delay)
+			if r.DownloadSpeed > 0 {
+				speeds[p.Protocol][name] = append(speeds[p.Protocol][name], r.DownloadSpeed)
+			}
+			if winner == "" || r.Delay < p.Results[winner].Delay {
+				winner = name
+			}
+		}
+		if everywhere && len(cores) > 1 {
+			pc.Cores[winner].Wins++
+		}
+	}
+
+	for i := range out {
+		pc := &out[i]
+		best := -1
+		for _, name := range cores {
+			stats := pc.Cores[name]
+			if d := delays[pc.Protocol][name]; len(d) > 0 {
+				sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+				stats.MedianDelay = d[(len(d)-1)/2]
+			}
+			if s := speeds[pc.Protocol][name]; len(s) > 0 {
+				sort.Slice(s, func(a, b int) bool { return s[a] < s[b] })
+				stats.MedianDownload = s[(len(s)-1)/2]
+			}
+			switch {
+			case stats.Wins > best:
+				best, pc.Faster = stats.Wins, name
+			case stats.Wins == best:
+				pc.Faster = ""
+			}
+		}
+		if best == 0 {
+			pc.Faster = ""
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Configs > out[j].Configs })
+	return out
+}
+
+// WriteCoreComparison renders the per-protocol comparison of the cores to w,
+// followed by the configs that passed on some cores but not on others, which
+// point at core-specific bugs.
+func WriteCoreComparison(w io.Writer, pairs []CoreComparison, cores []string) {
+	fmt.Fprintln(w, customlog.GetColor(customlog.Label, "By protocol"))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	header := "  PROTOCOL\tCONFIGS"
+	for _, name := range cores {
+		n := strings.ToUpper(name)
+		header += "\t" + n + " PASSED\t" + n + " DELAY\t" + n + " SPEED\t" + n + " WINS"
+	}
+	fmt.Fprintln(tw, header+"\tFASTER")
+	for _, pc := range CompareByProtocol(pairs, cores) {
+		row := fmt.Sprintf("  %s\t%d", pc.Protocol, pc.Configs)
+		for _, name := range cores {
+			s := pc.Cores[name]
+			if s.Tested == 0 {
+				row += "\tunsupported\t-\t-\t-"
+				continue
+			}
+			row += fmt.Sprintf("\t%d/%d\t%s\t%s\t%d", s.Passed, s.Tested, formatMs(s.MedianDelay, s.Passed), formatMbps(s.MedianDownload), s.Wins)
+		}
+		faster := pc.Faster
+		if faster == "" {
+			faster = "-"
+		}
+		fmt.Fprintln(tw, row+"\t"+faster)
+	}
+	tw.Flush()
+
+	var mismatched []CoreComparison
+	for _, p := range pairs {
+		var ok, failed int
+		for _, name := range cores {
+			switch r := p.Results[name]; {
+			case resultPassed(r):
+				ok++
+			case coreLoaded(r):
+				failed++
+			}
+		}
+		if ok > 0 && failed > 0 {
+			mismatched = append(mismatched, p)
+		}
+	}
+	if len(mismatched) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s (%d)\n", customlog.GetColor(customlog.Label, "Passed on one core only"), len(mismatched))
+	for _, p := range mismatched {
+		var parts []string
+		for _, name := range cores {
+			r := p.Results[name]
+			switch {
+			case resultPassed(r):
+				parts = append(parts, fmt.Sprintf("%s passed in %dms", name, r.Delay))
+			case coreLoaded(r):
+				parts = append(parts, fmt.Sprintf("%s %s: %s", name, r.Status, r.Reason))
+			}
+		}
+		fmt.Fprintf(w, "  %s\n    %s\n", p.Link, strings.Join(parts, "; "))
+	}
+}
+
+// WriteCoreComparisonCSV writes one row per config with the status, delay and
+// download speed of each core.
+func WriteCoreComparisonCSV(w io.Writer, pairs []CoreComparison, cores []string) error {
+	cw := csv.NewWriter(w)
+	header := []string{"link", "protocol"}
+	for _, name := range cores {
+		header = append(header, name+"_status", name+"_delay", name+"_download", name+"_reason")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		row := []string{p.Link, p.Protocol}
+		for _, name := range cores {
+			r := p.Results[name]
+			switch {
+			case r == nil:
+				row = append(row, "", "", "", "")
+			case !coreLoaded(r):
+				row = append(row, "unsupported", "", "", r.Reason)
+			default:
+				row = append(row, r.Status, fmt.Sprint(r.Delay), fmt.Sprintf("%.2f", r.DownloadSpeed), r.Reason)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatMs(ms int64, n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", ms)
+}
+
+func formatMbps(mbps float32) string {
+	if mbps <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fmbps", mbps)
+}
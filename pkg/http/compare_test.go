@@ -0,0 +1,85 @@
+package http
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// loaded is a stand-in for a parsed config; only its presence matters here.
+type loaded struct{ protocol.Protocol }
+
+func coreResult(link, proto, status string, delay int64) *Result {
+	r := &Result{ConfigLink: link, Status: status, Delay: delay, ProtocolInfo: ProtocolInfo{Protocol: proto}}
+	if status == "broken" && proto == "" {
+		r.Reason = "create protocol: unsupported"
+		return r
+	}
+	r.Protocol = loaded{}
+	return r
+}
+
+func TestCompareCores(t *testing.T) {
+	cores := []string{"xray", "singbox"}
+	links := []string{"vless://a", "vless://b", "vless://c", "hy2://d"}
+	pairs := PairCoreResults(links, cores, map[string]ConfigResults{
+		"xray": {
+			coreResult("vless://a", "vless", "passed", 100),
+			coreResult("vless://b", "vless", "passed", 300),
+			coreResult("vless://c", "vless", "failed", -1),
+			coreResult("hy2://d", "", "broken", -1),
+		},
+		"singbox": {
+			coreResult("vless://b", "vless", "passed", 200),
+			coreResult("vless://a", "vless", "passed", 150),
+			coreResult("vless://c", "vless", "passed", 400),
+			coreResult("hy2://d", "hysteria2", "passed", 80),
+		},
+	})
+	if pairs[3].Protocol != "hysteria2" || pairs[0].Results["singbox"].Delay != 150 {
+		t.Fatalf("pairs not lined up: %+v", pairs)
+	}
+
+	byProto := CompareByProtocol(pairs, cores)
+	if len(byProto) != 2 || byProto[0].Protocol != "vless" {
+		t.Fatalf("protocols = %+v", byProto)
+	}
+	vless := byProto[0]
+	x, s := vless.Cores["xray"], vless.Cores["singbox"]
+	if x.Tested != 3 || x.Passed != 2 || s.Passed != 3 {
+		t.Errorf("pass counts: xray %+v, singbox %+v", x, s)
+	}
+	if x.Wins != 1 || s.Wins != 1 || vless.Faster != "" {
+		t.Errorf("wins: xray %d, singbox %d, faster %q", x.Wins, s.Wins, vless.Faster)
+	}
+	if x.MedianDelay != 100 || s.MedianDelay != 200 {
+		t.Errorf("median delays: xray %d, singbox %d", x.MedianDelay, s.MedianDelay)
+	}
+	hy2 := byProto[1]
+	if hy2.Cores["xray"].Tested != 0 || hy2.Cores["singbox"].Passed != 1 {
+		t.Errorf("hysteria2: %+v %+v", hy2.Cores["xray"], hy2.Cores["singbox"])
+	}
+
+	var out bytes.Buffer
+	WriteCoreComparison(&out, pairs, cores)
+	text := out.String()
+	if !strings.Contains(text, "unsupported") || !strings.Contains(text, "Passed on one core only") ||
+		!strings.Contains(text, "vless://c") || strings.Contains(text, "hy2://d\n") {
+		t.Errorf("unexpected comparison:\n%s", text)
+	}
+
+	out.Reset()
+	if err := WriteCoreComparisonCSV(&out, pairs, cores); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || rows[4][2] != "unsupported" || rows[3][6] != "passed" {
+		t.Errorf("csv rows = %q", rows)
+	}
+}
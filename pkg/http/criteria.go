@@ -0,0 +1,94 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Criteria are what a working config must also meet to pass: the status codes
+// its latency request may get, a regular expression its response body must
+// match and a delay to stay under. A config missing any of them isn't failed
+// but degraded: it works, just not as well as asked for.
+type Criteria struct {
+	Statuses []int
+	Body     *regexp.Regexp
+	MaxDelay int64 // ms, 0 = any
+}
+
+// Criteria a degraded config can miss, as Result.Unmet lists them.
+const (
+	CriterionStatus = "status"
+	CriterionBody   = "body"
+	CriterionDelay  = "delay"
+)
+
+// NewCriteria checks and compiles the success criteria of a test. Zero values
+// leave a criterion out.
+func NewCriteria(statuses []int, body string, maxDelay uint16) (Criteria, error) {
+	c := Criteria{Statuses: statuses, MaxDelay: int64(maxDelay)}
+	for _, code := range statuses {
+		if code < 100 || code > 599 {
+			return c, fmt.Errorf("accepted status must be an HTTP status code, got %d", code)
+		}
+	}
+	if body != "" {
+		re, err := regexp.Compile(body)
+		if err != nil {
+			return c, fmt.Errorf("invalid body pattern: %w", err)
+		}
+		c.Body = re
+	}
+	return c, nil
+}
+
+// keepsRedirects reports whether a redirect is among the accepted status codes,
+// in which case the latency request must not follow it.
+func (c Criteria) keepsRedirects() bool {
+	return slices.ContainsFunc(c.Statuses, func(code int) bool { return code >= 300 && code < 400 })
+}
+
+// apply marks r degraded when it passed but misses some of the criteria, with
+// its response body.
+func (c Criteria) apply(r *Result, body []byte) {
+	if r.Status != "passed" && r.Status != "semi-passed" {
+		return
+	}
+	var unmet, reasons []string
+	if len(c.Statuses) > 0 && !slices.Contains(c.Statuses, r.HTTPCode) {
+		codes := make([]string, len(c.Statuses))
+		for i, code := range c.Statuses {
+			codes[i] = strconv.Itoa(code)
+		}
+		unmet = append(unmet, CriterionStatus)
+		reasons = append(reasons, fmt.Sprintf("status code %d is not one of %s", r.HTTPCode, strings.Join(codes, ",")))
+	}
+	if c.Body != nil && !c.Body.Match(body) {
+		unmet = append(unmet, CriterionBody)
+		reasons = append(reasons, fmt.Sprintf("response body does not match %q", c.Body))
+	}
+	if c.MaxDelay > 0 && r.Delay > c.MaxDelay {
+		unmet = append(unmet, CriterionDelay)
+		reasons = append(reasons, fmt.Sprintf("delay %dms is over %dms", r.Delay, c.MaxDelay))
+	}
+	if len(unmet) == 0 {
+		return
+	}
+	r.Status = "degraded"
+	r.Unmet = strings.Join(unmet, ",")
+	if r.Reason != "" {
+		reasons = append([]string{r.Reason}, reasons...)
+	}
+	r.Reason = strings.Join(reasons, "; ")
+}
+
+// noRedirects returns a copy of client handing redirects back instead of
+// following them.
+func noRedirects(client *http.Client) *http.Client {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &c
+}
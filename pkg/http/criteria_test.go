@@ -0,0 +1,93 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExamineWithClient_Criteria(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte("status: ok"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		statuses   []int
+		body       string
+		maxDelay   uint16
+		wantStatus string
+		wantUnmet  string
+	}{
+		{"none", "/", nil, "", 0, "passed", ""},
+		{"all met", "/", []int{200, 204}, `^status: (ok|up)$`, 5000, "passed", ""},
+		{"redirect kept", "/moved", []int{301}, "", 0, "passed", ""},
+		{"redirect not accepted", "/moved", []int{204}, "", 0, "degraded", CriterionStatus},
+		{"status and body", "/", []int{204}, "^up$", 0, "degraded", "status,body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			criteria, err := NewCriteria(tt.statuses, tt.body, tt.maxDelay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := &Examiner{MaxDelay: 5000, TestEndpoint: srv.URL + tt.path, TestEndpointHttpMethod: http.MethodGet, Criteria: criteria}
+			r, err := e.examineWithClient(context.Background(), Result{ConfigLink: "vless://x", Status: "passed"}, srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Status != tt.wantStatus || r.Unmet != tt.wantUnmet {
+				t.Errorf("status = %s, unmet %q (%s); want %s, unmet %q", r.Status, r.Unmet, r.Reason, tt.wantStatus, tt.wantUnmet)
+			}
+		})
+	}
+}
+
+func TestCriteriaApply(t *testing.T) {
+	c := Criteria{MaxDelay: 300}
+	r := Result{Status: "semi-passed", Reason: "ip_info_failed", Delay: 450}
+	c.apply(&r, nil)
+	if r.Status != "degraded" || r.Unmet != CriterionDelay || r.Reason != "ip_info_failed; delay 450ms is over 300ms" {
+		t.Errorf("slow semi-pass: %+v", r)
+	}
+
+	// Failures stay failures.
+	r = Result{Status: "failed", Delay: FailedDelay}
+	Criteria{Statuses: []int{200}}.apply(&r, nil)
+	if r.Status != "failed" || r.Unmet != "" {
+		t.Errorf("failed result: %+v", r)
+	}
+
+	if _, err := NewCriteria([]int{2000}, "", 0); err == nil {
+		t.Error("NewCriteria accepted status 2000")
+	}
+	if _, err := NewCriteria(nil, "(", 0); err == nil {
+		t.Error("NewCriteria accepted an invalid pattern")
+	}
+}
+
+func TestWriteDegraded(t *testing.T) {
+	var out strings.Builder
+	WriteDegraded(&out, ConfigResults{{Status: "passed"}})
+	if out.Len() != 0 {
+		t.Errorf("wrote %q without degraded results", out.String())
+	}
+
+	WriteDegraded(&out, ConfigResults{
+		{Status: "degraded", Unmet: "delay"},
+		{Status: "degraded", Unmet: "status,delay"},
+		{Status: "failed"},
+	})
+	text := out.String()
+	if !strings.Contains(text, "(2 configs)") || !strings.Contains(text, "status      1") || !strings.Contains(text, "delay       2") {
+		t.Errorf("unexpected output:\n%s", text)
+	}
+}
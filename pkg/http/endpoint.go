@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ParseEndpoint parses the address of a running SOCKS5 or HTTP proxy. It accepts
+// socks5://, socks5h://, socks://, http:// and https:// URLs with optional
+// credentials, and a bare host:port, which is taken as SOCKS5.
+func ParseEndpoint(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "socks5://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy endpoint: %w", err)
+	}
+	switch u.Scheme {
+	case "socks", "socks5h":
+		// net/http always lets a SOCKS5 proxy resolve host names.
+		u.Scheme = "socks5"
+	case "socks5", "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported proxy endpoint scheme %q (expected socks5, http or https)", u.Scheme)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return nil, fmt.Errorf("proxy endpoint %q needs a host and port", raw)
+	}
+	return u, nil
+}
+
+// EndpointClient returns an HTTP client that sends its requests through the proxy
+// endpoint, along with the parsed endpoint.
+func (e *Examiner) EndpointClient(raw string) (*http.Client, *url.URL, error) {
+	u, err := ParseEndpoint(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := &http.Transport{
+		Proxy:             http.ProxyURL(u),
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: e.InsecureTLS},
+	}
+	return &http.Client{
+		Transport: tr,
+		Timeout:   time.Duration(e.Timeout) * time.Millisecond,
+	}, u, nil
+}
+
+// ExamineEndpoint runs the latency, IP info, and speed tests through a running
+// SOCKS5/HTTP proxy instead of a config link.
+func (e *Examiner) ExamineEndpoint(ctx context.Context, raw string) (Result, error) {
+	r := Result{
+		ConfigLink: raw,
+		Status:     "passed",
+		Delay:      FailedDelay,
+		HTTPCode:   -1,
+		RealIPAddr: "null",
+		IpAddrLoc:  "null",
+	}
+
+	client, u, err := e.EndpointClient(raw)
+	if err != nil {
+		r.Status = "broken"
+		r.Reason = err.Error()
+		return r, err
+	}
+	r.ProtocolInfo = ProtocolInfo{
+		Remark:   u.Fragment,
+		Protocol: u.Scheme,
+		Address:  u.Hostname(),
+		Port:     u.Port(),
+	}
+	r.TLS = "none"
+	if u.Scheme == "https" {
+		r.TLS = "tls"
+	}
+	if e.Verbose {
+		e.Logger.Printf("Testing proxy endpoint %s\n\n", u.Redacted())
+	}
+
+	return e.examineWithClient(ctx, r, client)
+}
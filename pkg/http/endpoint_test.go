@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "127.0.0.1:1080", want: "socks5://127.0.0.1:1080"},
+		{raw: "socks5h://u:p@proxy.example.com:1080", want: "socks5://u:p@proxy.example.com:1080"},
+		{raw: "socks://127.0.0.1:1080", want: "socks5://127.0.0.1:1080"},
+		{raw: "http://127.0.0.1:8080", want: "http://127.0.0.1:8080"},
+		{raw: "https://proxy.example.com:443", want: "https://proxy.example.com:443"},
+		{raw: "http://127.0.0.1", wantErr: true},
+		{raw: "vless://id@1.2.3.4:443", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			u, err := ParseEndpoint(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && u.String() != tt.want {
+				t.Errorf("ParseEndpoint() = %s, want %s", u, tt.want)
+			}
+		})
+	}
+}
+
+func TestExamineEndpoint_HTTPProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the destination.
+		proxied = r.URL.String()
+		fmt.Fprint(w, "ip=203.0.113.7\nloc=NL\n")
+	}))
+	defer proxy.Close()
+
+	e, err := NewExaminer(Options{Endpoints: true, DoIPInfo: true, TestEndpoint: "http://example.com/cdn-cgi/trace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.ExamineConfig(context.Background(), proxy.URL)
+	if err != nil {
+		t.Fatalf("ExamineConfig() error = %v", err)
+	}
+	if proxied != "http://example.com/cdn-cgi/trace" {
+		t.Errorf("request was not sent through the proxy, got %q", proxied)
+	}
+	if res.Status != "passed" || res.HTTPCode != 200 || res.RealIPAddr != "203.0.113.7" || res.IpAddrLoc != "NL" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if res.ProtocolInfo.Protocol != "http" || res.ProtocolInfo.Address != "127.0.0.1" {
+		t.Errorf("unexpected protocol info: %+v", res.ProtocolInfo)
+	}
+}
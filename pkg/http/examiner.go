@@ -8,16 +8,18 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"net/http/httptrace"
 	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/fatih/color"
-
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
 )
 
 // ProtocolInfo holds basic, serializable information about a protocol.
@@ -32,7 +34,7 @@ type Result struct {
 	ConfigLink    string            `csv:"link" json:"link"`         // vmess://... vless//..., etc
 	Protocol      protocol.Protocol `csv:"-" json:"-"`               // The full protocol object for internal use
 	ProtocolInfo  ProtocolInfo      `csv:"-" json:"protocol"`        // Serializable info for the frontend
-	Status        string            `csv:"status" json:"status"`     // passed, semi-passed, failed, broken
+	Status        string            `csv:"status" json:"status"`     // passed, semi-passed, degraded, failed, broken
 	Reason        string            `csv:"reason" json:"reason"`     // reason of the error
 	TLS           string            `csv:"tls" json:"tls"`           // none, tls, reality
 	RealIPAddr    string            `csv:"ip" json:"ip"`             // Real ip address (req to cloudflare.com/cdn-cgi/trace)
@@ -43,6 +45,32 @@ type Result struct {
 	IpAddrLoc     string            `csv:"location" json:"location"`       // IP address location
 	TTFB          int64             `csv:"ttfb" json:"ttfb"`               // Time to first byte (ms)
 	ConnectTime   int64             `csv:"connect_time" json:"connectTime"` // Connection time (ms)
+	IPVersions    string            `csv:"ip_versions" json:"ipVersions,omitempty"` // IP versions the config passed over with --ip-version, e.g. "4,6"
+	WarmDelay     int64             `csv:"warm_delay" json:"warmDelay,omitempty"`   // Median delay (ms) over a reused connection with WarmProbes, 0 = not measured
+	FailedStage   string            `csv:"failed_stage" json:"failedStage,omitempty"` // Stage of the delay request that failed: connect, tls, first-byte, body
+	UDP           bool              `csv:"udp" json:"udp,omitempty"`           // UDP is relayed (UDPTest)
+	NATType       string            `csv:"nat_type" json:"natType,omitempty"` // NAT behind the relayed UDP, see the NAT* constants; "" = not tested
+	SMTP          string            `csv:"smtp" json:"smtp,omitempty"`         // Outgoing SMTP (port 25) with PolicyProbes: open, blocked
+	P2P           string            `csv:"p2p" json:"p2p,omitempty"`           // BitTorrent and trackers with PolicyProbes: open, blocked
+	UDPExitIP     string            `csv:"udp_exit_ip" json:"udpExitIp,omitempty"`         // Public IP STUN sees UDP coming from
+	DNSResolverIP string            `csv:"dns_resolver_ip" json:"dnsResolverIp,omitempty"` // Resolver that looked up names requested through the config (LeakCheck)
+	ExitMismatch  bool              `csv:"exit_mismatch" json:"exitMismatch,omitempty"`    // UDP leaves from another IP than HTTP (LeakCheck)
+	Leaks         string            `csv:"leaks" json:"leaks,omitempty"`                   // Comma-separated Leak* found by LeakCheck
+	Failure       string            `csv:"failure" json:"failure,omitempty"`               // Why the delay request failed: blocked, down
+	BlockSignal   string            `csv:"block_signal" json:"blockSignal,omitempty"`      // What showed a block: rst, block-page:<country>, cert:<issuer>
+	CertIssuer    string            `csv:"cert_issuer" json:"certIssuer,omitempty"`        // Issuer of the config server's certificate (CertCheck)
+	CertSANs      string            `csv:"cert_sans" json:"certSans,omitempty"`            // Comma-separated names the certificate is valid for
+	CertExpires   string            `csv:"cert_expires" json:"certExpires,omitempty"`      // Expiry date of the certificate, YYYY-MM-DD
+	CertWarnings  string            `csv:"cert_warnings" json:"certWarnings,omitempty"`    // Comma-separated Cert* problems of the certificate
+	Unmet         string            `csv:"unmet" json:"unmet,omitempty"`                   // Comma-separated Criterion* a degraded config missed
+	DNSTime       int64             `csv:"dns_time" json:"dnsTime,omitempty"`              // ms resolving the config server (Timings)
+	TCPTime       int64             `csv:"tcp_time" json:"tcpTime,omitempty"`              // ms of a direct TCP connect to the config server (Timings)
+	ProxyTime     int64             `csv:"proxy_time" json:"proxyTime,omitempty"`          // ms dialing through the outbound, see StageTimings
+	TLSTime       int64             `csv:"tls_time" json:"tlsTime,omitempty"`              // ms of the TLS handshake with the test URL inside the tunnel
+	FirstByteTime int64             `csv:"first_byte_time" json:"firstByteTime,omitempty"` // ms from the test request sent to the first response byte
+	BodyTime      int64             `csv:"body_time" json:"bodyTime,omitempty"`            // ms reading the test response
+	Mutation      string            `csv:"mutation" json:"mutation,omitempty"`             // Variant a failed config passed as with Mutate, e.g. fp=firefox, fragment
+	MutatedLink   string            `csv:"mutated_link" json:"mutatedLink,omitempty"`      // Link of that variant
 }
 
 type Examiner struct {
@@ -64,15 +92,121 @@ type Examiner struct {
 
 	DoSpeedtest bool
 	DoIPInfo    bool
+	// IPInfoProvider looks up the exit IP and country for DoIPInfo.
+	IPInfoProvider IPInfoProvider
 
 	TestEndpoint           string
 	TestEndpointHttpMethod string
 	SpeedtestKbAmount      uint64
 	Retries                uint8
 
+	// TestHeaders and TestBody are sent with the latency request, to test an API
+	// or a login endpoint rather than a generic URL.
+	TestHeaders http.Header
+	TestBody    string
+	// ExpectStatus fails configs whose latency request gets another status code
+	// (0 accepts any), and ExpectBody those whose response doesn't contain it.
+	ExpectStatus int
+	ExpectBody   string
+
+	// Criteria mark the configs that work but miss them as degraded.
+	Criteria Criteria
+
+	// WarmProbes is how many requests are repeated over the connection of the first
+	// one to measure WarmDelay; 0 only measures the cold, handshake-inclusive Delay.
+	WarmProbes uint8
+
+	// UDPTest also checks whether UDP is relayed and which NAT type it is behind
+	// (see testUDP).
+	UDPTest bool
+
+	// PolicyProbes also checks whether the exit blocks SMTP or BitTorrent (see
+	// probePolicies).
+	PolicyProbes bool
+
+	// LeakCheck compares the exit IPs seen over HTTP, STUN and DNS with the
+	// machine's own (see checkLeaks). It runs the UDP test too.
+	LeakCheck    bool
+	baselineOnce sync.Once
+	baseline     leakBaseline
+
+	// CertCheck also inspects the certificate the servers of TLS configs present
+	// (see inspectConfigCert).
+	CertCheck bool
+
+	// Stages limits the stages of the delay request separately from Timeout.
+	Stages StageTimeouts
+
+	// Timings also times resolving and connecting to the config servers directly
+	// (see timeServer), to tell a slow server from a slow tunnel.
+	Timings bool
+
+	// Mutate retests the configs that fail as safe variations of them and records
+	// the one that passed (see TryMutations). Fragmenting tells whether the cores
+	// fragment the ClientHello; fragmentCore is Core with it the other way round.
+	Mutate       bool
+	Fragmenting  bool
+	fragmentCore core.Core
+
+	// Per-link overrides of TestEndpoint and the expected HTTP status, keyed by config link.
+	TestTargets map[string]TestTarget
+	// Overrides for the configs whose remark matches a tag, used for links
+	// without a TestTargets entry. The first matching tag wins.
+	TagTargets []TagTarget
+
+	// Endpoints makes the links running SOCKS5/HTTP proxy addresses, which are
+	// tested directly instead of through a core (see ExamineEndpoint).
+	Endpoints bool
+
+	// Raw only measures the TCP connect and TLS handshake time to the config
+	// servers, without a core (see ExamineRaw).
+	Raw bool
+
+	// IPVersion is the only address family config servers are dialed over (4 or 6,
+	// 0 = default). In dual-stack mode it is 0 and ipv6Core tests IPv6 while Core
+	// tests IPv4.
+	IPVersion int
+	ipv6Core  core.Core
+
+	// Upstream is the proxy the examiner's own requests, those not made through a
+	// config (see controlClient), go through. Configs are always dialed directly.
+	Upstream *url.URL
+
 	Logger *log.Logger `json:"-"`
 }
 
+// TestTarget overrides the test destination for a single config.
+// A zero ExpectedStatus accepts any status code.
+type TestTarget struct {
+	URL            string
+	ExpectedStatus int
+}
+
+// TagTarget overrides the test destination for the configs whose remark
+// matches Tag, e.g. testing Iranian-facing configs against a domestic URL.
+type TagTarget struct {
+	Tag *regexp.Regexp
+	TestTarget
+}
+
+// testTarget returns the override of the test destination for link: its own,
+// else the one of the first tag its remark matches.
+func (e *Examiner) testTarget(link string) (TestTarget, bool) {
+	if t, ok := e.TestTargets[link]; ok {
+		return t, true
+	}
+	if len(e.TagTargets) == 0 {
+		return TestTarget{}, false
+	}
+	remark := utils.LinkRemark(link)
+	for _, t := range e.TagTargets {
+		if t.Tag.MatchString(remark) {
+			return t.TestTarget, true
+		}
+	}
+	return TestTarget{}, false
+}
+
 const FailedDelay int64 = -1
 
 type Options struct {
@@ -90,6 +224,31 @@ type Options struct {
 	TestEndpointHttpMethod string `json:"httpMethod"`
 	SpeedtestKbAmount      uint64 `json:"speedtestAmount"`
 	Retries                uint8  `json:"retries"`
+	TestHeaders            []string `json:"headers"`      // "Name: value" headers of the latency request
+	TestBody               string `json:"body"`           // Body of the latency request
+	ExpectStatus           int    `json:"expectStatus"`   // Status code the latency request must get (0 = any)
+	ExpectBody             string `json:"expectBody"`     // Text the latency response must contain
+	AcceptStatus           []int  `json:"acceptStatus,omitempty"` // Status codes of a pass; others degrade the config
+	AcceptBody             string `json:"acceptBody,omitempty"`   // Regular expression the body of a pass matches
+	AcceptDelay            uint16 `json:"acceptDelay,omitempty"`  // Delay (ms) of a pass; slower configs are degraded
+	UpstreamProxy          string `json:"upstreamProxy"` // Send the tester's own requests (not the configs') through this http/https/socks5 proxy
+	Endpoints              bool   `json:"endpoints"`     // Links are running SOCKS5/HTTP proxies, not config links
+	Raw                    bool   `json:"raw"`           // Only time the TCP connect and TLS handshake to config servers, without a core
+	IPInfoProviders        []string `json:"ipInfoProviders,omitempty"` // Exit IP lookups, tried in order (see ParseIPInfoProviders)
+	IPInfoToken            string `json:"-"`             // Token of the ipinfo provider
+	IPVersion              string `json:"ipVersion"`     // 4, 6 or both: force the address family config servers are dialed over
+	Dial                   protocol.DialOptions `json:"dial"` // Socket options injected into every outbound
+	DNSServer              string `json:"-"`             // host:port of the DNS server sing-box resolves config servers with, e.g. a shared cache
+	WarmProbes             uint8  `json:"warmProbes"`    // Requests repeated over a kept-alive connection to measure WarmDelay
+	UDPTest                bool   `json:"udpTest"`       // Check UDP relay and the NAT type with STUN
+	PolicyProbes           bool   `json:"policyProbes"`  // Check whether the exit blocks SMTP or BitTorrent
+	LeakCheck              bool   `json:"leakCheck"`     // Look for configs leaking the real IP or DNS lookups
+	CertCheck              bool   `json:"certCheck"`     // Inspect the certificates of TLS config servers
+	Timings                bool   `json:"timings"`       // Also time resolving and connecting to config servers directly
+	Mutate                 bool   `json:"mutate"`        // Retest failed configs as variations of them (see Mutations)
+	ConnectTimeout         uint16 `json:"connectTimeout"`   // ms allowed to dial through the outbound (0 = only Timeout applies)
+	TLSTimeout             uint16 `json:"tlsTimeout"`       // ms allowed for the TLS handshake with the test URL
+	FirstByteTimeout       uint16 `json:"firstByteTimeout"` // ms allowed between the connection being ready and the first response byte
 	Logger                 *log.Logger `json:"-"`
 }
 
@@ -105,6 +264,8 @@ func NewExaminer(opts Options) (*Examiner, error) {
 		TestEndpointHttpMethod: "GET",
 		MaxDelay:               5000,
 		SpeedtestKbAmount:      10000,
+		Endpoints:              opts.Endpoints,
+		Raw:                    opts.Raw,
 	}
 
 	// Override from opts if non-zero
@@ -129,6 +290,41 @@ func NewExaminer(opts Options) (*Examiner, error) {
 	}
 
 	e.Retries = opts.Retries
+	e.TestBody = opts.TestBody
+	e.ExpectStatus = opts.ExpectStatus
+	e.ExpectBody = opts.ExpectBody
+	if len(opts.TestHeaders) > 0 {
+		headers, err := ParseHeaders(opts.TestHeaders)
+		if err != nil {
+			return nil, err
+		}
+		e.TestHeaders = headers
+	}
+	if opts.UpstreamProxy != "" {
+		upstream, err := ParseUpstream(opts.UpstreamProxy)
+		if err != nil {
+			return nil, err
+		}
+		e.Upstream = upstream
+	}
+	if e.DoIPInfo {
+		provider, err := ParseIPInfoProviders(opts.IPInfoProviders, opts.IPInfoToken)
+		if err != nil {
+			return nil, err
+		}
+		e.IPInfoProvider = provider
+	}
+	e.WarmProbes = opts.WarmProbes
+	e.UDPTest = opts.UDPTest
+	e.PolicyProbes = opts.PolicyProbes
+	e.LeakCheck = opts.LeakCheck
+	e.CertCheck = opts.CertCheck
+	e.Timings = opts.Timings
+	e.Stages = StageTimeouts{
+		Connect:   time.Duration(opts.ConnectTimeout) * time.Millisecond,
+		TLS:       time.Duration(opts.TLSTimeout) * time.Millisecond,
+		FirstByte: time.Duration(opts.FirstByteTimeout) * time.Millisecond,
+	}
 
 	// Set logger: use provided logger or default to stdout
 	if opts.Logger != nil {
@@ -137,22 +333,102 @@ func NewExaminer(opts Options) (*Examiner, error) {
 		e.Logger = log.New(os.Stdout, "", 0)
 	}
 
+	var err error
+	if e.Criteria, err = NewCriteria(opts.AcceptStatus, opts.AcceptBody, opts.AcceptDelay); err != nil {
+		return nil, err
+	}
+	if e.Core, err = newExaminerCore(opts, e.InsecureTLS, e.Verbose); err != nil {
+		return nil, err
+	}
+
+	versions, err := core.ParseIPVersion(opts.IPVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 1 {
+		if e.Endpoints {
+			return nil, errors.New("--ip-version both cannot be used with endpoints")
+		}
+		// Dual-stack: every config is tested once over each family.
+		if e.ipv6Core, err = newExaminerCore(opts, e.InsecureTLS, e.Verbose); err != nil {
+			return nil, err
+		}
+		if err := setIPVersion(e.Core, opts.Core, 4); err != nil {
+			return nil, err
+		}
+		if err := setIPVersion(e.ipv6Core, opts.Core, 6); err != nil {
+			return nil, err
+		}
+	} else if versions[0] != 0 {
+		e.IPVersion = versions[0]
+		if err := setIPVersion(e.Core, opts.Core, e.IPVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Mutate {
+		if e.Endpoints || e.Raw || e.ipv6Core != nil {
+			return nil, errors.New("mutation cannot be used with endpoints, raw tests or --ip-version both")
+		}
+		toggled := opts
+		toggled.Dial.Fragment = !opts.Dial.Fragment
+		if e.fragmentCore, err = newExaminerCore(toggled, e.InsecureTLS, e.Verbose); err != nil {
+			return nil, err
+		}
+		if e.IPVersion != 0 {
+			if err := setIPVersion(e.fragmentCore, opts.Core, e.IPVersion); err != nil {
+				return nil, err
+			}
+		}
+		e.Mutate = true
+		e.Fragmenting = opts.Dial.Fragment
+	}
+
+	return e, nil
+}
+
+// newExaminerCore creates the core named by opts.Core with the dialer options of opts.
+func newExaminerCore(opts Options, insecureTLS, verbose bool) (core.Core, error) {
+	var c core.Core
 	switch opts.Core {
 	case "xray":
-		e.Core = core.CoreFactory(core.XrayCoreType, e.InsecureTLS, e.Verbose)
+		c = core.CoreFactory(core.XrayCoreType, insecureTLS, verbose)
 	case "singbox", "sing-box":
-		e.Core = core.CoreFactory(core.SingboxCoreType, e.InsecureTLS, e.Verbose)
+		c = core.CoreFactory(core.SingboxCoreType, insecureTLS, verbose)
 	case "auto":
 		fallthrough
 	default:
-		e.Core = core.NewAutomaticCore(e.Verbose, e.InsecureTLS)
+		c = core.NewAutomaticCore(verbose, insecureTLS)
 	}
 
-	if e.Core == nil {
+	if c == nil {
 		return nil, fmt.Errorf("failed to create core of type: %s", opts.Core)
 	}
 
-	return e, nil
+	if !opts.Dial.IsZero() {
+		if err := opts.Dial.Validate(); err != nil {
+			return nil, err
+		}
+		dc, ok := c.(core.DialOptionsCore)
+		if !ok {
+			return nil, fmt.Errorf("core %q does not support dialer options", opts.Core)
+		}
+		dc.SetDialOptions(opts.Dial)
+	}
+	// Cores without their own DNS client use the process resolver.
+	if dc, ok := c.(core.DNSServerCore); ok && opts.DNSServer != "" {
+		dc.SetDNSServer(opts.DNSServer)
+	}
+	return c, nil
+}
+
+func setIPVersion(c core.Core, name string, v int) error {
+	ic, ok := c.(core.IPVersionCore)
+	if !ok {
+		return fmt.Errorf("core %q does not support --ip-version", name)
+	}
+	ic.SetIPVersion(v)
+	return nil
 }
 
 // parseTraceBody is a helper function to parse the output of a /cdn-cgi/trace request.
@@ -176,6 +452,102 @@ func parseTraceBody(body []byte, r *Result) {
 }
 
 func (e *Examiner) ExamineConfig(ctx context.Context, link string) (Result, error) {
+	if e.Endpoints {
+		return e.ExamineEndpoint(ctx, link)
+	}
+	if e.Raw {
+		return e.ExamineRaw(ctx, link)
+	}
+	if e.ipv6Core != nil {
+		return e.examineDualStack(ctx, link)
+	}
+	return e.examineOver(ctx, link, e.Core, e.IPVersion)
+}
+
+// examineOver tests link through c, whose dials are restricted to IP version v.
+func (e *Examiner) examineOver(ctx context.Context, link string, c core.Core, v int) (Result, error) {
+	r, proto, err := e.prepareResult(link)
+	if err != nil {
+		return r, err
+	}
+	if err := checkIPVersion(&r, v); err != nil {
+		return r, err
+	}
+
+	if e.Timings {
+		e.timeServer(ctx, &r, proto, v)
+	}
+	client, instance, err := c.MakeHttpClient(ctx, proto, time.Duration(e.Timeout)*time.Millisecond)
+	if err != nil {
+		r.Status = "broken"
+		r.Reason = err.Error()
+		return r, err
+	}
+	defer instance.Close()
+
+	r, err = e.examineWithClient(ctx, r, client)
+	if v != 0 && r.Status == "passed" {
+		r.IPVersions = fmt.Sprint(v)
+	}
+	if (e.UDPTest || e.LeakCheck) && r.Status == "passed" {
+		e.testUDP(ctx, &r, c, instance)
+	}
+	if e.LeakCheck && r.Status == "passed" {
+		e.checkLeaks(ctx, &r, client)
+	}
+	if e.CertCheck {
+		e.inspectConfigCert(ctx, &r, proto, v)
+	}
+	return r, err
+}
+
+// examineDualStack tests link over IPv4 and then IPv6 and returns the better of the
+// two results. IPVersions lists the families that passed, and the reason a family
+// failed is kept, so servers whose AAAA (or A) record doesn't work stand out.
+func (e *Examiner) examineDualStack(ctx context.Context, link string) (Result, error) {
+	r4, err4 := e.examineOver(ctx, link, e.Core, 4)
+	if r4.Status == "broken" && r4.Protocol == nil {
+		return r4, err4 // the link itself doesn't parse
+	}
+	r6, err6 := e.examineOver(ctx, link, e.ipv6Core, 6)
+
+	best, err := r4, err4
+	if r6.Status == "passed" && (r4.Status != "passed" || r6.Delay < r4.Delay) {
+		best, err = r6, err6
+	}
+
+	var passed, reasons []string
+	for _, fr := range []struct {
+		v int
+		r Result
+	}{{4, r4}, {6, r6}} {
+		if fr.r.Status == "passed" {
+			passed = append(passed, fmt.Sprint(fr.v))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("IPv%d %s: %s", fr.v, fr.r.Status, fr.r.Reason))
+		}
+	}
+	best.IPVersions = strings.Join(passed, ",")
+	best.Reason = strings.Join(reasons, "; ")
+	if best.Status != "passed" && err == nil {
+		err = errors.New(best.Reason)
+	}
+	return best, err
+}
+
+// checkIPVersion fails r when its server is an IP literal of the other family than v,
+// which the core would dial regardless of the forced version.
+func checkIPVersion(r *Result, v int) error {
+	if core.AddressMatchesIPVersion(r.ProtocolInfo.Address, v) {
+		return nil
+	}
+	r.Status = "failed"
+	r.Reason = fmt.Sprintf("server address %s is not an IPv%d address", r.ProtocolInfo.Address, v)
+	return errors.New(r.Reason)
+}
+
+// prepareResult parses the link and fills in the static parts of its result.
+func (e *Examiner) prepareResult(link string) (Result, protocol.Protocol, error) {
 	r := Result{
 		ConfigLink: link,
 		Status:     "passed",
@@ -190,24 +562,24 @@ func (e *Examiner) ExamineConfig(ctx context.Context, link string) (Result, erro
 	if link == "" {
 		r.Status = "broken"
 		r.Reason = "config link is empty"
-		return r, errors.New(r.Reason)
+		return r, nil, errors.New(r.Reason)
 	}
 
 	proto, err := e.Core.CreateProtocol(link)
 	if err != nil {
 		r.Status = "broken"
 		r.Reason = fmt.Sprintf("create protocol: %v", err)
-		return r, errors.New(r.Reason)
+		return r, nil, errors.New(r.Reason)
 	}
 
 	if err = proto.Parse(); err != nil {
 		r.Status = "broken"
 		r.Reason = fmt.Sprintf("parse protocol: %v", err)
-		return r, errors.New(r.Reason)
+		return r, nil, errors.New(r.Reason)
 	}
 
 	if e.Verbose {
-		e.Logger.Printf("%v%s: %s\n\n", proto.DetailsStr(), color.RedString("Link"), proto.GetLink())
+		e.Logger.Printf("%v%s: %s\n\n", proto.DetailsStr(), customlog.GetColor(customlog.Label, "Link"), proto.GetLink())
 	}
 
 	r.Protocol = proto
@@ -219,19 +591,40 @@ func (e *Examiner) ExamineConfig(ctx context.Context, link string) (Result, erro
 		Port:     generalConfig.Port,
 	}
 	r.TLS = generalConfig.TLS
+	return r, proto, nil
+}
+
+// examineWithClient runs the latency, IP info, and speed tests through an HTTP
+// client that is already bound to the config's outbound.
+func (e *Examiner) examineWithClient(ctx context.Context, r Result, client *http.Client) (Result, error) {
+	if e.WarmProbes > 0 {
+		var closeIdle func()
+		client, closeIdle = keepAliveClient(client)
+		defer closeIdle()
+	}
+	link := strings.TrimSpace(r.ConfigLink)
+	testEndpoint := e.TestEndpoint
+	target, hasTarget := e.testTarget(link)
+	if hasTarget && target.URL != "" {
+		testEndpoint = target.URL
+	}
 
-	client, instance, err := e.Core.MakeHttpClient(ctx, proto, time.Duration(e.Timeout)*time.Millisecond)
+	req, err := e.newTestRequest(ctx, testEndpoint)
 	if err != nil {
-		r.Status = "broken"
+		r.Status = "failed"
 		r.Reason = err.Error()
 		return r, err
 	}
-	defer instance.Close()
-
-	delayResult, err := MeasureDelayDetailed(ctx, client, e.TestEndpoint, e.TestEndpointHttpMethod)
+	latencyClient := client
+	if e.Criteria.keepsRedirects() {
+		latencyClient = noRedirects(client)
+	}
+	delayResult, err := MeasureRequestStaged(latencyClient, req, e.Stages)
 	if err != nil {
 		r.Status = "failed"
 		r.Reason = err.Error()
+		r.FailedStage = FailedStage(err)
+		r.Failure, r.BlockSignal = classifyFailure(err)
 		return r, err
 	}
 	if e.ShowBody {
@@ -241,39 +634,59 @@ func (e *Examiner) ExamineConfig(ctx context.Context, link string) (Result, erro
 	r.HTTPCode = delayResult.Code
 	r.TTFB = delayResult.TTFB
 	r.ConnectTime = delayResult.ConnectTime
+	r.ProxyTime = delayResult.Timings.Connect.Milliseconds()
+	r.TLSTime = delayResult.Timings.TLS.Milliseconds()
+	r.FirstByteTime = delayResult.Timings.FirstByte.Milliseconds()
+	r.BodyTime = delayResult.Timings.Body.Milliseconds()
+	if e.Verbose {
+		e.Logger.Printf("%s: %s\n", customlog.GetColor(customlog.Label, "Timings"), r.Timings())
+	}
 	body := delayResult.Body
 
+	if page := matchBlockPage(body); page != "" {
+		r.Status = "failed"
+		r.Reason = fmt.Sprintf("the response is the block page of %s", page)
+		r.Failure = FailureBlocked
+		r.BlockSignal = "block-page:" + page
+		return r, errors.New(r.Reason)
+	}
+	if reason := e.checkResponse(r.HTTPCode, body, target.ExpectedStatus); reason != "" {
+		r.Status = "failed"
+		r.Reason = reason
+		return r, errors.New(r.Reason)
+	}
+
 	if r.Delay > int64(e.MaxDelay) {
 		r.Status = "timeout"
 		r.Reason = "config delay is more than the maximum allowed delay"
 		return r, errors.New(r.Reason)
 	}
 
+	if e.WarmProbes > 0 {
+		r.WarmDelay = e.measureWarmDelay(ctx, client, testEndpoint)
+	}
+
+	if e.PolicyProbes {
+		e.probePolicies(ctx, &r, client)
+	}
+
 	if e.DoIPInfo {
 		// If the latency test URL was already the trace endpoint, use its body.
-		if strings.Contains(e.TestEndpoint, "/cdn-cgi/trace") {
+		if strings.Contains(testEndpoint, "/cdn-cgi/trace") {
 			parseTraceBody(body, &r)
+		} else if info, err := e.IPInfoProvider.Lookup(ctx, client); err != nil {
+			if e.Verbose {
+				e.Logger.Printf("IP info lookup failed: %v\n", err)
+			}
+			if r.Reason != "" {
+				r.Reason += "; "
+			}
+			r.Reason += "ip_info_failed"
+			r.Status = "semi-passed"
 		} else {
-			// Otherwise, make a dedicated request for the IP info.
-			// Use a standard, reliable trace endpoint.
-			req, reqErr := http.NewRequestWithContext(ctx, "GET", "https://cloudflare.com/cdn-cgi/trace", nil)
-			if reqErr != nil {
-				if r.Reason != "" {
-					r.Reason += "; "
-				}
-				r.Reason += "ip_info_failed"
-				r.Status = "semi-passed"
-			} else {
-				_, ipBody, _, traceErr := CoreHTTPRequestCustom(ctx, client, 10*time.Second, req)
-				if traceErr != nil {
-					if r.Reason != "" {
-						r.Reason += "; "
-					}
-					r.Reason += "ip_info_failed"
-					r.Status = "semi-passed"
-				} else {
-					parseTraceBody(ipBody, &r)
-				}
+			r.RealIPAddr = info.IP
+			if info.Country != "" {
+				r.IpAddrLoc = info.Country
 			}
 		}
 	}
@@ -297,14 +710,57 @@ func (e *Examiner) ExamineConfig(ctx context.Context, link string) (Result, erro
 		}
 	}
 
+	e.Criteria.apply(&r, body)
 	return r, nil
 }
 
+// keepAliveClient returns a copy of client whose connections are kept alive
+// between requests, and a function closing them once the test is done. The core
+// clients disable keep-alives so every test starts from a fresh handshake.
+func keepAliveClient(client *http.Client) (*http.Client, func()) {
+	tr, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return client, func() {}
+	}
+	tr = tr.Clone()
+	tr.DisableKeepAlives = false
+	tr.MaxIdleConnsPerHost = 1
+	c := *client
+	c.Transport = tr
+	return &c, tr.CloseIdleConnections
+}
+
+// measureWarmDelay repeats the delay request WarmProbes times over the connection
+// kept alive since the cold request and returns the median delay of the requests
+// that did reuse it, or 0 when none did (the server closes every connection).
+func (e *Examiner) measureWarmDelay(ctx context.Context, client *http.Client, dest string) int64 {
+	var delays []int64
+	for i := uint8(0); i < e.WarmProbes; i++ {
+		req, err := e.newTestRequest(ctx, dest)
+		if err != nil {
+			break
+		}
+		res, err := MeasureRequestStaged(client, req, StageTimeouts{})
+		if err != nil {
+			break
+		}
+		if res.Reused {
+			delays = append(delays, res.Delay)
+		}
+	}
+	if len(delays) == 0 {
+		return 0
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	return delays[(len(delays)-1)/2]
+}
+
 // ExamineConfigWithRetries runs ExamineConfig up to 1+Retries times, keeping the best result.
+// A config that still fails is then retested as its Mutations with Mutate.
 func (e *Examiner) ExamineConfigWithRetries(ctx context.Context, link string) (Result, error) {
 	best, err := e.ExamineConfig(ctx, link)
 	if e.Retries == 0 || best.Status == "passed" {
-		return best, err
+		return e.TryMutations(ctx, best, err)
 	}
 
 	for i := uint8(0); i < e.Retries; i++ {
@@ -321,7 +777,7 @@ func (e *Examiner) ExamineConfigWithRetries(ctx context.Context, link string) (R
 			break
 		}
 	}
-	return best, err
+	return e.TryMutations(ctx, best, err)
 }
 
 // MeasureDelayResult holds the timing results from MeasureDelay.
@@ -331,6 +787,10 @@ type MeasureDelayResult struct {
 	Body        []byte
 	TTFB        int64
 	ConnectTime int64
+	Timings     StageTimings
+	// Reused is true when the request went over a kept-alive connection, so no
+	// handshake is included in Delay.
+	Reused bool
 }
 
 func MeasureDelay(ctx context.Context, client *http.Client, dest string, httpMethod string) (int64, int, []byte, error) {
@@ -342,47 +802,7 @@ func MeasureDelay(ctx context.Context, client *http.Client, dest string, httpMet
 }
 
 func MeasureDelayDetailed(ctx context.Context, client *http.Client, dest string, httpMethod string) (*MeasureDelayResult, error) {
-	req, err := http.NewRequestWithContext(ctx, httpMethod, dest, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var connectStart time.Time
-	var connectTime int64
-	var ttfb int64
-	start := time.Now()
-
-	trace := &httptrace.ClientTrace{
-		ConnectStart: func(_, _ string) {
-			connectStart = time.Now()
-		},
-		ConnectDone: func(_, _ string, err error) {
-			if err == nil && !connectStart.IsZero() {
-				connectTime = time.Since(connectStart).Milliseconds()
-			}
-		},
-		GotFirstResponseByte: func() {
-			ttfb = time.Since(start).Milliseconds()
-		},
-	}
-
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	b, _ := io.ReadAll(resp.Body)
-	delay := time.Since(start).Milliseconds()
-
-	return &MeasureDelayResult{
-		Delay:       delay,
-		Code:        resp.StatusCode,
-		Body:        b,
-		TTFB:        ttfb,
-		ConnectTime: connectTime,
-	}, nil
+	return MeasureDelayStaged(ctx, client, dest, httpMethod, StageTimeouts{})
 }
 
 // zeroReader is an io.Reader that endlessly produces zero bytes.
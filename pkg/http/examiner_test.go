@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTestTarget(t *testing.T) {
+	const ir, pinned, de = "vless://x@1.2.3.4:443#IR-1", "vless://x@1.2.3.5:443#IR-2", "vless://x@5.6.7.8:443#DE-1"
+	e := &Examiner{
+		TestTargets: map[string]TestTarget{pinned: {URL: "https://pinned.example", ExpectedStatus: 200}},
+		TagTargets: []TagTarget{
+			{Tag: regexp.MustCompile(`^IR`), TestTarget: TestTarget{URL: "https://domestic.example", ExpectedStatus: 204}},
+			{Tag: regexp.MustCompile(`-1$`), TestTarget: TestTarget{URL: "https://first.example"}},
+		},
+	}
+	tests := []struct {
+		link    string
+		want    string
+		matched bool
+	}{
+		{ir, "https://domestic.example", true},   // the first matching tag wins
+		{pinned, "https://pinned.example", true}, // the per-config target wins over the tag
+		{de, "https://first.example", true},
+		{"vless://x@9.9.9.9:443#US", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := e.testTarget(tt.link)
+		if ok != tt.matched || got.URL != tt.want {
+			t.Errorf("testTarget(%s) = %+v, %v, want %s, %v", tt.link, got, ok, tt.want, tt.matched)
+		}
+	}
+}
+
+func TestExamineWithClient_WarmDelay(t *testing.T) {
+	var conns int32
+	var closeConns atomic.Bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if closeConns.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		w.Write([]byte("ok"))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// Like the clients of the cores, which open a new connection per request.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	e := &Examiner{MaxDelay: 5000, TestEndpoint: srv.URL, TestEndpointHttpMethod: "GET", WarmProbes: 3}
+
+	r, err := e.examineWithClient(context.Background(), Result{ConfigLink: "vless://x", Status: "passed"}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.WarmDelay <= 0 || r.Delay <= 0 {
+		t.Errorf("delay %dms, warm delay %dms; want both measured", r.Delay, r.WarmDelay)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("4 requests used %d connections, want 1", n)
+	}
+
+	closeConns.Store(true)
+	r, err = e.examineWithClient(context.Background(), Result{ConfigLink: "vless://x", Status: "passed"}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.WarmDelay != 0 {
+		t.Errorf("warm delay = %dms without a reusable connection, want 0", r.WarmDelay)
+	}
+}
+
+func TestExamineWithClient_CustomRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Host != "api.example.com" || r.Header.Get("Authorization") != "Bearer t0ken" || string(body) != `{"user":"a"}` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	headers, err := ParseHeaders([]string{"authorization: Bearer t0ken", "Host: api.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		headers      http.Header
+		expectStatus int
+		expectBody   string
+		wantStatus   string
+	}{
+		{"matches", headers, 200, `"ok":true`, "passed"},
+		{"any status", nil, 0, "", "passed"},
+		{"wrong status", nil, 200, "", "failed"},
+		{"missing text", headers, 200, "welcome", "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Examiner{
+				MaxDelay:               5000,
+				TestEndpoint:           srv.URL,
+				TestEndpointHttpMethod: http.MethodPost,
+				TestHeaders:            tt.headers,
+				TestBody:               `{"user":"a"}`,
+				ExpectStatus:           tt.expectStatus,
+				ExpectBody:             tt.expectBody,
+			}
+			r, _ := e.examineWithClient(context.Background(), Result{ConfigLink: "vless://x", Status: "passed"}, srv.Client())
+			if r.Status != tt.wantStatus {
+				t.Errorf("status = %s (%s), want %s", r.Status, r.Reason, tt.wantStatus)
+			}
+		})
+	}
+
+	if _, err := ParseHeaders([]string{"no colon"}); err == nil {
+		t.Error("ParseHeaders accepted a line without a colon")
+	}
+}
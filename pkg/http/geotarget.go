@@ -0,0 +1,221 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// continents are the continent codes a geo target may be keyed by.
+var continents = map[string]bool{"AF": true, "AN": true, "AS": true, "EU": true, "NA": true, "OC": true, "SA": true}
+
+var asnKey = regexp.MustCompile(`^AS[0-9]+$`)
+
+// GeoTargets maps the location of config servers to the test URL near them,
+// keyed by ASN (AS13335), ISO 3166 country code (DE) or continent code (EU, AS
+// for Asia, NA, SA, AF, OC, AN). The most specific key matching a server wins.
+type GeoTargets map[string]string
+
+// ParseGeoTargets parses KEY=URL specs, such as "AS=https://asia.example.com/".
+func ParseGeoTargets(specs []string) (GeoTargets, error) {
+	targets := make(GeoTargets, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		key, rawURL, ok := strings.Cut(spec, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		rawURL = strings.TrimSpace(rawURL)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("geo test URL %q is not KEY=URL", spec)
+		}
+		if len(key) != 2 && !asnKey.MatchString(key) {
+			return nil, fmt.Errorf("geo test URL key %q is not a country code, continent code or ASN", key)
+		}
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("geo test URL of %s must be an absolute http(s) URL, got %q", key, rawURL)
+		}
+		targets[key] = rawURL
+	}
+	return targets, nil
+}
+
+// ServerLocation is where a config server is.
+type ServerLocation struct {
+	Country   string // ISO 3166 code, e.g. DE
+	Continent string // e.g. EU
+	ASN       string // e.g. AS13335
+}
+
+// URLFor returns the test URL for a server at loc, or "" when no key matches.
+func (t GeoTargets) URLFor(loc ServerLocation) string {
+	for _, key := range []string{loc.ASN, loc.Country} {
+		if u, ok := t[strings.ToUpper(key)]; ok && key != "" {
+			return u
+		}
+	}
+	if continent := strings.ToUpper(loc.Continent); continents[continent] {
+		return t[continent]
+	}
+	return ""
+}
+
+// geoLookupURL is the ip-api batch endpoint servers are located with. It takes
+// up to geoLookupBatch addresses per request.
+var geoLookupURL = "http://ip-api.com/batch?fields=status,countryCode,continentCode,as,query"
+
+const geoLookupBatch = 100
+
+// LocateServers returns the location of each of hosts (names or IPs) that could
+// be resolved and located, keyed by host. Servers are located by their IP with
+// ip-api, asked with client; a server behind a CDN is located where the CDN
+// answers from.
+func LocateServers(ctx context.Context, client *http.Client, hosts []string) (map[string]ServerLocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Resolve the names first, a few at a time.
+	ipOf := make(map[string]string, len(hosts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 16)
+	for _, host := range hosts {
+		if _, done := ipOf[host]; done {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ipOf[host] = ip.String()
+			continue
+		}
+		ipOf[host] = ""
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+			if err == nil && len(ips) > 0 {
+				mu.Lock()
+				ipOf[host] = ips[0].String()
+				mu.Unlock()
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	var ips []string
+	seen := make(map[string]bool)
+	for _, ip := range ipOf {
+		if ip != "" && !seen[ip] {
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	byIP := make(map[string]ServerLocation, len(ips))
+	for start := 0; start < len(ips); start += geoLookupBatch {
+		end := min(start+geoLookupBatch, len(ips))
+		if err := lookupLocations(ctx, client, ips[start:end], byIP); err != nil {
+			return nil, err
+		}
+	}
+
+	locations := make(map[string]ServerLocation, len(ipOf))
+	for host, ip := range ipOf {
+		if loc, ok := byIP[ip]; ok {
+			locations[host] = loc
+		}
+	}
+	return locations, nil
+}
+
+// lookupLocations locates ips with one batch request and adds them to byIP.
+func lookupLocations(ctx context.Context, client *http.Client, ips []string, byIP map[string]ServerLocation) error {
+	payload, err := json.Marshal(ips)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, geoLookupURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("locate config servers: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("locate config servers: HTTP %d", resp.StatusCode)
+	}
+	var answers []struct {
+		Status        string `json:"status"`
+		CountryCode   string `json:"countryCode"`
+		ContinentCode string `json:"continentCode"`
+		AS            string `json:"as"` // "AS13335 Cloudflare, Inc."
+		Query         string `json:"query"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answers); err != nil {
+		return fmt.Errorf("locate config servers: %w", err)
+	}
+	for _, a := range answers {
+		if a.Status != "success" {
+			continue
+		}
+		asn, _, _ := strings.Cut(a.AS, " ")
+		byIP[a.Query] = ServerLocation{Country: a.CountryCode, Continent: a.ContinentCode, ASN: asn}
+	}
+	return nil
+}
+
+// ApplyGeoTargets locates the servers of links and points the test of each at
+// the URL targets has for its location, unless it already has a per-config or
+// per-tag test URL. It returns how many configs got each URL.
+func (e *Examiner) ApplyGeoTargets(ctx context.Context, links []string, targets GeoTargets) (map[string]int, error) {
+	hostOf := make(map[string]string, len(links))
+	var hosts []string
+	for _, link := range links {
+		link = strings.TrimSpace(link)
+		if t, ok := e.testTarget(link); ok && t.URL != "" {
+			continue
+		}
+		proto, err := e.Core.CreateProtocol(link)
+		if err != nil || proto.Parse() != nil {
+			continue
+		}
+		host := proto.ConvertToGeneralConfig().Address
+		hostOf[link] = host
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	locations, err := LocateServers(ctx, e.controlClient(), hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for link, host := range hostOf {
+		u := targets.URLFor(locations[host])
+		if u == "" {
+			continue
+		}
+		if e.TestTargets == nil {
+			e.TestTargets = make(map[string]TestTarget)
+		}
+		t, _ := e.testTarget(link)
+		t.URL = u
+		e.TestTargets[link] = t
+		counts[u]++
+	}
+	return counts, nil
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseGeoTargets(t *testing.T) {
+	targets, err := ParseGeoTargets([]string{"as=https://asia.example.com/", " DE = https://de.example.com/", "AS13335=http://cf.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		loc  ServerLocation
+		want string
+	}{
+		{ServerLocation{Country: "JP", Continent: "AS", ASN: "AS2516"}, "https://asia.example.com/"},
+		{ServerLocation{Country: "DE", Continent: "EU", ASN: "AS3320"}, "https://de.example.com/"},
+		{ServerLocation{Country: "DE", Continent: "EU", ASN: "AS13335"}, "http://cf.example.com/"},
+		{ServerLocation{Country: "FR", Continent: "EU"}, ""},
+		{ServerLocation{}, ""},
+	}
+	for _, tt := range tests {
+		if got := targets.URLFor(tt.loc); got != tt.want {
+			t.Errorf("URLFor(%+v) = %q, want %q", tt.loc, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"https://example.com/", "EUROPE=https://example.com/", "EU=ftp://example.com/", "EU="} {
+		if _, err := ParseGeoTargets([]string{spec}); err == nil {
+			t.Errorf("ParseGeoTargets(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestApplyGeoTargets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ips []string
+		if err := json.NewDecoder(r.Body).Decode(&ips); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var answers []map[string]string
+		for _, ip := range ips {
+			switch ip {
+			case "203.0.113.1":
+				answers = append(answers, map[string]string{"status": "success", "countryCode": "JP", "continentCode": "AS", "as": "AS2516 KDDI", "query": ip})
+			case "198.51.100.1":
+				answers = append(answers, map[string]string{"status": "success", "countryCode": "US", "continentCode": "NA", "as": "AS7018 AT&T", "query": ip})
+			default:
+				answers = append(answers, map[string]string{"status": "fail", "query": ip})
+			}
+		}
+		json.NewEncoder(w).Encode(answers)
+	}))
+	defer srv.Close()
+	defer func(old string) { geoLookupURL = old }(geoLookupURL)
+	geoLookupURL = srv.URL
+
+	e, err := NewExaminer(Options{Core: "auto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := func(ip, remark string) string {
+		return fmt.Sprintf("vless://%s@%s:443?security=none&type=tcp#%s", rawUUID, ip, remark)
+	}
+	asia, us, unknown, pinned := link("203.0.113.1", "asia"), link("198.51.100.1", "us"), link("192.0.2.1", "unknown"), link("203.0.113.1", "pinned")
+	e.TestTargets = map[string]TestTarget{pinned: {URL: "https://pinned.example.com/", ExpectedStatus: 204}}
+
+	targets, _ := ParseGeoTargets([]string{"AS=https://asia.example.com/"})
+	counts, err := e.ApplyGeoTargets(context.Background(), []string{asia, us, unknown, pinned}, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["https://asia.example.com/"] != 1 || len(counts) != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+	if got := e.TestTargets[asia].URL; got != "https://asia.example.com/" {
+		t.Errorf("asian server tested against %q", got)
+	}
+	if _, ok := e.TestTargets[us]; ok {
+		t.Error("server matching no key got a test target")
+	}
+	if got := e.TestTargets[pinned]; got.URL != "https://pinned.example.com/" || got.ExpectedStatus != 204 {
+		t.Errorf("per-config test target overridden: %+v", got)
+	}
+}
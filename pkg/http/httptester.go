@@ -15,6 +15,7 @@ import (
 	"github.com/alitto/pond/v2"
 	"github.com/gocarina/gocsv"
 	"github.com/lilendian0x00/xray-knife/v9/database"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
 	"github.com/lilendian0x00/xray-knife/v9/utils"
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
 )
@@ -80,6 +81,7 @@ type TestManager struct {
 	logger      *log.Logger // Optional logger for web UI
 	threadCount uint16
 	verbose     bool
+	poolSize    int // Configs per shared core instance (0/1 = one instance per config)
 }
 
 func NewTestManager(examiner *Examiner, threadCount uint16, verbose bool, logger *log.Logger) *TestManager {
@@ -91,9 +93,23 @@ func NewTestManager(examiner *Examiner, threadCount uint16, verbose bool, logger
 	}
 }
 
+// SetPoolSize enables core instance pooling with n configs per instance.
+func (tm *TestManager) SetPoolSize(n int) {
+	tm.poolSize = n
+}
+
 // RunTests tests multiple configurations concurrently using a worker pool.
 // It accepts an optional onProgress callback which is fired after each test.
+// When a pool size is set and the core supports it, configs are loaded in
+// chunks into shared core instances instead of one instance per config.
 func (tm *TestManager) RunTests(ctx context.Context, links []string, resultsChan chan<- *Result, onProgress func()) {
+	// Dual-stack runs need two instances per config, one per family, and the UDP
+	// test and leak check need the config's own instance, so they aren't pooled.
+	if _, ok := tm.examiner.Core.(core.PooledCore); ok && tm.poolSize > 1 && !tm.examiner.Endpoints && !tm.examiner.Raw && tm.examiner.ipv6Core == nil && !tm.examiner.UDPTest && !tm.examiner.LeakCheck {
+		tm.runPooledTests(ctx, links, resultsChan, onProgress)
+		return
+	}
+
 	pool := pond.NewPool(int(tm.threadCount))
 	defer pool.Stop()
 	group := pool.NewGroupContext(ctx)
@@ -102,27 +118,7 @@ func (tm *TestManager) RunTests(ctx context.Context, links []string, resultsChan
 		linkToTest := link
 		group.Submit(func() {
 			res, err := tm.examiner.ExamineConfigWithRetries(group.Context(), linkToTest)
-			if err != nil && !strings.Contains(err.Error(), "context canceled") {
-				logMsg := fmt.Sprintf("[-] Error: %s - broken config: %s\n", err.Error(), linkToTest)
-				if tm.logger != nil {
-					tm.logger.Print(logMsg)
-				} else if tm.verbose {
-					customlog.Printf(customlog.Failure, "Error: %s - broken config: %s\n", err.Error(), linkToTest)
-				}
-			}
-
-			select {
-			case resultsChan <- &res:
-				if res.Status == "passed" && tm.logger != nil {
-					logMsg := fmt.Sprintf("[+] SUCCESS | %s | Delay: %dms\n", res.ConfigLink, res.Delay)
-					tm.logger.Print(logMsg)
-				}
-			case <-group.Context().Done():
-			}
-
-			if onProgress != nil {
-				onProgress()
-			}
+			tm.report(group.Context(), &res, err, resultsChan, onProgress)
 		})
 	}
 
@@ -154,7 +150,7 @@ func (rp *ResultProcessor) SaveResults(results ConfigResults) error {
 				UploadMbps:   0,
 			}
 
-			if res.Status == "passed" || res.Status == "semi-passed" {
+			if res.Status == "passed" || res.Status == "semi-passed" || res.Status == "degraded" {
 				dbRes.DelayMs = res.Delay
 				dbRes.DownloadMbps = float64(res.DownloadSpeed)
 				dbRes.UploadMbps = float64(res.UploadSpeed)
@@ -162,7 +158,21 @@ func (rp *ResultProcessor) SaveResults(results ConfigResults) error {
 				dbRes.IPLocation = sql.NullString{String: res.IpAddrLoc, Valid: res.IpAddrLoc != "" && res.IpAddrLoc != "null"}
 				dbRes.TTFBMs = res.TTFB
 				dbRes.ConnectTimeMs = res.ConnectTime
+				dbRes.WarmDelayMs = res.WarmDelay
+				dbRes.UDP = res.UDP
+				dbRes.NATType = res.NATType
+				dbRes.SMTP = res.SMTP
+				dbRes.P2P = res.P2P
+				dbRes.Leaks = res.Leaks
 			}
+			dbRes.CertIssuer = res.CertIssuer
+			dbRes.CertSANs = res.CertSANs
+			dbRes.CertExpires = res.CertExpires
+			dbRes.CertWarnings = res.CertWarnings
+			dbRes.Failure = res.Failure
+			dbRes.BlockSignal = res.BlockSignal
+			dbRes.Mutation = res.Mutation
+			dbRes.MutatedLink = res.MutatedLink
 			dbResults = append(dbResults, dbRes)
 		}
 
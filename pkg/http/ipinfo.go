@@ -0,0 +1,231 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPInfo is the exit IP of a config and the country it is in.
+type IPInfo struct {
+	IP      string
+	Country string // ISO 3166 code, e.g. DE
+}
+
+// IPInfoProvider looks up the IP requests made with a client come from.
+type IPInfoProvider interface {
+	Name() string
+	Lookup(ctx context.Context, client *http.Client) (IPInfo, error)
+}
+
+// Built-in IP info providers, by the names ParseIPInfoProviders takes.
+var ipInfoURLs = map[string]string{
+	"cloudflare": traceURL,
+	"ip-api":     "http://ip-api.com/json/?fields=status,message,countryCode,query",
+	"ipinfo":     "https://ipinfo.io/json",
+}
+
+// DefaultIPInfoProviders are tried in order when none are configured.
+var DefaultIPInfoProviders = []string{"cloudflare", "ipinfo", "ip-api"}
+
+// ErrRateLimited is returned by a provider that asked to be left alone for a while.
+var ErrRateLimited = errors.New("rate limited")
+
+// defaultRateLimitPause is how long a provider is skipped after a 429 that
+// doesn't say when to come back.
+const defaultRateLimitPause = time.Minute
+
+// ParseIPInfoProviders returns a provider trying each of specs in order until
+// one answers. A spec is the name of a built-in provider (cloudflare, ip-api,
+// ipinfo) or the http(s) URL of a self-hosted one, answering with a
+// /cdn-cgi/trace style body or a JSON object with the IP under "ip" or "query"
+// and the country under "country_code", "countryCode", "country_iso" or
+// "country". token is sent to ipinfo, whose free tier without one is small.
+func ParseIPInfoProviders(specs []string, token string) (IPInfoProvider, error) {
+	if len(specs) == 0 {
+		specs = DefaultIPInfoProviders
+	}
+	f := &ipInfoFailover{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		p, err := newURLProvider(spec, token)
+		if err != nil {
+			return nil, err
+		}
+		f.providers = append(f.providers, p)
+	}
+	if len(f.providers) == 0 {
+		return nil, errors.New("no IP info provider given")
+	}
+	if len(f.providers) == 1 {
+		return f.providers[0], nil
+	}
+	return f, nil
+}
+
+// ValidateIPInfoProvider checks a provider spec of ParseIPInfoProviders.
+func ValidateIPInfoProvider(spec string) error {
+	_, err := newURLProvider(spec, "")
+	return err
+}
+
+func newURLProvider(spec, token string) (*urlProvider, error) {
+	if u, ok := ipInfoURLs[spec]; ok {
+		if spec == "ipinfo" && token != "" {
+			u += "?token=" + url.QueryEscape(token)
+		}
+		return &urlProvider{name: spec, url: u}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid IP info provider %q: use cloudflare, ip-api, ipinfo or an http(s) URL", spec)
+	}
+	return &urlProvider{name: u.Host, url: spec}, nil
+}
+
+// urlProvider looks the IP up with a GET request to a URL. After a 429, or once
+// ip-api says no requests are left, it fails with ErrRateLimited without asking
+// until the time the service gave is up.
+type urlProvider struct {
+	name string
+	url  string
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+func (p *urlProvider) Name() string { return p.name }
+
+func (p *urlProvider) Lookup(ctx context.Context, client *http.Client) (IPInfo, error) {
+	p.mu.Lock()
+	paused := time.Now().Before(p.pausedUntil)
+	p.mu.Unlock()
+	if paused {
+		return IPInfo{}, fmt.Errorf("%s: %w", p.name, ErrRateLimited)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return IPInfo{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return IPInfo{}, fmt.Errorf("%s: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return IPInfo{}, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	if pause := rateLimitPause(resp); pause > 0 {
+		p.mu.Lock()
+		p.pausedUntil = time.Now().Add(pause)
+		p.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return IPInfo{}, fmt.Errorf("%s: %w", p.name, ErrRateLimited)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return IPInfo{}, fmt.Errorf("%s: status %d", p.name, resp.StatusCode)
+	}
+	info := parseIPInfo(body)
+	if info.IP == "" {
+		return IPInfo{}, fmt.Errorf("%s: no IP in the response", p.name)
+	}
+	return info, nil
+}
+
+// rateLimitPause returns how long to leave a service alone after resp: the
+// Retry-After of a 429, or, for ip-api, the X-Ttl seconds once X-Rl (the
+// requests left) is 0.
+func rateLimitPause(resp *http.Response) time.Duration {
+	seconds := func(v string) time.Duration {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return 0
+		}
+		return time.Duration(n) * time.Second
+	}
+	if resp.Header.Get("X-Rl") == "0" {
+		if d := seconds(resp.Header.Get("X-Ttl")); d > 0 {
+			return d
+		}
+		return defaultRateLimitPause
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if d := seconds(resp.Header.Get("Retry-After")); d > 0 {
+			return d
+		}
+		return defaultRateLimitPause
+	}
+	return 0
+}
+
+// parseIPInfo reads a /cdn-cgi/trace body or a JSON answer of an IP info service.
+func parseIPInfo(body []byte) IPInfo {
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		var r Result
+		parseTraceBody(body, &r)
+		return IPInfo{IP: r.RealIPAddr, Country: r.IpAddrLoc}
+	}
+	str := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := fields[k].(string); ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	// ip-api answers 200 with status "fail" for reserved ranges and the like.
+	if str("status") == "fail" {
+		return IPInfo{}
+	}
+	return IPInfo{
+		IP:      str("ip", "query"),
+		Country: str("country_code", "countryCode", "country_iso", "country"),
+	}
+}
+
+// ipInfoFailover asks its providers in order until one answers, so a provider
+// that throttles a bulk test, or is blocked where a config exits, is skipped.
+type ipInfoFailover struct {
+	providers []IPInfoProvider
+}
+
+func (f *ipInfoFailover) Name() string {
+	names := make([]string, len(f.providers))
+	for i, p := range f.providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *ipInfoFailover) Lookup(ctx context.Context, client *http.Client) (IPInfo, error) {
+	var errs []error
+	for _, p := range f.providers {
+		info, err := p.Lookup(ctx, client)
+		if err == nil {
+			return info, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return IPInfo{}, errors.Join(errs...)
+}
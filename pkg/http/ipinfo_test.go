@@ -0,0 +1,93 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseIPInfo(t *testing.T) {
+	tests := []struct {
+		body string
+		want IPInfo
+	}{
+		{"fl=1\nip=1.2.3.4\nloc=DE\n", IPInfo{"1.2.3.4", "DE"}},
+		{`{"status":"success","countryCode":"NL","query":"5.6.7.8"}`, IPInfo{"5.6.7.8", "NL"}},
+		{`{"ip":"9.9.9.9","country":"US","city":"Berkeley"}`, IPInfo{"9.9.9.9", "US"}},
+		{`{"ip":"2001:db8::1","country":"Germany","country_iso":"DE"}`, IPInfo{"2001:db8::1", "DE"}},
+		{`{"status":"fail","message":"reserved range","query":"10.0.0.1"}`, IPInfo{}},
+		{"<html>blocked</html>", IPInfo{}},
+	}
+	for _, tt := range tests {
+		if got := parseIPInfo([]byte(tt.body)); got != tt.want {
+			t.Errorf("parseIPInfo(%q) = %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestIPInfoFailoverSkipsRateLimited(t *testing.T) {
+	var limitedHits atomic.Int32
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limitedHits.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ip":"1.2.3.4","country":"FI"}`))
+	}))
+	defer backup.Close()
+
+	p, err := ParseIPInfoProviders([]string{limited.URL, backup.URL}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		info, err := p.Lookup(context.Background(), http.DefaultClient)
+		if err != nil || info != (IPInfo{"1.2.3.4", "FI"}) {
+			t.Fatalf("Lookup() = %+v, %v", info, err)
+		}
+	}
+	if n := limitedHits.Load(); n != 1 {
+		t.Errorf("rate-limited provider asked %d times, want 1", n)
+	}
+}
+
+func TestIPInfoProviderLastRequest(t *testing.T) {
+	// ip-api answers the last request of its window and says so in X-Rl.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rl", "0")
+		w.Header().Set("X-Ttl", "30")
+		w.Write([]byte(`{"status":"success","countryCode":"SE","query":"1.1.1.1"}`))
+	}))
+	defer srv.Close()
+
+	p, err := ParseIPInfoProviders([]string{srv.URL}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Lookup(context.Background(), http.DefaultClient); err != nil {
+		t.Fatalf("first Lookup() error = %v", err)
+	}
+	if _, err := p.Lookup(context.Background(), http.DefaultClient); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second Lookup() error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestParseIPInfoProvidersInvalid(t *testing.T) {
+	for _, spec := range []string{"ipapi", "ftp://example.com/ip"} {
+		if _, err := ParseIPInfoProviders([]string{spec}, ""); err == nil {
+			t.Errorf("ParseIPInfoProviders(%q) accepted an invalid provider", spec)
+		}
+	}
+	p, err := ParseIPInfoProviders([]string{"ipinfo"}, "secret token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.(*urlProvider).url; got != "https://ipinfo.io/json?token=secret+token" {
+		t.Errorf("ipinfo URL = %q", got)
+	}
+}
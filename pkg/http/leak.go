@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Leaks reported by the leak check in Result.Leaks.
+const (
+	LeakIP     = "ip"     // the HTTP exit IP is the machine's own
+	LeakWebRTC = "webrtc" // STUN sees the machine's own IP, as WebRTC in a browser would
+	LeakDNS    = "dns"    // lookups are made by the machine's own resolver, outside the tunnel
+)
+
+// DNSLeakURL is requested with a random label (%s). The lookup of the name reaches
+// ip-api's nameserver from whichever resolver made it, and the answer reports
+// that resolver's IP.
+var DNSLeakURL = "http://%s.edns.ip-api.com/json"
+
+// traceURL reports the IP a request came from.
+const traceURL = "https://cloudflare.com/cdn-cgi/trace"
+
+// leakBaseline is what the machine looks like without a proxy.
+type leakBaseline struct {
+	ip       string // public IP
+	resolver string // IP of the resolver the system's lookups come from
+}
+
+// directBaseline measures the machine's own public IP and resolver once per
+// Examiner. Fields it couldn't learn stay empty, and the checks using them are
+// skipped.
+func (e *Examiner) directBaseline(ctx context.Context) leakBaseline {
+	e.baselineOnce.Do(func() {
+		client := &http.Client{Timeout: time.Duration(e.Timeout) * time.Millisecond}
+		ctx := context.WithoutCancel(ctx)
+		if ip, err := exitIP(ctx, client); err == nil {
+			e.baseline.ip = ip
+		} else if e.Verbose {
+			e.Logger.Printf("Leak check: could not learn the direct IP: %v\n", err)
+		}
+		if resolver, err := resolverIP(ctx, client); err == nil {
+			e.baseline.resolver = resolver
+		} else if e.Verbose {
+			e.Logger.Printf("Leak check: could not learn the system resolver: %v\n", err)
+		}
+	})
+	return e.baseline
+}
+
+// checkLeaks compares the IPs seen through client over HTTP, STUN (Result.UDPExitIP,
+// from testUDP) and DNS with the machine's own, and records the leaks in r.
+func (e *Examiner) checkLeaks(ctx context.Context, r *Result, client *http.Client) {
+	if r.RealIPAddr == "" || r.RealIPAddr == "null" {
+		if ip, err := exitIP(ctx, client); err == nil {
+			r.RealIPAddr = ip
+		}
+	}
+	if resolver, err := resolverIP(ctx, client); err == nil {
+		r.DNSResolverIP = resolver
+	} else if e.Verbose {
+		e.Logger.Printf("Leak check: DNS probe failed: %v\n", err)
+	}
+
+	httpIP := r.RealIPAddr
+	if httpIP == "null" {
+		httpIP = ""
+	}
+	r.ExitMismatch = httpIP != "" && r.UDPExitIP != "" && httpIP != r.UDPExitIP
+	r.Leaks = strings.Join(findLeaks(e.directBaseline(ctx), httpIP, r.UDPExitIP, r.DNSResolverIP), ",")
+}
+
+// findLeaks lists the leaks shown by the IPs seen through a config.
+func findLeaks(direct leakBaseline, httpIP, udpIP, resolver string) []string {
+	var leaks []string
+	if direct.ip != "" && httpIP == direct.ip {
+		leaks = append(leaks, LeakIP)
+	}
+	if direct.ip != "" && udpIP == direct.ip {
+		leaks = append(leaks, LeakWebRTC)
+	}
+	if direct.resolver != "" && resolver == direct.resolver {
+		leaks = append(leaks, LeakDNS)
+	}
+	return leaks
+}
+
+// exitIP returns the IP the trace endpoint sees requests from client coming from.
+func exitIP(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, traceURL, nil)
+	if err != nil {
+		return "", err
+	}
+	_, body, _, err := CoreHTTPRequestCustom(ctx, client, 10*time.Second, req)
+	if err != nil {
+		return "", err
+	}
+	var r Result
+	parseTraceBody(body, &r)
+	if r.RealIPAddr == "" {
+		return "", fmt.Errorf("no IP in the trace response")
+	}
+	return r.RealIPAddr, nil
+}
+
+// resolverIP returns the IP of the resolver that looked up a fresh name for a
+// request made with client.
+func resolverIP(ctx context.Context, client *http.Client) (string, error) {
+	label := make([]byte, 16)
+	if _, err := rand.Read(label); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(DNSLeakURL, hex.EncodeToString(label)), nil)
+	if err != nil {
+		return "", err
+	}
+	_, body, _, err := CoreHTTPRequestCustom(ctx, client, 10*time.Second, req)
+	if err != nil {
+		return "", err
+	}
+	var answer struct {
+		DNS struct {
+			IP string `json:"ip"`
+		} `json:"dns"`
+	}
+	if err := json.Unmarshal(body, &answer); err != nil || answer.DNS.IP == "" {
+		return "", fmt.Errorf("unexpected answer from the DNS leak endpoint")
+	}
+	return answer.DNS.IP, nil
+}
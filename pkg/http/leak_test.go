@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFindLeaks(t *testing.T) {
+	direct := leakBaseline{ip: "198.51.100.7", resolver: "192.0.2.53"}
+	tests := []struct {
+		name                    string
+		httpIP, udpIP, resolver string
+		want                    []string
+	}{
+		{"clean", "203.0.113.1", "203.0.113.1", "203.0.113.53", nil},
+		{"webrtc", "203.0.113.1", "198.51.100.7", "203.0.113.53", []string{LeakWebRTC}},
+		{"dns", "203.0.113.1", "", "192.0.2.53", []string{LeakDNS}},
+		{"no proxy at all", "198.51.100.7", "198.51.100.7", "192.0.2.53", []string{LeakIP, LeakWebRTC, LeakDNS}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findLeaks(direct, tt.httpIP, tt.udpIP, tt.resolver); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findLeaks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := findLeaks(leakBaseline{}, "", "", ""); got != nil {
+		t.Errorf("findLeaks() without a baseline = %v", got)
+	}
+}
+
+func TestResolverIP(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"dns":{"geo":"Germany - Example","ip":"192.0.2.53"}}`))
+	}))
+	defer srv.Close()
+	defer func(old string) { DNSLeakURL = old }(DNSLeakURL)
+	DNSLeakURL = srv.URL + "/%s"
+
+	for i := 0; i < 2; i++ {
+		ip, err := resolverIP(context.Background(), srv.Client())
+		if err != nil || ip != "192.0.2.53" {
+			t.Fatalf("resolverIP() = %q, %v", ip, err)
+		}
+	}
+	// Every lookup needs a fresh name, or a cached answer hides the resolver.
+	if len(paths) != 2 || paths[0] == paths[1] {
+		t.Errorf("requested %v", paths)
+	}
+}
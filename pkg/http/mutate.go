@@ -0,0 +1,166 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// Mutation is a variant of a failed config that Mutate retests it as.
+type Mutation struct {
+	// Name says what was changed, e.g. "fp=firefox", "type=grpc" or "fragment",
+	// and is the fix recorded when the variant passes.
+	Name string
+	Link string
+	// ToggleFragment tests the variant with the ClientHello fragmented if the
+	// examiner doesn't fragment it, and whole if it does.
+	ToggleFragment bool
+}
+
+// mutationFingerprints are the TLS fingerprints a failed TLS or REALITY config
+// is retried with, in order.
+var mutationFingerprints = []string{"chrome", "firefox", "safari", "ios", "edge", "randomized"}
+
+// Mutations returns the safe variations of the config of proto worth retrying
+// it as, most likely fixes first: its ClientHello fragmented (or not, when
+// fragmenting is the default), the other of its ws and grpc transports when its
+// link has settings for both, and other TLS fingerprints. Only TLS and REALITY
+// configs have variants; the server and credentials are never changed.
+func Mutations(proto protocol.Protocol, fragmenting bool) []Mutation {
+	g := proto.ConvertToGeneralConfig()
+	if g.TLS != "tls" && g.TLS != "reality" {
+		return nil
+	}
+	link := proto.GetLink()
+
+	name := "fragment"
+	if fragmenting {
+		name = "no-fragment"
+	}
+	mutations := []Mutation{{Name: name, Link: link, ToggleFragment: true}}
+
+	// vless and trojan links carry a ws path and a grpc service name in their own
+	// parameters, so a server advertising both transports can be tried on either.
+	if u, err := url.Parse(link); err == nil && u.Scheme != protocol.VmessIdentifier {
+		q := u.Query()
+		switch {
+		case q.Get("type") == "ws" && q.Get("serviceName") != "":
+			mutations = appendParamMutation(mutations, link, "type", "grpc")
+		case q.Get("type") == "grpc" && q.Get("path") != "":
+			mutations = appendParamMutation(mutations, link, "type", "ws")
+		}
+	}
+
+	current := strings.ToLower(g.TlsFingerprint)
+	if current == "" {
+		current = "chrome"
+	}
+	for _, fp := range mutationFingerprints {
+		if fp != current {
+			mutations = appendParamMutation(mutations, link, "fp", fp)
+		}
+	}
+	return mutations
+}
+
+func appendParamMutation(mutations []Mutation, link, key, value string) []Mutation {
+	if mutated, ok := setLinkParam(link, key, value); ok {
+		mutations = append(mutations, Mutation{Name: key + "=" + value, Link: mutated})
+	}
+	return mutations
+}
+
+// setLinkParam sets the parameter key of link to value: a query parameter of a
+// URL-style link, or a field of the JSON of a base64 vmess link. ok is false
+// when the link can't be rewritten.
+func setLinkParam(link, key, value string) (mutated string, ok bool) {
+	if rest, isVmess := strings.CutPrefix(link, protocol.VmessIdentifier+"://"); isVmess && !strings.Contains(rest, "@") {
+		decoded, err := utils.Base64Decode(rest)
+		if err != nil {
+			return "", false
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(decoded, &fields); err != nil {
+			return "", false
+		}
+		fields[key] = value
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			return "", false
+		}
+		return protocol.VmessIdentifier + "://" + base64.StdEncoding.EncodeToString(encoded), true
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String(), true
+}
+
+// TryMutations retests r, a config that failed, as each of its Mutations until
+// one passes, and records that one in r as the fix. r keeps its status: the
+// config as given doesn't work.
+func (e *Examiner) TryMutations(ctx context.Context, r Result, err error) (Result, error) {
+	if !e.Mutate || r.Status != "failed" || r.Protocol == nil {
+		return r, err
+	}
+	for _, m := range Mutations(r.Protocol, e.Fragmenting) {
+		if ctx.Err() != nil {
+			break
+		}
+		if e.passesAs(ctx, r.ConfigLink, m) {
+			r.Mutation = m.Name
+			r.MutatedLink = m.Link
+			if e.Verbose {
+				e.Logger.Printf("%s passes with %s\n", r.ProtocolInfo.Remark, m.Name)
+			}
+			break
+		}
+	}
+	return r, err
+}
+
+// passesAs reports whether the config of link passes the delay test as m. The
+// variant is tested against the test target of link.
+func (e *Examiner) passesAs(ctx context.Context, link string, m Mutation) bool {
+	v, proto, err := e.prepareResult(m.Link)
+	if err != nil {
+		return false
+	}
+	v.ConfigLink = link
+	c := e.Core
+	if m.ToggleFragment {
+		c = e.fragmentCore
+	}
+	client, instance, err := c.MakeHttpClient(ctx, proto, time.Duration(e.Timeout)*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	defer instance.Close()
+	v, _ = e.examineWithClient(ctx, v, client)
+	return v.Status == "passed" || v.Status == "degraded"
+}
+
+// MutationFix tells how to apply the variant of r that passed with Mutate.
+func (r Result) MutationFix() string {
+	switch r.Mutation {
+	case "":
+		return ""
+	case "fragment":
+		return "test and use it with --fragment"
+	case "no-fragment":
+		return "test and use it without --fragment"
+	}
+	return fmt.Sprintf("set %s in the link", r.Mutation)
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+)
+
+func TestMutations(t *testing.T) {
+	c := core.NewAutomaticCore(false, false)
+	parse := func(link string) []Mutation {
+		t.Helper()
+		proto, err := c.CreateProtocol(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proto.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		return Mutations(proto, false)
+	}
+
+	link := fmt.Sprintf("vless://%s@example.com:443?security=tls&sni=example.com&fp=firefox&type=ws&path=%%2Fws&serviceName=grpc#both", rawUUID)
+	names := make([]string, 0)
+	for _, m := range parse(link) {
+		names = append(names, m.Name)
+		if m.Name == "type=grpc" && !strings.Contains(m.Link, "type=grpc") {
+			t.Errorf("grpc variant link = %s", m.Link)
+		}
+		if !m.ToggleFragment && m.Link == link {
+			t.Errorf("variant %s didn't change the link", m.Name)
+		}
+	}
+	want := "fragment,type=grpc,fp=chrome,fp=safari,fp=ios,fp=edge,fp=randomized"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("mutations = %s, want %s", got, want)
+	}
+
+	// A ws link without a grpc service name only gets the other variants.
+	for _, m := range parse(fmt.Sprintf("vless://%s@example.com:443?security=tls&type=ws&path=%%2F#ws", rawUUID)) {
+		if m.Name == "type=grpc" || m.Name == "fp=chrome" {
+			t.Errorf("unexpected variant %s", m.Name)
+		}
+	}
+	if m := parse(fmt.Sprintf("vless://%s@example.com:80?security=none&type=tcp#plain", rawUUID)); m != nil {
+		t.Errorf("config without TLS has mutations %v", m)
+	}
+}
+
+func TestSetLinkParam(t *testing.T) {
+	vmess := "vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"v":"2","add":"example.com","port":"443","id":"`+rawUUID+`","net":"ws","tls":"tls","fp":"chrome"}`))
+	mutated, ok := setLinkParam(vmess, "fp", "safari")
+	if !ok {
+		t.Fatal("vmess link not rewritten")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(mutated, "vmess://"))
+	if err != nil || !strings.Contains(string(decoded), `"fp":"safari"`) || !strings.Contains(string(decoded), `"add":"example.com"`) {
+		t.Errorf("vmess link = %s (%v)", decoded, err)
+	}
+	if _, ok := setLinkParam("vmess://not base64!", "fp", "safari"); ok {
+		t.Error("invalid vmess link rewritten")
+	}
+}
+
+func TestMutationFix(t *testing.T) {
+	for mutation, want := range map[string]string{
+		"":          "",
+		"fragment":  "test and use it with --fragment",
+		"fp=safari": "set fp=safari in the link",
+	} {
+		if got := (Result{Mutation: mutation}).MutationFix(); got != want {
+			t.Errorf("MutationFix(%q) = %q, want %q", mutation, got, want)
+		}
+	}
+}
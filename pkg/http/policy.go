@@ -0,0 +1,152 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Outcomes of the policy probes in Result.SMTP and Result.P2P; "" = not probed.
+const (
+	PolicyOpen    = "open"
+	PolicyBlocked = "blocked"
+)
+
+// SMTPProbeAddr is a mail server whose SMTP greeting shows that a config's exit
+// lets outgoing port 25 through.
+var SMTPProbeAddr = "gmail-smtp-in.l.google.com:25"
+
+// P2PProbeAddr is sent a BitTorrent handshake. Any web server works: it answers
+// the garbage request with 400 Bad Request, unless the exit sniffed the
+// handshake and dropped the connection.
+var P2PProbeAddr = "1.1.1.1:80"
+
+// TrackerProbeURL is a public tracker announce URL, which exits blocking trackers
+// by domain don't let through.
+var TrackerProbeURL = "http://tracker.opentrackr.org:1337/announce"
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// probePolicies records in r whether the exit behind client lets SMTP and
+// BitTorrent through. Clients that only reach an HTTP proxy, like the ones of
+// --endpoints, can't dial raw connections and are skipped.
+func (e *Examiner) probePolicies(ctx context.Context, r *Result, client *http.Client) {
+	tr, ok := client.Transport.(*http.Transport)
+	if !ok || tr.DialContext == nil {
+		return
+	}
+	timeout := time.Duration(e.Timeout) * time.Millisecond
+
+	r.SMTP = PolicyBlocked
+	if err := probeSMTP(ctx, tr.DialContext, SMTPProbeAddr, timeout); err == nil {
+		r.SMTP = PolicyOpen
+	} else if e.Verbose {
+		e.Logger.Printf("SMTP probe: %v\n", err)
+	}
+
+	r.P2P = PolicyBlocked
+	err := probeBitTorrent(ctx, tr.DialContext, P2PProbeAddr, timeout)
+	if err == nil {
+		err = probeTracker(ctx, client, TrackerProbeURL, timeout)
+	}
+	if err == nil {
+		r.P2P = PolicyOpen
+	} else if e.Verbose {
+		e.Logger.Printf("BitTorrent probe: %v\n", err)
+	}
+}
+
+// probeSMTP waits for the greeting of the mail server at addr.
+func probeSMTP(ctx context.Context, dial dialFunc, addr string, timeout time.Duration) error {
+	greeting, err := exchangeTCP(ctx, dial, addr, nil, timeout)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "220") {
+		return fmt.Errorf("unexpected SMTP greeting %q", strings.TrimSpace(greeting))
+	}
+	return nil
+}
+
+// probeBitTorrent sends a BitTorrent handshake to addr and expects any answer.
+func probeBitTorrent(ctx context.Context, dial dialFunc, addr string, timeout time.Duration) error {
+	handshake := make([]byte, 68)
+	handshake[0] = 19
+	copy(handshake[1:], "BitTorrent protocol")
+	// Reserved bytes stay zero; the info hash and peer ID are random.
+	if _, err := rand.Read(handshake[28:]); err != nil {
+		return err
+	}
+	copy(handshake[48:], "-XK0001-")
+	_, err := exchangeTCP(ctx, dial, addr, handshake, timeout)
+	return err
+}
+
+// probeTracker announces a random torrent to the tracker at announceURL. Trackers
+// answer unknown torrents with a bencoded failure, which is enough.
+func probeTracker(ctx context.Context, client *http.Client, announceURL string, timeout time.Duration) error {
+	var infoHash, peerID [20]byte
+	if _, err := rand.Read(infoHash[:]); err != nil {
+		return err
+	}
+	rand.Read(peerID[:])
+	query := fmt.Sprintf("info_hash=%s&peer_id=%s&port=6881&uploaded=0&downloaded=0&left=0&compact=1",
+		percentEncode(infoHash[:]), percentEncode(peerID[:]))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, announceURL+"?"+query, nil)
+	if err != nil {
+		return err
+	}
+	code, _, _, err := CoreHTTPRequestCustom(ctx, client, timeout, req)
+	if err != nil {
+		return fmt.Errorf("tracker: %w", err)
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("tracker answered %d", code)
+	}
+	return nil
+}
+
+// exchangeTCP dials addr, writes req if set and returns the start of the answer.
+func exchangeTCP(ctx context.Context, dial dialFunc, addr string, req []byte, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	// Not every core's connections honour deadlines; closing unblocks them all.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	if req != nil {
+		if _, err := conn.Write(req); err != nil {
+			return "", err
+		}
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if n > 0 {
+		return string(buf[:n]), nil
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("no answer from %s", addr)
+	}
+	if err == io.EOF {
+		return "", fmt.Errorf("%s closed the connection", addr)
+	}
+	return "", err
+}
+
+func percentEncode(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		fmt.Fprintf(&s, "%%%02X", c)
+	}
+	return s.String()
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// policyServer accepts connections on a local port and hands them to handle.
+func policyServer(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPolicyProbes(t *testing.T) {
+	var d net.Dialer
+	ctx := context.Background()
+	timeout := 500 * time.Millisecond
+
+	mail := policyServer(t, func(c net.Conn) { c.Write([]byte("220 mx.example.com ESMTP\r\n")) })
+	if err := probeSMTP(ctx, d.DialContext, mail, timeout); err != nil {
+		t.Errorf("probeSMTP() on a mail server = %v", err)
+	}
+	silent := policyServer(t, func(c net.Conn) { io.Copy(io.Discard, c) })
+	if err := probeSMTP(ctx, d.DialContext, silent, timeout); err == nil {
+		t.Error("probeSMTP() passed without a greeting")
+	}
+
+	web := policyServer(t, func(c net.Conn) {
+		c.Read(make([]byte, 68))
+		c.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	})
+	if err := probeBitTorrent(ctx, d.DialContext, web, timeout); err != nil {
+		t.Errorf("probeBitTorrent() through an open exit = %v", err)
+	}
+	// An exit sniffing BitTorrent drops the connection after the handshake.
+	sniffing := policyServer(t, func(c net.Conn) {
+		buf := make([]byte, 68)
+		if _, err := io.ReadFull(c, buf); err == nil && bytes.HasPrefix(buf, []byte("\x13BitTorrent protocol")) {
+			return
+		}
+		c.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	})
+	if err := probeBitTorrent(ctx, d.DialContext, sniffing, timeout); err == nil {
+		t.Error("probeBitTorrent() passed an exit dropping BitTorrent")
+	}
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alitto/pond/v2"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// examineWithClientRetries is ExamineConfigWithRetries for an already-built client.
+func (e *Examiner) examineWithClientRetries(ctx context.Context, r Result, client *http.Client) (Result, error) {
+	best, err := e.examineWithClient(ctx, r, client)
+	for i := uint8(0); i < e.Retries && best.Status != "passed"; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		res, retryErr := e.examineWithClient(ctx, r, client)
+		if res.Status == "passed" && (best.Status != "passed" || (res.Delay >= 0 && res.Delay < best.Delay)) {
+			best = res
+			err = retryErr
+		}
+	}
+	if e.CertCheck && best.Protocol != nil {
+		e.inspectConfigCert(ctx, &best, best.Protocol, e.IPVersion)
+	}
+	return e.TryMutations(ctx, best, err)
+}
+
+// runPooledTests tests links in chunks of poolSize, loading each chunk into a single
+// core instance instead of starting one instance per config. Chunks whose pooled
+// instance fails to start fall back to per-config instances.
+//
+// Chunks run side by side on one worker pool of threadCount, with as many
+// instances live as keep the workers busy: threadCount/poolSize, at least one.
+// A chunk waiting on its slowest config then doesn't hold up the next one.
+func (tm *TestManager) runPooledTests(ctx context.Context, links []string, resultsChan chan<- *Result, onProgress func()) {
+	pool := pond.NewPool(int(tm.threadCount))
+	defer pool.Stop()
+
+	live := make(chan struct{}, max(1, int(tm.threadCount)/tm.poolSize))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for start := 0; start < len(links); start += tm.poolSize {
+		select {
+		case live <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		chunk := links[start:min(start+tm.poolSize, len(links))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-live }()
+			tm.runPooledChunk(ctx, pool, chunk, resultsChan, onProgress)
+		}()
+	}
+}
+
+// runPooledChunk tests chunk through one pooled instance, submitting the tests to pool.
+func (tm *TestManager) runPooledChunk(ctx context.Context, pool pond.Pool, chunk []string, resultsChan chan<- *Result, onProgress func()) {
+	pooledCore := tm.examiner.Core.(core.PooledCore)
+
+	// Parse every link first; broken ones are reported right away.
+	var prepared []Result
+	var protos []protocol.Protocol
+	for _, link := range chunk {
+		r, proto, err := tm.examiner.prepareResult(link)
+		if err == nil {
+			err = checkIPVersion(&r, tm.examiner.IPVersion)
+		}
+		if err != nil {
+			tm.report(ctx, &r, err, resultsChan, onProgress)
+			continue
+		}
+		prepared = append(prepared, r)
+		protos = append(protos, proto)
+	}
+	if len(protos) == 0 {
+		return
+	}
+
+	timeout := time.Duration(tm.examiner.Timeout) * time.Millisecond
+	clients, instance, err := pooledCore.MakeHttpClientPool(ctx, protos, timeout)
+	if err != nil {
+		if tm.logger != nil {
+			tm.logger.Printf("[!] Pooled instance failed (%v), testing %d configs individually\n", err, len(protos))
+		} else if tm.verbose {
+			customlog.Printf(customlog.Warning, "Pooled instance failed (%v), testing %d configs individually\n", err, len(protos))
+		}
+		group := pool.NewGroupContext(ctx)
+		for _, r := range prepared {
+			link := r.ConfigLink
+			group.Submit(func() {
+				res, err := tm.examiner.ExamineConfigWithRetries(group.Context(), link)
+				tm.report(group.Context(), &res, err, resultsChan, onProgress)
+			})
+		}
+		group.Wait()
+		return
+	}
+	defer instance.Close()
+
+	group := pool.NewGroupContext(ctx)
+	for i := range prepared {
+		r := prepared[i]
+		pc := clients[i]
+		group.Submit(func() {
+			if pc.Err != nil {
+				r.Status = "broken"
+				r.Reason = pc.Err.Error()
+				tm.report(group.Context(), &r, pc.Err, resultsChan, onProgress)
+				return
+			}
+			res, err := tm.examiner.examineWithClientRetries(group.Context(), r, pc.Client)
+			if tm.examiner.IPVersion != 0 && res.Status == "passed" {
+				res.IPVersions = fmt.Sprint(tm.examiner.IPVersion)
+			}
+			tm.report(group.Context(), &res, err, resultsChan, onProgress)
+		})
+	}
+	group.Wait()
+}
+
+// report logs a single result, sends it to resultsChan and fires onProgress.
+func (tm *TestManager) report(ctx context.Context, res *Result, err error, resultsChan chan<- *Result, onProgress func()) {
+	if err != nil && !strings.Contains(err.Error(), "context canceled") {
+		if tm.logger != nil {
+			tm.logger.Printf("[-] Error: %s - broken config: %s\n", err.Error(), res.ConfigLink)
+		} else if tm.verbose {
+			customlog.Printf(customlog.Failure, "Error: %s - broken config: %s\n", err.Error(), res.ConfigLink)
+		}
+	}
+
+	select {
+	case resultsChan <- res:
+		if res.Status == "passed" && tm.logger != nil {
+			tm.logger.Printf("[+] SUCCESS | %s | Delay: %dms\n", res.ConfigLink, res.Delay)
+		}
+	case <-ctx.Done():
+	}
+
+	if onProgress != nil {
+		onProgress()
+	}
+}
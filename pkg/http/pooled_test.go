@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// countingPoolCore hands out plain clients for its pooled instances and records
+// how many instances were live at once.
+type countingPoolCore struct {
+	core.Core
+	mu      sync.Mutex
+	live    int
+	maxLive int
+}
+
+type countingInstance struct{ c *countingPoolCore }
+
+func (i countingInstance) Start() error { return nil }
+
+func (i countingInstance) Close() error {
+	i.c.mu.Lock()
+	defer i.c.mu.Unlock()
+	i.c.live--
+	return nil
+}
+
+func (c *countingPoolCore) MakeHttpClientPool(ctx context.Context, outbounds []protocol.Protocol, maxDelay time.Duration) ([]protocol.PooledClient, protocol.Instance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live++
+	c.maxLive = max(c.maxLive, c.live)
+	clients := make([]protocol.PooledClient, len(outbounds))
+	for i := range clients {
+		clients[i].Client = &http.Client{Timeout: maxDelay}
+	}
+	return clients, countingInstance{c}, nil
+}
+
+func TestRunPooledTestsOverlapsChunks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	e, err := NewExaminer(Options{Core: "xray", TestEndpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := &countingPoolCore{Core: e.Core}
+	e.Core = pc
+
+	var links []string
+	for i := range 8 {
+		links = append(links, fmt.Sprintf("vless://%s@203.0.113.%d:443?security=none&type=tcp#c%d", rawUUID, i+1, i))
+	}
+	tm := NewTestManager(e, 4, false, nil)
+	tm.SetPoolSize(2)
+	results := make(chan *Result, len(links))
+	tm.RunTests(context.Background(), links, results, nil)
+	close(results)
+
+	passed := 0
+	for r := range results {
+		if r.Status == "passed" {
+			passed++
+		}
+	}
+	if passed != len(links) {
+		t.Errorf("passed = %d, want %d", passed, len(links))
+	}
+	// 4 workers over chunks of 2 keep two instances live, and never more.
+	if pc.maxLive != 2 || pc.live != 0 {
+		t.Errorf("max live instances = %d, live after the run = %d; want 2 and 0", pc.maxLive, pc.live)
+	}
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alitto/pond/v2"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// ErrNotTCP is returned by ExamineRaw for configs whose server isn't reached over
+// TCP (Hysteria2, TUIC, WireGuard, QUIC and mKCP transports), which can't be
+// probed without a core.
+var ErrNotTCP = errors.New("server is not reached over TCP, can't probe it without a core")
+
+// ExamineRaw measures how long connecting to the server of link takes, without a
+// core: the TCP connect and, for TLS and REALITY configs, the TLS handshake with
+// the SNI of the config. The certificate isn't checked. ConnectTime is the TCP
+// connect and Delay the total. Nothing goes through the proxy, so a passing
+// config is only reachable, not necessarily working; it is a cheap way to rank a
+// long list before testing it properly.
+func (e *Examiner) ExamineRaw(ctx context.Context, link string) (Result, error) {
+	r, proto, err := e.prepareResult(link)
+	if err != nil {
+		return r, err
+	}
+	g := proto.ConvertToGeneralConfig()
+	if !reachedOverTCP(g) {
+		r.Status = "failed"
+		r.Reason = ErrNotTCP.Error()
+		return r, ErrNotTCP
+	}
+
+	network := "tcp"
+	if e.IPVersion != 0 {
+		network = fmt.Sprintf("tcp%d", e.IPVersion)
+	}
+	limit := time.Duration(e.MaxDelay) * time.Millisecond
+	ctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, net.JoinHostPort(g.Address, g.Port))
+	if err != nil {
+		return rawFailure(r, StageConnect, err)
+	}
+	defer conn.Close()
+	r.ConnectTime = time.Since(start).Milliseconds()
+
+	if g.TLS == "tls" || g.TLS == "reality" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         rawSNI(g),
+			NextProtos:         splitALPN(g.ALPN),
+			InsecureSkipVerify: true,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return rawFailure(r, StageTLS, err)
+		}
+	}
+	r.Delay = time.Since(start).Milliseconds()
+	e.Criteria.apply(&r, nil)
+	return r, nil
+}
+
+// rawFailure records a failed raw probe in r.
+func rawFailure(r Result, stage string, err error) (Result, error) {
+	r.Status = "failed"
+	r.FailedStage = stage
+	if errors.Is(err, context.DeadlineExceeded) {
+		r.Reason = fmt.Sprintf("%s timeout", stage)
+	} else {
+		r.Reason = fmt.Sprintf("%s: %v", stage, err)
+	}
+	return r, err
+}
+
+// reachedOverTCP reports whether the server of a config listens on TCP.
+func reachedOverTCP(g protocol.GeneralConfig) bool {
+	switch g.Protocol {
+	case protocol.Hysteria2Identifier, "hy2", "tuic", protocol.JuicityIdentifier, protocol.WireguardIdentifier:
+		return false
+	}
+	for _, transport := range []string{g.Network, g.Type} {
+		switch strings.ToLower(transport) {
+		case "quic", "kcp", "mkcp", "udp":
+			return false
+		}
+	}
+	return true
+}
+
+// rawSNI returns the server name the config offers in its TLS handshake.
+func rawSNI(g protocol.GeneralConfig) string {
+	switch {
+	case g.SNI != "":
+		return g.SNI
+	case g.Host != "":
+		return g.Host
+	case net.ParseIP(g.Address) == nil:
+		return g.Address
+	}
+	return ""
+}
+
+func splitALPN(alpn string) []string {
+	if alpn == "" {
+		return nil
+	}
+	return strings.Split(alpn, ",")
+}
+
+// PreRanked is the outcome of PreRank.
+type PreRanked struct {
+	// Links are the reachable links, fastest first, followed by those that
+	// can't be probed without a core.
+	Links []string
+	// Unreachable is the number of links dropped because their server didn't
+	// answer in time.
+	Unreachable int
+	// Unprobed is the number of links kept at the end because they aren't
+	// reached over TCP.
+	Unprobed int
+	// Cut is the number of reachable links left out by keep.
+	Cut int
+}
+
+// PreRank probes links with ExamineRaw on threads workers and orders them by
+// their raw delay. Broken and unreachable links are dropped. keep > 0 keeps only
+// that many of the fastest reachable links; links that can't be probed are kept
+// regardless.
+func (e *Examiner) PreRank(ctx context.Context, links []string, threads uint16, keep int) PreRanked {
+	type probed struct {
+		link  string
+		delay int64
+	}
+	var (
+		mu        sync.Mutex
+		reachable []probed
+		out       PreRanked
+		unprobed  []string
+	)
+
+	pool := pond.NewPool(int(max(threads, 1)))
+	defer pool.Stop()
+	group := pool.NewGroupContext(ctx)
+	for _, link := range links {
+		group.Submit(func() {
+			r, err := e.ExamineRaw(group.Context(), link)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reachable = append(reachable, probed{link, r.Delay})
+			case errors.Is(err, ErrNotTCP):
+				unprobed = append(unprobed, link)
+			default:
+				out.Unreachable++
+			}
+		})
+	}
+	group.Wait()
+
+	sort.SliceStable(reachable, func(i, j int) bool { return reachable[i].delay < reachable[j].delay })
+	if keep > 0 && len(reachable) > keep {
+		out.Cut = len(reachable) - keep
+		reachable = reachable[:keep]
+	}
+	for _, p := range reachable {
+		out.Links = append(out.Links, p.link)
+	}
+	out.Links = append(out.Links, unprobed...)
+	out.Unprobed = len(unprobed)
+	return out
+}
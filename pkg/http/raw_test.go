@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const rawUUID = "d342d11e-d424-4583-b36e-524ab1f0afa4"
+
+// closedPort returns a local address nothing listens on.
+func closedPort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestExamineRaw(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	e, err := NewExaminer(Options{Core: "auto", MaxDelay: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := fmt.Sprintf("vless://%s@%s?security=tls&sni=example.com&type=tcp#tls", rawUUID, srv.Listener.Addr())
+	r, err := e.ExamineRaw(context.Background(), link)
+	if err != nil || r.Status != "passed" {
+		t.Fatalf("ExamineRaw(tls) = %s %q, %v", r.Status, r.Reason, err)
+	}
+	if r.ConnectTime < 0 || r.Delay < r.ConnectTime {
+		t.Errorf("connect %dms, delay %dms", r.ConnectTime, r.Delay)
+	}
+
+	link = fmt.Sprintf("vless://%s@%s?security=none&type=tcp#closed", rawUUID, closedPort(t))
+	r, err = e.ExamineRaw(context.Background(), link)
+	if err == nil || r.Status != "failed" || r.FailedStage != StageConnect || r.Delay != FailedDelay {
+		t.Errorf("ExamineRaw(closed) = %s in %q, delay %d, %v", r.Status, r.FailedStage, r.Delay, err)
+	}
+
+	// A plain TCP server doesn't speak TLS.
+	plain := httptest.NewServer(nil)
+	defer plain.Close()
+	link = fmt.Sprintf("vless://%s@%s?security=tls&sni=example.com&type=tcp#plain", rawUUID, plain.Listener.Addr())
+	if r, _ := e.ExamineRaw(context.Background(), link); r.FailedStage != StageTLS {
+		t.Errorf("ExamineRaw(plain) failed in %q, want %q", r.FailedStage, StageTLS)
+	}
+
+	if _, err := e.ExamineRaw(context.Background(), "hysteria2://pass@127.0.0.1:443?sni=example.com#udp"); !errors.Is(err, ErrNotTCP) {
+		t.Errorf("ExamineRaw(hysteria2) error = %v, want ErrNotTCP", err)
+	}
+}
+
+func TestPreRank(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	e, err := NewExaminer(Options{Core: "auto", MaxDelay: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := fmt.Sprintf("vless://%s@%s?security=none&type=tcp#up", rawUUID, srv.Listener.Addr())
+	down := fmt.Sprintf("vless://%s@%s?security=none&type=tcp#down", rawUUID, closedPort(t))
+	udp := "hysteria2://pass@127.0.0.1:443?sni=example.com#udp"
+
+	got := e.PreRank(context.Background(), []string{udp, down, up}, 4, 0)
+	if len(got.Links) != 2 || got.Links[0] != up || got.Links[1] != udp {
+		t.Errorf("Links = %q, want the reachable config, then the UDP one", got.Links)
+	}
+	if got.Unreachable != 1 || got.Unprobed != 1 || got.Cut != 0 {
+		t.Errorf("PreRank() = %+v", got)
+	}
+
+	up2 := fmt.Sprintf("vless://%s@%s?security=none&type=tcp#up2", rawUUID, srv.Listener.Addr())
+	got = e.PreRank(context.Background(), []string{up, up2}, 2, 1)
+	if len(got.Links) != 1 || got.Cut != 1 {
+		t.Errorf("PreRank(keep 1) = %+v", got)
+	}
+}
+
+func TestTimeServer(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	e, err := NewExaminer(Options{Core: "auto", MaxDelay: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	r, proto, err := e.prepareResult(fmt.Sprintf("vless://%s@localhost:%s?security=none&type=tcp#local", rawUUID, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.timeServer(context.Background(), &r, proto, 4)
+	if r.DNSTime < 0 || r.TCPTime < 0 {
+		t.Errorf("dns %dms, tcp %dms", r.DNSTime, r.TCPTime)
+	}
+	if got := (Result{DNSTime: 3, ProxyTime: 1, TLSTime: 20, FirstByteTime: 5}).Timings(); got != "dns 3ms, proxy 1ms, tls 20ms, first byte 5ms, body 0ms" {
+		t.Errorf("Timings() = %q", got)
+	}
+}
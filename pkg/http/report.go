@@ -0,0 +1,169 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// Checks a test can run on each config, by the names of the 'test' command's
+// --stages. latency is the test request every other check builds on.
+const (
+	CheckLatency = "latency"
+	CheckSpeed   = "speed"
+	CheckIP      = "ip"
+	CheckWarm    = "warm"
+	CheckUDP     = "udp"
+	CheckPolicy  = "policy"
+	CheckLeak    = "leak"
+	CheckCert    = "cert"
+)
+
+// Checks are all checks, in the order they are reported.
+var Checks = []string{CheckLatency, CheckSpeed, CheckIP, CheckWarm, CheckUDP, CheckPolicy, CheckLeak, CheckCert}
+
+// ParseChecks validates a list of check names and returns them in report order,
+// latency always included.
+func ParseChecks(names []string) ([]string, error) {
+	set := map[string]bool{CheckLatency: true}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(Checks, name) {
+			return nil, fmt.Errorf("unknown stage %q (supported: %s)", name, strings.Join(Checks, ", "))
+		}
+		set[name] = true
+	}
+	var checks []string
+	for _, c := range Checks {
+		if set[c] {
+			checks = append(checks, c)
+		}
+	}
+	return checks, nil
+}
+
+// WriteCheckReport writes one line per check summing up how the results did in
+// it, so a test running several checks is read in one place.
+func WriteCheckReport(w io.Writer, results ConfigResults, checks []string) {
+	if len(results) == 0 {
+		return
+	}
+	var passed []*Result
+	for _, r := range results {
+		if r.Status == "passed" {
+			passed = append(passed, r)
+		}
+	}
+
+	fmt.Fprintf(w, "%s (%d configs)\n", customlog.GetColor(customlog.Label, "Report"), len(results))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  STAGE\tRESULT")
+	for _, check := range checks {
+		fmt.Fprintf(tw, "  %s\t%s\n", check, checkResult(check, results, passed))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// checkResult sums up one check. Only passed results ran the checks after latency.
+func checkResult(check string, results ConfigResults, passed []*Result) string {
+	count := func(ok func(r *Result) bool) int {
+		n := 0
+		for _, r := range passed {
+			if ok(r) {
+				n++
+			}
+		}
+		return n
+	}
+	switch check {
+	case CheckLatency:
+		var delays []int64
+		for _, r := range passed {
+			if r.Delay >= 0 {
+				delays = append(delays, r.Delay)
+			}
+		}
+		s := fmt.Sprintf("%d passed, %d failed", len(passed), len(results)-len(passed))
+		if len(delays) > 0 {
+			sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+			s += fmt.Sprintf(", median %dms", percentile(delays, 50))
+		}
+		return s
+	case CheckSpeed:
+		var down, up []float64
+		for _, r := range passed {
+			if r.DownloadSpeed > 0 {
+				down = append(down, float64(r.DownloadSpeed))
+			}
+			if r.UploadSpeed > 0 {
+				up = append(up, float64(r.UploadSpeed))
+			}
+		}
+		if len(down) == 0 && len(up) == 0 {
+			return "nothing measured"
+		}
+		return fmt.Sprintf("%d measured, median %.1f Mbps down, %.1f Mbps up", max(len(down), len(up)), medianOf(down), medianOf(up))
+	case CheckIP:
+		ips, countries := make(map[string]bool), make(map[string]bool)
+		for _, r := range passed {
+			if r.RealIPAddr != "" && r.RealIPAddr != "null" {
+				ips[r.RealIPAddr] = true
+			}
+			if r.IpAddrLoc != "" && r.IpAddrLoc != "null" {
+				countries[r.IpAddrLoc] = true
+			}
+		}
+		return fmt.Sprintf("%d distinct exit IPs in %d countries", len(ips), len(countries))
+	case CheckWarm:
+		var delays []int64
+		for _, r := range passed {
+			if r.WarmDelay > 0 {
+				delays = append(delays, r.WarmDelay)
+			}
+		}
+		if len(delays) == 0 {
+			return "nothing measured"
+		}
+		sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+		return fmt.Sprintf("%d measured, median %dms over a reused connection", len(delays), percentile(delays, 50))
+	case CheckUDP:
+		return fmt.Sprintf("%d relay UDP, %d don't", count(func(r *Result) bool { return r.UDP }), count(func(r *Result) bool { return r.NATType == NATBlocked }))
+	case CheckPolicy:
+		return fmt.Sprintf("SMTP open on %d, BitTorrent open on %d",
+			count(func(r *Result) bool { return r.SMTP == PolicyOpen }), count(func(r *Result) bool { return r.P2P == PolicyOpen }))
+	case CheckLeak:
+		return fmt.Sprintf("%d leaking, %d with UDP leaving from another IP",
+			count(func(r *Result) bool { return r.Leaks != "" }), count(func(r *Result) bool { return r.ExitMismatch }))
+	case CheckCert:
+		inspected, warned := 0, 0
+		for _, r := range results {
+			if r.CertIssuer != "" {
+				inspected++
+			}
+			if r.CertWarnings != "" {
+				warned++
+			}
+		}
+		return fmt.Sprintf("%d certificates inspected, %d with warnings", inspected, warned)
+	}
+	return ""
+}
+
+// medianOf returns the median of values, 0 for none.
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	sort.Float64s(sorted)
+	return sorted[(len(sorted)-1)/2]
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseChecks(t *testing.T) {
+	got, err := ParseChecks([]string{"ip", " Speed", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{CheckLatency, CheckSpeed, CheckIP}; !slices.Equal(got, want) {
+		t.Errorf("ParseChecks() = %v, want %v", got, want)
+	}
+	if _, err := ParseChecks([]string{"latency", "ping"}); err == nil {
+		t.Error("ParseChecks accepted an unknown stage")
+	}
+}
+
+func TestWriteCheckReport(t *testing.T) {
+	var b strings.Builder
+	WriteCheckReport(&b, nil, Checks)
+	if b.Len() != 0 {
+		t.Errorf("report without results: %q", b.String())
+	}
+
+	WriteCheckReport(&b, ConfigResults{
+		{Status: "passed", Delay: 100, DownloadSpeed: 20, UploadSpeed: 5, RealIPAddr: "1.1.1.1", IpAddrLoc: "DE", UDP: true, NATType: NATCone, SMTP: PolicyBlocked, P2P: PolicyOpen},
+		{Status: "passed", Delay: 300, DownloadSpeed: 40, UploadSpeed: 10, RealIPAddr: "1.1.1.1", IpAddrLoc: "DE", NATType: NATBlocked, Leaks: LeakDNS},
+		{Status: "failed", Delay: -1},
+	}, []string{CheckLatency, CheckSpeed, CheckIP, CheckUDP, CheckPolicy, CheckLeak})
+	out := b.String()
+	for _, want := range []string{
+		"(3 configs)",
+		"2 passed, 1 failed, median 100ms",
+		"median 20.0 Mbps down, 5.0 Mbps up",
+		"1 distinct exit IPs in 1 countries",
+		"1 relay UDP, 1 don't",
+		"SMTP open on 0, BitTorrent open on 1",
+		"1 leaking",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, CheckCert) {
+		t.Errorf("report has a stage that didn't run:\n%s", out)
+	}
+}
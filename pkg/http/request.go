@@ -0,0 +1,81 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// ParseHeaders parses "Name: value" lines, as given to curl's -H, into a header.
+func ParseHeaders(lines []string) (http.Header, error) {
+	h := make(http.Header)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", line)
+		}
+		h.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// newTestRequest builds the latency request to dest: TestEndpointHttpMethod with
+// TestHeaders and TestBody. Each call returns a fresh request, so the body can be
+// sent again by the warm probes.
+func (e *Examiner) newTestRequest(ctx context.Context, dest string) (*http.Request, error) {
+	var body io.Reader
+	if e.TestBody != "" {
+		body = strings.NewReader(e.TestBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, e.TestEndpointHttpMethod, dest, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range e.TestHeaders {
+		// net/http sends req.Host, not a Host header.
+		if name == "Host" {
+			req.Host = values[len(values)-1]
+			continue
+		}
+		req.Header[name] = append([]string(nil), values...)
+	}
+	return req, nil
+}
+
+// checkResponse returns why a latency response doesn't meet ExpectStatus (or the
+// per-link expectedStatus, which takes precedence) and ExpectBody, or "".
+func (e *Examiner) checkResponse(code int, body []byte, expectedStatus int) string {
+	if expectedStatus == 0 {
+		expectedStatus = e.ExpectStatus
+	}
+	if expectedStatus != 0 && code != expectedStatus {
+		return fmt.Sprintf("unexpected status code %d (expected %d)", code, expectedStatus)
+	}
+	if e.ExpectBody != "" && !bytes.Contains(body, []byte(e.ExpectBody)) {
+		return fmt.Sprintf("response body does not contain %q", e.ExpectBody)
+	}
+	return ""
+}
+
+// Ping sends the latency request to dest through client once and returns its
+// delay, failing like a test would when the response isn't the expected one.
+func (e *Examiner) Ping(ctx context.Context, client *http.Client, dest string) (int64, error) {
+	req, err := e.newTestRequest(ctx, dest)
+	if err != nil {
+		return FailedDelay, err
+	}
+	res, err := MeasureRequestStaged(client, req, StageTimeouts{})
+	if err != nil {
+		return FailedDelay, err
+	}
+	if reason := e.checkResponse(res.Code, res.Body, 0); reason != "" {
+		return FailedDelay, errors.New(reason)
+	}
+	return res.Delay, nil
+}
@@ -0,0 +1,250 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Stages of a test request, in order. Through a proxy, "connect" is the dial of
+// the outbound and "tls" the handshake with the test URL inside the tunnel, so a
+// config whose server IP is blocked usually fails in the first and one whose SNI
+// is filtered in the second.
+const (
+	StageConnect   = "connect"
+	StageTLS       = "tls"
+	StageFirstByte = "first-byte"
+	StageBody      = "body"
+)
+
+// StageTimeouts limit how long each stage of a test request may take. A zero
+// limit leaves the stage bounded by the client's overall timeout only.
+type StageTimeouts struct {
+	Connect   time.Duration
+	TLS       time.Duration
+	FirstByte time.Duration
+}
+
+func (t StageTimeouts) limit(stage string) time.Duration {
+	switch stage {
+	case StageConnect:
+		return t.Connect
+	case StageTLS:
+		return t.TLS
+	case StageFirstByte:
+		return t.FirstByte
+	}
+	return 0
+}
+
+// StageTimings is how long each stage of a successful test request took, like
+// the timings of curl -w. Connect is the dial through the outbound up to the
+// connection being ready, which includes the proxy handshake of cores dialing
+// eagerly; cores dialing lazily (xray) make that handshake during TLS instead.
+// A stage that didn't happen, such as the TLS handshake of a reused connection
+// or of an http:// URL, is 0.
+type StageTimings struct {
+	Connect   time.Duration
+	TLS       time.Duration
+	FirstByte time.Duration // from the request written to the first response byte
+	Body      time.Duration
+}
+
+// StageError is the error of a test request with the stage it failed in.
+type StageError struct {
+	Stage string
+	// Timeout is the stage limit that expired, 0 when the stage failed otherwise.
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *StageError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("%s timeout after %s", e.Stage, e.Timeout)
+	}
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// FailedStage returns the stage a test request error happened in, or "".
+func FailedStage(err error) string {
+	var se *StageError
+	if errors.As(err, &se) {
+		return se.Stage
+	}
+	return ""
+}
+
+// stageTracker follows the stage a request is in and cancels it when the stage
+// outlives its limit.
+type stageTracker struct {
+	limits StageTimeouts
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	stage   string
+	timer   *time.Timer
+	expired string // stage whose limit expired
+}
+
+func (s *stageTracker) enter(stage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired != "" || s.stage == stage {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.stage = stage
+	if limit := s.limits.limit(stage); limit > 0 {
+		s.timer = time.AfterFunc(limit, func() {
+			s.mu.Lock()
+			if s.stage == stage && s.expired == "" {
+				s.expired = stage
+			}
+			s.mu.Unlock()
+			s.cancel()
+		})
+	}
+}
+
+// fail wraps err with the stage the request was in.
+func (s *stageTracker) fail(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.expired != "" {
+		return &StageError{Stage: s.expired, Timeout: s.limits.limit(s.expired), Err: err}
+	}
+	return &StageError{Stage: s.stage, Err: err}
+}
+
+func (s *stageTracker) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// MeasureDelayStaged is MeasureDelayDetailed with a time limit per stage of the
+// request. Its errors are *StageError values naming the stage that failed.
+func MeasureDelayStaged(ctx context.Context, client *http.Client, dest string, httpMethod string, limits StageTimeouts) (*MeasureDelayResult, error) {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, dest, nil)
+	if err != nil {
+		return nil, err
+	}
+	return MeasureRequestStaged(client, req, limits)
+}
+
+// MeasureRequestStaged is MeasureDelayStaged for a request built by the caller,
+// e.g. one with headers and a body.
+func MeasureRequestStaged(client *http.Client, req *http.Request, limits StageTimeouts) (*MeasureDelayResult, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	tracker := &stageTracker{limits: limits, cancel: cancel}
+	defer tracker.stop()
+
+	var mu sync.Mutex
+	var connectStart time.Time
+	var connectTime int64
+	var ttfb int64
+	var reused bool
+	var connReady, tlsStart, wrote, firstByte time.Time
+	var tlsTime time.Duration
+	start := time.Now()
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			// The connection is ready, handshakes included; the request goes out next.
+			tracker.enter(StageFirstByte)
+			mu.Lock()
+			reused = info.Reused
+			connReady = time.Now()
+			mu.Unlock()
+		},
+		ConnectStart: func(_, _ string) {
+			mu.Lock()
+			connectStart = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			if err == nil && !connectStart.IsZero() {
+				connectTime = time.Since(connectStart).Milliseconds()
+			}
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			tracker.enter(StageTLS)
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			if !tlsStart.IsZero() {
+				tlsTime = time.Since(tlsStart)
+			}
+			mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wrote = time.Now()
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			tracker.enter(StageBody)
+			mu.Lock()
+			firstByte = time.Now()
+			ttfb = firstByte.Sub(start).Milliseconds()
+			mu.Unlock()
+		},
+	}
+
+	tracker.enter(StageConnect)
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, tracker.fail(err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	end := time.Now()
+	delay := end.Sub(start).Milliseconds()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var timings StageTimings
+	if !connReady.IsZero() {
+		timings.Connect = connReady.Sub(start) - tlsTime
+		timings.TLS = tlsTime
+	}
+	if !wrote.IsZero() && !firstByte.IsZero() {
+		timings.FirstByte = firstByte.Sub(wrote)
+	}
+	if !firstByte.IsZero() {
+		timings.Body = end.Sub(firstByte)
+	}
+	return &MeasureDelayResult{
+		Timings:     timings,
+		Delay:       delay,
+		Code:        resp.StatusCode,
+		Body:        b,
+		TTFB:        ttfb,
+		ConnectTime: connectTime,
+		Reused:      reused,
+	}, nil
+}
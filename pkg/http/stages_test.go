@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMeasureDelayStaged(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	// Accepts connections but never answers the TLS handshake.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			c, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	limits := StageTimeouts{Connect: 100 * time.Millisecond, TLS: 100 * time.Millisecond, FirstByte: 100 * time.Millisecond}
+	stalledDial := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}}
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		url    string
+		stage  string
+	}{
+		{"connect", stalledDial, slow.URL, StageConnect},
+		{"tls", http.DefaultClient, "https://" + silent.Addr().String(), StageTLS},
+		{"first byte", http.DefaultClient, slow.URL, StageFirstByte},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := MeasureDelayStaged(context.Background(), tt.client, tt.url, "GET", limits)
+			var se *StageError
+			if !errors.As(err, &se) {
+				t.Fatalf("err = %v, want a *StageError", err)
+			}
+			if se.Stage != tt.stage || se.Timeout != 100*time.Millisecond {
+				t.Errorf("err = %v, want a %s timeout", err, tt.stage)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %s, want the stage limit to cut it short", elapsed)
+			}
+		})
+	}
+
+	// A stage that fails by itself is reported without a timeout.
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := closed.Addr().String()
+	closed.Close()
+	_, err = MeasureDelayStaged(context.Background(), http.DefaultClient, "http://"+addr, "GET", StageTimeouts{})
+	if got := FailedStage(err); got != StageConnect {
+		t.Errorf("refused connection failed in stage %q, want %q", got, StageConnect)
+	}
+}
+
+func TestMeasureDelayStaged_Timings(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.(http.Flusher).Flush()
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	// Dialing through the outbound takes a while, like a proxy handshake.
+	client := srv.Client()
+	tr := client.Transport.(*http.Transport)
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		time.Sleep(20 * time.Millisecond)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	res, err := MeasureDelayStaged(context.Background(), client, srv.URL, "GET", StageTimeouts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := res.Timings
+	if tm.Connect < 20*time.Millisecond || tm.TLS <= 0 || tm.FirstByte < 50*time.Millisecond || tm.Body < 30*time.Millisecond {
+		t.Errorf("timings = %+v", tm)
+	}
+	if total := tm.Connect + tm.TLS + tm.FirstByte + tm.Body; total > time.Duration(res.Delay+1)*time.Millisecond {
+		t.Errorf("stages add up to %s, more than the delay %dms", total, res.Delay)
+	}
+}
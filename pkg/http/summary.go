@@ -0,0 +1,335 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+const (
+	histogramBuckets  = 10 // rough number of rows in the latency histogram
+	histogramBarWidth = 40 // width of the longest bar, in characters
+	summaryCountries  = 15 // countries listed before the rest are grouped as "others"
+)
+
+// latencyBucket is one row of the latency histogram: delays in [From, To), or
+// from From on when To is 0.
+type latencyBucket struct {
+	From, To int64
+	Count    int
+}
+
+// countryStats summarizes the passed configs exiting in one country.
+type countryStats struct {
+	Country          string
+	Count            int
+	Min, Median, P90 int64
+}
+
+// WriteLatencySummary renders an ASCII histogram of the delays of the passed
+// results and a per-country table of them to w. It writes nothing when no
+// result passed.
+func WriteLatencySummary(w io.Writer, results ConfigResults) {
+	var delays []int64
+	for _, r := range results {
+		if r.Status == "passed" && r.Delay >= 0 {
+			delays = append(delays, r.Delay)
+		}
+	}
+	if len(delays) == 0 {
+		return
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	fmt.Fprintf(w, "%s (%d passed)\n", customlog.GetColor(customlog.Label, "Latency distribution"), len(delays))
+	buckets := latencyHistogram(delays, histogramBuckets)
+	most := 0
+	for _, b := range buckets {
+		most = max(most, b.Count)
+	}
+	labels := make([]string, len(buckets))
+	labelWidth := 0
+	for i, b := range buckets {
+		labels[i] = fmt.Sprintf("%d-%dms", b.From, b.To-1)
+		if b.To == 0 {
+			labels[i] = fmt.Sprintf("%dms+", b.From)
+		}
+		labelWidth = max(labelWidth, len(labels[i]))
+	}
+	for i, b := range buckets {
+		bar := strings.Repeat("█", (b.Count*histogramBarWidth+most-1)/most)
+		fmt.Fprintf(w, "  %*s │%s %d\n", labelWidth, labels[i], customlog.GetColor(customlog.Success, bar), b.Count)
+	}
+	fmt.Fprintf(w, "  min %dms, p50 %dms, p90 %dms, p99 %dms, max %dms\n\n",
+		delays[0], percentile(delays, 50), percentile(delays, 90), percentile(delays, 99), delays[len(delays)-1])
+
+	countries := countrySummary(results, summaryCountries)
+	if len(countries) == 0 {
+		return
+	}
+	fmt.Fprintln(w, customlog.GetColor(customlog.Label, "By country"))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  COUNTRY\tPASSED\tMIN\tMEDIAN\tP90")
+	for _, c := range countries {
+		fmt.Fprintf(tw, "  %s\t%d\t%dms\t%dms\t%dms\n", c.Country, c.Count, c.Min, c.Median, c.P90)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// WriteFailureStages writes how many failed results broke down in each stage of
+// the delay request and how many of those hit the stage's own timeout, which
+// tells a blocked server IP (connect) from a filtered SNI (tls). It writes
+// nothing when no failure has a stage.
+func WriteFailureStages(w io.Writer, results ConfigResults) {
+	failed := make(map[string]int)
+	timedOut := make(map[string]int)
+	total := 0
+	for _, r := range results {
+		if r.FailedStage == "" {
+			continue
+		}
+		total++
+		failed[r.FailedStage]++
+		if strings.HasPrefix(r.Reason, r.FailedStage+" timeout after") {
+			timedOut[r.FailedStage]++
+		}
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s (%d failed)\n", customlog.GetColor(customlog.Label, "Failures by stage"), total)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  STAGE\tFAILED\tSTAGE TIMEOUT")
+	for _, stage := range []string{StageConnect, StageTLS, StageFirstByte, StageBody} {
+		if failed[stage] > 0 {
+			fmt.Fprintf(tw, "  %s\t%d\t%d\n", stage, failed[stage], timedOut[stage])
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// WriteFailureCauses writes how many failed results were blocked, by the signal
+// that showed it, and how many found their server down, to tell what is worth
+// retrying from another network. It writes nothing when no failure was classified.
+func WriteFailureCauses(w io.Writer, results ConfigResults) {
+	signals := make(map[string]int)
+	blocked, down := 0, 0
+	for _, r := range results {
+		switch r.Failure {
+		case FailureBlocked:
+			blocked++
+			signals[r.BlockSignal]++
+		case FailureDown:
+			down++
+		}
+	}
+	if blocked+down == 0 {
+		return
+	}
+	names := make([]string, 0, len(signals))
+	for name := range signals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if signals[names[i]] != signals[names[j]] {
+			return signals[names[i]] > signals[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintf(w, "%s (%d blocked, %d down)\n", customlog.GetColor(customlog.Label, "Failures by cause"), blocked, down)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  CAUSE\tFAILED")
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s (%s)\t%d\n", FailureBlocked, name, signals[name])
+	}
+	if down > 0 {
+		fmt.Fprintf(tw, "  %s\t%d\n", FailureDown, down)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// WriteCertWarnings lists the configs whose server certificate got warnings
+// from CertCheck. It writes nothing when none did.
+func WriteCertWarnings(w io.Writer, results ConfigResults) {
+	var warned []*Result
+	for _, r := range results {
+		if r.CertWarnings != "" {
+			warned = append(warned, r)
+		}
+	}
+	if len(warned) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s (%d configs)\n", customlog.GetColor(customlog.Label, "Certificate warnings"), len(warned))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  SERVER\tREMARK\tEXPIRES\tWARNINGS")
+	for _, r := range warned {
+		server := net.JoinHostPort(r.ProtocolInfo.Address, r.ProtocolInfo.Port)
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", server, r.ProtocolInfo.Remark, r.CertExpires, r.CertWarnings)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// WriteMutations lists the failed configs that passed as a variation of them
+// with Mutate, with the fix that made them pass. It writes nothing when none did.
+func WriteMutations(w io.Writer, results ConfigResults) {
+	var fixed []*Result
+	for _, r := range results {
+		if r.Mutation != "" {
+			fixed = append(fixed, r)
+		}
+	}
+	if len(fixed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s (%d configs)\n", customlog.GetColor(customlog.Label, "Failed configs that pass when changed"), len(fixed))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  SERVER\tREMARK\tPASSES WITH\tFIX")
+	for _, r := range fixed {
+		server := net.JoinHostPort(r.ProtocolInfo.Address, r.ProtocolInfo.Port)
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", server, r.ProtocolInfo.Remark, r.Mutation, r.MutationFix())
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// latencyHistogram splits sorted delays into about n buckets of a round width
+// (1, 2 or 5 times a power of ten), starting at the bucket of the lowest delay.
+// The buckets span up to the 95th percentile so that a few very slow configs
+// don't squash the rest into one row; the slower ones share a last open bucket.
+func latencyHistogram(sorted []int64, n int) []latencyBucket {
+	lo, hi := sorted[0], percentile(sorted, 95)
+	step := niceStep(float64(hi-lo+1) / float64(n))
+	start := lo / step * step
+
+	buckets := make([]latencyBucket, (hi-start)/step+1)
+	for i := range buckets {
+		buckets[i].From = start + int64(i)*step
+		buckets[i].To = buckets[i].From + step
+	}
+	end := buckets[len(buckets)-1].To
+	if sorted[len(sorted)-1] >= end {
+		buckets = append(buckets, latencyBucket{From: end})
+	}
+	for _, d := range sorted {
+		buckets[min((d-start)/step, int64(len(buckets)-1))].Count++
+	}
+	return buckets
+}
+
+// niceStep rounds x up to the nearest 1, 2 or 5 times a power of ten.
+func niceStep(x float64) int64 {
+	if x <= 1 {
+		return 1
+	}
+	pow := math.Pow(10, math.Floor(math.Log10(x)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if x <= m*pow {
+			return int64(m * pow)
+		}
+	}
+	return int64(10 * pow)
+}
+
+// percentile returns the p-th percentile of sorted using the nearest-rank method.
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// countrySummary groups the passed results by the country of their exit IP,
+// most configs first. Countries past limit are merged into one "others" row.
+// It returns nil when no result has a location.
+func countrySummary(results ConfigResults, limit int) []countryStats {
+	byCountry := make(map[string][]int64)
+	located := false
+	for _, r := range results {
+		if r.Status != "passed" || r.Delay < 0 {
+			continue
+		}
+		loc := r.IpAddrLoc
+		if loc == "" || loc == "null" {
+			loc = "unknown"
+		} else {
+			located = true
+		}
+		byCountry[loc] = append(byCountry[loc], r.Delay)
+	}
+	if !located {
+		return nil
+	}
+
+	names := make([]string, 0, len(byCountry))
+	for name := range byCountry {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := len(byCountry[names[i]]), len(byCountry[names[j]])
+		if a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > limit {
+		var rest []int64
+		for _, name := range names[limit:] {
+			rest = append(rest, byCountry[name]...)
+		}
+		byCountry["others"] = rest
+		names = append(names[:limit], "others")
+	}
+
+	stats := make([]countryStats, len(names))
+	for i, name := range names {
+		delays := byCountry[name]
+		sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+		stats[i] = countryStats{
+			Country: name,
+			Count:   len(delays),
+			Min:     delays[0],
+			Median:  percentile(delays, 50),
+			P90:     percentile(delays, 90),
+		}
+	}
+	return stats
+}
+
+// WriteDegraded writes how many results were degraded, by the success criterion
+// they missed. It writes nothing when none was.
+func WriteDegraded(w io.Writer, results ConfigResults) {
+	missed := make(map[string]int)
+	total := 0
+	for _, r := range results {
+		if r.Status != "degraded" {
+			continue
+		}
+		total++
+		for _, c := range strings.Split(r.Unmet, ",") {
+			missed[c]++
+		}
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s (%d configs)\n", customlog.GetColor(customlog.Label, "Degraded"), total)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "  CRITERION\tMISSED")
+	for _, c := range []string{CriterionStatus, CriterionBody, CriterionDelay} {
+		if missed[c] > 0 {
+			fmt.Fprintf(tw, "  %s\t%d\n", c, missed[c])
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	delays := []int64{120, 150, 180, 240, 260, 310, 950}
+	buckets := latencyHistogram(delays, 10)
+	// (950-120+1)/10 rounds up to a step of 100, starting at 100.
+	if buckets[0].From != 100 || buckets[0].To != 200 || buckets[0].Count != 3 {
+		t.Errorf("first bucket = %+v", buckets[0])
+	}
+	last := buckets[len(buckets)-1]
+	if last.From != 900 || last.Count != 1 {
+		t.Errorf("last bucket = %+v", last)
+	}
+	total := 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if len(buckets) != 9 || total != len(delays) {
+		t.Errorf("%d buckets holding %d delays", len(buckets), total)
+	}
+
+	if b := latencyHistogram([]int64{42, 42}, 10); len(b) != 1 || b[0].Count != 2 {
+		t.Errorf("identical delays: %+v", b)
+	}
+
+	// Outliers past the 95th percentile share an open-ended last bucket.
+	delays = make([]int64, 0, 40)
+	for i := range 39 {
+		delays = append(delays, int64(100+i*10))
+	}
+	delays = append(delays, 9000)
+	buckets = latencyHistogram(delays, 10)
+	last = buckets[len(buckets)-1]
+	if last.To != 0 || last.Count != 1 || last.From > 500 {
+		t.Errorf("outlier bucket = %+v", last)
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	for x, want := range map[float64]int64{0.3: 1, 1: 1, 1.5: 2, 3: 5, 7: 10, 83.1: 100, 120: 200} {
+		if got := niceStep(x); got != want {
+			t.Errorf("niceStep(%v) = %d, want %d", x, got, want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	if p := percentile(sorted, 50); p != 50 {
+		t.Errorf("p50 = %d", p)
+	}
+	if p := percentile(sorted, 90); p != 90 {
+		t.Errorf("p90 = %d", p)
+	}
+	if p := percentile(sorted[:1], 99); p != 10 {
+		t.Errorf("p99 of one = %d", p)
+	}
+}
+
+func TestCountrySummary(t *testing.T) {
+	results := ConfigResults{
+		{Status: "passed", Delay: 300, IpAddrLoc: "DE"},
+		{Status: "passed", Delay: 100, IpAddrLoc: "DE"},
+		{Status: "passed", Delay: 200, IpAddrLoc: "NL"},
+		{Status: "passed", Delay: 500, IpAddrLoc: "US"},
+		{Status: "passed", Delay: 400},
+		{Status: "failed", Delay: -1, IpAddrLoc: "FR"},
+	}
+	stats := countrySummary(results, 2)
+	if len(stats) != 3 {
+		t.Fatalf("got %d rows: %+v", len(stats), stats)
+	}
+	if de := stats[0]; de.Country != "DE" || de.Count != 2 || de.Min != 100 || de.Median != 100 || de.P90 != 300 {
+		t.Errorf("DE = %+v", de)
+	}
+	// NL, US and the unlocated result tie at one config; the ones past the limit are merged.
+	if stats[1].Country != "NL" || stats[2].Country != "others" || stats[2].Count != 2 {
+		t.Errorf("rows = %+v", stats)
+	}
+
+	if stats := countrySummary(ConfigResults{{Status: "passed", Delay: 100}}, 10); stats != nil {
+		t.Errorf("no locations: %+v", stats)
+	}
+}
+
+func TestWriteLatencySummary(t *testing.T) {
+	var b strings.Builder
+	WriteLatencySummary(&b, ConfigResults{{Status: "failed", Delay: -1}})
+	if b.Len() != 0 {
+		t.Errorf("summary without passed configs: %q", b.String())
+	}
+
+	WriteLatencySummary(&b, ConfigResults{
+		{Status: "passed", Delay: 100, IpAddrLoc: "DE"},
+		{Status: "passed", Delay: 180, IpAddrLoc: "NL"},
+	})
+	out := b.String()
+	for _, want := range []string{"(2 passed)", "100-109ms", "p50 100ms", "By country", "DE"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteFailureStages(t *testing.T) {
+	var out strings.Builder
+	WriteFailureStages(&out, ConfigResults{{Status: "passed"}})
+	if out.Len() != 0 {
+		t.Errorf("wrote %q without failures", out.String())
+	}
+
+	WriteFailureStages(&out, ConfigResults{
+		{Status: "failed", FailedStage: StageTLS, Reason: "tls timeout after 3s"},
+		{Status: "failed", FailedStage: StageTLS, Reason: "tls: connection reset by peer"},
+		{Status: "failed", FailedStage: StageConnect, Reason: "connect timeout after 2s"},
+		{Status: "passed"},
+	})
+	text := out.String()
+	if !strings.Contains(text, "(3 failed)") || !strings.Contains(text, "tls       2        1") || !strings.Contains(text, "connect   1        1") {
+		t.Errorf("unexpected output:\n%s", text)
+	}
+	if strings.Index(text, "connect ") > strings.Index(text, "tls ") {
+		t.Errorf("stages out of order:\n%s", text)
+	}
+}
+
+func TestWriteFailureCauses(t *testing.T) {
+	var out strings.Builder
+	WriteFailureCauses(&out, ConfigResults{{Status: "passed"}})
+	if out.Len() != 0 {
+		t.Errorf("wrote %q without failures", out.String())
+	}
+
+	WriteFailureCauses(&out, ConfigResults{
+		{Status: "failed", Failure: FailureBlocked, BlockSignal: "block-page:iran"},
+		{Status: "failed", Failure: FailureBlocked, BlockSignal: "rst"},
+		{Status: "failed", Failure: FailureBlocked, BlockSignal: "rst"},
+		{Status: "failed", Failure: FailureDown},
+		{Status: "passed"},
+	})
+	text := out.String()
+	if !strings.Contains(text, "(3 blocked, 1 down)") {
+		t.Errorf("unexpected header:\n%s", text)
+	}
+	for _, row := range [][2]string{{"blocked (rst)", "2"}, {"blocked (block-page:iran)", "1"}, {"down", "1"}} {
+		if !regexp.MustCompile(regexp.QuoteMeta(row[0]) + ` +` + row[1] + `\n`).MatchString(text) {
+			t.Errorf("missing row %q with %s:\n%s", row[0], row[1], text)
+		}
+	}
+	if strings.Index(text, "(rst)") > strings.Index(text, "(block-page:iran)") {
+		t.Errorf("signals not sorted by count:\n%s", text)
+	}
+}
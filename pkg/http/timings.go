@@ -0,0 +1,69 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// timeServer records in r how long resolving the server of proto and a TCP
+// connect to it over IP version v (0 = any) take when dialed directly, the first
+// stages curl -w reports, which the core makes out of sight of the test request.
+// A server reached over UDP is only resolved. Failures leave the stage at 0: the
+// test through the core says why the config doesn't work.
+func (e *Examiner) timeServer(ctx context.Context, r *Result, proto protocol.Protocol, v int) {
+	g := proto.ConvertToGeneralConfig()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.Timeout)*time.Millisecond)
+	defer cancel()
+
+	network := "ip"
+	if v != 0 {
+		network = fmt.Sprintf("ip%d", v)
+	}
+	ip := net.ParseIP(g.Address)
+	if ip == nil {
+		start := time.Now()
+		ips, err := net.DefaultResolver.LookupIP(ctx, network, g.Address)
+		if err != nil || len(ips) == 0 {
+			return
+		}
+		r.DNSTime = time.Since(start).Milliseconds()
+		ip = ips[0]
+	}
+	if !reachedOverTCP(g) {
+		return
+	}
+
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), g.Port))
+	if err != nil {
+		return
+	}
+	conn.Close()
+	r.TCPTime = time.Since(start).Milliseconds()
+}
+
+// Timings formats the stage timings of r, e.g. "dns 12ms, tcp 40ms, proxy 0ms,
+// tls 310ms, first byte 95ms, body 1ms". The direct dns and tcp stages are only
+// listed when they were measured.
+func (r Result) Timings() string {
+	var parts []string
+	if r.DNSTime > 0 {
+		parts = append(parts, fmt.Sprintf("dns %dms", r.DNSTime))
+	}
+	if r.TCPTime > 0 {
+		parts = append(parts, fmt.Sprintf("tcp %dms", r.TCPTime))
+	}
+	parts = append(parts,
+		fmt.Sprintf("proxy %dms", r.ProxyTime),
+		fmt.Sprintf("tls %dms", r.TLSTime),
+		fmt.Sprintf("first byte %dms", r.FirstByteTime),
+		fmt.Sprintf("body %dms", r.BodyTime),
+	)
+	return strings.Join(parts, ", ")
+}
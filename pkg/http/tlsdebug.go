@@ -0,0 +1,296 @@
+package http
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	utls "github.com/refraction-networking/utls"
+	xtls "github.com/xtls/xray-core/transport/internet/tls"
+)
+
+// ClientHello describes the ClientHello of a TLS handshake.
+type ClientHello struct {
+	SNI                 string
+	ALPN                []string
+	Versions            []string // offered in supported_versions, or the legacy version
+	CipherSuites        []string
+	Extensions          []string // in the order they were sent
+	Groups              []string // supported_groups
+	KeyShares           []string
+	SignatureAlgorithms []string
+	// JA3 is the JA3 fingerprint of the hello, without GREASE values, which
+	// other tools and clients can be compared by.
+	JA3  string
+	Size int // bytes of the handshake message
+}
+
+// TLSDebug is what DebugTLS found out about the TLS handshake of a config.
+type TLSDebug struct {
+	Server      string // host:port dialed
+	Security    string // tls or reality
+	Fingerprint string // the fingerprint of the config, "" for the default
+	Hello       ClientHello
+
+	// The server's side, when the handshake got that far.
+	Version       string
+	CipherSuite   string
+	ALPN          string // negotiated, "" for none
+	Certificate   *CertInfo
+	ConnectTime   time.Duration
+	HandshakeTime time.Duration
+	// Err is why the handshake failed, nil when it succeeded. A TLS alert from
+	// the server shows up as "remote error: tls: ...".
+	Err error
+}
+
+// DebugTLS makes the TLS handshake of the config of link with its server
+// directly, with the ClientHello the xray core builds for it: the SNI, ALPN and
+// uTLS fingerprint of the config. It returns the parameters of the hello and
+// what the server answered, to tell why a config works in one client and not
+// in another. REALITY configs are dialed without their REALITY authentication,
+// so their server answers as the site it borrows would. The certificate isn't
+// checked. The error is only for configs that can't be debugged; a failed
+// handshake is reported in TLSDebug.Err.
+func (e *Examiner) DebugTLS(ctx context.Context, link string) (*TLSDebug, error) {
+	proto, err := e.Core.CreateProtocol(strings.TrimSpace(link))
+	if err != nil {
+		return nil, fmt.Errorf("create protocol: %w", err)
+	}
+	if err := proto.Parse(); err != nil {
+		return nil, fmt.Errorf("parse protocol: %w", err)
+	}
+	g := proto.ConvertToGeneralConfig()
+	if g.TLS != "tls" && g.TLS != "reality" {
+		return nil, errors.New("the config doesn't use TLS or REALITY")
+	}
+	if !reachedOverTCP(g) {
+		return nil, ErrNotTCP
+	}
+	helloID := xtls.GetFingerprint(g.TlsFingerprint)
+	if helloID == nil {
+		return nil, fmt.Errorf("unknown TLS fingerprint %q", g.TlsFingerprint)
+	}
+
+	d := &TLSDebug{
+		Server:      net.JoinHostPort(g.Address, g.Port),
+		Security:    g.TLS,
+		Fingerprint: g.TlsFingerprint,
+	}
+	network := "tcp"
+	if e.IPVersion != 0 {
+		network = fmt.Sprintf("tcp%d", e.IPVersion)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.Timeout)*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.Server)
+	if err != nil {
+		d.Err = err
+		return d, nil
+	}
+	defer conn.Close()
+	d.ConnectTime = time.Since(start)
+
+	uconn := utls.UClient(conn, &utls.Config{ServerName: rawSNI(g), InsecureSkipVerify: true}, *helloID)
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, fmt.Errorf("build the ClientHello: %w", err)
+	}
+	// Like the core, keep the ALPN of the fingerprint unless the config or its
+	// transport only speaks HTTP/1.1.
+	if alpn := splitALPN(g.ALPN); (len(alpn) == 1 && alpn[0] == "http/1.1") || http1Transport(g) {
+		setALPN(uconn, []string{"http/1.1"})
+		if err := uconn.BuildHandshakeState(); err != nil {
+			return nil, fmt.Errorf("build the ClientHello: %w", err)
+		}
+	}
+	d.Hello = describeHello(uconn.HandshakeState.Hello)
+
+	start = time.Now()
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		d.Err = err
+		return d, nil
+	}
+	d.HandshakeTime = time.Since(start)
+	state := uconn.ConnectionState()
+	d.Version = utls.VersionName(state.Version)
+	d.CipherSuite = utls.CipherSuiteName(state.CipherSuite)
+	d.ALPN = state.NegotiatedProtocol
+	if len(state.PeerCertificates) > 0 {
+		d.Certificate = describeCert(state.PeerCertificates, rawSNI(g), time.Now())
+	}
+	return d, nil
+}
+
+// http1Transport reports whether the transport of g runs over HTTP/1.1.
+func http1Transport(g protocol.GeneralConfig) bool {
+	for _, transport := range []string{g.Network, g.Type} {
+		switch strings.ToLower(transport) {
+		case "ws", "httpupgrade":
+			return true
+		}
+	}
+	return false
+}
+
+// setALPN replaces the protocols of the ALPN extension of a hello, adding one
+// if it has none.
+func setALPN(uconn *utls.UConn, protocols []string) {
+	for _, ext := range uconn.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = protocols
+			return
+		}
+	}
+	uconn.Extensions = append(uconn.Extensions, &utls.ALPNExtension{AlpnProtocols: protocols})
+}
+
+// isGREASE reports whether v is one of the reserved GREASE values (RFC 8701)
+// clients send to keep servers tolerant of unknown ones.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// describeHello lists the parameters of a ClientHello.
+func describeHello(hello *utls.PubClientHelloMsg) ClientHello {
+	h := ClientHello{SNI: hello.ServerName, ALPN: hello.AlpnProtocols, Size: len(hello.Raw)}
+	var ja3Ciphers, ja3Exts, ja3Groups, ja3Points []string
+	for _, v := range hello.SupportedVersions {
+		if !isGREASE(v) {
+			h.Versions = append(h.Versions, utls.VersionName(v))
+		}
+	}
+	if len(h.Versions) == 0 {
+		h.Versions = []string{utls.VersionName(hello.Vers)}
+	}
+	for _, c := range hello.CipherSuites {
+		if isGREASE(c) {
+			h.CipherSuites = append(h.CipherSuites, "GREASE")
+			continue
+		}
+		h.CipherSuites = append(h.CipherSuites, utls.CipherSuiteName(c))
+		ja3Ciphers = append(ja3Ciphers, strconv.Itoa(int(c)))
+	}
+	for _, ext := range helloExtensions(hello.Raw) {
+		if isGREASE(ext) {
+			h.Extensions = append(h.Extensions, "GREASE")
+			continue
+		}
+		h.Extensions = append(h.Extensions, extensionName(ext))
+		ja3Exts = append(ja3Exts, strconv.Itoa(int(ext)))
+	}
+	for _, group := range hello.SupportedCurves {
+		if isGREASE(uint16(group)) {
+			continue
+		}
+		h.Groups = append(h.Groups, group.String())
+		ja3Groups = append(ja3Groups, strconv.Itoa(int(group)))
+	}
+	for _, share := range hello.KeyShares {
+		if !isGREASE(uint16(share.Group)) {
+			h.KeyShares = append(h.KeyShares, share.Group.String())
+		}
+	}
+	for _, scheme := range hello.SupportedSignatureAlgorithms {
+		h.SignatureAlgorithms = append(h.SignatureAlgorithms, scheme.String())
+	}
+	for _, p := range hello.SupportedPoints {
+		ja3Points = append(ja3Points, strconv.Itoa(int(p)))
+	}
+	ja3 := strings.Join([]string{
+		strconv.Itoa(int(hello.Vers)),
+		strings.Join(ja3Ciphers, "-"),
+		strings.Join(ja3Exts, "-"),
+		strings.Join(ja3Groups, "-"),
+		strings.Join(ja3Points, "-"),
+	}, ",")
+	sum := md5.Sum([]byte(ja3))
+	h.JA3 = hex.EncodeToString(sum[:])
+	return h
+}
+
+// helloExtensions returns the types of the extensions of a raw ClientHello
+// handshake message, in order, or nil if it is malformed.
+func helloExtensions(raw []byte) []uint16 {
+	// type (1), length (3), version (2), random (32)
+	p := raw
+	if len(p) < 38 {
+		return nil
+	}
+	p = p[38:]
+	skip := func(lenBytes int) bool {
+		if len(p) < lenBytes {
+			return false
+		}
+		n := 0
+		for _, b := range p[:lenBytes] {
+			n = n<<8 | int(b)
+		}
+		if len(p) < lenBytes+n {
+			return false
+		}
+		p = p[lenBytes+n:]
+		return true
+	}
+	// session ID, cipher suites, compression methods
+	if !skip(1) || !skip(2) || !skip(1) || len(p) < 2 {
+		return nil
+	}
+	p = p[2:]
+	var types []uint16
+	for len(p) >= 4 {
+		types = append(types, binary.BigEndian.Uint16(p))
+		p = p[2:]
+		if !skip(2) {
+			return nil
+		}
+	}
+	return types
+}
+
+// extensionNames are the TLS extensions a ClientHello commonly carries.
+var extensionNames = map[uint16]string{
+	0:     "server_name",
+	5:     "status_request",
+	10:    "supported_groups",
+	11:    "ec_point_formats",
+	13:    "signature_algorithms",
+	16:    "alpn",
+	17:    "status_request_v2",
+	18:    "signed_certificate_timestamp",
+	21:    "padding",
+	22:    "encrypt_then_mac",
+	23:    "extended_master_secret",
+	27:    "compress_certificate",
+	28:    "record_size_limit",
+	34:    "delegated_credentials",
+	35:    "session_ticket",
+	41:    "pre_shared_key",
+	42:    "early_data",
+	43:    "supported_versions",
+	45:    "psk_key_exchange_modes",
+	49:    "post_handshake_auth",
+	50:    "signature_algorithms_cert",
+	51:    "key_share",
+	17513: "application_settings",
+	17613: "application_settings_new",
+	65037: "encrypted_client_hello",
+	65281: "renegotiation_info",
+}
+
+func extensionName(t uint16) string {
+	if name, ok := extensionNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDebugTLS(t *testing.T) {
+	hellos := make(chan *tls.ClientHelloInfo, 2)
+	srv := httptest.NewUnstartedServer(nil)
+	srv.TLS = &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			hellos <- hello
+			return nil, nil
+		},
+	}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	e, err := NewExaminer(Options{Core: "auto", MaxDelay: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := fmt.Sprintf("vless://%s@%s?security=tls&sni=example.com&fp=chrome&type=tcp#tls", rawUUID, srv.Listener.Addr())
+	d, err := e.DebugTLS(context.Background(), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Err != nil {
+		t.Fatalf("handshake failed: %v", d.Err)
+	}
+	hello := <-hellos
+	if d.Hello.SNI != "example.com" || hello.ServerName != "example.com" {
+		t.Errorf("SNI = %q, server saw %q", d.Hello.SNI, hello.ServerName)
+	}
+	if !slices.Equal(d.Hello.ALPN, hello.SupportedProtos) || !slices.Contains(d.Hello.ALPN, "h2") {
+		t.Errorf("ALPN = %v, server saw %v", d.Hello.ALPN, hello.SupportedProtos)
+	}
+	if len(d.Hello.CipherSuites) != len(hello.CipherSuites) || d.Hello.CipherSuites[0] != "GREASE" {
+		t.Errorf("cipher suites = %v", d.Hello.CipherSuites)
+	}
+	if !slices.Contains(d.Hello.Extensions, "server_name") || !slices.Contains(d.Hello.Extensions, "key_share") {
+		t.Errorf("extensions = %v", d.Hello.Extensions)
+	}
+	if len(d.Hello.JA3) != 32 {
+		t.Errorf("JA3 = %q", d.Hello.JA3)
+	}
+	if d.Version != "TLS 1.3" || d.ALPN != "h2" || d.Certificate == nil {
+		t.Errorf("negotiated %s, ALPN %q, certificate %v", d.Version, d.ALPN, d.Certificate)
+	}
+
+	// A websocket transport only offers HTTP/1.1, whatever the fingerprint.
+	link = fmt.Sprintf("vless://%s@%s?security=tls&sni=example.com&fp=chrome&type=ws#ws", rawUUID, srv.Listener.Addr())
+	if d, err = e.DebugTLS(context.Background(), link); err != nil || d.Err != nil {
+		t.Fatalf("DebugTLS(ws) = %v, %v", err, d.Err)
+	}
+	<-hellos
+	if !slices.Equal(d.Hello.ALPN, []string{"http/1.1"}) || d.ALPN != "http/1.1" {
+		t.Errorf("ws ALPN = %v, negotiated %q", d.Hello.ALPN, d.ALPN)
+	}
+
+	link = fmt.Sprintf("vless://%s@%s?security=none&type=tcp#plain", rawUUID, srv.Listener.Addr())
+	if _, err := e.DebugTLS(context.Background(), link); err == nil {
+		t.Error("DebugTLS of a config without TLS succeeded")
+	}
+}
+
+func TestHelloExtensions(t *testing.T) {
+	if got := helloExtensions([]byte{1, 0, 0}); got != nil {
+		t.Errorf("helloExtensions(short) = %v", got)
+	}
+	if !isGREASE(0x1a1a) || isGREASE(0x1a2a) || isGREASE(0x0017) {
+		t.Error("isGREASE is wrong")
+	}
+}
@@ -0,0 +1,320 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+// NAT types reported by the UDP test in Result.NATType.
+const (
+	NATBlocked    = "blocked"    // UDP is not relayed
+	NATUnknown    = "unknown"    // UDP is relayed, but no STUN server answered
+	NATSymmetric  = "symmetric"  // every destination gets its own mapping
+	NATCone       = "cone"       // one mapping for all destinations; who may send back is not known
+	NATRestricted = "restricted" // one mapping, answering only hosts that were contacted
+	NATFullCone   = "full-cone"  // one mapping that any host can send to
+)
+
+// STUNServers are asked for the address UDP leaves the config's server from.
+// Two of them tell a symmetric NAT, which maps each destination to another
+// port, from a cone NAT.
+var STUNServers = []string{"stun.l.google.com:19302", "stun.cloudflare.com:3478"}
+
+// UDPDNSServer is sent a plain DNS query when no STUN server answers, to tell a
+// UDP relay that works from one that doesn't.
+var UDPDNSServer = "1.1.1.1:53"
+
+// testUDP checks UDP through the instance a config was tested with and records
+// the outcome in r. Cores that can't relay UDP leave r untouched.
+func (e *Examiner) testUDP(ctx context.Context, r *Result, c core.Core, instance protocol.Instance) {
+	uc, ok := c.(core.UDPCore)
+	if !ok || len(STUNServers) == 0 {
+		return
+	}
+	conn, err := uc.ListenPacket(ctx, instance, STUNServers[0])
+	if err != nil {
+		r.NATType = NATBlocked
+		if e.Verbose {
+			e.Logger.Printf("UDP test: %v\n", err)
+		}
+		return
+	}
+	defer conn.Close()
+
+	var exit netip.Addr
+	r.UDP, r.NATType, exit = probeNAT(ctx, conn, STUNServers, UDPDNSServer, time.Duration(e.Timeout)*time.Millisecond)
+	if exit.IsValid() {
+		r.UDPExitIP = exit.String()
+	}
+}
+
+// probeNAT classifies the NAT conn's packets leave through from the STUN binding
+// responses of servers, falling back to a DNS query to dnsServer when none of
+// them answers. Each exchange waits at most timeout. The public IP the first
+// STUN server saw is returned too.
+func probeNAT(ctx context.Context, conn net.PacketConn, servers []string, dnsServer string, timeout time.Duration) (bool, string, netip.Addr) {
+	packets := readPackets(conn)
+
+	var first *stunResponse
+	var firstServer *net.UDPAddr
+	for _, s := range servers {
+		addr, err := resolveUDP4(ctx, s)
+		if err != nil {
+			continue
+		}
+		res, err := stunBinding(ctx, conn, packets, addr, false, timeout)
+		if err != nil {
+			continue
+		}
+		if first == nil {
+			first, firstServer = res, addr
+			continue
+		}
+		if res.mapped != first.mapped {
+			return true, NATSymmetric, first.mapped.Addr().Unmap()
+		}
+		break
+	}
+
+	if first == nil {
+		if addr, err := resolveUDP4(ctx, dnsServer); err == nil && dnsExchange(ctx, conn, packets, addr, timeout) {
+			return true, NATUnknown, netip.Addr{}
+		}
+		return false, NATBlocked, netip.Addr{}
+	}
+
+	// Only servers implementing RFC 5780 announce another address and can answer
+	// from it; the rest ignore CHANGE-REQUEST, so their silence means nothing.
+	exit := first.mapped.Addr().Unmap()
+	if !first.other.IsValid() {
+		return true, NATCone, exit
+	}
+	if _, err := stunBinding(ctx, conn, packets, firstServer, true, timeout); err != nil {
+		return true, NATRestricted, exit
+	}
+	return true, NATFullCone, exit
+}
+
+type udpPacket struct {
+	data []byte
+	from net.Addr
+}
+
+// readPackets reads conn until it is closed. Packet connections relayed by a
+// core don't all honour read deadlines, so the exchanges select on the channel
+// instead.
+func readPackets(conn net.PacketConn) <-chan udpPacket {
+	ch := make(chan udpPacket, 16)
+	go func() {
+		defer close(ch)
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- udpPacket{data: bytes.Clone(buf[:n]), from: from}:
+			default:
+			}
+		}
+	}()
+	return ch
+}
+
+// exchange sends req to addr, once more halfway through timeout, and returns the
+// first packet accepted by match.
+func exchange(ctx context.Context, conn net.PacketConn, packets <-chan udpPacket, addr net.Addr, req []byte, match func([]byte) bool, timeout time.Duration) ([]byte, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	resend := time.NewTimer(timeout / 2)
+	defer resend.Stop()
+
+	if _, err := conn.WriteTo(req, addr); err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case p, ok := <-packets:
+			if !ok {
+				return nil, net.ErrClosed
+			}
+			if match(p.data) {
+				return p.data, nil
+			}
+		case <-resend.C:
+			if _, err := conn.WriteTo(req, addr); err != nil {
+				return nil, err
+			}
+		case <-deadline.C:
+			return nil, fmt.Errorf("no answer from %s", addr)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func resolveUDP4(ctx context.Context, hostport string) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%s has no IPv4 address", host)
+	}
+	p, err := net.LookupPort("udp", port)
+	if err != nil {
+		return nil, err
+	}
+	return net.UDPAddrFromAddrPort(netip.AddrPortFrom(addrs[0].Unmap(), uint16(p))), nil
+}
+
+const (
+	stunMagicCookie     = 0x2112A442
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrChangeRequest    = 0x0003
+	stunAttrChangedAddress   = 0x0005
+	stunAttrXorMappedAddress = 0x0020
+	stunAttrOtherAddress     = 0x802C
+)
+
+// stunResponse holds the addresses of a STUN binding response.
+type stunResponse struct {
+	mapped netip.AddrPort // address the request arrived from
+	other  netip.AddrPort // alternate address of an RFC 5780 server, if any
+}
+
+// stunBinding sends a binding request to addr and waits for its response. With
+// change set, the server is asked to answer from its other IP address and port.
+func stunBinding(ctx context.Context, conn net.PacketConn, packets <-chan udpPacket, addr net.Addr, change bool, timeout time.Duration) (*stunResponse, error) {
+	var txID [12]byte
+	if _, err := rand.Read(txID[:]); err != nil {
+		return nil, err
+	}
+	var res *stunResponse
+	_, err := exchange(ctx, conn, packets, addr, stunRequest(txID, change), func(b []byte) bool {
+		r, err := parseSTUNResponse(b, txID)
+		if err != nil {
+			return false
+		}
+		res = r
+		return true
+	}, timeout)
+	return res, err
+}
+
+// stunRequest encodes a binding request (RFC 5389), with a CHANGE-REQUEST for
+// both IP and port when change is set.
+func stunRequest(txID [12]byte, change bool) []byte {
+	b := make([]byte, 20, 28)
+	binary.BigEndian.PutUint16(b[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(b[4:], stunMagicCookie)
+	copy(b[8:], txID[:])
+	if change {
+		b = binary.BigEndian.AppendUint16(b, stunAttrChangeRequest)
+		b = binary.BigEndian.AppendUint16(b, 4)
+		b = binary.BigEndian.AppendUint32(b, 0x06)
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-20))
+	return b
+}
+
+// parseSTUNResponse decodes the binding response to the request txID.
+func parseSTUNResponse(b []byte, txID [12]byte) (*stunResponse, error) {
+	if len(b) < 20 || binary.BigEndian.Uint16(b[0:]) != stunBindingResponse ||
+		binary.BigEndian.Uint32(b[4:]) != stunMagicCookie || !bytes.Equal(b[8:20], txID[:]) {
+		return nil, errors.New("not a STUN binding response to this request")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if 20+length > len(b) {
+		return nil, errors.New("truncated STUN message")
+	}
+
+	res := &stunResponse{}
+	var mapped netip.AddrPort
+	attrs := b[20 : 20+length]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		size := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+size > len(attrs) {
+			return nil, errors.New("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+size]
+		switch typ {
+		case stunAttrXorMappedAddress:
+			res.mapped = stunAddress(value, b[4:20])
+		case stunAttrMappedAddress:
+			mapped = stunAddress(value, nil)
+		case stunAttrOtherAddress, stunAttrChangedAddress:
+			res.other = stunAddress(value, nil)
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		size = (size + 3) &^ 3
+		if 4+size > len(attrs) {
+			break
+		}
+		attrs = attrs[4+size:]
+	}
+	if !res.mapped.IsValid() {
+		res.mapped = mapped
+	}
+	if !res.mapped.IsValid() {
+		return nil, errors.New("STUN response has no mapped address")
+	}
+	return res, nil
+}
+
+// stunAddress decodes an address attribute, XORed with key (the magic cookie
+// and transaction ID) when key is set.
+func stunAddress(v, key []byte) netip.AddrPort {
+	if len(v) < 8 {
+		return netip.AddrPort{}
+	}
+	port := binary.BigEndian.Uint16(v[2:])
+	ip := bytes.Clone(v[4:])
+	if key != nil {
+		port ^= binary.BigEndian.Uint16(key)
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	switch {
+	case v[1] == 0x01 && len(ip) == 4:
+		return netip.AddrPortFrom(netip.AddrFrom4([4]byte(ip)), port)
+	case v[1] == 0x02 && len(ip) == 16:
+		return netip.AddrPortFrom(netip.AddrFrom16([16]byte(ip)), port)
+	}
+	return netip.AddrPort{}
+}
+
+// dnsExchange reports whether addr answers a DNS query for cloudflare.com.
+func dnsExchange(ctx context.Context, conn net.PacketConn, packets <-chan udpPacket, addr net.Addr, timeout time.Duration) bool {
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return false
+	}
+	q := append(id[:], 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0) // recursion desired, one question
+	q = append(q, "\x0acloudflare\x03com\x00"...)
+	q = append(q, 0, 1, 0, 1) // A, IN
+	_, err := exchange(ctx, conn, packets, addr, q, func(b []byte) bool {
+		return len(b) >= 12 && b[0] == id[0] && b[1] == id[1] && b[2]&0x80 != 0
+	}, timeout)
+	return err == nil
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// fakeSTUN answers binding requests with the sender's address, shifted by
+// portShift. With other set it announces that second socket as its alternate
+// address and answers CHANGE-REQUESTs from it.
+func fakeSTUN(t *testing.T, portShift int, other net.PacketConn) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			src := from.(*net.UDPAddr).AddrPort()
+			res := make([]byte, 20)
+			binary.BigEndian.PutUint16(res[0:], stunBindingResponse)
+			copy(res[4:], req[4:20])
+			res = binary.BigEndian.AppendUint16(res, stunAttrXorMappedAddress)
+			res = binary.BigEndian.AppendUint16(res, 8)
+			res = append(res, 0, 0x01)
+			res = binary.BigEndian.AppendUint16(res, uint16(int(src.Port())+portShift)^uint16(stunMagicCookie>>16))
+			ip := src.Addr().As4()
+			for i := range ip {
+				ip[i] ^= req[4+i]
+			}
+			res = append(res, ip[:]...)
+
+			change := len(req) > 20 && binary.BigEndian.Uint16(req[20:]) == stunAttrChangeRequest
+			if other != nil {
+				o := other.LocalAddr().(*net.UDPAddr).AddrPort()
+				res = binary.BigEndian.AppendUint16(res, stunAttrOtherAddress)
+				res = binary.BigEndian.AppendUint16(res, 8)
+				res = append(res, 0, 0x01)
+				res = binary.BigEndian.AppendUint16(res, o.Port())
+				oip := o.Addr().As4()
+				res = append(res, oip[:]...)
+			}
+			binary.BigEndian.PutUint16(res[2:], uint16(len(res)-20))
+			switch {
+			case !change:
+				pc.WriteTo(res, from)
+			case other != nil:
+				other.WriteTo(res, from)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestProbeNAT(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	alternate, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alternate.Close()
+
+	tests := []struct {
+		name    string
+		servers []string
+		wantUDP bool
+		wantNAT string
+	}{
+		{"cone", []string{fakeSTUN(t, 0, nil), fakeSTUN(t, 0, nil)}, true, NATCone},
+		{"symmetric", []string{fakeSTUN(t, 0, nil), fakeSTUN(t, 1, nil)}, true, NATSymmetric},
+		{"full cone", []string{fakeSTUN(t, 0, alternate), fakeSTUN(t, 0, nil)}, true, NATFullCone},
+		{"blocked", []string{silent.LocalAddr().String()}, false, NATBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			udp, nat, exit := probeNAT(context.Background(), conn, tt.servers, silent.LocalAddr().String(), 200*time.Millisecond)
+			if udp != tt.wantUDP || nat != tt.wantNAT {
+				t.Errorf("probeNAT() = %v, %q, want %v, %q", udp, nat, tt.wantUDP, tt.wantNAT)
+			}
+			if tt.wantUDP && exit.String() != "127.0.0.1" {
+				t.Errorf("probeNAT() exit = %s, want 127.0.0.1", exit)
+			}
+		})
+	}
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	txID := [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	req := stunRequest(txID, true)
+	if len(req) != 28 || binary.BigEndian.Uint16(req[2:]) != 8 {
+		t.Fatalf("stunRequest() = %x", req)
+	}
+	if _, err := parseSTUNResponse(req, txID); err == nil {
+		t.Error("parseSTUNResponse accepted a request")
+	}
+
+	// A legacy response carrying only MAPPED-ADDRESS, with an unknown attribute
+	// needing padding before it.
+	res := []byte{0x01, 0x01, 0, 20, 0x21, 0x12, 0xA4, 0x42}
+	res = append(res, txID[:]...)
+	res = append(res, 0x80, 0x22, 0, 3, 'x', 'k', '9', 0)
+	res = append(res, 0, 0x01, 0, 8, 0, 0x01, 0x1F, 0x90, 203, 0, 113, 7)
+	got, err := parseSTUNResponse(res, txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := netip.MustParseAddrPort("203.0.113.7:8080"); got.mapped != want {
+		t.Errorf("mapped = %s, want %s", got.mapped, want)
+	}
+	if _, err := parseSTUNResponse(res, [12]byte{}); err == nil {
+		t.Error("parseSTUNResponse accepted another transaction")
+	}
+}
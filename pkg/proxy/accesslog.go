@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// AccessLogFileName is the access log of the proxy in the data directory.
+const AccessLogFileName = "proxy-access.log"
+
+// DefaultAccessLogPath returns the access log of the proxy of the selected profile.
+func DefaultAccessLogPath() (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, AccessLogFileName), nil
+}
+
+// AccessLog appends the connections a proxy relays to a file, one JSON
+// protocol.AccessEntry per line. Once the file reaches MaxSize it is renamed to
+// <path>.1, the previous <path>.1 to <path>.2 and so on, keeping Backups of them.
+type AccessLog struct {
+	path    string
+	maxSize int64
+	backups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenAccessLog opens the access log at path for appending. maxSize is in bytes;
+// 0 never rotates the file.
+func OpenAccessLog(path string, maxSize int64, backups int) (*AccessLog, error) {
+	l := &AccessLog{path: path, maxSize: maxSize, backups: backups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *AccessLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// Recorder returns a recorder writing the entries of an instance whose outbound
+// connects through exit.
+func (l *AccessLog) Recorder(exit string) protocol.AccessRecorder {
+	return func(e protocol.AccessEntry) {
+		e.Exit = exit
+		l.Write(e)
+	}
+}
+
+// Write appends e to the log, rotating it first when it is full.
+func (l *AccessLog) Write(e protocol.AccessEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups up by one and starts a new file.
+func (l *AccessLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if l.backups < 1 {
+		os.Remove(l.path)
+	} else {
+		for i := l.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate access log: %w", err)
+		}
+	}
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *AccessLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// ReadAccessLog returns the last n entries of the access log at path (all of
+// them when n <= 0), skipping lines that aren't entries.
+func ReadAccessLog(path string, n int) ([]protocol.AccessEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, _, err := ReadAccessEntries(f)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+// ReadAccessEntries decodes the complete lines of r. read is how many bytes they
+// took, so a follower can resume after them once the last line is finished.
+func ReadAccessEntries(r io.Reader) (entries []protocol.AccessEntry, read int64, err error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return entries, read, nil
+		}
+		if err != nil {
+			return entries, read, err
+		}
+		read += int64(len(line))
+		var e protocol.AccessEntry
+		if json.Unmarshal(line, &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+)
+
+func TestAccessLog_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AccessLogFileName)
+	l, err := OpenAccessLog(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := l.Recorder("de-1 (1.2.3.4:443)")
+	for i := 0; i < 10; i++ {
+		rec(protocol.AccessEntry{Network: "tcp", Destination: "example.com:443", Outbound: "proxy", Up: int64(i)})
+	}
+	l.Close()
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%s is %d bytes, over the 300 byte limit", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more than 2 backups")
+	}
+
+	entries, err := ReadAccessLog(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Up != 9 || entries[0].Exit != "de-1 (1.2.3.4:443)" {
+		t.Errorf("last entry = %+v, want the 10th with its exit", entries)
+	}
+}
@@ -3,7 +3,8 @@ package netns
 import (
 	"encoding/json"
 	"os"
-	"path/filepath"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
 // State is persisted to disk so a subsequent launch can clean up
@@ -15,15 +16,7 @@ type State struct {
 }
 
 func stateFilePath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(home, ".xray-knife")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, ".netns-state.json"), nil
+	return utils.StateFile(".netns-state.json")
 }
 
 // SaveState persists the namespace state to disk for crash recovery.
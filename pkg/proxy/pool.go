@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	pkgsingbox "github.com/lilendian0x00/xray-knife/v9/pkg/core/singbox"
+	pkgxray "github.com/lilendian0x00/xray-knife/v9/pkg/core/xray"
+)
+
+// PoolConfig holds the settings of a proxy pool.
+type PoolConfig struct {
+	CoreType   string // xray, sing-box, or auto to pick the core per config
+	ListenAddr string
+	BasePort   int // the first config listens on BasePort, the next on BasePort+1, ...
+	// Username and Password protect every inbound when set.
+	Username    string
+	Password    string
+	InsecureTLS bool
+	Verbose     bool
+}
+
+// PoolMember is a config served on a SOCKS inbound of its own.
+type PoolMember struct {
+	Port   int
+	Link   string
+	Config protocol.GeneralConfig
+	// Err is why the config isn't served, nil when it is.
+	Err error
+
+	instance protocol.Instance
+}
+
+// Pool serves many configs at once, each behind its own local SOCKS port, for
+// clients that want many distinct exits in parallel.
+type Pool struct {
+	Members []*PoolMember
+}
+
+// StartPool starts one core instance per link, link i listening on BasePort+i.
+// A link that fails to start keeps its port unused and its error in Err; StartPool
+// fails only when none started.
+func StartPool(cfg PoolConfig, links []string) (*Pool, error) {
+	switch cfg.CoreType {
+	case "xray", "sing-box", "auto":
+	default:
+		return nil, fmt.Errorf("allowed core types: (auto, xray, sing-box), got: %s", cfg.CoreType)
+	}
+	if cfg.BasePort < 1 || cfg.BasePort+len(links)-1 > 65535 {
+		return nil, fmt.Errorf("ports %d-%d are out of range", cfg.BasePort, cfg.BasePort+len(links)-1)
+	}
+
+	p := &Pool{}
+	started := 0
+	for i, link := range links {
+		m := &PoolMember{Port: cfg.BasePort + i, Link: link}
+		m.Err = m.start(cfg)
+		if m.Err == nil {
+			started++
+		}
+		p.Members = append(p.Members, m)
+	}
+	if started == 0 && len(links) > 0 {
+		return nil, fmt.Errorf("no config of the pool could be started: %w", p.Members[0].Err)
+	}
+	return p, nil
+}
+
+// start serves the member's link on its port. With the auto core, links xray
+// can't handle go to sing-box.
+func (m *PoolMember) start(cfg PoolConfig) error {
+	coreTypes := []string{cfg.CoreType}
+	if cfg.CoreType == "auto" {
+		coreTypes = []string{"xray", "sing-box"}
+	}
+	var c core.Core
+	var outbound protocol.Protocol
+	var err error
+	for _, t := range coreTypes {
+		if c, err = poolMemberCore(cfg, t, m.Port); err != nil {
+			return err
+		}
+		if outbound, err = c.CreateProtocol(m.Link); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := outbound.Parse(); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	m.Config = outbound.ConvertToGeneralConfig()
+
+	instance, err := c.MakeInstance(context.Background(), outbound)
+	if err != nil {
+		return fmt.Errorf("error making instance: %w", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return fmt.Errorf("error starting instance: %w", err)
+	}
+	m.instance = instance
+	return nil
+}
+
+// poolMemberCore returns a core of type t whose inbound is a SOCKS server on port.
+func poolMemberCore(cfg PoolConfig, t string, port int) (core.Core, error) {
+	var c core.Core
+	var inbound protocol.Protocol
+	if t == "xray" {
+		c = core.CoreFactory(core.XrayCoreType, cfg.InsecureTLS, cfg.Verbose)
+		inbound = &pkgxray.Socks{Remark: "Listener", Address: cfg.ListenAddr, Port: strconv.Itoa(port), Username: cfg.Username, Password: cfg.Password}
+	} else {
+		c = core.CoreFactory(core.SingboxCoreType, cfg.InsecureTLS, cfg.Verbose)
+		inbound = &pkgsingbox.Socks{Remark: "Listener", Address: cfg.ListenAddr, Port: strconv.Itoa(port), Username: cfg.Username, Password: cfg.Password}
+	}
+	if err := c.SetInbound(inbound); err != nil {
+		return nil, fmt.Errorf("failed to set inbound: %w", err)
+	}
+	return c, nil
+}
+
+// Close stops every instance of the pool.
+func (p *Pool) Close() error {
+	var errs []error
+	for _, m := range p.Members {
+		if m.instance != nil {
+			errs = append(errs, m.instance.Close())
+			m.instance = nil
+		}
+	}
+	return errors.Join(errs...)
+}
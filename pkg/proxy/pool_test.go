@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStartPool(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	pool, err := StartPool(PoolConfig{CoreType: "xray", ListenAddr: "127.0.0.1", BasePort: base}, []string{
+		"socks://127.0.0.1:1#first",
+		"not a config link",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if len(pool.Members) != 2 {
+		t.Fatalf("%d members, want 2", len(pool.Members))
+	}
+	first, second := pool.Members[0], pool.Members[1]
+	if first.Err != nil || first.Port != base || first.Config.Remark != "first" {
+		t.Errorf("first member: port %d, remark %q, err %v", first.Port, first.Config.Remark, first.Err)
+	}
+	if second.Err == nil || second.Port != base+1 {
+		t.Errorf("second member: port %d, err %v; want a parse error on the next port", second.Port, second.Err)
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(base)), time.Second)
+	if err != nil {
+		t.Fatalf("first member is not listening: %v", err)
+	}
+	conn.Close()
+
+	if _, err := StartPool(PoolConfig{CoreType: "xray", ListenAddr: "127.0.0.1", BasePort: base}, []string{"not a config link"}); err == nil {
+		t.Error("StartPool succeeded without any config starting")
+	}
+}
@@ -0,0 +1,402 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// Rotation policies of a Rotator.
+const (
+	RotatePerConnection = "conn"     // every connection leaves through the next exit
+	RotatePerRequests   = "requests" // every RotatorConfig.Every connections
+	RotatePerInterval   = "interval" // every RotatorConfig.Interval
+)
+
+// RotatorConfig holds the settings of a Rotator.
+type RotatorConfig struct {
+	Policy   string
+	Every    int           // connections per exit with RotatePerRequests
+	Interval time.Duration // time per exit with RotatePerInterval
+	// Sticky sends the connections to a destination host through the exit the
+	// host last used, until it goes StickyTTL without a connection.
+	Sticky    bool
+	StickyTTL time.Duration
+	// Username and Password are required from clients when set, and used to
+	// connect to the exits.
+	Username string
+	Password string
+	Verbose  bool
+}
+
+type stickyExit struct {
+	exit int
+	used time.Time
+}
+
+// Rotator is a SOCKS5 server balancing its connections over the SOCKS inbounds
+// of a pool: each CONNECT is forwarded to the exit the rotation policy picks.
+type Rotator struct {
+	cfg    RotatorConfig
+	exits  []string
+	logger *log.Logger
+
+	mu        sync.Mutex
+	current   int
+	served    int // connections the current exit took, with RotatePerRequests
+	switched  time.Time
+	sticky    map[string]stickyExit
+	lastSweep time.Time
+
+	listener net.Listener
+}
+
+// NewRotator returns a rotator over exits, the host:port addresses of SOCKS5 proxies.
+func NewRotator(cfg RotatorConfig, exits []string, logger *log.Logger) (*Rotator, error) {
+	switch cfg.Policy {
+	case RotatePerConnection:
+	case RotatePerRequests:
+		if cfg.Every < 1 {
+			return nil, fmt.Errorf("the %s policy needs at least 1 request per exit", RotatePerRequests)
+		}
+	case RotatePerInterval:
+		if cfg.Interval <= 0 {
+			return nil, fmt.Errorf("the %s policy needs a positive interval", RotatePerInterval)
+		}
+	default:
+		return nil, fmt.Errorf("allowed rotation policies: (conn, requests, interval), got: %s", cfg.Policy)
+	}
+	if cfg.Sticky && cfg.StickyTTL <= 0 {
+		return nil, errors.New("sticky sessions need a positive TTL")
+	}
+	if len(exits) == 0 {
+		return nil, errors.New("no exit to rotate over")
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	return &Rotator{
+		cfg:      cfg,
+		exits:    exits,
+		logger:   logger,
+		sticky:   make(map[string]stickyExit),
+		switched: time.Now(),
+	}, nil
+}
+
+// PoolExits returns the addresses of the inbounds of the members of p that
+// started, for NewRotator.
+func PoolExits(p *Pool, listenAddr string) []string {
+	if listenAddr == "0.0.0.0" || listenAddr == "::" {
+		listenAddr = "127.0.0.1"
+	}
+	var exits []string
+	for _, m := range p.Members {
+		if m.Err == nil {
+			exits = append(exits, net.JoinHostPort(listenAddr, strconv.Itoa(m.Port)))
+		}
+	}
+	return exits
+}
+
+// Start listens on addr and serves clients until Close.
+func (r *Rotator) Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	r.listener = ln
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.handle(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr is the address the rotator listens on.
+func (r *Rotator) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Close stops accepting clients. Open connections run until either side closes.
+func (r *Rotator) Close() error {
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Close()
+}
+
+// pick returns the exit of a connection to host at now.
+func (r *Rotator) pick(host string, now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cfg.Sticky {
+		if now.Sub(r.lastSweep) >= r.cfg.StickyTTL {
+			for h, s := range r.sticky {
+				if now.Sub(s.used) >= r.cfg.StickyTTL {
+					delete(r.sticky, h)
+				}
+			}
+			r.lastSweep = now
+		}
+		if s, ok := r.sticky[host]; ok && now.Sub(s.used) < r.cfg.StickyTTL {
+			r.sticky[host] = stickyExit{exit: s.exit, used: now}
+			return s.exit
+		}
+	}
+
+	var exit int
+	switch r.cfg.Policy {
+	case RotatePerConnection:
+		exit = r.current
+		r.current = (r.current + 1) % len(r.exits)
+	case RotatePerRequests:
+		if r.served >= r.cfg.Every {
+			r.current = (r.current + 1) % len(r.exits)
+			r.served = 0
+		}
+		r.served++
+		exit = r.current
+	case RotatePerInterval:
+		if now.Sub(r.switched) >= r.cfg.Interval {
+			r.current = (r.current + 1) % len(r.exits)
+			r.switched = now
+		}
+		exit = r.current
+	}
+	if r.cfg.Sticky {
+		r.sticky[host] = stickyExit{exit: exit, used: now}
+	}
+	return exit
+}
+
+// SOCKS5 reply codes (RFC 1928).
+const (
+	socksSucceeded          = 0x00
+	socksGeneralFailure     = 0x01
+	socksHostUnreachable    = 0x04
+	socksCommandUnsupported = 0x07
+	socksAddressUnsupported = 0x08
+)
+
+// handle serves one client: the SOCKS5 handshake, then the CONNECT relayed
+// through the picked exit.
+func (r *Rotator) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := r.negotiate(conn); err != nil {
+		if r.cfg.Verbose {
+			r.logger.Printf("SOCKS handshake with %s failed: %v\n", conn.RemoteAddr(), err)
+		}
+		return
+	}
+	host, port, code, err := readConnectRequest(conn)
+	if err != nil {
+		if code != 0 {
+			writeReply(conn, code)
+		}
+		if r.cfg.Verbose {
+			r.logger.Printf("Bad SOCKS request from %s: %v\n", conn.RemoteAddr(), err)
+		}
+		return
+	}
+
+	exit := r.pick(host, time.Now())
+	var auth *xproxy.Auth
+	if r.cfg.Username != "" {
+		auth = &xproxy.Auth{User: r.cfg.Username, Password: r.cfg.Password}
+	}
+	forward := &exitDialer{Dialer: net.Dialer{Timeout: 10 * time.Second}}
+	dialer, err := xproxy.SOCKS5("tcp", r.exits[exit], auth, forward)
+	if err != nil {
+		writeReply(conn, socksGeneralFailure)
+		return
+	}
+	dest := net.JoinHostPort(host, strconv.Itoa(port))
+	upstream, err := dialer.Dial("tcp", dest)
+	if err != nil {
+		writeReply(conn, socksHostUnreachable)
+		if r.cfg.Verbose {
+			r.logger.Printf("Connecting to %s through %s failed: %v\n", dest, r.exits[exit], err)
+		}
+		return
+	}
+	defer upstream.Close()
+	if r.cfg.Verbose {
+		r.logger.Printf("%s -> %s via %s\n", conn.RemoteAddr(), dest, r.exits[exit])
+	}
+	if err := writeReply(conn, socksSucceeded); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	relay(conn, upstream, forward.conn)
+}
+
+// exitDialer dials the exit and keeps its TCP connection, which the SOCKS dialer
+// wraps, so relay can half-close it.
+type exitDialer struct {
+	net.Dialer
+	conn net.Conn
+}
+
+func (d *exitDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	c, err := d.Dialer.DialContext(ctx, network, addr)
+	d.conn = c
+	return c, err
+}
+
+func (d *exitDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// relay copies between conn and upstream until both directions are done. The side
+// that finishes sending first is half-closed on the other connection, so a client
+// that shuts its write side after the request still gets the whole response.
+// exit is the connection upstream runs over.
+func relay(conn, upstream, exit net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, conn)
+		closeWrite(exit)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, upstream)
+		closeWrite(conn)
+	}()
+	wg.Wait()
+}
+
+// closeWrite half-closes c, or closes it when it can't be half-closed.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	c.Close()
+}
+
+// negotiate picks the authentication method, checking the client's credentials
+// when the rotator requires them.
+func (r *Rotator) negotiate(conn net.Conn) error {
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return err
+	}
+	if head[0] != 0x05 {
+		return fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	want := byte(0x00)
+	if r.cfg.Username != "" {
+		want = 0x02
+	}
+	offered := false
+	for _, m := range methods {
+		offered = offered || m == want
+	}
+	if !offered {
+		conn.Write([]byte{0x05, 0xff})
+		return errors.New("no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{0x05, want}); err != nil {
+		return err
+	}
+	if want == 0x00 {
+		return nil
+	}
+
+	// RFC 1929 username/password
+	var ver [1]byte
+	if _, err := io.ReadFull(conn, ver[:]); err != nil {
+		return err
+	}
+	user, err := readLenPrefixed(conn)
+	if err != nil {
+		return err
+	}
+	pass, err := readLenPrefixed(conn)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(user, []byte(r.cfg.Username)) != 1 || subtle.ConstantTimeCompare(pass, []byte(r.cfg.Password)) != 1 {
+		conn.Write([]byte{0x01, 0x01})
+		return errors.New("wrong credentials")
+	}
+	_, err = conn.Write([]byte{0x01, 0x00})
+	return err
+}
+
+// readConnectRequest reads a CONNECT request. On failure, code is the reply
+// to send, or 0 when the client is gone.
+func readConnectRequest(conn net.Conn) (host string, port int, code byte, err error) {
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return "", 0, 0, err
+	}
+	if head[1] != 0x01 {
+		return "", 0, socksCommandUnsupported, fmt.Errorf("unsupported command %d", head[1])
+	}
+	switch head[3] {
+	case 0x01, 0x04:
+		ip := make(net.IP, 4)
+		if head[3] == 0x04 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", 0, 0, err
+		}
+		host = ip.String()
+	case 0x03:
+		name, err := readLenPrefixed(conn)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		host = string(name)
+	default:
+		return "", 0, socksAddressUnsupported, fmt.Errorf("unsupported address type %d", head[3])
+	}
+	var p [2]byte
+	if _, err := io.ReadFull(conn, p[:]); err != nil {
+		return "", 0, 0, err
+	}
+	return host, int(binary.BigEndian.Uint16(p[:])), 0, nil
+}
+
+func readLenPrefixed(conn net.Conn) ([]byte, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(conn, n[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n[0])
+	_, err := io.ReadFull(conn, b)
+	return b, err
+}
+
+func writeReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{0x05, code, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRotatorPick(t *testing.T) {
+	exits := []string{"a:1", "b:1", "c:1"}
+	start := time.Now()
+	tests := []struct {
+		name  string
+		cfg   RotatorConfig
+		hosts []string
+		at    []time.Duration
+		want  []int
+	}{
+		{
+			name:  "per connection",
+			cfg:   RotatorConfig{Policy: RotatePerConnection},
+			hosts: []string{"x", "x", "x", "x"},
+			want:  []int{0, 1, 2, 0},
+		},
+		{
+			name:  "per 2 requests",
+			cfg:   RotatorConfig{Policy: RotatePerRequests, Every: 2},
+			hosts: []string{"x", "x", "x", "x", "x"},
+			want:  []int{0, 0, 1, 1, 2},
+		},
+		{
+			name:  "per interval",
+			cfg:   RotatorConfig{Policy: RotatePerInterval, Interval: time.Minute},
+			hosts: []string{"x", "x", "x", "x"},
+			at:    []time.Duration{0, 30 * time.Second, 61 * time.Second, 90 * time.Second},
+			want:  []int{0, 0, 1, 1},
+		},
+		{
+			name:  "sticky hosts",
+			cfg:   RotatorConfig{Policy: RotatePerConnection, Sticky: true, StickyTTL: time.Minute},
+			hosts: []string{"x", "y", "x", "z", "y", "x"},
+			at:    []time.Duration{0, 0, 0, 0, 0, 2 * time.Minute},
+			want:  []int{0, 1, 0, 2, 1, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRotator(tt.cfg, exits, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.switched = start
+			for i, host := range tt.hosts {
+				now := start
+				if tt.at != nil {
+					now = start.Add(tt.at[i])
+				}
+				if got := r.pick(host, now); got != tt.want[i] {
+					t.Errorf("connection %d to %s went to exit %d, want %d", i, host, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := NewRotator(RotatorConfig{Policy: "random"}, exits, nil); err == nil {
+		t.Error("NewRotator accepted an unknown policy")
+	}
+}
+
+// echoExit is a SOCKS5 proxy that accepts any CONNECT and answers it itself: it
+// reads the request until the client half-closes, then replies "pong:<request>".
+func echoExit(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				head := make([]byte, 3)
+				if _, err := io.ReadFull(c, head); err != nil {
+					return
+				}
+				c.Write([]byte{0x05, 0x00})
+				// CONNECT to an IPv4 address: VER CMD RSV ATYP ADDR(4) PORT(2).
+				req := make([]byte, 10)
+				if _, err := io.ReadFull(c, req); err != nil {
+					return
+				}
+				c.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				body, _ := io.ReadAll(c)
+				c.Write(append([]byte("pong:"), body...))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRotatorHalfClose(t *testing.T) {
+	r, err := NewRotator(RotatorConfig{Policy: RotatePerConnection}, []string{echoExit(t)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	c, err := net.Dial("tcp", r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte{0x05, 0x01, 0x00})
+	if _, err := io.ReadFull(c, make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	c.Write([]byte{0x05, 0x01, 0x00, 0x01, 192, 0, 2, 1, 0, 80})
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(c, reply); err != nil || reply[1] != 0x00 {
+		t.Fatalf("CONNECT reply %v, %v", reply, err)
+	}
+
+	// The client sends its request and shuts its write side, as `nc -N` does.
+	c.Write([]byte("ping"))
+	c.(*net.TCPConn).CloseWrite()
+	got, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "pong:ping" {
+		t.Errorf("response = %q, want the whole reply after the half-close", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	osexec "os/exec"
@@ -16,7 +17,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/fatih/color"
 
 	"github.com/lilendian0x00/xray-knife/v9/database"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
@@ -70,6 +70,14 @@ type Config struct {
 	ChainFile           string `json:"chainFile"`           // file with fixed chain links (one per line)
 	ChainHops           uint8  `json:"chainHops"`           // number of hops when selecting from pool
 	ChainRotation       string `json:"chainRotation"`       // none, exit, full
+	Outbound            string `json:"outbound"`            // direct or block: route locally instead of through a config
+	BlockRules          string `json:"blockRules"`          // comma-separated destinations the local outbound drops
+	AllowRules          string `json:"allowRules"`          // comma-separated destinations the local outbound sends direct
+	IPVersion           string `json:"ipVersion"`           // 4 or 6: dial config servers over this address family only
+	Dial                protocol.DialOptions `json:"dial"`   // socket options injected into every outbound
+	AccessLog           string `json:"accessLog"`           // file recording the proxied connections ("" = off)
+	AccessLogMaxSize    uint32 `json:"accessLogMaxSize"`    // MB before the access log is rotated (0 = never)
+	AccessLogBackups    uint16 `json:"accessLogBackups"`    // rotated access logs to keep
 	ConfigLinks         []string
 }
 
@@ -109,6 +117,7 @@ type Service struct {
 	nsTunnel          protocol.Instance  // the sing-box tunnel inside the namespace
 	proxyReady        chan struct{}       // closed when the first proxy instance starts
 	proxyReadyOnce    sync.Once
+	accessLog         *AccessLog         // nil unless Config.AccessLog is set
 }
 
 func New(config Config, logger *log.Logger) (*Service, error) {
@@ -150,8 +159,20 @@ func New(config Config, logger *log.Logger) (*Service, error) {
 		proxyReady:     make(chan struct{}),
 	}
 
+	if config.Outbound != "" {
+		if config.CoreType != "xray" {
+			return nil, errors.New("--outbound requires the xray core")
+		}
+		if config.Chain {
+			return nil, errors.New("--outbound cannot be combined with --chain")
+		}
+		s.config.ConfigLinks = nil
+	} else if s.config.BlockRules != "" || s.config.AllowRules != "" {
+		return nil, errors.New("--block and --allow require --outbound")
+	}
+
 	// If no config links are provided via flags, fetch them from the database.
-	if len(s.config.ConfigLinks) == 0 {
+	if len(s.config.ConfigLinks) == 0 && config.Outbound == "" {
 		s.logf(customlog.Processing, "No config links provided, fetching from database...\n")
 		dbLinks, err := database.GetConfigsForProxy()
 		if err != nil {
@@ -180,6 +201,29 @@ func New(config Config, logger *log.Logger) (*Service, error) {
 		return nil, fmt.Errorf("allowed core types: (xray, sing-box), got: %s", config.CoreType)
 	}
 
+	if config.IPVersion != "" {
+		versions, err := core.ParseIPVersion(config.IPVersion)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(versions) > 1:
+			return nil, errors.New("--ip-version both only applies to tests; use 4 or 6 with proxy")
+		case config.Chain || config.Outbound != "":
+			return nil, errors.New("--ip-version cannot be combined with --chain or --outbound")
+		}
+		s.core.(core.IPVersionCore).SetIPVersion(versions[0])
+	}
+	if !config.Dial.IsZero() {
+		if err := config.Dial.Validate(); err != nil {
+			return nil, err
+		}
+		if config.IPVersion != "" && config.Dial.DomainStrategy != "" && config.Dial.DomainStrategy != protocol.DomainStrategyAsIs {
+			return nil, errors.New("--domain-strategy cannot be combined with --ip-version")
+		}
+		s.core.(core.DialOptionsCore).SetDialOptions(config.Dial)
+	}
+
 	inbound, err := s.createInbound()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create inbound: %w", err)
@@ -195,10 +239,19 @@ func New(config Config, logger *log.Logger) (*Service, error) {
 		g := inbound.ConvertToGeneralConfig()
 		s.logger.Printf("Protocol: %s\nListen: %s:%s\nLink: %s\n", g.Protocol, g.Address, g.Port, g.OrigLink)
 	} else {
-		fmt.Printf("\n%v%s: %v\n", inbound.DetailsStr(), color.RedString("Link"), inbound.GetLink())
+		fmt.Printf("\n%v%s: %v\n", inbound.DetailsStr(), customlog.GetColor(customlog.Label, "Link"), inbound.GetLink())
 	}
 	s.logf(customlog.Info, "============================\n\n")
 
+	if config.AccessLog != "" {
+		l, err := OpenAccessLog(config.AccessLog, int64(config.AccessLogMaxSize)<<20, int(config.AccessLogBackups))
+		if err != nil {
+			return nil, err
+		}
+		s.accessLog = l
+		s.logf(customlog.Info, "Logging proxied connections to %s\n", config.AccessLog)
+	}
+
 	// If system mode, configure the OS to route traffic through our local SOCKS proxy.
 	if config.Mode == "system" {
 		mgr, err := sysproxy.New()
@@ -260,6 +313,15 @@ func (s *Service) ConfigCount() int {
 	return len(s.config.ConfigLinks)
 }
 
+// localOutbound builds the direct/block router used instead of a remote config.
+func (s *Service) localOutbound() (protocol.Protocol, error) {
+	r := pkgxray.NewRouter(s.config.Outbound, splitRules(s.config.BlockRules), splitRules(s.config.AllowRules))
+	if err := r.Parse(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // logf is a helper to direct logs to either the web logger or the CLI customlog.
 func (s *Service) logf(logType customlog.Type, format string, v ...interface{}) {
 	if s.logger != nil {
@@ -328,6 +390,27 @@ func (s *Service) Close() {
 		sysproxy.ClearState()
 		s.sysProxyManager = nil
 	}
+
+	if s.accessLog != nil {
+		s.accessLog.Close()
+		s.accessLog = nil
+	}
+}
+
+// withAccessLog returns ctx making the instances built with it log their
+// connections as leaving through exit, when the access log is on.
+func (s *Service) withAccessLog(ctx context.Context, exit protocol.Protocol) context.Context {
+	if s.accessLog == nil {
+		return ctx
+	}
+	var name string
+	if g := exit.ConvertToGeneralConfig(); g.Address != "" {
+		name = net.JoinHostPort(g.Address, g.Port)
+		if g.Remark != "" {
+			name = g.Remark + " (" + name + ")"
+		}
+	}
+	return protocol.WithAccessRecorder(ctx, s.accessLog.Recorder(name))
 }
 
 // signalProxyReady is called once after the first proxy instance is started
@@ -392,7 +475,7 @@ func (s *Service) setupAppMode(ctx context.Context) error {
 
 // Run blocks until the context is canceled, running either single or rotation mode.
 func (s *Service) Run(ctx context.Context, forceRotate <-chan struct{}) error {
-	if len(s.config.ConfigLinks) == 0 {
+	if len(s.config.ConfigLinks) == 0 && s.config.Outbound == "" {
 		return errors.New("no configuration links provided")
 	}
 
@@ -404,11 +487,24 @@ func (s *Service) Run(ctx context.Context, forceRotate <-chan struct{}) error {
 		return s.runChainMode(ctx, forceRotate)
 	}
 
-	if len(s.config.ConfigLinks) == 1 {
+	return s.runProxy(ctx, forceRotate)
+}
+
+// runProxy serves the inbound through the local outbound, the single config, or a
+// rotating pool of configs.
+func (s *Service) runProxy(ctx context.Context, forceRotate <-chan struct{}) error {
+	switch {
+	case s.config.Outbound != "":
+		outbound, err := s.localOutbound()
+		if err != nil {
+			return err
+		}
+		return s.runOutbound(ctx, outbound, "")
+	case len(s.config.ConfigLinks) == 1:
 		return s.runSingleMode(ctx, s.config.ConfigLinks[0])
+	default:
+		return s.runRotationMode(ctx, forceRotate)
 	}
-
-	return s.runRotationMode(ctx, forceRotate)
 }
 
 // runAppMode starts the proxy in a goroutine, waits for it to be ready,
@@ -422,11 +518,7 @@ func (s *Service) runAppMode(ctx context.Context, forceRotate <-chan struct{}) e
 	// Run the underlying proxy (single or rotation) in a goroutine.
 	errCh := make(chan error, 1)
 	go func() {
-		if len(s.config.ConfigLinks) == 1 {
-			errCh <- s.runSingleMode(runCtx, s.config.ConfigLinks[0])
-		} else {
-			errCh <- s.runRotationMode(runCtx, forceRotate)
-		}
+		errCh <- s.runProxy(runCtx, forceRotate)
 	}()
 
 	// Wait for the proxy to start listening.
@@ -476,7 +568,18 @@ func (s *Service) runSingleMode(ctx context.Context, link string) error {
 	if err := outbound.Parse(); err != nil {
 		return fmt.Errorf("failed to parse single outbound config: %w", err)
 	}
+	return s.runOutbound(ctx, outbound, link)
+}
+
+func splitRules(rules string) []string {
+	if rules == "" {
+		return nil
+	}
+	return strings.Split(rules, ",")
+}
 
+// runOutbound serves the inbound through a single, already parsed outbound until ctx is done.
+func (s *Service) runOutbound(ctx context.Context, outbound protocol.Protocol, link string) error {
 	s.mu.Lock()
 	s.activeOutbound = &pkghttp.Result{ConfigLink: link, Protocol: outbound}
 	s.mu.Unlock()
@@ -485,12 +588,14 @@ func (s *Service) runSingleMode(ctx context.Context, link string) error {
 	if s.logger != nil {
 		g := outbound.ConvertToGeneralConfig()
 		s.logger.Printf("Protocol: %s\nRemark: %s\nAddr: %s:%s\nLink: %s\n", g.Protocol, g.Remark, g.Address, g.Port, g.OrigLink)
+	} else if outbound.GetLink() == "" {
+		fmt.Printf("\n%v\n", outbound.DetailsStr())
 	} else {
-		fmt.Printf("\n%v%s: %v\n", outbound.DetailsStr(), color.RedString("Link"), outbound.GetLink())
+		fmt.Printf("\n%v%s: %v\n", outbound.DetailsStr(), customlog.GetColor(customlog.Label, "Link"), outbound.GetLink())
 	}
 	s.logf(customlog.Info, "============================\n")
 
-	instance, err := s.core.MakeInstance(context.Background(), outbound)
+	instance, err := s.core.MakeInstance(s.withAccessLog(context.Background(), outbound), outbound)
 	if err != nil {
 		return fmt.Errorf("error making instance: %w", err)
 	}
@@ -756,7 +861,7 @@ func (s *Service) findAndStartWorkingConfig(
 			}
 			s.logf(customlog.Info, "============================\n")
 
-			instance, err := s.core.MakeInstance(context.Background(), res.Protocol)
+			instance, err := s.core.MakeInstance(s.withAccessLog(context.Background(), res.Protocol), res.Protocol)
 			if err != nil {
 				s.logf(customlog.Failure, "Error making core instance with '%s': %v\n", res.ConfigLink, err)
 				continue
@@ -838,6 +943,9 @@ func (s *Service) chainHealthCheck(ctx context.Context) bool {
 
 // makeChainedInstance delegates to the concrete core's MakeChainedInstance.
 func (s *Service) makeChainedInstance(ctx context.Context, hops []protocol.Protocol) (protocol.Instance, error) {
+	if len(hops) > 0 {
+		ctx = s.withAccessLog(ctx, hops[len(hops)-1])
+	}
 	switch c := s.core.(type) {
 	case *pkgxray.Core:
 		return c.MakeChainedInstance(ctx, hops)
@@ -1337,6 +1445,8 @@ func (s *Service) createExaminer() (*pkghttp.Examiner, error) {
 		TestEndpointHttpMethod: "GET",
 		DoSpeedtest:            false,
 		DoIPInfo:               true,
+		IPVersion:              s.config.IPVersion,
+		Dial:                   s.config.Dial,
 	})
 }
 
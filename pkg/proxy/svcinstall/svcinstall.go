@@ -0,0 +1,125 @@
+// Package svcinstall installs the proxy command as an OS-managed service
+// (a systemd unit on Linux, a service control manager entry on Windows) so
+// the rotating proxy keeps running across reboots.
+package svcinstall
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// DefaultName is the service name used when none is given.
+const DefaultName = "xray-knife-proxy"
+
+// ErrNotSupported is returned on platforms without a service backend.
+var ErrNotSupported = errors.New("service installation is only supported on Linux (systemd) and Windows")
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]*$`)
+
+// Options describes the service to install.
+type Options struct {
+	// Name is the service/unit name (without the .service suffix).
+	Name string
+	// Description is shown by systemctl / services.msc.
+	Description string
+	// Executable is the absolute path to the xray-knife binary.
+	// Empty means the currently running executable.
+	Executable string
+	// Args are the arguments passed to the executable, e.g. ["proxy", "--rotate", "600"].
+	Args []string
+	// User installs a per-user service (systemd --user). Ignored on Windows.
+	User bool
+	// NoStart only installs and enables the service without starting it.
+	NoStart bool
+	// DataDir is the data directory the service is pinned to with --data-dir.
+	// Empty means the one of the installing user, since a service may run as
+	// another user or with another environment. It is ignored when Args
+	// already set --data-dir.
+	DataDir string
+}
+
+// normalize fills in defaults and validates the options.
+func (o *Options) normalize() error {
+	if o.Name == "" {
+		o.Name = DefaultName
+	}
+	if !validName.MatchString(o.Name) {
+		return fmt.Errorf("invalid service name %q", o.Name)
+	}
+	if o.Description == "" {
+		o.Description = "xray-knife rotating proxy"
+	}
+	if o.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("could not determine executable path: %w", err)
+		}
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		o.Executable = exe
+	}
+	if hasFlag(o.Args, "--data-dir") {
+		// The data directory the user passed wins over the installer's.
+		return nil
+	}
+	if o.DataDir == "" {
+		dir, err := utils.BaseDir()
+		if err != nil {
+			return err
+		}
+		o.DataDir = dir
+	}
+	// --data-dir is a global flag, so it can go before the command.
+	o.Args = append([]string{"--data-dir", o.DataDir}, o.Args...)
+	return nil
+}
+
+// hasFlag reports whether args set the long flag name, as "name value" or
+// "name=value".
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Preview returns the service definition that Install would create,
+// without touching the system.
+func Preview(opts Options) (string, error) {
+	if err := opts.normalize(); err != nil {
+		return "", err
+	}
+	return preview(opts)
+}
+
+// Install writes and registers the service, enables it at boot and,
+// unless NoStart is set, starts it right away.
+func Install(opts Options) error {
+	if err := opts.normalize(); err != nil {
+		return err
+	}
+	return install(opts)
+}
+
+// Uninstall stops and removes a previously installed service.
+func Uninstall(name string, user bool) error {
+	if name == "" {
+		name = DefaultName
+	}
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid service name %q", name)
+	}
+	return uninstall(name, user)
+}
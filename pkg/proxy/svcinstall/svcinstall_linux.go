@@ -0,0 +1,150 @@
+package svcinstall
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unitDir returns where the unit file lives for system or user services.
+func unitDir(user bool) (string, error) {
+	if !user {
+		return "/etc/systemd/system", nil
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+// systemdQuote quotes an argument for an ExecStart= line.
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$%") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`).Replace(s) + `"`
+}
+
+// renderUnit builds the systemd unit file contents.
+func renderUnit(opts Options) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine home directory: %w", err)
+	}
+
+	execLine := []string{systemdQuote(opts.Executable)}
+	for _, a := range opts.Args {
+		execLine = append(execLine, systemdQuote(a))
+	}
+
+	wantedBy := "multi-user.target"
+	if opts.User {
+		wantedBy = "default.target"
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", opts.Description)
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(execLine, " "))
+	// Paths given with ~ resolve from HOME; pin it to the installing user's home
+	// as the data directory is pinned with --data-dir.
+	fmt.Fprintf(&b, "Environment=HOME=%s\n", systemdQuote(home))
+	b.WriteString("StandardInput=null\n")
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+	b.WriteString("KillSignal=SIGTERM\n")
+	b.WriteString("TimeoutStopSec=30\n\n")
+	b.WriteString("[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=%s\n", wantedBy)
+	return b.String(), nil
+}
+
+func preview(opts Options) (string, error) {
+	dir, err := unitDir(opts.User)
+	if err != nil {
+		return "", err
+	}
+	unit, err := renderUnit(opts)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("# %s\n%s", filepath.Join(dir, opts.Name+".service"), unit), nil
+}
+
+func systemctl(user bool, args ...string) error {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func install(opts Options) error {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return fmt.Errorf("systemctl not found, is this a systemd system? %w", err)
+	}
+	if !opts.User && os.Geteuid() != 0 {
+		return fmt.Errorf("installing a system service requires root (use sudo, or --user for a per-user service)")
+	}
+
+	dir, err := unitDir(opts.User)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create unit directory: %w", err)
+	}
+	unit, err := renderUnit(opts)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, opts.Name+".service")
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return fmt.Errorf("could not write unit file: %w", err)
+	}
+
+	if err := systemctl(opts.User, "daemon-reload"); err != nil {
+		return err
+	}
+	enableArgs := []string{"enable"}
+	if !opts.NoStart {
+		enableArgs = append(enableArgs, "--now")
+	}
+	return systemctl(opts.User, append(enableArgs, opts.Name+".service")...)
+}
+
+func uninstall(name string, user bool) error {
+	dir, err := unitDir(user)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name+".service")
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %q is not installed: %w", name, err)
+	}
+	// Ignore the error: the unit may already be stopped/disabled.
+	_ = systemctl(user, "disable", "--now", name+".service")
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("could not remove unit file: %w", err)
+	}
+	return systemctl(user, "daemon-reload")
+}
+
+// RunAsService is a no-op on Linux; systemd runs the proxy as a normal process.
+func RunAsService(string, func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package svcinstall
+
+import "context"
+
+func preview(Options) (string, error) { return "", ErrNotSupported }
+func install(Options) error           { return ErrNotSupported }
+func uninstall(string, bool) error    { return ErrNotSupported }
+
+// RunAsService is a no-op on platforms without a service backend.
+func RunAsService(string, func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,27 @@
+package svcinstall
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeDataDir(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"default", []string{"proxy", "--rotate", "600"}, []string{"--data-dir", "/var/lib/xk", "proxy", "--rotate", "600"}},
+		{"user flag", []string{"proxy", "--data-dir", "/srv/xk"}, []string{"proxy", "--data-dir", "/srv/xk"}},
+		{"user flag with =", []string{"proxy", "--data-dir=/srv/xk"}, []string{"proxy", "--data-dir=/srv/xk"}},
+	}
+	for _, tt := range tests {
+		o := Options{Executable: "/usr/bin/xray-knife", Args: tt.args, DataDir: "/var/lib/xk"}
+		if err := o.normalize(); err != nil {
+			t.Fatalf("%s: normalize: %v", tt.name, err)
+		}
+		if !slices.Equal(o.Args, tt.want) {
+			t.Errorf("%s: Args = %q, want %q", tt.name, o.Args, tt.want)
+		}
+	}
+}
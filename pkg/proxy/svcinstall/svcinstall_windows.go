@@ -0,0 +1,131 @@
+package svcinstall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func preview(opts Options) (string, error) {
+	cmdline := []string{`"` + opts.Executable + `"`}
+	for _, a := range opts.Args {
+		if strings.ContainsAny(a, " \t\"") {
+			a = `"` + strings.ReplaceAll(a, `"`, `\"`) + `"`
+		}
+		cmdline = append(cmdline, a)
+	}
+	return fmt.Sprintf("Service name:  %s\nDisplay name:  %s\nStart type:    automatic\nCommand line:  %s\n",
+		opts.Name, opts.Description, strings.Join(cmdline, " ")), nil
+}
+
+func install(opts Options) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to the service manager (run as Administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(opts.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %q already exists", opts.Name)
+	}
+
+	s, err := m.CreateService(opts.Name, opts.Executable, mgr.Config{
+		DisplayName: opts.Name,
+		Description: opts.Description,
+		StartType:   mgr.StartAutomatic,
+	}, opts.Args...)
+	if err != nil {
+		return fmt.Errorf("could not create service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart the service if it exits unexpectedly.
+	_ = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	}, 60)
+
+	if opts.NoStart {
+		return nil
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("service created but could not be started: %w", err)
+	}
+	return nil
+}
+
+func uninstall(name string, _ bool) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to the service manager (run as Administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %q is not installed: %w", name, err)
+	}
+	defer s.Close()
+
+	// Ignore the error: the service may already be stopped.
+	_, _ = s.Control(svc.Stop)
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("could not delete service: %w", err)
+	}
+	return nil
+}
+
+// handler adapts a run function to the Windows service control manager.
+type handler struct {
+	run func(ctx context.Context) error
+	err error
+}
+
+func (h *handler) Execute(_ []string, r <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- h.run(ctx) }()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			h.err = err
+			if err != nil {
+				return false, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				h.err = <-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// RunAsService runs fn under the service control manager when the process
+// was started as a Windows service. It reports false when running interactively.
+func RunAsService(name string, fn func(ctx context.Context) error) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	h := &handler{run: fn}
+	if err := svc.Run(name, h); err != nil {
+		return true, err
+	}
+	return true, h.err
+}
@@ -3,7 +3,8 @@ package sysproxy
 import (
 	"encoding/json"
 	"os"
-	"path/filepath"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
 // Settings holds the previous OS proxy configuration so it can be restored.
@@ -24,15 +25,7 @@ type Manager interface {
 
 // stateFilePath returns the path where we save proxy state for crash recovery.
 func stateFilePath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(home, ".xray-knife")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, ".sysproxy-state.json"), nil
+	return utils.StateFile(".sysproxy-state.json")
 }
 
 // SaveState persists the previous OS proxy settings to disk for crash recovery.
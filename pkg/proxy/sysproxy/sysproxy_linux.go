@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
 type desktopEnv int
@@ -256,15 +257,7 @@ func kdeRead(kreadConfig, key string) string {
 }
 
 func envFilePath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(home, ".xray-knife")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, "proxy.env"), nil
+	return utils.StateFile("proxy.env")
 }
 
 func (m *linuxManager) writeEnvFile(addr, port string) error {
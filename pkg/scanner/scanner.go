@@ -169,7 +169,11 @@ func NewScannerService(config ScannerConfig, logger *log.Logger) (*ScannerServic
 			protocol.VmessIdentifier: s.xrayCore, protocol.VlessIdentifier: s.xrayCore,
 			protocol.ShadowsocksIdentifier: s.xrayCore, protocol.TrojanIdentifier: s.xrayCore,
 			protocol.SocksIdentifier: s.xrayCore, protocol.WireguardIdentifier: s.xrayCore,
+			protocol.Socks5Scheme: s.xrayCore, protocol.Socks5HScheme: s.xrayCore,
+			protocol.HTTPProxyIdentifier: s.xrayCore, protocol.HTTPSProxyScheme: s.xrayCore,
 			protocol.Hysteria2Identifier: s.singboxCore, "hy2": s.singboxCore,
+			protocol.NaiveHTTPSScheme: s.singboxCore, protocol.NaiveQUICScheme: s.singboxCore,
+			protocol.JuicityIdentifier: s.singboxCore, protocol.MieruIdentifier: s.singboxCore, "mierus": s.singboxCore,
 		}
 	}
 
@@ -0,0 +1,111 @@
+package score
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+// ConfigFileName is the name of the xray-knife config file in the data directory.
+const ConfigFileName = "xray-knife.conf"
+
+// DefaultRuns is how many of the latest test runs a score looks back on.
+const DefaultRuns = 10
+
+// Config is the scoring section of the config file:
+//
+//	# Rank for gaming: latency and stability first, speed barely counts.
+//	score.latency = 0.5
+//	score.jitter  = 0.3
+//	score.speed   = 0
+//	score.streak  = 0.2
+//	score.age     = 0
+//	score.runs    = 20
+//	score.hook    = python3 ~/.xray-knife/rescore.py
+//
+// Factors left out keep their default weight. Keys outside the score section
+// are ignored so the file can be shared with other settings.
+type Config struct {
+	Weights Weights
+	Runs    int
+	// Hook is a command re-scoring the ranked configs, "" for none (see RunHook).
+	Hook string
+}
+
+// DefaultConfig returns the scoring settings used without a config file.
+func DefaultConfig() Config {
+	return Config{Weights: DefaultWeights(), Runs: DefaultRuns}
+}
+
+// LoadProfileConfig reads the scoring settings from the config file in the data
+// directory of the profile.
+func LoadProfileConfig() (Config, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return DefaultConfig(), err
+	}
+	return LoadConfig(filepath.Join(dir, ConfigFileName))
+}
+
+// LoadConfig reads the scoring settings from the key=value config file at path.
+// A missing file yields the defaults.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		name, ok := strings.CutPrefix(strings.TrimSpace(key), "score.")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		if name == "hook" {
+			cfg.Hook = value
+			continue
+		}
+		if name == "runs" {
+			runs, err := strconv.Atoi(value)
+			if err != nil || runs < 1 {
+				return cfg, fmt.Errorf("%s:%d: score.runs must be a whole number >= 1", path, n)
+			}
+			cfg.Runs = runs
+			continue
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("%s:%d: invalid weight %q", path, n, value)
+		}
+		if err := cfg.Weights.Set(name, weight); err != nil {
+			return cfg, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Weights.Validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
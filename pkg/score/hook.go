@@ -0,0 +1,101 @@
+package score
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// HookTimeout is how long a scoring hook may run.
+const HookTimeout = 30 * time.Second
+
+// HookConfig is a ranked config as a scoring hook reads it.
+type HookConfig struct {
+	Link        string             `json:"link"`
+	Score       float64            `json:"score"`
+	Factors     map[string]float64 `json:"factors"`
+	MedianDelay int64              `json:"median_delay_ms"`
+	Jitter      float64            `json:"jitter_ms"`
+	Download    float64            `json:"download_mbps"`
+	Passed      int                `json:"passed"`
+	Tests       int                `json:"tests"`
+	Streak      int                `json:"streak"`
+	LastPass    time.Time          `json:"last_pass"`
+	Location    string             `json:"location,omitempty"` // exit country of the latest pass
+	IP          string             `json:"ip,omitempty"`       // exit IP of the latest pass
+}
+
+// HookVerdict is what a scoring hook decided about a config. Score replaces
+// the config's score when set, and Drop leaves the config out of the ranking.
+type HookVerdict struct {
+	Link  string   `json:"link"`
+	Score *float64 `json:"score,omitempty"`
+	Drop  bool     `json:"drop,omitempty"`
+	Note  string   `json:"note,omitempty"` // why, shown by 'subs best --explain'
+}
+
+type hookInput struct {
+	Weights map[string]float64 `json:"weights"`
+	Configs []HookConfig       `json:"configs"`
+}
+
+type hookOutput struct {
+	Configs []HookVerdict `json:"configs"`
+}
+
+// RunHook runs command, a shell command line, to post-process the scores of
+// configs: it reads {"weights": {...}, "configs": [HookConfig...]} as JSON on
+// stdin and writes {"configs": [HookVerdict...]} on stdout, e.g. to penalize
+// the exits of an ASN. Configs it leaves out keep their score. What it writes
+// on stderr is shown to the user. It returns the verdicts by link.
+func RunHook(ctx context.Context, command string, w Weights, configs []HookConfig) (map[string]HookVerdict, error) {
+	in := hookInput{Weights: make(map[string]float64, len(factorNames)), Configs: configs}
+	for _, name := range factorNames {
+		in.Weights[name] = w.Get(name)
+	}
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, HookTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(payload), &stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("scoring hook %q didn't finish within %s", command, HookTimeout)
+		}
+		return nil, fmt.Errorf("scoring hook %q failed: %w", command, err)
+	}
+
+	var out hookOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("scoring hook %q wrote invalid JSON: %w", command, err)
+	}
+	verdicts := make(map[string]HookVerdict, len(out.Configs))
+	for _, v := range out.Configs {
+		if strings.TrimSpace(v.Link) == "" {
+			return nil, errors.New("scoring hook returned a config without a link")
+		}
+		if v.Score != nil && (math.IsNaN(*v.Score) || math.IsInf(*v.Score, 0)) {
+			return nil, fmt.Errorf("scoring hook returned an invalid score for %s", v.Link)
+		}
+		verdicts[v.Link] = v
+	}
+	return verdicts, nil
+}
@@ -0,0 +1,212 @@
+// Package score ranks configs by their HTTP test history with a weighted formula.
+//
+// Each factor is normalized to 0..1 (1 is best) and the score is the weighted
+// mean of the factors, scaled to 0..100:
+//
+//	latency  median delay of the passed tests, 500/(500+ms)
+//	jitter   mean absolute deviation of those delays, 100/(100+ms), 0.5 until
+//	         two tests passed
+//	speed    mean download speed, mbps/(mbps+10)
+//	streak   consecutive passes up to the latest test, 1-0.5^n
+//	age      time since the latest pass, 24/(24+hours)
+package score
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weights are the relative weights of the scoring factors.
+type Weights struct {
+	Latency float64
+	Jitter  float64
+	Speed   float64
+	Streak  float64
+	Age     float64
+}
+
+// DefaultWeights favour fast, stable configs that keep passing.
+func DefaultWeights() Weights {
+	return Weights{Latency: 0.4, Jitter: 0.2, Speed: 0.1, Streak: 0.2, Age: 0.1}
+}
+
+// factorNames lists the factors in display order.
+var factorNames = []string{"latency", "jitter", "speed", "streak", "age"}
+
+// field returns the weight of the named factor.
+func (w *Weights) field(name string) *float64 {
+	switch name {
+	case "latency":
+		return &w.Latency
+	case "jitter":
+		return &w.Jitter
+	case "speed":
+		return &w.Speed
+	case "streak":
+		return &w.Streak
+	case "age":
+		return &w.Age
+	}
+	return nil
+}
+
+// Get returns the weight of the named factor, 0 for an unknown one.
+func (w Weights) Get(name string) float64 {
+	if f := w.field(name); f != nil {
+		return *f
+	}
+	return 0
+}
+
+// Set sets the weight of the named factor.
+func (w *Weights) Set(name string, value float64) error {
+	f := w.field(strings.ToLower(strings.TrimSpace(name)))
+	if f == nil {
+		return fmt.Errorf("unknown scoring factor %q (known: %s)", name, strings.Join(factorNames, ", "))
+	}
+	if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("weight of %s must be a number >= 0", name)
+	}
+	*f = value
+	return nil
+}
+
+// Parse applies a comma-separated list of factor=weight pairs, e.g. "latency=1,speed=0".
+func (w *Weights) Parse(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid weight %q, want factor=weight", pair)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight %q: %w", pair, err)
+		}
+		if err := w.Set(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that at least one factor counts.
+func (w Weights) Validate() error {
+	if w.sum() == 0 {
+		return fmt.Errorf("all scoring weights are 0")
+	}
+	return nil
+}
+
+func (w Weights) sum() float64 {
+	return w.Latency + w.Jitter + w.Speed + w.Streak + w.Age
+}
+
+// String formats the weights the way Parse reads them.
+func (w Weights) String() string {
+	parts := make([]string, len(factorNames))
+	for i, name := range factorNames {
+		parts[i] = name + "=" + strconv.FormatFloat(w.Get(name), 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Sample is the outcome of one test of a config.
+type Sample struct {
+	Passed       bool
+	Delay        int64   // ms
+	DownloadMbps float64 // 0 when not measured
+	At           time.Time
+}
+
+// Breakdown is a config's score with the inputs and normalized value of each factor.
+type Breakdown struct {
+	Tests  int // samples scored
+	Passed int // samples that passed
+
+	MedianDelay int64   // ms
+	Jitter      float64 // ms, mean absolute deviation of the delays
+	Download    float64 // mbps, mean of the measured speeds
+	Streak      int
+	LastPass    time.Time
+
+	// Factors holds each factor's normalized value (0..1) by name.
+	Factors map[string]float64
+	Total   float64 // 0..100
+}
+
+// Contribution returns how many of the total's points the named factor brought in.
+func (b Breakdown) Contribution(w Weights, name string) float64 {
+	sum := w.sum()
+	if sum == 0 {
+		return 0
+	}
+	return 100 * w.Get(name) * b.Factors[name] / sum
+}
+
+// Score rates a config by its samples, newest first. A config that never
+// passed scores 0.
+func Score(samples []Sample, w Weights, now time.Time) Breakdown {
+	b := Breakdown{Tests: len(samples), Factors: make(map[string]float64, len(factorNames))}
+
+	var delays []int64
+	var speedSum float64
+	var speeds int
+	streakOver := false
+	for _, s := range samples {
+		if !s.Passed {
+			streakOver = true
+			continue
+		}
+		if !streakOver {
+			b.Streak++
+		}
+		b.Passed++
+		delays = append(delays, s.Delay)
+		if s.DownloadMbps > 0 {
+			speedSum += s.DownloadMbps
+			speeds++
+		}
+		if s.At.After(b.LastPass) {
+			b.LastPass = s.At
+		}
+	}
+	if b.Passed == 0 {
+		return b
+	}
+
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	b.MedianDelay = delays[(len(delays)-1)/2]
+	for _, d := range delays {
+		b.Jitter += math.Abs(float64(d - b.MedianDelay))
+	}
+	b.Jitter /= float64(len(delays))
+	if speeds > 0 {
+		b.Download = speedSum / float64(speeds)
+	}
+
+	b.Factors["latency"] = 500 / (500 + float64(b.MedianDelay))
+	b.Factors["jitter"] = 0.5 // unknown from a single delay
+	if b.Passed > 1 {
+		b.Factors["jitter"] = 100 / (100 + b.Jitter)
+	}
+	b.Factors["speed"] = b.Download / (b.Download + 10)
+	b.Factors["streak"] = 1 - math.Pow(0.5, float64(b.Streak))
+	b.Factors["age"] = 24 / (24 + math.Max(now.Sub(b.LastPass).Hours(), 0))
+
+	for _, name := range factorNames {
+		b.Total += b.Contribution(w, name)
+	}
+	return b
+}
+
+// FactorNames returns the names of the scoring factors in display order.
+func FactorNames() []string {
+	return append([]string(nil), factorNames...)
+}
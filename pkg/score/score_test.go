@@ -0,0 +1,128 @@
+package score
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Now()
+	w := Weights{Latency: 1, Streak: 1}
+	samples := []Sample{
+		{Passed: true, Delay: 500, At: now},
+		{Passed: true, Delay: 300, At: now.Add(-time.Hour)},
+		{Passed: false, Delay: -1, At: now.Add(-2 * time.Hour)},
+		{Passed: true, Delay: 700, DownloadMbps: 10, At: now.Add(-3 * time.Hour)},
+	}
+	b := Score(samples, w, now)
+	if b.Tests != 4 || b.Passed != 3 || b.Streak != 2 || b.MedianDelay != 500 || b.Download != 10 {
+		t.Errorf("breakdown = %+v", b)
+	}
+	if !b.LastPass.Equal(now) {
+		t.Errorf("last pass = %v, want %v", b.LastPass, now)
+	}
+	// latency 500/(500+500) = 0.5, streak 1-0.5^2 = 0.75, equally weighted.
+	if math.Abs(b.Total-62.5) > 1e-9 {
+		t.Errorf("total = %v, want 62.5", b.Total)
+	}
+	if c := b.Contribution(w, "speed"); c != 0 {
+		t.Errorf("speed weighted 0 contributed %v", c)
+	}
+
+	if b := Score([]Sample{{Passed: false, Delay: -1, At: now}}, DefaultWeights(), now); b.Total != 0 || b.Passed != 0 {
+		t.Errorf("never passed: %+v", b)
+	}
+}
+
+func TestWeightsParse(t *testing.T) {
+	w := DefaultWeights()
+	if err := w.Parse("latency=1, Speed=0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Latency != 1 || w.Speed != 0.5 || w.Jitter != DefaultWeights().Jitter {
+		t.Errorf("weights = %+v", w)
+	}
+	for _, bad := range []string{"latency", "ping=1", "age=-1", "age=x"} {
+		if err := w.Parse(bad); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+
+	var zero Weights
+	if err := zero.Validate(); err == nil {
+		t.Error("all-zero weights were accepted")
+	}
+	var round Weights
+	if err := round.Parse(DefaultWeights().String()); err != nil || round != DefaultWeights() {
+		t.Errorf("String/Parse round trip = %+v, %v", round, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	if cfg, err := LoadConfig(path); err != nil || cfg != DefaultConfig() {
+		t.Errorf("missing file: %+v, %v", cfg, err)
+	}
+
+	data := "# gaming\nusername=admin\nscore.latency = 0.5\nscore.speed=0\nscore.runs = 20\nscore.hook = ./rescore --asn 13335\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Runs != 20 || cfg.Weights.Latency != 0.5 || cfg.Weights.Speed != 0 || cfg.Weights.Streak != DefaultWeights().Streak || cfg.Hook != "./rescore --asn 13335" {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	for _, bad := range []string{"score.runs = 0\n", "score.ping = 1\n", "score.latency=fast\n"} {
+		if err := os.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks of this test are sh scripts")
+	}
+	configs := []HookConfig{{Link: "vless://a", Score: 80, IP: "203.0.113.7"}, {Link: "vless://b", Score: 60}}
+
+	// The hook sees the configs and the weights on stdin.
+	dir := t.TempDir()
+	seen := filepath.Join(dir, "in.json")
+	hook := `cat > '` + seen + `'; echo '{"configs":[{"link":"vless://a","score":10,"note":"hosting ASN"},{"link":"vless://b","drop":true}]}'`
+	verdicts, err := RunHook(context.Background(), hook, DefaultWeights(), configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := verdicts["vless://a"]; v.Score == nil || *v.Score != 10 || v.Note != "hosting ASN" {
+		t.Errorf("verdict of a = %+v", v)
+	}
+	if !verdicts["vless://b"].Drop {
+		t.Errorf("b wasn't dropped")
+	}
+	in, err := os.ReadFile(seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(in), `"ip":"203.0.113.7"`) || !strings.Contains(string(in), `"weights":{`) {
+		t.Errorf("hook input = %s", in)
+	}
+
+	for _, bad := range []string{"exit 3", "echo not json", `echo '{"configs":[{"score":1}]}'`} {
+		if _, err := RunHook(context.Background(), bad, DefaultWeights(), configs); err == nil {
+			t.Errorf("hook %q was accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package settings reads and writes the general section of the xray-knife
+// config file: where the database lives and the defaults of the test flags.
+package settings
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
+)
+
+// Keys of the settings in the config file.
+const (
+	KeyDBPath   = "db.path"
+	KeyCore     = "core"
+	KeyTestURL  = "test.url"
+	KeyMaxDelay = "test.mdelay"
+	KeyTimeout  = "test.timeout"
+	KeyGeoURLs  = "test.geo-urls"
+
+	KeyTheme        = "color.theme"
+	KeyColorSuccess = "color.success"
+	KeyColorFailure = "color.failure"
+
+	KeyIPInfoProviders = "ipinfo.providers"
+	KeyIPInfoToken     = "ipinfo.token"
+
+	KeyFetchMaxWorkers   = "fetch.max-workers"
+	KeyFetchPerHost      = "fetch.per-host"
+	KeyFetchDelayPerHost = "fetch.delay-per-host"
+)
+
+// Cores are the values the core setting accepts.
+var Cores = []string{"auto", "xray", "singbox"}
+
+// Settings is the general section of the config file:
+//
+//	db.path      = /srv/xray-knife/xray-knife.db
+//	core         = singbox
+//	test.url     = https://www.gstatic.com/generate_204
+//	test.mdelay  = 3000
+//	test.timeout = 0
+//	test.geo-urls = AS=https://asia.example.com/204, EU=https://eu.example.com/204
+//	color.theme   = light
+//	color.success = blue
+//	color.failure = magenta
+//	ipinfo.providers = cloudflare, ipinfo, https://ip.example.com/json
+//	ipinfo.token     = 0123456789abcd
+//	fetch.max-workers    = 200
+//	fetch.per-host       = 2
+//	fetch.delay-per-host = 1s
+//
+// Keys left out (the zero value) keep the built-in defaults. Other keys, such
+// as the score section, are ignored.
+type Settings struct {
+	DBPath   string
+	Core     string
+	TestURL  string
+	MaxDelay uint16
+	Timeout  uint16
+	// GeoURLs are the test URLs near config servers, comma-separated KEY=URL
+	// (see pkghttp.ParseGeoTargets).
+	GeoURLs string
+	// Theme of colored output and the colors replacing its success and failure ones.
+	Theme        string
+	ColorSuccess string
+	ColorFailure string
+	// IPInfoProviders are the exit IP lookups tried in order, comma-separated, and
+	// IPInfoToken the token of the ipinfo one.
+	IPInfoProviders string
+	IPInfoToken     string
+	// FetchMaxWorkers raises the cap of 'subs fetch --workers'; FetchPerHost
+	// ("0" is unlimited) and FetchDelayPerHost are the defaults of --per-host
+	// and --delay-per-host.
+	FetchMaxWorkers   int
+	FetchPerHost      string
+	FetchDelayPerHost time.Duration
+}
+
+// Load reads the settings from the config file at path. A missing file yields
+// empty settings.
+func Load(path string) (Settings, error) {
+	var s Settings
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return s, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok := parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if err := s.set(key, value); err != nil {
+			return s, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return s, scanner.Err()
+}
+
+// set validates and stores a single setting; unknown keys are ignored.
+func (s *Settings) set(key, value string) error {
+	switch key {
+	case KeyDBPath:
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf("%s must be an absolute path, got %q", key, value)
+		}
+		s.DBPath = value
+	case KeyCore:
+		if err := ValidateCore(value); err != nil {
+			return err
+		}
+		s.Core = value
+	case KeyTestURL:
+		if err := ValidateTestURL(value); err != nil {
+			return err
+		}
+		s.TestURL = value
+	case KeyMaxDelay, KeyTimeout:
+		ms, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("%s must be a number of milliseconds up to 65535, got %q", key, value)
+		}
+		if key == KeyMaxDelay {
+			s.MaxDelay = uint16(ms)
+		} else {
+			s.Timeout = uint16(ms)
+		}
+	case KeyGeoURLs:
+		if _, err := pkghttp.ParseGeoTargets(strings.Split(value, ",")); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		s.GeoURLs = value
+	case KeyTheme:
+		if err := customlog.ValidateTheme(value); err != nil {
+			return err
+		}
+		s.Theme = value
+	case KeyColorSuccess, KeyColorFailure:
+		if err := customlog.ValidateColor(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if key == KeyColorSuccess {
+			s.ColorSuccess = value
+		} else {
+			s.ColorFailure = value
+		}
+	case KeyIPInfoProviders:
+		for _, spec := range strings.Split(value, ",") {
+			if err := pkghttp.ValidateIPInfoProvider(strings.TrimSpace(spec)); err != nil {
+				return err
+			}
+		}
+		s.IPInfoProviders = value
+	case KeyIPInfoToken:
+		s.IPInfoToken = value
+	case KeyFetchMaxWorkers:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s must be a number of at least 1, got %q", key, value)
+		}
+		s.FetchMaxWorkers = n
+	case KeyFetchPerHost:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a number >= 0, got %q", key, value)
+		}
+		s.FetchPerHost = value
+	case KeyFetchDelayPerHost:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%s must be a duration such as 2s, got %q", key, value)
+		}
+		s.FetchDelayPerHost = d
+	}
+	return nil
+}
+
+// ValidateCore checks a core setting.
+func ValidateCore(core string) error {
+	for _, c := range Cores {
+		if core == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("core must be one of %s, got %q", strings.Join(Cores, ", "), core)
+}
+
+// ValidateTestURL checks a test URL setting.
+func ValidateTestURL(testURL string) error {
+	u, err := url.Parse(testURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("test url must be an absolute http(s) URL, got %q", testURL)
+	}
+	return nil
+}
+
+// values returns the settings in file order, empty ones included.
+func (s Settings) values() [][2]string {
+	ms := func(v uint16) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.Itoa(int(v))
+	}
+	positive := func(v int) string {
+		if v <= 0 {
+			return ""
+		}
+		return strconv.Itoa(v)
+	}
+	duration := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return [][2]string{
+		{KeyDBPath, s.DBPath},
+		{KeyCore, s.Core},
+		{KeyTestURL, s.TestURL},
+		{KeyMaxDelay, ms(s.MaxDelay)},
+		{KeyTimeout, ms(s.Timeout)},
+		{KeyGeoURLs, s.GeoURLs},
+		{KeyTheme, s.Theme},
+		{KeyColorSuccess, s.ColorSuccess},
+		{KeyColorFailure, s.ColorFailure},
+		{KeyIPInfoProviders, s.IPInfoProviders},
+		{KeyIPInfoToken, s.IPInfoToken},
+		{KeyFetchMaxWorkers, positive(s.FetchMaxWorkers)},
+		{KeyFetchPerHost, s.FetchPerHost},
+		{KeyFetchDelayPerHost, duration(s.FetchDelayPerHost)},
+	}
+}
+
+// Save writes s to the config file at path. Settings already in the file are
+// updated in place and empty ones removed, new ones go after them; comments
+// and other sections are kept as they are.
+func Save(path string, s Settings) error {
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pending := make(map[string]string)
+	for _, kv := range s.values() {
+		pending[kv[0]] = kv[1]
+	}
+	var lines []string
+	last := -1 // index of the last line holding a setting
+	if len(old) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(string(old), "\n"), "\n") {
+			key, _, ok := parseLine(line)
+			value, ours := pending[key]
+			if !ok || !ours {
+				lines = append(lines, line)
+				continue
+			}
+			delete(pending, key)
+			if value != "" {
+				lines = append(lines, key+" = "+value)
+				last = len(lines) - 1
+			}
+		}
+	}
+
+	var added []string
+	for _, kv := range s.values() {
+		if value, left := pending[kv[0]]; left && value != "" {
+			added = append(added, kv[0]+" = "+value)
+		}
+	}
+	if last < 0 && len(added) > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "# Written by 'xray-knife init'.")
+		last = len(lines) - 1
+	}
+	lines = append(lines[:last+1], append(added, lines[last+1:]...)...)
+
+	var out bytes.Buffer
+	for _, line := range lines {
+		out.WriteString(line + "\n")
+	}
+	return os.WriteFile(path, out.Bytes(), 0600)
+}
+
+// parseLine splits a "key = value" line, skipping blanks and comments.
+func parseLine(line string) (key, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	key, value, ok = strings.Cut(line, "=")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
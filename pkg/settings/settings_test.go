@@ -0,0 +1,75 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveKeepsOtherSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xray-knife.conf")
+	old := "# Gaming weights\nscore.latency = 0.5\ncore = xray\ntest.mdelay = 3000\n"
+	if err := os.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Settings{Core: "singbox", TestURL: "https://www.gstatic.com/generate_204", Timeout: 2000, GeoURLs: "AS=https://asia.example.com/204, EU=https://eu.example.com/204", FetchMaxWorkers: 200, FetchPerHost: "0", FetchDelayPerHost: 2 * time.Second}
+	if err := Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if !strings.HasPrefix(text, "# Gaming weights\nscore.latency = 0.5\ncore = singbox\n") {
+		t.Errorf("existing lines not kept in place:\n%s", text)
+	}
+	if strings.Contains(text, "test.mdelay") {
+		t.Errorf("cleared setting still written:\n%s", text)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	for _, line := range []string{"core = v2ray", "test.url = ftp://example.com", "test.mdelay = 70000", "test.geo-urls = EU=ftp://eu.example.com", "db.path = relative.db", "color.theme = solarized", "color.success = orange", "ipinfo.providers = cloudflare, whois", "fetch.max-workers = 0", "fetch.per-host = -1", "fetch.delay-per-host = soon"} {
+		path := filepath.Join(t.TempDir(), "xray-knife.conf")
+		if err := os.WriteFile(path, []byte(line+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+			t.Errorf("Load(%q) error = %v, want one pointing at line 1", line, err)
+		}
+	}
+}
+
+func TestSaveAddsNextToExistingSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xray-knife.conf")
+	if err := Save(path, Settings{Core: "xray"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\nscore.runs = 20\n")
+	f.Close()
+
+	if err := Save(path, Settings{Core: "xray", MaxDelay: 3000}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "# Written by 'xray-knife init'.\ncore = xray\ntest.mdelay = 3000\n\nscore.runs = 20\n"
+	if string(data) != want {
+		t.Errorf("file =\n%s\nwant\n%s", data, want)
+	}
+}
@@ -0,0 +1,113 @@
+// Package tester is the Go API of the xray-knife config tester, for bots, panels
+// and other programs that want the checks of 'xray-knife http' without shelling
+// out to it. A Tester runs configs through the same examiner and worker pool as
+// the command, and hands the results over on a channel as they come in instead
+// of printing them.
+//
+//	t, err := tester.New(tester.Options{Options: pkghttp.Options{Core: "auto", DoIPInfo: true}})
+//	if err != nil {
+//		return err
+//	}
+//	for r := range t.Test(ctx, links) {
+//		fmt.Println(r.Status, r.Delay, r.ConfigLink)
+//	}
+package tester
+
+import (
+	"context"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+)
+
+// DefaultThreads is how many configs are tested at once unless Options says,
+// the default of 'xray-knife http'.
+const DefaultThreads = 50
+
+// Result is the outcome of testing one config.
+type Result = pkghttp.Result
+
+// Options configure a Tester. The embedded options are those of the examiner
+// behind 'xray-knife http': the core, the test URL, timeouts and the checks to
+// run. Unlike the command, nothing is logged unless Logger is set.
+type Options struct {
+	pkghttp.Options
+	// Threads is how many configs are tested at once, 0 for DefaultThreads.
+	Threads uint16
+	// PoolSize loads that many configs into each core instance, when the core
+	// supports it and the checks allow it; 0 runs an instance per config.
+	PoolSize int
+}
+
+// Tester tests configs. It is safe for concurrent use; every call to Test runs
+// its own worker pool.
+type Tester struct {
+	examiner *pkghttp.Examiner
+	threads  uint16
+	poolSize int
+}
+
+// New returns a tester with opts.
+func New(opts Options) (*Tester, error) {
+	if opts.Logger == nil {
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+	examiner, err := pkghttp.NewExaminer(opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	threads := opts.Threads
+	if threads == 0 {
+		threads = DefaultThreads
+	}
+	return &Tester{examiner: examiner, threads: threads, poolSize: opts.PoolSize}, nil
+}
+
+// Examiner returns the examiner the tester runs, for the knobs Options doesn't
+// cover, such as per-link test targets. Change it before testing, not during.
+func (t *Tester) Examiner() *pkghttp.Examiner {
+	return t.examiner
+}
+
+// Test tests links and returns their results in the order they finish. The
+// channel is closed once every link is tested, or soon after ctx is cancelled;
+// results of the links not tested by then are dropped. The caller must drain it.
+func (t *Tester) Test(ctx context.Context, links []string) <-chan *Result {
+	results := make(chan *Result, t.threads)
+	manager := pkghttp.NewTestManager(t.examiner, t.threads, false, nil)
+	manager.SetPoolSize(t.poolSize)
+	go func() {
+		defer close(results)
+		manager.RunTests(ctx, links, results, nil)
+	}()
+	return results
+}
+
+// TestProtocols is Test for configs already created from links, e.g. by a core.
+func (t *Tester) TestProtocols(ctx context.Context, protocols []protocol.Protocol) <-chan *Result {
+	links := make([]string, len(protocols))
+	for i, p := range protocols {
+		links[i] = p.GetLink()
+	}
+	return t.Test(ctx, links)
+}
+
+// TestOne tests a single link, with the retries of the options. The error is
+// why the config failed; the result says so too.
+func (t *Tester) TestOne(ctx context.Context, link string) (Result, error) {
+	return t.examiner.ExamineConfigWithRetries(ctx, link)
+}
+
+// Collect reads every result of a channel returned by Test and returns them
+// fastest first, failed configs last.
+func Collect(results <-chan *Result) pkghttp.ConfigResults {
+	var all pkghttp.ConfigResults
+	for r := range results {
+		all = append(all, r)
+	}
+	sort.Stable(all)
+	return all
+}
@@ -0,0 +1,79 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core/protocol"
+	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
+)
+
+const testUUID = "d342d11e-d424-4583-b36e-524ab1f0afa4"
+
+func TestTester(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	// Raw probes only connect to the servers, so local listeners stand in for them.
+	tr, err := New(Options{Options: pkghttp.Options{Core: "auto", MaxDelay: 2000, Raw: true}, Threads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := fmt.Sprintf("vless://%s@%s?security=none&type=tcp#up", testUUID, listener.Addr())
+	down := fmt.Sprintf("vless://%s@%s?security=none&type=tcp#down", testUUID, closed.Addr())
+	results := Collect(tr.Test(context.Background(), []string{down, up, "vless://broken"}))
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].ConfigLink != up || results[0].Status != "passed" {
+		t.Errorf("first result = %s %s, want the passing config", results[0].ConfigLink, results[0].Status)
+	}
+	for _, r := range results[1:] {
+		if r.Status == "passed" {
+			t.Errorf("%s passed", r.ConfigLink)
+		}
+	}
+
+	proto, err := core.NewAutomaticCore(false, false).CreateProtocol(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	results = Collect(tr.TestProtocols(context.Background(), []protocol.Protocol{proto}))
+	if len(results) != 1 || results[0].Status != "passed" {
+		t.Errorf("TestProtocols = %+v", results)
+	}
+
+	if r, err := tr.TestOne(context.Background(), down); err == nil || r.Status != "failed" {
+		t.Errorf("TestOne(down) = %s, %v", r.Status, err)
+	}
+}
+
+func TestTesterCancelled(t *testing.T) {
+	tr, err := New(Options{Options: pkghttp.Options{Core: "auto", Raw: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	links := make([]string, 100)
+	for i := range links {
+		links[i] = fmt.Sprintf("vless://%s@192.0.2.1:%d?security=none&type=tcp", testUUID, 1000+i)
+	}
+	// The channel is closed without every link being tested.
+	for range tr.Test(ctx, links) {
+	}
+}
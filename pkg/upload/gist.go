@@ -0,0 +1,84 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// gistAPI is the GitHub API the gists are published to.
+var gistAPI = "https://api.github.com"
+
+// Gist is a published secret gist holding one file.
+type Gist struct {
+	ID    string
+	Owner string
+	File  string
+}
+
+// RawURL is the address of the latest version of the file, which stays the same
+// when the gist is updated, so it can be added to clients as a subscription.
+func (g Gist) RawURL() string {
+	return "https://gist.githubusercontent.com/" + url.PathEscape(g.Owner) + "/" + url.PathEscape(g.ID) + "/raw/" + url.PathEscape(g.File)
+}
+
+// PublishGist stores data as the file name of a secret gist, creating the gist
+// when id is empty and replacing the file of gist id otherwise. token needs the
+// gist scope.
+func PublishGist(ctx context.Context, token, id, name, description string, data []byte) (Gist, error) {
+	if token == "" {
+		return Gist{}, fmt.Errorf("publishing a gist needs a GitHub token with the gist scope")
+	}
+	body, err := json.Marshal(map[string]any{
+		"description": description,
+		"public":      false,
+		"files":       map[string]map[string]string{name: {"content": string(data)}},
+	})
+	if err != nil {
+		return Gist{}, err
+	}
+
+	method, endpoint := http.MethodPost, gistAPI+"/gists"
+	if id != "" {
+		method, endpoint = http.MethodPatch, gistAPI+"/gists/"+url.PathEscape(id)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Gist{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Gist{}, fmt.Errorf("publishing gist: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(respBody, &apiErr)
+		return Gist{}, fmt.Errorf("publishing gist: GitHub answered %s: %s", resp.Status, strings.TrimSpace(apiErr.Message))
+	}
+
+	var created struct {
+		ID    string `json:"id"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil || created.ID == "" {
+		return Gist{}, fmt.Errorf("publishing gist: unexpected answer from GitHub")
+	}
+	return Gist{ID: created.ID, Owner: created.Owner.Login, File: name}, nil
+}
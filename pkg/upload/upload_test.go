@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	got := hex.EncodeToString(signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam"))
+	if want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"; got != want {
+		t.Errorf("signingKey() = %s, want %s", got, want)
+	}
+}
+
+func TestWebDAVUpload(t *testing.T) {
+	var mu sync.Mutex
+	files := map[string]string{}
+	folders := map[string]bool{"/": true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if user, pass, _ := r.BasicAuth(); user != "team" || pass != "secret" || r.Header.Get("X-Probe") != "de" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "MKCOL":
+			if folders[r.URL.Path] {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			folders[r.URL.Path] = true
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			if !folders[r.URL.Path[:strings.LastIndex(r.URL.Path, "/")+1]] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			files[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := New(strings.Replace(srv.URL, "http://", "webdav://team:secret@", 1)+"/shared/lists", []string{"X-Probe: de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"vless://a\n", "vless://b\n"} {
+		if err := u.Upload(context.Background(), "best.txt", []byte(content), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := files["/shared/lists/best.txt"]; got != "vless://b\n" {
+		t.Errorf("uploaded file = %q, files = %v", got, files)
+	}
+
+	if _, err := New("ftp://example.com/", nil); err == nil {
+		t.Error("New accepted an ftp URL")
+	}
+	if _, err := New("https://example.com/", []string{"no colon"}); err == nil {
+		t.Error("New accepted a malformed header")
+	}
+}
+
+func TestS3Upload(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	u, err := New("s3://probes/eu west?region=eu-central-1&endpoint="+srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Upload(context.Background(), "results.json", []byte("[]"), "application/json"); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/probes/eu%20west/results.json" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(gotAuth, "/eu-central-1/s3/aws4_request") {
+		t.Errorf("Authorization = %s", gotAuth)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := New("s3://probes", nil); err == nil {
+		t.Error("New accepted s3 without credentials")
+	}
+}
+
+func TestPublishGist(t *testing.T) {
+	var method, path, auth string
+	var body struct {
+		Public bool                         `json:"public"`
+		Files  map[string]map[string]string `json:"files"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"id":"abc123","owner":{"login":"me"}}`))
+	}))
+	defer srv.Close()
+	defer func(old string) { gistAPI = old }(gistAPI)
+	gistAPI = srv.URL
+
+	g, err := PublishGist(context.Background(), "tok", "", "sub.txt", "configs", []byte("vless://a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost || path != "/gists" || auth != "Bearer tok" || body.Public || body.Files["sub.txt"]["content"] != "vless://a\n" {
+		t.Errorf("request = %s %s %q, body = %+v", method, path, auth, body)
+	}
+	if want := "https://gist.githubusercontent.com/me/abc123/raw/sub.txt"; g.RawURL() != want {
+		t.Errorf("RawURL() = %s, want %s", g.RawURL(), want)
+	}
+
+	if _, err := PublishGist(context.Background(), "tok", "abc123", "sub.txt", "configs", nil); err != nil || method != http.MethodPatch || path != "/gists/abc123" {
+		t.Errorf("update = %s %s, %v", method, path, err)
+	}
+	if _, err := PublishGist(context.Background(), "", "", "sub.txt", "", nil); err == nil {
+		t.Error("PublishGist accepted an empty token")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package watchdog
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Restart starts a fresh run of the same command line, sharing the console, and
+// exits. It only returns on error.
+func Restart() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
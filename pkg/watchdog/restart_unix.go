@@ -0,0 +1,18 @@
+//go:build unix
+
+package watchdog
+
+import (
+	"os"
+	"syscall"
+)
+
+// Restart replaces the process with a fresh run of the same command line. It
+// only returns on error.
+func Restart() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
@@ -0,0 +1,37 @@
+package watchdog
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// canCountFiles reports whether openFiles works here.
+const canCountFiles = true
+
+// openFiles returns the number of files this process has open.
+func openFiles() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// residentMemory returns the resident set size from /proc/self/statm.
+func residentMemory() uint64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	// "size resident shared text lib data dt", in pages
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package watchdog
+
+import "runtime"
+
+// canCountFiles reports whether openFiles works here.
+const canCountFiles = false
+
+// openFiles is not implemented outside Linux.
+func openFiles() int {
+	return 0
+}
+
+// residentMemory returns the memory the Go runtime got from the OS, the closest
+// portable stand-in for the resident set size.
+func residentMemory() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys
+}
@@ -0,0 +1,103 @@
+// Package watchdog watches the resources of a long-running xray-knife process,
+// such as the proxy or the test daemon, which embed cores that can leak memory,
+// goroutines and file descriptors over days of rotations and test rounds. When
+// the process grows over a memory limit, the command winds down and returns a
+// *RestartError, and Execute starts the same command line afresh.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// DefaultInterval is how often a Watchdog samples the process unless told.
+const DefaultInterval = 30 * time.Second
+
+// Stats are the resources the process holds.
+type Stats struct {
+	Goroutines int
+	// OpenFiles is the number of open file descriptors, sockets included; 0
+	// where they can't be counted.
+	OpenFiles int
+	// RSS is the resident memory in bytes. Outside Linux it is the memory the Go
+	// runtime got from the OS, which leaves out what cores allocate in C.
+	RSS uint64
+}
+
+func (s Stats) String() string {
+	files := "unknown"
+	if canCountFiles {
+		files = fmt.Sprint(s.OpenFiles)
+	}
+	return fmt.Sprintf("%d goroutines, %s open files, %.1f MB resident", s.Goroutines, files, float64(s.RSS)/(1<<20))
+}
+
+// Sample returns the resources the process holds now.
+func Sample() Stats {
+	return Stats{Goroutines: runtime.NumGoroutine(), OpenFiles: openFiles(), RSS: residentMemory()}
+}
+
+// RestartError is returned by a command the watchdog stopped. Execute restarts
+// the process when it gets one.
+type RestartError struct {
+	Stats Stats
+	Limit uint64 // bytes
+}
+
+func (e *RestartError) Error() string {
+	return fmt.Sprintf("resident memory %.1f MB is over the limit of %d MB (%s)", float64(e.Stats.RSS)/(1<<20), e.Limit>>20, e.Stats)
+}
+
+// Watchdog samples the process every Interval.
+type Watchdog struct {
+	// MaxMemory is the resident memory in MB over which the process restarts,
+	// 0 for no limit.
+	MaxMemory uint64
+	Interval  time.Duration
+	// OnSample, when set, gets every sample, e.g. to log it.
+	OnSample func(Stats)
+}
+
+// Watch watches the process until ctx is done or the returned stop is called.
+// The returned context is cancelled when the process goes over MaxMemory, with
+// a *RestartError as its cause (see Restarting).
+func (w *Watchdog) Watch(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s := Sample()
+			if w.OnSample != nil {
+				w.OnSample(s)
+			}
+			if limit := w.MaxMemory << 20; limit > 0 && s.RSS > limit {
+				cancel(&RestartError{Stats: s, Limit: limit})
+				return
+			}
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// Restarting returns the *RestartError that cancelled a context of Watch, or nil
+// when it was cancelled otherwise or not at all.
+func Restarting(ctx context.Context) error {
+	var re *RestartError
+	if errors.As(context.Cause(ctx), &re) {
+		return re
+	}
+	return nil
+}
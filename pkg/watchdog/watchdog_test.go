@@ -0,0 +1,46 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	s := Sample()
+	if s.Goroutines < 1 || s.RSS == 0 {
+		t.Errorf("Sample() = %+v", s)
+	}
+	if canCountFiles && s.OpenFiles < 3 {
+		t.Errorf("only %d open files counted", s.OpenFiles)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var samples int
+	w := &Watchdog{MaxMemory: 1, Interval: 10 * time.Millisecond, OnSample: func(Stats) { samples++ }}
+	ctx, stop := w.Watch(context.Background())
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watchdog didn't fire over its memory limit")
+	}
+	var re *RestartError
+	if err := Restarting(ctx); !errors.As(err, &re) || re.Limit != 1<<20 {
+		t.Errorf("Restarting() = %v", err)
+	}
+	if samples != 1 {
+		t.Errorf("%d samples, want 1", samples)
+	}
+
+	// Stopped or cancelled, it isn't a restart.
+	w = &Watchdog{Interval: 10 * time.Millisecond}
+	ctx, stop = w.Watch(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	stop()
+	if ctx.Err() == nil || Restarting(ctx) != nil {
+		t.Errorf("after stop: %v, %v", ctx.Err(), Restarting(ctx))
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"os"
 	"sync"
 	"time"
-
-	"github.com/fatih/color"
 )
 
 // Type is the log level/category.
@@ -23,23 +21,18 @@ var (
 	Warning    Type = 0x05
 	// None is for un-styled text, providing a neutral default.
 	None Type = 0x06
+	// Label is for the keys of key/value output and section headings.
+	Label Type = 0x07
 )
 
-// TypesDetails holds the visual properties for each log type.
-type TypesDetails struct {
-	symbol string
-	color  *color.Color
-}
-
-// logTypeMap maps a log Type to its visual details (symbol and color).
-var logTypeMap = map[Type]TypesDetails{
-	Success:    {symbol: "✅", color: color.New(color.Bold, color.FgGreen)},
-	Failure:    {symbol: "❌", color: color.New(color.Bold, color.FgRed)},
-	Processing: {symbol: "⚙️ ", color: color.New(color.Bold, color.FgBlue)},
-	Finished:   {symbol: "🎉", color: color.New(color.BgGreen, color.FgBlack)},
-	Info:       {symbol: "ℹ️ ", color: color.New(color.Bold, color.FgCyan)},
-	Warning:    {symbol: "⚠️ ", color: color.New(color.Bold, color.FgYellow)},
-	None:       {symbol: "", color: color.New()}, // No symbol, default color
+// symbols are the prefixes Printf puts before the time of each log type.
+var symbols = map[Type]string{
+	Success:    "✅",
+	Failure:    "❌",
+	Processing: "⚙️ ",
+	Finished:   "🎉",
+	Info:       "ℹ️ ",
+	Warning:    "⚠️ ",
 }
 
 var (
@@ -67,35 +60,22 @@ func Printf(logType Type, format string, v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	// Check if the current output is a terminal device.
-	// This check is a bit tricky as the `output` can be anything.
-	// We'll assume color is enabled unless we're sure it's not a tty.
-	if f, ok := output.(*os.File); ok {
-		stat, _ := f.Stat()
-		color.NoColor = (stat.Mode() & os.ModeCharDevice) != os.ModeCharDevice
-	} else {
-		// For non-file writers (like web sockets), we typically want to send the raw string without ANSI color codes.
-		// However, fatih/color handles this by checking the NO_COLOR env var. We can also force it.
-		// For now, let's assume the receiver can handle it or we strip it elsewhere if needed.
-		color.NoColor = false
-	}
-
-	t, ok := logTypeMap[logType]
-	if !ok {
-		// Fallback for an undefined type to prevent a panic.
-		t = logTypeMap[None]
-	}
-
 	// Prepare the prefix with a symbol (if it exists) and a timestamp.
 	prefix := ""
-	if t.symbol != "" {
-		prefix = t.symbol + " "
+	if symbol := symbols[logType]; symbol != "" {
+		prefix = symbol + " "
 	}
 	currentTime := time.Now()
 	fullFormat := prefix + currentTime.Format("15:04:05") + " " + format
 
 	// Use Fprintf to write to the designated output.
-	t.color.Fprintf(output, fullFormat, v...)
+	c := colorOf(logType)
+	if colorEnabled(output) {
+		c.EnableColor()
+	} else {
+		c.DisableColor()
+	}
+	c.Fprintf(output, fullFormat, v...)
 }
 
 // Println prints the given arguments to the designated output, followed by a newline.
@@ -105,11 +85,18 @@ func Println(v ...interface{}) {
 	fmt.Fprintln(output, v...)
 }
 
-// GetColor wraps text in the ANSI color for the given log type.
+// GetColor wraps text in the color the theme gives logType, unless colors are off
+// for stdout (--no-color, NO_COLOR, or stdout not being a terminal).
 func GetColor(logType Type, text string) string {
-	t, ok := logTypeMap[logType]
-	if !ok {
-		t = logTypeMap[None]
+	if !ColorEnabled() {
+		return text
 	}
-	return t.color.Sprint(text)
+	return Paint(logType, text)
+}
+
+// Paint wraps text in the color the theme gives logType, even when colors are off.
+func Paint(logType Type, text string) string {
+	c := colorOf(logType)
+	c.EnableColor()
+	return c.Sprint(text)
 }
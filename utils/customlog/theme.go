@@ -0,0 +1,157 @@
+package customlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Theme assigns the colors of each log type.
+type Theme map[Type][]color.Attribute
+
+// Themes are the built-in themes. dark is the default; light avoids yellow and
+// cyan, which are unreadable on a light background.
+var Themes = map[string]Theme{
+	"dark": {
+		Success:    {color.Bold, color.FgGreen},
+		Failure:    {color.Bold, color.FgRed},
+		Processing: {color.Bold, color.FgBlue},
+		Finished:   {color.BgGreen, color.FgBlack},
+		Info:       {color.Bold, color.FgCyan},
+		Warning:    {color.Bold, color.FgYellow},
+		Label:      {color.FgRed},
+	},
+	"light": {
+		Success:    {color.Bold, color.FgGreen},
+		Failure:    {color.Bold, color.FgRed},
+		Processing: {color.Bold, color.FgBlue},
+		Finished:   {color.BgGreen, color.FgBlack},
+		Info:       {color.Bold, color.FgBlue},
+		Warning:    {color.Bold, color.FgMagenta},
+		Label:      {color.Bold, color.FgRed},
+	},
+}
+
+// colorNames are the colors accepted by SetTypeColor.
+var colorNames = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+var (
+	// theme is the theme in use, with the overrides of SetTypeColor.
+	theme = Themes["dark"]
+	// disabled is set by --no-color and the NO_COLOR variable.
+	disabled = os.Getenv("NO_COLOR") != ""
+)
+
+// ThemeNames returns the names of the built-in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ColorNames returns the names SetTypeColor accepts.
+func ColorNames() []string {
+	names := make([]string, 0, len(colorNames))
+	for name := range colorNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateTheme checks a theme name.
+func ValidateTheme(name string) error {
+	if _, ok := Themes[name]; !ok {
+		return fmt.Errorf("theme must be one of %s, got %q", strings.Join(ThemeNames(), ", "), name)
+	}
+	return nil
+}
+
+// ValidateColor checks a color name.
+func ValidateColor(name string) error {
+	if _, ok := colorNames[name]; !ok {
+		return fmt.Errorf("color must be one of %s, got %q", strings.Join(ColorNames(), ", "), name)
+	}
+	return nil
+}
+
+// SetTheme switches to a built-in theme, dropping earlier SetTypeColor overrides.
+func SetTheme(name string) error {
+	if err := ValidateTheme(name); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	theme = Themes[name]
+	return nil
+}
+
+// SetTypeColor gives a log type another foreground color, keeping its other
+// attributes (bold, background).
+func SetTypeColor(logType Type, name string) error {
+	if err := ValidateColor(name); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	attrs := slices.DeleteFunc(slices.Clone(theme[logType]), func(a color.Attribute) bool {
+		return a >= color.FgBlack && a <= color.FgWhite
+	})
+	updated := make(Theme, len(theme))
+	for t, a := range theme {
+		updated[t] = a
+	}
+	updated[logType] = append(attrs, colorNames[name])
+	theme = updated
+	return nil
+}
+
+// DisableColor turns colors off everywhere, as --no-color does.
+func DisableColor() {
+	mu.Lock()
+	defer mu.Unlock()
+	disabled = true
+	color.NoColor = true
+}
+
+// ColorEnabled reports whether output to stdout is colored.
+func ColorEnabled() bool {
+	return !disabled && !color.NoColor
+}
+
+// colorOf returns a new color.Color for logType in the current theme.
+func colorOf(logType Type) *color.Color {
+	return color.New(theme[logType]...)
+}
+
+// colorEnabled reports whether output written to w is colored: unless colors are
+// disabled, terminals get colors and files and pipes don't. Other writers, like
+// the web UI's log stream, get them too.
+func colorEnabled(w io.Writer) bool {
+	if disabled {
+		return false
+	}
+	if f, ok := w.(*os.File); ok {
+		stat, err := f.Stat()
+		return err == nil && stat.Mode()&os.ModeCharDevice != 0
+	}
+	return true
+}
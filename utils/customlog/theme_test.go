@@ -0,0 +1,49 @@
+package customlog
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestSetTypeColorKeepsAttributes(t *testing.T) {
+	defer SetTheme("dark")
+
+	if err := SetTypeColor(Success, "blue"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := theme[Success], []color.Attribute{color.Bold, color.FgBlue}; !slices.Equal(got, want) {
+		t.Errorf("Success = %v, want %v", got, want)
+	}
+	if got := Themes["dark"][Success]; !slices.Contains(got, color.FgGreen) {
+		t.Errorf("built-in theme changed: %v", got)
+	}
+	if err := SetTypeColor(Failure, "orange"); err == nil {
+		t.Error("SetTypeColor accepted an unknown color")
+	}
+}
+
+func TestColorEnabledWriters(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if colorEnabled(f) {
+		t.Error("colors enabled for a regular file")
+	}
+
+	old := disabled
+	defer func() { disabled = old }()
+	disabled = false
+	if !colorEnabled(&bytes.Buffer{}) {
+		t.Error("colors disabled for a non-file writer")
+	}
+	disabled = true
+	if colorEnabled(&bytes.Buffer{}) {
+		t.Error("colors enabled with NO_COLOR")
+	}
+}
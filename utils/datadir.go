@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+)
+
+// ProfileEnv names the profile to use when --profile isn't given.
+const ProfileEnv = "XRAY_KNIFE_PROFILE"
+
+// DataDirEnv names the data directory to use when --data-dir isn't given.
+const DataDirEnv = "XRAY_KNIFE_DATA_DIR"
+
+// appDirName is the name of the data directory inside the platform's
+// per-user application data directory.
+const appDirName = "xray-knife"
+
+// legacyDirName is the data directory in the home directory that versions
+// before the platform directories used, kept while it exists.
+const legacyDirName = ".xray-knife"
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// profile is the selected profile, "" for the default one.
+var profile string
+
+// baseDir is the data directory set with SetBaseDir, "" for the default one.
+var baseDir string
+
+// SetProfile selects the profile DataDir points into. An empty name selects the
+// default profile.
+func SetProfile(name string) error {
+	if name != "" && !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	profile = name
+	return nil
+}
+
+// Profile returns the selected profile, "" for the default one.
+func Profile() string {
+	return profile
+}
+
+// SetBaseDir makes dir the data directory, overriding the platform default. An
+// empty dir selects the default again.
+func SetBaseDir(dir string) error {
+	if dir == "" {
+		baseDir = ""
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid data directory %q: %w", dir, err)
+	}
+	baseDir = abs
+	return nil
+}
+
+// BaseDir returns the data directory of xray-knife: the one set with
+// SetBaseDir, else ~/.xray-knife when it exists, else the directory of the
+// platform: under $XDG_DATA_HOME (~/.local/share) on Linux and other Unixes,
+// %AppData% on Windows and ~/Library/Application Support on macOS.
+// Machine-wide state, such as the system proxy settings to restore, lives
+// there whatever the profile.
+func BaseDir() (string, error) {
+	if baseDir != "" {
+		return baseDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find user home directory: %w", err)
+	}
+	legacy := filepath.Join(home, legacyDirName)
+	if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+		return legacy, nil
+	}
+	return platformDataDir(runtime.GOOS, home, os.Getenv), nil
+}
+
+// platformDataDir returns the data directory on goos for the user with the
+// given home directory and environment.
+func platformDataDir(goos, home string, getenv func(string) string) string {
+	switch goos {
+	case "windows":
+		if appData := getenv("AppData"); appData != "" {
+			return filepath.Join(appData, appDirName)
+		}
+		return filepath.Join(home, "AppData", "Roaming", appDirName)
+	case "darwin", "ios":
+		return filepath.Join(home, "Library", "Application Support", appDirName)
+	}
+	// The XDG spec says relative paths are invalid and must be ignored.
+	if xdg := getenv("XDG_DATA_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, appDirName)
+	}
+	return filepath.Join(home, ".local", "share", appDirName)
+}
+
+// DataDir returns the directory holding the database, config files and saved
+// results of the selected profile: BaseDir for the default profile and
+// BaseDir/profiles/<name> for the others. It is created when missing.
+func DataDir() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+	if profile != "" {
+		dir = filepath.Join(dir, "profiles", profile)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create data directory %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// StateFile returns the path of name in BaseDir, creating the directory when
+// missing, for state that outlives a crash, like the system proxy settings to
+// restore.
+func StateFile(name string) (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("could not create data directory %s: %w", dir, err)
+	}
+	return filepath.Join(dir, name), nil
+}
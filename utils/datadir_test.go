@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPlatformDataDir(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+	home := filepath.Join("/home", "me")
+
+	tests := []struct {
+		goos string
+		env  map[string]string
+		want string
+	}{
+		{"linux", nil, filepath.Join(home, ".local", "share", "xray-knife")},
+		{"linux", map[string]string{"XDG_DATA_HOME": "/data"}, filepath.Join("/data", "xray-knife")},
+		{"freebsd", map[string]string{"XDG_DATA_HOME": "relative"}, filepath.Join(home, ".local", "share", "xray-knife")},
+		{"darwin", nil, filepath.Join(home, "Library", "Application Support", "xray-knife")},
+		{"windows", map[string]string{"AppData": "/Users/me/AppData/Roaming"}, filepath.Join("/Users/me/AppData/Roaming", "xray-knife")},
+		{"windows", nil, filepath.Join(home, "AppData", "Roaming", "xray-knife")},
+	}
+	for _, tt := range tests {
+		env = tt.env
+		if got := platformDataDir(tt.goos, home, getenv); got != tt.want {
+			t.Errorf("platformDataDir(%s, %v) = %s, want %s", tt.goos, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestBaseDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "xdg"))
+	defer SetBaseDir("")
+
+	if dir, err := BaseDir(); err != nil || dir != platformDataDir(runtime.GOOS, home, os.Getenv) {
+		t.Errorf("BaseDir() = %s, %v; want the platform directory", dir, err)
+	}
+	legacy := filepath.Join(home, ".xray-knife")
+	if err := os.Mkdir(legacy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := BaseDir(); err != nil || dir != legacy {
+		t.Errorf("BaseDir() = %s, %v; want the existing %s", dir, err, legacy)
+	}
+
+	custom := filepath.Join(home, "custom")
+	if err := SetBaseDir(custom); err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := BaseDir(); err != nil || dir != custom {
+		t.Errorf("BaseDir() = %s, %v; want %s", dir, err, custom)
+	}
+	path, err := StateFile("state.json")
+	if err != nil || path != filepath.Join(custom, "state.json") {
+		t.Errorf("StateFile = %s, %v", path, err)
+	}
+	if _, err := os.Stat(custom); err != nil {
+		t.Errorf("StateFile didn't create the data directory: %v", err)
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	defer SetProfile("")
+	for _, name := range []string{"", "work", "phone-2", "de.vps_1", strings.Repeat("a", 64)} {
+		if err := SetProfile(name); err != nil {
+			t.Errorf("SetProfile(%q) = %v", name, err)
+		} else if Profile() != name {
+			t.Errorf("Profile() = %q after SetProfile(%q)", Profile(), name)
+		}
+	}
+	SetProfile("work")
+	for _, name := range []string{"..", "../x", "a/b", `a\b`, ".hidden", "-flag", "with space", strings.Repeat("a", 65)} {
+		if err := SetProfile(name); err == nil {
+			t.Errorf("SetProfile(%q) accepted an invalid name", name)
+		}
+	}
+	if Profile() != "work" {
+		t.Errorf("Profile() = %q, an invalid name replaced the selected one", Profile())
+	}
+}
+
+func TestDataDirProfiles(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "data")
+	if err := SetBaseDir(base); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseDir("")
+	defer SetProfile("")
+
+	if dir, err := DataDir(); err != nil || dir != base {
+		t.Errorf("DataDir() = %s, %v; want %s for the default profile", dir, err, base)
+	}
+	SetProfile("work")
+	want := filepath.Join(base, "profiles", "work")
+	if dir, err := DataDir(); err != nil || dir != want {
+		t.Errorf("DataDir() = %s, %v; want %s", dir, err, want)
+	}
+	if fi, err := os.Stat(want); err != nil || !fi.IsDir() {
+		t.Errorf("DataDir didn't create the profile directory: %v", err)
+	}
+	// The base directory stays the same whatever the profile.
+	if dir, err := BaseDir(); err != nil || dir != base {
+		t.Errorf("BaseDir() = %s, %v; want %s", dir, err, base)
+	}
+}
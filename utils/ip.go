@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 )
 
 func incrementIP(i *net.IP) {
@@ -49,3 +50,31 @@ func IsIPv6(ipStr string) bool {
 	}
 	return ip.To4() == nil // if To4() returns nil, it's not an IPv4 address, hence it's IPv6
 }
+
+// IsLoopbackAddr reports whether a listen address only accepts local connections.
+func IsLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// IsLoopbackHost reports whether host, the Host header of a request or the host
+// of a URL, with or without a port, names a loopback address.
+func IsLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Placeholders RedactLink puts in place of secrets.
+const (
+	RedactedUUID   = "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"
+	RedactedSecret = "***"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// secretParams are the query parameters holding credentials or keys, lowercased.
+var secretParams = map[string]bool{
+	"password":      true,
+	"obfs-password": true,
+	"auth":          true,
+	"auth_str":      true,
+	"uuid":          true,
+	"key":           true,
+	"privatekey":    true,
+	"private_key":   true,
+	"secretkey":     true,
+	"psk":           true,
+	"presharedkey":  true,
+	"pbk":           true,
+	"sid":           true,
+}
+
+// vmessSecrets are the fields of a vmess payload holding credentials.
+var vmessSecrets = []string{"id"}
+
+// RedactLink masks the credentials of a config link so it can be shared: UUIDs
+// become RedactedUUID and passwords and keys RedactedSecret. Everything else,
+// the server, transport settings, remark and parameter order, is left as it is,
+// and the link still parses.
+func RedactLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if rest, ok := cutScheme(link, "vmess"); ok {
+		fields, err := decodeVmess(rest)
+		if err != nil {
+			return "", err
+		}
+		for _, key := range vmessSecrets {
+			if v, ok := fields[key].(string); ok && v != "" {
+				fields[key] = redactValue(v)
+			}
+		}
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(raw), nil
+	}
+
+	scheme, rest, ok := strings.Cut(link, "://")
+	if !ok {
+		return link, nil
+	}
+	rest, fragment, hasFragment := strings.Cut(rest, "#")
+	rest, query, hasQuery := strings.Cut(rest, "?")
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		rest = redactUserinfo(strings.ToLower(scheme), rest[:at]) + rest[at:]
+	}
+
+	out := scheme + "://" + rest
+	if hasQuery {
+		out += "?" + redactQuery(query)
+	}
+	if hasFragment {
+		out += "#" + fragment
+	}
+	return out, nil
+}
+
+// redactUserinfo masks the user and password of a link.
+func redactUserinfo(scheme, userinfo string) string {
+	// Shadowsocks keeps the cipher readable: it often is what's being debugged.
+	if scheme == "ss" {
+		if decoded, err := Base64Decode(userinfo); err == nil {
+			if method, _, ok := strings.Cut(string(decoded), ":"); ok {
+				return base64.RawURLEncoding.EncodeToString([]byte(method + ":" + RedactedSecret))
+			}
+		}
+		if method, _, ok := strings.Cut(userinfo, ":"); ok {
+			return method + ":" + RedactedSecret
+		}
+	}
+	// SOCKS links carry base64("user:pass").
+	if scheme == "socks" && !strings.Contains(userinfo, ":") {
+		if decoded, err := Base64Decode(userinfo); err == nil && strings.Contains(string(decoded), ":") {
+			return base64.StdEncoding.EncodeToString([]byte(RedactedSecret + ":" + RedactedSecret))
+		}
+	}
+	user, _, hasPassword := strings.Cut(userinfo, ":")
+	user = redactValue(user)
+	if hasPassword {
+		return user + ":" + RedactedSecret
+	}
+	return user
+}
+
+// redactQuery masks the secret parameters of a query string, keeping their order.
+func redactQuery(query string) string {
+	params := strings.Split(query, "&")
+	for i, p := range params {
+		key, value, ok := strings.Cut(p, "=")
+		if ok && value != "" && secretParams[strings.ToLower(key)] {
+			params[i] = key + "=" + redactValue(value)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// redactValue keeps the shape of UUIDs so the link still parses.
+func redactValue(v string) string {
+	if uuidPattern.MatchString(v) {
+		return RedactedUUID
+	}
+	if v == "" {
+		return ""
+	}
+	return RedactedSecret
+}
@@ -0,0 +1,86 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lilendian0x00/xray-knife/v9/pkg/core"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
+)
+
+func TestRedactLink(t *testing.T) {
+	tests := []struct {
+		name, link, want string
+	}{
+		{
+			"vless reality",
+			"vless://3f8e2a1c-1b2d-4c5e-9f70-112233445566@example.com:443?security=reality&pbk=AbCdEf&sid=12ab&sni=www.microsoft.com&type=tcp#My%20server",
+			"vless://xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx@example.com:443?security=reality&pbk=***&sid=***&sni=www.microsoft.com&type=tcp#My%20server",
+		},
+		{
+			"trojan",
+			"trojan://s3cret@1.2.3.4:443?security=tls&sni=a.example.com#t",
+			"trojan://***@1.2.3.4:443?security=tls&sni=a.example.com#t",
+		},
+		{
+			"shadowsocks keeps the cipher",
+			"ss://YWVzLTI1Ni1nY206cGFzc3dvcmQ@5.6.7.8:8388#ss",
+			"ss://YWVzLTI1Ni1nY206Kioq@5.6.7.8:8388#ss",
+		},
+		{
+			"hysteria2",
+			"hysteria2://pw@h.example.com:443?obfs=salamander&obfs-password=hidden&sni=h.example.com",
+			"hysteria2://***@h.example.com:443?obfs=salamander&obfs-password=***&sni=h.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.RedactLink(tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("RedactLink() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactLinkStillParses(t *testing.T) {
+	vmess := "vmess://eyJ2IjoiMiIsInBzIjoidm0iLCJhZGQiOiIxLjIuMy40IiwicG9ydCI6IjQ0MyIsImlkIjoiM2Y4ZTJhMWMtMWIyZC00YzVlLTlmNzAtMTEyMjMzNDQ1NTY2IiwiYWlkIjoiMCIsIm5ldCI6IndzIiwidHlwZSI6Im5vbmUiLCJob3N0IjoiIiwicGF0aCI6Ii8iLCJ0bHMiOiIifQ=="
+	links := []string{
+		vmess,
+		"vless://3f8e2a1c-1b2d-4c5e-9f70-112233445566@example.com:443?security=tls&sni=example.com&type=ws&path=%2F#v",
+		"ss://YWVzLTI1Ni1nY206cGFzc3dvcmQ@5.6.7.8:8388#ss",
+		"trojan://s3cret@1.2.3.4:443?security=tls&sni=a.example.com#t",
+	}
+	c := core.NewAutomaticCore(false, false)
+	for _, link := range links {
+		redacted, err := utils.RedactLink(link)
+		if err != nil {
+			t.Fatalf("RedactLink(%q) = %v", link, err)
+		}
+		if strings.Contains(redacted, "3f8e2a1c") || strings.Contains(redacted, "s3cret") {
+			t.Errorf("RedactLink(%q) = %q still holds the secret", link, redacted)
+		}
+		p, err := c.CreateProtocol(redacted)
+		if err == nil {
+			err = p.Parse()
+		}
+		if err != nil {
+			t.Errorf("redacted %q does not parse: %v", redacted, err)
+		}
+	}
+	if got := utils.LinkRemark(mustRedact(t, vmess)); got != "vm" {
+		t.Errorf("vmess remark = %q, want vm", got)
+	}
+}
+
+func mustRedact(t *testing.T, link string) string {
+	t.Helper()
+	r, err := utils.RedactLink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
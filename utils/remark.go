@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// LinkRemark returns the remark of a config link: the "ps" field of a vmess link,
+// the URL fragment for everything else.
+func LinkRemark(link string) string {
+	link = strings.TrimSpace(link)
+	if rest, ok := cutScheme(link, "vmess"); ok {
+		if fields, err := decodeVmess(rest); err == nil {
+			if ps, ok := fields["ps"].(string); ok {
+				return ps
+			}
+		}
+		return ""
+	}
+	_, fragment, found := strings.Cut(link, "#")
+	if !found {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		return unescaped
+	}
+	return fragment
+}
+
+// SetLinkRemark returns the link with its remark replaced, leaving the rest of the
+// link byte-for-byte unchanged (except vmess, whose JSON payload is re-encoded).
+func SetLinkRemark(link, remark string) (string, error) {
+	link = strings.TrimSpace(link)
+	if rest, ok := cutScheme(link, "vmess"); ok {
+		fields, err := decodeVmess(rest)
+		if err != nil {
+			return "", err
+		}
+		fields["ps"] = remark
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(raw), nil
+	}
+	base, _, _ := strings.Cut(link, "#")
+	if remark == "" {
+		return base, nil
+	}
+	return base + "#" + url.PathEscape(remark), nil
+}
+
+// CountryFlag returns the flag emoji for an ISO 3166-1 alpha-2 code such as "DE",
+// or "" for anything else (including Cloudflare's "XX" and "T1" placeholders).
+func CountryFlag(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code == "XX" {
+		return ""
+	}
+	var flag []rune
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		flag = append(flag, 0x1F1E6+(c-'A')) // regional indicator symbol letters
+	}
+	return string(flag)
+}
+
+func cutScheme(link, scheme string) (string, bool) {
+	if len(link) > len(scheme)+3 && strings.EqualFold(link[:len(scheme)+3], scheme+"://") {
+		return link[len(scheme)+3:], true
+	}
+	return "", false
+}
+
+func decodeVmess(payload string) (map[string]interface{}, error) {
+	decoded, err := Base64Decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vmess payload: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return nil, fmt.Errorf("invalid vmess payload: %w", err)
+	}
+	return fields, nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// Unicode directional isolates (FSI ... PDI). Wrapping a cell in them keeps the
+// terminal's bidi algorithm from reordering it together with the columns around it.
+const (
+	firstStrongIsolate    = "\u2068"
+	popDirectionalIsolate = "\u2069"
+)
+
+// TableWriter renders tab-separated lines as aligned columns, like text/tabwriter
+// with padding and ' ' as the pad character, but measures cells by the columns
+// they take up on a terminal: East Asian wide characters and emoji count twice and
+// combining marks not at all, so Persian, Chinese and emoji remarks line up.
+// Cells containing right-to-left text are isolated from their neighbours. As with
+// tabwriter, the text after the last tab of a line is not a column and is never
+// padded. Nothing is written until Flush.
+type TableWriter struct {
+	out         io.Writer
+	padding     int
+	maxColWidth int
+	buf         bytes.Buffer
+}
+
+// NewTableWriter returns a TableWriter separating columns by padding spaces. Cells
+// wider than maxColWidth columns are truncated with "..." (0 = no limit).
+func NewTableWriter(out io.Writer, padding, maxColWidth int) *TableWriter {
+	return &TableWriter{out: out, padding: padding, maxColWidth: maxColWidth}
+}
+
+// Write buffers p; lines are laid out by Flush.
+func (t *TableWriter) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+// Flush writes the buffered lines as a table and resets the writer.
+func (t *TableWriter) Flush() error {
+	text := strings.TrimSuffix(t.buf.String(), "\n")
+	t.buf.Reset()
+	if text == "" {
+		return nil
+	}
+
+	lines := strings.Split(text, "\n")
+	rows := make([][]string, len(lines))
+	var widths []int
+	for i, line := range lines {
+		cells := strings.Split(line, "\t")
+		for j, cell := range cells {
+			if t.maxColWidth > 0 {
+				if strings.Trim(cell, "-") == "" {
+					// A header divider is shortened with its column.
+					cell = cell[:min(len(cell), t.maxColWidth)]
+				} else {
+					cell = TruncateWidth(cell, t.maxColWidth)
+				}
+				cells[j] = cell
+			}
+			// The last cell is not a column.
+			if j == len(cells)-1 {
+				break
+			}
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], uniseg.StringWidth(cell))
+		}
+		rows[i] = cells
+	}
+
+	var b strings.Builder
+	for _, cells := range rows {
+		for j, cell := range cells {
+			b.WriteString(isolateRTL(cell))
+			if j < len(cells)-1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-uniseg.StringWidth(cell)+t.padding))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(t.out, b.String())
+	return err
+}
+
+// TruncateWidth shortens s to at most width terminal columns, ending it with
+// "..." when cut. Grapheme clusters (an emoji flag, a letter with its marks) are
+// never split.
+func TruncateWidth(s string, width int) string {
+	if uniseg.StringWidth(s) <= width {
+		return s
+	}
+	if width <= 3 {
+		return strings.Repeat(".", max(width, 0))
+	}
+	var b strings.Builder
+	used, state := 0, -1
+	for rest := s; rest != ""; {
+		var cluster string
+		var w int
+		cluster, rest, w, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		if used+w > width-3 {
+			break
+		}
+		b.WriteString(cluster)
+		used += w
+	}
+	return b.String() + "..."
+}
+
+// isolateRTL wraps s in directional isolates when it contains right-to-left letters.
+func isolateRTL(s string) string {
+	for _, r := range s {
+		if unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko) {
+			return firstStrongIsolate + s + popDirectionalIsolate
+		}
+	}
+	return s
+}
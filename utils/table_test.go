@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rivo/uniseg"
+)
+
+func TestTableWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewTableWriter(&b, 2, 0)
+	w.Write([]byte("ID\tREMARK\tPROTO\n"))
+	w.Write([]byte("1\t🇩🇪 آلمان\tvless\n"))
+	w.Write([]byte("2\t香港节点\ttrojan\n"))
+	w.Write([]byte("3\tplain\tss\n"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines:\n%s", len(lines), b.String())
+	}
+	// The last column starts at the same terminal column on every line.
+	for _, line := range lines {
+		line = strings.NewReplacer(firstStrongIsolate, "", popDirectionalIsolate, "").Replace(line)
+		i := strings.LastIndex(line, "  ")
+		if got := uniseg.StringWidth(line[:i+2]); got != 14 {
+			t.Errorf("last column of %q starts at %d, want 14", line, got)
+		}
+	}
+	if !strings.Contains(lines[1], firstStrongIsolate+"🇩🇪 آلمان"+popDirectionalIsolate) {
+		t.Errorf("RTL cell not isolated: %q", lines[1])
+	}
+}
+
+func TestTruncateWidth(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"abcdefghij", 8, "abcde..."},
+		{"香港节点香港", 9, "香港节..."},
+		{"🇩🇪🇩🇪🇩🇪🇩🇪", 7, "🇩🇪🇩🇪..."},
+		{"abcdef", 2, ".."},
+	}
+	for _, tt := range tests {
+		got := TruncateWidth(tt.in, tt.width)
+		if got != tt.want || uniseg.StringWidth(got) > tt.width {
+			t.Errorf("TruncateWidth(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
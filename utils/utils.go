@@ -3,27 +3,191 @@ package utils
 import (
 	"bufio"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
 )
 
+// Base64Decode decodes standard or URL-safe base64, padded or not, ignoring
+// whitespace such as line wrapping.
 func Base64Decode(b64 string) ([]byte, error) {
-	b64 = strings.TrimSpace(b64)
-	stdb64 := b64
-	if pad := len(b64) % 4; pad != 0 {
-		stdb64 += strings.Repeat("=", 4-pad)
+	normalized := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		case '-':
+			return '+'
+		case '_':
+			return '/'
+		}
+		return r
+	}, b64)
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(normalized, "="))
+}
+
+// ConfigDedupKey returns a key that is equal for two config links pointing at the same
+// server with the same settings, regardless of their remark or query parameter order.
+// Subscriptions often republish the same server under a different name.
+func ConfigDedupKey(link string) string {
+	link = strings.TrimSpace(link)
+	scheme, rest, ok := strings.Cut(link, "://")
+	if !ok {
+		return hashKey(link)
 	}
+	scheme = strings.ToLower(scheme)
 
-	b, err := base64.StdEncoding.DecodeString(stdb64)
-	if err != nil {
-		return base64.URLEncoding.DecodeString(b64)
+	// vmess links carry their remark ("ps") inside a base64 encoded JSON object.
+	if scheme == "vmess" {
+		if decoded, err := Base64Decode(rest); err == nil {
+			var fields map[string]interface{}
+			if json.Unmarshal(decoded, &fields) == nil {
+				delete(fields, "ps")
+				if normalized, err := json.Marshal(fields); err == nil {
+					return hashKey(scheme + "://" + string(normalized))
+				}
+			}
+		}
+	}
+
+	if u, err := url.Parse(scheme + "://" + rest); err == nil {
+		u.Fragment, u.RawFragment = "", ""
+		u.RawQuery = u.Query().Encode()
+		return hashKey(u.String())
+	}
+	if i := strings.IndexByte(rest, '#'); i >= 0 {
+		rest = rest[:i]
+	}
+	return hashKey(scheme + "://" + rest)
+}
+
+// LinkNetwork returns the transport a vmess, vless or trojan link asks for ("ws",
+// "quic", ...), or "" when the link does not say.
+func LinkNetwork(link string) string {
+	if payload, ok := cutScheme(strings.TrimSpace(link), "vmess"); ok {
+		if fields, err := decodeVmess(payload); err == nil {
+			return fmt.Sprint(fields["net"])
+		}
+		return ""
+	}
+	if u, err := url.Parse(strings.TrimSpace(link)); err == nil {
+		return u.Query().Get("type")
+	}
+	return ""
+}
+
+func hashKey(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// base64Value maps the standard and URL-safe base64 alphabets to their 6-bit values;
+// other bytes map to 0xFF.
+var base64Value = func() (t [256]byte) {
+	for i := range t {
+		t[i] = 0xFF
+	}
+	const std = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	for i := 0; i < len(std); i++ {
+		t[std[i]] = byte(i)
+	}
+	t['-'], t['_'] = 62, 63
+	return t
+}()
+
+// base64StreamDecoder decodes base64 leniently and incrementally: both alphabets
+// (even mixed), with or without padding, ignoring whitespace. Padding in the middle
+// of the stream ends a chunk, as does a line break after an incomplete quantum, so
+// payloads made of several separately encoded chunks or lines decode too; a line
+// break is emitted after each such chunk.
+type base64StreamDecoder struct {
+	r       io.Reader
+	buf     []byte
+	quantum [4]byte
+	qn      int
+	out     []byte
+	err     error
+}
+
+// NewBase64StreamDecoder returns a reader that decodes a base64 stream, however
+// it is wrapped, padded or split into chunks.
+func NewBase64StreamDecoder(r io.Reader) io.Reader {
+	return &base64StreamDecoder{r: r, buf: make([]byte, 4096)}
+}
+
+func (d *base64StreamDecoder) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf)
+		for _, c := range d.buf[:n] {
+			if ferr := d.feed(c); ferr != nil {
+				err = ferr
+				break
+			}
+		}
+		if err == io.EOF {
+			d.flush()
+		}
+		d.err = err
 	}
-	return b, nil
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// feed adds one input byte to the decoder.
+func (d *base64StreamDecoder) feed(c byte) error {
+	switch c {
+	case ' ', '\t', '\r':
+		return nil
+	case '\n':
+		if d.qn > 1 {
+			d.flush()
+		}
+		return nil
+	case '=':
+		if d.qn > 1 {
+			d.flush()
+		}
+		return nil
+	}
+	v := base64Value[c]
+	if v == 0xFF {
+		return fmt.Errorf("invalid base64 character %q", c)
+	}
+	d.quantum[d.qn] = v
+	d.qn++
+	if d.qn == 4 {
+		q := d.quantum
+		d.out = append(d.out, q[0]<<2|q[1]>>4, q[1]<<4|q[2]>>2, q[2]<<6|q[3])
+		d.qn = 0
+	}
+	return nil
+}
+
+// flush decodes an incomplete quantum and ends the chunk with a line break.
+func (d *base64StreamDecoder) flush() {
+	q := d.quantum
+	switch d.qn {
+	case 2:
+		d.out = append(d.out, q[0]<<2|q[1]>>4)
+	case 3:
+		d.out = append(d.out, q[0]<<2|q[1]>>4, q[1]<<4|q[2]>>2)
+	}
+	if d.qn > 1 {
+		d.out = append(d.out, '\n')
+	}
+	d.qn = 0
 }
 
 func ParseFileByNewline(fileName string) []string {
@@ -69,6 +233,13 @@ func WriteIntoFile(fileName string, data []byte) error {
 	return nil
 }
 
+// ChunkFileName returns the name of the n-th (1-based) part of a file split into
+// chunks: configs.txt becomes configs_001.txt, configs_002.txt, ...
+func ChunkFileName(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%03d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
 const (
 	charSet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	// Storing the length of the character set avoids recalculating it.
@@ -8,10 +8,7 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/lilendian0x00/xray-knife/v9/utils/customlog"
@@ -66,17 +63,13 @@ func NewServer(listenAddr, user, pass, secret string) (*Server, error) {
 	return s, nil
 }
 
-// Run starts listening and blocks until SIGINT/SIGTERM or an error.
-func (s *Server) Run() error {
+// Run starts listening and blocks until ctx is cancelled (SIGINT/SIGTERM) or an error.
+func (s *Server) Run(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:    s.listenAddr,
 		Handler: s.router,
 	}
 
-	// Channel to receive OS signals
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
 	// Start server in a goroutine
 	errCh := make(chan error, 1)
 	go func() {
@@ -87,10 +80,10 @@ func (s *Server) Run() error {
 		close(errCh)
 	}()
 
-	// Wait for signal or server error
+	// Wait for shutdown or server error
 	select {
-	case sig := <-quit:
-		s.logger.Printf("Received signal %v, shutting down gracefully...", sig)
+	case <-ctx.Done():
+		s.logger.Println("Shutting down gracefully...")
 	case err := <-errCh:
 		if err != nil {
 			return fmt.Errorf("web server failed: %w", err)
@@ -107,10 +100,10 @@ func (s *Server) Run() error {
 	}()
 
 	// Graceful shutdown with a 3-second timeout for in-flight HTTP requests.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		s.logger.Printf("HTTP server forced to shutdown: %v", err)
 	}
 
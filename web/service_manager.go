@@ -4,27 +4,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"time"
 
 	pkghttp "github.com/lilendian0x00/xray-knife/v9/pkg/http"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/proxy"
 	"github.com/lilendian0x00/xray-knife/v9/pkg/scanner"
+	"github.com/lilendian0x00/xray-knife/v9/utils"
 )
 
 var cfScannerHistoryFile string
 var httpTesterHistoryFile string
 
-func init() {
-	home, err := os.UserHomeDir()
+// initHistoryFiles points the history files into the profile's data directory.
+// It runs once the command line, and so --profile, has been parsed.
+func initHistoryFiles() {
+	dataDir, err := utils.DataDir()
 	if err != nil {
 		// Fallback to current directory if home dir is unavailable
 		cfScannerHistoryFile = "results.csv"
 		httpTesterHistoryFile = "http-results.csv"
 		return
 	}
-	dataDir := filepath.Join(home, ".xray-knife")
 	cfScannerHistoryFile = filepath.Join(dataDir, "results.csv")
 	httpTesterHistoryFile = filepath.Join(dataDir, "http-results.csv")
 }
@@ -37,6 +38,7 @@ type ServiceManager struct {
 
 // NewServiceManager sets up the service registry and registers all available services.
 func NewServiceManager(logger *log.Logger, hub *Hub) *ServiceManager {
+	initHistoryFiles()
 	sm := &ServiceManager{
 		services: make(map[string]ManagedService),
 		done:     make(chan struct{}),
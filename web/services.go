@@ -386,7 +386,21 @@ func (ht *HttpTestRunner) consumeResults(ctx context.Context, resultsChan <-chan
 					dbRes.IPLocation = sql.NullString{String: res.IpAddrLoc, Valid: res.IpAddrLoc != "" && res.IpAddrLoc != "null"}
 					dbRes.TTFBMs = res.TTFB
 					dbRes.ConnectTimeMs = res.ConnectTime
+					dbRes.WarmDelayMs = res.WarmDelay
+					dbRes.UDP = res.UDP
+					dbRes.NATType = res.NATType
+					dbRes.SMTP = res.SMTP
+					dbRes.P2P = res.P2P
+					dbRes.Leaks = res.Leaks
 				}
+				dbRes.CertIssuer = res.CertIssuer
+				dbRes.CertSANs = res.CertSANs
+				dbRes.CertExpires = res.CertExpires
+				dbRes.CertWarnings = res.CertWarnings
+				dbRes.Failure = res.Failure
+				dbRes.BlockSignal = res.BlockSignal
+				dbRes.Mutation = res.Mutation
+				dbRes.MutatedLink = res.MutatedLink
 				dbResults = append(dbResults, dbRes)
 			}
 			if err := database.InsertHttpTestResultsBatch(runID, dbResults); err != nil {